@@ -11,18 +11,27 @@ type Cache[K comparable, V any] struct {
 	// an item is evicted. Zero means no limit.
 	MaxEntries int
 
+	// MaxSize is the maximum total size of the cache entries, as reported
+	// by SizeOf, before items are evicted. Zero means no limit.
+	MaxSize int64
+
+	// SizeOf optionally reports the size of an entry, counted against MaxSize.
+	SizeOf func(key K, value V) int64
+
 	// OnEvicted optionally specifies a callback function to be
 	// executed when an entry is purged from the cache.
 	OnEvicted func(key K, value V)
 
 	ll    *list.List
 	cache map[K]*list.Element
+	size  int64
 	mut   sync.Mutex
 }
 
 type entry[K comparable, V any] struct {
 	key   K
 	value V
+	size  int64
 }
 
 // New creates a new Cache.
@@ -47,14 +56,15 @@ func (c *Cache[K, V]) Add(key K, value V) {
 	}
 	if ee, ok := c.cache[key]; ok {
 		c.ll.MoveToFront(ee)
-		ee.Value.(*entry[K, V]).value = value
+		e := ee.Value.(*entry[K, V])
+		e.value = value
+		c.size -= e.size
+		e.size = c.sizeOf(key, value)
+		c.size += e.size
+		c.evict()
 		return
 	}
-	ele := c.ll.PushFront(&entry[K, V]{key, value})
-	c.cache[key] = ele
-	if c.MaxEntries != 0 && c.ll.Len() > c.MaxEntries {
-		c.RemoveOldest()
-	}
+	c.push(key, value)
 }
 
 // Get looks up a key's value from the cache.
@@ -89,14 +99,32 @@ func (c *Cache[K, V]) GetOrNew(key K, newFunc func() (V, bool)) (value V, ok boo
 	if !ok {
 		return value, false
 	}
-	ele := c.ll.PushFront(&entry[K, V]{key, value})
-	c.cache[key] = ele
-	if c.MaxEntries != 0 && c.ll.Len() > c.MaxEntries {
-		c.RemoveOldest()
-	}
+	c.push(key, value)
 	return value, true
 }
 
+// push adds a new entry in front of the cache, evicting the oldest ones above the limits.
+func (c *Cache[K, V]) push(key K, value V) {
+	e := &entry[K, V]{key: key, value: value, size: c.sizeOf(key, value)}
+	c.cache[key] = c.ll.PushFront(e)
+	c.size += e.size
+	c.evict()
+}
+
+// evict removes the oldest entries until the cache is within its limits.
+func (c *Cache[K, V]) evict() {
+	for c.ll.Len() > 0 && (c.MaxEntries != 0 && c.ll.Len() > c.MaxEntries || c.MaxSize != 0 && c.size > c.MaxSize) {
+		c.removeOldest()
+	}
+}
+
+func (c *Cache[K, V]) sizeOf(key K, value V) int64 {
+	if c.SizeOf == nil {
+		return 0
+	}
+	return c.SizeOf(key, value)
+}
+
 // Remove removes the provided key from the cache.
 func (c *Cache[K, V]) Remove(key K) {
 	c.mut.Lock()
@@ -118,6 +146,10 @@ func (c *Cache[K, V]) RemoveOldest() {
 	if c.cache == nil {
 		return
 	}
+	c.removeOldest()
+}
+
+func (c *Cache[K, V]) removeOldest() {
 	ele := c.ll.Back()
 	if ele != nil {
 		c.removeElement(ele)
@@ -128,6 +160,7 @@ func (c *Cache[K, V]) removeElement(e *list.Element) {
 	c.ll.Remove(e)
 	kv := e.Value.(*entry[K, V])
 	delete(c.cache, kv.key)
+	c.size -= kv.size
 	if c.OnEvicted != nil {
 		c.OnEvicted(kv.key, kv.value)
 	}
@@ -144,6 +177,14 @@ func (c *Cache[K, V]) Len() int {
 	return c.ll.Len()
 }
 
+// Size returns the total size of the items in the cache, as reported by SizeOf.
+func (c *Cache[K, V]) Size() int64 {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	return c.size
+}
+
 // Clear purges all stored items from the cache.
 func (c *Cache[K, V]) Clear() {
 	c.mut.Lock()
@@ -157,4 +198,5 @@ func (c *Cache[K, V]) Clear() {
 	}
 	c.ll = nil
 	c.cache = nil
+	c.size = 0
 }
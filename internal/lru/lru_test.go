@@ -0,0 +1,66 @@
+package lru
+
+import "testing"
+
+func TestEvictOldest(t *testing.T) {
+	var evicted []string
+	c := New[string, int](2)
+	c.OnEvicted = func(key string, _ int) {
+		evicted = append(evicted, key)
+	}
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Get("a")
+	c.Add("c", 3)
+	if _, ok := c.Get("b"); ok {
+		t.Error("Expected least recently used entry to be evicted")
+	}
+
+	c.GetOrNew("d", func() (int, bool) { return 4, true })
+	if _, ok := c.Get("a"); ok {
+		t.Error("Expected least recently used entry to be evicted")
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", c.Len())
+	}
+	if len(evicted) != 2 || evicted[0] != "b" || evicted[1] != "a" {
+		t.Errorf("evicted = %v, want [b a]", evicted)
+	}
+}
+
+func TestEvictAboveMaxSize(t *testing.T) {
+	var evicted []string
+	c := New[string, string](0)
+	c.MaxSize = 10
+	c.SizeOf = func(_ string, value string) int64 {
+		return int64(len(value))
+	}
+	c.OnEvicted = func(key string, _ string) {
+		evicted = append(evicted, key)
+	}
+
+	c.Add("a", "1234")
+	c.Add("b", "1234")
+	c.Get("a")
+	c.Add("c", "1234")
+	if _, ok := c.Get("b"); ok {
+		t.Error("Expected least recently used entry to be evicted")
+	}
+	if c.Size() != 8 {
+		t.Errorf("Size() = %d, want 8", c.Size())
+	}
+
+	c.Add("a", "1234567")
+	if _, ok := c.Get("c"); ok {
+		t.Error("Expected entry to be evicted when another one grows")
+	}
+
+	c.Add("d", "12345678901")
+	if c.Len() != 0 || c.Size() != 0 {
+		t.Errorf("Expected an entry larger than MaxSize to empty the cache, got Len() = %d, Size() = %d", c.Len(), c.Size())
+	}
+	if len(evicted) != 4 || evicted[0] != "b" || evicted[1] != "c" || evicted[2] != "a" || evicted[3] != "d" {
+		t.Errorf("evicted = %v, want [b c a d]", evicted)
+	}
+}
@@ -7,11 +7,21 @@ import (
 
 	"github.com/gorilla/mux"
 
+	"github.com/matrixhub-ai/hfd/internal/lru"
+	"github.com/matrixhub-ai/hfd/pkg/convert"
+	"github.com/matrixhub-ai/hfd/pkg/gguf"
 	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/maintenance"
 	"github.com/matrixhub-ai/hfd/pkg/mirror"
+	"github.com/matrixhub-ai/hfd/pkg/modeltree"
 	"github.com/matrixhub-ai/hfd/pkg/permission"
+	"github.com/matrixhub-ai/hfd/pkg/pushmirror"
 	"github.com/matrixhub-ai/hfd/pkg/receive"
 	"github.com/matrixhub-ai/hfd/pkg/repository"
+	"github.com/matrixhub-ai/hfd/pkg/safetensors"
+	"github.com/matrixhub-ai/hfd/pkg/scan"
+	"github.com/matrixhub-ai/hfd/pkg/secrets"
+	"github.com/matrixhub-ai/hfd/pkg/signature"
 	"github.com/matrixhub-ai/hfd/pkg/storage"
 )
 
@@ -21,10 +31,30 @@ type Handler struct {
 	root                *mux.Router
 	next                http.Handler
 	lfsStorage          lfs.Storage
+	lfsTeeCache         *lfs.TeeCache
 	permissionHookFunc  permission.PermissionHookFunc
 	preReceiveHookFunc  receive.PreReceiveHookFunc
 	postReceiveHookFunc receive.PostReceiveHookFunc
+	quarantineHookFunc  receive.QuarantineHookFunc
 	mirror              *mirror.Mirror
+	pushMirror          *pushmirror.PushMirror
+	maintenance         *maintenance.Scheduler
+	archiveDir          string
+	archives            *lru.Cache[string, cachedArchive]
+	signer              *signature.Signer
+	committerName       string
+	committerEmail      string
+	verifier            *signature.Verifier
+	signaturePolicy     *signature.Policy
+	safetensors         *safetensors.Indexer
+	gguf                *gguf.Indexer
+	notebooks           *lru.Cache[string, []byte]
+	validateCards       bool
+	modelTree           *modeltree.Index
+	converter           *convert.Converter
+	scanner             *scan.Scanner
+	blockUnsafeFiles    bool
+	secretScanner       *secrets.Scanner
 }
 
 // Option defines a functional option for configuring the Handler.
@@ -59,6 +89,14 @@ func WithPreReceiveHookFunc(fn receive.PreReceiveHookFunc) Option {
 	}
 }
 
+// WithQuarantineHookFunc sets the hook called with the objects of a bundle import before they are stored,
+// and with the branches and tags created by the API before they are. If the hook returns an error, the update is rejected.
+func WithQuarantineHookFunc(fn receive.QuarantineHookFunc) Option {
+	return func(h *Handler) {
+		h.quarantineHookFunc = fn
+	}
+}
+
 // WithPostReceiveHookFunc sets the post-receive hook called after a git push is processed.
 // Errors from this hook are logged but do not affect the push result.
 func WithPostReceiveHookFunc(fn receive.PostReceiveHookFunc) Option {
@@ -74,6 +112,14 @@ func WithLFSStorage(storage lfs.Storage) Option {
 	}
 }
 
+// WithLFSTeeCache sets the cache of the LFS objects being fetched from a proxy source,
+// whose headers are read before the fetch completes.
+func WithLFSTeeCache(c *lfs.TeeCache) Option {
+	return func(h *Handler) {
+		h.lfsTeeCache = c
+	}
+}
+
 // WithMirror sets the mirror to use for repository synchronization. If not provided,
 // a mirror will be created when mirrorSourceFunc is set.
 func WithMirror(m *mirror.Mirror) Option {
@@ -82,15 +128,158 @@ func WithMirror(m *mirror.Mirror) Option {
 	}
 }
 
+// WithPushMirror sets the push mirror whose replication status is exposed by the API.
+func WithPushMirror(p *pushmirror.PushMirror) Option {
+	return func(h *Handler) {
+		h.pushMirror = p
+	}
+}
+
+// WithMaintenance sets the maintenance scheduler whose status is exposed, and runs are triggered, by the API.
+func WithMaintenance(s *maintenance.Scheduler) Option {
+	return func(h *Handler) {
+		h.maintenance = s
+	}
+}
+
+// WithArchiveDir sets the directory the most recently downloaded repository archives are kept in,
+// so downloading them again, or resuming their download with range requests, does not rebuild them.
+// Without it, archives are built for every download.
+func WithArchiveDir(dir string) Option {
+	return func(h *Handler) {
+		h.archiveDir = dir
+	}
+}
+
+// WithCommitSigner sets the key the commits and annotated tags made by the server are signed with.
+func WithCommitSigner(signer *signature.Signer) Option {
+	return func(h *Handler) {
+		h.signer = signer
+	}
+}
+
+// WithCommitter sets the committer of the commits made by the server, which otherwise are
+// committed by their author. It is also the author when the user is not known.
+func WithCommitter(name string, email string) Option {
+	return func(h *Handler) {
+		h.committerName = name
+		h.committerEmail = email
+	}
+}
+
+// WithSignatureVerifier sets the verifier the signatures of commits are reported with,
+// so that it trusts the keys of the users and shares its results with the verification done on push.
+func WithSignatureVerifier(verifier *signature.Verifier) Option {
+	return func(h *Handler) {
+		h.verifier = verifier
+	}
+}
+
+// WithSignaturePolicy sets the policy of the refs only verified commits and tags can be pushed to.
+// The server only commits to them when it signs its commits with the signer of WithCommitSigner,
+// as the committer email of WithCommitter its key is trusted for.
+func WithSignaturePolicy(policy *signature.Policy) Option {
+	return func(h *Handler) {
+		h.signaturePolicy = policy
+	}
+}
+
+// WithSafetensors sets the indexer the safetensors weights of models are described with,
+// so that it shares its cached parameter counts with the indexing done after pushes.
+// If not provided, the headers are read from the LFS storage and tee cache of the handler.
+func WithSafetensors(indexer *safetensors.Indexer) Option {
+	return func(h *Handler) {
+		h.safetensors = indexer
+	}
+}
+
+// WithGGUF sets the indexer the GGUF models of repositories are described with,
+// so that it shares the descriptions made after pushes.
+// If not provided, the headers are read from the LFS storage and tee cache of the handler.
+func WithGGUF(indexer *gguf.Indexer) Option {
+	return func(h *Handler) {
+		h.gguf = indexer
+	}
+}
+
+// WithCardValidation sets whether commits changing README.md are rejected when its metadata is invalid,
+// as validated by the validate-yaml endpoint.
+func WithCardValidation(enabled bool) Option {
+	return func(h *Handler) {
+		h.validateCards = enabled
+	}
+}
+
+// WithModelTree sets the index of base model relations that "base_model:" list filters are answered from,
+// and that deleted and moved repositories are dropped from or renamed in.
+func WithModelTree(x *modeltree.Index) Option {
+	return func(h *Handler) {
+		h.modelTree = x
+	}
+}
+
+// WithConverter sets the converter of datasets to Parquet whose status is exposed, and runs are triggered, by the API.
+func WithConverter(c *convert.Converter) Option {
+	return func(h *Handler) {
+		h.converter = c
+	}
+}
+
+// WithScanner sets the scanner of unsafe files whose results are exposed by the scan endpoint
+// and the securityFileStatus of expanded tree entries.
+func WithScanner(s *scan.Scanner) Option {
+	return func(h *Handler) {
+		h.scanner = s
+	}
+}
+
+// WithBlockUnsafeFiles sets whether commits adding files the scanner finds unsafe are rejected.
+func WithBlockUnsafeFiles(enabled bool) Option {
+	return func(h *Handler) {
+		h.blockUnsafeFiles = enabled
+	}
+}
+
+// WithSecretScanner sets the scanner of the secrets in the files of commits, which warns about them or rejects the commits.
+func WithSecretScanner(s *secrets.Scanner) Option {
+	return func(h *Handler) {
+		h.secretScanner = s
+	}
+}
+
 // NewHandler creates a new Handler with the given repository directory.
 func NewHandler(opts ...Option) *Handler {
 	h := &Handler{
-		root: mux.NewRouter(),
+		root:      mux.NewRouter(),
+		notebooks: newNotebookCache(),
 	}
 
 	for _, opt := range opts {
 		opt(h)
 	}
+	if h.archiveDir != "" {
+		h.archives = newArchiveCache(h.archiveDir)
+	}
+	if h.safetensors == nil {
+		h.safetensors = safetensors.NewIndexer(
+			safetensors.WithLFSStorage(h.lfsStorage),
+			safetensors.WithTeeCache(h.lfsTeeCache),
+		)
+	}
+	if h.gguf == nil {
+		h.gguf = gguf.NewIndexer(
+			gguf.WithLFSStorage(h.lfsStorage),
+			gguf.WithTeeCache(h.lfsTeeCache),
+		)
+	}
+	if h.verifier == nil {
+		h.verifier = signature.NewVerifier()
+	}
+	if h.signer != nil && h.committerEmail != "" {
+		// The server key is only trusted for the commits the server is the committer of,
+		// not to vouch for the identity of its users.
+		h.verifier.TrustSigner(h.signer, h.committerEmail)
+	}
 
 	h.register()
 	return h
@@ -125,6 +314,10 @@ func (h *Handler) registryHuggingFace(r *mux.Router) {
 	r.HandleFunc("/api/repos/delete", h.handleDeleteRepo).Methods(http.MethodDelete)
 	r.HandleFunc("/api/repos/move", h.handleMoveRepo).Methods(http.MethodPost)
 
+	// Server administration endpoints
+	r.HandleFunc("/api/admin/maintenance", h.handleAdminMaintenanceStatus).Methods(http.MethodGet)
+	r.HandleFunc("/api/admin/maintenance", h.handleAdminMaintenanceRun).Methods(http.MethodPost)
+
 	// YAML validation endpoint - used by huggingface_hub to validate README YAML front matter
 	r.HandleFunc("/api/validate-yaml", h.handleValidateYAML).Methods(http.MethodPost)
 
@@ -139,13 +332,29 @@ func (h *Handler) registryHuggingFace(r *mux.Router) {
 	r.HandleFunc("/api/{repoType:models|datasets|spaces}/{namespace}/{repo}/commits/{rev}", h.handleListCommits).Methods(http.MethodGet)
 	r.HandleFunc("/api/{repoType:models|datasets|spaces}/{namespace}/{repo}/compare/{compare}", h.handleCompare).Methods(http.MethodGet)
 	r.HandleFunc("/api/{repoType:models|datasets|spaces}/{namespace}/{repo}/super-squash/{rev}", h.handleSuperSquash).Methods(http.MethodPost)
+	r.HandleFunc("/api/{repoType:models|datasets|spaces}/{namespace}/{repo}/push-mirrors", h.handlePushMirrorStatus).Methods(http.MethodGet)
+	r.HandleFunc("/api/{repoType:models|datasets|spaces}/{namespace}/{repo}/push-mirrors/sync", h.handlePushMirrorSync).Methods(http.MethodPost)
+	r.HandleFunc("/api/{repoType:models|datasets|spaces}/{namespace}/{repo}/maintenance", h.handleMaintenanceStatus).Methods(http.MethodGet)
+	r.HandleFunc("/api/{repoType:models|datasets|spaces}/{namespace}/{repo}/maintenance", h.handleMaintenanceRun).Methods(http.MethodPost)
+	r.HandleFunc("/api/{repoType:models|datasets|spaces}/{namespace}/{repo}/archive/{archive:.+}", h.handleArchive).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/api/{repoType:models|datasets|spaces}/{namespace}/{repo}/bundle", h.handleBundleExport).Methods(http.MethodGet)
+	r.HandleFunc("/api/{repoType:models|datasets|spaces}/{namespace}/{repo}/bundle", h.handleBundleImport).Methods(http.MethodPost)
+	r.HandleFunc("/api/{repoType:models|datasets|spaces}/{namespace}/{repo}/scan", h.handleScan).Methods(http.MethodGet)
+	r.HandleFunc("/api/{repoType:datasets}/{namespace}/{repo}/configs", h.handleDatasetConfigs).Methods(http.MethodGet)
+	r.HandleFunc("/api/{repoType:datasets}/{namespace}/{repo}/configs/{rev}", h.handleDatasetConfigs).Methods(http.MethodGet)
+	r.HandleFunc("/api/{repoType:datasets}/{namespace}/{repo}/parquet", h.handleParquetFiles).Methods(http.MethodGet)
+	r.HandleFunc("/api/{repoType:datasets}/{namespace}/{repo}/parquet/{config}", h.handleParquetFiles).Methods(http.MethodGet)
+	r.HandleFunc("/api/{repoType:datasets}/{namespace}/{repo}/parquet/{config}/{split}", h.handleParquetFiles).Methods(http.MethodGet)
+	r.HandleFunc("/api/{repoType:datasets}/{namespace}/{repo}/convert/parquet", h.handleParquetStatus).Methods(http.MethodGet)
+	r.HandleFunc("/api/{repoType:datasets}/{namespace}/{repo}/convert/parquet", h.handleParquetRun).Methods(http.MethodPost)
 
 	// API endpoints for all repo types (models, datasets, spaces)
 	r.HandleFunc("/api/{repoType:models|datasets|spaces}/{namespace}/{repo}/preupload/{rev}", h.handlePreupload).Methods(http.MethodPost)
 	r.HandleFunc("/api/{repoType:models|datasets|spaces}/{namespace}/{repo}/commit/{rev}", h.handleCommit).Methods(http.MethodPost)
 	r.HandleFunc("/api/{repoType:models|datasets|spaces}/{namespace}/{repo}/treesize/{revpath:.*}", h.handleTreeSize).Methods(http.MethodGet)
+	r.HandleFunc("/api/{repoType:models|datasets|spaces}/{namespace}/{repo}/notebook/{revpath:.*}", h.handleNotebook).Methods(http.MethodGet)
 	r.HandleFunc("/api/{repoType:models|datasets|spaces}/{namespace}/{repo}/tree/{revpath:.*}", h.handleTree).Methods(http.MethodGet)
-	r.HandleFunc("/api/{repoType:models|datasets|spaces}/{namespace}/{repo}/revision/{rev}", h.handleInfoRevision).Methods(http.MethodGet)
+	r.HandleFunc("/api/{repoType:models|datasets|spaces}/{namespace}/{repo}/revision/{rev:.+}", h.handleInfoRevision).Methods(http.MethodGet)
 	r.HandleFunc("/api/{repoType:models|datasets|spaces}/{namespace}/{repo}", h.handleInfoRevision).Methods(http.MethodGet)
 	r.HandleFunc("/api/{repoType:models|datasets|spaces}", h.handleList).Methods(http.MethodGet)
 
@@ -0,0 +1,299 @@
+package hf
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/matrixhub-ai/hfd/internal/lru"
+	"github.com/matrixhub-ai/hfd/internal/utils"
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/mirror"
+	"github.com/matrixhub-ai/hfd/pkg/permission"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+)
+
+const (
+	// maxCachedArchives is the number of archives kept in the archive directory.
+	maxCachedArchives = 16
+	// maxCachedArchivesSize is the total size of the archives kept in the archive directory.
+	maxCachedArchivesSize = 4 << 30
+)
+
+// cachedArchive is an archive stored in the archive directory.
+type cachedArchive struct {
+	file string
+	size int64
+}
+
+// archiveContentTypes maps the archive formats to their content types.
+var archiveContentTypes = map[repository.ArchiveFormat]string{
+	repository.ArchiveTarGz: "application/gzip",
+	repository.ArchiveZip:   "application/zip",
+}
+
+// newArchiveCache creates the cache of the archives stored in dir, removing the archives of a previous process.
+func newArchiveCache(dir string) *lru.Cache[string, cachedArchive] {
+	_ = os.RemoveAll(dir)
+	c := lru.New[string, cachedArchive](maxCachedArchives)
+	c.MaxSize = maxCachedArchivesSize
+	c.SizeOf = func(key string, archive cachedArchive) int64 {
+		return archive.size
+	}
+	c.OnEvicted = func(key string, archive cachedArchive) {
+		_ = os.Remove(archive.file)
+	}
+	return c
+}
+
+// handleArchive handles GET /api/{repoType}/{namespace}/{repo}/archive/{rev}.tar.gz and .zip
+// It downloads the files of a revision, or of the directory given by the path query parameter,
+// as a single archive. LFS files are archived with their content rather than their pointer files.
+func (h *Handler) handleArchive(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	ri := getRepoInformation(r)
+
+	if h.permissionHookFunc != nil {
+		if ok, err := h.permissionHookFunc(r.Context(), permission.OperationReadRepo, ri.RepoName, permission.Context{}); err != nil {
+			responseJSON(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if !ok {
+			responseJSON(w, "permission denied", http.StatusForbidden)
+			return
+		}
+	}
+
+	rev, format, ok := parseArchiveName(vars["archive"])
+	if !ok {
+		responseJSON(w, fmt.Errorf("unsupported archive %q, expected {revision}.tar.gz or {revision}.zip", vars["archive"]), http.StatusBadRequest)
+		return
+	}
+	treePath := strings.Trim(r.URL.Query().Get("path"), "/")
+
+	repoPath := h.storage.ResolvePath(ri.RepoName)
+	if repoPath == "" {
+		responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
+		return
+	}
+
+	repo, err := h.openRepo(r.Context(), repoPath, ri.RepoName, repository.GitUploadPack)
+	if err != nil {
+		if errors.Is(err, repository.ErrRepositoryNotExists) {
+			responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, mirror.ErrUpstreamUnavailable) {
+			responseJSON(w, fmt.Errorf("repository %q is not available: %v", ri.RepoName, err), http.StatusServiceUnavailable)
+			return
+		}
+		responseJSON(w, fmt.Errorf("failed to open repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
+		return
+	}
+
+	commit, err := repo.ResolveRevision(rev)
+	if err != nil {
+		responseJSON(w, fmt.Errorf("revision %q not found in repository %q", rev, ri.RepoName), http.StatusNotFound)
+		return
+	}
+
+	name := fmt.Sprintf("%s-%s", path.Base(ri.RepoName), commit[:12])
+	key := archiveKey(ri.RepoName, commit, treePath, format)
+	etag := fmt.Sprintf("\"%s\"", key)
+
+	header := w.Header()
+	header.Set("X-Repo-Commit", commit)
+	header.Set("ETag", etag)
+	header.Set("Content-Type", archiveContentTypes[format])
+	header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"."+string(format)))
+
+	// Archives of a commit never change, so cached copies are always valid.
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if h.serveCachedArchive(w, r, key) {
+		return
+	}
+
+	files, err := repo.ArchiveFiles(commit, treePath)
+	if err != nil {
+		responseJSON(w, fmt.Errorf("path %q not found in repository %q at revision %q: %v", treePath, ri.RepoName, rev, err), http.StatusNotFound)
+		return
+	}
+
+	// Make sure every LFS object can be read before the archive is written,
+	// as errors cannot be reported once the response has started.
+	opts := &repository.ArchiveOptions{Prefix: name}
+	if h.lfsStorage != nil {
+		if err := h.prepareLFSObjects(r.Context(), ri.RepoName, files); err != nil {
+			if errors.Is(err, mirror.ErrUpstreamUnavailable) {
+				responseJSON(w, err, http.StatusServiceUnavailable)
+				return
+			}
+			responseJSON(w, err, http.StatusNotFound)
+			return
+		}
+		opts.OpenLFS = func(ptr *lfs.Pointer) (io.ReadCloser, error) {
+			return h.openLFSObject(r.Context(), ptr.OID())
+		}
+	}
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	var out io.Writer = w
+	var tmp *os.File
+	if h.archives != nil {
+		if err := os.MkdirAll(h.archiveDir, 0750); err == nil {
+			tmp, err = os.CreateTemp(h.archiveDir, key+".*.tmp")
+			if err != nil {
+				slog.WarnContext(r.Context(), "Failed to cache archive", "repo", ri.RepoName, "error", err)
+			}
+		}
+	}
+	if tmp != nil {
+		out = io.MultiWriter(w, tmp)
+	}
+
+	err = repo.WriteArchive(out, commit, treePath, format, opts)
+	if tmp != nil {
+		var info os.FileInfo
+		if err == nil {
+			info, err = tmp.Stat()
+		}
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		// Archives too large for the cache are not kept.
+		keep := err == nil && info.Size() <= maxCachedArchivesSize
+		file := filepath.Join(h.archiveDir, key)
+		if keep {
+			err = os.Rename(tmp.Name(), file)
+		}
+		if keep && err == nil {
+			h.archives.Add(key, cachedArchive{file: file, size: info.Size()})
+		} else {
+			_ = os.Remove(tmp.Name())
+		}
+	}
+	if err != nil {
+		// The response has started, so the error can only be logged.
+		slog.WarnContext(r.Context(), "Failed to write archive", "repo", ri.RepoName, "rev", rev, "error", err)
+	}
+}
+
+// serveCachedArchive serves the archive stored under key, supporting range requests.
+// It reports false if the archive is not stored.
+func (h *Handler) serveCachedArchive(w http.ResponseWriter, r *http.Request, key string) bool {
+	if h.archives == nil {
+		return false
+	}
+	archive, ok := h.archives.Get(key)
+	if !ok {
+		return false
+	}
+	f, err := os.Open(archive.file)
+	if err != nil {
+		return false
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	http.ServeContent(w, r, "", time.Time{}, f)
+	return true
+}
+
+// prepareLFSObjects checks that the LFS objects of the files are stored, starting to fetch
+// the missing ones through the mirror.
+func (h *Handler) prepareLFSObjects(ctx context.Context, repoName string, files []repository.ArchiveFile) error {
+	var missing []lfs.LFSObject
+	seen := map[string]bool{}
+	for _, f := range files {
+		if f.LFS == nil || seen[f.LFS.OID()] {
+			continue
+		}
+		seen[f.LFS.OID()] = true
+		if !h.lfsStorage.Exists(f.LFS.OID()) {
+			missing = append(missing, lfs.LFSObject{Oid: f.LFS.OID(), Size: f.LFS.Size()})
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if h.mirror != nil {
+		sourceURL, started, err := h.mirror.StartLFSFetch(ctx, repoName, missing)
+		if err != nil {
+			return fmt.Errorf("failed to fetch LFS objects from upstream source %q: %w", sourceURL, err)
+		}
+		if started {
+			return nil
+		}
+	}
+	return fmt.Errorf("LFS object %q not found in repository %q", missing[0].Oid, repoName)
+}
+
+// openLFSObject opens the content of an LFS object, reading it from the mirror while it is being fetched.
+func (h *Handler) openLFSObject(ctx context.Context, oid string) (io.ReadCloser, error) {
+	if h.mirror != nil {
+		if pf := h.mirror.Get(oid); pf != nil {
+			return pf.NewReadSeeker(), nil
+		}
+		h.mirror.Touch(oid)
+	}
+
+	switch s := h.lfsStorage.(type) {
+	case lfs.Getter:
+		content, _, err := s.Get(oid)
+		return content, err
+	case lfs.SignGetter:
+		url, err := s.SignGet(oid)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := utils.HTTPClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			_ = resp.Body.Close()
+			return nil, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		return resp.Body, nil
+	default:
+		return nil, fmt.Errorf("LFS storage does not support content retrieval")
+	}
+}
+
+// parseArchiveName splits an archive name into its revision and format.
+func parseArchiveName(archive string) (string, repository.ArchiveFormat, bool) {
+	for _, format := range repository.ArchiveFormats {
+		if rev, ok := strings.CutSuffix(archive, "."+string(format)); ok && rev != "" {
+			return rev, format, true
+		}
+	}
+	return "", "", false
+}
+
+// archiveKey identifies the archive of the files under treePath at a commit of a repository.
+// The repository is part of the key, as the archived files are prefixed with its name.
+func archiveKey(repoName string, commit string, treePath string, format repository.ArchiveFormat) string {
+	sum := sha256.Sum256([]byte(repoName + "\x00" + commit + "\x00" + treePath + "\x00" + string(format)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,168 @@
+package hf
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/storage"
+)
+
+func getArchive(t *testing.T, url string, header http.Header) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to get archive: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+	return resp, body
+}
+
+func TestHuggingFaceArchive(t *testing.T) {
+	dataDir := t.TempDir()
+	store := storage.NewStorage(storage.WithRootDir(dataDir))
+	lfsStorage := lfs.NewLocal(store.LFSDir())
+	server := httptest.NewServer(NewHandler(
+		WithStorage(store),
+		WithLFSStorage(lfsStorage),
+		WithArchiveDir(filepath.Join(dataDir, "archive-cache")),
+	))
+	t.Cleanup(server.Close)
+	endpoint := server.URL
+
+	resp, err := http.Post(endpoint+"/api/repos/create", "application/json", strings.NewReader(`{"type":"model","name":"archive-model","organization":"test-user"}`))
+	if err != nil {
+		t.Fatalf("Failed to create repo: %v", err)
+	}
+	resp.Body.Close()
+
+	weights := bytes.Repeat([]byte("weights"), 1000)
+	sum := sha256.Sum256(weights)
+	oid := hex.EncodeToString(sum[:])
+	if err := lfsStorage.Put(oid, bytes.NewReader(weights), int64(len(weights))); err != nil {
+		t.Fatalf("Failed to store LFS object: %v", err)
+	}
+
+	ndjson := "{\"key\":\"header\",\"value\":{\"summary\":\"Add files\"}}\n" +
+		"{\"key\":\"file\",\"value\":{\"content\":\"# Model\\n\",\"path\":\"README.md\",\"encoding\":\"utf-8\"}}\n" +
+		"{\"key\":\"file\",\"value\":{\"content\":\"{}\",\"path\":\"configs/config.json\",\"encoding\":\"utf-8\"}}\n" +
+		fmt.Sprintf("{\"key\":\"lfsFile\",\"value\":{\"path\":\"model.bin\",\"algo\":\"sha256\",\"oid\":%q,\"size\":%d}}\n", oid, len(weights))
+	resp, err = http.Post(endpoint+"/api/models/test-user/archive-model/commit/main", "application/x-ndjson", strings.NewReader(ndjson))
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 for commit, got %d", resp.StatusCode)
+	}
+
+	archiveURL := endpoint + "/api/models/test-user/archive-model/archive/main.tar.gz"
+	resp, body := getArchive(t, archiveURL, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	commit := resp.Header.Get("X-Repo-Commit")
+	prefix := "archive-model-" + commit[:12] + "/"
+
+	gr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to read gzip: %v", err)
+	}
+	tr := tar.NewReader(gr)
+	var names []string
+	files := map[string][]byte{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read tar: %v", err)
+		}
+		content, _ := io.ReadAll(tr)
+		names = append(names, hdr.Name)
+		files[hdr.Name] = content
+	}
+	wantNames := []string{prefix + ".gitattributes", prefix + "README.md", prefix + "configs/config.json", prefix + "model.bin"}
+	if fmt.Sprint(names) != fmt.Sprint(wantNames) {
+		t.Errorf("Expected entries %v, got %v", wantNames, names)
+	}
+	if !bytes.Equal(files[prefix+"model.bin"], weights) {
+		t.Errorf("Expected the LFS content in the archive, got %d bytes", len(files[prefix+"model.bin"]))
+	}
+
+	// The archive is cached by commit: downloading it again gives the same bytes, and ranges are served.
+	resp, again := getArchive(t, archiveURL, nil)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, again) {
+		t.Errorf("Expected the same archive again, got %d", resp.StatusCode)
+	}
+	resp, part := getArchive(t, archiveURL, http.Header{"Range": {"bytes=10-19"}})
+	if resp.StatusCode != http.StatusPartialContent || !bytes.Equal(part, body[10:20]) {
+		t.Errorf("Expected partial content, got %d", resp.StatusCode)
+	}
+	resp, _ = getArchive(t, archiveURL, http.Header{"If-None-Match": {resp.Header.Get("ETag")}})
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("Expected 304, got %d", resp.StatusCode)
+	}
+
+	resp, body = getArchive(t, endpoint+"/api/models/test-user/archive-model/archive/"+commit+".zip?path=configs", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 for zip, got %d: %s", resp.StatusCode, body)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+	if len(zr.File) != 1 || zr.File[0].Name != prefix+"configs/config.json" {
+		t.Errorf("Expected only the config in the zip, got %d files", len(zr.File))
+	}
+
+	resp, _ = getArchive(t, endpoint+"/api/models/test-user/archive-model/archive/main.rar", nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unsupported format, got %d", resp.StatusCode)
+	}
+	resp, _ = getArchive(t, endpoint+"/api/models/test-user/archive-model/archive/missing.zip", nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for missing revision, got %d", resp.StatusCode)
+	}
+	// The archive of the same commit in another repository is prefixed with the name of that repository.
+	resp, err = http.Post(endpoint+"/api/repos/move", "application/json",
+		strings.NewReader(`{"fromRepo":"test-user/archive-model","toRepo":"test-user/renamed-model","type":"model"}`))
+	if err != nil {
+		t.Fatalf("Failed to move repo: %v", err)
+	}
+	resp.Body.Close()
+	resp, body = getArchive(t, endpoint+"/api/models/test-user/renamed-model/archive/"+commit+".zip?path=configs", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 for zip, got %d: %s", resp.StatusCode, body)
+	}
+	zr, err = zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+	if want := "renamed-model-" + commit[:12] + "/configs/config.json"; len(zr.File) != 1 || zr.File[0].Name != want {
+		t.Errorf("Expected %s in the zip, got %d files", want, len(zr.File))
+	}
+}
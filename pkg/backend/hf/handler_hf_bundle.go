@@ -0,0 +1,161 @@
+package hf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+
+	"github.com/matrixhub-ai/hfd/pkg/bundle"
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/mirror"
+	"github.com/matrixhub-ai/hfd/pkg/permission"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+)
+
+// handleBundleExport handles GET /api/{repoType}/{namespace}/{repo}/bundle
+// It exports the repository as a bundle archive for offline transfer. The ref query parameters select
+// the exported branches and tags, and the since query parameters make the archive relative to the
+// commits of a previous export.
+func (h *Handler) handleBundleExport(w http.ResponseWriter, r *http.Request) {
+	ri := getRepoInformation(r)
+
+	if h.permissionHookFunc != nil {
+		if ok, err := h.permissionHookFunc(r.Context(), permission.OperationReadRepo, ri.RepoName, permission.Context{}); err != nil {
+			responseJSON(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if !ok {
+			responseJSON(w, "permission denied", http.StatusForbidden)
+			return
+		}
+	}
+
+	repoPath := h.storage.ResolvePath(ri.RepoName)
+	if repoPath == "" {
+		responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
+		return
+	}
+
+	repo, err := h.openRepo(r.Context(), repoPath, ri.RepoName, repository.GitUploadPack)
+	if err != nil {
+		if errors.Is(err, repository.ErrRepositoryNotExists) {
+			responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, mirror.ErrUpstreamUnavailable) {
+			responseJSON(w, fmt.Errorf("repository %q is not available: %v", ri.RepoName, err), http.StatusServiceUnavailable)
+			return
+		}
+		responseJSON(w, fmt.Errorf("failed to open repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	opts := bundle.ExportOptions{
+		Refs:  query["ref"],
+		Since: query["since"],
+	}
+	if h.lfsStorage != nil {
+		opts.OpenLFS = func(ptr *lfs.Pointer) (io.ReadCloser, error) {
+			return h.openLFSObject(r.Context(), ptr.OID())
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(ri.RepoName)+".bundle.tar"))
+
+	out := &trackingWriter{w: w}
+	if err := bundle.Export(r.Context(), out, ri.RepoName, repo, opts); err != nil {
+		if out.written {
+			// The response has started, so the error can only be logged.
+			slog.WarnContext(r.Context(), "Failed to export bundle", "repo", ri.RepoName, "error", err)
+			return
+		}
+		w.Header().Del("Content-Disposition")
+		w.Header().Del("Content-Type")
+		if errors.Is(err, bundle.ErrUnknownRevision) {
+			responseJSON(w, fmt.Errorf("failed to export repository %q: %v", ri.RepoName, err), http.StatusNotFound)
+			return
+		}
+		responseJSON(w, fmt.Errorf("failed to export repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
+	}
+}
+
+// handleBundleImport handles POST /api/{repoType}/{namespace}/{repo}/bundle
+// It creates or updates the repository from a bundle archive written by the export endpoint.
+// Branches are only fast-forwarded and existing tags kept, unless the force query parameter is true.
+func (h *Handler) handleBundleImport(w http.ResponseWriter, r *http.Request) {
+	ri := getRepoInformation(r)
+
+	repoPath := h.storage.ResolvePath(ri.RepoName)
+	exists := repoPath != "" && repository.IsRepository(repoPath)
+
+	if h.permissionHookFunc != nil {
+		op := permission.OperationUpdateRepo
+		if !exists {
+			op = permission.OperationCreateRepo
+		}
+		if ok, err := h.permissionHookFunc(r.Context(), op, ri.RepoName, permission.Context{}); err != nil {
+			responseJSON(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if !ok {
+			responseJSON(w, "permission denied", http.StatusForbidden)
+			return
+		}
+	}
+
+	if repoPath == "" {
+		responseJSON(w, fmt.Errorf("invalid repository name: %q", ri.RepoName), http.StatusBadRequest)
+		return
+	}
+
+	// Mirrors are only updated from their source
+	if exists {
+		repo, err := repository.Open(repoPath)
+		if err != nil {
+			responseJSON(w, fmt.Errorf("failed to open repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
+			return
+		}
+		if repo.IsMirror() {
+			responseJSON(w, "import to mirror repository is not allowed", http.StatusForbidden)
+			return
+		}
+	}
+
+	result, err := bundle.Import(r.Context(), r.Body, bundle.ImportOptions{
+		RepoName:            ri.RepoName,
+		RepoPath:            repoPath,
+		LFSStorage:          h.lfsStorage,
+		PreReceiveHookFunc:  h.preReceiveHookFunc,
+		QuarantineHookFunc:  h.quarantineHookFunc,
+		PostReceiveHookFunc: h.postReceiveHookFunc,
+		Force:               r.URL.Query().Get("force") == "true",
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, bundle.ErrInvalidArchive):
+			responseJSON(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, bundle.ErrDenied), errors.Is(err, bundle.ErrRejected):
+			responseJSON(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, bundle.ErrNonFastForward):
+			responseJSON(w, err.Error(), http.StatusConflict)
+		default:
+			responseJSON(w, fmt.Errorf("failed to import repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
+		}
+		return
+	}
+	responseJSON(w, result, http.StatusOK)
+}
+
+// trackingWriter records whether anything was written to the response.
+type trackingWriter struct {
+	w       io.Writer
+	written bool
+}
+
+func (t *trackingWriter) Write(p []byte) (int, error) {
+	t.written = true
+	return t.w.Write(p)
+}
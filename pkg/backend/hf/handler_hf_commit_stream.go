@@ -0,0 +1,166 @@
+package hf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxCommitOperationSize bounds the memory used to read a commit operation, content included.
+// Regular files are at most lfsThreshold bytes, larger ones being uploaded through LFS,
+// and the bound leaves room for their content to be encoded in base64 or escaped.
+const maxCommitOperationSize = 32 * 1024 * 1024 // 32MB
+
+var errCommitOperationTooLarge = errors.New("commit operation is too large")
+
+// streamedCommitOperation is a commit operation read by commitStreamReader.
+type streamedCommitOperation struct {
+	Key string
+	// Value is the value of the operation without its content member.
+	Value json.RawMessage
+	// HasContent reports whether the value had a string content member, which is Content.
+	HasContent bool
+	Content    string
+}
+
+// commitStreamReader reads the NDJSON operations of a commit request one at a time,
+// so that a commit of any number of files is read with the memory of a single operation.
+type commitStreamReader struct {
+	in  *operationReader
+	dec *json.Decoder
+}
+
+func newCommitStreamReader(r io.Reader) *commitStreamReader {
+	in := &operationReader{r: r}
+	return &commitStreamReader{
+		in:  in,
+		dec: json.NewDecoder(in),
+	}
+}
+
+// Next reads the next operation, returning io.EOF when there are no more.
+func (c *commitStreamReader) Next() (*streamedCommitOperation, error) {
+	c.in.n = maxCommitOperationSize
+	if err := c.expectDelim('{'); err != nil {
+		return nil, err
+	}
+
+	op := &streamedCommitOperation{}
+	for c.dec.More() {
+		name, err := c.memberName()
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "key":
+			err = c.dec.Decode(&op.Key)
+		case "value":
+			op.Value, err = c.readValue(op)
+		default:
+			var skipped json.RawMessage
+			err = c.dec.Decode(&skipped)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := c.expectDelim('}'); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// readValue reads the value of an operation, keeping its content member apart from the others.
+func (c *commitStreamReader) readValue(op *streamedCommitOperation) (json.RawMessage, error) {
+	tok, err := c.dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := tok.(json.Delim); ok && delim != '{' {
+		return nil, fmt.Errorf("expected an object value, got %q", delim)
+	} else if !ok {
+		return json.Marshal(tok)
+	}
+
+	value := []byte{'{'}
+	for c.dec.More() {
+		name, err := c.memberName()
+		if err != nil {
+			return nil, err
+		}
+		var raw json.RawMessage
+		if name == "content" {
+			tok, err := c.dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			if content, ok := tok.(string); ok {
+				op.Content, op.HasContent = content, true
+				continue
+			}
+			if _, ok := tok.(json.Delim); ok {
+				return nil, fmt.Errorf("expected a string content")
+			}
+			if raw, err = json.Marshal(tok); err != nil {
+				return nil, err
+			}
+		} else if err := c.dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+
+		if len(value) > 1 {
+			value = append(value, ',')
+		}
+		key, _ := json.Marshal(name)
+		value = append(append(append(value, key...), ':'), raw...)
+	}
+	if err := c.expectDelim('}'); err != nil {
+		return nil, err
+	}
+	return append(value, '}'), nil
+}
+
+// memberName reads the name of the next member of an object.
+func (c *commitStreamReader) memberName() (string, error) {
+	tok, err := c.dec.Token()
+	if err != nil {
+		return "", err
+	}
+	name, ok := tok.(string)
+	if !ok {
+		return "", fmt.Errorf("expected a member name, got %v", tok)
+	}
+	return name, nil
+}
+
+// expectDelim reads the delimiter delim.
+func (c *commitStreamReader) expectDelim(delim json.Delim) error {
+	tok, err := c.dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("expected %q, got %v", delim, tok)
+	}
+	return nil
+}
+
+// operationReader fails reading more than n bytes, so that the decoder never buffers
+// more than an operation. The bound is reset before each operation.
+type operationReader struct {
+	r io.Reader
+	n int64
+}
+
+func (o *operationReader) Read(p []byte) (int, error) {
+	if o.n <= 0 {
+		return 0, errCommitOperationTooLarge
+	}
+	if int64(len(p)) > o.n {
+		p = p[:o.n]
+	}
+	n, err := o.r.Read(p)
+	o.n -= int64(n)
+	return n, err
+}
@@ -0,0 +1,139 @@
+package hf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/matrixhub-ai/hfd/pkg/storage"
+)
+
+func TestCommitStreamReader(t *testing.T) {
+	body := "{\"key\":\"header\",\"value\":{\"summary\":\"Add \\\"files\\\"\"}}\n" +
+		"\n" +
+		"{ \"value\" : { \"path\" : \"a.txt\", \"content\" : \"line\\n\\u00e9\\ud83d\\ude00\\/\\\\\", \"encoding\" : \"utf-8\" } , \"key\" : \"file\" }\n" +
+		"{\"key\":\"deletedFile\",\"value\":{\"path\":\"b.txt\"}}"
+	reader := newCommitStreamReader(strings.NewReader(body))
+
+	op, err := reader.Next()
+	if err != nil || op.Key != "header" || op.HasContent {
+		t.Fatalf("Unexpected header operation %+v: %v", op, err)
+	}
+	var header commitHeader
+	if err := json.Unmarshal(op.Value, &header); err != nil || header.Summary != `Add "files"` {
+		t.Errorf("Unexpected header %+v: %v", header, err)
+	}
+
+	op, err = reader.Next()
+	if err != nil || op.Key != "file" || !op.HasContent {
+		t.Fatalf("Unexpected file operation %+v: %v", op, err)
+	}
+	var file commitFile
+	if err := json.Unmarshal(op.Value, &file); err != nil || file.Path != "a.txt" || file.Encoding != "utf-8" || file.Content != "" {
+		t.Errorf("Unexpected file %+v: %v", file, err)
+	}
+	if op.Content != "line\né😀/\\" {
+		t.Errorf("Unexpected content %q", op.Content)
+	}
+
+	op, err = reader.Next()
+	if err != nil || op.Key != "deletedFile" || string(op.Value) != `{"path":"b.txt"}` {
+		t.Fatalf("Unexpected delete operation %+v: %v", op, err)
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+
+	for _, invalid := range []string{
+		`{"key":"file","value":{"content":"unterminated`,
+		`{"key":"file","value":{"content":"\x"}}`,
+		`{"key":"file" "value":{}}`,
+		`{"key":"header","value":{"summary":"` + strings.Repeat("a", maxCommitOperationSize) + `"}}`,
+	} {
+		if _, err := newCommitStreamReader(strings.NewReader(invalid)).Next(); err == nil {
+			t.Errorf("Expected an error for %.40q", invalid)
+		}
+	}
+}
+
+func TestHuggingFaceCommitStreaming(t *testing.T) {
+	server, dataDir := setupTestServer(t)
+	endpoint := server.URL
+
+	resp, err := http.Post(endpoint+"/api/repos/create", "application/json", strings.NewReader(`{"type":"model","name":"stream-model","organization":"test-user"}`))
+	if err != nil {
+		t.Fatalf("Failed to create repo: %v", err)
+	}
+	resp.Body.Close()
+
+	large := bytes.Repeat([]byte("0123456789abcdef"), 512*1024)
+
+	// Write the body while it is sent, as upload_folder does with many files.
+	pr, pw := io.Pipe()
+	go func() {
+		fmt.Fprintln(pw, `{"key":"header","value":{"summary":"Upload folder"}}`)
+		for i := 0; i < 2000; i++ {
+			fmt.Fprintf(pw, "{\"key\":\"file\",\"value\":{\"content\":%q,\"path\":\"files/%04d.txt\",\"encoding\":\"utf-8\"}}\n", fmt.Sprint(i), i)
+		}
+		fmt.Fprint(pw, `{"key":"file","value":{"path":"large.bin","encoding":"base64","content":"`)
+		enc := base64.NewEncoder(base64.StdEncoding, pw)
+		_, _ = enc.Write(large)
+		_ = enc.Close()
+		fmt.Fprintln(pw, `"}}`)
+		_ = pw.Close()
+	}()
+
+	resp, err = http.Post(endpoint+"/api/models/test-user/stream-model/commit/main", "application/x-ndjson", pr)
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+	}
+
+	for path, want := range map[string][]byte{
+		"files/1999.txt": []byte("1999"),
+		"large.bin":      large,
+	} {
+		resp, err := http.Get(endpoint + "/test-user/stream-model/resolve/main/" + path)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", path, err)
+		}
+		content, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !bytes.Equal(content, want) {
+			t.Errorf("Unexpected content for %s: status %d, %d bytes", path, resp.StatusCode, len(content))
+		}
+	}
+
+	// The blobs of a rejected commit are not left in the repository
+	ndjson := "{\"key\":\"file\",\"value\":{\"content\":\"rejected\",\"path\":\"good.txt\",\"encoding\":\"utf-8\"}}\n" +
+		"{\"key\":\"file\",\"value\":{\"content\":\"not base64!\",\"path\":\"bad.bin\",\"encoding\":\"base64\"}}\n"
+	resp, err = http.Post(endpoint+"/api/models/test-user/stream-model/commit/main", "application/x-ndjson", strings.NewReader(ndjson))
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid base64, got %d", resp.StatusCode)
+	}
+	repoPath := storage.NewStorage(storage.WithRootDir(dataDir)).ResolvePath("test-user/stream-model")
+	hash := plumbing.ComputeHash(plumbing.BlobObject, []byte("rejected")).String()
+	if _, err := os.Stat(filepath.Join(repoPath, "objects", hash[:2], hash[2:])); !os.IsNotExist(err) {
+		t.Errorf("Expected the blob of the rejected commit not to be stored, got %v", err)
+	}
+	if incoming, _ := filepath.Glob(filepath.Join(repoPath, "objects", "incoming-*")); len(incoming) != 0 {
+		t.Errorf("Expected the quarantine to be removed, got %v", incoming)
+	}
+}
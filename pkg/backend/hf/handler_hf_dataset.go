@@ -0,0 +1,86 @@
+package hf
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/matrixhub-ai/hfd/pkg/hf"
+	"github.com/matrixhub-ai/hfd/pkg/mirror"
+	"github.com/matrixhub-ai/hfd/pkg/permission"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+)
+
+// handleDatasetConfigs handles GET /api/datasets/{namespace}/{repo}/configs[/{rev}]
+// It describes the configurations of a dataset with the data files of their splits, as told by
+// the configs of its card or detected by the conventions of the Hub, so that clients resolve
+// data files without listing the whole repository.
+func (h *Handler) handleDatasetConfigs(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	ri := getRepoInformation(r)
+
+	if h.permissionHookFunc != nil {
+		if ok, err := h.permissionHookFunc(r.Context(), permission.OperationReadRepo, ri.RepoName, permission.Context{}); err != nil {
+			responseJSON(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if !ok {
+			responseJSON(w, "permission denied", http.StatusForbidden)
+			return
+		}
+	}
+
+	repoPath := h.storage.ResolvePath(ri.RepoName)
+	if repoPath == "" {
+		responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
+		return
+	}
+
+	repo, err := h.openRepo(r.Context(), repoPath, ri.RepoName, repository.GitUploadPack)
+	if err != nil {
+		if errors.Is(err, repository.ErrRepositoryNotExists) {
+			responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, mirror.ErrUpstreamUnavailable) {
+			responseJSON(w, fmt.Errorf("repository %q is not available: %v", ri.RepoName, err), http.StatusServiceUnavailable)
+			return
+		}
+		responseJSON(w, fmt.Errorf("failed to open repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
+		return
+	}
+
+	rev := vars["rev"]
+	if rev == "" {
+		rev = repo.DefaultBranch()
+	}
+
+	sha, err := repo.ResolveRevision(rev)
+	if err != nil {
+		responseJSON(w, fmt.Errorf("revision %q not found", rev), http.StatusNotFound)
+		return
+	}
+
+	files, err := hf.ReadDataFiles(repo, sha)
+	if err != nil {
+		responseJSON(w, fmt.Errorf("failed to get tree for repo %q at rev %q: %v", ri.RepoName, rev, err), http.StatusInternalServerError)
+		return
+	}
+
+	card, err := hf.ReadDatasetCard(repo, sha)
+	if err != nil {
+		if errors.Is(err, hf.ErrInvalidDatasetCard) {
+			responseJSON(w, err, http.StatusBadRequest)
+			return
+		}
+		responseJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	responseJSON(w, datasetConfigsResponse{
+		ID:      ri.FullName,
+		SHA:     sha,
+		Configs: card.ResolveConfigs(files),
+	}, http.StatusOK)
+}
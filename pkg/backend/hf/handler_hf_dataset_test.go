@@ -0,0 +1,85 @@
+package hf
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHuggingFaceDatasetConfigs(t *testing.T) {
+	server, _ := setupTestServer(t)
+	endpoint := server.URL
+
+	createRepoAndCommit(t, endpoint, "dataset", "test-user", "configs-data")
+
+	commit := func(files map[string]string) {
+		t.Helper()
+		ndjson := "{\"key\":\"header\",\"value\":{\"summary\":\"Add data\"}}\n"
+		for path, content := range files {
+			encoded, _ := json.Marshal(content)
+			ndjson += "{\"key\":\"file\",\"value\":{\"content\":" + string(encoded) + ",\"path\":\"" + path + "\",\"encoding\":\"utf-8\"}}\n"
+		}
+		resp, err := http.Post(endpoint+"/api/datasets/test-user/configs-data/commit/main", "application/x-ndjson", strings.NewReader(ndjson))
+		if err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200 for commit, got %d", resp.StatusCode)
+		}
+	}
+	getConfigs := func(path string) (int, datasetConfigsResponse) {
+		t.Helper()
+		resp, err := http.Get(endpoint + "/api/datasets/test-user/configs-data/" + path)
+		if err != nil {
+			t.Fatalf("Failed to get configs: %v", err)
+		}
+		defer resp.Body.Close()
+		var configs datasetConfigsResponse
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&configs); err != nil {
+				t.Fatalf("Failed to decode configs: %v", err)
+			}
+		}
+		return resp.StatusCode, configs
+	}
+
+	// Splits are detected from the names of the data files
+	commit(map[string]string{
+		"train.jsonl": "{\"text\":\"a\"}\n{\"text\":\"b\"}\n",
+		"test.jsonl":  "{\"text\":\"c\"}\n",
+	})
+	status, configs := getConfigs("configs")
+	if status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if configs.ID != "test-user/configs-data" || configs.SHA == "" || len(configs.Configs) != 1 {
+		t.Fatalf("Unexpected configs %+v", configs)
+	}
+	config := configs.Configs[0]
+	if config.ConfigName != "default" || config.Format != "json" || len(config.Splits) != 2 ||
+		config.Splits[0].Split != "train" || config.Splits[1].Split != "test" {
+		t.Fatalf("Unexpected default config %+v", config)
+	}
+	if train := config.Splits[0]; len(train.Files) != 1 || train.Files[0].Path != "train.jsonl" || train.Size != 26 {
+		t.Errorf("Unexpected train split %+v", train)
+	}
+
+	// The configs of the card take precedence
+	commit(map[string]string{
+		"README.md": "---\nconfigs:\n- config_name: all\n  data_files: \"*.jsonl\"\n---\n",
+	})
+	status, configs = getConfigs("configs/main")
+	if status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if len(configs.Configs) != 1 || configs.Configs[0].ConfigName != "all" ||
+		len(configs.Configs[0].Splits) != 1 || len(configs.Configs[0].Splits[0].Files) != 2 {
+		t.Errorf("Unexpected card configs %+v", configs.Configs)
+	}
+
+	if status, _ := getConfigs("configs/missing"); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing revision, got %d", status)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/gorilla/mux"
 
 	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/mirror"
 	"github.com/matrixhub-ai/hfd/pkg/permission"
 	"github.com/matrixhub-ai/hfd/pkg/repository"
 )
@@ -43,12 +44,24 @@ func (h *Handler) handleTree(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if lazy, err := h.isLazy(r.Context(), repoPath, ri.RepoName); err != nil {
+		responseJSON(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if lazy {
+		h.handleLazyAPI(w, r, ri)
+		return
+	}
+
 	repo, err := h.openRepo(r.Context(), repoPath, ri.RepoName, repository.GitUploadPack)
 	if err != nil {
 		if errors.Is(err, repository.ErrRepositoryNotExists) {
 			responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
 			return
 		}
+		if errors.Is(err, mirror.ErrUpstreamUnavailable) {
+			responseJSON(w, fmt.Errorf("repository %q is not available: %v", ri.RepoName, err), http.StatusServiceUnavailable)
+			return
+		}
 		responseJSON(w, fmt.Errorf("failed to open repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
 		return
 	}
@@ -67,10 +80,10 @@ func (h *Handler) handleTree(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	responseJSON(w, toHFTreeEntries(r.Context(), entries, expand), http.StatusOK)
+	responseJSON(w, h.toHFTreeEntries(r.Context(), entries, expand), http.StatusOK)
 }
 
-func toHFTreeEntries(ctx context.Context, entries []*repository.TreeEntry, expand bool) []treeEntry {
+func (h *Handler) toHFTreeEntries(ctx context.Context, entries []*repository.TreeEntry, expand bool) []treeEntry {
 	result := make([]treeEntry, len(entries))
 	for i, e := range entries {
 
@@ -101,6 +114,9 @@ func toHFTreeEntries(ctx context.Context, entries []*repository.TreeEntry, expan
 				Date:  lastCommit.Author().When().UTC().Format(repository.TimeFormat),
 			}
 		}
+		if expand && h.scanner != nil && e.Type() == repository.EntryTypeFile {
+			result[i].SecurityFileStatus = h.scanner.File(ctx, e.Path(), blob)
+		}
 	}
 	return result
 }
@@ -128,12 +144,24 @@ func (h *Handler) handleTreeSize(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if lazy, err := h.isLazy(r.Context(), repoPath, ri.RepoName); err != nil {
+		responseJSON(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if lazy {
+		h.handleLazyAPI(w, r, ri)
+		return
+	}
+
 	repo, err := h.openRepo(r.Context(), repoPath, ri.RepoName, repository.GitUploadPack)
 	if err != nil {
 		if errors.Is(err, repository.ErrRepositoryNotExists) {
 			responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
 			return
 		}
+		if errors.Is(err, mirror.ErrUpstreamUnavailable) {
+			responseJSON(w, fmt.Errorf("repository %q is not available: %v", ri.RepoName, err), http.StatusServiceUnavailable)
+			return
+		}
 		responseJSON(w, fmt.Errorf("failed to open repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
 		return
 	}
@@ -180,12 +208,24 @@ func (h *Handler) handleResolve(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if lazy, err := h.isLazy(r.Context(), repoPath, ri.RepoName); err != nil {
+		responseJSON(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if lazy {
+		h.handleLazyResolve(w, r, ri, revpath)
+		return
+	}
+
 	repo, err := h.openRepo(r.Context(), repoPath, ri.RepoName, repository.GitUploadPack)
 	if err != nil {
 		if errors.Is(err, repository.ErrRepositoryNotExists) {
 			responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
 			return
 		}
+		if errors.Is(err, mirror.ErrUpstreamUnavailable) {
+			responseJSON(w, fmt.Errorf("repository %q is not available: %v", ri.RepoName, err), http.StatusServiceUnavailable)
+			return
+		}
 		responseJSON(w, fmt.Errorf("failed to open repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
 		return
 	}
@@ -230,48 +270,31 @@ func (h *Handler) handleResolve(w http.ResponseWriter, r *http.Request) {
 							{Oid: ptr.OID(), Size: ptr.Size()},
 						})
 						if err != nil {
+							if errors.Is(err, mirror.ErrUpstreamUnavailable) {
+								responseJSON(w, fmt.Errorf("LFS object %q for file %q is not cached locally and upstream source %q is unreachable: %v", ptr.OID(), path, sourceURL, err), http.StatusServiceUnavailable)
+								return
+							}
 							responseJSON(w, fmt.Errorf("failed to fetch LFS object %q from upstream source %q: %v", ptr.OID(), sourceURL, err), http.StatusInternalServerError)
 							return
 						}
 
 						if started {
-							pf := h.mirror.Get(ptr.OID())
-							rs := pf.NewReadSeeker()
-							defer rs.Close()
-							http.ServeContent(w, r, ptr.OID(), pf.ModTime(), rs)
-							return
+							if pf := h.mirror.Get(ptr.OID()); pf != nil {
+								rs := pf.NewReadSeeker()
+								defer rs.Close()
+								http.ServeContent(w, r, ptr.OID(), pf.ModTime(), rs)
+								return
+							}
+							if h.lfsStorage.Exists(ptr.OID()) {
+								h.serveLFSObject(w, r, ptr.OID(), fmt.Errorf("LFS object %q not found for file %q in repository %q at revision %q", ptr.OID(), path, ri.RepoName, rev))
+								return
+							}
 						}
 					}
 					responseJSON(w, fmt.Errorf("LFS object %q not found for file %q in repository %q at revision %q", ptr.OID(), path, ri.RepoName, rev), http.StatusNotFound)
 					return
 				}
-				if signer, ok := h.lfsStorage.(lfs.SignGetter); ok {
-					url, err := signer.SignGet(ptr.OID())
-					if err != nil {
-						responseJSON(w, fmt.Errorf("failed to sign URL for LFS object %q: %v", ptr.OID(), err), http.StatusInternalServerError)
-						return
-					}
-					http.Redirect(w, r, url, http.StatusTemporaryRedirect)
-					return
-				}
-				if getter, ok := h.lfsStorage.(lfs.Getter); ok {
-					content, stat, err := getter.Get(ptr.OID())
-					if err != nil {
-						if os.IsNotExist(err) {
-							responseJSON(w, fmt.Errorf("LFS object %q not found for file %q in repository %q at revision %q", ptr.OID(), path, ri.RepoName, rev), http.StatusNotFound)
-							return
-						}
-						responseJSON(w, fmt.Errorf("failed to get LFS object %q: %v", ptr.OID(), err), http.StatusInternalServerError)
-						return
-					}
-					defer func() {
-						_ = content.Close()
-					}()
-
-					http.ServeContent(w, r, ptr.OID(), stat.ModTime(), content)
-					return
-				}
-				responseJSON(w, fmt.Errorf("LFS storage does not support direct content retrieval for object %q", ptr.OID()), http.StatusNotImplemented)
+				h.serveLFSObject(w, r, ptr.OID(), fmt.Errorf("LFS object %q not found for file %q in repository %q at revision %q", ptr.OID(), path, ri.RepoName, rev))
 				return
 			}
 		}
@@ -283,27 +306,109 @@ func (h *Handler) handleResolve(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("ETag", fmt.Sprintf("\"%s\"", blob.Hash()))
 
-	// Serve regular file content
-	w.Header().Set("Content-Length", strconv.FormatInt(blob.Size(), 10))
-	w.Header().Set("Last-Modified", blob.ModTime().UTC().Format(http.TimeFormat))
+	// Serve regular file content, with support for range requests such as
+	// the reads of safetensors headers by huggingface_hub
+	content := newBlobReadSeeker(blob)
+	defer func() {
+		_ = content.Close()
+	}()
+	http.ServeContent(w, r, "", blob.ModTime(), content)
+}
+
+// blobReadSeeker reads a git blob for http.ServeContent. Blobs are read as streams,
+// so seeking forward skips content, and seeking backward reads the blob again.
+type blobReadSeeker struct {
+	blob   *repository.Blob
+	reader io.ReadCloser
+	pos    int64 // position of reader
+	offset int64 // position to read from
+}
 
-	// Handle HEAD request
-	if r.Method == http.MethodHead {
-		return
+func newBlobReadSeeker(blob *repository.Blob) *blobReadSeeker {
+	return &blobReadSeeker{blob: blob}
+}
+
+func (b *blobReadSeeker) Read(p []byte) (int, error) {
+	if b.reader == nil || b.offset < b.pos {
+		if err := b.Close(); err != nil {
+			return 0, err
+		}
+		reader, err := b.blob.NewReader()
+		if err != nil {
+			return 0, err
+		}
+		b.reader, b.pos = reader, 0
 	}
+	if b.offset > b.pos {
+		n, err := io.CopyN(io.Discard, b.reader, b.offset-b.pos)
+		b.pos += n
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := b.reader.Read(p)
+	b.pos += int64(n)
+	b.offset = b.pos
+	return n, err
+}
 
-	reader, err := blob.NewReader()
-	if err != nil {
-		responseJSON(w, fmt.Errorf("failed to get blob reader for file %q in repository %q at revision %q: %v", path, ri.RepoName, rev, err), http.StatusInternalServerError)
+func (b *blobReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += b.offset
+	case io.SeekEnd:
+		offset += b.blob.Size()
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative position %d", offset)
+	}
+	b.offset = offset
+	return offset, nil
+}
+
+func (b *blobReadSeeker) Close() error {
+	if b.reader == nil {
+		return nil
+	}
+	err := b.reader.Close()
+	b.reader = nil
+	return err
+}
+
+// serveLFSObject serves the content of an LFS object from the LFS storage,
+// responding with notFound if the object does not exist.
+func (h *Handler) serveLFSObject(w http.ResponseWriter, r *http.Request, oid string, notFound error) {
+	if h.mirror != nil {
+		h.mirror.Touch(oid)
+	}
+	if signer, ok := h.lfsStorage.(lfs.SignGetter); ok {
+		url, err := signer.SignGet(oid)
+		if err != nil {
+			responseJSON(w, fmt.Errorf("failed to sign URL for LFS object %q: %v", oid, err), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 		return
 	}
-	defer func() {
-		_ = reader.Close()
-	}()
+	if getter, ok := h.lfsStorage.(lfs.Getter); ok {
+		content, stat, err := getter.Get(oid)
+		if err != nil {
+			if os.IsNotExist(err) {
+				responseJSON(w, notFound, http.StatusNotFound)
+				return
+			}
+			responseJSON(w, fmt.Errorf("failed to get LFS object %q: %v", oid, err), http.StatusInternalServerError)
+			return
+		}
+		defer func() {
+			_ = content.Close()
+		}()
 
-	_, err = io.Copy(w, reader)
-	if err != nil {
-		// Log but don't send error - we may have already written partial content
+		http.ServeContent(w, r, oid, stat.ModTime(), content)
 		return
 	}
+	responseJSON(w, fmt.Errorf("LFS storage does not support direct content retrieval for object %q", oid), http.StatusNotImplemented)
 }
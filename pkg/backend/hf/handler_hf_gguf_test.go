@@ -0,0 +1,97 @@
+package hf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// buildGGUF returns a GGUF file of a llama model quantized to fileType, with one tensor of the given size.
+func buildGGUF(fileType uint32, size uint64) []byte {
+	var buf bytes.Buffer
+	le := binary.LittleEndian
+	putString := func(s string) {
+		_ = binary.Write(&buf, le, uint64(len(s)))
+		buf.WriteString(s)
+	}
+	_ = binary.Write(&buf, le, []uint32{0x46554747, 3})
+	_ = binary.Write(&buf, le, []uint64{1, 3}) // tensors, metadata
+	putString("general.architecture")
+	_ = binary.Write(&buf, le, uint32(8))
+	putString("llama")
+	putString("llama.context_length")
+	_ = binary.Write(&buf, le, []uint32{4, 2048})
+	putString("general.file_type")
+	_ = binary.Write(&buf, le, []uint32{4, fileType})
+	putString("token_embd.weight")
+	_ = binary.Write(&buf, le, uint32(1))
+	_ = binary.Write(&buf, le, size)
+	_ = binary.Write(&buf, le, uint32(12))
+	_ = binary.Write(&buf, le, uint64(0))
+	return buf.Bytes()
+}
+
+func TestHuggingFaceRepoInfoGGUF(t *testing.T) {
+	server, _ := setupTestServer(t)
+	endpoint := server.URL
+
+	createRepoAndCommit(t, endpoint, "model", "test-user", "gguf-model")
+	createRepoAndCommit(t, endpoint, "model", "test-user", "plain-model")
+
+	ndjson := "{\"key\":\"header\",\"value\":{\"summary\":\"Add quantizations\"}}\n"
+	for path, content := range map[string][]byte{
+		"model-Q4_K_M.gguf":                   buildGGUF(15, 100),
+		"Q8_0/model-Q8_0-00001-of-00002.gguf": buildGGUF(7, 60),
+		"Q8_0/model-Q8_0-00002-of-00002.gguf": buildGGUF(7, 40),
+	} {
+		ndjson += "{\"key\":\"file\",\"value\":{\"content\":\"" + base64.StdEncoding.EncodeToString(content) + "\",\"path\":\"" + path + "\",\"encoding\":\"base64\"}}\n"
+	}
+	resp, err := http.Post(endpoint+"/api/models/test-user/gguf-model/commit/main", "application/x-ndjson", strings.NewReader(ndjson))
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 for commit, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(endpoint + "/api/models/test-user/gguf-model")
+	if err != nil {
+		t.Fatalf("Failed to get repo info: %v", err)
+	}
+	defer resp.Body.Close()
+	var info repoInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		t.Fatalf("Failed to decode repo info: %v", err)
+	}
+	if info.GGUF == nil {
+		t.Fatal("Expected gguf in repo info")
+	}
+	// The split model sorts first, and its shards are counted together
+	if info.GGUF.Architecture != "llama" || info.GGUF.ContextLength != 2048 || info.GGUF.Quantization != "Q8_0" ||
+		info.GGUF.Total != 100 || info.GGUF.TensorCount != 2 {
+		t.Errorf("Unexpected gguf %+v", info.GGUF)
+	}
+	for _, tag := range []string{"gguf", "Q4_K_M", "Q8_0"} {
+		if !matchesAllTags(info.Tags, []string{tag}) {
+			t.Errorf("Expected tag %q, got %v", tag, info.Tags)
+		}
+	}
+
+	resp, err = http.Get(endpoint + "/api/models?filter=gguf")
+	if err != nil {
+		t.Fatalf("Failed to list models: %v", err)
+	}
+	defer resp.Body.Close()
+	var items []repoListItem
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		t.Fatalf("Failed to decode models: %v", err)
+	}
+	if len(items) != 1 || items[0].ModelID != "test-user/gguf-model" {
+		t.Errorf("Expected only the GGUF model, got %+v", items)
+	}
+}
@@ -0,0 +1,181 @@
+package hf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/matrixhub-ai/hfd/pkg/mirror"
+)
+
+// maxLazyRedirects is the maximum number of upstream redirects followed while resolving a file lazily.
+const maxLazyRedirects = 5
+
+// lazyResponseHeaders are the upstream response headers passed through to clients of the lazy proxy.
+var lazyResponseHeaders = []string{
+	"Accept-Ranges",
+	"Content-Length",
+	"Content-Range",
+	"Content-Type",
+	"ETag",
+	"Last-Modified",
+	"Link",
+	"X-Repo-Commit",
+	"X-Error-Code",
+	"X-Error-Message",
+}
+
+// isLazy reports whether the repository should be served by forwarding to the mirror's lazy endpoint.
+func (h *Handler) isLazy(ctx context.Context, repoPath, repoName string) (bool, error) {
+	if h.mirror == nil {
+		return false, nil
+	}
+	return h.mirror.IsLazy(ctx, repoPath, repoName)
+}
+
+// handleLazyAPI forwards a metadata API request (repo info, tree) unchanged to the lazy endpoint.
+func (h *Handler) handleLazyAPI(w http.ResponseWriter, r *http.Request, ri repoInformation) {
+	resp, err := h.mirror.LazyRequest(r.Context(), r.Method, r.URL.RequestURI(), http.Header{
+		"Accept": {"application/json"},
+	})
+	if err != nil {
+		responseLazyError(w, ri, err)
+		return
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	copyLazyResponse(w, resp)
+}
+
+// handleLazyResolve resolves a file through the lazy endpoint. Regular files are streamed from upstream and cached
+// by commit, while LFS files are served from the LFS storage, fetching them into the tee cache on first access.
+func (h *Handler) handleLazyResolve(w http.ResponseWriter, r *http.Request, ri repoInformation, revpath string) {
+	header := http.Header{}
+	if rng := r.Header.Get("Range"); rng != "" {
+		header.Set("Range", rng)
+	}
+
+	uri := "/" + ri.RepoName + "/resolve/" + revpath
+	if r.URL.RawQuery != "" {
+		uri += "?" + r.URL.RawQuery
+	}
+
+	// Files of a commit never change, so cached files are served without asking upstream
+	var commitHash string
+	if rev, _, _ := strings.Cut(revpath, "/"); mirror.IsCommitHash(rev) {
+		commitHash = rev
+		if h.serveLazyFile(w, r, ri, commitHash, revpath) {
+			return
+		}
+	}
+
+	for range maxLazyRedirects {
+		resp, err := h.mirror.LazyRequest(r.Context(), r.Method, uri, header)
+		if err != nil {
+			responseLazyError(w, ri, err)
+			return
+		}
+		if commit := resp.Header.Get("X-Repo-Commit"); commit != "" {
+			commitHash = commit
+		}
+
+		location := resp.Header.Get("Location")
+		if resp.StatusCode < 300 || resp.StatusCode >= 400 || location == "" {
+			if r.Method == http.MethodGet && header.Get("Range") == "" {
+				resp.Body = h.mirror.TeeLazyFile(ri.RepoName, commitHash, revpath, resp)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+			copyLazyResponse(w, resp)
+			return
+		}
+		_ = resp.Body.Close()
+
+		oid := strings.Trim(resp.Header.Get("X-Linked-Etag"), `"`)
+		if oid == "" {
+			// Regular files redirect to their content at the resolved commit, which may be cached already
+			if h.serveLazyFile(w, r, ri, commitHash, revpath) {
+				return
+			}
+			uri = location
+			continue
+		}
+		size, err := strconv.ParseInt(resp.Header.Get("X-Linked-Size"), 10, 64)
+		if err != nil {
+			responseJSON(w, fmt.Errorf("invalid linked size for LFS file %q in repository %q: %v", revpath, ri.RepoName, err), http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("X-Repo-Commit", commitHash)
+		w.Header().Set("ETag", fmt.Sprintf("\"%s\"", oid))
+		if h.lfsStorage.Exists(oid) {
+			h.serveLFSObject(w, r, oid, fmt.Errorf("LFS object %q not found for %q in repository %q", oid, revpath, ri.RepoName))
+			return
+		}
+
+		if err := h.mirror.StartLFSFetchURL(r.Context(), oid, size, location); err != nil {
+			responseLazyError(w, ri, err)
+			return
+		}
+		pf := h.mirror.Get(oid)
+		if pf == nil {
+			if h.lfsStorage.Exists(oid) {
+				h.serveLFSObject(w, r, oid, fmt.Errorf("LFS object %q not found for %q in repository %q", oid, revpath, ri.RepoName))
+				return
+			}
+			responseJSON(w, fmt.Errorf("failed to fetch LFS object %q for %q in repository %q", oid, revpath, ri.RepoName), http.StatusBadGateway)
+			return
+		}
+		rs := pf.NewReadSeeker()
+		defer rs.Close()
+		http.ServeContent(w, r, oid, pf.ModTime(), rs)
+		return
+	}
+	responseJSON(w, fmt.Errorf("too many upstream redirects resolving %q in repository %q", revpath, ri.RepoName), http.StatusBadGateway)
+}
+
+// serveLazyFile serves a regular file cached by the lazy mode, reporting whether it was cached.
+func (h *Handler) serveLazyFile(w http.ResponseWriter, r *http.Request, ri repoInformation, commit, revpath string) bool {
+	f := h.mirror.OpenLazyFile(ri.RepoName, commit, revpath)
+	if f == nil {
+		return false
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	header := w.Header()
+	header.Set("X-Repo-Commit", commit)
+	if f.ETag != "" {
+		header.Set("ETag", f.ETag)
+	}
+	if f.ContentType != "" {
+		header.Set("Content-Type", f.ContentType)
+	}
+	http.ServeContent(w, r, path.Base(revpath), f.ModTime, f)
+	return true
+}
+
+func copyLazyResponse(w http.ResponseWriter, resp *http.Response) {
+	for _, key := range lazyResponseHeaders {
+		if v := resp.Header.Values(key); len(v) > 0 {
+			w.Header()[key] = v
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+func responseLazyError(w http.ResponseWriter, ri repoInformation, err error) {
+	if errors.Is(err, mirror.ErrUpstreamUnavailable) {
+		responseJSON(w, fmt.Errorf("repository %q is not available: %v", ri.RepoName, err), http.StatusServiceUnavailable)
+		return
+	}
+	responseJSON(w, fmt.Errorf("failed to forward request for repository %q to upstream: %v", ri.RepoName, err), http.StatusBadGateway)
+}
@@ -0,0 +1,190 @@
+package hf
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/mirror"
+	"github.com/matrixhub-ai/hfd/pkg/storage"
+)
+
+func TestLazyProxy(t *testing.T) {
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+	weights := []byte(strings.Repeat("weights", 1024))
+	sum := sha256.Sum256(weights)
+	oid := hex.EncodeToString(sum[:])
+
+	var contentRequests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/models/org/lazy":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, `{"id":"org/lazy","sha":"`+commit+`"}`)
+		case "/api/models/org/lazy/tree/main":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, `[{"type":"file","path":"config.json","size":8}]`)
+		case "/org/lazy/resolve/main/config.json":
+			w.Header().Set("X-Repo-Commit", commit)
+			http.Redirect(w, r, "/api/resolve-cache/models/org/lazy/"+commit+"/config.json", http.StatusTemporaryRedirect)
+		case "/api/resolve-cache/models/org/lazy/" + commit + "/config.json":
+			contentRequests.Add(1)
+			w.Header().Set("X-Repo-Commit", commit)
+			w.Header().Set("ETag", `"blob"`)
+			_, _ = io.WriteString(w, `{"a":1}`)
+		case "/org/lazy/resolve/main/model.bin":
+			w.Header().Set("X-Repo-Commit", commit)
+			w.Header().Set("X-Linked-Etag", `"`+oid+`"`)
+			w.Header().Set("X-Linked-Size", strconv.Itoa(len(weights)))
+			http.Redirect(w, r, "http://"+r.Host+"/cdn/"+oid, http.StatusFound)
+		case "/cdn/" + oid:
+			_, _ = w.Write(weights)
+		default:
+			w.Header().Set("X-Error-Code", "RepoNotFound")
+			http.Error(w, `{"error":"Repository not found"}`, http.StatusNotFound)
+		}
+	}))
+	defer upstream.Close()
+
+	dataDir := t.TempDir()
+	store := storage.NewStorage(storage.WithRootDir(dataDir))
+	lfsStorage := lfs.NewLocal(store.LFSDir())
+	m := mirror.NewMirror(
+		mirror.WithMirrorSourceFunc(func(ctx context.Context, repoName string) (string, bool, error) {
+			return upstream.URL + "/" + repoName, true, nil
+		}),
+		mirror.WithLFSCache(lfs.NewTeeCache(lfsStorage)),
+		mirror.WithLazyEndpoint(upstream.URL),
+		mirror.WithLazyFileCache(filepath.Join(dataDir, "lazy-files"), 0),
+	)
+	server := httptest.NewServer(NewHandler(
+		WithStorage(store),
+		WithLFSStorage(lfsStorage),
+		WithMirror(m),
+	))
+	defer server.Close()
+
+	get := func(t *testing.T, path string) (*http.Response, string) {
+		t.Helper()
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	t.Run("info", func(t *testing.T) {
+		resp, body := get(t, "/api/models/org/lazy")
+		if resp.StatusCode != http.StatusOK || !strings.Contains(body, commit) {
+			t.Fatalf("unexpected info response %d: %s", resp.StatusCode, body)
+		}
+	})
+
+	t.Run("tree", func(t *testing.T) {
+		resp, body := get(t, "/api/models/org/lazy/tree/main")
+		if resp.StatusCode != http.StatusOK || !strings.Contains(body, "config.json") {
+			t.Fatalf("unexpected tree response %d: %s", resp.StatusCode, body)
+		}
+	})
+
+	t.Run("resolve regular file", func(t *testing.T) {
+		resp, body := get(t, "/org/lazy/resolve/main/config.json")
+		if resp.StatusCode != http.StatusOK || body != `{"a":1}` {
+			t.Fatalf("unexpected resolve response %d: %s", resp.StatusCode, body)
+		}
+		if got := resp.Header.Get("X-Repo-Commit"); got != commit {
+			t.Errorf("expected X-Repo-Commit %q, got %q", commit, got)
+		}
+
+		// Once fetched, the file is served from the cache
+		resp, body = get(t, "/org/lazy/resolve/main/config.json")
+		if resp.StatusCode != http.StatusOK || body != `{"a":1}` || resp.Header.Get("ETag") != `"blob"` {
+			t.Fatalf("unexpected cached resolve response %d %q: %s", resp.StatusCode, resp.Header.Get("ETag"), body)
+		}
+		if n := contentRequests.Load(); n != 1 {
+			t.Errorf("expected the content to be fetched from upstream once, got %d", n)
+		}
+	})
+
+	t.Run("resolve LFS file", func(t *testing.T) {
+		resp, body := get(t, "/org/lazy/resolve/main/model.bin")
+		if resp.StatusCode != http.StatusOK || body != string(weights) {
+			t.Fatalf("unexpected resolve response %d: %d bytes", resp.StatusCode, len(body))
+		}
+		if got := resp.Header.Get("ETag"); got != `"`+oid+`"` {
+			t.Errorf("expected ETag of LFS object, got %q", got)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for !lfsStorage.Exists(oid) {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected LFS object to be cached in LFS storage")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		resp, _ := get(t, "/api/models/org/missing")
+		if resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("expected 404, got %d", resp.StatusCode)
+		}
+		if got := resp.Header.Get("X-Error-Code"); got != "RepoNotFound" {
+			t.Errorf("expected X-Error-Code to be passed through, got %q", got)
+		}
+	})
+
+	if _, err := os.Stat(filepath.Join(store.RepositoriesDir(), "org", "lazy.git")); !os.IsNotExist(err) {
+		t.Fatalf("expected no git mirror to be created, stat error: %v", err)
+	}
+}
+
+func TestLazyProxyCircuitBreaker(t *testing.T) {
+	var requests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "upstream failure", http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+
+	store := storage.NewStorage(storage.WithRootDir(t.TempDir()))
+	m := mirror.NewMirror(
+		mirror.WithMirrorSourceFunc(func(ctx context.Context, repoName string) (string, bool, error) {
+			return upstream.URL + "/" + repoName, true, nil
+		}),
+		mirror.WithLazyEndpoint(upstream.URL),
+		mirror.WithCircuitBreaker(2, time.Minute),
+	)
+	server := httptest.NewServer(NewHandler(WithStorage(store), WithMirror(m)))
+	defer server.Close()
+
+	var codes []int
+	for range 3 {
+		resp, err := http.Get(server.URL + "/api/models/org/lazy")
+		if err != nil {
+			t.Fatalf("GET: %v", err)
+		}
+		resp.Body.Close()
+		codes = append(codes, resp.StatusCode)
+	}
+	// Server errors are passed through until the breaker opens
+	if codes[0] != http.StatusBadGateway || codes[1] != http.StatusBadGateway || codes[2] != http.StatusServiceUnavailable {
+		t.Errorf("expected 502, 502 then 503, got %v", codes)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("expected 2 upstream requests, got %d", n)
+	}
+}
@@ -1,18 +1,22 @@
 package hf
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/matrixhub-ai/hfd/pkg/gguf"
 	"github.com/matrixhub-ai/hfd/pkg/hf"
 	"github.com/matrixhub-ai/hfd/pkg/repository"
 )
@@ -65,7 +69,10 @@ func (h *Handler) handleListRepos(w http.ResponseWriter, r *http.Request, repoTy
 	}
 
 	entries := discoverRepos(baseDir, isModel, f.author)
-	items := buildRepoListItems(entries, isModel, f.search, f.filterTags)
+	if isModel && h.modelTree != nil {
+		entries = h.filterDerivedRepos(entries, f.filterTags)
+	}
+	items := h.buildRepoListItems(r.Context(), entries, isModel, f.search, f.filterTags)
 
 	// Sort results
 	sortRepoItems(items, f.sortField)
@@ -93,6 +100,27 @@ func (h *Handler) handleListRepos(w http.ResponseWriter, r *http.Request, repoTy
 	responseJSON(w, items, http.StatusOK)
 }
 
+// filterDerivedRepos keeps the entries derived from the base models of the "base_model:<id>" and
+// "base_model:<relation>:<id>" filter tags, as told by the model tree, so that only their metadata is read.
+func (h *Handler) filterDerivedRepos(entries []repoEntry, filterTags []string) []repoEntry {
+	for _, tag := range filterTags {
+		baseModel, ok := strings.CutPrefix(tag, "base_model:")
+		if !ok {
+			continue
+		}
+		relation := ""
+		if rel, id, ok := strings.Cut(baseModel, ":"); ok && slices.Contains(hf.BaseModelRelations, rel) {
+			relation, baseModel = rel, id
+		}
+		derived := h.modelTree.Derived(baseModel, relation)
+		entries = slices.DeleteFunc(entries, func(e repoEntry) bool {
+			_, found := slices.BinarySearch(derived, e.fullName)
+			return !found
+		})
+	}
+	return entries
+}
+
 // repoEntry represents a discovered repository on disk.
 type repoEntry struct {
 	fullName string // "namespace/repo"
@@ -153,7 +181,7 @@ func discoverReposInNamespace(nsPath, nsName string) []repoEntry {
 
 // buildRepoListItems converts discovered repo entries into list items,
 // applying search and tag filters and reading metadata from each repository.
-func buildRepoListItems(entries []repoEntry, isModel bool, search string, filterTags []string) []repoListItem {
+func (h *Handler) buildRepoListItems(ctx context.Context, entries []repoEntry, isModel bool, search string, filterTags []string) []repoListItem {
 	var items []repoListItem
 	for _, e := range entries {
 		if search != "" && !strings.Contains(strings.ToLower(e.fullName), strings.ToLower(search)) {
@@ -168,7 +196,7 @@ func buildRepoListItems(entries []repoEntry, isModel bool, search string, filter
 		}
 
 		if repo, err := repository.Open(e.repoPath); err == nil {
-			meta := collectRepoMetadata(repo, repo.DefaultBranch())
+			meta := h.collectRepoMetadata(ctx, repo, repo.DefaultBranch(), isModel, nil)
 			item.Tags = meta.tags
 			item.PipelineTag = meta.pipelineTag
 			item.LibraryName = meta.libraryName
@@ -184,7 +212,7 @@ func buildRepoListItems(entries []repoEntry, isModel bool, search string, filter
 }
 
 // repoMetadata holds metadata extracted from a repository's README.md
-// front matter and config.json. It is the single source of truth for
+// front matter, config.json and GGUF headers. It is the single source of truth for
 // tag collection, pipeline_tag, library_name, cardData, and createdAt,
 // used by both the list endpoints and the individual repo info endpoint.
 type repoMetadata struct {
@@ -192,13 +220,22 @@ type repoMetadata struct {
 	pipelineTag string
 	libraryName string
 	cardData    any
+	gguf        *gguf.Info
+
+	config           *hf.RepoConfig
+	transformersInfo *hf.TransformersInfo
 }
 
 // collectRepoMetadata reads metadata from an already-opened repository at the
 // given revision. It extracts tags, pipeline_tag, library_name, and cardData
 // from README.md YAML front matter and config.json, and derives createdAt
-// from the latest commit date.
-func collectRepoMetadata(repo *repository.Repository, rev string) repoMetadata {
+// from the latest commit date. GGUF files add the "gguf" tag and their file types.
+// When the card of a model does not tell them, library_name and pipeline_tag are inferred
+// from the layout and configuration files of the repository. The base models of
+// the card add "base_model:<id>" and "base_model:<relation>:<id>" tags.
+// The files of the repository at rev are read from entries, listed recursively, which are listed
+// when nil so that callers having them do not walk the tree again.
+func (h *Handler) collectRepoMetadata(ctx context.Context, repo *repository.Repository, rev string, isModel bool, entries []*repository.TreeEntry) repoMetadata {
 	var meta repoMetadata
 
 	seen := make(map[string]struct{})
@@ -213,6 +250,7 @@ func collectRepoMetadata(repo *repository.Repository, rev string) repoMetadata {
 	}
 
 	// README.md YAML front matter
+	var card *hf.Card
 	if blob, err := repo.Blob(rev, "README.md"); err == nil {
 		if rc, err := blob.NewReader(); err == nil {
 			if rm, err := hf.ParseReadme(rc); err == nil {
@@ -222,22 +260,58 @@ func collectRepoMetadata(repo *repository.Repository, rev string) repoMetadata {
 				meta.pipelineTag = rm.Card.PipelineTag
 				meta.libraryName = rm.Card.LibraryName
 				meta.cardData = rm.CardData
+				card = rm.Card
 			}
 			rc.Close()
 		}
 	}
 
-	// config.json
-	if blob, err := repo.Blob(rev, "config.json"); err == nil {
-		if rc, err := blob.NewReader(); err == nil {
-			if cfg, err := hf.ParseConfigData(rc); err == nil {
-				for _, tag := range cfg.Tags() {
-					addTag(tag)
-				}
+	if !isModel {
+		addTag(meta.libraryName)
+		addTag(meta.pipelineTag)
+		return meta
+	}
+
+	// config.json and the other files telling the library of the model
+	if entries == nil {
+		entries, _ = repo.Tree(rev, "", &repository.TreeOptions{Recursive: true})
+	}
+	files := hf.ReadModelFiles(repo, rev, entries)
+	if files.Config != nil {
+		for _, tag := range files.Config.Tags() {
+			addTag(tag)
+		}
+	}
+
+	// GGUF headers, described when the repository was pushed
+	if info, err := h.gguf.Info(ctx, repo, rev, entries); err != nil {
+		slog.WarnContext(ctx, "Failed to describe GGUF models", "rev", rev, "error", err)
+	} else if info != nil {
+		addTag("gguf")
+		for _, fileType := range info.FileTypes {
+			addTag(fileType)
+		}
+		meta.gguf = info
+	}
+
+	// The card tells the library and task; files only fill what it leaves out
+	if meta.libraryName == "" {
+		meta.libraryName = files.LibraryName()
+	}
+	if meta.pipelineTag == "" {
+		meta.pipelineTag = files.PipelineTag()
+	}
+	addTag(meta.libraryName)
+	addTag(meta.pipelineTag)
+	if card != nil {
+		for _, base := range hf.BaseModels(card, files) {
+			for _, tag := range base.Tags() {
+				addTag(tag)
 			}
-			rc.Close()
 		}
 	}
+	meta.config = files.RepoConfig()
+	meta.transformersInfo = files.TransformersInfo()
 
 	return meta
 }
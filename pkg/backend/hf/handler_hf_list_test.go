@@ -4,8 +4,13 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/matrixhub-ai/hfd/pkg/modeltree"
+	"github.com/matrixhub-ai/hfd/pkg/storage"
 )
 
 func TestHandleListModelsEmpty(t *testing.T) {
@@ -828,3 +833,83 @@ func TestHandleListModelsSortByTrendingScore(t *testing.T) {
 		t.Fatalf("Expected 2 models, got %d", len(items))
 	}
 }
+
+func TestHandleListModelsBaseModelFilter(t *testing.T) {
+	store := storage.NewStorage(storage.WithRootDir(t.TempDir()))
+	modelTree := modeltree.NewIndex(modeltree.WithStorage(store))
+	server := httptest.NewServer(NewHandler(
+		WithStorage(store),
+		WithPostReceiveHookFunc(modelTree.PostReceiveHook),
+		WithModelTree(modelTree),
+	))
+	t.Cleanup(server.Close)
+	endpoint := server.URL
+
+	commitCard := func(name, card string) {
+		t.Helper()
+		createRepoAndCommit(t, endpoint, "model", "test-user", name)
+		content, _ := json.Marshal(card)
+		ndjson := "{\"key\":\"header\",\"value\":{\"summary\":\"Update card\"}}\n" +
+			"{\"key\":\"file\",\"value\":{\"content\":" + string(content) + ",\"path\":\"README.md\",\"encoding\":\"utf-8\"}}\n"
+		resp, err := http.Post(endpoint+"/api/models/test-user/"+name+"/commit/main", "application/x-ndjson", strings.NewReader(ndjson))
+		if err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200 for commit, got %d", resp.StatusCode)
+		}
+	}
+	commitCard("base", "---\nlicense: mit\n---\n")
+	commitCard("finetune", "---\nbase_model: test-user/base\n---\n")
+	commitCard("quantized", "---\nbase_model: test-user/base\nbase_model_relation: quantized\n---\n")
+	commitCard("other", "---\nbase_model: test-user/other\n---\n")
+
+	list := func(query string) []string {
+		t.Helper()
+		resp, err := http.Get(endpoint + "/api/models?" + query)
+		if err != nil {
+			t.Fatalf("Failed to list models: %v", err)
+		}
+		defer resp.Body.Close()
+		var items []repoListItem
+		if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+			t.Fatalf("Failed to decode models: %v", err)
+		}
+		var ids []string
+		for _, item := range items {
+			ids = append(ids, item.ModelID)
+		}
+		return ids
+	}
+	if got := list("filter=base_model:test-user/base"); !reflect.DeepEqual(got, []string{"test-user/finetune", "test-user/quantized"}) {
+		t.Errorf("Expected the models derived from the base model, got %v", got)
+	}
+	if got := list("filter=base_model:quantized:test-user/base"); !reflect.DeepEqual(got, []string{"test-user/quantized"}) {
+		t.Errorf("Expected the quantizations of the base model, got %v", got)
+	}
+
+	resp, err := http.Get(endpoint + "/api/models/test-user/finetune")
+	if err != nil {
+		t.Fatalf("Failed to get repo info: %v", err)
+	}
+	defer resp.Body.Close()
+	var info repoInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		t.Fatalf("Failed to decode repo info: %v", err)
+	}
+	if !matchesAllTags(info.Tags, []string{"base_model:test-user/base", "base_model:finetune:test-user/base"}) {
+		t.Errorf("Expected base_model tags, got %v", info.Tags)
+	}
+
+	// Moved repositories are found under their new name
+	resp, err = http.Post(endpoint+"/api/repos/move", "application/json",
+		strings.NewReader(`{"fromRepo":"test-user/finetune","toRepo":"test-user/renamed","type":"model"}`))
+	if err != nil {
+		t.Fatalf("Failed to move repo: %v", err)
+	}
+	resp.Body.Close()
+	if got := list("filter=base_model:test-user/base"); !reflect.DeepEqual(got, []string{"test-user/quantized", "test-user/renamed"}) {
+		t.Errorf("Expected the moved model to be found, got %v", got)
+	}
+}
@@ -0,0 +1,192 @@
+package hf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+
+	"github.com/matrixhub-ai/hfd/pkg/maintenance"
+	"github.com/matrixhub-ai/hfd/pkg/permission"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+)
+
+// maintenanceRequest is the body of a maintenance run request. Without tasks, all tasks are run.
+type maintenanceRequest struct {
+	Tasks []repository.MaintenanceTask `json:"tasks,omitempty"`
+}
+
+// handleMaintenanceStatus handles GET /api/{repoType}/{namespace}/{repo}/maintenance
+// It reports the maintenance status of the repository.
+func (h *Handler) handleMaintenanceStatus(w http.ResponseWriter, r *http.Request) {
+	ri := getRepoInformation(r)
+
+	if h.permissionHookFunc != nil {
+		if ok, err := h.permissionHookFunc(r.Context(), permission.OperationReadRepo, ri.RepoName, permission.Context{}); err != nil {
+			responseJSON(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if !ok {
+			responseJSON(w, "permission denied", http.StatusForbidden)
+			return
+		}
+	}
+
+	if h.maintenance == nil {
+		responseJSON(w, fmt.Errorf("maintenance is not configured"), http.StatusNotFound)
+		return
+	}
+
+	repoPath := h.storage.ResolvePath(ri.RepoName)
+	if repoPath == "" || !repository.IsRepository(repoPath) {
+		responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
+		return
+	}
+
+	responseJSON(w, h.maintenance.Status(ri.RepoName), http.StatusOK)
+}
+
+// handleMaintenanceRun handles POST /api/{repoType}/{namespace}/{repo}/maintenance
+// It schedules the requested maintenance tasks of the repository to run as soon as possible.
+func (h *Handler) handleMaintenanceRun(w http.ResponseWriter, r *http.Request) {
+	ri := getRepoInformation(r)
+
+	if h.permissionHookFunc != nil {
+		if ok, err := h.permissionHookFunc(r.Context(), permission.OperationUpdateRepo, ri.RepoName, permission.Context{}); err != nil {
+			responseJSON(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if !ok {
+			responseJSON(w, "permission denied", http.StatusForbidden)
+			return
+		}
+	}
+
+	if h.maintenance == nil {
+		responseJSON(w, fmt.Errorf("maintenance is not configured"), http.StatusNotFound)
+		return
+	}
+
+	var req maintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		responseJSON(w, fmt.Errorf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	for _, task := range req.Tasks {
+		if !task.Valid() {
+			responseJSON(w, fmt.Errorf("unknown maintenance task %q", task), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := h.maintenance.Run(r.Context(), ri.RepoName, req.Tasks...); err != nil {
+		if errors.Is(err, repository.ErrRepositoryNotExists) {
+			responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
+			return
+		}
+		responseJSON(w, fmt.Errorf("failed to schedule maintenance of repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
+		return
+	}
+	responseJSON(w, h.maintenance.Status(ri.RepoName), http.StatusAccepted)
+}
+
+// adminMaintenanceRequest is the body of a server-wide maintenance run request.
+// Without repos, all repositories are maintained; without tasks, all tasks are run.
+type adminMaintenanceRequest struct {
+	Repos []string                     `json:"repos,omitempty"`
+	Tasks []repository.MaintenanceTask `json:"tasks,omitempty"`
+}
+
+// handleAdminMaintenanceStatus handles GET /api/admin/maintenance
+// It reports the maintenance status of every repository, keyed by repository name.
+func (h *Handler) handleAdminMaintenanceStatus(w http.ResponseWriter, r *http.Request) {
+	if h.permissionHookFunc != nil {
+		if ok, err := h.permissionHookFunc(r.Context(), permission.OperationManageServer, "", permission.Context{}); err != nil {
+			responseJSON(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if !ok {
+			responseJSON(w, "permission denied", http.StatusForbidden)
+			return
+		}
+	}
+
+	if h.maintenance == nil {
+		responseJSON(w, fmt.Errorf("maintenance is not configured"), http.StatusNotFound)
+		return
+	}
+
+	statuses := map[string]maintenance.Status{}
+	for _, repoName := range h.allRepoNames() {
+		statuses[repoName] = h.maintenance.Status(repoName)
+	}
+	responseJSON(w, statuses, http.StatusOK)
+}
+
+// handleAdminMaintenanceRun handles POST /api/admin/maintenance
+// It schedules the requested maintenance tasks of the given repositories, or of all of them,
+// to run as soon as possible.
+func (h *Handler) handleAdminMaintenanceRun(w http.ResponseWriter, r *http.Request) {
+	if h.permissionHookFunc != nil {
+		if ok, err := h.permissionHookFunc(r.Context(), permission.OperationManageServer, "", permission.Context{}); err != nil {
+			responseJSON(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if !ok {
+			responseJSON(w, "permission denied", http.StatusForbidden)
+			return
+		}
+	}
+
+	if h.maintenance == nil {
+		responseJSON(w, fmt.Errorf("maintenance is not configured"), http.StatusNotFound)
+		return
+	}
+
+	var req adminMaintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		responseJSON(w, fmt.Errorf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	for _, task := range req.Tasks {
+		if !task.Valid() {
+			responseJSON(w, fmt.Errorf("unknown maintenance task %q", task), http.StatusBadRequest)
+			return
+		}
+	}
+
+	repoNames := req.Repos
+	if len(repoNames) == 0 {
+		repoNames = h.allRepoNames()
+	}
+	for _, repoName := range repoNames {
+		repoPath := h.storage.ResolvePath(repoName)
+		if repoPath == "" || !repository.IsRepository(repoPath) {
+			responseJSON(w, fmt.Errorf("repository %q not found", repoName), http.StatusNotFound)
+			return
+		}
+	}
+
+	statuses := map[string]maintenance.Status{}
+	for _, repoName := range repoNames {
+		if err := h.maintenance.Run(r.Context(), repoName, req.Tasks...); err != nil {
+			responseJSON(w, fmt.Errorf("failed to schedule maintenance of repository %q: %v", repoName, err), http.StatusInternalServerError)
+			return
+		}
+		statuses[repoName] = h.maintenance.Status(repoName)
+	}
+	responseJSON(w, statuses, http.StatusAccepted)
+}
+
+// allRepoNames returns the names of all models, datasets and spaces in the storage.
+func (h *Handler) allRepoNames() []string {
+	reposDir := h.storage.RepositoriesDir()
+	var names []string
+	for _, e := range discoverRepos(reposDir, true, "") {
+		names = append(names, e.fullName)
+	}
+	for _, repoType := range []string{"datasets", "spaces"} {
+		for _, e := range discoverRepos(filepath.Join(reposDir, repoType), false, "") {
+			names = append(names, repoType+"/"+e.fullName)
+		}
+	}
+	return names
+}
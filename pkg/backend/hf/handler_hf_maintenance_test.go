@@ -0,0 +1,107 @@
+package hf
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matrixhub-ai/hfd/pkg/maintenance"
+	"github.com/matrixhub-ai/hfd/pkg/permission"
+	"github.com/matrixhub-ai/hfd/pkg/storage"
+)
+
+func TestHuggingFaceAdminMaintenance(t *testing.T) {
+	store := storage.NewStorage(storage.WithRootDir(t.TempDir()))
+	scheduler := maintenance.NewScheduler(
+		maintenance.WithStorage(store),
+		maintenance.WithDelay(0),
+	)
+	var admin atomic.Bool
+	server := httptest.NewServer(NewHandler(
+		WithStorage(store),
+		WithMaintenance(scheduler),
+		WithPermissionHookFunc(func(ctx context.Context, op permission.Operation, repoName string, opCtx permission.Context) (bool, error) {
+			return op != permission.OperationManageServer || admin.Load(), nil
+		}),
+	))
+	t.Cleanup(server.Close)
+	endpoint := server.URL
+
+	for _, body := range []string{
+		`{"type":"model","name":"model","organization":"test-org"}`,
+		`{"type":"dataset","name":"dataset","organization":"test-org"}`,
+	} {
+		resp, err := http.Post(endpoint+"/api/repos/create", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to create repo: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := http.Post(endpoint+"/api/admin/maintenance", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Failed to run maintenance: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected status 403 without the permission, got %d", resp.StatusCode)
+	}
+
+	admin.Store(true)
+	resp, err = http.Post(endpoint+"/api/admin/maintenance", "application/json", strings.NewReader(`{"repos":["test-org/missing"]}`))
+	if err != nil {
+		t.Fatalf("Failed to run maintenance: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected status 404 for a missing repository, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(endpoint+"/api/admin/maintenance", "application/json", strings.NewReader(`{"tasks":["commit-graph"]}`))
+	if err != nil {
+		t.Fatalf("Failed to run maintenance: %v", err)
+	}
+	var scheduled map[string]maintenance.Status
+	if err := json.NewDecoder(resp.Body).Decode(&scheduled); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", resp.StatusCode)
+	}
+	if len(scheduled) != 2 {
+		t.Fatalf("Expected both repositories to be scheduled, got %v", scheduled)
+	}
+
+	deadline := time.Now().Add(30 * time.Second)
+	for _, repoName := range []string{"test-org/model", "datasets/test-org/dataset"} {
+		for {
+			status := scheduler.Status(repoName)
+			if status.State == maintenance.StateIdle && len(status.LastTasks) == 1 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected maintenance of %s to run, got %+v", repoName, status)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	resp, err = http.Get(endpoint + "/api/admin/maintenance")
+	if err != nil {
+		t.Fatalf("Failed to get maintenance status: %v", err)
+	}
+	var statuses map[string]maintenance.Status
+	if err := json.NewDecoder(resp.Body).Decode(&statuses); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	resp.Body.Close()
+	if status := statuses["datasets/test-org/dataset"]; status.State != maintenance.StateIdle || status.LastRun.IsZero() {
+		t.Fatalf("Unexpected status of the dataset: %+v", status)
+	}
+}
@@ -0,0 +1,208 @@
+package hf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/matrixhub-ai/hfd/internal/lru"
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/mirror"
+	"github.com/matrixhub-ai/hfd/pkg/notebook"
+	"github.com/matrixhub-ai/hfd/pkg/permission"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+)
+
+const (
+	// notebookCacheSize is the number of rendered notebooks kept in memory.
+	notebookCacheSize = 256
+	// maxCachedNotebooksSize is the total size of the rendered notebooks kept in memory.
+	maxCachedNotebooksSize = 256 << 20
+
+	// maxNotebookSize is the size of the largest notebook that is rendered.
+	maxNotebookSize = 32 << 20
+)
+
+var errNotebookTooLarge = fmt.Errorf("notebook larger than %d bytes", maxNotebookSize)
+
+// newNotebookCache creates the cache of rendered notebooks, by object ID.
+func newNotebookCache() *lru.Cache[string, []byte] {
+	c := lru.New[string, []byte](notebookCacheSize)
+	c.MaxSize = maxCachedNotebooksSize
+	c.SizeOf = func(key string, content []byte) int64 {
+		return int64(len(content))
+	}
+	return c
+}
+
+// notebookCSP keeps rendered notebooks from running scripts or loading anything but images, should the sanitizer miss something.
+const notebookCSP = "default-src 'none'; img-src * data:; style-src 'unsafe-inline'; sandbox allow-popups allow-popups-to-escape-sandbox"
+
+// handleNotebook handles GET /api/{repoType}/{namespace}/{repo}/notebook/{rev}/{path}
+// It renders a Jupyter notebook as a sanitized HTML document. As huggingface.co does, it answers
+// with the URL of the rendered document, which is served with ?format=html.
+func (h *Handler) handleNotebook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	ri := getRepoInformation(r)
+	revpath := vars["revpath"]
+
+	if h.permissionHookFunc != nil {
+		if ok, err := h.permissionHookFunc(r.Context(), permission.OperationReadRepo, ri.RepoName, permission.Context{}); err != nil {
+			responseJSON(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if !ok {
+			responseJSON(w, "permission denied", http.StatusForbidden)
+			return
+		}
+	}
+
+	repoPath := h.storage.ResolvePath(ri.RepoName)
+	if repoPath == "" {
+		responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
+		return
+	}
+
+	if lazy, err := h.isLazy(r.Context(), repoPath, ri.RepoName); err != nil {
+		responseJSON(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if lazy {
+		h.handleLazyAPI(w, r, ri)
+		return
+	}
+
+	repo, err := h.openRepo(r.Context(), repoPath, ri.RepoName, repository.GitUploadPack)
+	if err != nil {
+		if errors.Is(err, repository.ErrRepositoryNotExists) {
+			responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, mirror.ErrUpstreamUnavailable) {
+			responseJSON(w, fmt.Errorf("repository %q is not available: %v", ri.RepoName, err), http.StatusServiceUnavailable)
+			return
+		}
+		responseJSON(w, fmt.Errorf("failed to open repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
+		return
+	}
+
+	rev, file, err := repo.SplitRevisionAndPath(revpath)
+	if err != nil {
+		responseJSON(w, fmt.Errorf("failed to parse rev and path for repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
+		return
+	}
+	if !strings.HasSuffix(file, ".ipynb") {
+		responseJSON(w, fmt.Errorf("file %q is not a notebook", file), http.StatusBadRequest)
+		return
+	}
+
+	commit, err := repo.ResolveRevision(rev)
+	if err != nil {
+		responseJSON(w, fmt.Errorf("revision %q not found in repository %q", rev, ri.RepoName), http.StatusNotFound)
+		return
+	}
+
+	blob, err := repo.Blob(commit, file)
+	if err != nil {
+		responseJSON(w, fmt.Errorf("file %q not found in repository %q at revision %q", file, ri.RepoName, rev), http.StatusNotFound)
+		return
+	}
+
+	content, etag, err := h.renderNotebook(r.Context(), blob)
+	if err != nil {
+		switch {
+		case errors.Is(err, lfs.ErrObjectNotAvailable):
+			responseJSON(w, fmt.Errorf("notebook %q is not available: %v", file, err), http.StatusNotFound)
+		case errors.Is(err, mirror.ErrUpstreamUnavailable):
+			responseJSON(w, fmt.Errorf("notebook %q is not available: %v", file, err), http.StatusServiceUnavailable)
+		default:
+			responseJSON(w, fmt.Errorf("failed to render notebook %q: %v", file, err), http.StatusBadRequest)
+		}
+		return
+	}
+
+	origin := requestOrigin(r)
+	if r.URL.Query().Get("format") != "html" {
+		responseJSON(w, notebookURL{
+			URL: origin + "/api/" + ri.RepoType + "/" + ri.FullName + "/notebook/" + commit + "/" + escapePath(file) + "?format=html",
+		}, http.StatusOK)
+		return
+	}
+
+	header := w.Header()
+	header.Set("X-Repo-Commit", commit)
+	header.Set("ETag", etag)
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Set("Content-Security-Policy", notebookCSP)
+	header.Set("X-Content-Type-Options", "nosniff")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+
+	// Links and images relative to the notebook point to the files of the same commit
+	dir := ""
+	if d := path.Dir(file); d != "." {
+		dir = escapePath(d) + "/"
+	}
+	_ = notebook.WriteDocument(w, content, notebook.Options{
+		Title: path.Base(file),
+		Base:  "/" + ri.RepoName + "/resolve/" + commit + "/" + dir,
+	})
+}
+
+// renderNotebook returns the cells of a notebook rendered as HTML and its ETag, caching them by object ID.
+// The cells do not depend on where the notebook is, which the document they are written in tells.
+func (h *Handler) renderNotebook(ctx context.Context, blob *repository.Blob) ([]byte, string, error) {
+	// Content that does not parse as a pointer is the file itself
+	ptr, _ := blob.LFSPointer()
+
+	key := blob.Hash().String()
+	size := blob.Size()
+	open := blob.NewReader
+	if ptr != nil {
+		key = ptr.OID()
+		size = ptr.Size()
+		open = func() (io.ReadCloser, error) {
+			return lfs.OpenHead(ctx, h.lfsStorage, h.lfsTeeCache, ptr.OID(), ptr.Size())
+		}
+	}
+	etag := fmt.Sprintf("\"%s\"", key)
+	if content, ok := h.notebooks.Get(key); ok {
+		return content, etag, nil
+	}
+	if size > maxNotebookSize {
+		return nil, "", errNotebookTooLarge
+	}
+
+	rc, err := open()
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+	nb, err := notebook.Parse(io.LimitReader(rc, maxNotebookSize))
+	if err != nil {
+		return nil, "", err
+	}
+	content := notebook.Render(nb)
+	h.notebooks.Add(key, content)
+	return content, etag, nil
+}
+
+// escapePath escapes the segments of a slash separated path for URLs.
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,122 @@
+package hf
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHuggingFaceNotebook(t *testing.T) {
+	server, _ := setupTestServer(t)
+	endpoint := server.URL
+	api := endpoint + "/api/datasets/test-user/notebooks"
+
+	createRepoAndCommit(t, endpoint, "dataset", "test-user", "notebooks")
+	nb := `{"cells": [` +
+		`{"cell_type": "markdown", "metadata": {}, "source": ["# Analysis\n", "![chart](chart.png)<script>alert(1)</script>"]},` +
+		`{"cell_type": "code", "execution_count": 1, "metadata": {}, "source": "1 + 1", "outputs": [{"output_type": "execute_result", "execution_count": 1, "data": {"text/plain": "2"}, "metadata": {}}]}` +
+		`], "metadata": {"language_info": {"name": "python"}}, "nbformat": 4, "nbformat_minor": 5}`
+	value, _ := json.Marshal(map[string]string{"content": base64.StdEncoding.EncodeToString([]byte(nb)), "path": "docs/analysis.ipynb", "encoding": "base64"})
+	ndjson := "{\"key\":\"header\",\"value\":{\"summary\":\"Add notebook\"}}\n" +
+		"{\"key\":\"file\",\"value\":" + string(value) + "}\n" +
+		"{\"key\":\"lfsFile\",\"value\":{\"path\":\"large.ipynb\",\"algo\":\"sha256\",\"oid\":\"" + strings.Repeat("0", 64) + "\",\"size\":10}}\n"
+	resp, err := http.Post(api+"/commit/main", "application/x-ndjson", strings.NewReader(ndjson))
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	var commit commitResponse
+	err = json.NewDecoder(resp.Body).Decode(&commit)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 for commit, got %d: %v", resp.StatusCode, err)
+	}
+
+	resp, err = http.Get(api + "/notebook/main/docs/analysis.ipynb")
+	if err != nil {
+		t.Fatalf("Failed to get notebook: %v", err)
+	}
+	var result notebookURL
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 for notebook, got %d: %v", resp.StatusCode, err)
+	}
+	want := api + "/notebook/" + commit.CommitOid + "/docs/analysis.ipynb?format=html"
+	if result.URL != want {
+		t.Fatalf("Expected notebook URL %q, got %q", want, result.URL)
+	}
+
+	resp, err = http.Get(result.URL)
+	if err != nil {
+		t.Fatalf("Failed to get rendered notebook: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Fatalf("Expected 200 with HTML, got %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(resp.Header.Get("Content-Security-Policy"), "default-src 'none'") {
+		t.Errorf("Expected a restrictive content security policy, got %q", resp.Header.Get("Content-Security-Policy"))
+	}
+	html := string(body)
+	for _, s := range []string{
+		"<h1>Analysis</h1>",
+		`<base href="/datasets/test-user/notebooks/resolve/` + commit.CommitOid + `/docs/">`,
+		`<img src="chart.png" alt="chart">`,
+		`<code class="language-python">1 + 1</code>`,
+		"<pre>2</pre>",
+	} {
+		if !strings.Contains(html, s) {
+			t.Errorf("Expected the rendered notebook to contain %q, got:\n%s", s, html)
+		}
+	}
+	if strings.Contains(html, "<script>") {
+		t.Errorf("Expected scripts to be removed")
+	}
+
+	// Rendered notebooks of a commit do not change
+	req, _ := http.NewRequest(http.MethodGet, result.URL, nil)
+	req.Header.Set("If-None-Match", resp.Header.Get("ETag"))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to get rendered notebook: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("Expected 304 for a cached notebook, got %d", resp.StatusCode)
+	}
+
+	// Rendered notebooks do not depend on the host they are requested from
+	req, _ = http.NewRequest(http.MethodGet, result.URL, nil)
+	req.Host = "hub.example.com"
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to get rendered notebook: %v", err)
+	}
+	other, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(other) != html {
+		t.Errorf("Expected the same notebook from another host, got:\n%s", other)
+	}
+
+	for _, tt := range []struct {
+		path string
+		code int
+	}{
+		{"/notebook/main/README.md", http.StatusBadRequest},
+		{"/notebook/main/missing.ipynb", http.StatusNotFound},
+		{"/notebook/main/large.ipynb", http.StatusNotFound},
+	} {
+		resp, err := http.Get(api + tt.path)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", tt.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.code {
+			t.Errorf("Expected %d for %s, got %d", tt.code, tt.path, resp.StatusCode)
+		}
+	}
+}
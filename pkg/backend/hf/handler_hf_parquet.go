@@ -0,0 +1,155 @@
+package hf
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+
+	"github.com/matrixhub-ai/hfd/pkg/convert"
+	"github.com/matrixhub-ai/hfd/pkg/mirror"
+	"github.com/matrixhub-ai/hfd/pkg/permission"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+)
+
+// handleParquetFiles handles GET /api/datasets/{namespace}/{repo}/parquet[/{config}[/{split}]]
+// It lists the URLs of the Parquet files of the convert ref of a dataset, by config and split
+// as huggingface.co does: all configs, the splits of a config, or the files of a split.
+func (h *Handler) handleParquetFiles(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	ri := getRepoInformation(r)
+
+	if h.permissionHookFunc != nil {
+		if ok, err := h.permissionHookFunc(r.Context(), permission.OperationReadRepo, ri.RepoName, permission.Context{}); err != nil {
+			responseJSON(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if !ok {
+			responseJSON(w, "permission denied", http.StatusForbidden)
+			return
+		}
+	}
+
+	repoPath := h.storage.ResolvePath(ri.RepoName)
+	if repoPath == "" {
+		responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
+		return
+	}
+
+	repo, err := h.openRepo(r.Context(), repoPath, ri.RepoName, repository.GitUploadPack)
+	if err != nil {
+		if errors.Is(err, repository.ErrRepositoryNotExists) {
+			responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, mirror.ErrUpstreamUnavailable) {
+			responseJSON(w, fmt.Errorf("repository %q is not available: %v", ri.RepoName, err), http.StatusServiceUnavailable)
+			return
+		}
+		responseJSON(w, fmt.Errorf("failed to open repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
+		return
+	}
+
+	files, err := convert.ListFiles(repo)
+	if err != nil {
+		responseJSON(w, fmt.Errorf("failed to list parquet files of %q: %v", ri.RepoName, err), http.StatusInternalServerError)
+		return
+	}
+	if len(files) == 0 {
+		responseJSON(w, fmt.Errorf("dataset %q has no parquet files", ri.FullName), http.StatusNotFound)
+		return
+	}
+
+	baseURL := requestOrigin(r) + "/datasets/" + ri.FullName + "/resolve/" + url.PathEscape(convert.ParquetRef) + "/"
+	configs := map[string]map[string][]string{}
+	for _, f := range files {
+		splits, ok := configs[f.Config]
+		if !ok {
+			splits = map[string][]string{}
+			configs[f.Config] = splits
+		}
+		splits[f.Split] = append(splits[f.Split], baseURL+f.Path)
+	}
+
+	config, split := vars["config"], vars["split"]
+	if config == "" {
+		responseJSON(w, configs, http.StatusOK)
+		return
+	}
+	splits, ok := configs[config]
+	if !ok {
+		responseJSON(w, fmt.Errorf("config %q not found", config), http.StatusNotFound)
+		return
+	}
+	if split == "" {
+		responseJSON(w, splits, http.StatusOK)
+		return
+	}
+	urls, ok := splits[split]
+	if !ok {
+		responseJSON(w, fmt.Errorf("split %q of config %q not found", split, config), http.StatusNotFound)
+		return
+	}
+	responseJSON(w, urls, http.StatusOK)
+}
+
+// handleParquetStatus handles GET /api/datasets/{namespace}/{repo}/convert/parquet
+// It reports the state of the conversion of a dataset to Parquet.
+func (h *Handler) handleParquetStatus(w http.ResponseWriter, r *http.Request) {
+	ri := getRepoInformation(r)
+
+	if h.permissionHookFunc != nil {
+		if ok, err := h.permissionHookFunc(r.Context(), permission.OperationReadRepo, ri.RepoName, permission.Context{}); err != nil {
+			responseJSON(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if !ok {
+			responseJSON(w, "permission denied", http.StatusForbidden)
+			return
+		}
+	}
+
+	if h.converter == nil {
+		responseJSON(w, fmt.Errorf("parquet conversion is not configured"), http.StatusNotFound)
+		return
+	}
+
+	repoPath := h.storage.ResolvePath(ri.RepoName)
+	if repoPath == "" || !repository.IsRepository(repoPath) {
+		responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
+		return
+	}
+
+	responseJSON(w, h.converter.Status(ri.RepoName), http.StatusOK)
+}
+
+// handleParquetRun handles POST /api/datasets/{namespace}/{repo}/convert/parquet
+// It converts a dataset to Parquet again as soon as possible.
+func (h *Handler) handleParquetRun(w http.ResponseWriter, r *http.Request) {
+	ri := getRepoInformation(r)
+
+	if h.permissionHookFunc != nil {
+		if ok, err := h.permissionHookFunc(r.Context(), permission.OperationUpdateRepo, ri.RepoName, permission.Context{}); err != nil {
+			responseJSON(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if !ok {
+			responseJSON(w, "permission denied", http.StatusForbidden)
+			return
+		}
+	}
+
+	if h.converter == nil {
+		responseJSON(w, fmt.Errorf("parquet conversion is not configured"), http.StatusNotFound)
+		return
+	}
+
+	if err := h.converter.Run(r.Context(), ri.RepoName); err != nil {
+		if errors.Is(err, repository.ErrRepositoryNotExists) {
+			responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
+			return
+		}
+		responseJSON(w, fmt.Errorf("failed to schedule parquet conversion of repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
+		return
+	}
+	responseJSON(w, h.converter.Status(ri.RepoName), http.StatusAccepted)
+}
@@ -0,0 +1,153 @@
+package hf
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matrixhub-ai/hfd/pkg/convert"
+	"github.com/matrixhub-ai/hfd/pkg/storage"
+)
+
+func TestHuggingFaceParquetConversion(t *testing.T) {
+	store := storage.NewStorage(storage.WithRootDir(t.TempDir()))
+	converter := convert.NewConverter(convert.WithStorage(store))
+	server := httptest.NewServer(NewHandler(
+		WithStorage(store),
+		WithPostReceiveHookFunc(converter.PostReceiveHook),
+		WithConverter(converter),
+	))
+	t.Cleanup(server.Close)
+	endpoint := server.URL
+	api := endpoint + "/api/datasets/test-user/pq-data"
+
+	createRepoAndCommit(t, endpoint, "dataset", "test-user", "pq-data")
+	ndjson := "{\"key\":\"header\",\"value\":{\"summary\":\"Add data\"}}\n" +
+		"{\"key\":\"file\",\"value\":{\"content\":\"text,label\\na,1\\nb,0\\n\",\"path\":\"train.csv\",\"encoding\":\"utf-8\"}}\n" +
+		"{\"key\":\"file\",\"value\":{\"content\":\"text,label\\nc,1\\n\",\"path\":\"test.csv\",\"encoding\":\"utf-8\"}}\n"
+	resp, err := http.Post(api+"/commit/main", "application/x-ndjson", strings.NewReader(ndjson))
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 for commit, got %d", resp.StatusCode)
+	}
+
+	getJSON := func(url string, v any) int {
+		t.Helper()
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", url, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusOK && v != nil {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatalf("Failed to decode %s: %v", url, err)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	waitConverted := func(after time.Time) convert.Status {
+		t.Helper()
+		deadline := time.Now().Add(30 * time.Second)
+		for {
+			var status convert.Status
+			if code := getJSON(api+"/convert/parquet", &status); code != http.StatusOK {
+				t.Fatalf("Expected 200 for conversion status, got %d", code)
+			}
+			if status.State == convert.StateDone && status.LastRun.After(after) {
+				return status
+			}
+			if status.State == convert.StateFailed || time.Now().After(deadline) {
+				t.Fatalf("Unexpected conversion status %+v", status)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	status := waitConverted(time.Time{})
+
+	// The convert ref is listed with the refs
+	var refs gitRefs
+	if code := getJSON(api+"/refs", &refs); code != http.StatusOK {
+		t.Fatalf("Expected 200 for refs, got %d", code)
+	}
+	if len(refs.Converts) != 1 || refs.Converts[0].Name != "parquet" ||
+		refs.Converts[0].Ref != "refs/convert/parquet" || refs.Converts[0].TargetCommit != status.Commit {
+		t.Errorf("Unexpected converts %+v", refs.Converts)
+	}
+
+	var configs map[string]map[string][]string
+	if code := getJSON(api+"/parquet", &configs); code != http.StatusOK {
+		t.Fatalf("Expected 200 for parquet files, got %d", code)
+	}
+	wantURL := endpoint + "/datasets/test-user/pq-data/resolve/refs%2Fconvert%2Fparquet/default/train/0000.parquet"
+	if len(configs) != 1 || len(configs["default"]) != 2 || len(configs["default"]["train"]) != 1 ||
+		configs["default"]["train"][0] != wantURL {
+		t.Fatalf("Unexpected parquet files %v", configs)
+	}
+	var urls []string
+	if code := getJSON(api+"/parquet/default/test", &urls); code != http.StatusOK || len(urls) != 1 {
+		t.Errorf("Expected the files of the test split, got %d %v", code, urls)
+	}
+	if code := getJSON(api+"/parquet/other", nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing config, got %d", code)
+	}
+
+	// The files and the info of the convert ref are served as those of a branch
+	resp, err = http.Get(wantURL)
+	if err != nil {
+		t.Fatalf("Failed to download parquet file: %v", err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(string(data), "PAR1") {
+		t.Errorf("Expected a parquet file, got %d %q", resp.StatusCode, data)
+	}
+	var info map[string]any
+	if code := getJSON(api+"/revision/refs%2Fconvert%2Fparquet", &info); code != http.StatusOK || info["sha"] != status.Commit {
+		t.Errorf("Expected the info of the convert ref, got %d %v", code, info["sha"])
+	}
+
+	resp, err = http.Post(api+"/convert/parquet", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Failed to trigger conversion: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("Expected 202 for a conversion run, got %d", resp.StatusCode)
+	}
+	if rerun := waitConverted(status.LastRun); rerun.Revision != status.Revision {
+		t.Errorf("Expected the conversion of revision %s, got %+v", status.Revision, rerun)
+	}
+}
+
+func TestHuggingFaceParquetNotConfigured(t *testing.T) {
+	server, _ := setupTestServer(t)
+	endpoint := server.URL
+
+	createRepoAndCommit(t, endpoint, "dataset", "test-user", "plain-data")
+
+	resp, err := http.Get(endpoint + "/api/datasets/test-user/plain-data/convert/parquet")
+	if err != nil {
+		t.Fatalf("Failed to get conversion status: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 without a converter, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(endpoint + "/api/datasets/test-user/plain-data/parquet")
+	if err != nil {
+		t.Fatalf("Failed to get parquet files: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for a dataset without parquet files, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,75 @@
+package hf
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/matrixhub-ai/hfd/pkg/permission"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+)
+
+// handlePushMirrorStatus handles GET /api/{repoType}/{namespace}/{repo}/push-mirrors
+// It reports the replication status of the repository to each of its push mirror remotes.
+func (h *Handler) handlePushMirrorStatus(w http.ResponseWriter, r *http.Request) {
+	ri := getRepoInformation(r)
+
+	if h.permissionHookFunc != nil {
+		if ok, err := h.permissionHookFunc(r.Context(), permission.OperationReadRepo, ri.RepoName, permission.Context{}); err != nil {
+			responseJSON(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if !ok {
+			responseJSON(w, "permission denied", http.StatusForbidden)
+			return
+		}
+	}
+
+	if h.pushMirror == nil {
+		responseJSON(w, fmt.Errorf("push mirrors are not configured"), http.StatusNotFound)
+		return
+	}
+
+	repoPath := h.storage.ResolvePath(ri.RepoName)
+	if repoPath == "" || !repository.IsRepository(repoPath) {
+		responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
+		return
+	}
+
+	status, err := h.pushMirror.Status(r.Context(), ri.RepoName)
+	if err != nil {
+		responseJSON(w, fmt.Errorf("failed to get push mirror status for repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
+		return
+	}
+	responseJSON(w, status, http.StatusOK)
+}
+
+// handlePushMirrorSync handles POST /api/{repoType}/{namespace}/{repo}/push-mirrors/sync
+// It queues all branches and tags of the repository for pushing to its push mirror remotes.
+func (h *Handler) handlePushMirrorSync(w http.ResponseWriter, r *http.Request) {
+	ri := getRepoInformation(r)
+
+	if h.permissionHookFunc != nil {
+		if ok, err := h.permissionHookFunc(r.Context(), permission.OperationUpdateRepo, ri.RepoName, permission.Context{}); err != nil {
+			responseJSON(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if !ok {
+			responseJSON(w, "permission denied", http.StatusForbidden)
+			return
+		}
+	}
+
+	if h.pushMirror == nil {
+		responseJSON(w, fmt.Errorf("push mirrors are not configured"), http.StatusNotFound)
+		return
+	}
+
+	if err := h.pushMirror.Sync(r.Context(), ri.RepoName); err != nil {
+		if errors.Is(err, repository.ErrRepositoryNotExists) {
+			responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
+			return
+		}
+		responseJSON(w, fmt.Errorf("failed to sync push mirrors of repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
+		return
+	}
+	responseJSON(w, nil, http.StatusAccepted)
+}
@@ -12,7 +12,7 @@ import (
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/gorilla/mux"
 
-	"github.com/matrixhub-ai/hfd/pkg/authenticate"
+	"github.com/matrixhub-ai/hfd/pkg/mirror"
 	"github.com/matrixhub-ai/hfd/pkg/permission"
 	"github.com/matrixhub-ai/hfd/pkg/receive"
 	"github.com/matrixhub-ai/hfd/pkg/repository"
@@ -41,12 +41,24 @@ func (h *Handler) handleInfoRevision(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if lazy, err := h.isLazy(r.Context(), repoPath, ri.RepoName); err != nil {
+		responseJSON(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if lazy {
+		h.handleLazyAPI(w, r, ri)
+		return
+	}
+
 	repo, err := h.openRepo(r.Context(), repoPath, ri.RepoName, repository.GitUploadPack)
 	if err != nil {
 		if errors.Is(err, repository.ErrRepositoryNotExists) {
 			responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
 			return
 		}
+		if errors.Is(err, mirror.ErrUpstreamUnavailable) {
+			responseJSON(w, fmt.Errorf("repository %q is not available: %v", ri.RepoName, err), http.StatusServiceUnavailable)
+			return
+		}
 		responseJSON(w, fmt.Errorf("failed to open repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
 		return
 	}
@@ -81,8 +93,8 @@ func (h *Handler) handleInfoRevision(w http.ResponseWriter, r *http.Request) {
 		commitHash = commits[0].Hash().String()
 	}
 
-	// Collect metadata (tags, cardData, pipeline_tag, etc.) from README.md and config.json.
-	meta := collectRepoMetadata(repo, rev)
+	// Collect metadata (tags, cardData, pipeline_tag, etc.) from README.md, config.json and GGUF headers.
+	meta := h.collectRepoMetadata(r.Context(), repo, rev, ri.RepoType == "models", hfEntries)
 
 	tags := meta.tags
 	if tags == nil {
@@ -101,11 +113,22 @@ func (h *Handler) handleInfoRevision(w http.ResponseWriter, r *http.Request) {
 		Siblings:    siblings,
 		CardData:    meta.cardData,
 		UsedStorage: usedStorage,
+		GGUF:        meta.gguf,
+		PipelineTag: meta.pipelineTag,
+		LibraryName: meta.libraryName,
+		Config:      meta.config,
 	}
 
 	// For models, also set the modelId field which is required by some HuggingFace clients. For datasets and spaces, the client doesn't require it and it can be confusing to have it be different from the ID, so we leave it empty.
 	if ri.RepoType == "models" {
 		hfInfo.ModelID = hfInfo.ID
+		hfInfo.TransformersInfo = meta.transformersInfo
+
+		info, err := h.safetensors.Info(r.Context(), repo, rev)
+		if err != nil {
+			slog.WarnContext(r.Context(), "Failed to read safetensors weights", "repo", ri.RepoName, "rev", rev, "error", err)
+		}
+		hfInfo.Safetensors = info
 	}
 
 	responseJSON(w, hfInfo, http.StatusOK)
@@ -160,6 +183,9 @@ func (h *Handler) handleDeleteRepo(w http.ResponseWriter, r *http.Request) {
 		responseJSON(w, fmt.Errorf("failed to delete repository %q: %v", repoName, err), http.StatusInternalServerError)
 		return
 	}
+	if h.modelTree != nil {
+		h.modelTree.Remove(storageName)
+	}
 
 	w.WriteHeader(http.StatusOK)
 }
@@ -225,6 +251,9 @@ func (h *Handler) handleMoveRepo(w http.ResponseWriter, r *http.Request) {
 		responseJSON(w, fmt.Errorf("failed to move repository: %v", err), http.StatusInternalServerError)
 		return
 	}
+	if h.modelTree != nil {
+		h.modelTree.Rename(fromName, toName)
+	}
 
 	w.WriteHeader(http.StatusOK)
 }
@@ -317,15 +346,19 @@ func (h *Handler) handleCreateBranch(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Resolve the starting point to a hash so the hooks have the target commit
+	newRev, _ := repo.ResolveRevision(req.StartingPoint)
+	if newRev == "" {
+		newRev, _ = repo.RefHash(plumbing.NewBranchReferenceName(repo.DefaultBranch()))
+	}
+	updates := []receive.RefUpdate{
+		receive.NewRefUpdate(receive.ZeroHash, newRev, "refs/heads/"+rev, repo.RepoPath()),
+	}
+
 	if h.preReceiveHookFunc != nil {
-		// Resolve the starting point to a hash so the hook has the target commit
-		newRev, _ := repo.ResolveRevision(req.StartingPoint)
-		if newRev == "" {
-			newRev, _ = repo.RefHash(plumbing.NewBranchReferenceName(repo.DefaultBranch()))
-		}
-		if ok, err := h.preReceiveHookFunc(r.Context(), ri.RepoName, []receive.RefUpdate{
-			receive.NewRefUpdate(receive.ZeroHash, newRev, "refs/heads/"+rev, repo.RepoPath()),
-		}); err != nil {
+		ctx, endPush := receive.WithPush(r.Context())
+		defer endPush()
+		if ok, err := h.preReceiveHookFunc(ctx, ri.RepoName, updates); err != nil {
 			responseJSON(w, err.Error(), http.StatusInternalServerError)
 			return
 		} else if !ok {
@@ -334,6 +367,15 @@ func (h *Handler) handleCreateBranch(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if err := h.checkRefUpdates(r.Context(), ri.RepoName, repo, updates); err != nil {
+		if errors.Is(err, errRefUpdateRejected) {
+			responseJSON(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		responseJSON(w, fmt.Errorf("failed to check branch %q: %v", rev, err), http.StatusInternalServerError)
+		return
+	}
+
 	revision := req.StartingPoint
 	if err := repo.CreateBranch(rev, revision); err != nil {
 		responseJSON(w, fmt.Errorf("failed to create branch %q: %v", rev, err), http.StatusInternalServerError)
@@ -410,7 +452,9 @@ func (h *Handler) handleDeleteBranch(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if h.preReceiveHookFunc != nil {
-		if ok, err := h.preReceiveHookFunc(r.Context(), ri.RepoName, updates); err != nil {
+		ctx, endPush := receive.WithPush(r.Context())
+		defer endPush()
+		if ok, err := h.preReceiveHookFunc(ctx, ri.RepoName, updates); err != nil {
 			responseJSON(w, err.Error(), http.StatusInternalServerError)
 			return
 		} else if !ok {
@@ -491,12 +535,23 @@ func (h *Handler) handleCreateTag(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Tags with a message are annotated, and so are all tags when they can be signed
+	annotated := req.Message != "" || h.signer != nil
+	if annotated && h.cannotSign("refs/tags/"+req.Tag) {
+		responseJSON(w, fmt.Errorf("tag %q only accepts signed tags", req.Tag), http.StatusForbidden)
+		return
+	}
+
+	// Resolve the revision to a hash so the hooks have the target commit
+	newRev, _ := repo.ResolveRevision(rev)
+	updates := []receive.RefUpdate{
+		receive.NewRefUpdate(receive.ZeroHash, newRev, "refs/tags/"+req.Tag, repo.RepoPath()),
+	}
+
 	if h.preReceiveHookFunc != nil {
-		// Resolve the revision to a hash so the hook has the target commit
-		newRev, _ := repo.ResolveRevision(rev)
-		if ok, err := h.preReceiveHookFunc(r.Context(), ri.RepoName, []receive.RefUpdate{
-			receive.NewRefUpdate(receive.ZeroHash, newRev, "refs/tags/"+req.Tag, repo.RepoPath()),
-		}); err != nil {
+		ctx, endPush := receive.WithPush(r.Context())
+		defer endPush()
+		if ok, err := h.preReceiveHookFunc(ctx, ri.RepoName, updates); err != nil {
 			responseJSON(w, err.Error(), http.StatusInternalServerError)
 			return
 		} else if !ok {
@@ -505,7 +560,27 @@ func (h *Handler) handleCreateTag(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if err := repo.CreateTag(req.Tag, rev); err != nil {
+	// The commits the tag points to are checked, the tag itself being signed by the server
+	if err := h.checkRefUpdates(r.Context(), ri.RepoName, repo, updates); err != nil {
+		if errors.Is(err, errRefUpdateRejected) {
+			responseJSON(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		responseJSON(w, fmt.Errorf("failed to check tag %q: %v", req.Tag, err), http.StatusInternalServerError)
+		return
+	}
+
+	if annotated {
+		message := req.Message
+		if message == "" {
+			message = req.Tag
+		}
+		user := h.commitAuthor(r.Context())
+		err = repo.CreateAnnotatedTag(req.Tag, rev, message, user.User, user.Email, h.commitOptions()...)
+	} else {
+		err = repo.CreateTag(req.Tag, rev)
+	}
+	if err != nil {
 		responseJSON(w, fmt.Errorf("failed to create tag %q: %v", req.Tag, err), http.StatusInternalServerError)
 		return
 	}
@@ -574,7 +649,9 @@ func (h *Handler) handleDeleteTag(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if h.preReceiveHookFunc != nil {
-		if ok, err := h.preReceiveHookFunc(r.Context(), ri.RepoName, updates); err != nil {
+		ctx, endPush := receive.WithPush(r.Context())
+		defer endPush()
+		if ok, err := h.preReceiveHookFunc(ctx, ri.RepoName, updates); err != nil {
 			responseJSON(w, err.Error(), http.StatusInternalServerError)
 			return
 		} else if !ok {
@@ -623,6 +700,10 @@ func (h *Handler) handleListRefs(w http.ResponseWriter, r *http.Request) {
 			responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
 			return
 		}
+		if errors.Is(err, mirror.ErrUpstreamUnavailable) {
+			responseJSON(w, fmt.Errorf("repository %q is not available: %v", ri.RepoName, err), http.StatusServiceUnavailable)
+			return
+		}
 		responseJSON(w, fmt.Errorf("failed to open repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
 		return
 	}
@@ -668,16 +749,39 @@ func (h *Handler) handleListRefs(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
+	// List conversions, such as refs/convert/parquet
+	convertNames, err := repo.Converts()
+	if err != nil {
+		convertNames = nil
+	}
+
+	var converts []gitRefInfo
+	for _, name := range convertNames {
+		refName := plumbing.ReferenceName(repository.ConvertRefPrefix + name)
+		hash, err := repo.RefHash(refName)
+		if err != nil {
+			continue
+		}
+		converts = append(converts, gitRefInfo{
+			Name:         name,
+			Ref:          refName.String(),
+			TargetCommit: hash,
+		})
+	}
+
 	if branches == nil {
 		branches = []gitRefInfo{}
 	}
+	if converts == nil {
+		converts = []gitRefInfo{}
+	}
 	if tags == nil {
 		tags = []gitRefInfo{}
 	}
 
 	refs := gitRefs{
 		Branches: branches,
-		Converts: []gitRefInfo{},
+		Converts: converts,
 		Tags:     tags,
 	}
 	responseJSON(w, refs, http.StatusOK)
@@ -712,6 +816,10 @@ func (h *Handler) handleListCommits(w http.ResponseWriter, r *http.Request) {
 			responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
 			return
 		}
+		if errors.Is(err, mirror.ErrUpstreamUnavailable) {
+			responseJSON(w, fmt.Errorf("repository %q is not available: %v", ri.RepoName, err), http.StatusServiceUnavailable)
+			return
+		}
 		responseJSON(w, fmt.Errorf("failed to open repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
 		return
 	}
@@ -749,11 +857,12 @@ func (h *Handler) handleListCommits(w http.ResponseWriter, r *http.Request) {
 	commitInfos := make([]commitInfo, 0, len(rawCommits))
 	for _, c := range rawCommits {
 		commitInfos = append(commitInfos, commitInfo{
-			ID:      c.Hash().String(),
-			Title:   c.Title(),
-			Message: c.Message(),
-			Authors: []commitAuthor{{User: c.Author().Name()}},
-			Date:    c.Author().When().UTC().Format(repository.TimeFormat),
+			ID:           c.Hash().String(),
+			Title:        c.Title(),
+			Message:      c.Message(),
+			Authors:      []commitAuthor{{User: c.Author().Name()}},
+			Date:         c.Author().When().UTC().Format(repository.TimeFormat),
+			Verification: h.commitVerificationOf(r.Context(), &c),
 		})
 	}
 
@@ -798,6 +907,10 @@ func (h *Handler) handleCompare(w http.ResponseWriter, r *http.Request) {
 			responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
 			return
 		}
+		if errors.Is(err, mirror.ErrUpstreamUnavailable) {
+			responseJSON(w, fmt.Errorf("repository %q is not available: %v", ri.RepoName, err), http.StatusServiceUnavailable)
+			return
+		}
 		responseJSON(w, fmt.Errorf("failed to open repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
 		return
 	}
@@ -872,8 +985,15 @@ func (h *Handler) handleSuperSquash(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if h.cannotSign("refs/heads/" + rev) {
+		responseJSON(w, fmt.Errorf("branch %q only accepts signed commits", rev), http.StatusForbidden)
+		return
+	}
+
 	if h.preReceiveHookFunc != nil {
-		if ok, err := h.preReceiveHookFunc(r.Context(), ri.RepoName, []receive.RefUpdate{
+		ctx, endPush := receive.WithPush(r.Context())
+		defer endPush()
+		if ok, err := h.preReceiveHookFunc(ctx, ri.RepoName, []receive.RefUpdate{
 			receive.NewRefUpdate(receive.BreakHash, receive.BreakHash, "refs/heads/"+rev, repo.RepoPath()),
 		}); err != nil {
 			responseJSON(w, err.Error(), http.StatusInternalServerError)
@@ -884,20 +1004,14 @@ func (h *Handler) handleSuperSquash(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	user, ok := authenticate.GetUserInfo(r.Context())
-	if !ok {
-		user = authenticate.UserInfo{
-			User:  "HuggingFace",
-			Email: "hf@users.noreply.huggingface.co",
-		}
-	}
+	user := h.commitAuthor(r.Context())
 
 	message := req.Message
 	if message == "" {
 		message = "Super-squash branch '" + rev + "'"
 	}
 
-	if _, err := repo.SuperSquash(r.Context(), rev, message, user.User, user.Email); err != nil {
+	if _, err := repo.SuperSquash(r.Context(), rev, message, user.User, user.Email, h.commitOptions()...); err != nil {
 		responseJSON(w, fmt.Errorf("failed to squash repository %q rev %q: %v", ri.RepoName, rev, err), http.StatusInternalServerError)
 		return
 	}
@@ -1,6 +1,8 @@
 package hf
 
 import (
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -539,6 +541,163 @@ func TestHuggingFaceRepoInfoUsedStorage(t *testing.T) {
 	}
 }
 
+func TestHuggingFaceRepoInfoSafetensors(t *testing.T) {
+	server, _ := setupTestServer(t)
+	endpoint := server.URL
+
+	createRepoAndCommit(t, endpoint, "model", "test-user", "safetensors-model")
+
+	// Commit a safetensors file of a single 2x3 BF16 tensor
+	header := `{"__metadata__":{"format":"pt"},"w":{"dtype":"BF16","shape":[2,3],"data_offsets":[0,12]}}`
+	file := binary.LittleEndian.AppendUint64(nil, uint64(len(header)))
+	file = append(file, header...)
+	file = append(file, make([]byte, 12)...)
+	ndjson := "{\"key\":\"header\",\"value\":{\"summary\":\"Add weights\"}}\n" +
+		"{\"key\":\"file\",\"value\":{\"content\":\"" + base64.StdEncoding.EncodeToString(file) + "\",\"path\":\"model.safetensors\",\"encoding\":\"base64\"}}\n"
+	resp, err := http.Post(endpoint+"/api/models/test-user/safetensors-model/commit/main", "application/x-ndjson", strings.NewReader(ndjson))
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 for commit, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(endpoint + "/api/models/test-user/safetensors-model")
+	if err != nil {
+		t.Fatalf("Failed to get repo info: %v", err)
+	}
+	defer resp.Body.Close()
+	var info repoInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		t.Fatalf("Failed to decode repo info: %v", err)
+	}
+	if info.Safetensors == nil {
+		t.Fatal("Expected safetensors in repo info")
+	}
+	if info.Safetensors.Total != 6 || info.Safetensors.Parameters["BF16"] != 6 {
+		t.Errorf("Unexpected safetensors %+v", info.Safetensors)
+	}
+
+	// The client reads the header with a range request
+	req, _ := http.NewRequest(http.MethodGet, endpoint+"/test-user/safetensors-model/resolve/main/model.safetensors", nil)
+	req.Header.Set("Range", "bytes=0-7")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to resolve: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatalf("Expected 206, got %d", resp.StatusCode)
+	}
+	content, _ := io.ReadAll(resp.Body)
+	if binary.LittleEndian.Uint64(content) != uint64(len(header)) {
+		t.Errorf("Unexpected header size bytes %v", content)
+	}
+
+	// Repositories without weights have no safetensors
+	createRepoAndCommit(t, endpoint, "model", "test-user", "plain-model")
+	resp, err = http.Get(endpoint + "/api/models/test-user/plain-model")
+	if err != nil {
+		t.Fatalf("Failed to get repo info: %v", err)
+	}
+	defer resp.Body.Close()
+	var plain map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&plain); err != nil {
+		t.Fatalf("Failed to decode repo info: %v", err)
+	}
+	if _, ok := plain["safetensors"]; ok {
+		t.Errorf("Expected no safetensors, got %v", plain["safetensors"])
+	}
+}
+
+func TestHuggingFaceRepoInfoLibrary(t *testing.T) {
+	server, _ := setupTestServer(t)
+	endpoint := server.URL
+
+	createRepoAndCommit(t, endpoint, "model", "test-user", "causal-model")
+	createRepoAndCommit(t, endpoint, "model", "test-user", "adapter-model")
+
+	commit := func(name string, files map[string]string) {
+		t.Helper()
+		ndjson := "{\"key\":\"header\",\"value\":{\"summary\":\"Add config\"}}\n"
+		for path, content := range files {
+			ndjson += "{\"key\":\"file\",\"value\":{\"content\":\"" + base64.StdEncoding.EncodeToString([]byte(content)) + "\",\"path\":\"" + path + "\",\"encoding\":\"base64\"}}\n"
+		}
+		resp, err := http.Post(endpoint+"/api/"+name+"/commit/main", "application/x-ndjson", strings.NewReader(ndjson))
+		if err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200 for commit, got %d", resp.StatusCode)
+		}
+	}
+	commit("models/test-user/causal-model", map[string]string{
+		"config.json":           `{"architectures":["LlamaForCausalLM"],"model_type":"llama"}`,
+		"tokenizer_config.json": `{"bos_token":"<s>","eos_token":"</s>","model_max_length":4096}`,
+	})
+	commit("models/test-user/adapter-model", map[string]string{
+		"adapter_config.json": `{"base_model_name_or_path":"test-user/causal-model","task_type":"CAUSAL_LM","peft_type":"LORA"}`,
+	})
+
+	resp, err := http.Get(endpoint + "/api/models/test-user/causal-model")
+	if err != nil {
+		t.Fatalf("Failed to get repo info: %v", err)
+	}
+	defer resp.Body.Close()
+	var info repoInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		t.Fatalf("Failed to decode repo info: %v", err)
+	}
+	if info.LibraryName != "transformers" || info.PipelineTag != "text-generation" {
+		t.Errorf("Unexpected library %q and pipeline tag %q", info.LibraryName, info.PipelineTag)
+	}
+	if info.TransformersInfo == nil || info.TransformersInfo.AutoModel != "AutoModelForCausalLM" || info.TransformersInfo.Processor != "AutoTokenizer" {
+		t.Errorf("Unexpected transformersInfo %+v", info.TransformersInfo)
+	}
+	if info.Config == nil || info.Config.ModelType != "llama" || info.Config.TokenizerConfig["eos_token"] != "</s>" {
+		t.Errorf("Unexpected config %+v", info.Config)
+	}
+	for _, tag := range []string{"transformers", "text-generation", "llama"} {
+		if !matchesAllTags(info.Tags, []string{tag}) {
+			t.Errorf("Expected tag %q, got %v", tag, info.Tags)
+		}
+	}
+
+	resp, err = http.Get(endpoint + "/api/models?filter=peft")
+	if err != nil {
+		t.Fatalf("Failed to list models: %v", err)
+	}
+	defer resp.Body.Close()
+	var items []repoListItem
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		t.Fatalf("Failed to decode models: %v", err)
+	}
+	if len(items) != 1 || items[0].ModelID != "test-user/adapter-model" ||
+		items[0].LibraryName != "peft" || items[0].PipelineTag != "text-generation" {
+		t.Errorf("Expected only the adapter, got %+v", items)
+	}
+
+	// The library and task of datasets are not inferred from their files
+	createRepoAndCommit(t, endpoint, "dataset", "test-user", "config-dataset")
+	commit("datasets/test-user/config-dataset", map[string]string{
+		"config.json": `{"architectures":["LlamaForCausalLM"],"model_type":"llama"}`,
+	})
+	resp, err = http.Get(endpoint + "/api/datasets/test-user/config-dataset")
+	if err != nil {
+		t.Fatalf("Failed to get repo info: %v", err)
+	}
+	defer resp.Body.Close()
+	var dataset repoInfo
+	if err := json.NewDecoder(resp.Body).Decode(&dataset); err != nil {
+		t.Fatalf("Failed to decode repo info: %v", err)
+	}
+	if dataset.LibraryName != "" || dataset.PipelineTag != "" || matchesAllTags(dataset.Tags, []string{"llama"}) {
+		t.Errorf("Expected no library, task or config tags for a dataset, got %q, %q, %v", dataset.LibraryName, dataset.PipelineTag, dataset.Tags)
+	}
+}
+
 func TestHuggingFaceDatasetBranchAndTag(t *testing.T) {
 	server, _ := setupTestServer(t)
 	endpoint := server.URL
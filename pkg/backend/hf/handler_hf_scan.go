@@ -0,0 +1,78 @@
+package hf
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/matrixhub-ai/hfd/pkg/mirror"
+	"github.com/matrixhub-ai/hfd/pkg/permission"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+	"github.com/matrixhub-ai/hfd/pkg/scan"
+)
+
+// handleScan handles GET /api/{repoType}/{namespace}/{repo}/scan
+// It reports the security status of the files of the default branch of a repository.
+// Files not scanned yet are scanned in the background, and scansDone is false until they are.
+func (h *Handler) handleScan(w http.ResponseWriter, r *http.Request) {
+	ri := getRepoInformation(r)
+
+	if h.permissionHookFunc != nil {
+		if ok, err := h.permissionHookFunc(r.Context(), permission.OperationReadRepo, ri.RepoName, permission.Context{}); err != nil {
+			responseJSON(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if !ok {
+			responseJSON(w, "permission denied", http.StatusForbidden)
+			return
+		}
+	}
+
+	if h.scanner == nil {
+		responseJSON(w, fmt.Errorf("security scanning is not configured"), http.StatusNotFound)
+		return
+	}
+
+	repoPath := h.storage.ResolvePath(ri.RepoName)
+	if repoPath == "" {
+		responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
+		return
+	}
+
+	repo, err := h.openRepo(r.Context(), repoPath, ri.RepoName, repository.GitUploadPack)
+	if err != nil {
+		if errors.Is(err, repository.ErrRepositoryNotExists) {
+			responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, mirror.ErrUpstreamUnavailable) {
+			responseJSON(w, fmt.Errorf("repository %q is not available: %v", ri.RepoName, err), http.StatusServiceUnavailable)
+			return
+		}
+		responseJSON(w, fmt.Errorf("failed to open repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
+		return
+	}
+
+	status := scanStatus{ScansDone: true, FilesWithIssues: []scanFileIssue{}}
+	files, err := h.scanner.Files(r.Context(), repo, repo.DefaultBranch())
+	if err != nil {
+		// An empty repository has nothing to scan
+		if !errors.Is(err, repository.ErrRevisionNotFound) {
+			responseJSON(w, fmt.Errorf("failed to scan repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
+			return
+		}
+	}
+	for _, f := range files {
+		switch f.Result.Status {
+		case scan.StatusQueued:
+			status.ScansDone = false
+		case scan.StatusCaution, scan.StatusUnsafe:
+			status.HasUnsafeFile = status.HasUnsafeFile || f.Result.Status == scan.StatusUnsafe
+			status.FilesWithIssues = append(status.FilesWithIssues, scanFileIssue{
+				Path:   f.Path,
+				Level:  f.Result.Status,
+				Issues: f.Result.Issues,
+			})
+		}
+	}
+	responseJSON(w, status, http.StatusOK)
+}
@@ -0,0 +1,186 @@
+package hf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/scan"
+	"github.com/matrixhub-ai/hfd/pkg/secrets"
+	"github.com/matrixhub-ai/hfd/pkg/storage"
+)
+
+func TestHuggingFaceScan(t *testing.T) {
+	store := storage.NewStorage(storage.WithRootDir(t.TempDir()))
+	scanner := scan.NewScanner(scan.WithStorage(store), scan.WithLFSStorage(lfs.NewLocal(store.LFSDir())))
+	server := httptest.NewServer(NewHandler(
+		WithStorage(store),
+		WithPostReceiveHookFunc(scanner.PostReceiveHook),
+		WithScanner(scanner),
+	))
+	t.Cleanup(server.Close)
+	endpoint := server.URL
+	api := endpoint + "/api/models/test-user/scanned"
+
+	createRepoAndCommit(t, endpoint, "model", "test-user", "scanned")
+	commit := func(path, content string) int {
+		t.Helper()
+		encoded := base64.StdEncoding.EncodeToString([]byte(content))
+		value, _ := json.Marshal(map[string]string{"content": encoded, "path": path, "encoding": "base64"})
+		ndjson := "{\"key\":\"header\",\"value\":{\"summary\":\"Add model\"}}\n" +
+			"{\"key\":\"file\",\"value\":" + string(value) + "}\n"
+		resp, err := http.Post(api+"/commit/main", "application/x-ndjson", strings.NewReader(ndjson))
+		if err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := commit("model.pkl", "cos\nsystem\n(S'echo hi'\ntR."); code != http.StatusOK {
+		t.Fatalf("Expected 200 for commit, got %d", code)
+	}
+
+	var status scanStatus
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		resp, err := http.Get(api + "/scan")
+		if err != nil {
+			t.Fatalf("Failed to get scan status: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			t.Fatalf("Expected 200 for scan status, got %d", resp.StatusCode)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&status)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Failed to decode scan status: %v", err)
+		}
+		if status.ScansDone {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Scans did not complete, got %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !status.HasUnsafeFile || len(status.FilesWithIssues) != 1 ||
+		status.FilesWithIssues[0].Path != "model.pkl" || status.FilesWithIssues[0].Level != scan.StatusUnsafe {
+		t.Fatalf("Expected model.pkl to be unsafe, got %+v", status)
+	}
+
+	// Expanded tree entries tell the security status of files
+	resp, err := http.Get(api + "/tree/main?expand=true")
+	if err != nil {
+		t.Fatalf("Failed to get tree: %v", err)
+	}
+	var entries []treeEntry
+	err = json.NewDecoder(resp.Body).Decode(&entries)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to decode tree: %v", err)
+	}
+	for _, e := range entries {
+		sfs := e.SecurityFileStatus
+		switch e.Path {
+		case "README.md":
+			if sfs == nil || sfs.Status != scan.StatusSafe {
+				t.Errorf("Expected README.md to be safe, got %+v", sfs)
+			}
+		case "model.pkl":
+			if sfs == nil || sfs.Status != scan.StatusUnsafe || sfs.PickleImportScan == nil ||
+				sfs.PickleImportScan.HighestSafetyLevel != scan.SafetyDangerous ||
+				len(sfs.PickleImportScan.Imports) != 1 || sfs.PickleImportScan.Imports[0].Module != "os" {
+				t.Errorf("Expected model.pkl to be unsafe, got %+v", sfs)
+			}
+		}
+	}
+
+	// Unsafe files are rejected when blocking is enabled
+	blocking := httptest.NewServer(NewHandler(
+		WithStorage(store),
+		WithScanner(scanner),
+		WithBlockUnsafeFiles(true),
+	))
+	t.Cleanup(blocking.Close)
+	api = blocking.URL + "/api/models/test-user/scanned"
+	if code := commit("other.pt", "\x80\x04\x8c\x05posix\x94\x8c\x06system\x94\x93."); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unsafe file, got %d", code)
+	}
+	if code := commit("config.json", "{}"); code != http.StatusOK {
+		t.Errorf("Expected 200 for a safe file, got %d", code)
+	}
+	// Files whose LFS object is not uploaded cannot be scanned, so they are rejected too
+	ndjson := "{\"key\":\"header\",\"value\":{\"summary\":\"Add weights\"}}\n" +
+		"{\"key\":\"lfsFile\",\"value\":{\"path\":\"model.bin\",\"algo\":\"sha256\",\"oid\":\"" + strings.Repeat("0", 64) + "\",\"size\":10}}\n"
+	resp, err = http.Post(api+"/commit/main", "application/x-ndjson", strings.NewReader(ndjson))
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a file whose LFS object is not uploaded, got %d", resp.StatusCode)
+	}
+}
+
+func TestHuggingFaceScanNotConfigured(t *testing.T) {
+	server, _ := setupTestServer(t)
+	endpoint := server.URL
+
+	createRepoAndCommit(t, endpoint, "model", "test-user", "unscanned")
+
+	resp, err := http.Get(endpoint + "/api/models/test-user/unscanned/scan")
+	if err != nil {
+		t.Fatalf("Failed to get scan status: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 without a scanner, got %d", resp.StatusCode)
+	}
+}
+
+func TestHuggingFaceCommitSecrets(t *testing.T) {
+	store := storage.NewStorage(storage.WithRootDir(t.TempDir()))
+	var auditLog bytes.Buffer
+	server := httptest.NewServer(NewHandler(
+		WithStorage(store),
+		WithSecretScanner(secrets.NewScanner(secrets.WithPolicy(secrets.PolicyReject), secrets.WithAuditLog(&auditLog))),
+	))
+	t.Cleanup(server.Close)
+	endpoint := server.URL
+
+	createRepoAndCommit(t, endpoint, "model", "test-user", "secrets")
+	commit := func(path, content string) (int, string) {
+		t.Helper()
+		value, _ := json.Marshal(map[string]string{"content": content, "path": path})
+		ndjson := "{\"key\":\"header\",\"value\":{\"summary\":\"Add script\"}}\n" +
+			"{\"key\":\"file\",\"value\":" + string(value) + "}\n"
+		resp, err := http.Post(endpoint+"/api/models/test-user/secrets/commit/main", "application/x-ndjson", strings.NewReader(ndjson))
+		if err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	// The token is assembled from parts, so that the test is not taken for a leak itself
+	token := "hf_" + "AbCdEfGhIjKlMnOpQrStUvWxYz01234567"
+	if code, body := commit("train.py", "from huggingface_hub import login\nlogin(\""+token+"\")\n"); code != http.StatusBadRequest ||
+		!strings.Contains(body, "train.py:2 (Hugging Face access token)") {
+		t.Errorf("Expected 400 for a file with a secret, got %d: %s", code, body)
+	}
+	if !strings.Contains(auditLog.String(), `"action":"rejected"`) || strings.Contains(auditLog.String(), token) {
+		t.Errorf("Expected the rejection to be audited without the secret, got %s", auditLog.String())
+	}
+	if code, body := commit("train.py", "from huggingface_hub import login\nlogin()\n"); code != http.StatusOK {
+		t.Errorf("Expected 200 for a file without secrets, got %d: %s", code, body)
+	}
+}
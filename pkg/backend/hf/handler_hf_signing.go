@@ -0,0 +1,109 @@
+package hf
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/matrixhub-ai/hfd/pkg/authenticate"
+	"github.com/matrixhub-ai/hfd/pkg/receive"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+)
+
+// commitAuthor returns the author of the commits made for a request: the authenticated user,
+// or else the committer of the server, completed with a placeholder identity.
+func (h *Handler) commitAuthor(ctx context.Context) authenticate.UserInfo {
+	if user, ok := authenticate.GetUserInfo(ctx); ok {
+		return user
+	}
+	return authenticate.UserInfo{
+		User:  cmp.Or(h.committerName, "HuggingFace"),
+		Email: cmp.Or(h.committerEmail, "hf@users.noreply.huggingface.co"),
+	}
+}
+
+// commitOptions returns the options the commits and tags made by the server are created with.
+func (h *Handler) commitOptions() []repository.CommitOption {
+	var opts []repository.CommitOption
+	if h.signer != nil {
+		opts = append(opts, repository.WithSigner(h.signer))
+	}
+	if h.committerName != "" || h.committerEmail != "" {
+		opts = append(opts, repository.WithCommitter(h.committerName, h.committerEmail))
+	}
+	return opts
+}
+
+// cannotSign reports whether ref only accepts verified commits and tags while the server does not sign its own,
+// or has no committer email its key is trusted for.
+func (h *Handler) cannotSign(ref string) bool {
+	return (h.signer == nil || h.committerEmail == "") && h.signaturePolicy != nil && h.signaturePolicy.IsProtected(ref)
+}
+
+// errRefUpdateRejected is returned by checkRefUpdates when the quarantine hook rejects the updates.
+var errRefUpdateRejected = errors.New("ref update rejected")
+
+// checkRefUpdates runs the quarantine hook on ref updates made by the server to objects already in the repository,
+// so that they are checked like a push. Updates to commits already reachable from the refs of the repository,
+// such as branches and tags created at existing commits, bring no new content: only their signatures are checked.
+func (h *Handler) checkRefUpdates(ctx context.Context, repoName string, repo *repository.Repository, updates []receive.RefUpdate) error {
+	if h.quarantineHookFunc == nil {
+		return nil
+	}
+	q, err := receive.NewRefQuarantine(repo.RepoPath())
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+
+	hook := h.quarantineHookFunc
+	reachable, err := reachableFromRefs(ctx, q, updates)
+	if err != nil {
+		return err
+	}
+	if reachable {
+		if h.signaturePolicy == nil {
+			return nil
+		}
+		hook = h.signaturePolicy.Check
+	}
+	if err := hook(ctx, repoName, q, updates); err != nil {
+		return fmt.Errorf("%w: %v", errRefUpdateRejected, err)
+	}
+	return nil
+}
+
+// reachableFromRefs reports whether the new revisions of updates are all reachable from the refs of the repository.
+func reachableFromRefs(ctx context.Context, q *receive.Quarantine, updates []receive.RefUpdate) (bool, error) {
+	for _, u := range updates {
+		if u.IsDelete() {
+			continue
+		}
+		commits, err := q.NewCommits(ctx, u.NewRev())
+		if err != nil {
+			return false, err
+		}
+		if len(commits) != 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// commitVerificationOf reports the signature status of a commit.
+func (h *Handler) commitVerificationOf(ctx context.Context, c *repository.Commit) commitVerification {
+	result, err := c.Verify(h.verifier)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to verify commit signature", "commit", c.Hash(), "error", err)
+		return commitVerification{Reason: "unverifiable"}
+	}
+	return commitVerification{
+		Verified:    result.Verified,
+		Reason:      string(result.Status),
+		Format:      string(result.Format),
+		Fingerprint: result.Fingerprint,
+		Signer:      result.Signer,
+	}
+}
@@ -0,0 +1,315 @@
+package hf
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/matrixhub-ai/hfd/pkg/receive"
+	"github.com/matrixhub-ai/hfd/pkg/signature"
+	"github.com/matrixhub-ai/hfd/pkg/storage"
+)
+
+func TestHuggingFaceSignedCommits(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	signer, err := signature.NewSSHSigner(pem.EncodeToMemory(block))
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+
+	dataDir := t.TempDir()
+	store := storage.NewStorage(storage.WithRootDir(dataDir))
+	server := httptest.NewServer(NewHandler(
+		WithStorage(store),
+		WithCommitSigner(signer),
+		WithCommitter("Hub", "hub@example.com"),
+	))
+	t.Cleanup(server.Close)
+	endpoint := server.URL
+
+	resp, err := http.Post(endpoint+"/api/repos/create", "application/json", strings.NewReader(`{"type":"model","name":"signed-model","organization":"test-user"}`))
+	if err != nil {
+		t.Fatalf("Failed to create repo: %v", err)
+	}
+	resp.Body.Close()
+
+	ndjson := "{\"key\":\"header\",\"value\":{\"summary\":\"Add README\"}}\n" +
+		"{\"key\":\"file\",\"value\":{\"content\":\"# Model\\n\",\"path\":\"README.md\",\"encoding\":\"utf-8\"}}\n"
+	resp, err = http.Post(endpoint+"/api/models/test-user/signed-model/commit/main", "application/x-ndjson", strings.NewReader(ndjson))
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 for commit, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(endpoint+"/api/models/test-user/signed-model/tag/main", "application/json", strings.NewReader(`{"tag":"v1"}`))
+	if err != nil {
+		t.Fatalf("Failed to create tag: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 for tag, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(endpoint + "/api/models/test-user/signed-model/commits/main")
+	if err != nil {
+		t.Fatalf("Failed to list commits: %v", err)
+	}
+	var commits []commitInfo
+	if err := json.NewDecoder(resp.Body).Decode(&commits); err != nil {
+		t.Fatalf("Failed to decode commits: %v", err)
+	}
+	resp.Body.Close()
+	if len(commits) != 2 {
+		t.Fatalf("Expected 2 commits, got %d", len(commits))
+	}
+	for _, c := range commits {
+		v := c.Verification
+		if !v.Verified || v.Reason != "valid" || v.Format != "ssh" || v.Fingerprint != signer.Fingerprint() || v.Signer != "hub@example.com" {
+			t.Errorf("Expected commit %q to be verified, got %+v", c.Title, v)
+		}
+		// Without a user, commits are authored by the committer of the server
+		if len(c.Authors) != 1 || c.Authors[0].User != "Hub" {
+			t.Errorf("Expected commit %q to be authored by the committer, got %+v", c.Title, c.Authors)
+		}
+	}
+
+	repoPath := store.ResolvePath("test-user/signed-model")
+	out, err := exec.Command("git", "-C", repoPath, "cat-file", "-p", "v1").Output()
+	if err != nil || !strings.Contains(string(out), "-----BEGIN SSH SIGNATURE-----") {
+		t.Errorf("Expected a signed annotated tag, got %q: %v", out, err)
+	}
+}
+
+func TestHuggingFaceCommitterEmailOnly(t *testing.T) {
+	dataDir := t.TempDir()
+	store := storage.NewStorage(storage.WithRootDir(dataDir))
+	server := httptest.NewServer(NewHandler(
+		WithStorage(store),
+		WithCommitter("", "hub@example.com"),
+	))
+	t.Cleanup(server.Close)
+	endpoint := server.URL
+
+	resp, err := http.Post(endpoint+"/api/repos/create", "application/json", strings.NewReader(`{"type":"model","name":"model","organization":"test-user"}`))
+	if err != nil {
+		t.Fatalf("Failed to create repo: %v", err)
+	}
+	resp.Body.Close()
+
+	ndjson := "{\"key\":\"header\",\"value\":{\"summary\":\"Add README\"}}\n" +
+		"{\"key\":\"file\",\"value\":{\"content\":\"# Model\\n\",\"path\":\"README.md\",\"encoding\":\"utf-8\"}}\n"
+	resp, err = http.Post(endpoint+"/api/models/test-user/model/commit/main", "application/x-ndjson", strings.NewReader(ndjson))
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 for commit, got %d", resp.StatusCode)
+	}
+
+	repoPath := store.ResolvePath("test-user/model")
+	out, err := exec.Command("git", "-C", repoPath, "log", "-1", "--format=%an <%ae>|%cn <%ce>", "main").Output()
+	if err != nil {
+		t.Fatalf("Failed to read commit: %v", err)
+	}
+	if got, want := strings.TrimSpace(string(out)), "HuggingFace <hub@example.com>| <hub@example.com>"; got != want {
+		t.Errorf("Expected identities %q, got %q", want, got)
+	}
+}
+
+func TestHuggingFaceSignaturePolicy(t *testing.T) {
+	dataDir := t.TempDir()
+	store := storage.NewStorage(storage.WithRootDir(dataDir))
+	policy := signature.NewPolicy(signature.NewVerifier(), signature.WithProtectedRefs("refs/heads/main", "refs/heads/release", "refs/tags/*"))
+	server := httptest.NewServer(NewHandler(
+		WithStorage(store),
+		WithSignaturePolicy(policy),
+		WithQuarantineHookFunc(policy.Check),
+	))
+	t.Cleanup(server.Close)
+	endpoint := server.URL + "/api/models/test-user/model"
+
+	resp, err := http.Post(server.URL+"/api/repos/create", "application/json", strings.NewReader(`{"type":"model","name":"model","organization":"test-user"}`))
+	if err != nil {
+		t.Fatalf("Failed to create repo: %v", err)
+	}
+	resp.Body.Close()
+
+	post := func(path, contentType, body string) int {
+		t.Helper()
+		resp, err := http.Post(endpoint+path, contentType, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to post %s: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	ndjson := "{\"key\":\"header\",\"value\":{\"summary\":\"Add README\"}}\n" +
+		"{\"key\":\"file\",\"value\":{\"content\":\"# Model\\n\",\"path\":\"README.md\",\"encoding\":\"utf-8\"}}\n"
+
+	// Without a signer, the server cannot commit to protected branches
+	if status := post("/commit/main", "application/x-ndjson", ndjson); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for a commit to a protected branch, got %d", status)
+	}
+	if status := post("/super-squash/main", "application/json", `{}`); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for a super-squash of a protected branch, got %d", status)
+	}
+	if status := post("/branch/dev", "application/json", `{}`); status != http.StatusOK {
+		t.Fatalf("Expected 200 for an unprotected branch, got %d", status)
+	}
+	if status := post("/commit/dev", "application/x-ndjson", ndjson); status != http.StatusOK {
+		t.Fatalf("Expected 200 for a commit to an unprotected branch, got %d", status)
+	}
+
+	// Refs created by the API are checked like pushes
+	if status := post("/branch/release", "application/json", `{"startingPoint":"dev"}`); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for a protected branch of an unsigned commit, got %d", status)
+	}
+	if status := post("/tag/dev", "application/json", `{"tag":"v1"}`); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for a tag of an unsigned commit, got %d", status)
+	}
+	if status := post("/tag/main", "application/json", `{"tag":"v1","message":"Release"}`); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for an annotated tag the server cannot sign, got %d", status)
+	}
+	if status := post("/branch/release", "application/json", `{"startingPoint":"main"}`); status != http.StatusOK {
+		t.Errorf("Expected 200 for a protected branch of a protected commit, got %d", status)
+	}
+	if status := post("/tag/main", "application/json", `{"tag":"v1"}`); status != http.StatusOK {
+		t.Errorf("Expected 200 for a tag of a protected commit, got %d", status)
+	}
+}
+
+func TestHuggingFaceSignerWithoutCommitter(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	signer, err := signature.NewSSHSigner(pem.EncodeToMemory(block))
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+
+	store := storage.NewStorage(storage.WithRootDir(t.TempDir()))
+	server := httptest.NewServer(NewHandler(
+		WithStorage(store),
+		WithCommitSigner(signer),
+	))
+	t.Cleanup(server.Close)
+	endpoint := server.URL
+
+	resp, err := http.Post(endpoint+"/api/repos/create", "application/json", strings.NewReader(`{"type":"model","name":"model","organization":"test-user"}`))
+	if err != nil {
+		t.Fatalf("Failed to create repo: %v", err)
+	}
+	resp.Body.Close()
+
+	ndjson := "{\"key\":\"header\",\"value\":{\"summary\":\"Add README\"}}\n" +
+		"{\"key\":\"file\",\"value\":{\"content\":\"# Model\\n\",\"path\":\"README.md\",\"encoding\":\"utf-8\"}}\n"
+	resp, err = http.Post(endpoint+"/api/models/test-user/model/commit/main", "application/x-ndjson", strings.NewReader(ndjson))
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 for commit, got %d", resp.StatusCode)
+	}
+
+	// The server key does not vouch for the identity of the authors it signs for
+	resp, err = http.Get(endpoint + "/api/models/test-user/model/commits/main")
+	if err != nil {
+		t.Fatalf("Failed to list commits: %v", err)
+	}
+	var commits []commitInfo
+	if err := json.NewDecoder(resp.Body).Decode(&commits); err != nil {
+		t.Fatalf("Failed to decode commits: %v", err)
+	}
+	resp.Body.Close()
+	if len(commits) == 0 {
+		t.Fatalf("Expected commits")
+	}
+	for _, c := range commits {
+		if v := c.Verification; v.Verified || v.Reason != "unknown_key" {
+			t.Errorf("Expected commit %q not to be verified without a committer, got %+v", c.Title, v)
+		}
+	}
+}
+
+func TestHuggingFaceRefUpdatesOfExistingCommits(t *testing.T) {
+	store := storage.NewStorage(storage.WithRootDir(t.TempDir()))
+	var checked int
+	server := httptest.NewServer(NewHandler(
+		WithStorage(store),
+		WithQuarantineHookFunc(func(ctx context.Context, repoName string, q *receive.Quarantine, updates []receive.RefUpdate) error {
+			checked++
+			return errors.New("rejected content")
+		}),
+	))
+	t.Cleanup(server.Close)
+	endpoint := server.URL + "/api/models/test-user/model"
+
+	resp, err := http.Post(server.URL+"/api/repos/create", "application/json", strings.NewReader(`{"type":"model","name":"model","organization":"test-user"}`))
+	if err != nil {
+		t.Fatalf("Failed to create repo: %v", err)
+	}
+	resp.Body.Close()
+	post := func(path, contentType, body string) int {
+		t.Helper()
+		resp, err := http.Post(endpoint+path, contentType, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to post %s: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	ndjson := "{\"key\":\"header\",\"value\":{\"summary\":\"Add README\"}}\n" +
+		"{\"key\":\"file\",\"value\":{\"content\":\"# Model\\n\",\"path\":\"README.md\",\"encoding\":\"utf-8\"}}\n"
+	if status := post("/commit/main", "application/x-ndjson", ndjson); status != http.StatusOK {
+		t.Fatalf("Expected 200 for commit, got %d", status)
+	}
+
+	// Branches and tags of commits reachable from the refs bring no content to check
+	if status := post("/branch/dev", "application/json", `{"startingPoint":"main"}`); status != http.StatusOK {
+		t.Errorf("Expected 200 for a branch of an existing commit, got %d", status)
+	}
+	if status := post("/tag/main", "application/json", `{"tag":"v1"}`); status != http.StatusOK {
+		t.Errorf("Expected 200 for a tag of an existing commit, got %d", status)
+	}
+	if checked != 0 {
+		t.Errorf("Expected the content hooks to be skipped, ran %d times", checked)
+	}
+
+	// A commit no ref reaches is checked like a push
+	repoPath := store.ResolvePath("test-user/model")
+	cmd := exec.Command("git", "-C", repoPath, "commit-tree", "-m", "dangling", "main^{tree}")
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@test.com", "GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@test.com")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Failed to create commit: %v", err)
+	}
+	dangling := strings.TrimSpace(string(out))
+	if status := post("/branch/other", "application/json", `{"startingPoint":"`+dangling+`"}`); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for a branch of a commit no ref reaches, got %d", status)
+	}
+	if checked != 1 {
+		t.Errorf("Expected the content hooks to run once, ran %d times", checked)
+	}
+}
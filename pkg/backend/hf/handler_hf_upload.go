@@ -1,12 +1,13 @@
 package hf
 
 import (
-	"bufio"
+	"cmp"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
@@ -16,18 +17,27 @@ import (
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/gorilla/mux"
 
-	"github.com/matrixhub-ai/hfd/pkg/authenticate"
+	"github.com/matrixhub-ai/hfd/pkg/hf"
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
 	"github.com/matrixhub-ai/hfd/pkg/permission"
 	"github.com/matrixhub-ai/hfd/pkg/receive"
 	"github.com/matrixhub-ai/hfd/pkg/repository"
+	"github.com/matrixhub-ai/hfd/pkg/scan"
+	"github.com/matrixhub-ai/hfd/pkg/secrets"
 )
 
 const (
 	// lfsThreshold is the file size threshold for LFS upload mode.
 	// Files larger than this will be uploaded via LFS.
 	lfsThreshold = 10 * 1024 * 1024 // 10MB
+
+	// maxCardSize is the largest README.md whose metadata is validated.
+	maxCardSize = 10 * 1024 * 1024 // 10MB
 )
 
+// errCardTooLarge is returned for cards larger than maxCardSize.
+var errCardTooLarge = fmt.Errorf("README.md is larger than %d bytes", maxCardSize)
+
 func requestOrigin(r *http.Request) string {
 	scheme := "http"
 	if r.TLS != nil {
@@ -40,17 +50,24 @@ func requestOrigin(r *http.Request) string {
 }
 
 // handleValidateYAML handles POST /api/validate-yaml
-// This endpoint is called by huggingface_hub to validate YAML front matter in files like README.md.
-// https://github.com/huggingface/huggingface_hub/blob/8708631a463d9a6dc8ec7b046e748cc14844474e/src/huggingface_hub/repocard.py#L189-L224
+// It validates the metadata of a card before it is pushed. Cards with errors are
+// answered with 400, as the Hub does, so that the client raises them.
 func (h *Handler) handleValidateYAML(w http.ResponseWriter, r *http.Request) {
-	// Return a successful validation response
-	responseJSON(w, struct {
-		Errors   []string `json:"errors"`
-		Warnings []string `json:"warnings"`
-	}{
-		Errors:   []string{},
-		Warnings: []string{},
-	}, http.StatusOK)
+	var req validateYAMLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		responseJSON(w, fmt.Errorf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.RepoType == "" {
+		req.RepoType = "model"
+	}
+
+	v := hf.ValidateCard([]byte(req.Content), req.RepoType)
+	if len(v.Errors) != 0 {
+		responseJSON(w, v, http.StatusBadRequest)
+		return
+	}
+	responseJSON(w, v, http.StatusOK)
 }
 
 func repoTypePrefix(repoType string) string {
@@ -93,13 +110,7 @@ func (h *Handler) handleCreateRepo(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	user, ok := authenticate.GetUserInfo(r.Context())
-	if !ok {
-		user = authenticate.UserInfo{
-			User:  "HuggingFace",
-			Email: "hf@users.noreply.huggingface.co",
-		}
-	}
+	user := h.commitAuthor(r.Context())
 
 	urlName := "/" + storageName
 
@@ -133,14 +144,15 @@ func (h *Handler) handleCreateRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create initial commit with default .gitattributes
+	// Create initial commit with default .gitattributes.
+	// Its content is the server's own, so it is made on protected branches even when it cannot be signed.
 	_, err = repo.CreateCommit(context.Background(), defaultBranch, "Initial commit", user.User, user.Email, []repository.CommitOperation{
 		{
 			Type:    repository.CommitOperationAdd,
 			Path:    repository.GitattributesFileName,
 			Content: repository.GitattributesText,
 		},
-	}, "")
+	}, "", h.commitOptions()...)
 	if err != nil {
 		_ = repo.Remove()
 		responseJSON(w, fmt.Errorf("failed to create initial commit: %v", err), http.StatusInternalServerError)
@@ -234,13 +246,7 @@ func (h *Handler) handleCommit(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	user, ok := authenticate.GetUserInfo(r.Context())
-	if !ok {
-		user = authenticate.UserInfo{
-			User:  "HuggingFace",
-			Email: "hf@users.noreply.huggingface.co",
-		}
-	}
+	user := h.commitAuthor(r.Context())
 
 	repoPath := h.storage.ResolvePath(ri.RepoName)
 	if repoPath == "" {
@@ -248,21 +254,51 @@ func (h *Handler) handleCommit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Open the repository
+	repo, err := repository.Open(repoPath)
+	if err != nil {
+		if errors.Is(err, repository.ErrRepositoryNotExists) {
+			responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
+			return
+		}
+		responseJSON(w, fmt.Errorf("failed to open repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
+		return
+	}
+
+	if h.cannotSign("refs/heads/" + rev) {
+		responseJSON(w, fmt.Errorf("branch %q only accepts signed commits", rev), http.StatusForbidden)
+		return
+	}
+
+	// The operations are read one at a time and their content written into blobs right away,
+	// so memory stays bounded whatever the size of the commit. The blobs stay in quarantine
+	// until the commit is made, so that a rejected commit leaves nothing behind.
+	quarantine, err := repo.NewObjectQuarantine()
+	if err != nil {
+		responseJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		_ = quarantine.Close()
+	}()
+
 	// Parse NDJSON body
-	scanner := bufio.NewScanner(r.Body)
-	scanner.Buffer(make([]byte, 1024*1024), 100*1024*1024) // Allow up to 100MB lines
+	reader := newCommitStreamReader(r.Body)
 
 	var header commitHeader
 	var ops []repository.CommitOperation
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.TrimSpace(line) == "" {
-			continue
+	// readCard reads the README.md the commit ends with, as written by the last operation on it.
+	// It is nil when the commit does not write it.
+	var readCard func() ([]byte, error)
+	var scanned []scan.FileResult
+	var findings []secrets.Finding
+
+	for {
+		op, err := reader.Next()
+		if err == io.EOF {
+			break
 		}
-
-		var op commitOperation
-		if err := json.Unmarshal([]byte(line), &op); err != nil {
+		if err != nil {
 			responseJSON(w, fmt.Errorf("invalid NDJSON line: %v", err), http.StatusBadRequest)
 			return
 		}
@@ -281,20 +317,83 @@ func (h *Handler) handleCommit(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			content := []byte(file.Content)
+			if op.HasContent {
+				file.Content = op.Content
+			}
+			var content io.ReadSeeker = strings.NewReader(file.Content)
+			size := int64(len(file.Content))
+			var blobContent io.Reader = content
 			if file.Encoding == "base64" {
-				decoded, err := base64.StdEncoding.DecodeString(file.Content)
+				// Decode once to validate the content and learn its size before writing the blob
+				size, err = io.Copy(io.Discard, base64.NewDecoder(base64.StdEncoding, content))
 				if err != nil {
 					responseJSON(w, fmt.Errorf("failed to decode base64 content for %s: %v", file.Path, err), http.StatusBadRequest)
 					return
 				}
-				content = decoded
+				if _, err := content.Seek(0, io.SeekStart); err != nil {
+					responseJSON(w, fmt.Errorf("failed to read content for %s: %v", file.Path, err), http.StatusInternalServerError)
+					return
+				}
+				blobContent = base64.NewDecoder(base64.StdEncoding, content)
+			}
+			blob, err := quarantine.WriteBlob(blobContent, size)
+			if err != nil {
+				responseJSON(w, fmt.Errorf("failed to write blob for %s: %v", file.Path, err), http.StatusInternalServerError)
+				return
+			}
+
+			// The content is decoded again to be scanned, so that it is not held in memory twice
+			rereadContent := func() (io.Reader, error) {
+				if _, err := content.Seek(0, io.SeekStart); err != nil {
+					return nil, err
+				}
+				if file.Encoding == "base64" {
+					return base64.NewDecoder(base64.StdEncoding, content), nil
+				}
+				return content, nil
+			}
+			if file.Path == "README.md" {
+				readCard = func() ([]byte, error) {
+					rd, err := rereadContent()
+					if err != nil {
+						return nil, err
+					}
+					return readCardContent(rd)
+				}
+			}
+
+			if h.blockUnsafeFiles && h.scanner != nil {
+				scanContent, err := rereadContent()
+				if err != nil {
+					responseJSON(w, fmt.Errorf("failed to read content for %s: %v", file.Path, err), http.StatusInternalServerError)
+					return
+				}
+				result, err := h.scanner.Check(r.Context(), file.Path, blob, scanContent)
+				if err != nil {
+					responseJSON(w, fmt.Errorf("failed to scan %s: %v", file.Path, err), http.StatusInternalServerError)
+					return
+				}
+				scanned = append(scanned, scan.FileResult{Path: file.Path, Result: result})
+			}
+
+			if h.secretScanner != nil {
+				scanContent, err := rereadContent()
+				if err != nil {
+					responseJSON(w, fmt.Errorf("failed to read content for %s: %v", file.Path, err), http.StatusInternalServerError)
+					return
+				}
+				found, err := h.secretScanner.File(file.Path, scanContent)
+				if err != nil {
+					responseJSON(w, fmt.Errorf("failed to scan %s for secrets: %v", file.Path, err), http.StatusInternalServerError)
+					return
+				}
+				findings = append(findings, found...)
 			}
 
 			ops = append(ops, repository.CommitOperation{
-				Type:    repository.CommitOperationAdd,
-				Path:    file.Path,
-				Content: content,
+				Type: repository.CommitOperationAdd,
+				Path: file.Path,
+				Blob: blob,
 			})
 
 		case "lfsFile":
@@ -304,6 +403,26 @@ func (h *Handler) handleCommit(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
+			if h.blockUnsafeFiles && h.scanner != nil {
+				// Files are only committed once scanned, so their LFS object must be uploaded first
+				result, err := h.scanner.CheckLFS(r.Context(), lfsFile.Path, lfs.NewPointer(lfsFile.OID, lfsFile.Size))
+				if errors.Is(err, lfs.ErrObjectNotAvailable) {
+					responseJSON(w, fmt.Errorf("%w: the LFS object of %s must be uploaded before it is committed", scan.ErrUnscannedFiles, lfsFile.Path), http.StatusBadRequest)
+					return
+				}
+				if err != nil {
+					responseJSON(w, fmt.Errorf("failed to scan %s: %v", lfsFile.Path, err), http.StatusInternalServerError)
+					return
+				}
+				scanned = append(scanned, scan.FileResult{Path: lfsFile.Path, Result: result})
+			}
+
+			if lfsFile.Path == "README.md" {
+				readCard = func() ([]byte, error) {
+					return h.readLFSCard(r.Context(), lfsFile.OID)
+				}
+			}
+
 			// Create an LFS pointer content
 			pointerContent := fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", lfsFile.OID, lfsFile.Size)
 			ops = append(ops, repository.CommitOperation{
@@ -319,18 +438,88 @@ func (h *Handler) handleCommit(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
+			if deleted.Path == "README.md" {
+				readCard = nil
+			}
 			ops = append(ops, repository.CommitOperation{
 				Type: repository.CommitOperationDelete,
 				Path: deleted.Path,
 			})
+
+		case "deletedFolder":
+			var deleted commitDeletedFile
+			if err := json.Unmarshal(op.Value, &deleted); err != nil {
+				responseJSON(w, fmt.Errorf("invalid delete operation: %v", err), http.StatusBadRequest)
+				return
+			}
+
+			if folder := strings.Trim(deleted.Path, "/"); folder == "" || folder == "." {
+				readCard = nil
+			}
+			ops = append(ops, repository.CommitOperation{
+				Type: repository.CommitOperationDeleteFolder,
+				Path: deleted.Path,
+			})
+
+		case "copyFile":
+			var copied commitCopyFile
+			if err := json.Unmarshal(op.Value, &copied); err != nil {
+				responseJSON(w, fmt.Errorf("invalid copy operation: %v", err), http.StatusBadRequest)
+				return
+			}
+			if copied.SrcPath == "" || copied.Path == "" {
+				responseJSON(w, "copy operation requires srcPath and path", http.StatusBadRequest)
+				return
+			}
+
+			if copied.Path == "README.md" {
+				readCard = func() ([]byte, error) {
+					return h.readCopiedCard(r.Context(), repo, cmp.Or(copied.SrcRevision, rev), copied.SrcPath)
+				}
+			}
+			ops = append(ops, repository.CommitOperation{
+				Type:        repository.CommitOperationCopy,
+				Path:        copied.Path,
+				SrcPath:     copied.SrcPath,
+				SrcRevision: copied.SrcRevision,
+			})
+
+		default:
+			responseJSON(w, fmt.Errorf("unknown commit operation %q", op.Key), http.StatusBadRequest)
+			return
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		responseJSON(w, fmt.Errorf("failed to read request body: %v", err), http.StatusBadRequest)
+	if h.validateCards && readCard != nil {
+		card, err := readCard()
+		if err != nil {
+			if errors.Is(err, errCardTooLarge) || errors.Is(err, lfs.ErrObjectNotAvailable) {
+				responseJSON(w, fmt.Errorf("failed to validate README.md: %v", err), http.StatusBadRequest)
+				return
+			}
+			responseJSON(w, fmt.Errorf("failed to read README.md: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if card != nil {
+			if err := hf.ValidateCard(card, hf.RepoTypeOf(ri.RepoName)).Err(); err != nil {
+				responseJSON(w, err, http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	if err := scan.UnsafeFilesError(scanned); err != nil {
+		responseJSON(w, err, http.StatusBadRequest)
 		return
 	}
 
+	if h.secretScanner != nil {
+		if err := h.secretScanner.Report(r.Context(), ri.RepoName, "refs/heads/"+rev, findings); err != nil {
+			responseJSON(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
 	message := header.Summary
 	if message == "" {
 		message = "Upload files"
@@ -339,17 +528,6 @@ func (h *Handler) handleCommit(w http.ResponseWriter, r *http.Request) {
 		message += "\n\n" + header.Description
 	}
 
-	// Open the repository
-	repo, err := repository.Open(repoPath)
-	if err != nil {
-		if errors.Is(err, repository.ErrRepositoryNotExists) {
-			responseJSON(w, fmt.Errorf("repository %q not found", ri.RepoName), http.StatusNotFound)
-			return
-		}
-		responseJSON(w, fmt.Errorf("failed to open repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
-		return
-	}
-
 	// Mock pre-receive hook with current branch head as OldRev
 	if h.preReceiveHookFunc != nil {
 		oldRev := header.ParentCommit
@@ -359,7 +537,9 @@ func (h *Handler) handleCommit(w http.ResponseWriter, r *http.Request) {
 				oldRev = receive.ZeroHash
 			}
 		}
-		if ok, err := h.preReceiveHookFunc(r.Context(), ri.RepoName, []receive.RefUpdate{
+		ctx, endPush := receive.WithPush(r.Context())
+		defer endPush()
+		if ok, err := h.preReceiveHookFunc(ctx, ri.RepoName, []receive.RefUpdate{
 			receive.NewRefUpdate(oldRev, receive.ZeroHash, "refs/heads/"+rev, ri.RepoName),
 		}); err != nil {
 			responseJSON(w, err.Error(), http.StatusInternalServerError)
@@ -370,8 +550,13 @@ func (h *Handler) handleCommit(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	commitHash, err := repo.CreateCommit(r.Context(), rev, message, user.User, user.Email, ops, header.ParentCommit)
+	opts := append(h.commitOptions(), repository.WithObjectQuarantine(quarantine))
+	commitHash, err := repo.CreateCommit(r.Context(), rev, message, user.User, user.Email, ops, header.ParentCommit, opts...)
 	if err != nil {
+		if errors.Is(err, repository.ErrCopySourceNotFound) {
+			responseJSON(w, err.Error(), http.StatusNotFound)
+			return
+		}
 		responseJSON(w, fmt.Errorf("failed to create commit in repository %q: %v", ri.RepoName, err), http.StatusInternalServerError)
 		return
 	}
@@ -395,3 +580,47 @@ func (h *Handler) handleCommit(w http.ResponseWriter, r *http.Request) {
 	}
 	responseJSON(w, resp, http.StatusOK)
 }
+
+// readCardContent reads a card, up to maxCardSize bytes.
+func readCardContent(rd io.Reader) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(rd, maxCardSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxCardSize {
+		return nil, errCardTooLarge
+	}
+	return content, nil
+}
+
+// readLFSCard reads a card stored as an LFS object, which must be uploaded before the commit.
+func (h *Handler) readLFSCard(ctx context.Context, oid string) ([]byte, error) {
+	rc, err := lfs.OpenHead(ctx, h.lfsStorage, h.lfsTeeCache, oid, maxCardSize+1)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+	return readCardContent(rc)
+}
+
+// readCopiedCard reads the file a card is copied from. It returns nil when the source does not exist,
+// which fails the commit.
+func (h *Handler) readCopiedCard(ctx context.Context, repo *repository.Repository, rev string, path string) ([]byte, error) {
+	blob, err := repo.Blob(rev, path)
+	if err != nil {
+		return nil, nil
+	}
+	if ptr, err := blob.LFSPointer(); err == nil && ptr != nil {
+		return h.readLFSCard(ctx, ptr.OID())
+	}
+	rc, err := blob.NewReader()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+	return readCardContent(rc)
+}
@@ -1,6 +1,7 @@
 package hf
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -11,6 +12,7 @@ import (
 
 	backendhttp "github.com/matrixhub-ai/hfd/pkg/backend/http"
 	backendlfs "github.com/matrixhub-ai/hfd/pkg/backend/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/hf"
 	"github.com/matrixhub-ai/hfd/pkg/storage"
 )
 
@@ -657,6 +659,70 @@ func TestHuggingFaceCommitDeleteFile(t *testing.T) {
 	}
 }
 
+func TestHuggingFaceCommitCopyFile(t *testing.T) {
+	server, _ := setupTestServer(t)
+	endpoint := server.URL
+
+	createBody := `{"type":"model","name":"copy-model","organization":"test-user"}`
+	resp, err := http.Post(endpoint+"/api/repos/create", "application/json", strings.NewReader(createBody))
+	if err != nil {
+		t.Fatalf("Failed to create repo: %v", err)
+	}
+	resp.Body.Close()
+
+	commit := func(ndjson string) int {
+		t.Helper()
+		resp, err := http.Post(endpoint+"/api/models/test-user/copy-model/commit/main", "application/x-ndjson", strings.NewReader(ndjson))
+		if err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	resolve := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(endpoint + "/test-user/copy-model/resolve/main/" + path)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		content, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(content)
+	}
+
+	status := commit("{\"key\":\"header\",\"value\":{\"summary\":\"Add files\"}}\n" +
+		"{\"key\":\"file\",\"value\":{\"content\":\"weights\",\"path\":\"checkpoints/step-1/model.bin\",\"encoding\":\"utf-8\"}}\n" +
+		"{\"key\":\"file\",\"value\":{\"content\":\"config\",\"path\":\"checkpoints/step-1/config.json\",\"encoding\":\"utf-8\"}}\n")
+	if status != http.StatusOK {
+		t.Fatalf("Expected 200 for first commit, got %d", status)
+	}
+
+	// Promote the checkpoint to the root and drop the checkpoints folder
+	status = commit("{\"key\":\"header\",\"value\":{\"summary\":\"Promote checkpoint\"}}\n" +
+		"{\"key\":\"copyFile\",\"value\":{\"srcPath\":\"checkpoints/step-1/model.bin\",\"path\":\"model.bin\"}}\n" +
+		"{\"key\":\"copyFile\",\"value\":{\"srcPath\":\"checkpoints/step-1/config.json\",\"srcRevision\":\"main\",\"path\":\"config.json\"}}\n" +
+		"{\"key\":\"deletedFolder\",\"value\":{\"path\":\"checkpoints/\"}}\n")
+	if status != http.StatusOK {
+		t.Fatalf("Expected 200 for copy commit, got %d", status)
+	}
+	if status, content := resolve("model.bin"); status != http.StatusOK || content != "weights" {
+		t.Errorf("Expected the copied file, got %d: %q", status, content)
+	}
+	if status, content := resolve("config.json"); status != http.StatusOK || content != "config" {
+		t.Errorf("Expected the copied file, got %d: %q", status, content)
+	}
+	if status, _ := resolve("checkpoints/step-1/model.bin"); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for a file of the deleted folder, got %d", status)
+	}
+
+	if status := commit("{\"key\":\"copyFile\",\"value\":{\"srcPath\":\"missing.bin\",\"path\":\"copy.bin\"}}\n"); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing copy source, got %d", status)
+	}
+	if status := commit("{\"key\":\"renameFile\",\"value\":{\"path\":\"model.bin\"}}\n"); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown operation, got %d", status)
+	}
+}
+
 func TestHuggingFacePreuploadWithGitAttributes(t *testing.T) {
 	server, _ := setupTestServer(t)
 	endpoint := server.URL
@@ -814,3 +880,102 @@ func TestHuggingFaceTreeSizeNotFound(t *testing.T) {
 		t.Errorf("Expected 404 for nonexistent repo, got %d", resp.StatusCode)
 	}
 }
+
+func TestHuggingFaceValidateYAML(t *testing.T) {
+	server, _ := setupTestServer(t)
+	endpoint := server.URL
+
+	validate := func(content string, repoType string) (int, hf.Validation) {
+		t.Helper()
+		body, _ := json.Marshal(validateYAMLRequest{Content: content, RepoType: repoType})
+		resp, err := http.Post(endpoint+"/api/validate-yaml", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to validate: %v", err)
+		}
+		defer resp.Body.Close()
+		var v hf.Validation
+		if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+			t.Fatalf("Failed to decode validation: %v", err)
+		}
+		return resp.StatusCode, v
+	}
+
+	status, v := validate("---\nlicense: mit\ntags:\n- test\n---\n# Model\n", "model")
+	if status != http.StatusOK || len(v.Errors) != 0 || len(v.Warnings) != 0 {
+		t.Errorf("Expected a valid card, got %d %+v", status, v)
+	}
+
+	status, v = validate("---\nlicense: not-a-license\n---\n# Model\n", "model")
+	if status != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for an invalid card, got %d", status)
+	}
+	if len(v.Errors) != 1 || v.Errors[0].Line != 2 || !strings.Contains(v.Errors[0].Message, "not-a-license") {
+		t.Errorf("Unexpected errors %+v", v.Errors)
+	}
+
+	status, v = validate("---\nconfigs:\n- data_files: train.csv\n---\n", "dataset")
+	if status != http.StatusBadRequest || len(v.Errors) != 1 || !strings.Contains(v.Errors[0].Message, "config_name is required") {
+		t.Errorf("Expected the configs of a dataset card to be validated, got %d %+v", status, v)
+	}
+}
+
+func TestHuggingFaceCommitCardValidation(t *testing.T) {
+	dataDir := t.TempDir()
+	store := storage.NewStorage(storage.WithRootDir(dataDir))
+	server := httptest.NewServer(NewHandler(WithStorage(store), WithCardValidation(true)))
+	t.Cleanup(server.Close)
+	endpoint := server.URL
+
+	createRepoAndCommit(t, endpoint, "model", "test-user", "card-model")
+
+	commitReadme := func(readme string) *http.Response {
+		t.Helper()
+		content, _ := json.Marshal(readme)
+		ndjson := "{\"key\":\"header\",\"value\":{\"summary\":\"Update card\"}}\n" +
+			"{\"key\":\"file\",\"value\":{\"content\":" + string(content) + ",\"path\":\"README.md\",\"encoding\":\"utf-8\"}}\n"
+		resp, err := http.Post(endpoint+"/api/models/test-user/card-model/commit/main", "application/x-ndjson", strings.NewReader(ndjson))
+		if err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+		return resp
+	}
+
+	resp := commitReadme("---\nlicense: [mit\n---\n# Model\n")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), "invalid card metadata") {
+		t.Fatalf("Expected an invalid card to be rejected, got %d: %s", resp.StatusCode, body)
+	}
+
+	resp = commitReadme("---\nlicense: mit\n---\n# Model\n")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected a valid card to be committed, got %d", resp.StatusCode)
+	}
+
+	// The card the commit ends with is validated, whatever the operation writing it
+	commit := func(ops string) (int, string) {
+		t.Helper()
+		ndjson := "{\"key\":\"header\",\"value\":{\"summary\":\"Update card\"}}\n" + ops
+		resp, err := http.Post(endpoint+"/api/models/test-user/card-model/commit/main", "application/x-ndjson", strings.NewReader(ndjson))
+		if err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	if status, _ := commit("{\"key\":\"file\",\"value\":{\"content\":\"---\\nlicense: [mit\\n---\\n\",\"path\":\"draft.md\",\"encoding\":\"utf-8\"}}\n"); status != http.StatusOK {
+		t.Fatalf("Expected a file other than the card to be committed, got %d", status)
+	}
+	if status, body := commit("{\"key\":\"copyFile\",\"value\":{\"srcPath\":\"draft.md\",\"path\":\"README.md\"}}\n"); status != http.StatusBadRequest || !strings.Contains(body, "invalid card metadata") {
+		t.Errorf("Expected an invalid card copied from another file to be rejected, got %d: %s", status, body)
+	}
+	if status, body := commit("{\"key\":\"lfsFile\",\"value\":{\"path\":\"README.md\",\"algo\":\"sha256\",\"oid\":\"" + strings.Repeat("ab", 32) + "\",\"size\":42}}\n"); status != http.StatusBadRequest {
+		t.Errorf("Expected a card stored in a missing LFS object to be rejected, got %d: %s", status, body)
+	}
+	if status, body := commit("{\"key\":\"file\",\"value\":{\"content\":\"---\\nlicense: [mit\\n---\\n\",\"path\":\"README.md\",\"encoding\":\"utf-8\"}}\n" +
+		"{\"key\":\"deletedFile\",\"value\":{\"path\":\"README.md\"}}\n"); status != http.StatusOK {
+		t.Errorf("Expected a card deleted by the commit not to be validated, got %d: %s", status, body)
+	}
+}
@@ -1,9 +1,11 @@
 package hf
 
 import (
-	"encoding/json"
-
+	"github.com/matrixhub-ai/hfd/pkg/gguf"
+	"github.com/matrixhub-ai/hfd/pkg/hf"
 	"github.com/matrixhub-ai/hfd/pkg/repository"
+	"github.com/matrixhub-ai/hfd/pkg/safetensors"
+	"github.com/matrixhub-ai/hfd/pkg/scan"
 )
 
 // whoamiResponse represents the response for the /api/whoami-v2 endpoint.
@@ -40,6 +42,8 @@ type treeEntry struct {
 	Size       int64                `json:"size"`
 	LFS        *lfsPointer          `json:"lfs,omitempty"`
 	LastCommit *treeLastCommit      `json:"lastCommit,omitempty"`
+	// SecurityFileStatus is the result of the scan of a file, told for expanded entries.
+	SecurityFileStatus *scan.Result `json:"securityFileStatus,omitempty"`
 }
 
 // lfsPointer is the API response type for an LFS pointer, with JSON annotations.
@@ -56,6 +60,20 @@ type treeLastCommit struct {
 	Date  string `json:"date"`
 }
 
+// scanStatus represents the response for the Get security status API.
+type scanStatus struct {
+	ScansDone       bool            `json:"scansDone"`
+	HasUnsafeFile   bool            `json:"hasUnsafeFile"`
+	FilesWithIssues []scanFileIssue `json:"filesWithIssues"`
+}
+
+// scanFileIssue is a file whose scan found issues, in the Get security status response.
+type scanFileIssue struct {
+	Path   string      `json:"path"`
+	Level  scan.Status `json:"level"`
+	Issues []string    `json:"issues,omitempty"`
+}
+
 // treeSize represents the response for the Get folder size API.
 type treeSize struct {
 	Path string `json:"path"`
@@ -91,6 +109,23 @@ type repoInfo struct {
 	CreatedAt    string    `json:"createdAt,omitempty"`
 	LastModified string    `json:"lastModified,omitempty"`
 	UsedStorage  int64     `json:"usedStorage"`
+	PipelineTag  string    `json:"pipeline_tag,omitempty"`
+	LibraryName  string    `json:"library_name,omitempty"`
+	// Safetensors is the parameter count of the safetensors weights of a model.
+	Safetensors *safetensors.Info `json:"safetensors,omitempty"`
+	// GGUF describes the GGUF model of a repository.
+	GGUF *gguf.Info `json:"gguf,omitempty"`
+	// Config summarizes the configuration files of a model.
+	Config *hf.RepoConfig `json:"config,omitempty"`
+	// TransformersInfo tells how a transformers model is loaded.
+	TransformersInfo *hf.TransformersInfo `json:"transformersInfo,omitempty"`
+}
+
+// datasetConfigsResponse represents the response for the dataset configs API.
+type datasetConfigsResponse struct {
+	ID      string                 `json:"id"`
+	SHA     string                 `json:"sha"`
+	Configs []hf.DatasetConfigInfo `json:"configs"`
 }
 
 // sibling represents a file in the model repository
@@ -98,6 +133,12 @@ type sibling struct {
 	RFilename string `json:"rfilename"`
 }
 
+// validateYAMLRequest represents the validate-yaml request body.
+type validateYAMLRequest struct {
+	Content  string `json:"content"`
+	RepoType string `json:"repoType"`
+}
+
 // deleteRepoRequest represents the delete repo request body.
 type deleteRepoRequest struct {
 	Type         string `json:"type"`
@@ -150,11 +191,21 @@ type commitAuthor struct {
 
 // commitInfo represents a single commit in the list commits response.
 type commitInfo struct {
-	ID      string         `json:"id"`
-	Title   string         `json:"title"`
-	Message string         `json:"message"`
-	Authors []commitAuthor `json:"authors"`
-	Date    string         `json:"date"`
+	ID           string             `json:"id"`
+	Title        string             `json:"title"`
+	Message      string             `json:"message"`
+	Authors      []commitAuthor     `json:"authors"`
+	Date         string             `json:"date"`
+	Verification commitVerification `json:"verification"`
+}
+
+// commitVerification reports the signature status of a commit.
+type commitVerification struct {
+	Verified    bool   `json:"verified"`
+	Reason      string `json:"reason"`
+	Format      string `json:"format,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Signer      string `json:"signer,omitempty"`
 }
 
 // superSquashRequest represents the super-squash request body.
@@ -206,12 +257,6 @@ type commitResponse struct {
 	CommitMessage string `json:"commitMessage"`
 }
 
-// commitOperation represents a single operation in the NDJSON commit request.
-type commitOperation struct {
-	Key   string          `json:"key"`
-	Value json.RawMessage `json:"value"`
-}
-
 // commitHeader represents the header operation in the commit request.
 type commitHeader struct {
 	Summary      string `json:"summary"`
@@ -234,7 +279,19 @@ type commitLFSFile struct {
 	Size int64  `json:"size"`
 }
 
-// commitDeletedFile represents a delete file operation in the commit request.
+// commitDeletedFile represents a delete file or folder operation in the commit request.
 type commitDeletedFile struct {
 	Path string `json:"path"`
 }
+
+// commitCopyFile represents a copy operation in the commit request.
+type commitCopyFile struct {
+	SrcPath     string `json:"srcPath"`
+	SrcRevision string `json:"srcRevision"`
+	Path        string `json:"path"`
+}
+
+// notebookURL represents the response for the Get notebook URL API.
+type notebookURL struct {
+	URL string `json:"url"`
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/gorilla/mux"
 
 	"github.com/matrixhub-ai/hfd/pkg/mirror"
+	"github.com/matrixhub-ai/hfd/pkg/packcache"
 	"github.com/matrixhub-ai/hfd/pkg/permission"
 	"github.com/matrixhub-ai/hfd/pkg/receive"
 	"github.com/matrixhub-ai/hfd/pkg/storage"
@@ -20,7 +21,10 @@ type Handler struct {
 	permissionHookFunc  permission.PermissionHookFunc
 	preReceiveHookFunc  receive.PreReceiveHookFunc
 	postReceiveHookFunc receive.PostReceiveHookFunc
+	quarantineHookFunc  receive.QuarantineHookFunc
 	mirror              *mirror.Mirror
+	nativeGit           bool
+	packCache           *packcache.Cache
 }
 
 // Option defines a functional option for configuring the Handler.
@@ -55,6 +59,14 @@ func WithPreReceiveHookFunc(fn receive.PreReceiveHookFunc) Option {
 	}
 }
 
+// WithQuarantineHookFunc sets the hook called with the objects of a git push before they are stored.
+// If the hook returns an error, the push is rejected.
+func WithQuarantineHookFunc(fn receive.QuarantineHookFunc) Option {
+	return func(h *Handler) {
+		h.quarantineHookFunc = fn
+	}
+}
+
 // WithPostReceiveHookFunc sets the post-receive hook called after a git push is processed.
 // Errors from this hook are logged but do not affect the push result.
 func WithPostReceiveHookFunc(fn receive.PostReceiveHookFunc) Option {
@@ -71,6 +83,22 @@ func WithMirror(m *mirror.Mirror) Option {
 	}
 }
 
+// WithNativeGit serves git-upload-pack and git-receive-pack in-process instead of spawning the git binaries.
+// Protocol v2, shallow and filtered fetches, and fetches of partial clone mirrors are still served by the binaries,
+// as are the quarantine hooks checking pushed objects.
+func WithNativeGit(native bool) Option {
+	return func(h *Handler) {
+		h.nativeGit = native
+	}
+}
+
+// WithPackCache sets the cache answering identical upload-pack requests with a stored response.
+func WithPackCache(c *packcache.Cache) Option {
+	return func(h *Handler) {
+		h.packCache = c
+	}
+}
+
 // NewHandler creates a new Handler with the given repository directory.
 func NewHandler(opts ...Option) *Handler {
 	h := &Handler{
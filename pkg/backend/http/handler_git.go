@@ -1,15 +1,19 @@
 package backend
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
 
+	"github.com/matrixhub-ai/hfd/pkg/mirror"
+	"github.com/matrixhub-ai/hfd/pkg/packcache"
 	"github.com/matrixhub-ai/hfd/pkg/permission"
 	"github.com/matrixhub-ai/hfd/pkg/receive"
 	"github.com/matrixhub-ai/hfd/pkg/repository"
@@ -80,6 +84,10 @@ func (h *Handler) handleInfoRefs(w http.ResponseWriter, r *http.Request) {
 			responseText(w, fmt.Sprintf("repository %q not found", repoName), http.StatusNotFound)
 			return
 		}
+		if errors.Is(err, mirror.ErrUpstreamUnavailable) {
+			responseText(w, fmt.Sprintf("repository %q is not available: %v", repoName, err), http.StatusServiceUnavailable)
+			return
+		}
 		responseText(w, fmt.Sprintf("Failed to open repository %q: %v", repoName, err), http.StatusInternalServerError)
 		return
 	}
@@ -87,7 +95,7 @@ func (h *Handler) handleInfoRefs(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", fmt.Sprintf("application/x-%s-advertisement", service))
 	w.Header().Set("Cache-Control", "no-cache")
 
-	err = repo.Stateless(r.Context(), w, nil, service, true, gitProtocolEnv(r)...)
+	err = h.stateless(r.Context(), repo, w, nil, service, true, gitProtocolEnv(r))
 	if err != nil {
 		responseText(w, fmt.Sprintf("Failed to get info refs for %q: %v", repoName, err), http.StatusInternalServerError)
 		return
@@ -151,7 +159,9 @@ func (h *Handler) handleService(w http.ResponseWriter, r *http.Request, service
 
 	// Pre-receive hook — can reject the push before git-receive-pack processes it.
 	if service == repository.GitReceivePack && h.preReceiveHookFunc != nil && len(updates) > 0 {
-		if ok, err := h.preReceiveHookFunc(r.Context(), repoName, updates); err != nil {
+		ctx, endPush := receive.WithPush(r.Context())
+		defer endPush()
+		if ok, err := h.preReceiveHookFunc(ctx, repoName, updates); err != nil {
 			responseText(w, err.Error(), http.StatusInternalServerError)
 			return
 		} else if !ok {
@@ -160,20 +170,60 @@ func (h *Handler) handleService(w http.ResponseWriter, r *http.Request, service
 		}
 	}
 
+	// Quarantine hook — checks the pushed objects before git-receive-pack stores them.
+	// The messages of the hook are shown to the client through the side-band.
+	var progress []byte
+	if service == repository.GitReceivePack && h.quarantineHookFunc != nil && len(updates) > 0 {
+		q, err := receive.NewQuarantine(r.Context(), repoPath, input, updates)
+		if err != nil {
+			responseText(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer q.Close()
+		ctx, messages := receive.WithMessages(r.Context())
+		if err := h.quarantineHookFunc(ctx, repoName, q, updates); err != nil {
+			// Clients only show the reason of a rejection reported as the result of the push
+			if report := receive.RejectionReport(q.Capabilities(), updates, messages.Lines(), err.Error()); report != nil {
+				w.Header().Set("Content-Type", fmt.Sprintf("application/x-%s-result", service))
+				w.Header().Set("Cache-Control", "no-cache")
+				_, _ = w.Write(report)
+				return
+			}
+			responseText(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		progress = receive.SideBandMessages(q.Capabilities(), messages.Lines())
+		if input, err = q.Reader(); err != nil {
+			responseText(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	repo, err := h.openRepo(r.Context(), repoPath, repoName, service)
 	if err != nil {
 		if errors.Is(err, repository.ErrRepositoryNotExists) {
 			responseText(w, fmt.Sprintf("repository %q not found", repoName), http.StatusNotFound)
 			return
 		}
+		if errors.Is(err, mirror.ErrUpstreamUnavailable) {
+			responseText(w, fmt.Sprintf("repository %q is not available: %v", repoName, err), http.StatusServiceUnavailable)
+			return
+		}
 		responseText(w, fmt.Sprintf("Failed to open repository %q: %v", repoName, err), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", fmt.Sprintf("application/x-%s-result", service))
 	w.Header().Set("Cache-Control", "no-cache")
+	if len(progress) > 0 {
+		_, _ = w.Write(progress)
+	}
 
-	err = repo.Stateless(r.Context(), w, input, service, false, gitProtocolEnv(r)...)
+	if service == repository.GitUploadPack && h.packCache != nil {
+		err = h.cachedUploadPack(r, repo, repoName, w, input)
+	} else {
+		err = h.stateless(r.Context(), repo, w, input, service, false, gitProtocolEnv(r))
+	}
 	if err != nil {
 		responseText(w, fmt.Sprintf("Failed to get info refs for %q: %v", repoName, err), http.StatusInternalServerError)
 		return
@@ -186,6 +236,37 @@ func (h *Handler) handleService(w http.ResponseWriter, r *http.Request, service
 	}
 }
 
+// stateless runs the git service for the request, in-process or with the git binaries.
+// Requests the in-process implementation does not support are served by the git binaries.
+func (h *Handler) stateless(ctx context.Context, repo *repository.Repository, w io.Writer, input io.Reader, service string, advertise bool, protocolEnv []string) error {
+	if h.nativeGit && repo.NativeSupported(service, protocolEnv) {
+		return repo.NativeStateless(ctx, w, input, service, advertise, protocolEnv...)
+	}
+	return repo.Stateless(ctx, w, input, service, advertise, protocolEnv...)
+}
+
+// cachedUploadPack serves an upload-pack request through the pack cache.
+// Requests too large to be repeated by other clients bypass the cache.
+func (h *Handler) cachedUploadPack(r *http.Request, repo *repository.Repository, repoName string, w io.Writer, input io.Reader) error {
+	protocolEnv := gitProtocolEnv(r)
+	body, err := io.ReadAll(io.LimitReader(input, packcache.MaxRequestSize+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > packcache.MaxRequestSize {
+		return h.stateless(r.Context(), repo, w, io.MultiReader(bytes.NewReader(body), input), repository.GitUploadPack, false, protocolEnv)
+	}
+
+	refs, err := repo.Refs()
+	if err != nil {
+		return err
+	}
+	key := packcache.Key(repoName, refs, repo.DefaultBranch(), strings.Join(protocolEnv, " "), body)
+	return h.packCache.Serve(r.Context(), w, repoName, key, func(ctx context.Context, w io.Writer) error {
+		return h.stateless(ctx, repo, w, bytes.NewReader(body), repository.GitUploadPack, false, protocolEnv)
+	})
+}
+
 func (h *Handler) openRepo(ctx context.Context, repoPath, repoName, service string) (*repository.Repository, error) {
 	if h.mirror == nil || service != repository.GitUploadPack {
 		return repository.Open(repoPath)
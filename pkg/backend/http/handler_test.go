@@ -2,9 +2,11 @@ package backend_test
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -12,6 +14,7 @@ import (
 	"github.com/matrixhub-ai/hfd/internal/utils"
 	backendhttp "github.com/matrixhub-ai/hfd/pkg/backend/http"
 	"github.com/matrixhub-ai/hfd/pkg/permission"
+	"github.com/matrixhub-ai/hfd/pkg/receive"
 	"github.com/matrixhub-ai/hfd/pkg/storage"
 )
 
@@ -242,3 +245,73 @@ func TestHTTPHandlerAuthHook(t *testing.T) {
 		}
 	})
 }
+
+func TestHTTPHandlerQuarantineHook(t *testing.T) {
+	upstreamDir := t.TempDir()
+	clientDir := t.TempDir()
+
+	upstreamStorage := storage.NewStorage(storage.WithRootDir(upstreamDir))
+	repoName := "test-repo"
+	repoPath := filepath.Join(upstreamStorage.RepositoriesDir(), repoName+".git")
+	if err := os.MkdirAll(filepath.Dir(repoPath), 0755); err != nil {
+		t.Fatalf("Failed to create repos dir: %v", err)
+	}
+	runGitCmd(t, "", "init", "--bare", repoPath)
+
+	// Reject the pushes bringing work in progress commits
+	handler := backendhttp.NewHandler(
+		backendhttp.WithStorage(upstreamStorage),
+		backendhttp.WithQuarantineHookFunc(func(ctx context.Context, repo string, q *receive.Quarantine, updates []receive.RefUpdate) error {
+			for _, u := range updates {
+				commits, err := q.NewCommits(ctx, u.NewRev())
+				if err != nil {
+					return err
+				}
+				receive.SendMessage(ctx, "checking %d new commits", len(commits))
+				err = q.ReadObjects(ctx, commits, func(hash string, objectType string, content []byte) error {
+					if strings.Contains(string(content), "WIP") {
+						return fmt.Errorf("commit %s is a work in progress", hash)
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	workDir := filepath.Join(clientDir, "work")
+	runGitCmd(t, "", "clone", server.URL+"/"+repoName+".git", workDir)
+	runGitCmd(t, workDir, "config", "user.email", "test@test.com")
+	runGitCmd(t, workDir, "config", "user.name", "Test User")
+	runGitCmd(t, workDir, "commit", "--allow-empty", "-m", "WIP")
+	wip := strings.TrimSpace(runGitCmd(t, workDir, "rev-parse", "HEAD"))
+
+	push := exec.CommandContext(t.Context(), "git", "push", "origin", "HEAD:refs/heads/main")
+	push.Dir = workDir
+	if out, err := push.CombinedOutput(); err == nil {
+		t.Fatalf("Expected the push to be rejected, got: %s", out)
+	} else if !strings.Contains(string(out), "remote: checking 1 new commits") || !strings.Contains(string(out), "work in progress") {
+		t.Errorf("Expected the messages and the rejection reason to be reported, got: %s", out)
+	}
+	if err := exec.CommandContext(t.Context(), "git", "--git-dir", repoPath, "cat-file", "-e", wip).Run(); err == nil {
+		t.Errorf("Expected the rejected commit not to be stored")
+	}
+
+	runGitCmd(t, workDir, "commit", "--amend", "--allow-empty", "-m", "Initial commit")
+	push = exec.CommandContext(t.Context(), "git", "push", "origin", "HEAD:refs/heads/main")
+	push.Dir = workDir
+	if out, err := push.CombinedOutput(); err != nil {
+		t.Fatalf("Expected the push to be accepted, got %v: %s", err, out)
+	} else if !strings.Contains(string(out), "remote: checking 1 new commits") {
+		t.Errorf("Expected the messages to be reported, got: %s", out)
+	}
+	head := strings.TrimSpace(runGitCmd(t, workDir, "rev-parse", "HEAD"))
+	if got := strings.TrimSpace(runGitCmd(t, "", "--git-dir", repoPath, "rev-parse", "refs/heads/main")); got != head {
+		t.Errorf("Expected main to be %s, got %s", head, got)
+	}
+}
@@ -3,6 +3,7 @@ package lfs
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/matrixhub-ai/hfd/pkg/authenticate"
 	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/mirror"
 	"github.com/matrixhub-ai/hfd/pkg/permission"
 )
 
@@ -49,6 +51,9 @@ func (h *Handler) handleBatch(w http.ResponseWriter, r *http.Request) {
 	// Create a response object
 	for _, object := range bv.Objects {
 		if h.lfsStorage.Exists(object.Oid) {
+			if h.mirror != nil && bv.Operation != "upload" {
+				h.mirror.Touch(object.Oid)
+			}
 			responseObjects = append(responseObjects, h.lfsRepresent(r.Context(), object, true, false))
 			continue
 		}
@@ -69,11 +74,25 @@ func (h *Handler) handleBatch(w http.ResponseWriter, r *http.Request) {
 			lfsObjects[i] = lfs.LFSObject{Oid: obj.Oid, Size: obj.Size}
 		}
 		sourceURL, started, err := h.mirror.StartLFSFetch(r.Context(), repoName, lfsObjects)
-		if err != nil {
+		if err != nil && !errors.Is(err, mirror.ErrUpstreamUnavailable) {
 			responseJSON(w, fmt.Errorf("failed to fetch LFS objects from upstream source %q: %v", sourceURL, err), http.StatusInternalServerError)
 			return
 		}
-		if started {
+		if err != nil {
+			// The objects cached locally are still served, only the missing ones fail
+			slog.WarnContext(r.Context(), "LFS objects are not cached locally and upstream source is unreachable", "repo", repoName, "source", sourceURL, "error", err)
+			for _, obj := range missingObjects {
+				rep := &lfsRepresentation{
+					Oid:  obj.Oid,
+					Size: obj.Size,
+					Error: &lfsObjectError{
+						Code:    http.StatusServiceUnavailable,
+						Message: "Not cached locally and upstream source is unreachable",
+					},
+				}
+				responseObjects = append(responseObjects, rep)
+			}
+		} else if started {
 			for _, obj := range missingObjects {
 				responseObjects = append(responseObjects, h.lfsRepresent(r.Context(), obj, true, false))
 			}
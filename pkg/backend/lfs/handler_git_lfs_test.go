@@ -0,0 +1,68 @@
+package lfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/mirror"
+)
+
+func TestBatchOffline(t *testing.T) {
+	storage := lfs.NewLocal(t.TempDir())
+	content := "cached content"
+	sum := sha256.Sum256([]byte(content))
+	cached := hex.EncodeToString(sum[:])
+	if err := storage.Put(cached, strings.NewReader(content), int64(len(content))); err != nil {
+		t.Fatal(err)
+	}
+	missing := strings.Repeat("0", 64)
+
+	m := mirror.NewMirror(
+		mirror.WithOffline(true),
+		mirror.WithMirrorSourceFunc(func(ctx context.Context, repoName string) (string, bool, error) {
+			return "https://huggingface.co/" + repoName, true, nil
+		}),
+	)
+	server := httptest.NewServer(NewHandler(WithLFSStorage(storage), WithMirror(m)))
+	t.Cleanup(server.Close)
+
+	body := `{"operation":"download","objects":[{"oid":"` + cached + `","size":14},{"oid":"` + missing + `","size":1}]}`
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/user/model.git/info/lfs/objects/batch", strings.NewReader(body))
+	req.Header.Set("Accept", metaMediaType)
+	req.Header.Set("Content-Type", metaMediaType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to post batch: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 for batch, got %d", resp.StatusCode)
+	}
+
+	var result lfsBatchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode batch response: %v", err)
+	}
+	if len(result.Objects) != 2 {
+		t.Fatalf("Expected 2 objects, got %d", len(result.Objects))
+	}
+	for _, obj := range result.Objects {
+		switch obj.Oid {
+		case cached:
+			if obj.Error != nil || obj.Actions["download"] == nil {
+				t.Errorf("Expected the cached object to be downloadable, got %+v", obj)
+			}
+		case missing:
+			if obj.Error == nil || obj.Error.Code != http.StatusServiceUnavailable {
+				t.Errorf("Expected a 503 error for the missing object, got %+v", obj)
+			}
+		}
+	}
+}
@@ -3,6 +3,7 @@ package ssh
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -17,6 +18,7 @@ import (
 	"github.com/matrixhub-ai/hfd/internal/utils"
 	"github.com/matrixhub-ai/hfd/pkg/authenticate"
 	"github.com/matrixhub-ai/hfd/pkg/mirror"
+	"github.com/matrixhub-ai/hfd/pkg/packcache"
 	"github.com/matrixhub-ai/hfd/pkg/permission"
 	"github.com/matrixhub-ai/hfd/pkg/receive"
 	"github.com/matrixhub-ai/hfd/pkg/repository"
@@ -36,9 +38,12 @@ type Server struct {
 	permissionHookFunc  permission.PermissionHookFunc
 	preReceiveHookFunc  receive.PreReceiveHookFunc
 	postReceiveHookFunc receive.PostReceiveHookFunc
+	quarantineHookFunc  receive.QuarantineHookFunc
 	tokenSignValidator  authenticate.TokenSignValidator
 	lfsURL              string
 	mirror              *mirror.Mirror
+	nativeGit           bool
+	packCache           *packcache.Cache
 }
 
 // Option configures the SSH server.
@@ -67,6 +72,14 @@ func WithPreReceiveHookFunc(fn receive.PreReceiveHookFunc) Option {
 	}
 }
 
+// WithQuarantineHookFunc sets the hook called with the objects of a git push before they are stored.
+// If the hook returns an error, the push is rejected.
+func WithQuarantineHookFunc(fn receive.QuarantineHookFunc) Option {
+	return func(s *Server) {
+		s.quarantineHookFunc = fn
+	}
+}
+
 // WithPostReceiveHookFunc sets the post-receive hook called after a git push is processed.
 // Errors from this hook are logged but do not affect the push result.
 func WithPostReceiveHookFunc(fn receive.PostReceiveHookFunc) Option {
@@ -91,6 +104,23 @@ func WithMirror(m *mirror.Mirror) Option {
 	}
 }
 
+// WithNativeGit serves git-upload-pack and git-receive-pack in-process instead of spawning the git binaries.
+// Protocol v2, shallow and filtered fetches, and fetches of partial clone mirrors are still served by the binaries,
+// as are the quarantine hooks checking pushed objects.
+func WithNativeGit(native bool) Option {
+	return func(s *Server) {
+		s.nativeGit = native
+	}
+}
+
+// WithPackCache sets the cache answering identical upload-pack requests with a stored response.
+// Sessions using the cache are served by the git binaries.
+func WithPackCache(c *packcache.Cache) Option {
+	return func(s *Server) {
+		s.packCache = c
+	}
+}
+
 func permissionsExtensions(user string) *ssh.Permissions {
 	return &ssh.Permissions{
 		Extensions: map[string]string{
@@ -359,12 +389,16 @@ func (s *Server) executeCommand(ctx context.Context, channel ssh.Channel, servic
 		}
 	}
 
-	_, err := s.openRepo(ctx, repoPath, repoName, service)
+	repo, err := s.openRepo(ctx, repoPath, repoName, service)
 	if err != nil {
 		if err == repository.ErrRepositoryNotExists {
 			sendExitStatus(channel, 1, "repository not found\n")
 			return
 		}
+		if errors.Is(err, mirror.ErrUpstreamUnavailable) {
+			sendExitStatus(channel, 1, fmt.Sprintf("repository is not available: %v\n", err))
+			return
+		}
 		slog.WarnContext(ctx, "ssh protocol: failed to open repository", "repo", repoName, "error", err)
 		sendExitStatus(channel, 1, "")
 		return
@@ -372,11 +406,32 @@ func (s *Server) executeCommand(ctx context.Context, channel ssh.Channel, servic
 
 	// For receive-pack with permission/receive hooks: use pipe-based approach
 	// to intercept pkt-line commands for permission checking before the push completes.
-	if service == repository.GitReceivePack && (s.preReceiveHookFunc != nil || s.postReceiveHookFunc != nil) {
-		s.executeReceivePackWithHooks(ctx, channel, service, repoName, repoPath, env...)
+	if service == repository.GitReceivePack && (s.preReceiveHookFunc != nil || s.postReceiveHookFunc != nil || s.quarantineHookFunc != nil) {
+		s.executeReceivePackWithHooks(ctx, channel, repo, service, repoName, repoPath, env...)
+		return
+	}
+
+	if service == repository.GitUploadPack && s.packCache != nil {
+		if err := s.cachedUploadPack(ctx, channel, repo, repoName, env); err != nil {
+			slog.ErrorContext(ctx, "ssh protocol: command failed", "service", service, "error", err)
+			sendExitStatus(channel, 1, "")
+			return
+		}
+		sendExitStatus(channel, 0, "")
+		return
+	}
+
+	if s.nativeGit && repo.NativeSupported(service, env) {
+		if err := repo.NativeServe(ctx, channel, channel, service, env...); err != nil {
+			slog.ErrorContext(ctx, "ssh protocol: command failed", "service", service, "error", err)
+			sendExitStatus(channel, 1, "")
+			return
+		}
+		sendExitStatus(channel, 0, "")
 		return
 	}
 
+	env = append(repository.ServiceEnv(service), env...)
 	cmd := utils.Command(ctx, service, ".")
 	cmd.Dir = repoPath
 	cmd.Stdin = channel
@@ -399,20 +454,12 @@ func (s *Server) executeCommand(ctx context.Context, channel ssh.Channel, servic
 // executeReceivePackWithHooks handles git-receive-pack using a pipe to intercept
 // pkt-line ref update commands. This allows the permission hook to inspect and
 // reject pushes before git-receive-pack processes the pack data.
-func (s *Server) executeReceivePackWithHooks(ctx context.Context, channel ssh.Channel, service string, repoPath, fullPath string, env ...string) {
+func (s *Server) executeReceivePackWithHooks(ctx context.Context, channel ssh.Channel, repo *repository.Repository, service string, repoPath, fullPath string, env ...string) {
 	pr, pw := io.Pipe()
 	defer pr.Close()
 
-	cmd := utils.Command(ctx, service, ".")
-	cmd.Dir = fullPath
-	cmd.Stdin = pr
-	cmd.Stdout = channel
-	cmd.Stderr = channel.Stderr()
-	if len(env) > 0 {
-		cmd.Env = append(os.Environ(), env...)
-	}
-
-	if err := cmd.Start(); err != nil {
+	wait, abort, err := s.startService(ctx, channel, repo, service, fullPath, pr, env...)
+	if err != nil {
 		pw.Close()
 		slog.ErrorContext(ctx, "ssh protocol: command start failed", "service", service, "error", err)
 		sendExitStatus(channel, 1, "")
@@ -426,23 +473,59 @@ func (s *Server) executeReceivePackWithHooks(ctx context.Context, channel ssh.Ch
 
 	// Pre-receive hook — can reject the push before pack data is processed.
 	if s.preReceiveHookFunc != nil && len(updates) > 0 {
-		if ok, err := s.preReceiveHookFunc(ctx, repoPath, updates); err != nil {
+		pushCtx, endPush := receive.WithPush(ctx)
+		defer endPush()
+		if ok, err := s.preReceiveHookFunc(pushCtx, repoPath, updates); err != nil {
 			slog.WarnContext(ctx, "ssh protocol: pre-receive hook denied push", "repo", repoPath, "error", err)
-			cmd.Process.Kill()
+			abort()
 			pw.Close()
-			_ = cmd.Wait()
+			_, _ = wait()
 			sendExitStatus(channel, 1, "")
 			return
 		} else if !ok {
 			slog.WarnContext(ctx, "ssh protocol: pre-receive hook denied push", "repo", repoPath)
-			cmd.Process.Kill()
+			abort()
 			pw.Close()
-			_ = cmd.Wait()
+			_, _ = wait()
 			sendExitStatus(channel, 1, "pre-receive denied")
 			return
 		}
 	}
 
+	// Quarantine hook — can reject the push after its objects are received, before they are stored.
+	if s.quarantineHookFunc != nil && len(updates) > 0 {
+		q, err := receive.NewQuarantine(ctx, fullPath, replay, updates)
+		if err != nil {
+			slog.WarnContext(ctx, "ssh protocol: failed to quarantine push", "repo", repoPath, "error", err)
+			abort()
+			pw.Close()
+			_, _ = wait()
+			sendExitStatus(channel, 1, err.Error()+"\n")
+			return
+		}
+		defer q.Close()
+		hookCtx, messages := receive.WithMessages(ctx)
+		err = s.quarantineHookFunc(hookCtx, repoPath, q, updates)
+		for _, line := range messages.Lines() {
+			_, _ = fmt.Fprintln(channel.Stderr(), line)
+		}
+		if err != nil {
+			slog.WarnContext(ctx, "ssh protocol: quarantine hook denied push", "repo", repoPath, "error", err)
+			abort()
+			pw.Close()
+			_, _ = wait()
+			sendExitStatus(channel, 1, err.Error()+"\n")
+			return
+		}
+		if replay, err = q.Reader(); err != nil {
+			abort()
+			pw.Close()
+			_, _ = wait()
+			sendExitStatus(channel, 1, "")
+			return
+		}
+	}
+
 	// Permission granted — forward the buffered pkt-line data and remaining
 	// channel input to git-receive-pack through the pipe.
 	go func() {
@@ -452,7 +535,8 @@ func (s *Server) executeReceivePackWithHooks(ctx context.Context, channel ssh.Ch
 		}
 	}()
 
-	if err := cmd.Wait(); err != nil {
+	exitCode, err := wait()
+	if err != nil {
 		slog.ErrorContext(ctx, "ssh protocol: command failed", "service", service, "error", err)
 		sendExitStatus(channel, 1, "")
 		return
@@ -465,10 +549,51 @@ func (s *Server) executeReceivePackWithHooks(ctx context.Context, channel ssh.Ch
 		}
 	}
 
-	exitCode := cmd.ProcessState.ExitCode()
 	sendExitStatus(channel, uint32(exitCode), "")
 }
 
+// startService starts the git service reading its input from stdin and writing to the channel.
+// It returns a function waiting for the exit code of the service, and a function aborting it.
+func (s *Server) startService(ctx context.Context, channel ssh.Channel, repo *repository.Repository, service string, fullPath string, stdin io.Reader, env ...string) (func() (int, error), func(), error) {
+	if s.nativeGit && repo.NativeSupported(service, env) {
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() {
+			done <- repo.NativeServe(ctx, channel, stdin, service, env...)
+		}()
+		wait := func() (int, error) {
+			defer cancel()
+			if err := <-done; err != nil {
+				return 1, err
+			}
+			return 0, nil
+		}
+		return wait, cancel, nil
+	}
+
+	cmd := utils.Command(ctx, service, ".")
+	cmd.Dir = fullPath
+	cmd.Stdin = stdin
+	cmd.Stdout = channel
+	cmd.Stderr = channel.Stderr()
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+	wait := func() (int, error) {
+		if err := cmd.Wait(); err != nil {
+			return 1, err
+		}
+		return cmd.ProcessState.ExitCode(), nil
+	}
+	abort := func() {
+		_ = cmd.Process.Kill()
+	}
+	return wait, abort, nil
+}
+
 func (s *Server) openRepo(ctx context.Context, repoPath, repoName, service string) (*repository.Repository, error) {
 	if s.mirror == nil || service != repository.GitUploadPack {
 		return repository.Open(repoPath)
@@ -10,6 +10,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -17,6 +18,7 @@ import (
 	"github.com/matrixhub-ai/hfd/internal/utils"
 	"github.com/matrixhub-ai/hfd/pkg/authenticate"
 	backendssh "github.com/matrixhub-ai/hfd/pkg/backend/ssh"
+	"github.com/matrixhub-ai/hfd/pkg/receive"
 	pkgssh "github.com/matrixhub-ai/hfd/pkg/ssh"
 	"github.com/matrixhub-ai/hfd/pkg/storage"
 	"golang.org/x/crypto/ssh"
@@ -171,6 +173,90 @@ func TestSSHProtocolServer(t *testing.T) {
 	})
 }
 
+func TestSSHQuarantineHook(t *testing.T) {
+	storage := storage.NewStorage(storage.WithRootDir(t.TempDir()))
+	repoName := "test-repo.git"
+	repoPath := filepath.Join(storage.RepositoriesDir(), repoName)
+	runGitCmd(t, "", nil, "init", "--bare", repoPath)
+
+	hostKey, err := generateHostKey()
+	if err != nil {
+		t.Fatalf("Failed to generate host key: %v", err)
+	}
+
+	// Reject the pushes bringing work in progress commits
+	server := backendssh.NewServer(
+		backendssh.WithHostKey(hostKey),
+		backendssh.WithStorage(storage),
+		backendssh.WithQuarantineHookFunc(func(ctx context.Context, repo string, q *receive.Quarantine, updates []receive.RefUpdate) error {
+			for _, u := range updates {
+				if u.IsDelete() {
+					continue
+				}
+				commits, err := q.NewCommits(ctx, u.NewRev())
+				if err != nil {
+					return err
+				}
+				receive.SendMessage(ctx, "checking %d new commits", len(commits))
+				err = q.ReadObjects(ctx, commits, func(hash string, objectType string, content []byte) error {
+					if strings.Contains(string(content), "WIP") {
+						return fmt.Errorf("commit %s is a work in progress", hash)
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		_ = server.Serve(t.Context(), listener)
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	sshURL := "ssh://git@" + addr.String() + "/" + repoName
+	sshCmd := "ssh -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null -p " + strings.Split(addr.String(), ":")[1]
+	env := []string{
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_SSH_COMMAND=" + sshCmd,
+	}
+
+	workDir := filepath.Join(t.TempDir(), "work")
+	runGitCmd(t, "", env, "clone", sshURL, workDir)
+	runGitCmd(t, workDir, env, "config", "user.email", "test@test.com")
+	runGitCmd(t, workDir, env, "config", "user.name", "Test User")
+	runGitCmd(t, workDir, env, "commit", "--allow-empty", "-m", "WIP")
+
+	push := exec.CommandContext(t.Context(), "git", "push", "origin", "HEAD:refs/heads/main")
+	push.Dir = workDir
+	push.Env = append(os.Environ(), env...)
+	if out, err := push.CombinedOutput(); err == nil {
+		t.Fatalf("Expected the push to be rejected, got: %s", out)
+	} else if !strings.Contains(string(out), "checking 1 new commits") || !strings.Contains(string(out), "work in progress") {
+		t.Errorf("Expected the messages and the rejection reason to be reported, got: %s", out)
+	}
+
+	runGitCmd(t, workDir, env, "commit", "--amend", "--allow-empty", "-m", "Initial commit")
+	runGitCmd(t, workDir, env, "push", "origin", "HEAD:refs/heads/main", "HEAD:refs/heads/dev")
+	head := strings.TrimSpace(runGitCmd(t, workDir, nil, "rev-parse", "HEAD"))
+	if got := strings.TrimSpace(runGitCmd(t, "", nil, "--git-dir", repoPath, "rev-parse", "refs/heads/main")); got != head {
+		t.Errorf("Expected main to be %s, got %s", head, got)
+	}
+
+	// A push deleting refs only carries no pack
+	runGitCmd(t, workDir, env, "push", "origin", ":refs/heads/dev")
+	if refs := runGitCmd(t, "", nil, "--git-dir", repoPath, "for-each-ref", "refs/heads/dev"); refs != "" {
+		t.Errorf("Expected dev to be deleted, got %s", refs)
+	}
+}
+
 func generateHostKey() (ssh.Signer, error) {
 	_, priv, err := ed25519.GenerateKey(rand.Reader)
 	if err != nil {
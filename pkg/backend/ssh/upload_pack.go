@@ -0,0 +1,144 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/matrixhub-ai/hfd/pkg/packcache"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+)
+
+// cachedUploadPack serves an upload-pack session through the pack cache. The session is split into the
+// stateless requests smart HTTP sends: every protocol v2 request is one, and so is a protocol v0 fetch
+// negotiating nothing, such as a clone. Other protocol v0 sessions negotiate interactively, and are
+// served by git-upload-pack.
+func (s *Server) cachedUploadPack(ctx context.Context, channel io.ReadWriter, repo *repository.Repository, repoName string, env []string) error {
+	service := repository.GitUploadPack
+	if err := repo.Advertise(ctx, channel, service, env...); err != nil {
+		return err
+	}
+
+	if isProtocolV2(env) {
+		for {
+			request, _, err := readSection(channel)
+			if err != nil {
+				if errors.Is(err, io.EOF) && len(request) == 0 {
+					return nil
+				}
+				return err
+			}
+			if string(request) == "0000" {
+				// The client ends the session
+				return nil
+			}
+			if err := s.serveStateless(ctx, channel, repo, repoName, request, env); err != nil {
+				return err
+			}
+		}
+	}
+
+	request, lines, err := readSection(channel)
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(request) == 0 {
+			return nil
+		}
+		return err
+	}
+	if len(lines) == 0 {
+		// The client only listed the refs
+		return nil
+	}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "shallow ") || strings.HasPrefix(line, "deepen") {
+			// The shallow commits are sent before the client goes on
+			return repo.ServeAdvertised(ctx, channel, io.MultiReader(bytes.NewReader(request), channel), service, env...)
+		}
+	}
+	next, payload, err := readPacket(channel)
+	if err != nil {
+		return err
+	}
+	request = append(request, next...)
+	if payload != "done\n" {
+		return repo.ServeAdvertised(ctx, channel, io.MultiReader(bytes.NewReader(request), channel), service, env...)
+	}
+	return s.serveStateless(ctx, channel, repo, repoName, request, env)
+}
+
+// serveStateless answers a stateless upload-pack request through the pack cache.
+func (s *Server) serveStateless(ctx context.Context, w io.Writer, repo *repository.Repository, repoName string, request []byte, env []string) error {
+	service := repository.GitUploadPack
+	if len(request) > packcache.MaxRequestSize {
+		return repo.Stateless(ctx, w, bytes.NewReader(request), service, false, env...)
+	}
+	refs, err := repo.Refs()
+	if err != nil {
+		return err
+	}
+	key := packcache.Key(repoName, refs, repo.DefaultBranch(), strings.Join(env, " "), request)
+	return s.packCache.Serve(ctx, w, repoName, key, func(ctx context.Context, w io.Writer) error {
+		return repo.Stateless(ctx, w, bytes.NewReader(request), service, false, env...)
+	})
+}
+
+// isProtocolV2 reports whether the client asked for protocol v2 through GIT_PROTOCOL.
+func isProtocolV2(env []string) bool {
+	for _, e := range env {
+		if value, ok := strings.CutPrefix(e, "GIT_PROTOCOL="); ok && slices.Contains(strings.Split(value, ":"), "version=2") {
+			return true
+		}
+	}
+	return false
+}
+
+// readSection reads pkt-lines up to and including the next flush-pkt. It returns them as read,
+// along with the payloads of the data lines.
+func readSection(r io.Reader) ([]byte, []string, error) {
+	var raw []byte
+	var lines []string
+	for {
+		pkt, payload, err := readPacket(r)
+		raw = append(raw, pkt...)
+		if err != nil {
+			return raw, lines, err
+		}
+		switch string(pkt) {
+		case "0000":
+			return raw, lines, nil
+		case "0001", "0002":
+			// Delimiter and response end packets of protocol v2
+			continue
+		}
+		lines = append(lines, strings.TrimSuffix(payload, "\n"))
+	}
+}
+
+// readPacket reads a single pkt-line, returning it as read along with its payload.
+func readPacket(r io.Reader) ([]byte, string, error) {
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(r, head); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, "", fmt.Errorf("truncated pkt-line: %w", err)
+		}
+		return nil, "", err
+	}
+	n, err := strconv.ParseUint(string(head), 16, 16)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid pkt-line length %q", head)
+	}
+	if n < 4 {
+		return head, "", nil
+	}
+	pkt := make([]byte, n)
+	copy(pkt, head)
+	if _, err := io.ReadFull(r, pkt[4:]); err != nil {
+		return nil, "", fmt.Errorf("truncated pkt-line: %w", err)
+	}
+	return pkt, string(pkt[4:]), nil
+}
@@ -0,0 +1,525 @@
+package bundle
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/receive"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+)
+
+const (
+	// ManifestFile is the name of the manifest in a bundle archive.
+	ManifestFile = "manifest.json"
+	// GitBundleFile is the name of the git bundle in a bundle archive. It is left out
+	// of incremental archives whose refs did not change.
+	GitBundleFile = "repo.bundle"
+	// lfsPrefix is the directory of the LFS objects in a bundle archive, named by their OID.
+	lfsPrefix = "lfs/"
+
+	manifestVersion = 1
+)
+
+var (
+	// ErrInvalidArchive is returned when importing an archive that is not a valid bundle archive.
+	ErrInvalidArchive = errors.New("invalid bundle archive")
+	// ErrDenied is returned when the pre-receive hook rejects the ref updates of an import.
+	ErrDenied = errors.New("pre-receive hook denied the import")
+	// ErrRejected is returned when the quarantine hook rejects the objects of an import.
+	ErrRejected = errors.New("import rejected")
+	// ErrNonFastForward is returned when an import would rewind a branch or move a tag without being forced.
+	ErrNonFastForward = errors.New("non-fast-forward update")
+	// ErrUnknownRevision is returned when exporting refs or relative to commits that do not exist.
+	// It is returned before anything is written.
+	ErrUnknownRevision = errors.New("unknown revision")
+)
+
+// Manifest describes the content of a bundle archive.
+type Manifest struct {
+	Version       int               `json:"version"`
+	Repo          string            `json:"repo"`
+	DefaultBranch string            `json:"defaultBranch"`
+	Refs          map[string]string `json:"refs"`
+	// Since lists the commits the archive is relative to. Only the objects not reachable from them are included.
+	Since      []string    `json:"since,omitempty"`
+	LFSObjects []LFSObject `json:"lfsObjects,omitempty"`
+	CreatedAt  time.Time   `json:"createdAt"`
+}
+
+// LFSObject is an LFS object included in a bundle archive.
+type LFSObject struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+// ExportOptions provides options for Export.
+type ExportOptions struct {
+	// Refs selects the branches and tags to export, by full ref name or short name.
+	// All branches and tags are exported if empty.
+	Refs []string
+	// Since lists commits the receiving side already has, typically the refs of a previous export.
+	// Their objects, and the LFS objects of their trees, are left out of the archive.
+	Since []string
+	// OpenLFS opens the content of the LFS objects. Without it, LFS objects are left out of the archive.
+	OpenLFS repository.LFSOpenFunc
+}
+
+// Export writes a bundle archive of the repository to w: a tar archive holding the manifest,
+// a git bundle of the selected refs and the LFS objects referenced by their trees.
+func Export(ctx context.Context, w io.Writer, repoName string, repo *repository.Repository, opts ExportOptions) error {
+	refs, err := selectRefs(repo, opts.Refs)
+	if err != nil {
+		return err
+	}
+	for _, commit := range opts.Since {
+		if _, err := repo.ResolveRevision(commit); err != nil {
+			return fmt.Errorf("%w: commit %q", ErrUnknownRevision, commit)
+		}
+	}
+
+	manifest := Manifest{
+		Version:       manifestVersion,
+		Repo:          repoName,
+		DefaultBranch: repo.DefaultBranch(),
+		Refs:          refs,
+		Since:         opts.Since,
+		CreatedAt:     time.Now().UTC(),
+	}
+	if opts.OpenLFS != nil {
+		manifest.LFSObjects, err = lfsObjects(ctx, repo, refs, opts.Since)
+		if err != nil {
+			return err
+		}
+	}
+
+	tmp, err := os.MkdirTemp("", "hfd-bundle-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(tmp)
+	}()
+	bundleFile := filepath.Join(tmp, GitBundleFile)
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	err = repo.CreateBundle(ctx, bundleFile, names, opts.Since)
+	if errors.Is(err, repository.ErrEmptyBundle) {
+		bundleFile = ""
+	} else if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeEntry(tw, ManifestFile, int64(len(data)), strings.NewReader(string(data))); err != nil {
+		return err
+	}
+
+	if bundleFile != "" {
+		f, err := os.Open(bundleFile)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		stat, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if err := writeEntry(tw, GitBundleFile, stat.Size(), f); err != nil {
+			return err
+		}
+	}
+
+	for _, obj := range manifest.LFSObjects {
+		rc, err := opts.OpenLFS(lfs.NewPointer(obj.OID, obj.Size))
+		if err != nil {
+			return fmt.Errorf("failed to open LFS object %q: %w", obj.OID, err)
+		}
+		err = writeEntry(tw, lfsPrefix+obj.OID, obj.Size, rc)
+		_ = rc.Close()
+		if err != nil {
+			return fmt.Errorf("failed to export LFS object %q: %w", obj.OID, err)
+		}
+	}
+	return tw.Close()
+}
+
+// selectRefs returns the exported refs and the commits they point to.
+func selectRefs(repo *repository.Repository, selected []string) (map[string]string, error) {
+	all, err := repo.Refs()
+	if err != nil {
+		return nil, err
+	}
+	refs := map[string]string{}
+	if len(selected) == 0 {
+		for name, hash := range all {
+			if strings.HasPrefix(name, "refs/heads/") || strings.HasPrefix(name, "refs/tags/") {
+				refs[name] = hash
+			}
+		}
+		return refs, nil
+	}
+
+	for _, ref := range selected {
+		found := false
+		for _, name := range []string{ref, "refs/heads/" + ref, "refs/tags/" + ref} {
+			if hash, ok := all[name]; ok && strings.HasPrefix(name, "refs/") {
+				refs[name] = hash
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: ref %q", ErrUnknownRevision, ref)
+		}
+	}
+	return refs, nil
+}
+
+// lfsObjects returns the LFS objects referenced by the trees of the commits reachable from refs and not
+// from the since commits, leaving out the ones the trees of the since commits reference.
+func lfsObjects(ctx context.Context, repo *repository.Repository, refs map[string]string, since []string) ([]LFSObject, error) {
+	known := map[string]bool{}
+	for _, commit := range since {
+		ptrs, err := repo.ScanLFSPointersAt(commit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan LFS pointers of %s: %w", commit, err)
+		}
+		for _, ptr := range ptrs {
+			known[ptr.OID()] = true
+		}
+	}
+
+	var objects []LFSObject
+	for name := range refs {
+		ptrs, err := repo.ScanLFSPointersRange(ctx, name, since)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan LFS pointers of %s: %w", name, err)
+		}
+		for _, ptr := range ptrs {
+			if known[ptr.OID()] {
+				continue
+			}
+			known[ptr.OID()] = true
+			objects = append(objects, LFSObject{OID: ptr.OID(), Size: ptr.Size()})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].OID < objects[j].OID
+	})
+	return objects, nil
+}
+
+func writeEntry(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, r, size)
+	return err
+}
+
+// ImportOptions provides options for Import.
+type ImportOptions struct {
+	// RepoName is the name of the repository passed to the hooks.
+	RepoName string
+	// RepoPath is the path of the repository, which is created if it does not exist.
+	RepoPath string
+	// LFSStorage stores the imported LFS objects.
+	LFSStorage lfs.Storage
+	// PreReceiveHookFunc is called with the ref updates before they are applied, and can reject them.
+	PreReceiveHookFunc receive.PreReceiveHookFunc
+	// QuarantineHookFunc is called with the objects of the git bundle before they are stored, and can reject them.
+	QuarantineHookFunc receive.QuarantineHookFunc
+	// PostReceiveHookFunc is called with the ref updates after they are applied.
+	PostReceiveHookFunc receive.PostReceiveHookFunc
+	// Force allows the import to rewind branches and move tags. Otherwise, such imports fail with ErrNonFastForward.
+	Force bool
+}
+
+// ImportResult reports what an import changed.
+type ImportResult struct {
+	Created    bool              `json:"created"`
+	Refs       map[string]string `json:"refs"`
+	LFSObjects int               `json:"lfsObjects"`
+}
+
+// Import creates or updates a repository from a bundle archive written by Export. The LFS objects
+// are checked against their OIDs and stored first, then the refs of the archive are updated to the
+// commits of its git bundle, running the pre-receive, quarantine and post-receive hooks as a push does.
+// Incremental archives can only be imported into a repository having the commits they are relative to.
+func Import(ctx context.Context, in io.Reader, opts ImportOptions) (*ImportResult, error) {
+	tmp, err := os.MkdirTemp("", "hfd-bundle-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.RemoveAll(tmp)
+	}()
+
+	var manifest *Manifest
+	bundleFile := ""
+	result := &ImportResult{Refs: map[string]string{}}
+	tr := tar.NewReader(in)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+		}
+
+		switch {
+		case hdr.Name == ManifestFile:
+			manifest = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, fmt.Errorf("%w: invalid manifest: %w", ErrInvalidArchive, err)
+			}
+			if manifest.Version != manifestVersion {
+				return nil, fmt.Errorf("%w: unsupported manifest version %d", ErrInvalidArchive, manifest.Version)
+			}
+		case hdr.Name == GitBundleFile:
+			bundleFile = filepath.Join(tmp, GitBundleFile)
+			if err := writeFile(bundleFile, tr); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(hdr.Name, lfsPrefix):
+			if manifest == nil {
+				return nil, fmt.Errorf("%w: %s before %s", ErrInvalidArchive, hdr.Name, ManifestFile)
+			}
+			oid := strings.TrimPrefix(hdr.Name, lfsPrefix)
+			if !manifestHasObject(manifest, oid, hdr.Size) {
+				return nil, fmt.Errorf("%w: LFS object %q is not listed in the manifest", ErrInvalidArchive, oid)
+			}
+			if opts.LFSStorage == nil || opts.LFSStorage.Exists(oid) {
+				continue
+			}
+			if err := importLFSObject(opts.LFSStorage, filepath.Join(tmp, "lfs-object"), oid, hdr.Size, tr); err != nil {
+				return nil, err
+			}
+			result.LFSObjects++
+		default:
+			return nil, fmt.Errorf("%w: unexpected file %q", ErrInvalidArchive, hdr.Name)
+		}
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("%w: missing %s", ErrInvalidArchive, ManifestFile)
+	}
+	if opts.LFSStorage != nil {
+		for _, obj := range manifest.LFSObjects {
+			if !opts.LFSStorage.Exists(obj.OID) {
+				return nil, fmt.Errorf("%w: missing LFS object %q", ErrInvalidArchive, obj.OID)
+			}
+		}
+	}
+
+	var repo *repository.Repository
+	if repository.IsRepository(opts.RepoPath) {
+		repo, err = repository.Open(opts.RepoPath)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if err := os.MkdirAll(filepath.Dir(opts.RepoPath), 0755); err != nil {
+			return nil, err
+		}
+		defaultBranch := manifest.DefaultBranch
+		if defaultBranch == "" {
+			defaultBranch = "main"
+		}
+		repo, err = repository.Init(ctx, opts.RepoPath, defaultBranch)
+		if err != nil {
+			return nil, err
+		}
+		result.Created = true
+	}
+
+	if err := applyBundle(ctx, repo, manifest, bundleFile, opts, result); err != nil {
+		if result.Created {
+			_ = repo.Remove()
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// applyBundle updates the refs of the repository to the commits of the manifest, fetching the objects from the git bundle.
+func applyBundle(ctx context.Context, repo *repository.Repository, manifest *Manifest, bundleFile string, opts ImportOptions, result *ImportResult) error {
+	current, err := repo.Refs()
+	if err != nil {
+		return err
+	}
+
+	var heads map[string]string
+	if bundleFile != "" {
+		heads, err = repository.BundleHeads(ctx, bundleFile)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+		}
+	}
+
+	var refs []string
+	var updates []receive.RefUpdate
+	names := make([]string, 0, len(manifest.Refs))
+	for name := range manifest.Refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		hash := manifest.Refs[name]
+		if !strings.HasPrefix(name, "refs/heads/") && !strings.HasPrefix(name, "refs/tags/") {
+			return fmt.Errorf("%w: unsupported ref %q", ErrInvalidArchive, name)
+		}
+		if current[name] == hash {
+			continue
+		}
+		if heads[name] != hash {
+			return fmt.Errorf("%w: ref %q is not in the git bundle", ErrInvalidArchive, name)
+		}
+		oldRev, ok := current[name]
+		if !ok {
+			oldRev = receive.ZeroHash
+		}
+		refs = append(refs, name)
+		updates = append(updates, receive.NewRefUpdate(oldRev, hash, name, repo.RepoPath()))
+		result.Refs[name] = hash
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+
+	q, err := receive.NewBundleQuarantine(ctx, repo.RepoPath(), bundleFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = q.Close()
+	}()
+	if !opts.Force {
+		if err := checkFastForward(ctx, q, updates); err != nil {
+			return err
+		}
+	}
+
+	if opts.PreReceiveHookFunc != nil {
+		pushCtx, endPush := receive.WithPush(ctx)
+		defer endPush()
+		if ok, err := opts.PreReceiveHookFunc(pushCtx, opts.RepoName, updates); err != nil {
+			return err
+		} else if !ok {
+			return ErrDenied
+		}
+	}
+
+	if opts.QuarantineHookFunc != nil {
+		if err := opts.QuarantineHookFunc(ctx, opts.RepoName, q, updates); err != nil {
+			return fmt.Errorf("%w: %w", ErrRejected, err)
+		}
+	}
+
+	if err := repo.FetchBundle(ctx, bundleFile, refs, opts.Force); err != nil {
+		return err
+	}
+
+	if opts.PostReceiveHookFunc != nil {
+		if hookErr := opts.PostReceiveHookFunc(ctx, opts.RepoName, updates); hookErr != nil {
+			slog.WarnContext(ctx, "post-receive hook error", "repo", opts.RepoName, "error", hookErr)
+		}
+	}
+	return nil
+}
+
+// checkFastForward checks that the updates only fast-forward branches and create tags.
+func checkFastForward(ctx context.Context, q *receive.Quarantine, updates []receive.RefUpdate) error {
+	for _, u := range updates {
+		if u.IsCreate() {
+			continue
+		}
+		if u.IsTag() {
+			return fmt.Errorf("%w: tag %q already exists", ErrNonFastForward, u.Name())
+		}
+		ok, err := q.IsAncestor(ctx, u.OldRev(), u.NewRev())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w: branch %q would not be fast-forwarded", ErrNonFastForward, u.Name())
+		}
+	}
+	return nil
+}
+
+func manifestHasObject(manifest *Manifest, oid string, size int64) bool {
+	for _, obj := range manifest.LFSObjects {
+		if obj.OID == oid && obj.Size == size {
+			return true
+		}
+	}
+	return false
+}
+
+// importLFSObject stores an LFS object of the archive, after checking its content matches its OID.
+func importLFSObject(storage lfs.Storage, file string, oid string, size int64, r io.Reader) error {
+	h := sha256.New()
+	if err := writeFile(file, io.TeeReader(r, h)); err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(file)
+	}()
+	if got := hex.EncodeToString(h.Sum(nil)); got != oid {
+		return fmt.Errorf("%w: LFS object %q has content hash %q", ErrInvalidArchive, oid, got)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	if err := storage.Put(oid, f, size); err != nil {
+		return fmt.Errorf("failed to store LFS object %q: %w", oid, err)
+	}
+	return nil
+}
+
+func writeFile(name string, r io.Reader) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,269 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/receive"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+)
+
+func lfsOpener(storage lfs.Storage) repository.LFSOpenFunc {
+	return func(ptr *lfs.Pointer) (io.ReadCloser, error) {
+		content, _, err := storage.(lfs.Getter).Get(ptr.OID())
+		return content, err
+	}
+}
+
+func commitLFSFile(t *testing.T, repo *repository.Repository, storage lfs.Storage, path string, content []byte) string {
+	t.Helper()
+	sum := sha256.Sum256(content)
+	oid := hex.EncodeToString(sum[:])
+	if err := storage.Put(oid, bytes.NewReader(content), int64(len(content))); err != nil {
+		t.Fatalf("store LFS object: %v", err)
+	}
+	pointer := fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", oid, len(content))
+	head, err := repo.CreateCommit(context.Background(), "main", "add "+path, "test", "test@example.com", []repository.CommitOperation{
+		{Type: repository.CommitOperationAdd, Path: path, Content: []byte(pointer)},
+	}, "")
+	if err != nil {
+		t.Fatalf("create commit: %v", err)
+	}
+	return head
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+
+	srcLFS := lfs.NewLocal(filepath.Join(root, "src-lfs"))
+	src, err := repository.Init(ctx, filepath.Join(root, "src.git"), "main")
+	if err != nil {
+		t.Fatalf("init repository: %v", err)
+	}
+	commitLFSFile(t, src, srcLFS, "model.bin", []byte("first weights"))
+	if err := src.CreateTag("v1", "main"); err != nil {
+		t.Fatalf("create tag: %v", err)
+	}
+	first := commitLFSFile(t, src, srcLFS, "model.bin", []byte("second weights"))
+
+	var full bytes.Buffer
+	if err := Export(ctx, &full, "org/model", src, ExportOptions{OpenLFS: lfsOpener(srcLFS)}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	dstLFS := lfs.NewLocal(filepath.Join(root, "dst-lfs"))
+	var received []receive.RefUpdate
+	opts := ImportOptions{
+		RepoName:   "org/copy",
+		RepoPath:   filepath.Join(root, "dst.git"),
+		LFSStorage: dstLFS,
+		PreReceiveHookFunc: func(ctx context.Context, repoName string, updates []receive.RefUpdate) (bool, error) {
+			return repoName == "org/copy", nil
+		},
+		PostReceiveHookFunc: func(ctx context.Context, repoName string, updates []receive.RefUpdate) error {
+			received = append(received, updates...)
+			return nil
+		},
+	}
+	result, err := Import(ctx, bytes.NewReader(full.Bytes()), opts)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if !result.Created || result.LFSObjects != 2 || len(result.Refs) != 2 || len(received) != 2 {
+		t.Fatalf("unexpected import result %+v with %d updates", result, len(received))
+	}
+
+	// An incremental export only carries what changed since the first one.
+	second := commitLFSFile(t, src, srcLFS, "model.bin", []byte("third weights"))
+	var incremental bytes.Buffer
+	if err := Export(ctx, &incremental, "org/model", src, ExportOptions{Refs: []string{"main"}, Since: []string{first}, OpenLFS: lfsOpener(srcLFS)}); err != nil {
+		t.Fatalf("incremental export: %v", err)
+	}
+	if incremental.Len() >= full.Len() {
+		t.Errorf("expected the incremental archive (%d bytes) to be smaller than the full one (%d bytes)", incremental.Len(), full.Len())
+	}
+
+	received = nil
+	result, err = Import(ctx, bytes.NewReader(incremental.Bytes()), opts)
+	if err != nil {
+		t.Fatalf("incremental import: %v", err)
+	}
+	if result.Created || result.LFSObjects != 1 || result.Refs["refs/heads/main"] != second || len(received) != 1 {
+		t.Fatalf("unexpected incremental import result %+v", result)
+	}
+
+	dst, err := repository.Open(opts.RepoPath)
+	if err != nil {
+		t.Fatalf("open imported repository: %v", err)
+	}
+	refs, err := dst.Refs()
+	if err != nil {
+		t.Fatalf("refs: %v", err)
+	}
+	srcRefs, _ := src.Refs()
+	if fmt.Sprint(refs) != fmt.Sprint(srcRefs) {
+		t.Errorf("expected refs %v, got %v", srcRefs, refs)
+	}
+	ptrs, err := dst.ScanLFSPointersAt("main")
+	if err != nil || len(ptrs) != 1 || !dstLFS.Exists(ptrs[0].OID()) {
+		t.Fatalf("expected the LFS object of main to be imported: %v", err)
+	}
+
+	// Incremental archives need the commits they are relative to.
+	_, err = Import(ctx, bytes.NewReader(incremental.Bytes()), ImportOptions{
+		RepoName:   "org/other",
+		RepoPath:   filepath.Join(root, "other.git"),
+		LFSStorage: lfs.NewLocal(filepath.Join(root, "other-lfs")),
+	})
+	if err == nil {
+		t.Fatalf("expected importing an incremental archive into a new repository to fail")
+	}
+	if repository.IsRepository(filepath.Join(root, "other.git")) {
+		t.Errorf("expected the repository created by the failed import to be removed")
+	}
+}
+
+func TestImportRejectsCorruptedLFSObject(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+
+	srcLFS := lfs.NewLocal(filepath.Join(root, "src-lfs"))
+	src, err := repository.Init(ctx, filepath.Join(root, "src.git"), "main")
+	if err != nil {
+		t.Fatalf("init repository: %v", err)
+	}
+	commitLFSFile(t, src, srcLFS, "model.bin", []byte("weights"))
+
+	var archive bytes.Buffer
+	if err := Export(ctx, &archive, "org/model", src, ExportOptions{OpenLFS: lfsOpener(srcLFS)}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	// Rewrite the archive with the content of the LFS object altered.
+	var corrupted bytes.Buffer
+	tr := tar.NewReader(&archive)
+	tw := tar.NewWriter(&corrupted)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read archive: %v", err)
+		}
+		content, _ := io.ReadAll(tr)
+		if strings.HasPrefix(hdr.Name, "lfs/") {
+			content = bytes.ToUpper(content)
+		}
+		_ = tw.WriteHeader(hdr)
+		_, _ = tw.Write(content)
+	}
+	_ = tw.Close()
+
+	dstLFS := lfs.NewLocal(filepath.Join(root, "dst-lfs"))
+	_, err = Import(ctx, &corrupted, ImportOptions{
+		RepoName:   "org/copy",
+		RepoPath:   filepath.Join(root, "dst.git"),
+		LFSStorage: dstLFS,
+	})
+	if !errors.Is(err, ErrInvalidArchive) {
+		t.Fatalf("expected ErrInvalidArchive, got %v", err)
+	}
+	if repository.IsRepository(filepath.Join(root, "dst.git")) {
+		t.Errorf("expected no repository to be created")
+	}
+}
+
+func TestImportChecks(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+
+	srcLFS := lfs.NewLocal(filepath.Join(root, "src-lfs"))
+	src, err := repository.Init(ctx, filepath.Join(root, "src.git"), "main")
+	if err != nil {
+		t.Fatalf("init repository: %v", err)
+	}
+	commitLFSFile(t, src, srcLFS, "model.bin", []byte("first weights"))
+	commitLFSFile(t, src, srcLFS, "model.bin", []byte("second weights"))
+
+	// The LFS objects of every exported commit are included, not only those of the tips.
+	var archive bytes.Buffer
+	if err := Export(ctx, &archive, "org/model", src, ExportOptions{Refs: []string{"main"}, OpenLFS: lfsOpener(srcLFS)}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	dstPath := filepath.Join(root, "dst.git")
+	dstLFS := lfs.NewLocal(filepath.Join(root, "dst-lfs"))
+	result, err := Import(ctx, bytes.NewReader(archive.Bytes()), ImportOptions{RepoName: "org/copy", RepoPath: dstPath, LFSStorage: dstLFS})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if result.LFSObjects != 2 {
+		t.Fatalf("expected the LFS objects of both commits to be imported, got %d", result.LFSObjects)
+	}
+
+	// Diverge from the source, so that importing it again rewinds main.
+	dst, err := repository.Open(dstPath)
+	if err != nil {
+		t.Fatalf("open imported repository: %v", err)
+	}
+	if _, err := dst.CreateCommit(ctx, "main", "diverge", "test", "test@example.com", []repository.CommitOperation{
+		{Type: repository.CommitOperationAdd, Path: "local.txt", Content: []byte("local")},
+	}, ""); err != nil {
+		t.Fatalf("create commit: %v", err)
+	}
+	before, _ := dst.Refs()
+	head := commitLFSFile(t, src, srcLFS, "model.bin", []byte("third weights"))
+	archive.Reset()
+	if err := Export(ctx, &archive, "org/model", src, ExportOptions{Refs: []string{"main"}, OpenLFS: lfsOpener(srcLFS)}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	var checked []string
+	opts := ImportOptions{
+		RepoName:   "org/copy",
+		RepoPath:   dstPath,
+		LFSStorage: dstLFS,
+		QuarantineHookFunc: func(ctx context.Context, repoName string, q *receive.Quarantine, updates []receive.RefUpdate) error {
+			commits, err := q.NewCommits(ctx, updates[0].NewRev())
+			if err != nil {
+				return err
+			}
+			checked = commits
+			return errors.New("secret found")
+		},
+	}
+	if _, err := Import(ctx, bytes.NewReader(archive.Bytes()), opts); !errors.Is(err, ErrNonFastForward) {
+		t.Fatalf("expected ErrNonFastForward, got %v", err)
+	}
+
+	opts.Force = true
+	if _, err := Import(ctx, bytes.NewReader(archive.Bytes()), opts); !errors.Is(err, ErrRejected) {
+		t.Fatalf("expected ErrRejected, got %v", err)
+	}
+	if len(checked) != 1 || checked[0] != head {
+		t.Errorf("expected the quarantine hook to see the new commits of the bundle, got %v", checked)
+	}
+	if after, _ := dst.Refs(); fmt.Sprint(after) != fmt.Sprint(before) {
+		t.Errorf("expected refs %v to be kept after the rejected import, got %v", before, after)
+	}
+
+	opts.QuarantineHookFunc = nil
+	result, err = Import(ctx, bytes.NewReader(archive.Bytes()), opts)
+	if err != nil {
+		t.Fatalf("forced import: %v", err)
+	}
+	if result.Refs["refs/heads/main"] != head {
+		t.Errorf("expected main to be rewound to %s, got %+v", head, result)
+	}
+}
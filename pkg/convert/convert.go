@@ -0,0 +1,320 @@
+// Package convert converts the data files of dataset repositories to Parquet in the background,
+// committing the converted files to refs/convert/parquet as huggingface.co does.
+package convert
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/matrixhub-ai/hfd/internal/lru"
+	"github.com/matrixhub-ai/hfd/pkg/hf"
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/receive"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+	"github.com/matrixhub-ai/hfd/pkg/storage"
+)
+
+const (
+	// ParquetConvert is the name of the conversion to Parquet.
+	ParquetConvert = "parquet"
+	// ParquetRef is the ref the Parquet files converted from the default branch are committed to.
+	ParquetRef = repository.ConvertRefPrefix + ParquetConvert
+
+	defaultConcurrency = 1
+	// defaultStatusCacheSize bounds the number of repositories whose last conversion status is kept in memory.
+	defaultStatusCacheSize = 1024
+	// defaultMaxSplitSize bounds the size of the data files of a split converted, as on huggingface.co.
+	// Larger splits are converted partially, to a "partial-" prefixed directory.
+	defaultMaxSplitSize = 5 << 30
+)
+
+// State is the conversion state of a repository.
+type State string
+
+const (
+	// StateIdle means the repository was not converted since the converter started.
+	StateIdle State = "idle"
+	// StatePending means a conversion is waiting for a free worker.
+	StatePending State = "pending"
+	// StateRunning means a conversion is in progress.
+	StateRunning State = "running"
+	// StateDone means the convert ref holds the conversion of the revision of the status.
+	StateDone State = "done"
+	// StateSkipped means the repository has no data files to convert.
+	StateSkipped State = "skipped"
+	// StateFailed means the last conversion failed.
+	StateFailed State = "failed"
+)
+
+// Status reports the conversion state of a repository.
+type Status struct {
+	State State `json:"state"`
+	// Revision is the commit of the default branch the convert ref was converted from.
+	Revision string `json:"revision,omitempty"`
+	// Commit is the commit of the convert ref.
+	Commit       string    `json:"commit,omitempty"`
+	LastRun      time.Time `json:"lastRun,omitzero"`
+	LastDuration string    `json:"lastDuration,omitempty"`
+	LastError    string    `json:"lastError,omitempty"`
+}
+
+type repoState struct {
+	status  Status
+	pending bool
+	force   bool
+	running bool
+}
+
+// Converter converts the CSV and JSON data files of dataset repositories to Parquet whenever
+// their default branch changes. A limited number of repositories are converted at once, and a
+// change during a conversion converts the repository again once it ends. Only the repositories
+// being converted are tracked; the statuses of finished conversions are kept in a bounded cache.
+type Converter struct {
+	storage      *storage.Storage
+	lfsStorage   lfs.Storage
+	teeCache     *lfs.TeeCache
+	commitOpts   []repository.CommitOption
+	maxSplitSize int64
+	sem          chan struct{}
+
+	mut      sync.Mutex
+	repos    map[string]*repoState
+	statuses *lru.Cache[string, Status]
+}
+
+// Option defines a functional option for configuring the Converter.
+type Option func(*Converter)
+
+// WithStorage sets the storage the converted repositories are read from. This is required.
+func WithStorage(storage *storage.Storage) Option {
+	return func(c *Converter) {
+		c.storage = storage
+	}
+}
+
+// WithLFSStorage sets the storage the LFS objects of data files are read from, and the Parquet
+// files are stored to. Without it, the Parquet files are committed as plain git blobs.
+func WithLFSStorage(s lfs.Storage) Option {
+	return func(c *Converter) {
+		c.lfsStorage = s
+	}
+}
+
+// WithTeeCache sets the cache of the LFS objects being fetched from a proxy source.
+func WithTeeCache(tc *lfs.TeeCache) Option {
+	return func(c *Converter) {
+		c.teeCache = tc
+	}
+}
+
+// WithCommitOptions sets the options of the commits to the convert ref, such as their signer.
+func WithCommitOptions(opts ...repository.CommitOption) Option {
+	return func(c *Converter) {
+		c.commitOpts = opts
+	}
+}
+
+// WithMaxSplitSize sets the size of the data files of a split beyond which it is converted partially.
+func WithMaxSplitSize(size int64) Option {
+	return func(c *Converter) {
+		if size > 0 {
+			c.maxSplitSize = size
+		}
+	}
+}
+
+// WithConcurrency sets the number of repositories converted at once.
+func WithConcurrency(n int) Option {
+	return func(c *Converter) {
+		c.sem = make(chan struct{}, max(n, 1))
+	}
+}
+
+// NewConverter creates a new Converter with the provided options.
+func NewConverter(opts ...Option) *Converter {
+	c := &Converter{
+		maxSplitSize: defaultMaxSplitSize,
+		sem:          make(chan struct{}, defaultConcurrency),
+		repos:        map[string]*repoState{},
+		statuses:     lru.New[string, Status](defaultStatusCacheSize),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// PostReceiveHook converts a dataset repository when its default branch changes, by a push or a commit.
+// Repositories mirrored from another source are not converted on sync: their data files may only be
+// fetched on demand, and the source converts them itself. It matches receive.PostReceiveHookFunc.
+func (c *Converter) PostReceiveHook(ctx context.Context, repoName string, updates []receive.RefUpdate) error {
+	if c.storage == nil || hf.RepoTypeOf(repoName) != "dataset" {
+		return nil
+	}
+	repoPath := c.storage.ResolvePath(repoName)
+	if repoPath == "" {
+		return nil
+	}
+	repo, err := repository.Open(repoPath)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to open repository to convert", "repo", repoName, "error", err)
+		return err
+	}
+	if repo.IsMirror() {
+		return nil
+	}
+	defaultRef := "refs/heads/" + repo.DefaultBranch()
+	for _, u := range updates {
+		if u.RefName() == defaultRef {
+			c.schedule(repoName, false)
+			break
+		}
+	}
+	return nil
+}
+
+// Run converts the dataset repository as soon as possible, even if the convert ref is up to date.
+func (c *Converter) Run(ctx context.Context, repoName string) error {
+	repoPath := c.storage.ResolvePath(repoName)
+	if repoPath == "" || !repository.IsRepository(repoPath) {
+		return repository.ErrRepositoryNotExists
+	}
+	c.schedule(repoName, true)
+	return nil
+}
+
+// Status returns the conversion status of the repository. When it was not converted since the
+// converter started, the status tells the conversion recorded by its convert ref, if any.
+func (c *Converter) Status(repoName string) Status {
+	c.mut.Lock()
+	st, ok := c.repos[repoName]
+	if ok {
+		status := st.status
+		c.mut.Unlock()
+		return status
+	}
+	c.mut.Unlock()
+	if status, ok := c.statuses.Get(repoName); ok {
+		return status
+	}
+
+	status := Status{State: StateIdle}
+	if c.storage == nil {
+		return status
+	}
+	repoPath := c.storage.ResolvePath(repoName)
+	if repoPath == "" {
+		return status
+	}
+	repo, err := repository.Open(repoPath)
+	if err != nil {
+		return status
+	}
+	if commit, revision, ok := lastConversion(repo); ok {
+		status.State = StateDone
+		status.Commit = commit
+		status.Revision = revision
+	}
+	return status
+}
+
+// repoState returns the state of the repository, creating it from its last status if needed. The caller must hold c.mut.
+func (c *Converter) repoState(repoName string) *repoState {
+	st, ok := c.repos[repoName]
+	if !ok {
+		status, ok := c.statuses.Get(repoName)
+		if !ok {
+			status = Status{State: StateIdle}
+		}
+		st = &repoState{status: status}
+		c.repos[repoName] = st
+	}
+	return st
+}
+
+// schedule marks the repository to be converted, starting the conversion unless one is in progress,
+// in which case the repository is converted again when it ends.
+func (c *Converter) schedule(repoName string, force bool) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	st := c.repoState(repoName)
+	st.pending = true
+	st.force = st.force || force
+	if st.running {
+		return
+	}
+	st.status.State = StatePending
+	go c.start(repoName)
+}
+
+// start converts the repository once a worker is free.
+func (c *Converter) start(repoName string) {
+	c.sem <- struct{}{}
+	defer func() { <-c.sem }()
+
+	c.mut.Lock()
+	st := c.repos[repoName]
+	if st == nil || st.running || !st.pending {
+		c.mut.Unlock()
+		return
+	}
+	force := st.force
+	st.pending = false
+	st.force = false
+	st.running = true
+	st.status.State = StateRunning
+	c.mut.Unlock()
+
+	ctx := context.Background()
+	started := time.Now()
+	result, err := c.convert(ctx, repoName, force)
+	duration := time.Since(started)
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	st.running = false
+	st.status.LastRun = started
+	st.status.LastDuration = duration.String()
+	st.status.LastError = ""
+	if err != nil {
+		st.status.State = StateFailed
+		st.status.LastError = err.Error()
+		slog.WarnContext(ctx, "Parquet conversion: failed", "repo", repoName, "error", err)
+	} else {
+		st.status.Revision = result.revision
+		st.status.Commit = result.commit
+		st.status.State = StateDone
+		if result.commit == "" {
+			st.status.State = StateSkipped
+		}
+		slog.InfoContext(ctx, "Parquet conversion: done", "repo", repoName, "revision", result.revision, "commit", result.commit, "duration", duration)
+	}
+	if st.pending {
+		st.status.State = StatePending
+		go c.start(repoName)
+		return
+	}
+	// The repository is no longer tracked once converted, only its status is kept
+	delete(c.repos, repoName)
+	c.statuses.Add(repoName, st.status)
+}
+
+// sourceRevisionTrailer is the trailer of the commits of the convert ref telling the commit they were converted from.
+const sourceRevisionTrailer = "Source-Revision: "
+
+// lastConversion returns the last commit of the convert ref of the repository, and the commit it was converted from.
+func lastConversion(repo *repository.Repository) (commit string, revision string, ok bool) {
+	commits, err := repo.Commits(ParquetRef, &repository.CommitsOptions{Limit: 1})
+	if err != nil || len(commits) == 0 {
+		return "", "", false
+	}
+	for _, line := range strings.Split(commits[0].Message(), "\n") {
+		if rev, found := strings.CutPrefix(line, sourceRevisionTrailer); found {
+			revision = strings.TrimSpace(rev)
+		}
+	}
+	return commits[0].Hash().String(), revision, true
+}
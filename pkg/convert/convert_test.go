@@ -0,0 +1,198 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/receive"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+	"github.com/matrixhub-ai/hfd/pkg/storage"
+)
+
+func waitConverted(t *testing.T, c *Converter, repoName string) Status {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		status := c.Status(repoName)
+		switch status.State {
+		case StateDone, StateSkipped:
+			return status
+		case StateFailed:
+			t.Fatalf("conversion failed: %s", status.LastError)
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("conversion did not end, got %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConverter(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := storage.NewStorage(storage.WithRootDir(dir))
+	lfsStorage := lfs.NewLocal(store.LFSDir())
+	repoName := "datasets/org/data"
+	repo, err := repository.Init(ctx, store.ResolvePath(repoName), "main")
+	if err != nil {
+		t.Fatalf("init repository: %v", err)
+	}
+
+	c := NewConverter(
+		WithStorage(store),
+		WithLFSStorage(lfsStorage),
+	)
+	commit := func(ops ...repository.CommitOperation) {
+		t.Helper()
+		hash, err := repo.CreateCommit(ctx, "main", "update", "test", "test@example.com", ops, "")
+		if err != nil {
+			t.Fatalf("create commit: %v", err)
+		}
+		err = c.PostReceiveHook(ctx, repoName, []receive.RefUpdate{
+			receive.NewRefUpdate(receive.ZeroHash, hash, "refs/heads/main", repo.RepoPath()),
+		})
+		if err != nil {
+			t.Fatalf("post-receive hook: %v", err)
+		}
+	}
+	add := func(path, content string) repository.CommitOperation {
+		return repository.CommitOperation{Type: repository.CommitOperationAdd, Path: path, Content: []byte(content)}
+	}
+
+	if status := c.Status(repoName); status.State != StateIdle {
+		t.Fatalf("expected idle status, got %+v", status)
+	}
+
+	commit(
+		add("train.csv", "text,label\na,1\nb,0\n"),
+		add("test.csv", "text,label\nc,1\n"),
+		add("images/cat.png", "png"),
+	)
+	status := waitConverted(t, c, repoName)
+	head, _ := repo.ResolveRevision("main")
+	if status.State != StateDone || status.Revision != head || status.Commit == "" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	// Finished conversions are no longer tracked, but their status is kept
+	c.mut.Lock()
+	tracked := len(c.repos)
+	c.mut.Unlock()
+	if tracked != 0 || status.LastRun.IsZero() {
+		t.Errorf("expected the status of the finished conversion to be cached, got %d tracked and %+v", tracked, status)
+	}
+
+	files, err := ListFiles(repo)
+	if err != nil {
+		t.Fatalf("ListFiles: %v", err)
+	}
+	want := []string{"default/test/0000.parquet", "default/train/0000.parquet"}
+	if len(files) != len(want) {
+		t.Fatalf("expected files %v, got %+v", want, files)
+	}
+	for i, f := range files {
+		if f.Path != want[i] || f.Config != "default" || f.Size == 0 {
+			t.Errorf("unexpected file %+v", f)
+		}
+		blob, err := repo.Blob(ParquetRef, f.Path)
+		if err != nil {
+			t.Fatalf("read %q: %v", f.Path, err)
+		}
+		ptr, _ := blob.LFSPointer()
+		if ptr == nil {
+			t.Fatalf("expected %q to be stored with LFS", f.Path)
+		}
+		rc, err := lfs.OpenHead(ctx, lfsStorage, nil, ptr.OID(), ptr.Size())
+		if err != nil {
+			t.Fatalf("open %q: %v", f.Path, err)
+		}
+		data, _ := io.ReadAll(rc)
+		_ = rc.Close()
+		if !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")) {
+			t.Errorf("expected %q to be a Parquet file", f.Path)
+		}
+	}
+	if converts, _ := repo.Converts(); len(converts) != 1 || converts[0] != ParquetConvert {
+		t.Errorf("expected the parquet convert ref, got %v", converts)
+	}
+
+	// A new converter reads the last conversion from the ref
+	if restored := NewConverter(WithStorage(store)).Status(repoName); restored.State != StateDone ||
+		restored.Revision != status.Revision || restored.Commit != status.Commit {
+		t.Errorf("expected status %+v from the ref, got %+v", status, restored)
+	}
+
+	// Splits that are gone are deleted
+	commit(repository.CommitOperation{Type: repository.CommitOperationDelete, Path: "test.csv"})
+	for {
+		if s := waitConverted(t, c, repoName); s.Commit != status.Commit {
+			status = s
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	files, _ = ListFiles(repo)
+	if len(files) != 1 || files[0].Split != "train" {
+		t.Errorf("expected only the train split, got %+v", files)
+	}
+
+	// The convert ref is deleted once there is nothing to convert
+	commit(repository.CommitOperation{Type: repository.CommitOperationDelete, Path: "train.csv"})
+	for c.Status(repoName).State != StateSkipped {
+		waitConverted(t, c, repoName)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if converts, _ := repo.Converts(); len(converts) != 0 {
+		t.Errorf("expected no convert ref, got %v", converts)
+	}
+}
+
+func TestConverterPartialSplit(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewStorage(storage.WithRootDir(t.TempDir()))
+	repoName := "datasets/org/large"
+	repo, err := repository.Init(ctx, store.ResolvePath(repoName), "main")
+	if err != nil {
+		t.Fatalf("init repository: %v", err)
+	}
+	var content bytes.Buffer
+	content.WriteString("n\n")
+	for i := range 1000 {
+		content.WriteString(string(rune('0'+i%10)) + "\n")
+	}
+	_, err = repo.CreateCommit(ctx, "main", "add data", "test", "test@example.com", []repository.CommitOperation{
+		{Type: repository.CommitOperationAdd, Path: "data.csv", Content: content.Bytes()},
+	}, "")
+	if err != nil {
+		t.Fatalf("create commit: %v", err)
+	}
+
+	c := NewConverter(WithStorage(store), WithMaxSplitSize(100))
+	if err := c.Run(ctx, repoName); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	waitConverted(t, c, repoName)
+
+	files, err := ListFiles(repo)
+	if err != nil {
+		t.Fatalf("ListFiles: %v", err)
+	}
+	if len(files) != 1 || files[0].Path != "default/partial-train/0000.parquet" {
+		t.Fatalf("expected a partial train split, got %+v", files)
+	}
+	// Without LFS storage, the files are plain blobs
+	blob, err := repo.Blob(ParquetRef, files[0].Path)
+	if err != nil {
+		t.Fatalf("read parquet file: %v", err)
+	}
+	if ptr, _ := blob.LFSPointer(); ptr != nil {
+		t.Errorf("expected a plain blob, got an LFS pointer")
+	}
+
+	if err := c.Run(ctx, "datasets/org/missing"); err == nil {
+		t.Errorf("expected an error for a missing repository")
+	}
+}
@@ -0,0 +1,352 @@
+package convert
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/matrixhub-ai/hfd/pkg/hf"
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/parquet"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+)
+
+const (
+	commitAuthorName  = "parquet-converter"
+	commitAuthorEmail = "parquet-converter@localhost"
+)
+
+// File is a Parquet file of the convert ref.
+type File struct {
+	Config string `json:"config"`
+	Split  string `json:"split"`
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+}
+
+// ListFiles lists the Parquet files of the convert ref of the repository, which are laid out as
+// {config}/{split}/{shard}.parquet. It returns no files when the repository was not converted.
+func ListFiles(repo *repository.Repository) ([]File, error) {
+	if _, err := repo.ResolveRevision(ParquetRef); err != nil {
+		return nil, nil
+	}
+	entries, err := repo.Tree(ParquetRef, "", &repository.TreeOptions{Recursive: true})
+	if err != nil {
+		return nil, err
+	}
+	var files []File
+	for _, entry := range entries {
+		if entry.Type() != repository.EntryTypeFile || path.Ext(entry.Path()) != ".parquet" {
+			continue
+		}
+		parts := strings.Split(entry.Path(), "/")
+		if len(parts) != 3 {
+			continue
+		}
+		blob, err := entry.Blob()
+		if err != nil {
+			return nil, err
+		}
+		size := blob.Size()
+		if ptr, _ := blob.LFSPointer(); ptr != nil {
+			size = ptr.Size()
+		}
+		files = append(files, File{Config: parts[0], Split: parts[1], Path: entry.Path(), Size: size})
+	}
+	return files, nil
+}
+
+// result is the outcome of a conversion.
+type result struct {
+	revision string
+	// commit is the commit of the convert ref, empty when there was nothing to convert.
+	commit string
+}
+
+// convert converts the data files of the default branch of the repository and commits them to the
+// convert ref. Unless forced, a repository whose convert ref was converted from the default branch is left as is.
+func (c *Converter) convert(ctx context.Context, repoName string, force bool) (result, error) {
+	repoPath := c.storage.ResolvePath(repoName)
+	if repoPath == "" {
+		return result{}, repository.ErrRepositoryNotExists
+	}
+	repo, err := repository.Open(repoPath)
+	if err != nil {
+		return result{}, err
+	}
+
+	revision, err := repo.ResolveRevision(repo.DefaultBranch())
+	if err != nil {
+		return result{}, fmt.Errorf("failed to resolve the default branch: %w", err)
+	}
+	commit, converted, hasRef := lastConversion(repo)
+	if !force && hasRef && converted == revision {
+		return result{revision: revision, commit: commit}, nil
+	}
+
+	card, err := hf.ReadDatasetCard(repo, revision)
+	if err != nil {
+		return result{}, err
+	}
+	dataFiles, err := hf.ReadDataFiles(repo, revision)
+	if err != nil {
+		return result{}, err
+	}
+
+	var ops []repository.CommitOperation
+	paths := map[string]struct{}{}
+	for _, config := range card.ResolveConfigs(dataFiles) {
+		for _, split := range config.Splits {
+			var files []hf.DataFile
+			var size int64
+			for _, f := range split.Files {
+				if fileFormat(f.Path) != "" {
+					files = append(files, f)
+					size += f.Size
+				}
+			}
+			if len(files) == 0 {
+				continue
+			}
+			dir := split.Split
+			if size > c.maxSplitSize {
+				dir = "partial-" + dir
+			}
+			name := path.Join(config.ConfigName, dir, "0000.parquet")
+			op, err := c.convertSplit(ctx, repo, revision, name, files)
+			if err != nil {
+				return result{}, fmt.Errorf("failed to convert split %q of config %q: %w", split.Split, config.ConfigName, err)
+			}
+			ops = append(ops, op)
+			paths[name] = struct{}{}
+		}
+	}
+
+	if len(ops) == 0 {
+		if hasRef {
+			if err := repo.DeleteConvert(ParquetConvert); err != nil {
+				return result{}, fmt.Errorf("failed to delete %s: %w", ParquetRef, err)
+			}
+		}
+		return result{revision: revision}, nil
+	}
+
+	if c.lfsStorage != nil {
+		ops = append(ops, repository.CommitOperation{
+			Type:    repository.CommitOperationAdd,
+			Path:    repository.GitattributesFileName,
+			Content: repository.GitattributesText,
+		})
+	}
+	// Files of configs and splits that are gone are deleted
+	if hasRef {
+		entries, err := repo.Tree(ParquetRef, "", &repository.TreeOptions{Recursive: true})
+		if err != nil {
+			return result{}, err
+		}
+		for _, entry := range entries {
+			if entry.Type() != repository.EntryTypeFile || entry.Path() == repository.GitattributesFileName {
+				continue
+			}
+			if _, ok := paths[entry.Path()]; !ok {
+				ops = append(ops, repository.CommitOperation{Type: repository.CommitOperationDelete, Path: entry.Path()})
+			}
+		}
+	}
+
+	message := fmt.Sprintf("Update parquet files\n\n%s%s\n", sourceRevisionTrailer, revision)
+	commit, err = repo.CreateCommit(ctx, ParquetRef, message, commitAuthorName, commitAuthorEmail, ops, "", c.commitOpts...)
+	if err != nil {
+		return result{}, err
+	}
+	return result{revision: revision, commit: commit}, nil
+}
+
+// convertSplit converts the data files of a split to a Parquet file, returning the operation adding it.
+func (c *Converter) convertSplit(ctx context.Context, repo *repository.Repository, revision string, name string, files []hf.DataFile) (repository.CommitOperation, error) {
+	// The columns and their types are inferred from every row before the rows are written
+	var s schema
+	err := c.scanSplit(ctx, repo, revision, files, func(r row) error {
+		s.add(r)
+		return nil
+	})
+	if err != nil {
+		return repository.CommitOperation{}, err
+	}
+	if len(s.names) == 0 {
+		return repository.CommitOperation{}, errors.New("no columns")
+	}
+
+	tmp, err := os.CreateTemp("", "parquet-*")
+	if err != nil {
+		return repository.CommitOperation{}, err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	hash := sha256.New()
+	buf := bufio.NewWriter(io.MultiWriter(tmp, hash))
+	w, err := parquet.NewWriter(buf, s.columns())
+	if err != nil {
+		return repository.CommitOperation{}, err
+	}
+	values := make([]any, len(s.names))
+	err = c.scanSplit(ctx, repo, revision, files, func(r row) error {
+		clear(values)
+		for i, name := range r.names {
+			j := s.index[name]
+			values[j] = r.values[i].convert(s.kinds[j])
+		}
+		return w.Write(values)
+	})
+	if err != nil {
+		return repository.CommitOperation{}, err
+	}
+	if err := w.Close(); err != nil {
+		return repository.CommitOperation{}, err
+	}
+	if err := buf.Flush(); err != nil {
+		return repository.CommitOperation{}, err
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return repository.CommitOperation{}, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return repository.CommitOperation{}, err
+	}
+
+	if c.lfsStorage == nil {
+		blob, err := repo.WriteBlob(tmp, size)
+		if err != nil {
+			return repository.CommitOperation{}, err
+		}
+		return repository.CommitOperation{Type: repository.CommitOperationAdd, Path: name, Blob: blob}, nil
+	}
+
+	oid := hex.EncodeToString(hash.Sum(nil))
+	if !c.lfsStorage.Exists(oid) {
+		if err := c.lfsStorage.Put(oid, tmp, size); err != nil {
+			return repository.CommitOperation{}, fmt.Errorf("failed to store %q: %w", name, err)
+		}
+	}
+	return repository.CommitOperation{
+		Type:    repository.CommitOperationAdd,
+		Path:    name,
+		Content: []byte(lfs.NewPointer(oid, size).Encoded()),
+	}, nil
+}
+
+// errSplitLimit stops the scan of a split once the maximum size of a split is read.
+var errSplitLimit = errors.New("split size limit reached")
+
+// scanSplit calls fn with the rows of the data files of a split, in order. The rows past
+// the maximum size of a split are left out. Scans of the same files yield the same rows.
+func (c *Converter) scanSplit(ctx context.Context, repo *repository.Repository, revision string, files []hf.DataFile, fn func(row) error) error {
+	var read int64
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rc, err := c.openFile(ctx, repo, revision, f.Path)
+		if err != nil {
+			return fmt.Errorf("failed to open %q: %w", f.Path, err)
+		}
+		cr := &countingReader{r: rc}
+		br := bufio.NewReader(cr)
+		err = readRows(br, fileFormat(f.Path), func(r row) error {
+			// The bytes read ahead are not counted, so the first rows of a split are always converted
+			if read+cr.n-int64(br.Buffered()) > c.maxSplitSize {
+				return errSplitLimit
+			}
+			return fn(r)
+		})
+		_ = rc.Close()
+		read += cr.n
+		if errors.Is(err, errSplitLimit) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %q: %w", f.Path, err)
+		}
+	}
+	return nil
+}
+
+// openFile opens a file of the repository at revision, reading LFS files from their object.
+func (c *Converter) openFile(ctx context.Context, repo *repository.Repository, revision string, name string) (io.ReadCloser, error) {
+	blob, err := repo.Blob(revision, name)
+	if err != nil {
+		return nil, err
+	}
+	if ptr, _ := blob.LFSPointer(); ptr != nil {
+		return lfs.OpenHead(ctx, c.lfsStorage, c.teeCache, ptr.OID(), ptr.Size())
+	}
+	return blob.NewReader()
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// schema collects the columns of the rows of a split and the kinds of their values.
+type schema struct {
+	names []string
+	index map[string]int
+	kinds []kind
+}
+
+func (s *schema) add(r row) {
+	if s.index == nil {
+		s.index = map[string]int{}
+	}
+	for i, name := range r.names {
+		j, ok := s.index[name]
+		if !ok {
+			j = len(s.names)
+			s.index[name] = j
+			s.names = append(s.names, name)
+			s.kinds = append(s.kinds, kindNull)
+		}
+		s.kinds[j] = mergeKinds(s.kinds[j], r.values[i].kind)
+	}
+}
+
+// columns returns the Parquet columns of the schema. Columns with only nulls are strings.
+func (s *schema) columns() []parquet.Column {
+	columns := make([]parquet.Column, len(s.names))
+	for i, name := range s.names {
+		columns[i] = parquet.Column{Name: name, Type: s.kinds[i].parquetType()}
+	}
+	return columns
+}
+
+// formats maps the extensions of the data files converted to their format.
+var formats = map[string]string{
+	".csv":   "csv",
+	".tsv":   "tsv",
+	".json":  "json",
+	".jsonl": "json",
+}
+
+// fileFormat returns the format of a data file converted to Parquet, or "" if it is not converted.
+func fileFormat(name string) string {
+	return formats[strings.ToLower(path.Ext(name))]
+}
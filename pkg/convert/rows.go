@@ -0,0 +1,299 @@
+package convert
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/matrixhub-ai/hfd/pkg/parquet"
+)
+
+// kind is the kind of a value read from a data file, from which the types of the columns are inferred.
+type kind int
+
+const (
+	kindNull kind = iota
+	kindBool
+	kindInt
+	kindDouble
+	kindString
+)
+
+// mergeKinds returns the kind of a column holding values of both kinds: integers and
+// doubles are doubles, and values of any other different kinds are strings.
+func mergeKinds(a, b kind) kind {
+	switch {
+	case a == b || b == kindNull:
+		return a
+	case a == kindNull:
+		return b
+	case a == kindInt && b == kindDouble, a == kindDouble && b == kindInt:
+		return kindDouble
+	}
+	return kindString
+}
+
+func (k kind) parquetType() parquet.Type {
+	switch k {
+	case kindBool:
+		return parquet.Boolean
+	case kindInt:
+		return parquet.Int64
+	case kindDouble:
+		return parquet.Double
+	}
+	return parquet.String
+}
+
+// value is a value of a data file, with its text in the file.
+type value struct {
+	kind kind
+	text string
+}
+
+// convert returns the value as a value of a Parquet column of the given kind.
+func (v value) convert(k kind) any {
+	if v.kind == kindNull {
+		return nil
+	}
+	switch k {
+	case kindBool:
+		return strings.EqualFold(v.text, "true")
+	case kindInt:
+		n, _ := strconv.ParseInt(v.text, 10, 64)
+		return n
+	case kindDouble:
+		f, _ := strconv.ParseFloat(v.text, 64)
+		return f
+	}
+	return v.text
+}
+
+// row is a row of a data file, with the names of its columns in the order they are read.
+type row struct {
+	names  []string
+	values []value
+}
+
+func (r *row) set(name string, v value) {
+	for i, n := range r.names {
+		if n == name {
+			r.values[i] = v
+			return
+		}
+	}
+	r.names = append(r.names, name)
+	r.values = append(r.values, v)
+}
+
+// readRows calls fn with each row of a data file of the given format.
+func readRows(r *bufio.Reader, format string, fn func(row) error) error {
+	switch format {
+	case "csv":
+		return readCSV(r, ',', fn)
+	case "tsv":
+		return readCSV(r, '\t', fn)
+	case "json":
+		return readJSON(r, fn)
+	}
+	return fmt.Errorf("unsupported format %q", format)
+}
+
+// csvNullValues are the values of CSV files read as nulls, as by pandas.
+var csvNullValues = map[string]struct{}{
+	"": {}, "#N/A": {}, "#N/A N/A": {}, "#NA": {}, "-1.#IND": {}, "-1.#QNAN": {}, "-NaN": {}, "-nan": {},
+	"1.#IND": {}, "1.#QNAN": {}, "<NA>": {}, "N/A": {}, "NA": {}, "NULL": {}, "NaN": {}, "None": {},
+	"n/a": {}, "nan": {}, "null": {},
+}
+
+// readCSV reads a CSV file whose first record names its columns.
+func readCSV(r io.Reader, comma rune, fn func(row) error) error {
+	cr := csv.NewReader(r)
+	cr.Comma = comma
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(header))
+	seen := map[string]int{}
+	for i, name := range header {
+		name = strings.TrimPrefix(name, "\ufeff")
+		if name == "" {
+			name = fmt.Sprintf("Unnamed: %d", i)
+		}
+		// Duplicate names are numbered, as by pandas
+		if n := seen[name]; n > 0 {
+			seen[name]++
+			name = fmt.Sprintf("%s.%d", name, n)
+		} else {
+			seen[name] = 1
+		}
+		names[i] = name
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(record) == 1 && record[0] == "" {
+			continue
+		}
+		r := row{names: names, values: make([]value, len(names))}
+		for i := range names {
+			if i < len(record) {
+				r.values[i] = csvValue(record[i])
+			}
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+}
+
+func csvValue(s string) value {
+	if _, ok := csvNullValues[s]; ok {
+		return value{}
+	}
+	switch s {
+	case "true", "True", "TRUE", "false", "False", "FALSE":
+		return value{kind: kindBool, text: s}
+	}
+	if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return value{kind: kindInt, text: s}
+	}
+	// Words such as "inf" are strings, not doubles
+	if strings.ContainsAny(s, "0123456789") {
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			return value{kind: kindDouble, text: s}
+		}
+	}
+	return value{kind: kindString, text: s}
+}
+
+// readJSON reads a JSON Lines file of objects, or a JSON file of an array of objects.
+// Nested objects and arrays are kept as JSON strings.
+func readJSON(r *bufio.Reader, fn func(row) error) error {
+	if bom, _ := r.Peek(3); bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+		_, _ = r.Discard(3)
+	}
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	first, err := peekNonSpace(r)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	array := first == '['
+	if array {
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	}
+
+	for {
+		if array && !dec.More() {
+			return nil
+		}
+		r, err := readObject(dec)
+		if err == io.EOF && !array {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+}
+
+func peekNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return b, r.UnreadByte()
+		}
+	}
+}
+
+// readObject reads a JSON object as a row.
+func readObject(dec *json.Decoder) (row, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return row{}, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return row{}, fmt.Errorf("expected a JSON object, got %v", tok)
+	}
+	var r row
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return row{}, err
+		}
+		name, ok := tok.(string)
+		if !ok {
+			return row{}, fmt.Errorf("expected a JSON object key, got %v", tok)
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return row{}, err
+		}
+		v, err := jsonValue(raw)
+		if err != nil {
+			return row{}, err
+		}
+		r.set(name, v)
+	}
+	if _, err := dec.Token(); err != nil {
+		return row{}, err
+	}
+	return r, nil
+}
+
+func jsonValue(raw json.RawMessage) (value, error) {
+	switch raw[0] {
+	case 'n':
+		return value{}, nil
+	case 't', 'f':
+		return value{kind: kindBool, text: string(raw)}, nil
+	case '"':
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return value{}, err
+		}
+		return value{kind: kindString, text: s}, nil
+	case '{', '[':
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, raw); err != nil {
+			return value{}, err
+		}
+		return value{kind: kindString, text: buf.String()}, nil
+	}
+	text := string(raw)
+	if _, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return value{kind: kindInt, text: text}, nil
+	}
+	return value{kind: kindDouble, text: text}, nil
+}
@@ -0,0 +1,100 @@
+package convert
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/matrixhub-ai/hfd/pkg/parquet"
+)
+
+func TestReadRows(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		columns []parquet.Column
+		rows    [][]any
+	}{
+		{
+			name:    "csv",
+			format:  "csv",
+			content: "\ufeffid,score,ok,text,,id\n1,0.5,true,hello,x,2\n2,3,False,NA,y\n",
+			columns: []parquet.Column{
+				{Name: "id", Type: parquet.Int64},
+				{Name: "score", Type: parquet.Double},
+				{Name: "ok", Type: parquet.Boolean},
+				{Name: "text", Type: parquet.String},
+				{Name: "Unnamed: 4", Type: parquet.String},
+				{Name: "id.1", Type: parquet.Int64},
+			},
+			rows: [][]any{
+				{int64(1), 0.5, true, "hello", "x", int64(2)},
+				{int64(2), 3.0, false, nil, "y", nil},
+			},
+		},
+		{
+			name:    "tsv",
+			format:  "tsv",
+			content: "a\tb\n1\tinf\n",
+			columns: []parquet.Column{{Name: "a", Type: parquet.Int64}, {Name: "b", Type: parquet.String}},
+			rows:    [][]any{{int64(1), "inf"}},
+		},
+		{
+			name:    "json lines",
+			format:  "json",
+			content: "{\"a\": 1, \"b\": {\"x\": [1, 2]}}\n\n{\"c\": null, \"a\": \"two\"}\n",
+			columns: []parquet.Column{
+				{Name: "a", Type: parquet.String},
+				{Name: "b", Type: parquet.String},
+				{Name: "c", Type: parquet.String},
+			},
+			rows: [][]any{
+				{"1", `{"x":[1,2]}`, nil},
+				{"two", nil, nil},
+			},
+		},
+		{
+			name:    "json array",
+			format:  "json",
+			content: " [{\"n\": 1}, {\"n\": 2.5, \"ok\": true}]",
+			columns: []parquet.Column{{Name: "n", Type: parquet.Double}, {Name: "ok", Type: parquet.Boolean}},
+			rows:    [][]any{{1.0, nil}, {2.5, true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s schema
+			var rows []row
+			err := readRows(bufio.NewReader(strings.NewReader(tt.content)), tt.format, func(r row) error {
+				s.add(r)
+				rows = append(rows, r)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("readRows: %v", err)
+			}
+			if columns := s.columns(); !reflect.DeepEqual(columns, tt.columns) {
+				t.Errorf("expected columns %v, got %v", tt.columns, columns)
+			}
+			var got [][]any
+			for _, r := range rows {
+				values := make([]any, len(s.names))
+				for i, name := range r.names {
+					j := s.index[name]
+					values[j] = r.values[i].convert(s.kinds[j])
+				}
+				got = append(got, values)
+			}
+			if !reflect.DeepEqual(got, tt.rows) {
+				t.Errorf("expected rows %v, got %v", tt.rows, got)
+			}
+		})
+	}
+
+	err := readRows(bufio.NewReader(strings.NewReader("[1, 2]")), "json", func(row) error { return nil })
+	if err == nil {
+		t.Errorf("expected an error for JSON values that are not objects")
+	}
+}
@@ -0,0 +1,274 @@
+package gguf
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/matrixhub-ai/hfd/internal/lru"
+	"github.com/matrixhub-ai/hfd/pkg/hf"
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/receive"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+	"github.com/matrixhub-ai/hfd/pkg/storage"
+)
+
+const defaultCacheSize = 4096
+
+// reShard matches the suffix of the files a GGUF model is split into, such as "-00001-of-00003.gguf".
+var reShard = regexp.MustCompile(`-\d{5}-of-\d{5}\.gguf$`)
+
+// Info describes the GGUF models of a repository: the first model with a valid header, with the shards of a split model
+// counted together, and the file types of all the models.
+type Info struct {
+	Total         int64  `json:"total"`
+	Architecture  string `json:"architecture,omitempty"`
+	ContextLength int64  `json:"context_length,omitempty"`
+	ChatTemplate  string `json:"chat_template,omitempty"`
+	Quantization  string `json:"quantization,omitempty"`
+	TensorCount   uint64 `json:"tensor_count"`
+
+	// FileTypes are the file types of all the models, such as "Q4_K_M".
+	FileTypes []string `json:"-"`
+}
+
+// fileInfo is what is kept of the header of a GGUF file, or the error it failed to parse with.
+type fileInfo struct {
+	architecture  string
+	contextLength int64
+	chatTemplate  string
+	fileType      string
+	parameters    int64
+	tensorCount   uint64
+	err           error
+}
+
+// Indexer describes the GGUF models of repositories from the headers of their files.
+// The headers are cached by object ID, failures included, and the descriptions by commit,
+// so that listing models reads nothing once their pushes were indexed.
+type Indexer struct {
+	storage    *storage.Storage
+	lfsStorage lfs.Storage
+	teeCache   *lfs.TeeCache
+	files      *lru.Cache[string, fileInfo]
+	commits    *lru.Cache[string, *Info]
+}
+
+// Option defines a functional option for configuring the Indexer.
+type Option func(*Indexer)
+
+// WithStorage sets the storage repositories are opened from by PostReceiveHook.
+func WithStorage(storage *storage.Storage) Option {
+	return func(x *Indexer) {
+		x.storage = storage
+	}
+}
+
+// WithLFSStorage sets the storage the LFS objects of GGUF files are read from.
+func WithLFSStorage(s lfs.Storage) Option {
+	return func(x *Indexer) {
+		x.lfsStorage = s
+	}
+}
+
+// WithTeeCache sets the cache of the LFS objects being fetched from a proxy source,
+// whose headers can be read before the fetch completes.
+func WithTeeCache(c *lfs.TeeCache) Option {
+	return func(x *Indexer) {
+		x.teeCache = c
+	}
+}
+
+// WithCacheSize sets the number of files and of commits whose descriptions are kept in memory.
+func WithCacheSize(n int) Option {
+	return func(x *Indexer) {
+		x.files = lru.New[string, fileInfo](n)
+		x.commits = lru.New[string, *Info](n)
+	}
+}
+
+// NewIndexer creates a new Indexer with the provided options.
+func NewIndexer(opts ...Option) *Indexer {
+	x := &Indexer{
+		files:   lru.New[string, fileInfo](defaultCacheSize),
+		commits: lru.New[string, *Info](defaultCacheSize),
+	}
+	for _, opt := range opts {
+		opt(x)
+	}
+	return x
+}
+
+// Info describes the GGUF models of a repository at rev, or returns nil when it has no GGUF files.
+// Files whose header cannot be read are left out. The GGUF files are found in entries, the files of the
+// repository at rev listed recursively, which are only listed when nil and the description is not cached.
+func (x *Indexer) Info(ctx context.Context, repo *repository.Repository, rev string, entries []*repository.TreeEntry) (*Info, error) {
+	commit, err := repo.ResolveRevision(rev)
+	if err != nil {
+		// Revisions that do not exist, such as the default branch of an empty repository, have no models
+		return nil, nil
+	}
+	if info, ok := x.commits.Get(commit); ok {
+		return info, nil
+	}
+
+	if entries == nil {
+		entries, err = repo.Tree(commit, "", &repository.TreeOptions{Recursive: true})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Files of the same model share the name before the shard suffix
+	models := map[string][]string{}
+	for _, entry := range entries {
+		if entry.Type() != repository.EntryTypeFile || !strings.HasSuffix(entry.Path(), ".gguf") {
+			continue
+		}
+		name := reShard.ReplaceAllString(entry.Path(), "")
+		models[name] = append(models[name], entry.Path())
+	}
+	if len(models) == 0 {
+		x.commits.Add(commit, nil)
+		return nil, nil
+	}
+	names := make([]string, 0, len(models))
+	for name := range models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	info := &Info{}
+	complete := true
+	described := false
+	for _, name := range names {
+		files := models[name]
+		sort.Strings(files)
+		// The model described is the first one with a valid header; the others only tell their file type,
+		// which is in their first shard
+		main := !described
+		if !main {
+			files = files[:1]
+		}
+		for j, file := range files {
+			f, err := x.file(ctx, repo, commit, file)
+			if err != nil {
+				// The description is not cached until the file can be read, such as an LFS object not uploaded yet
+				slog.WarnContext(ctx, "Failed to read GGUF header", "file", file, "rev", rev, "error", err)
+				complete = false
+				continue
+			}
+			if f.err != nil {
+				continue
+			}
+			if j == 0 && f.fileType != "" {
+				info.FileTypes = append(info.FileTypes, f.fileType)
+			}
+			if !main {
+				continue
+			}
+			if !described {
+				info.Architecture = f.architecture
+				info.ContextLength = f.contextLength
+				info.ChatTemplate = f.chatTemplate
+				info.Quantization = f.fileType
+				described = true
+			}
+			info.Total += f.parameters
+			info.TensorCount += f.tensorCount
+		}
+	}
+	if complete {
+		x.commits.Add(commit, info)
+	}
+	return info, nil
+}
+
+// file returns what is kept of the header of a GGUF file of a repository at rev, caching it by object ID.
+// Only the header region of the file is read. Files that do not parse are cached with the error they failed with,
+// while an error is returned when the file cannot be read.
+func (x *Indexer) file(ctx context.Context, repo *repository.Repository, rev string, file string) (fileInfo, error) {
+	blob, err := repo.Blob(rev, file)
+	if err != nil {
+		return fileInfo{}, err
+	}
+	// Content that does not parse as a pointer is the file itself
+	ptr, _ := blob.LFSPointer()
+
+	key := blob.Hash().String()
+	open := blob.NewReader
+	if ptr != nil {
+		key = ptr.OID()
+		open = func() (io.ReadCloser, error) {
+			return lfs.OpenHead(ctx, x.lfsStorage, x.teeCache, ptr.OID(), hf.MaxGGUFHeaderSize)
+		}
+	}
+	if f, ok := x.files.Get(key); ok {
+		return f, nil
+	}
+
+	rc, err := open()
+	if err != nil {
+		return fileInfo{}, err
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+	g, err := hf.ParseGGUF(rc)
+	if err != nil {
+		// Files that are not valid GGUF files stay so
+		slog.WarnContext(ctx, "Invalid GGUF header", "file", file, "rev", rev, "error", err)
+		f := fileInfo{err: err}
+		x.files.Add(key, f)
+		return f, nil
+	}
+	f := fileInfo{
+		architecture:  g.Architecture(),
+		contextLength: g.ContextLength(),
+		chatTemplate:  g.ChatTemplate(),
+		fileType:      g.FileType(),
+		parameters:    g.Parameters,
+		tensorCount:   g.TensorCount,
+	}
+	x.files.Add(key, f)
+	return f, nil
+}
+
+// PostReceiveHook describes the GGUF models of the updated branches in the background,
+// so that they are cached by the time models are listed. It matches receive.PostReceiveHookFunc.
+func (x *Indexer) PostReceiveHook(ctx context.Context, repoName string, updates []receive.RefUpdate) error {
+	if x.storage == nil {
+		return nil
+	}
+	var revs []string
+	for _, u := range updates {
+		if u.IsBranch() && !u.IsDelete() {
+			revs = append(revs, u.NewRev())
+		}
+	}
+	if len(revs) == 0 {
+		return nil
+	}
+	repoPath := x.storage.ResolvePath(repoName)
+	if repoPath == "" {
+		return nil
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		repo, err := repository.Open(repoPath)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to open repository to read GGUF headers", "repo", repoName, "error", err)
+			return
+		}
+		for _, rev := range revs {
+			if _, err := x.Info(ctx, repo, rev, nil); err != nil {
+				slog.WarnContext(ctx, "Failed to read GGUF headers", "repo", repoName, "rev", rev, "error", err)
+			}
+		}
+	}()
+	return nil
+}
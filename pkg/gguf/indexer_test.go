@@ -0,0 +1,143 @@
+package gguf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+)
+
+// buildFile returns a GGUF file of a llama model quantized to fileType, with one tensor of the given size.
+func buildFile(fileType uint32, size uint64) []byte {
+	var buf bytes.Buffer
+	le := binary.LittleEndian
+	putString := func(s string) {
+		_ = binary.Write(&buf, le, uint64(len(s)))
+		buf.WriteString(s)
+	}
+	_ = binary.Write(&buf, le, []uint32{0x46554747, 3})
+	_ = binary.Write(&buf, le, []uint64{1, 2}) // tensors, metadata
+	putString("general.architecture")
+	_ = binary.Write(&buf, le, uint32(8))
+	putString("llama")
+	putString("general.file_type")
+	_ = binary.Write(&buf, le, []uint32{4, fileType})
+	putString("token_embd.weight")
+	_ = binary.Write(&buf, le, uint32(1))
+	_ = binary.Write(&buf, le, size)
+	_ = binary.Write(&buf, le, uint32(12))
+	_ = binary.Write(&buf, le, uint64(0))
+	return buf.Bytes()
+}
+
+func TestIndexer(t *testing.T) {
+	lfsDir := t.TempDir()
+	lfsStorage := lfs.NewLocal(lfsDir)
+	workDir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.CommandContext(t.Context(), "git", args...)
+		cmd.Dir = workDir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	write := func(name string, content []byte) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(workDir, name), content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// writeLFS writes the pointer of the content in the repository, storing the content when store is set.
+	writeLFS := func(name string, content []byte, store bool) {
+		t.Helper()
+		sum := sha256.Sum256(content)
+		oid := hex.EncodeToString(sum[:])
+		if store {
+			if err := lfsStorage.Put(oid, bytes.NewReader(content), int64(len(content))); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+		}
+		write(name, []byte(fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", oid, len(content))))
+	}
+
+	git("init", "--initial-branch=main")
+	git("config", "user.email", "test@test.com")
+	git("config", "user.name", "Test User")
+	write("README.md", []byte("# Model\n"))
+	git("add", ".")
+	git("commit", "-m", "Initial commit")
+	write("model-Q4_K_M.gguf", buildFile(15, 100))
+	write("broken.gguf", []byte("not a GGUF file"))
+	git("add", ".")
+	git("commit", "-m", "Add weights")
+
+	repo, err := repository.Open(workDir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	x := NewIndexer(WithLFSStorage(lfsStorage))
+
+	info, err := x.Info(t.Context(), repo, "main~1", nil)
+	if err != nil || info != nil {
+		t.Fatalf("expected no info without GGUF files, got %+v, %v", info, err)
+	}
+	// Files that are not GGUF files are left out
+	info, err = x.Info(t.Context(), repo, "main", nil)
+	if err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+	if info.Architecture != "llama" || info.Quantization != "Q4_K_M" || info.Total != 100 || len(info.FileTypes) != 1 {
+		t.Errorf("unexpected info %+v", info)
+	}
+	if f, ok := x.files.Get(hashOf(t, workDir, "main:broken.gguf")); !ok || f.err == nil {
+		t.Errorf("expected the failure of broken.gguf to be cached, got %+v", f)
+	}
+
+	// Descriptions are cached by commit
+	git("rm", "-q", "broken.gguf")
+	writeLFS("model-Q8_0.gguf", buildFile(7, 50), false)
+	git("add", ".")
+	git("commit", "-m", "Add quantization")
+	head := hashOf(t, workDir, "main")
+	if cached, ok := x.commits.Get(hashOf(t, workDir, "main~1")); !ok || cached != info {
+		t.Errorf("expected the description of main~1 to be cached")
+	}
+
+	// Descriptions of files not uploaded yet are not cached
+	if _, err := x.Info(t.Context(), repo, "main", nil); err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+	if _, ok := x.commits.Get(head); ok {
+		t.Errorf("expected the description of %s not to be cached while an object is missing", head)
+	}
+	writeLFS("model-Q8_0.gguf", buildFile(7, 50), true)
+	info, err = x.Info(t.Context(), repo, "main", nil)
+	if err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+	if info.Quantization != "Q4_K_M" || strings.Join(info.FileTypes, ",") != "Q4_K_M,Q8_0" {
+		t.Errorf("unexpected info %+v", info)
+	}
+	if _, ok := x.commits.Get(head); !ok {
+		t.Errorf("expected the description of %s to be cached", head)
+	}
+}
+
+func hashOf(t *testing.T, dir, rev string) string {
+	t.Helper()
+	out, err := exec.CommandContext(t.Context(), "git", "-C", dir, "rev-parse", rev).Output()
+	if err != nil {
+		t.Fatalf("rev-parse %s: %v", rev, err)
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,64 @@
+package hf
+
+import (
+	"slices"
+	"strings"
+)
+
+// BaseModel is a model another model is derived from.
+type BaseModel struct {
+	// ID is the ID of the base model (e.g. "meta-llama/Llama-2-7b").
+	ID string `json:"id"`
+	// Relation is how the model relates to the base model, one of BaseModelRelations.
+	Relation string `json:"relation"`
+}
+
+// Tags returns the tags the Hub gives a model derived from the base model:
+// "base_model:<id>" and "base_model:<relation>:<id>".
+func (b BaseModel) Tags() []string {
+	return []string{
+		"base_model:" + b.ID,
+		"base_model:" + b.Relation + ":" + b.ID,
+	}
+}
+
+// BaseModels returns the models the model with card and files is derived from. The relation
+// to them is the base_model_relation of the card, or else the one its files tell: adapters
+// and quantizations are recognized by their files, and models with several bases are merges.
+// Base models that are not the ID of a model are left out.
+func BaseModels(card *Card, files *ModelFiles) []BaseModel {
+	var ids []string
+	for _, id := range card.BaseModel {
+		id = strings.TrimSpace(id)
+		if reRepoID.MatchString(id) && !strings.Contains(id, "..") && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	relation := card.BaseModelRelation
+	if !slices.Contains(BaseModelRelations, relation) {
+		relation = inferBaseModelRelation(len(ids), files)
+	}
+	bases := make([]BaseModel, 0, len(ids))
+	for _, id := range ids {
+		bases = append(bases, BaseModel{ID: id, Relation: relation})
+	}
+	return bases
+}
+
+// inferBaseModelRelation returns the relation of a model with n base models to them, from its files.
+func inferBaseModelRelation(n int, files *ModelFiles) string {
+	switch {
+	case files != nil && files.LibraryName() == "peft":
+		return "adapter"
+	case files != nil && (files.HasGGUF || files.hasExt(".gguf") || (files.Config != nil && files.Config.QuantizationConfig != nil)):
+		return "quantized"
+	case n > 1:
+		return "merge"
+	default:
+		return "finetune"
+	}
+}
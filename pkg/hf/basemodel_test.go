@@ -0,0 +1,64 @@
+package hf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBaseModels(t *testing.T) {
+	tests := []struct {
+		name  string
+		card  Card
+		files *ModelFiles
+		want  []BaseModel
+	}{
+		{
+			name: "no base model",
+		},
+		{
+			name: "explicit relation",
+			card: Card{BaseModel: StringOrSlice{"org/base"}, BaseModelRelation: "quantized"},
+			want: []BaseModel{{ID: "org/base", Relation: "quantized"}},
+		},
+		{
+			name: "finetune by default",
+			card: Card{BaseModel: StringOrSlice{"org/base"}},
+			want: []BaseModel{{ID: "org/base", Relation: "finetune"}},
+		},
+		{
+			name:  "adapter",
+			card:  Card{BaseModel: StringOrSlice{"org/base"}},
+			files: &ModelFiles{Paths: []string{"adapter_config.json"}},
+			want:  []BaseModel{{ID: "org/base", Relation: "adapter"}},
+		},
+		{
+			name:  "quantized",
+			card:  Card{BaseModel: StringOrSlice{"org/base"}},
+			files: &ModelFiles{HasGGUF: true},
+			want:  []BaseModel{{ID: "org/base", Relation: "quantized"}},
+		},
+		{
+			name: "merge",
+			card: Card{BaseModel: StringOrSlice{"org/a", "org/b", "org/a"}},
+			want: []BaseModel{{ID: "org/a", Relation: "merge"}, {ID: "org/b", Relation: "merge"}},
+		},
+		{
+			name: "invalid ids and relation",
+			card: Card{BaseModel: StringOrSlice{"https://example.com/model", "org/base"}, BaseModelRelation: "distilled"},
+			want: []BaseModel{{ID: "org/base", Relation: "finetune"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := BaseModels(&tt.card, tt.files)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+
+	tags := BaseModel{ID: "org/base", Relation: "adapter"}.Tags()
+	if !reflect.DeepEqual(tags, []string{"base_model:org/base", "base_model:adapter:org/base"}) {
+		t.Errorf("unexpected tags %v", tags)
+	}
+}
@@ -0,0 +1,62 @@
+package hf
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/matrixhub-ai/hfd/pkg/receive"
+)
+
+// cardFile is the file holding the card of a repository.
+const cardFile = "README.md"
+
+// RepoTypeOf returns the type of a repository ("model", "dataset" or "space") from its storage name,
+// in which the repositories of datasets and spaces are prefixed by "datasets/" and "spaces/".
+func RepoTypeOf(repoName string) string {
+	switch {
+	case strings.HasPrefix(repoName, "datasets/"):
+		return "dataset"
+	case strings.HasPrefix(repoName, "spaces/"):
+		return "space"
+	default:
+		return "model"
+	}
+}
+
+// ValidateCardsHook validates the card of the branches a push updates, and rejects the push when
+// it changes a card to one with invalid metadata. Cards the push does not change are not validated.
+// It is a receive.QuarantineHookFunc.
+func ValidateCardsHook(ctx context.Context, repoName string, q *receive.Quarantine, updates []receive.RefUpdate) error {
+	for _, u := range updates {
+		if !u.IsBranch() || u.IsDelete() {
+			continue
+		}
+		hash := cardHash(ctx, q, u.NewRev())
+		if hash == "" || (u.OldRev() != receive.ZeroHash && hash == cardHash(ctx, q, u.OldRev())) {
+			continue
+		}
+
+		var content []byte
+		err := q.ReadObjects(ctx, []string{hash}, func(_ string, _ string, data []byte) error {
+			content = data
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := ValidateCard(content, RepoTypeOf(repoName)).Err(); err != nil {
+			return fmt.Errorf("%s of %s: %w", cardFile, u.RefName(), err)
+		}
+	}
+	return nil
+}
+
+// cardHash returns the hash of the card at rev, or an empty string if there is none.
+func cardHash(ctx context.Context, q *receive.Quarantine, rev string) string {
+	out, err := q.Command(ctx, "rev-parse", "--verify", "--quiet", rev+":"+cardFile).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,83 @@
+package hf
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matrixhub-ai/hfd/pkg/receive"
+)
+
+func git(t *testing.T, dir string, input string, args ...string) string {
+	t.Helper()
+	cmd := exec.CommandContext(t.Context(), "git", args...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(input)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("git %s failed: %v", strings.Join(args, " "), err)
+	}
+	return string(out)
+}
+
+func TestValidateCardsHook(t *testing.T) {
+	repoDir := filepath.Join(t.TempDir(), "repo.git")
+	workDir := t.TempDir()
+	git(t, "", "", "init", "--bare", "--initial-branch=main", repoDir)
+	git(t, "", "", "init", "--initial-branch=main", workDir)
+	git(t, workDir, "", "config", "user.email", "test@test.com")
+	git(t, workDir, "", "config", "user.name", "Test User")
+	commit := func(readme string) string {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(workDir, cardFile), []byte(readme), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		git(t, workDir, "", "add", cardFile)
+		git(t, workDir, "", "commit", "--allow-empty", "-m", "Update card")
+		return strings.TrimSpace(git(t, workDir, "", "rev-parse", "HEAD"))
+	}
+	// push runs the hook on a push of rev to main, built as a client would send it.
+	push := func(repoName, oldRev, rev string) error {
+		t.Helper()
+		pack := git(t, workDir, rev+"\n", "pack-objects", "--stdout", "--revs")
+		line := fmt.Sprintf("%s %s refs/heads/main\x00report-status\n", oldRev, rev)
+		input := fmt.Sprintf("%04x%s0000%s", len(line)+4, line, pack)
+		updates, replay := receive.ParseRefUpdates(strings.NewReader(input), repoDir)
+		q, err := receive.NewQuarantine(t.Context(), repoDir, replay, updates)
+		if err != nil {
+			t.Fatalf("NewQuarantine: %v", err)
+		}
+		defer q.Close()
+		return ValidateCardsHook(t.Context(), repoName, q, updates)
+	}
+
+	invalid := commit("---\nlicense: my-license\n---\n")
+	err := push("user/model", receive.ZeroHash, invalid)
+	if err == nil || !strings.Contains(err.Error(), `line 2: unknown license "my-license"`) {
+		t.Fatalf("expected an invalid card to be rejected, got %v", err)
+	}
+
+	// A card left unchanged is not validated
+	git(t, workDir, "", "commit", "--allow-empty", "-m", "Unrelated change")
+	head := strings.TrimSpace(git(t, workDir, "", "rev-parse", "HEAD"))
+	if err := push("user/model", invalid, head); err != nil {
+		t.Fatalf("expected a push not changing the card to be accepted, got %v", err)
+	}
+
+	// Cards are validated for the type of the repository
+	configs := commit("---\nconfigs:\n- data_files: train.csv\n---\n")
+	if err := push("user/model", receive.ZeroHash, configs); err != nil {
+		t.Fatalf("expected the configs of a model card not to be validated, got %v", err)
+	}
+	if err := push("datasets/user/data", receive.ZeroHash, configs); err == nil {
+		t.Fatalf("expected invalid configs of a dataset card to be rejected")
+	}
+
+	valid := commit("---\nlicense: mit\n---\n# Model\n")
+	if err := push("user/model", receive.ZeroHash, valid); err != nil {
+		t.Fatalf("expected a valid card to be accepted, got %v", err)
+	}
+}
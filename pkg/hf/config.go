@@ -10,7 +10,7 @@ import (
 type QuantizationConfig struct {
 	// QuantMethod is the quantization type identifier (e.g. "fp8", "int4", "awq").
 	// It is appended as a plain tag to the repo's tag list when non-empty.
-	QuantMethod string `json:"quant_method"`
+	QuantMethod string `json:"quant_method,omitempty"`
 }
 
 // ConfigData holds fields extracted from a model's config.json that contribute
@@ -26,6 +26,14 @@ type ConfigData struct {
 	// It is appended as a plain tag to the repo's tag list.
 	ModelType string `json:"model_type"`
 
+	// Architectures lists the classes of the model in transformers (e.g. "LlamaForCausalLM"),
+	// which tell the task of the model and the auto class it is loaded with.
+	Architectures []string `json:"architectures"`
+
+	// Architecture is the architecture of a timm model (e.g. "resnet50"), which
+	// names it in a single field instead of Architectures.
+	Architecture string `json:"architecture"`
+
 	// QuantizationConfig holds quantization-related metadata. When present and
 	// its QuantType is non-empty, the quant_type value is appended as a plain tag
 	// (e.g. "fp8").
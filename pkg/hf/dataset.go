@@ -0,0 +1,529 @@
+package hf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+)
+
+// ErrInvalidDatasetCard is returned when the configs or dataset_info of a dataset card cannot be parsed.
+var ErrInvalidDatasetCard = errors.New("invalid dataset card")
+
+// DatasetCard holds the sections of a dataset card describing its configurations.
+// They are parsed apart from Card, so that malformed configs do not prevent reading the rest of the card.
+type DatasetCard struct {
+	// Configs tell the data files of each configuration of the dataset.
+	Configs []DatasetConfig `yaml:"configs,omitempty"`
+	// DatasetInfo describes the features and splits of each configuration.
+	DatasetInfo DatasetInfos `yaml:"dataset_info,omitempty"`
+}
+
+// DatasetConfig is a configuration of a dataset, listed in the "configs" field of its card.
+type DatasetConfig struct {
+	ConfigName string `yaml:"config_name"`
+	Default    bool   `yaml:"default,omitempty"`
+	// DataFiles are the patterns of the data files of each split, relative to DataDir.
+	// When empty, the data files under DataDir are detected by the conventions of the Hub.
+	DataFiles DataFiles `yaml:"data_files,omitempty"`
+	DataDir   string    `yaml:"data_dir,omitempty"`
+}
+
+// DataFiles are the patterns of the data files of the splits of a configuration. In a card,
+// they are a pattern or a list of patterns of the files of the "train" split, or a list of
+// splits with the patterns of their files.
+type DataFiles []SplitPatterns
+
+// SplitPatterns are the patterns of the data files of a split.
+type SplitPatterns struct {
+	Split string        `yaml:"split"`
+	Path  StringOrSlice `yaml:"path"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (d *DataFiles) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*d = DataFiles{{Split: "train", Path: StringOrSlice{value.Value}}}
+		return nil
+	}
+	if value.Kind != yaml.SequenceNode {
+		return fmt.Errorf("cannot unmarshal %v into DataFiles", value.Tag)
+	}
+	var patterns StringOrSlice
+	var splits []SplitPatterns
+	for _, item := range value.Content {
+		if item.Kind == yaml.ScalarNode {
+			patterns = append(patterns, item.Value)
+			continue
+		}
+		var split SplitPatterns
+		if err := item.Decode(&split); err != nil {
+			return err
+		}
+		splits = append(splits, split)
+	}
+	if len(patterns) != 0 && len(splits) != 0 {
+		return fmt.Errorf("data_files mixes patterns and splits")
+	}
+	if len(patterns) != 0 {
+		splits = []SplitPatterns{{Split: "train", Path: patterns}}
+	}
+	*d = splits
+	return nil
+}
+
+// DatasetInfos are the descriptions of the configurations of a dataset, written in the card
+// as a single mapping or as a list of them.
+type DatasetInfos []DatasetInfo
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (d *DatasetInfos) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.MappingNode {
+		var info DatasetInfo
+		if err := value.Decode(&info); err != nil {
+			return err
+		}
+		*d = DatasetInfos{info}
+		return nil
+	}
+	var infos []DatasetInfo
+	if err := value.Decode(&infos); err != nil {
+		return err
+	}
+	*d = infos
+	return nil
+}
+
+// DatasetInfo describes the features and splits of a configuration of a dataset.
+type DatasetInfo struct {
+	ConfigName   string      `yaml:"config_name,omitempty"`
+	Features     any         `yaml:"features,omitempty"`
+	Splits       []SplitInfo `yaml:"splits,omitempty"`
+	DownloadSize int64       `yaml:"download_size,omitempty"`
+	DatasetSize  int64       `yaml:"dataset_size,omitempty"`
+}
+
+// SplitInfo describes a split of a configuration of a dataset.
+type SplitInfo struct {
+	Name        string `yaml:"name"`
+	NumBytes    int64  `yaml:"num_bytes,omitempty"`
+	NumExamples int64  `yaml:"num_examples,omitempty"`
+}
+
+// ParseDatasetCard reads the configs and dataset_info sections of the front matter of a dataset card.
+// A README.md without front matter yields an empty DatasetCard.
+func ParseDatasetCard(r io.Reader) (*DatasetCard, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var card DatasetCard
+	if fm, _ := extractFrontMatterAndBody(data); fm != nil {
+		if err := yaml.Unmarshal(fm, &card); err != nil {
+			return nil, fmt.Errorf("failed to parse dataset card: %w", err)
+		}
+	}
+	return &card, nil
+}
+
+// ReadDatasetCard reads the dataset card of the repository at rev. It returns nil without a card.
+func ReadDatasetCard(repo *repository.Repository, rev string) (*DatasetCard, error) {
+	blob, err := repo.Blob(rev, "README.md")
+	if err != nil {
+		return nil, nil
+	}
+	rc, err := blob.NewReader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dataset card: %w", err)
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+	card, err := ParseDatasetCard(rc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDatasetCard, err)
+	}
+	return card, nil
+}
+
+// ReadDataFiles lists the files of the repository at rev the data files of a dataset are resolved from.
+// The size of LFS files is the size of their object, not of their pointer.
+func ReadDataFiles(repo *repository.Repository, rev string) ([]DataFile, error) {
+	entries, err := repo.Tree(rev, "", &repository.TreeOptions{Recursive: true})
+	if err != nil {
+		return nil, err
+	}
+	var files []DataFile
+	for _, entry := range entries {
+		if entry.Type() != repository.EntryTypeFile {
+			continue
+		}
+		blob, err := entry.Blob()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %q: %w", entry.Path(), err)
+		}
+		size := blob.Size()
+		if ptr, _ := blob.LFSPointer(); ptr != nil {
+			size = ptr.Size()
+		}
+		files = append(files, DataFile{Path: entry.Path(), Size: size})
+	}
+	return files, nil
+}
+
+// DataFile is a file of a dataset repository.
+type DataFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// DatasetConfigInfo describes a configuration of a dataset with its resolved data files.
+type DatasetConfigInfo struct {
+	ConfigName string `json:"config_name"`
+	Default    bool   `json:"default,omitempty"`
+	// Format is the builder of the data files: "parquet", "arrow", "json" or "csv".
+	Format       string         `json:"format,omitempty"`
+	DataDir      string         `json:"data_dir,omitempty"`
+	Splits       []DatasetSplit `json:"splits"`
+	Features     any            `json:"features,omitempty"`
+	DownloadSize int64          `json:"download_size,omitempty"`
+	DatasetSize  int64          `json:"dataset_size,omitempty"`
+}
+
+// DatasetSplit describes a split of a configuration of a dataset with its resolved data files.
+type DatasetSplit struct {
+	Split string `json:"split"`
+	// Patterns are the patterns the files of the split are resolved from.
+	Patterns []string   `json:"patterns"`
+	Files    []DataFile `json:"files"`
+	// Size is the total size of the files of the split.
+	Size        int64 `json:"size"`
+	NumBytes    int64 `json:"num_bytes,omitempty"`
+	NumExamples int64 `json:"num_examples,omitempty"`
+}
+
+// dataFileFormats maps the extensions of data files to the builder that loads them.
+var dataFileFormats = map[string]string{
+	".parquet": "parquet",
+	".arrow":   "arrow",
+	".jsonl":   "json",
+	".json":    "json",
+	".csv":     "csv",
+	".tsv":     "csv",
+}
+
+// formatOrder breaks ties between formats with as many files.
+var formatOrder = []string{"parquet", "arrow", "json", "csv"}
+
+// splitKeywords are the words naming the standard splits in the paths of data files.
+var splitKeywords = []struct {
+	split    string
+	keywords []string
+}{
+	{"train", []string{"train", "training"}},
+	{"validation", []string{"validation", "valid", "dev", "val"}},
+	{"test", []string{"test", "testing", "eval", "evaluation"}},
+}
+
+// The patterns of the conventions of the Hub telling the split of data files from their path,
+// with the keyword of the split in place of {keyword}. Keywords are separated from the rest
+// of a name by a character that is not a letter.
+var (
+	splitInDirNamePatterns = []string{
+		"**/{keyword}/**",
+		"**/{keyword}[-._ 0-9]*/**",
+		"**/*[-._ 0-9]{keyword}/**",
+		"**/*[-._ 0-9]{keyword}[-._ 0-9]*/**",
+	}
+	splitInFileNamePatterns = []string{
+		"**/{keyword}[-._ 0-9]*",
+		"**/*[-._ 0-9]{keyword}[-._ 0-9]*",
+	}
+)
+
+// shardedSplitPattern is the pattern of the files written by push_to_hub, which name splits of any name.
+const shardedSplitPattern = "data/{split}-[0-9][0-9][0-9][0-9][0-9]-of-[0-9][0-9][0-9][0-9][0-9]*.*"
+
+var reShardedSplit = regexp.MustCompile(`^data/(\w+)-\d{5}-of-\d{5}[^/]*\.[^/]*$`)
+
+// ResolveConfigs returns the configurations of the dataset with the given files, as told by
+// the configs of the card, or detected by the conventions of the Hub when the card has none.
+// A nil card is a card without configs.
+func (c *DatasetCard) ResolveConfigs(files []DataFile) []DatasetConfigInfo {
+	files = slices.DeleteFunc(slices.Clone(files), func(f DataFile) bool {
+		return isHiddenPath(f.Path)
+	})
+
+	var configs []DatasetConfig
+	var infos DatasetInfos
+	if c != nil {
+		configs = c.Configs
+		infos = c.DatasetInfo
+	}
+	if len(configs) == 0 {
+		configs = []DatasetConfig{{ConfigName: "default"}}
+	}
+
+	result := make([]DatasetConfigInfo, 0, len(configs))
+	for _, config := range configs {
+		info := DatasetConfigInfo{
+			ConfigName: config.ConfigName,
+			Default:    config.Default || len(configs) == 1,
+			DataDir:    config.DataDir,
+		}
+		if config.DataFiles == nil {
+			info.Splits = detectSplits(underDir(files, config.DataDir), config.DataDir)
+		} else {
+			info.Splits = resolveSplits(files, config.DataFiles, config.DataDir)
+		}
+		if len(info.Splits) == 0 {
+			continue
+		}
+		info.Format = mostCommonFormat(splitFiles(info.Splits))
+		info.describe(infos)
+		result = append(result, info)
+	}
+	return result
+}
+
+// describe fills the configuration with its features and sizes from the dataset_info of the card.
+func (c *DatasetConfigInfo) describe(infos DatasetInfos) {
+	for _, info := range infos {
+		if info.ConfigName != c.ConfigName && (info.ConfigName != "" || c.ConfigName != "default") {
+			continue
+		}
+		c.Features = info.Features
+		c.DownloadSize = info.DownloadSize
+		c.DatasetSize = info.DatasetSize
+		for i := range c.Splits {
+			for _, split := range info.Splits {
+				if split.Name == c.Splits[i].Split {
+					c.Splits[i].NumBytes = split.NumBytes
+					c.Splits[i].NumExamples = split.NumExamples
+				}
+			}
+		}
+		return
+	}
+}
+
+// resolveSplits resolves the patterns of the splits of a configuration, relative to dataDir.
+func resolveSplits(files []DataFile, dataFiles DataFiles, dataDir string) []DatasetSplit {
+	var splits []DatasetSplit
+	for _, sp := range dataFiles {
+		split := DatasetSplit{Split: sp.Split, Files: []DataFile{}}
+		for _, pattern := range sp.Path {
+			if dataDir != "" {
+				pattern = path.Join(dataDir, pattern)
+			}
+			split.Patterns = append(split.Patterns, pattern)
+			split.add(matchFiles(files, pattern))
+		}
+		splits = append(splits, split)
+	}
+	return splits
+}
+
+// detectSplits detects the splits of data files by the conventions of the Hub, which only
+// consider the files of the most common format. Files not telling a split are all in the "train" split.
+func detectSplits(files []DataFile, dataDir string) []DatasetSplit {
+	format := mostCommonFormat(files)
+	if format == "" {
+		return nil
+	}
+	files = slices.DeleteFunc(slices.Clone(files), func(f DataFile) bool {
+		return dataFileFormats[path.Ext(f.Path)] != format
+	})
+	prefix := ""
+	if dataDir != "" {
+		prefix = strings.TrimSuffix(dataDir, "/") + "/"
+	}
+
+	// Files written by push_to_hub
+	var sharded []string
+	for _, f := range files {
+		if m := reShardedSplit.FindStringSubmatch(strings.TrimPrefix(f.Path, prefix)); m != nil && !slices.Contains(sharded, m[1]) {
+			sharded = append(sharded, m[1])
+		}
+	}
+	if len(sharded) != 0 {
+		var splits []DatasetSplit
+		for _, name := range sharded {
+			pattern := prefix + strings.ReplaceAll(shardedSplitPattern, "{split}", name)
+			split := DatasetSplit{Split: name, Patterns: []string{pattern}}
+			split.add(matchFiles(files, pattern))
+			splits = append(splits, split)
+		}
+		sortSplits(splits)
+		return splits
+	}
+
+	for _, basePatterns := range [][]string{splitInDirNamePatterns, splitInFileNamePatterns} {
+		var splits []DatasetSplit
+		for _, sk := range splitKeywords {
+			split := DatasetSplit{Split: sk.split}
+			for _, keyword := range sk.keywords {
+				for _, base := range basePatterns {
+					pattern := prefix + strings.ReplaceAll(base, "{keyword}", keyword)
+					if matched := matchFiles(files, pattern); len(matched) != 0 {
+						split.Patterns = append(split.Patterns, pattern)
+						split.add(matched)
+					}
+				}
+			}
+			if len(split.Files) != 0 {
+				splits = append(splits, split)
+			}
+		}
+		if len(splits) != 0 {
+			return splits
+		}
+	}
+
+	split := DatasetSplit{Split: "train", Patterns: []string{prefix + "**"}}
+	split.add(files)
+	return []DatasetSplit{split}
+}
+
+// add adds files to the split, skipping those it already has.
+func (s *DatasetSplit) add(files []DataFile) {
+	for _, f := range files {
+		if !slices.ContainsFunc(s.Files, func(g DataFile) bool { return g.Path == f.Path }) {
+			s.Files = append(s.Files, f)
+			s.Size += f.Size
+		}
+	}
+}
+
+// sortSplits sorts the standard splits first, in the order of splitKeywords, then the others by name.
+func sortSplits(splits []DatasetSplit) {
+	rank := func(name string) int {
+		for i, sk := range splitKeywords {
+			if sk.split == name {
+				return i
+			}
+		}
+		return len(splitKeywords)
+	}
+	sort.SliceStable(splits, func(i, j int) bool {
+		ri, rj := rank(splits[i].Split), rank(splits[j].Split)
+		if ri != rj {
+			return ri < rj
+		}
+		return splits[i].Split < splits[j].Split
+	})
+}
+
+// mostCommonFormat returns the format of most of the data files, or an empty string if there are none.
+func mostCommonFormat(files []DataFile) string {
+	counts := map[string]int{}
+	for _, f := range files {
+		if format, ok := dataFileFormats[path.Ext(f.Path)]; ok {
+			counts[format]++
+		}
+	}
+	best := ""
+	for _, format := range formatOrder {
+		if counts[format] > counts[best] {
+			best = format
+		}
+	}
+	return best
+}
+
+func splitFiles(splits []DatasetSplit) []DataFile {
+	var files []DataFile
+	for _, s := range splits {
+		files = append(files, s.Files...)
+	}
+	return files
+}
+
+func underDir(files []DataFile, dir string) []DataFile {
+	if dir == "" {
+		return files
+	}
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	var under []DataFile
+	for _, f := range files {
+		if strings.HasPrefix(f.Path, prefix) {
+			under = append(under, f)
+		}
+	}
+	return under
+}
+
+// matchFiles returns the files whose path matches a glob pattern.
+func matchFiles(files []DataFile, pattern string) []DataFile {
+	re, err := globToRegexp(pattern)
+	if err != nil {
+		return nil
+	}
+	var matched []DataFile
+	for _, f := range files {
+		if re.MatchString(f.Path) {
+			matched = append(matched, f)
+		}
+	}
+	return matched
+}
+
+// globToRegexp converts a glob pattern of data files to a regular expression. As in the
+// datasets library, "*" and "?" do not match "/", while "**" matches any number of directories.
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 3
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i += 2
+		case c == '*':
+			b.WriteString("[^/]*")
+			i++
+		case c == '?':
+			b.WriteString("[^/]")
+			i++
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end <= 0 {
+				b.WriteString(`\[`)
+				i++
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 2
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+			i++
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// isHiddenPath reports whether a path is in or of a hidden file or directory,
+// which are never data files.
+func isHiddenPath(p string) bool {
+	for _, part := range strings.Split(p, "/") {
+		if strings.HasPrefix(part, ".") || strings.HasPrefix(part, "__") {
+			return true
+		}
+	}
+	return false
+}
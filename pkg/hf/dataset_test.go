@@ -0,0 +1,198 @@
+package hf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDatasetCardResolveConfigs(t *testing.T) {
+	type split struct {
+		name  string
+		files []string
+	}
+	tests := []struct {
+		name   string
+		card   string
+		files  []string
+		format string
+		splits []split
+	}{
+		{
+			name:   "push_to_hub shards",
+			files:  []string{"README.md", "data/train-00000-of-00002.parquet", "data/train-00001-of-00002.parquet", "data/test-00000-of-00001.parquet", "data/extra-00000-of-00001.parquet"},
+			format: "parquet",
+			splits: []split{
+				{"train", []string{"data/train-00000-of-00002.parquet", "data/train-00001-of-00002.parquet"}},
+				{"test", []string{"data/test-00000-of-00001.parquet"}},
+				{"extra", []string{"data/extra-00000-of-00001.parquet"}},
+			},
+		},
+		{
+			name:   "split in directory name",
+			files:  []string{"train/a.jsonl", "train/b.jsonl", "dev/a.jsonl", "notes.csv"},
+			format: "json",
+			splits: []split{
+				{"train", []string{"train/a.jsonl", "train/b.jsonl"}},
+				{"validation", []string{"dev/a.jsonl"}},
+			},
+		},
+		{
+			name:   "split in file name",
+			files:  []string{"my_train.csv", "my_test.csv", "pretraining.csv", ".hidden/train.csv"},
+			format: "csv",
+			splits: []split{
+				{"train", []string{"my_train.csv"}},
+				{"test", []string{"my_test.csv"}},
+			},
+		},
+		{
+			name:   "no split",
+			files:  []string{"a.arrow", "sub/b.arrow"},
+			format: "arrow",
+			splits: []split{{"train", []string{"a.arrow", "sub/b.arrow"}}},
+		},
+		{
+			name:  "no data files",
+			files: []string{"README.md", "script.py"},
+		},
+		{
+			name: "configs of the card",
+			card: `---
+configs:
+- config_name: main
+  data_files:
+  - split: train
+    path: "data/*.csv"
+  - split: test
+    path: [holdout.csv]
+dataset_info:
+  config_name: main
+  splits:
+  - name: train
+    num_examples: 10
+---
+`,
+			files:  []string{"data/a.csv", "data/sub/b.csv", "holdout.csv"},
+			format: "csv",
+			splits: []split{
+				{"train", []string{"data/a.csv"}},
+				{"test", []string{"holdout.csv"}},
+			},
+		},
+		{
+			name:   "data_dir of the card",
+			card:   "---\nconfigs:\n- config_name: en\n  data_dir: en\n---\n",
+			files:  []string{"en/train.parquet", "en/test.parquet", "fr/train.parquet"},
+			format: "parquet",
+			splits: []split{
+				{"train", []string{"en/train.parquet"}},
+				{"test", []string{"en/test.parquet"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			card, err := ParseDatasetCard(strings.NewReader(tt.card))
+			if err != nil {
+				t.Fatalf("ParseDatasetCard: %v", err)
+			}
+			var files []DataFile
+			for _, f := range tt.files {
+				files = append(files, DataFile{Path: f, Size: 1})
+			}
+			configs := card.ResolveConfigs(files)
+			if tt.splits == nil {
+				if len(configs) != 0 {
+					t.Fatalf("expected no configs, got %+v", configs)
+				}
+				return
+			}
+			if len(configs) != 1 {
+				t.Fatalf("expected 1 config, got %+v", configs)
+			}
+			if configs[0].Format != tt.format {
+				t.Errorf("expected format %q, got %q", tt.format, configs[0].Format)
+			}
+			var got []split
+			for _, s := range configs[0].Splits {
+				var paths []string
+				for _, f := range s.Files {
+					paths = append(paths, f.Path)
+				}
+				got = append(got, split{s.Split, paths})
+				if s.Size != int64(len(paths)) {
+					t.Errorf("expected size %d for split %q, got %d", len(paths), s.Split, s.Size)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.splits) {
+				t.Errorf("expected splits %v, got %v", tt.splits, got)
+			}
+		})
+	}
+}
+
+func TestParseDatasetCard(t *testing.T) {
+	card, err := ParseDatasetCard(strings.NewReader(`---
+configs:
+- config_name: default
+  data_files: data/*.parquet
+dataset_info:
+- config_name: default
+  features:
+  - name: text
+    dtype: string
+  splits:
+  - name: train
+    num_bytes: 100
+    num_examples: 3
+  dataset_size: 100
+---
+`))
+	if err != nil {
+		t.Fatalf("ParseDatasetCard: %v", err)
+	}
+	want := DataFiles{{Split: "train", Path: StringOrSlice{"data/*.parquet"}}}
+	if len(card.Configs) != 1 || !reflect.DeepEqual(card.Configs[0].DataFiles, want) {
+		t.Errorf("unexpected configs %+v", card.Configs)
+	}
+
+	configs := card.ResolveConfigs([]DataFile{{Path: "data/x.parquet", Size: 7}})
+	if len(configs) != 1 || configs[0].DatasetSize != 100 || configs[0].Features == nil {
+		t.Fatalf("unexpected configs %+v", configs)
+	}
+	if s := configs[0].Splits[0]; s.NumBytes != 100 || s.NumExamples != 3 || s.Size != 7 {
+		t.Errorf("unexpected split %+v", s)
+	}
+
+	if _, err := ParseDatasetCard(strings.NewReader("---\nconfigs:\n- data_files: [a.csv, {split: test, path: b.csv}]\n---\n")); err == nil {
+		t.Errorf("expected data_files mixing patterns and splits to be rejected")
+	}
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"data/*.csv", "data/a.csv", true},
+		{"data/*.csv", "data/sub/a.csv", false},
+		{"data/**", "data/sub/a.csv", true},
+		{"**/train[-._ 0-9]*", "train.csv", true},
+		{"**/train[-._ 0-9]*", "a/b/train-0.csv", true},
+		{"**/train[-._ 0-9]*", "pretrain.csv", false},
+		{"file?.json", "file1.json", true},
+		{"[!a]*.json", "a.json", false},
+		{"a+b[.csv", "a+b[.csv", true},
+	}
+	for _, tt := range tests {
+		re, err := globToRegexp(tt.pattern)
+		if err != nil {
+			t.Fatalf("globToRegexp(%q): %v", tt.pattern, err)
+		}
+		if got := re.MatchString(tt.path); got != tt.match {
+			t.Errorf("expected %q matching %q to be %v", tt.pattern, tt.path, tt.match)
+		}
+	}
+}
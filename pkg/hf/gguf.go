@@ -0,0 +1,315 @@
+package hf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// MaxGGUFHeaderSize is the largest GGUF header read. The header holds the metadata,
+// including the vocabulary of the tokenizer, and the descriptions of the tensors.
+const MaxGGUFHeaderSize = 64 << 20
+
+// ggufMaxDims is the largest number of dimensions of a GGUF tensor.
+const ggufMaxDims = 4
+
+// ggufMaxArrayDepth is the deepest nesting of GGUF metadata arrays read.
+const ggufMaxArrayDepth = 8
+
+// ggufMagic is the "GGUF" magic number at the start of GGUF files, read as a little-endian integer.
+const ggufMagic = 0x46554747
+
+// ErrNotGGUF is returned for files that are not GGUF files of a supported version.
+var ErrNotGGUF = errors.New("not a GGUF file")
+
+// GGUF metadata value types.
+const (
+	ggufTypeUint8 uint32 = iota
+	ggufTypeInt8
+	ggufTypeUint16
+	ggufTypeInt16
+	ggufTypeUint32
+	ggufTypeInt32
+	ggufTypeFloat32
+	ggufTypeBool
+	ggufTypeString
+	ggufTypeArray
+	ggufTypeUint64
+	ggufTypeInt64
+	ggufTypeFloat64
+)
+
+// ggufFileTypes names the values of "general.file_type", the type most tensors of the file are quantized to.
+//
+// Reference: https://github.com/ggml-org/llama.cpp/blob/master/include/llama.h (llama_ftype)
+var ggufFileTypes = map[int64]string{
+	0:  "F32",
+	1:  "F16",
+	2:  "Q4_0",
+	3:  "Q4_1",
+	7:  "Q8_0",
+	8:  "Q5_0",
+	9:  "Q5_1",
+	10: "Q2_K",
+	11: "Q3_K_S",
+	12: "Q3_K_M",
+	13: "Q3_K_L",
+	14: "Q4_K_S",
+	15: "Q4_K_M",
+	16: "Q5_K_S",
+	17: "Q5_K_M",
+	18: "Q6_K",
+	19: "IQ2_XXS",
+	20: "IQ2_XS",
+	21: "Q2_K_S",
+	22: "IQ3_XS",
+	23: "IQ3_XXS",
+	24: "IQ1_S",
+	25: "IQ4_NL",
+	26: "IQ3_S",
+	27: "IQ3_M",
+	28: "IQ2_S",
+	29: "IQ2_M",
+	30: "IQ4_XS",
+	31: "IQ1_M",
+	32: "BF16",
+	36: "TQ1_0",
+	37: "TQ2_0",
+}
+
+// GGUF holds the header of a GGUF file, the format llama.cpp stores models in.
+//
+// Reference: https://github.com/ggml-org/ggml/blob/master/docs/gguf.md
+type GGUF struct {
+	// Version is the version of the format. Versions 2 and 3 are supported.
+	Version uint32
+
+	// TensorCount is the number of tensors of the file.
+	TensorCount uint64
+
+	// Metadata holds the scalar metadata values by key. Arrays, such as the
+	// vocabulary of the tokenizer, are skipped.
+	Metadata map[string]any
+
+	// Parameters is the number of parameters of the tensors of the file.
+	Parameters int64
+}
+
+// ParseGGUF reads the header of a GGUF file: its metadata and the descriptions of its tensors.
+// Nothing past the header is read, and at most MaxGGUFHeaderSize bytes are.
+func ParseGGUF(r io.Reader) (*GGUF, error) {
+	d := &ggufDecoder{r: bufio.NewReader(io.LimitReader(r, MaxGGUFHeaderSize))}
+
+	if magic := d.uint32(); d.err != nil || magic != ggufMagic {
+		return nil, ErrNotGGUF
+	}
+	g := &GGUF{Version: d.uint32()}
+	if d.err == nil && g.Version != 2 && g.Version != 3 {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrNotGGUF, g.Version)
+	}
+	g.TensorCount = d.uint64()
+	kvCount := d.uint64()
+	if d.err != nil {
+		return nil, fmt.Errorf("failed to read GGUF header: %w", d.err)
+	}
+
+	g.Metadata = map[string]any{}
+	for i := uint64(0); i < kvCount && d.err == nil; i++ {
+		key := d.string()
+		typ := d.uint32()
+		if typ == ggufTypeArray {
+			d.skipArray(0)
+			continue
+		}
+		if value := d.value(typ); d.err == nil {
+			g.Metadata[key] = value
+		}
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("failed to read GGUF metadata: %w", d.err)
+	}
+
+	for i := uint64(0); i < g.TensorCount && d.err == nil; i++ {
+		d.skipString() // name
+		dims := d.uint32()
+		if d.err == nil && dims > ggufMaxDims {
+			d.err = fmt.Errorf("tensor has %d dimensions", dims)
+		}
+		n := int64(1)
+		for j := uint32(0); j < dims && d.err == nil; j++ {
+			dim := d.uint64()
+			if dim != 0 && uint64(n) > math.MaxInt64/dim {
+				d.err = errors.New("tensor size overflows")
+				break
+			}
+			n *= int64(dim)
+		}
+		d.uint32() // type
+		d.uint64() // offset
+		if d.err == nil && g.Parameters > math.MaxInt64-n {
+			d.err = errors.New("parameter count overflows")
+		}
+		g.Parameters += n
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("failed to read GGUF tensors: %w", d.err)
+	}
+	return g, nil
+}
+
+// Architecture returns the architecture of the model, such as "llama".
+func (g *GGUF) Architecture() string {
+	s, _ := g.Metadata["general.architecture"].(string)
+	return s
+}
+
+// ContextLength returns the context length the model was trained with.
+func (g *GGUF) ContextLength() int64 {
+	return g.int(g.Architecture() + ".context_length")
+}
+
+// FileType returns the type most tensors are quantized to, such as "Q4_K_M",
+// or an empty string when the file does not tell.
+func (g *GGUF) FileType() string {
+	if _, ok := g.Metadata["general.file_type"]; !ok {
+		return ""
+	}
+	return ggufFileTypes[g.int("general.file_type")]
+}
+
+// ChatTemplate returns the chat template of the tokenizer.
+func (g *GGUF) ChatTemplate() string {
+	s, _ := g.Metadata["tokenizer.chat_template"].(string)
+	return s
+}
+
+// SplitCount returns the number of files the model is split into, or 0 when it is not split.
+func (g *GGUF) SplitCount() int64 {
+	return g.int("split.count")
+}
+
+// int returns an integer metadata value, whatever its integer type.
+func (g *GGUF) int(key string) int64 {
+	switch v := g.Metadata[key].(type) {
+	case uint8:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	case int64:
+		return v
+	}
+	return 0
+}
+
+// ggufDecoder reads little-endian GGUF values, keeping the first error.
+type ggufDecoder struct {
+	r   *bufio.Reader
+	err error
+	buf [8]byte
+}
+
+func (d *ggufDecoder) read(n int) []byte {
+	if d.err != nil {
+		return d.buf[:n]
+	}
+	_, d.err = io.ReadFull(d.r, d.buf[:n])
+	return d.buf[:n]
+}
+
+func (d *ggufDecoder) uint8() uint8   { return d.read(1)[0] }
+func (d *ggufDecoder) uint16() uint16 { return binary.LittleEndian.Uint16(d.read(2)) }
+func (d *ggufDecoder) uint32() uint32 { return binary.LittleEndian.Uint32(d.read(4)) }
+func (d *ggufDecoder) uint64() uint64 { return binary.LittleEndian.Uint64(d.read(8)) }
+
+func (d *ggufDecoder) length() int64 {
+	n := d.uint64()
+	if d.err == nil && n > MaxGGUFHeaderSize {
+		d.err = fmt.Errorf("length %d exceeds the header size", n)
+	}
+	return int64(n)
+}
+
+func (d *ggufDecoder) string() string {
+	n := d.length()
+	if d.err != nil {
+		return ""
+	}
+	b := make([]byte, n)
+	_, d.err = io.ReadFull(d.r, b)
+	return string(b)
+}
+
+func (d *ggufDecoder) skipString() {
+	n := d.length()
+	if d.err != nil {
+		return
+	}
+	_, d.err = d.r.Discard(int(n))
+}
+
+func (d *ggufDecoder) value(typ uint32) any {
+	switch typ {
+	case ggufTypeUint8:
+		return d.uint8()
+	case ggufTypeInt8:
+		return int8(d.uint8())
+	case ggufTypeUint16:
+		return d.uint16()
+	case ggufTypeInt16:
+		return int16(d.uint16())
+	case ggufTypeUint32:
+		return d.uint32()
+	case ggufTypeInt32:
+		return int32(d.uint32())
+	case ggufTypeFloat32:
+		return math.Float32frombits(d.uint32())
+	case ggufTypeBool:
+		return d.uint8() != 0
+	case ggufTypeString:
+		return d.string()
+	case ggufTypeUint64:
+		return d.uint64()
+	case ggufTypeInt64:
+		return int64(d.uint64())
+	case ggufTypeFloat64:
+		return math.Float64frombits(d.uint64())
+	}
+	if d.err == nil {
+		d.err = fmt.Errorf("unknown value type %d", typ)
+	}
+	return nil
+}
+
+// skipArray reads past an array value, whose type and length come first,
+// nested in depth other arrays.
+func (d *ggufDecoder) skipArray(depth int) {
+	if d.err == nil && depth >= ggufMaxArrayDepth {
+		d.err = fmt.Errorf("arrays nested deeper than %d", ggufMaxArrayDepth)
+		return
+	}
+	typ := d.uint32()
+	n := d.length()
+	for i := int64(0); i < n && d.err == nil; i++ {
+		switch typ {
+		case ggufTypeString:
+			d.skipString()
+		case ggufTypeArray:
+			d.skipArray(depth + 1)
+		default:
+			d.value(typ)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package hf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// ggufBuilder writes GGUF files for tests.
+type ggufBuilder struct {
+	kvs     int
+	tensors int
+	body    bytes.Buffer
+	infos   bytes.Buffer
+}
+
+func (b *ggufBuilder) putString(w *bytes.Buffer, s string) {
+	_ = binary.Write(w, binary.LittleEndian, uint64(len(s)))
+	w.WriteString(s)
+}
+
+func (b *ggufBuilder) kv(key string, typ uint32, value any) {
+	b.kvs++
+	b.putString(&b.body, key)
+	_ = binary.Write(&b.body, binary.LittleEndian, typ)
+	if s, ok := value.(string); ok {
+		b.putString(&b.body, s)
+		return
+	}
+	_ = binary.Write(&b.body, binary.LittleEndian, value)
+}
+
+func (b *ggufBuilder) stringArray(key string, values ...string) {
+	b.kvs++
+	b.putString(&b.body, key)
+	_ = binary.Write(&b.body, binary.LittleEndian, ggufTypeArray)
+	_ = binary.Write(&b.body, binary.LittleEndian, ggufTypeString)
+	_ = binary.Write(&b.body, binary.LittleEndian, uint64(len(values)))
+	for _, v := range values {
+		b.putString(&b.body, v)
+	}
+}
+
+func (b *ggufBuilder) tensor(name string, dims ...uint64) {
+	b.tensors++
+	b.putString(&b.infos, name)
+	_ = binary.Write(&b.infos, binary.LittleEndian, uint32(len(dims)))
+	_ = binary.Write(&b.infos, binary.LittleEndian, dims)
+	_ = binary.Write(&b.infos, binary.LittleEndian, uint32(12)) // Q4_K
+	_ = binary.Write(&b.infos, binary.LittleEndian, uint64(0))
+}
+
+func (b *ggufBuilder) bytes() []byte {
+	var out bytes.Buffer
+	_ = binary.Write(&out, binary.LittleEndian, uint32(ggufMagic))
+	_ = binary.Write(&out, binary.LittleEndian, uint32(3))
+	_ = binary.Write(&out, binary.LittleEndian, uint64(b.tensors))
+	_ = binary.Write(&out, binary.LittleEndian, uint64(b.kvs))
+	out.Write(b.body.Bytes())
+	out.Write(b.infos.Bytes())
+	return out.Bytes()
+}
+
+func TestParseGGUF(t *testing.T) {
+	var b ggufBuilder
+	b.kv("general.architecture", ggufTypeString, "llama")
+	b.kv("llama.context_length", ggufTypeUint32, uint32(4096))
+	b.kv("general.file_type", ggufTypeUint32, uint32(15))
+	b.stringArray("tokenizer.ggml.tokens", "<s>", "</s>", "hello")
+	b.kv("tokenizer.chat_template", ggufTypeString, "{{ messages }}")
+	b.kv("llama.rope.freq_base", ggufTypeFloat32, float32(10000))
+	b.tensor("token_embd.weight", 64, 3)
+	b.tensor("output_norm.weight", 64)
+	// Tensor data follows the header, and is not read.
+	data := append(b.bytes(), make([]byte, 1024)...)
+
+	g, err := ParseGGUF(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ParseGGUF: %v", err)
+	}
+	if g.Version != 3 || g.TensorCount != 2 || g.Parameters != 256 {
+		t.Errorf("unexpected header %+v", g)
+	}
+	if g.Architecture() != "llama" || g.ContextLength() != 4096 {
+		t.Errorf("unexpected architecture %q, context length %d", g.Architecture(), g.ContextLength())
+	}
+	if g.FileType() != "Q4_K_M" {
+		t.Errorf("expected file type Q4_K_M, got %q", g.FileType())
+	}
+	if g.ChatTemplate() != "{{ messages }}" {
+		t.Errorf("unexpected chat template %q", g.ChatTemplate())
+	}
+	if _, ok := g.Metadata["tokenizer.ggml.tokens"]; ok {
+		t.Errorf("expected arrays to be skipped")
+	}
+	if g.Metadata["llama.rope.freq_base"] != float32(10000) {
+		t.Errorf("unexpected value %v", g.Metadata["llama.rope.freq_base"])
+	}
+
+	if _, err := ParseGGUF(bytes.NewReader([]byte("PK\x03\x04not gguf"))); !errors.Is(err, ErrNotGGUF) {
+		t.Errorf("expected ErrNotGGUF, got %v", err)
+	}
+	if _, err := ParseGGUF(bytes.NewReader(data[:60])); err == nil {
+		t.Errorf("expected an error for a truncated header")
+	}
+
+	// Hostile headers fail instead of exhausting the stack or overflowing the counts
+	var nested ggufBuilder
+	nested.kvs++
+	nested.putString(&nested.body, "nested")
+	_ = binary.Write(&nested.body, binary.LittleEndian, ggufTypeArray)
+	for range 1 << 16 {
+		_ = binary.Write(&nested.body, binary.LittleEndian, ggufTypeArray)
+		_ = binary.Write(&nested.body, binary.LittleEndian, uint64(1))
+	}
+	if _, err := ParseGGUF(bytes.NewReader(nested.bytes())); err == nil {
+		t.Errorf("expected an error for deeply nested arrays")
+	}
+	var huge ggufBuilder
+	huge.tensor("huge", 1<<40, 1<<40)
+	if _, err := ParseGGUF(bytes.NewReader(huge.bytes())); err == nil {
+		t.Errorf("expected an error for an overflowing tensor size")
+	}
+	var wide ggufBuilder
+	wide.tensor("wide", 1, 1, 1, 1, 1)
+	if _, err := ParseGGUF(bytes.NewReader(wide.bytes())); err == nil {
+		t.Errorf("expected an error for a tensor of too many dimensions")
+	}
+}
@@ -0,0 +1,374 @@
+package hf
+
+import (
+	"encoding/json"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+)
+
+// The files telling the library of a model.
+const (
+	// ConfigFile is the configuration of transformers and timm models.
+	ConfigFile = "config.json"
+	// AdapterConfigFile is the configuration of PEFT adapters.
+	AdapterConfigFile = "adapter_config.json"
+	// ModelIndexFile lists the components of a diffusers pipeline.
+	ModelIndexFile = "model_index.json"
+	// TokenizerConfigFile is the configuration of the tokenizer of transformers models.
+	TokenizerConfigFile = "tokenizer_config.json"
+
+	sentenceTransformersModulesFile = "modules.json"
+	sentenceTransformersConfigFile  = "config_sentence_transformers.json"
+	openCLIPConfigFile              = "open_clip_config.json"
+)
+
+// AdapterConfig holds the fields of the adapter_config.json of a PEFT adapter describing what it adapts.
+type AdapterConfig struct {
+	// BaseModelNameOrPath is the ID of the model the adapter is applied to.
+	BaseModelNameOrPath string `json:"base_model_name_or_path,omitempty"`
+	// TaskType is the task the adapter was trained for (e.g. "CAUSAL_LM").
+	TaskType string `json:"task_type,omitempty"`
+	// PeftType is the method of the adapter (e.g. "LORA").
+	PeftType string `json:"peft_type,omitempty"`
+}
+
+// ParseAdapterConfig reads the adapter_config.json of a PEFT adapter.
+func ParseAdapterConfig(r io.Reader) (*AdapterConfig, error) {
+	var cfg AdapterConfig
+	if err := json.NewDecoder(r).Decode(&cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// DiffusersIndex holds the fields of the model_index.json of a diffusers pipeline describing it.
+type DiffusersIndex struct {
+	// ClassName is the class of the pipeline (e.g. "StableDiffusionXLPipeline").
+	ClassName string `json:"_class_name,omitempty"`
+}
+
+// ParseDiffusersIndex reads the model_index.json of a diffusers pipeline.
+func ParseDiffusersIndex(r io.Reader) (*DiffusersIndex, error) {
+	var index DiffusersIndex
+	if err := json.NewDecoder(r).Decode(&index); err != nil {
+		return nil, err
+	}
+	return &index, nil
+}
+
+// tokenizerConfigKeys are the fields of tokenizer_config.json exposed in the repo config.
+var tokenizerConfigKeys = []string{"bos_token", "eos_token", "pad_token", "unk_token", "chat_template"}
+
+// ParseTokenizerConfig reads the tokenizer_config.json of a transformers model, keeping
+// the special tokens and the chat template.
+func ParseTokenizerConfig(r io.Reader) (map[string]any, error) {
+	var raw map[string]any
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+	cfg := map[string]any{}
+	for _, key := range tokenizerConfigKeys {
+		if v, ok := raw[key]; ok && v != nil {
+			cfg[key] = v
+		}
+	}
+	return cfg, nil
+}
+
+// RepoConfig is the summary of the configuration files of a model the Hub returns in the
+// "config" field of model info.
+type RepoConfig struct {
+	Architectures      []string            `json:"architectures,omitempty"`
+	ModelType          string              `json:"model_type,omitempty"`
+	QuantizationConfig *QuantizationConfig `json:"quantization_config,omitempty"`
+	TokenizerConfig    map[string]any      `json:"tokenizer_config,omitempty"`
+	Peft               *AdapterConfig      `json:"peft,omitempty"`
+	Diffusers          *DiffusersIndex     `json:"diffusers,omitempty"`
+}
+
+// TransformersInfo tells how a transformers model is loaded, as the Hub returns it in the
+// "transformersInfo" field of model info.
+type TransformersInfo struct {
+	// AutoModel is the auto class the model is loaded with (e.g. "AutoModelForCausalLM").
+	AutoModel string `json:"auto_model"`
+	// PipelineTag is the task of the model.
+	PipelineTag string `json:"pipeline_tag,omitempty"`
+	// Processor is the auto class of the preprocessing of the inputs (e.g. "AutoTokenizer").
+	Processor string `json:"processor,omitempty"`
+}
+
+// Input modalities of tasks, which tell the processor of their models.
+const (
+	modalityText = iota
+	modalityImage
+	modalityAudio
+	modalityMultimodal
+)
+
+// architectureTask is the auto class and task of the architectures with a suffix.
+type architectureTask struct {
+	suffix      string
+	autoModel   string
+	pipelineTag string
+	modality    int
+}
+
+// architectureTasks maps the suffixes of transformers architectures to their auto class and task.
+// Longer suffixes come first, so that the first match is the most specific.
+var architectureTasks = []architectureTask{
+	{"ForZeroShotImageClassification", "AutoModelForZeroShotImageClassification", "zero-shot-image-classification", modalityMultimodal},
+	{"ForSequenceClassification", "AutoModelForSequenceClassification", "text-classification", modalityText},
+	{"ForTokenClassification", "AutoModelForTokenClassification", "token-classification", modalityText},
+	{"ForQuestionAnswering", "AutoModelForQuestionAnswering", "question-answering", modalityText},
+	{"ForImageClassification", "AutoModelForImageClassification", "image-classification", modalityImage},
+	{"ForSemanticSegmentation", "AutoModelForSemanticSegmentation", "image-segmentation", modalityImage},
+	{"ForAudioClassification", "AutoModelForAudioClassification", "audio-classification", modalityAudio},
+	{"ForImageTextToText", "AutoModelForImageTextToText", "image-text-to-text", modalityMultimodal},
+	{"ForMultipleChoice", "AutoModelForMultipleChoice", "", modalityText},
+	{"ForObjectDetection", "AutoModelForObjectDetection", "object-detection", modalityImage},
+	{"ForDepthEstimation", "AutoModelForDepthEstimation", "depth-estimation", modalityImage},
+	{"ForSpeechSeq2Seq", "AutoModelForSpeechSeq2Seq", "automatic-speech-recognition", modalityMultimodal},
+	{"ForPreTraining", "AutoModelForPreTraining", "", modalityText},
+	{"ForVision2Seq", "AutoModelForVision2Seq", "image-to-text", modalityMultimodal},
+	{"ForSeq2SeqLM", "AutoModelForSeq2SeqLM", "text2text-generation", modalityText},
+	{"ForCausalLM", "AutoModelForCausalLM", "text-generation", modalityText},
+	{"ForMaskedLM", "AutoModelForMaskedLM", "fill-mask", modalityText},
+	{"ForCTC", "AutoModelForCTC", "automatic-speech-recognition", modalityMultimodal},
+	{"Model", "AutoModel", "feature-extraction", modalityText},
+}
+
+// conditionalGenerationTasks are the tasks of the models with "ForConditionalGeneration" architectures,
+// by the prefix of their architecture. Other models generate text from text.
+var conditionalGenerationTasks = []architectureTask{
+	{"Whisper", "AutoModelForSpeechSeq2Seq", "automatic-speech-recognition", modalityMultimodal},
+	{"Speech2Text", "AutoModelForSpeechSeq2Seq", "automatic-speech-recognition", modalityMultimodal},
+	{"Blip", "AutoModelForVision2Seq", "image-to-text", modalityMultimodal},
+	{"Llava", "AutoModelForImageTextToText", "image-text-to-text", modalityMultimodal},
+	{"Qwen2VL", "AutoModelForImageTextToText", "image-text-to-text", modalityMultimodal},
+	{"Qwen2_5_VL", "AutoModelForImageTextToText", "image-text-to-text", modalityMultimodal},
+	{"PaliGemma", "AutoModelForImageTextToText", "image-text-to-text", modalityMultimodal},
+	{"Idefics", "AutoModelForImageTextToText", "image-text-to-text", modalityMultimodal},
+	{"Gemma3", "AutoModelForImageTextToText", "image-text-to-text", modalityMultimodal},
+	{"Mllama", "AutoModelForImageTextToText", "image-text-to-text", modalityMultimodal},
+}
+
+// peftTaskTypes maps the task types of PEFT adapters to their task.
+var peftTaskTypes = map[string]string{
+	"CAUSAL_LM":          "text-generation",
+	"SEQ_2_SEQ_LM":       "text2text-generation",
+	"SEQ_CLS":            "text-classification",
+	"TOKEN_CLS":          "token-classification",
+	"QUESTION_ANS":       "question-answering",
+	"FEATURE_EXTRACTION": "feature-extraction",
+}
+
+// ModelFiles holds the files of a model repository its library and task are inferred from,
+// when its card does not tell them.
+type ModelFiles struct {
+	// Paths are the paths of the files at the root of the repository.
+	Paths []string
+	// HasGGUF is whether the repository holds GGUF files, at any path.
+	HasGGUF bool
+
+	Config          *ConfigData
+	AdapterConfig   *AdapterConfig
+	DiffusersIndex  *DiffusersIndex
+	TokenizerConfig map[string]any
+}
+
+// ReadModelFiles reads the files of a model repository at rev its library and task are inferred from,
+// whose entries are listed recursively by repository.Repository.Tree, so that callers listing them
+// for other uses walk the tree once. Files that do not exist or cannot be parsed are left out.
+func ReadModelFiles(repo *repository.Repository, rev string, entries []*repository.TreeEntry) *ModelFiles {
+	files := &ModelFiles{
+		Config:          parseRepoFile(repo, rev, ConfigFile, ParseConfigData),
+		AdapterConfig:   parseRepoFile(repo, rev, AdapterConfigFile, ParseAdapterConfig),
+		DiffusersIndex:  parseRepoFile(repo, rev, ModelIndexFile, ParseDiffusersIndex),
+		TokenizerConfig: parseRepoFile(repo, rev, TokenizerConfigFile, ParseTokenizerConfig),
+	}
+	for _, entry := range entries {
+		if entry.Type() != repository.EntryTypeFile {
+			continue
+		}
+		if path.Dir(entry.Path()) == "." {
+			files.Paths = append(files.Paths, entry.Path())
+		}
+		if path.Ext(entry.Path()) == ".gguf" {
+			files.HasGGUF = true
+		}
+	}
+	return files
+}
+
+// parseRepoFile parses the file at name of the repository at rev, returning the zero value
+// when the file does not exist or cannot be parsed.
+func parseRepoFile[T any](repo *repository.Repository, rev, name string, parse func(io.Reader) (T, error)) T {
+	var zero T
+	blob, err := repo.Blob(rev, name)
+	if err != nil {
+		return zero
+	}
+	rc, err := blob.NewReader()
+	if err != nil {
+		return zero
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+	v, err := parse(rc)
+	if err != nil {
+		return zero
+	}
+	return v
+}
+
+func (m *ModelFiles) has(name string) bool {
+	for _, p := range m.Paths {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *ModelFiles) hasExt(ext string) bool {
+	for _, p := range m.Paths {
+		if path.Ext(p) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// LibraryName returns the library the model is loaded with, or an empty string if it is not known.
+// Libraries wrapping others come first: sentence-transformers models are also transformers models.
+func (m *ModelFiles) LibraryName() string {
+	switch {
+	case m.DiffusersIndex != nil || m.has(ModelIndexFile):
+		return "diffusers"
+	case m.has(sentenceTransformersModulesFile) || m.has(sentenceTransformersConfigFile):
+		return "sentence-transformers"
+	case m.AdapterConfig != nil || m.has(AdapterConfigFile):
+		return "peft"
+	case m.has(openCLIPConfigFile):
+		return "open_clip"
+	case m.Config != nil && m.Config.Architecture != "" && len(m.Config.Architectures) == 0 && m.Config.ModelType == "":
+		return "timm"
+	case m.Config != nil && (len(m.Config.Architectures) != 0 || m.Config.ModelType != ""):
+		return "transformers"
+	case m.HasGGUF || m.hasExt(".gguf"):
+		return "gguf"
+	}
+	return ""
+}
+
+// PipelineTag returns the task of the model, or an empty string if it is not known.
+func (m *ModelFiles) PipelineTag() string {
+	switch m.LibraryName() {
+	case "diffusers":
+		if m.DiffusersIndex != nil {
+			return diffusersTask(m.DiffusersIndex.ClassName)
+		}
+	case "sentence-transformers":
+		return "sentence-similarity"
+	case "peft":
+		if m.AdapterConfig != nil {
+			return peftTaskTypes[m.AdapterConfig.TaskType]
+		}
+	case "timm":
+		return "image-classification"
+	case "transformers":
+		if info := m.TransformersInfo(); info != nil {
+			return info.PipelineTag
+		}
+	}
+	return ""
+}
+
+// diffusersTask returns the task of a diffusers pipeline from its class.
+func diffusersTask(className string) string {
+	switch {
+	case className == "":
+		return ""
+	case strings.Contains(className, "Img2Img"), strings.Contains(className, "InstructPix2Pix"):
+		return "image-to-image"
+	case strings.Contains(className, "Inpaint"):
+		return "image-to-image"
+	case strings.Contains(className, "ImageToVideo"), strings.Contains(className, "Img2Vid"):
+		return "image-to-video"
+	case strings.Contains(className, "Video"):
+		return "text-to-video"
+	case strings.Contains(className, "Audio"):
+		return "text-to-audio"
+	default:
+		return "text-to-image"
+	}
+}
+
+// TransformersInfo returns how the model is loaded with transformers, from the first of its
+// architectures, or nil if it is not a transformers model with a known architecture.
+func (m *ModelFiles) TransformersInfo() *TransformersInfo {
+	if m.Config == nil || len(m.Config.Architectures) == 0 || m.LibraryName() != "transformers" {
+		return nil
+	}
+	arch := m.Config.Architectures[0]
+
+	var task *architectureTask
+	if strings.HasSuffix(arch, "ForConditionalGeneration") {
+		task = &architectureTask{autoModel: "AutoModelForSeq2SeqLM", pipelineTag: "text2text-generation", modality: modalityText}
+		for i, t := range conditionalGenerationTasks {
+			if strings.HasPrefix(arch, t.suffix) {
+				task = &conditionalGenerationTasks[i]
+				break
+			}
+		}
+	} else {
+		for i, t := range architectureTasks {
+			if strings.HasSuffix(arch, t.suffix) {
+				task = &architectureTasks[i]
+				break
+			}
+		}
+	}
+	if task == nil {
+		return nil
+	}
+
+	info := &TransformersInfo{
+		AutoModel:   task.autoModel,
+		PipelineTag: task.pipelineTag,
+	}
+	switch task.modality {
+	case modalityText:
+		info.Processor = "AutoTokenizer"
+	case modalityImage:
+		info.Processor = "AutoImageProcessor"
+	case modalityAudio:
+		info.Processor = "AutoFeatureExtractor"
+	case modalityMultimodal:
+		info.Processor = "AutoProcessor"
+	}
+	return info
+}
+
+// RepoConfig returns the summary of the configuration files of the model, or nil if it has none.
+func (m *ModelFiles) RepoConfig() *RepoConfig {
+	cfg := &RepoConfig{
+		TokenizerConfig: m.TokenizerConfig,
+		Peft:            m.AdapterConfig,
+		Diffusers:       m.DiffusersIndex,
+	}
+	if m.Config != nil {
+		cfg.Architectures = m.Config.Architectures
+		cfg.ModelType = m.Config.ModelType
+		cfg.QuantizationConfig = m.Config.QuantizationConfig
+	}
+	if len(cfg.Architectures) == 0 && cfg.ModelType == "" && cfg.QuantizationConfig == nil &&
+		len(cfg.TokenizerConfig) == 0 && cfg.Peft == nil && cfg.Diffusers == nil {
+		return nil
+	}
+	return cfg
+}
@@ -0,0 +1,127 @@
+package hf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestModelFiles(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       ModelFiles
+		library     string
+		pipelineTag string
+		info        *TransformersInfo
+	}{
+		{
+			name: "causal lm",
+			files: ModelFiles{
+				Paths:  []string{"config.json", "model.safetensors", "tokenizer.json"},
+				Config: &ConfigData{ModelType: "llama", Architectures: []string{"LlamaForCausalLM"}},
+			},
+			library:     "transformers",
+			pipelineTag: "text-generation",
+			info:        &TransformersInfo{AutoModel: "AutoModelForCausalLM", PipelineTag: "text-generation", Processor: "AutoTokenizer"},
+		},
+		{
+			name: "speech recognition",
+			files: ModelFiles{
+				Paths:  []string{"config.json"},
+				Config: &ConfigData{ModelType: "whisper", Architectures: []string{"WhisperForConditionalGeneration"}},
+			},
+			library:     "transformers",
+			pipelineTag: "automatic-speech-recognition",
+			info:        &TransformersInfo{AutoModel: "AutoModelForSpeechSeq2Seq", PipelineTag: "automatic-speech-recognition", Processor: "AutoProcessor"},
+		},
+		{
+			name: "text to text",
+			files: ModelFiles{
+				Paths:  []string{"config.json"},
+				Config: &ConfigData{ModelType: "t5", Architectures: []string{"T5ForConditionalGeneration"}},
+			},
+			library:     "transformers",
+			pipelineTag: "text2text-generation",
+			info:        &TransformersInfo{AutoModel: "AutoModelForSeq2SeqLM", PipelineTag: "text2text-generation", Processor: "AutoTokenizer"},
+		},
+		{
+			name: "image classification",
+			files: ModelFiles{
+				Paths:  []string{"config.json"},
+				Config: &ConfigData{ModelType: "vit", Architectures: []string{"ViTForImageClassification"}},
+			},
+			library:     "transformers",
+			pipelineTag: "image-classification",
+			info:        &TransformersInfo{AutoModel: "AutoModelForImageClassification", PipelineTag: "image-classification", Processor: "AutoImageProcessor"},
+		},
+		{
+			name: "sentence transformers",
+			files: ModelFiles{
+				Paths:  []string{"config.json", "modules.json", "1_Pooling/config.json"},
+				Config: &ConfigData{ModelType: "bert", Architectures: []string{"BertModel"}},
+			},
+			library:     "sentence-transformers",
+			pipelineTag: "sentence-similarity",
+		},
+		{
+			name: "peft adapter",
+			files: ModelFiles{
+				Paths:         []string{"adapter_config.json", "adapter_model.safetensors"},
+				AdapterConfig: &AdapterConfig{BaseModelNameOrPath: "meta-llama/Llama-2-7b", TaskType: "CAUSAL_LM"},
+			},
+			library:     "peft",
+			pipelineTag: "text-generation",
+		},
+		{
+			name: "diffusers pipeline",
+			files: ModelFiles{
+				Paths:          []string{"model_index.json"},
+				DiffusersIndex: &DiffusersIndex{ClassName: "StableDiffusionXLImg2ImgPipeline"},
+			},
+			library:     "diffusers",
+			pipelineTag: "image-to-image",
+		},
+		{
+			name: "timm",
+			files: ModelFiles{
+				Paths:  []string{"config.json", "model.safetensors"},
+				Config: &ConfigData{Architecture: "resnet50"},
+			},
+			library:     "timm",
+			pipelineTag: "image-classification",
+		},
+		{
+			name:    "gguf",
+			files:   ModelFiles{HasGGUF: true},
+			library: "gguf",
+		},
+		{
+			name:  "unknown",
+			files: ModelFiles{Paths: []string{"README.md"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.files.LibraryName(); got != tt.library {
+				t.Errorf("expected library %q, got %q", tt.library, got)
+			}
+			if got := tt.files.PipelineTag(); got != tt.pipelineTag {
+				t.Errorf("expected pipeline tag %q, got %q", tt.pipelineTag, got)
+			}
+			if got := tt.files.TransformersInfo(); !reflect.DeepEqual(got, tt.info) {
+				t.Errorf("expected transformers info %+v, got %+v", tt.info, got)
+			}
+		})
+	}
+}
+
+func TestParseTokenizerConfig(t *testing.T) {
+	cfg, err := ParseTokenizerConfig(strings.NewReader(`{"bos_token": "<s>", "eos_token": {"content": "</s>"}, "pad_token": null, "model_max_length": 4096}`))
+	if err != nil {
+		t.Fatalf("ParseTokenizerConfig: %v", err)
+	}
+	want := map[string]any{"bos_token": "<s>", "eos_token": map[string]any{"content": "</s>"}}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("expected %v, got %v", want, cfg)
+	}
+}
@@ -0,0 +1,483 @@
+package hf
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Licenses are the license identifiers the Hub accepts in the "license" field of cards.
+//
+// Reference: https://huggingface.co/docs/hub/en/repositories-licenses
+var Licenses = []string{
+	"apache-2.0", "mit", "openrail", "bigscience-openrail-m", "creativeml-openrail-m",
+	"bigscience-bloom-rail-1.0", "bigcode-openrail-m", "afl-3.0", "artistic-2.0", "bsl-1.0",
+	"bsd", "bsd-2-clause", "bsd-3-clause", "bsd-3-clause-clear", "c-uda", "cc", "cc0-1.0",
+	"cc-by-2.0", "cc-by-2.5", "cc-by-3.0", "cc-by-4.0", "cc-by-sa-3.0", "cc-by-sa-4.0",
+	"cc-by-nc-2.0", "cc-by-nc-3.0", "cc-by-nc-4.0", "cc-by-nd-4.0", "cc-by-nc-nd-3.0",
+	"cc-by-nc-nd-4.0", "cc-by-nc-sa-2.0", "cc-by-nc-sa-3.0", "cc-by-nc-sa-4.0",
+	"cdla-sharing-1.0", "cdla-permissive-1.0", "cdla-permissive-2.0", "wtfpl", "ecl-2.0",
+	"epl-1.0", "epl-2.0", "etalab-2.0", "eupl-1.1", "eupl-1.2", "agpl-3.0", "gfdl", "gpl",
+	"gpl-2.0", "gpl-3.0", "lgpl", "lgpl-2.1", "lgpl-3.0", "isc", "h-research", "intel-research",
+	"lppl-1.3c", "ms-pl", "apple-ascl", "apple-amlr", "mpl-2.0", "odc-by", "odbl", "openrail++",
+	"osl-3.0", "postgresql", "ofl-1.1", "ncsa", "unlicense", "zlib", "pddl", "lgpl-lr",
+	"deepfloyd-if-license", "fair-noncommercial-research-license", "llama2", "llama3",
+	"llama3.1", "llama3.2", "llama3.3", "llama4", "gemma", "unknown", "other",
+}
+
+// BaseModelRelations are the values of the "base_model_relation" field of model cards.
+var BaseModelRelations = []string{"adapter", "merge", "quantized", "finetune"}
+
+// reRepoID matches the ID of a Hub repository, with or without its namespace.
+var reRepoID = regexp.MustCompile(`^(?:[A-Za-z0-9][\w.-]*/)?[A-Za-z0-9][\w.-]*$`)
+
+// reYAMLErrorLine matches the line yaml.v3 reports errors at.
+var reYAMLErrorLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// reYAMLDefinedAt matches the line of the first definition of a duplicate key in yaml.v3 errors.
+var reYAMLDefinedAt = regexp.MustCompile(`already defined at line (\d+)`)
+
+// The kinds of values of the fields of cards that are type checked.
+const (
+	kindString = iota
+	kindStringOrList
+	kindList
+	kindInt
+)
+
+// cardFieldKinds are the kinds of the values of the fields of Card.
+var cardFieldKinds = map[string]int{
+	"language":             kindStringOrList,
+	"license":              kindStringOrList,
+	"license_name":         kindString,
+	"license_link":         kindString,
+	"tags":                 kindList,
+	"datasets":             kindList,
+	"library_name":         kindString,
+	"pipeline_tag":         kindString,
+	"base_model":           kindStringOrList,
+	"base_model_relation":  kindString,
+	"metrics":              kindList,
+	"new_version":          kindString,
+	"annotations_creators": kindStringOrList,
+	"language_creators":    kindStringOrList,
+	"multilinguality":      kindStringOrList,
+	"size_categories":      kindStringOrList,
+	"source_datasets":      kindList,
+	"task_categories":      kindStringOrList,
+	"task_ids":             kindStringOrList,
+	"pretty_name":          kindString,
+	"config_names":         kindStringOrList,
+	"paperswithcode_id":    kindString,
+	"title":                kindString,
+	"sdk":                  kindString,
+	"sdk_version":          kindString,
+	"app_file":             kindString,
+	"app_port":             kindInt,
+	"duplicated_from":      kindString,
+	"models":               kindList,
+}
+
+// ValidationIssue is an error or a warning found in the metadata of a card.
+type ValidationIssue struct {
+	Message string `json:"message"`
+	// Line is the line of the README the issue is at, or 0 when it is not at a line.
+	Line int `json:"line,omitempty"`
+}
+
+func (i ValidationIssue) String() string {
+	if i.Line == 0 {
+		return i.Message
+	}
+	return fmt.Sprintf("line %d: %s", i.Line, i.Message)
+}
+
+// Validation is the result of the validation of the metadata of a card.
+// A card with errors is rejected by the Hub; warnings are only reported.
+type Validation struct {
+	Errors   []ValidationIssue `json:"errors"`
+	Warnings []ValidationIssue `json:"warnings"`
+}
+
+// Err returns an error listing the errors of the validation, or nil if there are none.
+func (v *Validation) Err() error {
+	if len(v.Errors) == 0 {
+		return nil
+	}
+	msgs := make([]string, 0, len(v.Errors))
+	for _, issue := range v.Errors {
+		msgs = append(msgs, issue.String())
+	}
+	return errors.New("invalid card metadata: " + strings.Join(msgs, "; "))
+}
+
+// ValidateCard validates the YAML front matter of the README.md of a repository of the
+// given type ("model", "dataset" or "space"). Lines are reported as lines of the README.
+func ValidateCard(content []byte, repoType string) *Validation {
+	v := &cardValidator{
+		Validation: &Validation{
+			Errors:   []ValidationIssue{},
+			Warnings: []ValidationIssue{},
+		},
+		// The front matter starts after the "---" line
+		offset: 1,
+	}
+
+	fm, _ := extractFrontMatterAndBody(content)
+	if len(strings.TrimSpace(string(fm))) == 0 {
+		v.warn(0, "empty or missing yaml metadata in repo card")
+		return v.Validation
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(fm, &doc); err != nil {
+		v.yamlError(err)
+		return v.Validation
+	}
+	if len(doc.Content) == 0 {
+		v.warn(0, "empty or missing yaml metadata in repo card")
+		return v.Validation
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		v.error(root.Line, "metadata must be a mapping")
+		return v.Validation
+	}
+
+	fields := map[string]*yaml.Node{}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		fields[key.Value] = value
+		if kind, ok := cardFieldKinds[key.Value]; ok {
+			v.checkKind(key.Value, value, kind)
+		}
+	}
+
+	v.checkLicense(fields)
+	v.checkBaseModel(fields)
+	if node, ok := fields["model-index"]; ok {
+		v.checkModelIndex(node)
+	}
+	if node, ok := fields["configs"]; ok && repoType == "dataset" {
+		v.checkConfigs(node)
+	}
+
+	// Mismatches the checks above do not cover are found by decoding the card
+	if len(v.Errors) == 0 {
+		var card Card
+		if err := root.Decode(&card); err != nil {
+			v.yamlError(err)
+		}
+	}
+	return v.Validation
+}
+
+// cardValidator collects the issues of a card, converting the lines of its front matter to lines of the README.
+type cardValidator struct {
+	*Validation
+	offset int
+}
+
+func (v *cardValidator) line(line int) int {
+	if line == 0 {
+		return 0
+	}
+	return line + v.offset
+}
+
+func (v *cardValidator) error(line int, format string, args ...any) {
+	v.Errors = append(v.Errors, ValidationIssue{Message: fmt.Sprintf(format, args...), Line: v.line(line)})
+}
+
+func (v *cardValidator) warn(line int, format string, args ...any) {
+	v.Warnings = append(v.Warnings, ValidationIssue{Message: fmt.Sprintf(format, args...), Line: v.line(line)})
+}
+
+// yamlError reports the syntax or type errors of yaml.v3, which are prefixed by their line.
+func (v *cardValidator) yamlError(err error) {
+	msgs := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		msgs = typeErr.Errors
+	}
+	for _, msg := range msgs {
+		if m := reYAMLErrorLine.FindStringSubmatch(msg); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			msg := reYAMLDefinedAt.ReplaceAllStringFunc(m[2], func(s string) string {
+				defined, _ := strconv.Atoi(reYAMLDefinedAt.FindStringSubmatch(s)[1])
+				return fmt.Sprintf("already defined at line %d", v.line(defined))
+			})
+			v.error(line, "%s", msg)
+			continue
+		}
+		v.error(0, "%s", strings.TrimPrefix(msg, "yaml: "))
+	}
+}
+
+func isString(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!str"
+}
+
+func isNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
+
+func (v *cardValidator) checkKind(key string, node *yaml.Node, kind int) {
+	if isNull(node) {
+		return
+	}
+	switch kind {
+	case kindString:
+		if !isString(node) {
+			v.error(node.Line, "%q must be a string", key)
+		}
+	case kindInt:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!int" {
+			v.error(node.Line, "%q must be an integer", key)
+		}
+	case kindStringOrList, kindList:
+		if kind == kindStringOrList && node.Kind == yaml.ScalarNode {
+			if !isString(node) {
+				v.error(node.Line, "%q must be a string or a list of strings", key)
+			}
+			return
+		}
+		if node.Kind != yaml.SequenceNode {
+			if kind == kindList {
+				v.error(node.Line, "%q must be a list of strings", key)
+			} else {
+				v.error(node.Line, "%q must be a string or a list of strings", key)
+			}
+			return
+		}
+		for _, item := range node.Content {
+			if !isString(item) {
+				v.error(item.Line, "%q must only contain strings", key)
+			}
+		}
+	}
+}
+
+// stringValues returns the string values of a field that is a string or a list of strings.
+func stringValues(node *yaml.Node) []*yaml.Node {
+	if node == nil {
+		return nil
+	}
+	if isString(node) {
+		return []*yaml.Node{node}
+	}
+	var values []*yaml.Node
+	if node.Kind == yaml.SequenceNode {
+		for _, item := range node.Content {
+			if isString(item) {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
+
+func (v *cardValidator) checkLicense(fields map[string]*yaml.Node) {
+	for _, value := range stringValues(fields["license"]) {
+		if !slices.Contains(Licenses, value.Value) {
+			v.error(value.Line, "unknown license %q, use \"other\" with license_name and license_link for custom licenses", value.Value)
+			continue
+		}
+		if value.Value == "other" {
+			if _, ok := fields["license_name"]; !ok {
+				v.warn(value.Line, "license_name should be set when the license is \"other\"")
+			}
+		}
+	}
+}
+
+func (v *cardValidator) checkBaseModel(fields map[string]*yaml.Node) {
+	for _, value := range stringValues(fields["base_model"]) {
+		if !reRepoID.MatchString(value.Value) || strings.Contains(value.Value, "..") {
+			v.error(value.Line, "invalid base_model %q, it must be the ID of a model on the Hub", value.Value)
+		}
+	}
+	relation := fields["base_model_relation"]
+	if relation == nil || !isString(relation) {
+		return
+	}
+	if !slices.Contains(BaseModelRelations, relation.Value) {
+		v.error(relation.Line, "invalid base_model_relation %q, it must be one of %s", relation.Value, strings.Join(BaseModelRelations, ", "))
+	}
+	if _, ok := fields["base_model"]; !ok {
+		v.error(relation.Line, "base_model_relation is set without base_model")
+	}
+}
+
+// mappingFields returns the fields of a mapping node, or nil if the node is not a mapping.
+func mappingFields(node *yaml.Node) map[string]*yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	fields := make(map[string]*yaml.Node, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		fields[node.Content[i].Value] = node.Content[i+1]
+	}
+	return fields
+}
+
+// requireString reports an error when a field of a mapping is missing or not a string.
+func (v *cardValidator) requireString(fields map[string]*yaml.Node, parent *yaml.Node, path, key string) {
+	value, ok := fields[key]
+	switch {
+	case !ok:
+		v.error(parent.Line, "%s.%s is required", path, key)
+	case !isString(value):
+		v.error(value.Line, "%s.%s must be a string", path, key)
+	}
+}
+
+func (v *cardValidator) checkModelIndex(node *yaml.Node) {
+	if node.Kind != yaml.SequenceNode {
+		v.error(node.Line, "model-index must be a list")
+		return
+	}
+	for i, entry := range node.Content {
+		path := fmt.Sprintf("model-index[%d]", i)
+		fields := mappingFields(entry)
+		if fields == nil {
+			v.error(entry.Line, "%s must be a mapping", path)
+			continue
+		}
+		v.requireString(fields, entry, path, "name")
+
+		results, ok := fields["results"]
+		if !ok {
+			continue
+		}
+		if results.Kind != yaml.SequenceNode {
+			v.error(results.Line, "%s.results must be a list", path)
+			continue
+		}
+		for j, result := range results.Content {
+			v.checkEvalResult(result, fmt.Sprintf("%s.results[%d]", path, j))
+		}
+	}
+}
+
+func (v *cardValidator) checkEvalResult(node *yaml.Node, path string) {
+	fields := mappingFields(node)
+	if fields == nil {
+		v.error(node.Line, "%s must be a mapping", path)
+		return
+	}
+
+	for _, key := range []string{"task", "dataset"} {
+		value, ok := fields[key]
+		if !ok {
+			v.error(node.Line, "%s.%s is required", path, key)
+			continue
+		}
+		sub := mappingFields(value)
+		if sub == nil {
+			v.error(value.Line, "%s.%s must be a mapping", path, key)
+			continue
+		}
+		v.requireString(sub, value, path+"."+key, "type")
+		if key == "dataset" {
+			v.requireString(sub, value, path+"."+key, "name")
+		}
+	}
+
+	metrics, ok := fields["metrics"]
+	if !ok {
+		v.error(node.Line, "%s.metrics is required", path)
+		return
+	}
+	if metrics.Kind != yaml.SequenceNode {
+		v.error(metrics.Line, "%s.metrics must be a list", path)
+		return
+	}
+	for k, metric := range metrics.Content {
+		metricPath := fmt.Sprintf("%s.metrics[%d]", path, k)
+		sub := mappingFields(metric)
+		if sub == nil {
+			v.error(metric.Line, "%s must be a mapping", metricPath)
+			continue
+		}
+		v.requireString(sub, metric, metricPath, "type")
+		if value, ok := sub["value"]; !ok || isNull(value) {
+			v.error(metric.Line, "%s.value is required", metricPath)
+		}
+	}
+}
+
+// checkConfigs checks the configs of a dataset card, which tell the data files of each configuration.
+//
+// Reference: https://huggingface.co/docs/hub/en/datasets-manual-configuration
+func (v *cardValidator) checkConfigs(node *yaml.Node) {
+	if node.Kind != yaml.SequenceNode {
+		v.error(node.Line, "configs must be a list")
+		return
+	}
+	names := map[string]struct{}{}
+	defaults := 0
+	for i, config := range node.Content {
+		path := fmt.Sprintf("configs[%d]", i)
+		fields := mappingFields(config)
+		if fields == nil {
+			v.error(config.Line, "%s must be a mapping", path)
+			continue
+		}
+		v.requireString(fields, config, path, "config_name")
+		if name := fields["config_name"]; name != nil && isString(name) {
+			if _, ok := names[name.Value]; ok {
+				v.error(name.Line, "%s.config_name %q is already used", path, name.Value)
+			}
+			names[name.Value] = struct{}{}
+		}
+		if value, ok := fields["default"]; ok {
+			if value.Kind != yaml.ScalarNode || value.Tag != "!!bool" {
+				v.error(value.Line, "%s.default must be a boolean", path)
+			} else if value.Value == "true" {
+				defaults++
+				if defaults > 1 {
+					v.error(value.Line, "%s.default is set, but only one config can be the default", path)
+				}
+			}
+		}
+		if value, ok := fields["data_files"]; ok {
+			v.checkDataFiles(value, path+".data_files")
+		}
+	}
+}
+
+// checkDataFiles checks the data files of a config: a pattern, a list of patterns,
+// or a list of splits with the patterns of their files.
+func (v *cardValidator) checkDataFiles(node *yaml.Node, path string) {
+	if isString(node) {
+		return
+	}
+	if node.Kind != yaml.SequenceNode {
+		v.error(node.Line, "%s must be a string or a list", path)
+		return
+	}
+	for i, item := range node.Content {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+		if isString(item) {
+			continue
+		}
+		fields := mappingFields(item)
+		if fields == nil {
+			v.error(item.Line, "%s must be a string or a mapping of split and path", itemPath)
+			continue
+		}
+		v.requireString(fields, item, itemPath, "split")
+		paths, ok := fields["path"]
+		if !ok {
+			v.error(item.Line, "%s.path is required", itemPath)
+			continue
+		}
+		v.checkKind(itemPath+".path", paths, kindStringOrList)
+	}
+}
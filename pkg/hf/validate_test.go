@@ -0,0 +1,149 @@
+package hf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateCard(t *testing.T) {
+	tests := []struct {
+		name     string
+		repoType string
+		content  string
+		errors   []string
+		warnings []string
+	}{
+		{
+			name:    "valid model card",
+			content: "---\nlicense: apache-2.0\nlanguage: [en, fr]\nbase_model: meta-llama/Llama-2-7b\nbase_model_relation: finetune\ntags:\n- text\n---\n# Model\n",
+		},
+		{
+			name:     "missing metadata",
+			content:  "# Model\n",
+			warnings: []string{"empty or missing yaml metadata in repo card"},
+		},
+		{
+			name:    "syntax error",
+			content: "---\nlicense: mit\ntags: a: b\n---\n",
+			errors:  []string{"line 3: mapping values are not allowed in this context"},
+		},
+		{
+			name:    "type mismatch",
+			content: "---\nlicense: 3\ntags: text\napp_port: eighty\n---\n",
+			errors: []string{
+				`line 2: "license" must be a string or a list of strings`,
+				`line 3: "tags" must be a list of strings`,
+				`line 4: "app_port" must be an integer`,
+			},
+		},
+		{
+			name:    "unknown license",
+			content: "---\nlicense:\n- mit\n- my-license\n---\n",
+			errors:  []string{`line 4: unknown license "my-license"`},
+		},
+		{
+			name:     "other license without name",
+			content:  "---\nlicense: other\n---\n",
+			warnings: []string{"line 2: license_name should be set"},
+		},
+		{
+			name:    "invalid base model",
+			content: "---\nbase_model: https://example.com/model\nbase_model_relation: distilled\n---\n",
+			errors: []string{
+				`line 2: invalid base_model "https://example.com/model"`,
+				`line 3: invalid base_model_relation "distilled"`,
+			},
+		},
+		{
+			name: "malformed model-index",
+			content: `---
+model-index:
+- name: my-model
+  results:
+  - task:
+      type: text-classification
+    dataset:
+      type: imdb
+    metrics:
+    - type: accuracy
+- results: []
+---
+`,
+			errors: []string{
+				"line 8: model-index[0].results[0].dataset.name is required",
+				"line 10: model-index[0].results[0].metrics[0].value is required",
+				"line 11: model-index[1].name is required",
+			},
+		},
+		{
+			name:     "valid dataset configs",
+			repoType: "dataset",
+			content: `---
+configs:
+- config_name: default
+  default: true
+  data_files:
+  - split: train
+    path: data/train-*
+  - split: test
+    path: [data/test.csv]
+- config_name: extra
+  data_files: extra/*.parquet
+---
+`,
+		},
+		{
+			name:     "invalid dataset configs",
+			repoType: "dataset",
+			content: `---
+configs:
+- config_name: a
+  default: yes please
+  data_files:
+  - path: data/train-*
+- config_name: a
+  data_files: {train: x}
+---
+`,
+			errors: []string{
+				"line 4: configs[0].default must be a boolean",
+				"line 6: configs[0].data_files[0].split is required",
+				`line 7: configs[1].config_name "a" is already used`,
+				"line 8: configs[1].data_files must be a string or a list",
+			},
+		},
+		{
+			name:    "configs of models are not checked",
+			content: "---\nconfigs: 1\n---\n",
+		},
+		{
+			name:    "duplicate key",
+			content: "---\nlicense: mit\nlicense: mit\n---\n",
+			errors:  []string{`line 3: mapping key "license" already defined at line 2`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repoType := tt.repoType
+			if repoType == "" {
+				repoType = "model"
+			}
+			v := ValidateCard([]byte(tt.content), repoType)
+			check := func(kind string, issues []ValidationIssue, want []string) {
+				if len(issues) != len(want) {
+					t.Fatalf("expected %d %s, got %v", len(want), kind, issues)
+				}
+				for i, issue := range issues {
+					if !strings.HasPrefix(issue.String(), want[i]) {
+						t.Errorf("expected %s %q, got %q", kind, want[i], issue.String())
+					}
+				}
+			}
+			check("errors", v.Errors, tt.errors)
+			check("warnings", v.Warnings, tt.warnings)
+			if (v.Err() == nil) != (len(tt.errors) == 0) {
+				t.Errorf("unexpected Err() %v", v.Err())
+			}
+		})
+	}
+}
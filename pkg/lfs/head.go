@@ -0,0 +1,67 @@
+package lfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/matrixhub-ai/hfd/internal/utils"
+)
+
+// ErrObjectNotAvailable is returned when an LFS object is neither stored nor being fetched.
+var ErrObjectNotAvailable = errors.New("LFS object is not available")
+
+// OpenHead opens the first n bytes of an LFS object, so that the header of a file
+// is read without reading all of it. The object is read from the storage, with a range
+// request when the storage only signs URLs, or from the tee cache while it is being fetched.
+func OpenHead(ctx context.Context, s Storage, c *TeeCache, oid string, n int64) (io.ReadCloser, error) {
+	if s != nil && s.Exists(oid) {
+		if getter, ok := s.(Getter); ok {
+			content, _, err := getter.Get(oid)
+			if err != nil {
+				return nil, err
+			}
+			return limitReadCloser(content, n), nil
+		}
+		if signer, ok := s.(SignGetter); ok {
+			url, err := signer.SignGet(oid)
+			if err != nil {
+				return nil, err
+			}
+			return openRange(ctx, url, n)
+		}
+	}
+	if c != nil {
+		if b := c.Get(oid); b != nil {
+			return limitReadCloser(b.NewReadSeeker(), n), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrObjectNotAvailable, oid)
+}
+
+// openRange requests the first n bytes of an object.
+func openRange(ctx context.Context, url string, n int64) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", n-1))
+	resp, err := utils.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("failed to get LFS object: %s", resp.Status)
+	}
+	return limitReadCloser(resp.Body, n), nil
+}
+
+func limitReadCloser(rc io.ReadCloser, n int64) io.ReadCloser {
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(rc, n), rc}
+}
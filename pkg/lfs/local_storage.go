@@ -97,6 +97,12 @@ func (s *localStorage) Exists(oid string) bool {
 	return true
 }
 
+// Delete removes the object from the content store.
+func (s *localStorage) Delete(oid string) error {
+	path := filepath.Join(s.basePath, transformKey(oid))
+	return os.Remove(path)
+}
+
 func transformKey(key string) string {
 	if len(key) < 5 {
 		return key
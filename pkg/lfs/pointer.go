@@ -46,3 +46,15 @@ func (p *Pointer) OIDType() string {
 func (p *Pointer) String() string {
 	return fmt.Sprintf("<LFS Pointer oid=%s size=%d>", p.OID(), p.Size())
 }
+
+// Encoded returns the content of the pointer file committed in place of the LFS object.
+func (p *Pointer) Encoded() string {
+	return p.pointer.Encoded()
+}
+
+// NewPointer returns the pointer of the LFS object with the given OID and size.
+func NewPointer(oid string, size int64) *Pointer {
+	return &Pointer{
+		pointer: lfs.NewPointer(oid, size, nil),
+	}
+}
@@ -0,0 +1,134 @@
+package lfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/git-lfs/git-lfs/v3/lfshttp"
+)
+
+// Push uploads the given LFS objects from storage to the LFS server of the git repository at repoURL.
+// Objects the server already has are skipped.
+func Push(ctx context.Context, httpClient *http.Client, repoURL string, storage Storage, objects []LFSObject) error {
+	client := newClient(httpClient)
+	batchResp, err := client.PostBatch(ctx, repoURL, objects)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, obj := range batchResp.Objects {
+		if obj.Error != nil {
+			errs = append(errs, fmt.Errorf("LFS object %s: %s (code %d)", obj.Oid, obj.Error.Message, obj.Error.Code))
+			continue
+		}
+
+		uploadAction, ok := obj.Actions["upload"]
+		if !ok {
+			continue
+		}
+		if err := uploadObject(ctx, httpClient, storage, obj.Oid, obj.Size, uploadAction); err != nil {
+			errs = append(errs, fmt.Errorf("failed to upload LFS object %s: %w", obj.Oid, err))
+			continue
+		}
+
+		if verifyAction, ok := obj.Actions["verify"]; ok {
+			if err := verifyObject(ctx, httpClient, obj.Oid, obj.Size, verifyAction); err != nil {
+				errs = append(errs, fmt.Errorf("failed to verify LFS object %s: %w", obj.Oid, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// openObject opens the content of an LFS object from storage, either directly or through a presigned URL.
+func openObject(ctx context.Context, httpClient *http.Client, storage Storage, oid string) (io.ReadCloser, error) {
+	if getter, ok := storage.(Getter); ok {
+		content, _, err := getter.Get(oid)
+		return content, err
+	}
+	if signer, ok := storage.(SignGetter); ok {
+		url, err := signer.SignGet(oid)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			_ = resp.Body.Close()
+			return nil, fmt.Errorf("unexpected status code %d when reading object from storage", resp.StatusCode)
+		}
+		return resp.Body, nil
+	}
+	return nil, fmt.Errorf("LFS storage does not support content retrieval")
+}
+
+func uploadObject(ctx context.Context, httpClient *http.Client, storage Storage, oid string, size int64, uploadAction action) error {
+	content, err := openObject(ctx, httpClient, storage, oid)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, uploadAction.Href, content)
+	if err != nil {
+		return fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("User-Agent", lfshttp.UserAgent)
+	for key, value := range uploadAction.Header {
+		req.Header.Set(key, value)
+	}
+
+	return doAction(httpClient, req)
+}
+
+func verifyObject(ctx context.Context, httpClient *http.Client, oid string, size int64, verifyAction action) error {
+	body, err := json.Marshal(batchObject{Oid: oid, Size: size})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, verifyAction.Href, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create verify request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/vnd.git-lfs+json")
+	req.Header.Set("Accept", "application/vnd.git-lfs+json")
+	req.Header.Set("User-Agent", lfshttp.UserAgent)
+	for key, value := range verifyAction.Header {
+		req.Header.Set(key, value)
+	}
+
+	return doAction(httpClient, req)
+}
+
+func doAction(httpClient *http.Client, req *http.Request) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status code %d from %s: %s", resp.StatusCode, req.URL.Redacted(), body)
+	}
+	return nil
+}
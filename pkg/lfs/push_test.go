@@ -0,0 +1,86 @@
+package lfs_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+)
+
+func TestPush(t *testing.T) {
+	local := lfs.NewLocal(t.TempDir())
+	remote := lfs.NewLocal(t.TempDir())
+
+	put := func(s lfs.Storage, content string) lfs.LFSObject {
+		sum := sha256.Sum256([]byte(content))
+		oid := hex.EncodeToString(sum[:])
+		if err := s.Put(oid, bytes.NewReader([]byte(content)), int64(len(content))); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		return lfs.LFSObject{Oid: oid, Size: int64(len(content))}
+	}
+	missing := put(local, "missing on remote")
+	present := put(local, "present on remote")
+	put(remote, "present on remote")
+
+	var verified []string
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/org/repo.git/info/lfs/objects/batch":
+			var req struct {
+				Operation string `json:"operation"`
+				Objects   []struct {
+					Oid  string `json:"oid"`
+					Size int64  `json:"size"`
+				} `json:"objects"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Operation != "upload" {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			var objects []map[string]any
+			for _, obj := range req.Objects {
+				o := map[string]any{"oid": obj.Oid, "size": obj.Size}
+				if !remote.Exists(obj.Oid) {
+					o["actions"] = map[string]any{
+						"upload": map[string]any{"href": server.URL + "/objects/" + obj.Oid},
+						"verify": map[string]any{"href": server.URL + "/verify"},
+					}
+				}
+				objects = append(objects, o)
+			}
+			w.Header().Set("Content-Type", "application/vnd.git-lfs+json")
+			_ = json.NewEncoder(w).Encode(map[string]any{"objects": objects})
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/objects/"):
+			if err := remote.Put(strings.TrimPrefix(r.URL.Path, "/objects/"), r.Body, r.ContentLength); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+		case r.URL.Path == "/verify":
+			body, _ := io.ReadAll(r.Body)
+			verified = append(verified, string(body))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	err := lfs.Push(context.Background(), http.DefaultClient, server.URL+"/org/repo", local, []lfs.LFSObject{missing, present})
+	if err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if !remote.Exists(missing.Oid) {
+		t.Fatal("Expected missing object to be uploaded")
+	}
+	if len(verified) != 1 || !strings.Contains(verified[0], missing.Oid) {
+		t.Fatalf("Expected only the uploaded object to be verified, got %v", verified)
+	}
+}
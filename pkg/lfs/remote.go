@@ -86,6 +86,16 @@ func getLFSEndpoint(repoURL string) string {
 
 // GetBatch requests download URLs for LFS objects using the batch API
 func (c *client) GetBatch(ctx context.Context, lfsEndpoint string, objects []LFSObject) (*batchResponse, error) {
+	return c.batch(ctx, lfsEndpoint, "download", objects)
+}
+
+// PostBatch requests upload URLs for LFS objects using the batch API.
+// Objects the server already has are returned without an upload action.
+func (c *client) PostBatch(ctx context.Context, lfsEndpoint string, objects []LFSObject) (*batchResponse, error) {
+	return c.batch(ctx, lfsEndpoint, "upload", objects)
+}
+
+func (c *client) batch(ctx context.Context, lfsEndpoint string, operation string, objects []LFSObject) (*batchResponse, error) {
 	if len(objects) == 0 {
 		return &batchResponse{}, nil
 	}
@@ -98,7 +108,7 @@ func (c *client) GetBatch(ctx context.Context, lfsEndpoint string, objects []LFS
 	}
 
 	reqBody := batchRequest{
-		Operation: "download",
+		Operation: operation,
 		Transfers: []string{"basic"},
 		Objects:   batchObjects,
 	}
@@ -187,6 +187,15 @@ func (s *s3Storage) Exists(oid string) bool {
 	return err == nil
 }
 
+func (s *s3Storage) Delete(oid string) error {
+	key := path.Join(s.basePath, transformKey(oid))
+	_, err := s.s3.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
 func isNotFoundError(err error) bool {
 	if aerr, ok := err.(s3.RequestFailure); ok {
 		if aerr.StatusCode() == 404 {
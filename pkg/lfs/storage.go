@@ -28,3 +28,9 @@ type SignGetter interface {
 type SignPutter interface {
 	SignPut(oid string) (string, error)
 }
+
+// Deleter is implemented by stores that support removing objects,
+// which is required for evicting cached objects.
+type Deleter interface {
+	Delete(oid string) error
+}
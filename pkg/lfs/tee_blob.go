@@ -0,0 +1,407 @@
+package lfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var errBlobReleased = errors.New("in-flight object is no longer available")
+
+// Blob tracks the state of an in-flight LFS object fetch. The object is downloaded in chunks
+// into a partial file, and concurrent readers can read any downloaded range before the download completes.
+type Blob struct {
+	oid       string
+	total     int64
+	chunkSize int64
+	modTime   time.Time
+	partPath  string
+	statePath string
+	file      *os.File
+	storage   Storage
+
+	mut       sync.Mutex
+	cond      *sync.Cond
+	filled    []int64 // contiguous bytes downloaded from the start of each chunk
+	fetching  []bool
+	wanted    []int // chunks readers are blocked on, in request order
+	err       error
+	committed bool
+	refs      int
+}
+
+// partialState is the persisted progress of a partial download, recording the completed chunks.
+type partialState struct {
+	Size      int64 `json:"size"`
+	ChunkSize int64 `json:"chunkSize"`
+	Done      []int `json:"done"`
+}
+
+// openBlob opens the partial file of the object in dir, resuming the chunks completed by a previous fetch.
+func openBlob(dir string, oid string, total int64, chunkSize int64, storage Storage) (*Blob, error) {
+	if !validOID(oid) {
+		return nil, fmt.Errorf("invalid LFS object id %q", oid)
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+
+	b := &Blob{
+		oid:       oid,
+		total:     total,
+		chunkSize: chunkSize,
+		modTime:   time.Now(),
+		partPath:  filepath.Join(dir, oid+".part"),
+		statePath: filepath.Join(dir, oid+".json"),
+		storage:   storage,
+		refs:      1,
+	}
+	b.cond = sync.NewCond(&b.mut)
+
+	n := int((total + chunkSize - 1) / chunkSize)
+	b.filled = make([]int64, n)
+	b.fetching = make([]bool, n)
+
+	file, err := os.OpenFile(b.partPath, os.O_RDWR|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(total); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	b.file = file
+
+	if data, err := os.ReadFile(b.statePath); err == nil {
+		var state partialState
+		if json.Unmarshal(data, &state) == nil && state.Size == total && state.ChunkSize == chunkSize {
+			for _, idx := range state.Done {
+				if idx >= 0 && idx < n {
+					b.filled[idx] = b.chunkLen(idx)
+				}
+			}
+		}
+	}
+	return b, nil
+}
+
+// NewReadSeeker returns a new ReadSeeker for serving in-flight content.
+// Reads block until the requested range has been downloaded.
+func (b *Blob) NewReadSeeker() io.ReadSeekCloser {
+	b.mut.Lock()
+	if b.refs == 0 {
+		b.mut.Unlock()
+		// The fetch finished and every reader is gone; serve the committed object instead.
+		if getter, ok := b.storage.(Getter); ok {
+			content, _, err := getter.Get(b.oid)
+			if err == nil {
+				return content
+			}
+		}
+		return &blobReader{b: b, err: errBlobReleased}
+	}
+	b.refs++
+	b.mut.Unlock()
+	return &blobReader{b: b}
+}
+
+// Total returns the total size of the object being fetched.
+func (b *Blob) Total() int64 {
+	return b.total
+}
+
+// ModTime returns the Last-Modified time of the object being fetched, if available.
+func (b *Blob) ModTime() time.Time {
+	return b.modTime
+}
+
+// Progress returns the number of bytes downloaded so far.
+func (b *Blob) Progress() int64 {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	var n int64
+	for _, filled := range b.filled {
+		n += filled
+	}
+	return n
+}
+
+func (b *Blob) chunkStart(idx int) int64 {
+	return int64(idx) * b.chunkSize
+}
+
+func (b *Blob) chunkLen(idx int) int64 {
+	return min(b.chunkSize, b.total-b.chunkStart(idx))
+}
+
+// nextChunk picks the next chunk to download and marks it as fetching.
+// Chunks readers are blocked on come first, then the lowest missing chunk.
+func (b *Blob) nextChunk() (int, bool) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	available := func(idx int) bool {
+		return !b.fetching[idx] && b.filled[idx] < b.chunkLen(idx)
+	}
+	for len(b.wanted) > 0 {
+		idx := b.wanted[0]
+		b.wanted = b.wanted[1:]
+		if available(idx) {
+			b.fetching[idx] = true
+			return idx, true
+		}
+	}
+	for idx := range b.filled {
+		if available(idx) {
+			b.fetching[idx] = true
+			return idx, true
+		}
+	}
+	return 0, false
+}
+
+// unmarkChunk makes the chunk available to be picked again after a failed download.
+func (b *Blob) unmarkChunk(idx int) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	b.fetching[idx] = false
+}
+
+// resumeOffset returns the offset the download of the chunk resumes from.
+func (b *Blob) resumeOffset(idx int) int64 {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return b.chunkStart(idx) + b.filled[idx]
+}
+
+// complete reports whether every chunk has been downloaded.
+func (b *Blob) complete() bool {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	for idx, filled := range b.filled {
+		if filled < b.chunkLen(idx) {
+			return false
+		}
+	}
+	return true
+}
+
+// write writes p at off into the partial file. Writes must continue the downloaded prefix of each chunk
+// they cover; bytes of chunks that are already downloaded are skipped.
+func (b *Blob) write(off int64, p []byte) error {
+	for len(p) > 0 {
+		idx := int(off / b.chunkSize)
+		if idx >= len(b.filled) {
+			return fmt.Errorf("received more than %d bytes", b.total)
+		}
+		n := min(int64(len(p)), b.chunkStart(idx)+b.chunkLen(idx)-off)
+
+		b.mut.Lock()
+		filled := b.chunkStart(idx) + b.filled[idx]
+		b.mut.Unlock()
+		if off+n <= filled {
+			off += n
+			p = p[n:]
+			continue
+		}
+		if off < filled {
+			skip := filled - off
+			off, p, n = filled, p[skip:], n-skip
+		}
+		if off > filled {
+			return fmt.Errorf("non-contiguous write at offset %d, chunk %d is filled up to %d", off, idx, filled)
+		}
+
+		if _, err := b.file.WriteAt(p[:n], off); err != nil {
+			return err
+		}
+
+		b.mut.Lock()
+		b.filled[idx] += n
+		done := b.filled[idx] == b.chunkLen(idx)
+		b.cond.Broadcast()
+		b.mut.Unlock()
+
+		if done {
+			b.saveState()
+		}
+		off += n
+		p = p[n:]
+	}
+	return nil
+}
+
+// saveState persists the completed chunks so an interrupted fetch can resume.
+func (b *Blob) saveState() {
+	state := partialState{
+		Size:      b.total,
+		ChunkSize: b.chunkSize,
+	}
+	b.mut.Lock()
+	for idx, filled := range b.filled {
+		if filled == b.chunkLen(idx) {
+			state.Done = append(state.Done, idx)
+		}
+	}
+	b.mut.Unlock()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return
+	}
+	tmp := b.statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0640); err != nil {
+		return
+	}
+	_ = os.Rename(tmp, b.statePath)
+}
+
+// commit verifies the sha256 of the downloaded object and stores it.
+func (b *Blob) commit() error {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(b.file, 0, b.total)); err != nil {
+		return err
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != b.oid {
+		// The partial data is corrupt, so it must not be resumed.
+		_ = os.Remove(b.statePath)
+		return errHashMismatch
+	}
+	return b.storage.Put(b.oid, io.NewSectionReader(b.file, 0, b.total), b.total)
+}
+
+// finish records the result of the fetch and wakes blocked readers.
+func (b *Blob) finish(err error) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	if err != nil {
+		b.err = err
+	} else {
+		b.committed = true
+	}
+	b.cond.Broadcast()
+}
+
+// release drops a reference to the blob. The partial file is closed once the fetch has finished
+// and every reader is gone, and removed if the object was committed.
+func (b *Blob) release() {
+	b.mut.Lock()
+	b.refs--
+	last := b.refs == 0
+	committed := b.committed
+	b.mut.Unlock()
+	if !last {
+		return
+	}
+
+	_ = b.file.Close()
+	if committed {
+		_ = os.Remove(b.partPath)
+		_ = os.Remove(b.statePath)
+	}
+}
+
+// waitAvailable blocks until the byte at off has been downloaded, and returns the number of
+// contiguous bytes available from off.
+func (b *Blob) waitAvailable(off int64) (int64, error) {
+	idx := int(off / b.chunkSize)
+	rel := off - b.chunkStart(idx)
+
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	queued := false
+	for {
+		if n := b.filled[idx] - rel; n > 0 {
+			return n, nil
+		}
+		if b.err != nil {
+			return 0, b.err
+		}
+		if !queued {
+			b.wanted = append(b.wanted, idx)
+			queued = true
+		}
+		b.cond.Wait()
+	}
+}
+
+// blobReader reads an in-flight object, blocking until the requested bytes are downloaded.
+type blobReader struct {
+	b      *Blob
+	off    int64
+	err    error
+	closed bool
+}
+
+func (r *blobReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	if r.off >= r.b.total {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	avail, err := r.b.waitAvailable(r.off)
+	if err != nil {
+		return 0, err
+	}
+	if int64(len(p)) > avail {
+		p = p[:avail]
+	}
+	n, err := r.b.file.ReadAt(p, r.off)
+	r.off += int64(n)
+	if n == len(p) {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *blobReader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.off + offset
+	case io.SeekEnd:
+		abs = r.b.total + offset
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if abs < 0 {
+		return 0, fmt.Errorf("negative position %d", abs)
+	}
+	r.off = abs
+	return abs, nil
+}
+
+func (r *blobReader) Close() error {
+	if r.closed || r.err != nil {
+		return nil
+	}
+	r.closed = true
+	r.b.release()
+	return nil
+}
+
+// validOID reports whether oid is a hex encoded sha256, and so safe to use as a file name.
+func validOID(oid string) bool {
+	if len(oid) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(oid)
+	return err == nil
+}
@@ -2,63 +2,90 @@ package lfs
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
 	"github.com/matrixhub-ai/hfd/internal/utils"
-	"github.com/wzshiming/ioswmr"
+	"golang.org/x/sync/errgroup"
 )
 
-// Blob tracks the state of an in-flight LFS object fetch, allowing concurrent readers to access
-// the data as it is being downloaded and written to the local store.
-type Blob struct {
-	swmr    ioswmr.SWMR
-	total   int64
-	modTime time.Time
-}
-
-// NewReadSeeker returns a new ReadSeeker for serving in-flight content.
-func (b *Blob) NewReadSeeker() io.ReadSeekCloser {
-	return b.swmr.NewReadSeeker(0, int(b.total))
-}
+const (
+	defaultChunkSize   = 64 << 20
+	defaultConcurrency = 4
 
-// Total returns the total size of the object being fetched.
-func (b *Blob) Total() int64 {
-	return b.total
-}
-
-// ModTime returns the Last-Modified time of the object being fetched, if available.
-func (b *Blob) ModTime() time.Time {
-	return b.modTime
-}
+	// maxChunkAttempts is the number of times the download of a chunk is attempted before the fetch fails.
+	maxChunkAttempts = 3
+	chunkRetryDelay  = time.Second
+)
 
-// Progress returns the number of bytes currently available for reading.
-func (b *Blob) Progress() int64 {
-	return int64(b.swmr.Length())
-}
+// errRangeNotSupported is returned when the upstream answers a range request with the full object.
+var errRangeNotSupported = errors.New("upstream does not support range requests")
 
 // TeeCache fetches LFS objects from an upstream source, tees the download
 // stream into a local store, and allows concurrent readers to access
 // in-flight data before the download completes.
+//
+// Objects are downloaded in chunks with parallel range requests, fetching first the chunks
+// readers are waiting for. Progress is kept in a partial directory, so a fetch interrupted by a
+// broken connection or a restart resumes where it stopped. The sha256 of the downloaded object
+// is verified before it is stored.
 type TeeCache struct {
-	httpClient *http.Client
-	cache      sync.Map
-	storage    Storage
-	mut        sync.Mutex
+	httpClient  *http.Client
+	cache       sync.Map
+	storage     Storage
+	mut         sync.Mutex
+	partialDir  string
+	chunkSize   int64
+	concurrency int
 }
 
 // TeeCacheOption configures a TeeCache.
 type TeeCacheOption func(*TeeCache)
 
+// WithPartialDir sets the directory holding partially downloaded objects.
+// Use a persistent directory for fetches to resume across restarts.
+func WithPartialDir(dir string) TeeCacheOption {
+	return func(m *TeeCache) {
+		m.partialDir = dir
+	}
+}
+
+// WithChunkSize sets the size of the chunks objects are downloaded in.
+// A non-positive size keeps the default.
+func WithChunkSize(size int64) TeeCacheOption {
+	return func(m *TeeCache) {
+		if size > 0 {
+			m.chunkSize = size
+		}
+	}
+}
+
+// WithConcurrency sets the number of chunks of an object downloaded in parallel.
+// A non-positive number keeps the default.
+func WithConcurrency(n int) TeeCacheOption {
+	return func(m *TeeCache) {
+		if n > 0 {
+			m.concurrency = n
+		}
+	}
+}
+
 // NewTeeCache creates a new TeeCache.
 // storage is used to persist fetched objects and check if objects already exist locally.
 func NewTeeCache(storage Storage, opts ...TeeCacheOption) *TeeCache {
 	p := &TeeCache{
-		httpClient: utils.HTTPClient,
-		storage:    storage,
+		httpClient:  utils.HTTPClient,
+		storage:     storage,
+		partialDir:  filepath.Join(os.TempDir(), "hfd-lfs-partial"),
+		chunkSize:   defaultChunkSize,
+		concurrency: defaultConcurrency,
 	}
 	for _, opt := range opts {
 		opt(p)
@@ -106,72 +133,222 @@ func (m *TeeCache) StartFetch(ctx context.Context, sourceURL string, objects []L
 		}
 
 		slog.InfoContext(ctx, "LFS tee cache: fetching object from upstream", "oid", obj.Oid)
-		m.fetchSingleObject(context.Background(), obj.Oid, obj.Size, downloadAction)
+		if err := m.fetchSingleObject(context.Background(), obj.Oid, obj.Size, downloadAction); err != nil {
+			slog.ErrorContext(ctx, "LFS tee cache: failed to fetch object", "oid", obj.Oid, "error", err)
+		}
 	}
 	return nil
 }
 
-// fetchSingleObject fetches a single LFS object from upstream, tees the response
-// body into the local storage while making it available for concurrent readers.
-func (m *TeeCache) fetchSingleObject(ctx context.Context, oid string, size int64, downloadAction action) {
+// StartFetchURL initiates fetching a single LFS object directly from a download URL,
+// such as the CDN location an upstream resolve endpoint redirects to.
+func (m *TeeCache) StartFetchURL(ctx context.Context, oid string, size int64, href string) error {
+	if _, ok := m.cache.Load(oid); ok {
+		return nil
+	}
+	if m.storage.Exists(oid) {
+		return nil
+	}
+
+	slog.InfoContext(ctx, "LFS tee cache: fetching object from URL", "oid", oid)
+	return m.fetchSingleObject(context.Background(), oid, size, action{Href: href})
+}
+
+// fetchSingleObject starts fetching a single LFS object from upstream into the partial directory,
+// making it available for concurrent readers, and stores it once downloaded and verified.
+// The first request is made synchronously so upstream errors are reported to the caller.
+func (m *TeeCache) fetchSingleObject(ctx context.Context, oid string, size int64, downloadAction action) error {
 	m.mut.Lock()
 	defer m.mut.Unlock()
 	_, ok := m.cache.Load(oid)
 	if ok {
-		return
+		return nil
 	}
 
-	req, err := downloadAction.Request(ctx)
+	b, err := openBlob(m.partialDir, oid, size, m.chunkSize, m.storage)
 	if err != nil {
-		slog.ErrorContext(ctx, "LFS tee cache: failed to create download request", "oid", oid, "error", err)
-		return
+		return fmt.Errorf("failed to open partial object: %w", err)
 	}
 
-	resp, err := m.httpClient.Do(req)
-	if err != nil {
-		slog.ErrorContext(ctx, "LFS tee cache: failed to download object", "oid", oid, "error", err)
-		return
+	idx, ok := b.nextChunk()
+	var probe *http.Response
+	if ok {
+		probe, err = m.requestRange(ctx, downloadAction, b.resumeOffset(idx), b.chunkStart(idx)+b.chunkLen(idx))
+		if err != nil {
+			b.finish(err)
+			b.release()
+			return err
+		}
+		if modTime, err := time.Parse(http.TimeFormat, probe.Header.Get("Last-Modified")); err == nil {
+			b.modTime = modTime
+		}
 	}
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-		resp.Body.Close()
-		slog.ErrorContext(ctx, "LFS tee cache: unexpected status code when downloading object", "status", resp.StatusCode, "oid", oid, "url", req.URL, "body", string(body))
-		return
+
+	m.cache.Store(oid, b)
+	go func() {
+		err := m.download(ctx, b, downloadAction, idx, probe)
+		if err == nil {
+			err = b.commit()
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "LFS tee cache: failed to fetch object", "oid", oid, "error", err)
+		}
+		m.cache.Delete(oid)
+		b.finish(err)
+		b.release()
+	}()
+	return nil
+}
+
+// download completes the fetch started by the probe response for chunk idx. If the upstream answered
+// the probe with a range, the probe is streamed while the remaining chunks are fetched in parallel;
+// otherwise the probe carries the full object and is read sequentially.
+func (m *TeeCache) download(ctx context.Context, b *Blob, downloadAction action, idx int, probe *http.Response) error {
+	if probe != nil && probe.StatusCode == http.StatusOK {
+		defer func() {
+			_ = probe.Body.Close()
+		}()
+		if err := copyAt(b, 0, probe.Body); err != nil {
+			return err
+		}
+		if !b.complete() {
+			return fmt.Errorf("upstream returned fewer than %d bytes", b.total)
+		}
+		return nil
 	}
 
-	f := &Blob{
-		swmr: ioswmr.NewSWMR(
-			ioswmr.NewMemoryOrTemporaryFileBuffer(nil, nil),
-			ioswmr.WithAutoClose(),
-			ioswmr.WithBeforeCloseFunc(func() {
-				m.cache.Delete(oid)
-			}),
-		),
-		total: size,
+	g, ctx := errgroup.WithContext(ctx)
+	worker := func() error {
+		for {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			idx, ok := b.nextChunk()
+			if !ok {
+				return nil
+			}
+			err := m.fetchChunk(ctx, b, downloadAction, idx)
+			b.unmarkChunk(idx)
+			if err != nil {
+				return err
+			}
+		}
 	}
-	lastModified := resp.Header.Get("Last-Modified")
-	if modTime, err := time.Parse(http.TimeFormat, lastModified); err != nil {
-		f.modTime = time.Now()
-	} else {
-		f.modTime = modTime
+
+	workers := max(m.concurrency, 1)
+	if probe != nil {
+		workers--
+		g.Go(func() error {
+			err := copyAt(b, b.resumeOffset(idx), probe.Body)
+			_ = probe.Body.Close()
+			if err != nil {
+				slog.WarnContext(ctx, "LFS tee cache: failed to fetch chunk, retrying", "oid", b.oid, "chunk", idx, "error", err)
+			}
+			// Resume the chunk if the probe ended early, then continue as a regular worker.
+			err = m.fetchChunk(ctx, b, downloadAction, idx)
+			b.unmarkChunk(idx)
+			if err != nil {
+				return err
+			}
+			return worker()
+		})
 	}
+	for range workers {
+		g.Go(worker)
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	if !b.complete() {
+		return fmt.Errorf("object is incomplete after download")
+	}
+	return nil
+}
 
-	m.cache.Store(oid, f)
-	reader := f.swmr.NewReader(0)
+// fetchChunk downloads the remaining bytes of chunk idx, resuming from the bytes already
+// downloaded when a request fails.
+func (m *TeeCache) fetchChunk(ctx context.Context, b *Blob, downloadAction action, idx int) error {
+	end := b.chunkStart(idx) + b.chunkLen(idx)
+	var err error
+	for attempt := range maxChunkAttempts {
+		if attempt > 0 {
+			slog.WarnContext(ctx, "LFS tee cache: failed to fetch chunk, retrying", "oid", b.oid, "chunk", idx, "error", err)
+			time.Sleep(time.Duration(attempt) * chunkRetryDelay)
+		}
 
-	go func() {
-		sw := f.swmr.Writer()
-		defer sw.Close()
-		defer resp.Body.Close()
-		_, err := io.Copy(sw, resp.Body)
-		sw.CloseWithError(err)
-	}()
+		off := b.resumeOffset(idx)
+		if off >= end {
+			return nil
+		}
 
-	go func() {
-		defer reader.Close()
-		if err := m.storage.Put(oid, reader, size); err != nil {
-			slog.ErrorContext(ctx, "LFS tee cache: failed to storage object", "oid", oid, "error", err)
-			return
+		var resp *http.Response
+		resp, err = m.requestRange(ctx, downloadAction, off, end)
+		if err != nil {
+			continue
 		}
-	}()
+		if resp.StatusCode != http.StatusPartialContent {
+			_ = resp.Body.Close()
+			return errRangeNotSupported
+		}
+		err = copyAt(b, off, resp.Body)
+		_ = resp.Body.Close()
+		if err == nil && b.resumeOffset(idx) < end {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to fetch chunk %d: %w", idx, err)
+}
+
+// requestRange requests the bytes [off, end) of the object. The response is either a matching
+// 206 Partial Content, or a 200 OK carrying the full object when the upstream ignores ranges.
+func (m *TeeCache) requestRange(ctx context.Context, downloadAction action, off, end int64) (*http.Response, error) {
+	req, err := downloadAction.Request(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download request: %w", err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, end-1))
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download object: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp, nil
+	case http.StatusPartialContent:
+		var start int64
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-", &start); err != nil || start != off {
+			_ = resp.Body.Close()
+			return nil, fmt.Errorf("unexpected Content-Range %q when requesting offset %d", resp.Header.Get("Content-Range"), off)
+		}
+		return resp, nil
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code %d when downloading object from %s: %s", resp.StatusCode, req.URL.Redacted(), body)
+	}
+}
+
+// copyAt streams r into the blob starting at off.
+func copyAt(b *Blob, off int64, r io.Reader) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if werr := b.write(off, buf[:n]); werr != nil {
+				return werr
+			}
+			off += int64(n)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
 }
@@ -0,0 +1,219 @@
+package lfs_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+)
+
+func testObject(size int) ([]byte, string) {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	sum := sha256.Sum256(data)
+	return data, hex.EncodeToString(sum[:])
+}
+
+// rangeOffset returns the start offset of the request's Range header, or -1 without one.
+func rangeOffset(r *http.Request) int64 {
+	spec, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes=")
+	if !ok {
+		return -1
+	}
+	start, _, _ := strings.Cut(spec, "-")
+	off, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return off
+}
+
+func waitStored(t *testing.T, storage lfs.Storage, oid string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !storage.Exists(oid) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected object to be stored")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTeeCacheRange(t *testing.T) {
+	data, oid := testObject(8 * 1024)
+
+	// The first chunk stalls until released, so reading the last chunk must not wait for it.
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rangeOffset(r) == 0 {
+			w.Header().Set("Content-Range", "bytes 0-1023/8192")
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(data[:512])
+			w.(http.Flusher).Flush()
+			<-release
+			_, _ = w.Write(data[512:1024])
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	storage := lfs.NewLocal(t.TempDir())
+	tc := lfs.NewTeeCache(storage,
+		lfs.WithPartialDir(t.TempDir()),
+		lfs.WithChunkSize(1024),
+		lfs.WithConcurrency(2),
+	)
+	if err := tc.StartFetchURL(context.Background(), oid, int64(len(data)), server.URL); err != nil {
+		t.Fatalf("StartFetchURL failed: %v", err)
+	}
+	blob := tc.Get(oid)
+	if blob == nil {
+		t.Fatal("Expected in-flight blob")
+	}
+
+	rs := blob.NewReadSeeker()
+	if _, err := rs.Seek(-100, io.SeekEnd); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	tail, err := io.ReadAll(rs)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if !bytes.Equal(tail, data[len(data)-100:]) {
+		t.Fatal("Tail content mismatch")
+	}
+	if storage.Exists(oid) {
+		t.Fatal("Expected object not to be stored before the first chunk is downloaded")
+	}
+
+	close(release)
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	all, err := io.ReadAll(rs)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	_ = rs.Close()
+	if !bytes.Equal(all, data) {
+		t.Fatal("Content mismatch")
+	}
+	waitStored(t, storage, oid)
+}
+
+func TestTeeCacheWithoutRangeSupport(t *testing.T) {
+	data, oid := testObject(5000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+
+	storage := lfs.NewLocal(t.TempDir())
+	tc := lfs.NewTeeCache(storage, lfs.WithPartialDir(t.TempDir()), lfs.WithChunkSize(1024))
+	if err := tc.StartFetchURL(context.Background(), oid, int64(len(data)), server.URL); err != nil {
+		t.Fatalf("StartFetchURL failed: %v", err)
+	}
+	waitStored(t, storage, oid)
+}
+
+func TestTeeCacheResume(t *testing.T) {
+	data, oid := testObject(8 * 1024)
+	partialDir := t.TempDir()
+	storage := lfs.NewLocal(t.TempDir())
+
+	// The first upstream fails every chunk from offset 4096 on.
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rangeOffset(r) >= 4096 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer failing.Close()
+
+	tc := lfs.NewTeeCache(storage, lfs.WithPartialDir(partialDir), lfs.WithChunkSize(1024), lfs.WithConcurrency(1))
+	if err := tc.StartFetchURL(context.Background(), oid, int64(len(data)), failing.URL); err != nil {
+		t.Fatalf("StartFetchURL failed: %v", err)
+	}
+	deadline := time.Now().Add(20 * time.Second)
+	for tc.Get(oid) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected fetch to fail")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if storage.Exists(oid) {
+		t.Fatal("Expected failed fetch not to be stored")
+	}
+	if _, err := os.Stat(filepath.Join(partialDir, oid+".part")); err != nil {
+		t.Fatalf("Expected partial file to be kept: %v", err)
+	}
+
+	// A new fetch resumes from the chunks downloaded before the failure.
+	var mut sync.Mutex
+	var offsets []int64
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mut.Lock()
+		offsets = append(offsets, rangeOffset(r))
+		mut.Unlock()
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer working.Close()
+
+	tc = lfs.NewTeeCache(storage, lfs.WithPartialDir(partialDir), lfs.WithChunkSize(1024), lfs.WithConcurrency(1))
+	if err := tc.StartFetchURL(context.Background(), oid, int64(len(data)), working.URL); err != nil {
+		t.Fatalf("StartFetchURL failed: %v", err)
+	}
+	waitStored(t, storage, oid)
+
+	mut.Lock()
+	defer mut.Unlock()
+	for _, off := range offsets {
+		if off < 4096 {
+			t.Errorf("Expected downloaded chunks not to be fetched again, got request at offset %d", off)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(partialDir, oid+".part")); !os.IsNotExist(err) {
+		t.Errorf("Expected partial file to be removed after commit, stat error: %v", err)
+	}
+}
+
+func TestTeeCacheHashMismatch(t *testing.T) {
+	data, _ := testObject(3000)
+	_, oid := testObject(3001)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	storage := lfs.NewLocal(t.TempDir())
+	tc := lfs.NewTeeCache(storage, lfs.WithPartialDir(t.TempDir()), lfs.WithChunkSize(1024))
+	if err := tc.StartFetchURL(context.Background(), oid, int64(len(data)), server.URL); err != nil {
+		t.Fatalf("StartFetchURL failed: %v", err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for tc.Get(oid) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected fetch to finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if storage.Exists(oid) {
+		t.Fatal("Expected object with mismatching content not to be stored")
+	}
+}
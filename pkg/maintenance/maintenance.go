@@ -0,0 +1,357 @@
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/matrixhub-ai/hfd/pkg/receive"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+	"github.com/matrixhub-ai/hfd/pkg/storage"
+)
+
+const (
+	defaultDelay       = 10 * time.Minute
+	defaultConcurrency = 2
+	defaultPushTimeout = time.Hour
+	// maxDelayFactor bounds how long writes can keep postponing maintenance,
+	// as a multiple of the delay, so busy repositories are maintained too.
+	maxDelayFactor = 10
+	// pushRetryDelay is the wait before checking again whether the pushes to a repository are over.
+	pushRetryDelay = 30 * time.Second
+)
+
+// State is the maintenance state of a repository.
+type State string
+
+const (
+	// StateIdle means no maintenance is pending.
+	StateIdle State = "idle"
+	// StateScheduled means maintenance is pending, waiting for its scheduled time,
+	// for a free worker, or for the pushes to the repository to end.
+	StateScheduled State = "scheduled"
+	// StateRunning means maintenance is in progress.
+	StateRunning State = "running"
+	// StateFailed means the last maintenance failed and no maintenance is pending.
+	StateFailed State = "failed"
+)
+
+// Status reports the maintenance state of a repository.
+type Status struct {
+	State        State                        `json:"state"`
+	Writes       int                          `json:"writes"`
+	ActivePushes int                          `json:"activePushes"`
+	PendingTasks []repository.MaintenanceTask `json:"pendingTasks,omitempty"`
+	NextRun      time.Time                    `json:"nextRun,omitzero"`
+	LastRun      time.Time                    `json:"lastRun,omitzero"`
+	LastDuration string                       `json:"lastDuration,omitempty"`
+	LastTasks    []repository.MaintenanceTask `json:"lastTasks,omitempty"`
+	LastError    string                       `json:"lastError,omitempty"`
+}
+
+type repoState struct {
+	status  Status
+	tasks   map[repository.MaintenanceTask]struct{}
+	pushes  map[uint64]time.Time // start times of the pushes in progress, by token
+	waiting bool                 // maintenance was due, and waits for the pushes to end
+	since   time.Time            // time of the first write not maintained yet
+	due     time.Time
+	timer   *time.Timer
+	running bool
+}
+
+// Scheduler runs maintenance on repositories in the background. Writes to a repository schedule
+// its maintenance once the repository has not been written to for a while, a limited number of
+// repositories are maintained at once, and maintenance waits for the pushes to a repository to end.
+type Scheduler struct {
+	storage     *storage.Storage
+	delay       time.Duration
+	pushTimeout time.Duration
+	sem         chan struct{}
+
+	mut       sync.Mutex
+	repos     map[string]*repoState
+	nextToken uint64
+}
+
+// Option defines a functional option for configuring the Scheduler.
+type Option func(*Scheduler)
+
+// WithStorage sets the storage the maintained repositories are read from. This is required.
+func WithStorage(storage *storage.Storage) Option {
+	return func(s *Scheduler) {
+		s.storage = storage
+	}
+}
+
+// WithDelay sets how long a repository must not be written to before it is maintained.
+// Writes postpone maintenance by at most ten times the delay. Zero disables maintenance
+// after writes, leaving only maintenance triggered with Run.
+func WithDelay(delay time.Duration) Option {
+	return func(s *Scheduler) {
+		s.delay = delay
+	}
+}
+
+// WithConcurrency sets the number of repositories maintained at once.
+func WithConcurrency(n int) Option {
+	return func(s *Scheduler) {
+		s.sem = make(chan struct{}, max(n, 1))
+	}
+}
+
+// WithPushTimeout sets the duration after which a push whose end was never reported,
+// as by a backend not setting up its context with receive.WithPush, no longer holds back maintenance.
+func WithPushTimeout(timeout time.Duration) Option {
+	return func(s *Scheduler) {
+		s.pushTimeout = timeout
+	}
+}
+
+// NewScheduler creates a new Scheduler with the provided options.
+func NewScheduler(opts ...Option) *Scheduler {
+	s := &Scheduler{
+		delay:       defaultDelay,
+		pushTimeout: defaultPushTimeout,
+		sem:         make(chan struct{}, defaultConcurrency),
+		repos:       map[string]*repoState{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// PreReceiveHook records a push to the repository in progress, holding back its maintenance
+// until the push of ctx ends, as set up with receive.WithPush, or times out.
+// It never rejects the push, and matches receive.PreReceiveHookFunc.
+func (s *Scheduler) PreReceiveHook(ctx context.Context, repoName string, updates []receive.RefUpdate) (bool, error) {
+	s.mut.Lock()
+	st := s.repoState(repoName)
+	s.nextToken++
+	token := s.nextToken
+	st.pushes[token] = time.Now()
+	s.mut.Unlock()
+
+	receive.OnPushEnd(ctx, func() { s.endPush(repoName, token) })
+	return true, nil
+}
+
+// endPush records the end of the push with token, whether it was applied, rejected or failed.
+func (s *Scheduler) endPush(repoName string, token uint64) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	st := s.repoState(repoName)
+	delete(st.pushes, token)
+	if st.waiting && len(st.tasks) != 0 && !st.running && s.activePushes(st) == 0 {
+		// Maintenance was waiting for the pushes to end.
+		st.due = time.Now()
+		st.status.NextRun = st.due
+		s.arm(repoName, st)
+	}
+}
+
+// PostReceiveHook records the writes of a push to the repository, and schedules its maintenance.
+// It matches receive.PostReceiveHookFunc.
+func (s *Scheduler) PostReceiveHook(ctx context.Context, repoName string, updates []receive.RefUpdate) error {
+	if len(updates) == 0 {
+		return nil
+	}
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	st := s.repoState(repoName)
+	st.status.Writes++
+	if s.delay <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+
+	if st.since.IsZero() {
+		st.since = now
+	}
+	due := now.Add(s.delay)
+	if limit := st.since.Add(maxDelayFactor * s.delay); limit.Before(due) {
+		due = limit
+	}
+	if len(st.tasks) != 0 && st.due.Before(due) {
+		// Keep the earlier run already scheduled, such as one requested with Run.
+		due = st.due
+	}
+	s.schedule(repoName, st, due, repository.MaintenanceTasks)
+	return nil
+}
+
+// Run schedules the given maintenance tasks, or all of them if none are given,
+// to run on the repository as soon as possible.
+func (s *Scheduler) Run(ctx context.Context, repoName string, tasks ...repository.MaintenanceTask) error {
+	for _, task := range tasks {
+		if !task.Valid() {
+			return fmt.Errorf("unknown maintenance task %q", task)
+		}
+	}
+	if len(tasks) == 0 {
+		tasks = repository.MaintenanceTasks
+	}
+
+	repoPath := s.storage.ResolvePath(repoName)
+	if repoPath == "" || !repository.IsRepository(repoPath) {
+		return repository.ErrRepositoryNotExists
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.schedule(repoName, s.repoState(repoName), time.Now(), tasks)
+	return nil
+}
+
+// Status returns the maintenance status of the repository.
+func (s *Scheduler) Status(repoName string) Status {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	st, ok := s.repos[repoName]
+	if !ok {
+		return Status{State: StateIdle}
+	}
+	status := st.status
+	status.LastTasks = slices.Clone(status.LastTasks)
+	status.ActivePushes = s.activePushes(st)
+	status.PendingTasks = pendingTasks(st)
+	return status
+}
+
+// repoState returns the state of the repository, creating it if needed. The caller must hold s.mut.
+func (s *Scheduler) repoState(repoName string) *repoState {
+	st, ok := s.repos[repoName]
+	if !ok {
+		st = &repoState{
+			status: Status{State: StateIdle},
+			tasks:  map[repository.MaintenanceTask]struct{}{},
+			pushes: map[uint64]time.Time{},
+		}
+		s.repos[repoName] = st
+	}
+	return st
+}
+
+// schedule adds tasks to the pending tasks of the repository, to run at due.
+// The caller must hold s.mut.
+func (s *Scheduler) schedule(repoName string, st *repoState, due time.Time, tasks []repository.MaintenanceTask) {
+	for _, task := range tasks {
+		st.tasks[task] = struct{}{}
+	}
+	st.due = due
+	st.status.NextRun = due
+	if st.running {
+		// The run in progress schedules the pending tasks when it ends.
+		return
+	}
+	st.status.State = StateScheduled
+	s.arm(repoName, st)
+}
+
+// arm starts the timer running the pending tasks of the repository at their due time.
+// The caller must hold s.mut.
+func (s *Scheduler) arm(repoName string, st *repoState) {
+	d := max(time.Until(st.due), 0)
+	if st.timer == nil {
+		st.timer = time.AfterFunc(d, func() { s.start(repoName) })
+		return
+	}
+	st.timer.Reset(d)
+}
+
+// activePushes returns the number of pushes to the repository in progress, dropping the
+// ones that timed out. The caller must hold s.mut.
+func (s *Scheduler) activePushes(st *repoState) int {
+	if s.pushTimeout > 0 {
+		expired := time.Now().Add(-s.pushTimeout)
+		maps.DeleteFunc(st.pushes, func(_ uint64, t time.Time) bool {
+			return t.Before(expired)
+		})
+	}
+	return len(st.pushes)
+}
+
+// start runs the pending tasks of the repository once a worker is free and no push is in progress.
+func (s *Scheduler) start(repoName string) {
+	s.sem <- struct{}{}
+	defer func() { <-s.sem }()
+
+	s.mut.Lock()
+	st := s.repos[repoName]
+	if st.running || len(st.tasks) == 0 || time.Now().Before(st.due) {
+		s.mut.Unlock()
+		return
+	}
+	if s.activePushes(st) != 0 {
+		st.waiting = true
+		st.due = time.Now().Add(pushRetryDelay)
+		st.status.NextRun = st.due
+		s.arm(repoName, st)
+		s.mut.Unlock()
+		return
+	}
+	tasks := pendingTasks(st)
+	clear(st.tasks)
+	st.waiting = false
+	st.running = true
+	st.since = time.Time{}
+	st.status.State = StateRunning
+	st.status.Writes = 0
+	st.status.NextRun = time.Time{}
+	s.mut.Unlock()
+
+	ctx := context.Background()
+	started := time.Now()
+	err := s.maintain(ctx, repoName, tasks)
+	duration := time.Since(started)
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	st.running = false
+	st.status.LastRun = started
+	st.status.LastDuration = duration.String()
+	st.status.LastTasks = tasks
+	st.status.LastError = ""
+	st.status.State = StateIdle
+	if err != nil {
+		st.status.LastError = err.Error()
+		st.status.State = StateFailed
+		slog.WarnContext(ctx, "Maintenance: failed", "repo", repoName, "tasks", tasks, "error", err)
+	} else {
+		slog.InfoContext(ctx, "Maintenance: done", "repo", repoName, "tasks", tasks, "duration", duration)
+	}
+	if len(st.tasks) != 0 {
+		st.status.State = StateScheduled
+		st.status.NextRun = st.due
+		s.arm(repoName, st)
+	}
+}
+
+func (s *Scheduler) maintain(ctx context.Context, repoName string, tasks []repository.MaintenanceTask) error {
+	repoPath := s.storage.ResolvePath(repoName)
+	if repoPath == "" {
+		return repository.ErrRepositoryNotExists
+	}
+	repo, err := repository.Open(repoPath)
+	if err != nil {
+		return err
+	}
+	return repo.Maintain(ctx, tasks...)
+}
+
+// pendingTasks returns the pending tasks of the repository in the order they are run.
+func pendingTasks(st *repoState) []repository.MaintenanceTask {
+	var tasks []repository.MaintenanceTask
+	for _, task := range repository.MaintenanceTasks {
+		if _, ok := st.tasks[task]; ok {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
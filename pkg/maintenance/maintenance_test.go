@@ -0,0 +1,145 @@
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matrixhub-ai/hfd/pkg/receive"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+	"github.com/matrixhub-ai/hfd/pkg/storage"
+)
+
+func waitState(t *testing.T, s *Scheduler, repoName string, want State) Status {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		status := s.Status(repoName)
+		if status.State == want {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected state %q, got %+v", want, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewStorage(storage.WithRootDir(t.TempDir()))
+	repoPath := store.ResolvePath("org/repo")
+	repo, err := repository.Init(ctx, repoPath, "main")
+	if err != nil {
+		t.Fatalf("init repository: %v", err)
+	}
+	for i := range 3 {
+		_, err := repo.CreateCommit(ctx, "main", fmt.Sprintf("commit %d", i), "test", "test@example.com", []repository.CommitOperation{
+			{Type: repository.CommitOperationAdd, Path: fmt.Sprintf("file-%d.txt", i), Content: []byte(fmt.Sprintf("content %d", i))},
+		}, "")
+		if err != nil {
+			t.Fatalf("create commit: %v", err)
+		}
+	}
+
+	s := NewScheduler(
+		WithStorage(store),
+		WithDelay(50*time.Millisecond),
+	)
+	updates := []receive.RefUpdate{receive.NewRefUpdate("0000000000000000000000000000000000000000", "1111111111111111111111111111111111111111", "refs/heads/main", "org/repo")}
+
+	// A push in progress holds back maintenance.
+	pushCtx, endPush := receive.WithPush(ctx)
+	if ok, err := s.PreReceiveHook(pushCtx, "org/repo", updates); err != nil || !ok {
+		t.Fatalf("pre-receive hook: %v, %v", ok, err)
+	}
+	if err := s.Run(ctx, "org/repo"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	status := s.Status("org/repo")
+	if status.State != StateScheduled || status.ActivePushes != 1 {
+		t.Fatalf("expected maintenance held back by the push, got %+v", status)
+	}
+
+	if err := s.PostReceiveHook(pushCtx, "org/repo", updates); err != nil {
+		t.Fatalf("post-receive hook: %v", err)
+	}
+	endPush()
+	status = waitState(t, s, "org/repo", StateIdle)
+	if status.LastError != "" || len(status.LastTasks) != len(repository.MaintenanceTasks) || status.Writes != 0 {
+		t.Fatalf("unexpected status after maintenance: %+v", status)
+	}
+
+	packs, err := filepath.Glob(filepath.Join(repoPath, "objects", "pack", "*.pack"))
+	if err != nil || len(packs) != 1 {
+		t.Fatalf("expected a single pack, got %v (%v)", packs, err)
+	}
+	for _, name := range []string{
+		filepath.Join("objects", "info", "commit-graph"),
+		filepath.Join("objects", "pack", "multi-pack-index"),
+	} {
+		if _, err := os.Stat(filepath.Join(repoPath, name)); err != nil {
+			t.Errorf("expected %s to be written: %v", name, err)
+		}
+	}
+
+	// The repository is readable with the new packs.
+	repo, err = repository.Open(repoPath)
+	if err != nil {
+		t.Fatalf("open repository: %v", err)
+	}
+	if _, err := repo.Blob("main", "file-2.txt"); err != nil {
+		t.Fatalf("read blob after maintenance: %v", err)
+	}
+
+	if err := s.Run(ctx, "org/missing"); err == nil {
+		t.Fatalf("expected an error for a missing repository")
+	}
+	if err := s.Run(ctx, "org/repo", "unknown"); err == nil {
+		t.Fatalf("expected an error for an unknown task")
+	}
+}
+
+func TestSchedulerRejectedPush(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewStorage(storage.WithRootDir(t.TempDir()))
+	if _, err := repository.Init(ctx, store.ResolvePath("org/repo"), "main"); err != nil {
+		t.Fatalf("init repository: %v", err)
+	}
+
+	s := NewScheduler(WithStorage(store), WithDelay(0))
+	updates := []receive.RefUpdate{receive.NewRefUpdate("0000000000000000000000000000000000000000", "1111111111111111111111111111111111111111", "refs/heads/main", "org/repo")}
+	firstCtx, endFirst := receive.WithPush(ctx)
+	secondCtx, endSecond := receive.WithPush(ctx)
+	for _, pushCtx := range []context.Context{firstCtx, secondCtx} {
+		if ok, err := s.PreReceiveHook(pushCtx, "org/repo", updates); err != nil || !ok {
+			t.Fatalf("pre-receive hook: %v, %v", ok, err)
+		}
+	}
+	if err := s.Run(ctx, "org/repo", repository.MaintenanceCommitGraph); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if status := s.Status("org/repo"); status.State != StateScheduled || status.ActivePushes != 2 {
+		t.Fatalf("expected maintenance held back by the pushes, got %+v", status)
+	}
+
+	// The end of a push releases its own hold only, however many times it is reported.
+	endSecond()
+	endSecond()
+	time.Sleep(100 * time.Millisecond)
+	if status := s.Status("org/repo"); status.State != StateScheduled || status.ActivePushes != 1 {
+		t.Fatalf("expected maintenance held back by the first push, got %+v", status)
+	}
+
+	// A rejected push no longer holds back maintenance, and does not count as a write.
+	endFirst()
+	status := waitState(t, s, "org/repo", StateIdle)
+	if status.ActivePushes != 0 || status.Writes != 0 || len(status.LastTasks) != 1 {
+		t.Fatalf("unexpected status after the rejected push: %+v", status)
+	}
+}
@@ -0,0 +1,102 @@
+package mirror
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+)
+
+// ErrUpstreamUnavailable is returned when the upstream source of a mirror cannot be used,
+// either because the mirror is running offline, the upstream is unreachable, or the circuit
+// breaker for the upstream is open after repeated failures.
+var ErrUpstreamUnavailable = errors.New("upstream unavailable")
+
+const (
+	defaultBreakerThreshold = 3
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// breaker is a circuit breaker for a single upstream host.
+// After threshold consecutive failures it opens for the cooldown period, during which
+// no requests are sent upstream. Once the cooldown expires requests are let through again,
+// and a single further failure reopens it until a request succeeds.
+type breaker struct {
+	mut       sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+func (b *breaker) allow(now time.Time) bool {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	if b.openUntil.IsZero() || now.After(b.openUntil) {
+		return true
+	}
+	return false
+}
+
+func (b *breaker) success() {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+func (b *breaker) failure(now time.Time, threshold int, cooldown time.Duration) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	b.failures++
+	if b.failures >= threshold {
+		b.openUntil = now.Add(cooldown)
+	}
+}
+
+// upstreamKey returns the key used to track the health of the upstream serving sourceURL.
+func upstreamKey(sourceURL string) string {
+	u, err := url.Parse(sourceURL)
+	if err != nil || u.Host == "" {
+		return sourceURL
+	}
+	return u.Host
+}
+
+func (m *Mirror) breakerFor(sourceURL string) *breaker {
+	b, _ := m.breakers.LoadOrStore(upstreamKey(sourceURL), &breaker{})
+	return b.(*breaker)
+}
+
+// upstreamAvailable reports whether requests may be sent to the upstream of sourceURL.
+func (m *Mirror) upstreamAvailable(sourceURL string) bool {
+	if m.offline {
+		return false
+	}
+	return m.breakerFor(sourceURL).allow(time.Now())
+}
+
+// recordUpstream updates the circuit breaker of the upstream of sourceURL with the result of a request.
+// Errors not caused by the upstream being unreachable do not count as failures.
+func (m *Mirror) recordUpstream(sourceURL string, err error) {
+	if err == nil {
+		m.breakerFor(sourceURL).success()
+		return
+	}
+	if isUnreachable(err) {
+		m.breakerFor(sourceURL).failure(time.Now(), m.breakerThreshold, m.breakerCooldown)
+	}
+}
+
+// isUnreachable reports whether err was caused by the upstream being unreachable.
+func isUnreachable(err error) bool {
+	if errors.Is(err, repository.ErrRemoteUnreachable) || errors.Is(err, ErrUpstreamUnavailable) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,365 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+	"github.com/matrixhub-ai/hfd/pkg/storage"
+)
+
+// EvictionPolicy selects which cached LFS objects are evicted first when the cache exceeds its capacity.
+type EvictionPolicy string
+
+const (
+	// EvictionLRU evicts the least recently accessed objects first.
+	EvictionLRU EvictionPolicy = "lru"
+	// EvictionLFU evicts the least frequently accessed objects first, breaking ties by access time.
+	EvictionLFU EvictionPolicy = "lfu"
+)
+
+// Pin protects the LFS objects of a mirrored repository from eviction.
+// An empty Revision pins the objects referenced by every branch of the repository.
+type Pin struct {
+	RepoName string
+	Revision string
+}
+
+// ParsePin parses a pin in the form "repo" or "repo@revision".
+func ParsePin(s string) Pin {
+	repoName, rev, _ := strings.Cut(s, "@")
+	return Pin{RepoName: strings.Trim(repoName, "/"), Revision: rev}
+}
+
+// cacheEntry tracks the access statistics of a cached LFS object.
+type cacheEntry struct {
+	Size       int64     `json:"size"`
+	LastAccess time.Time `json:"lastAccess"`
+	Hits       int64     `json:"hits"`
+}
+
+// lfsCache accounts the LFS objects fetched from upstream and evicts them when over capacity.
+type lfsCache struct {
+	mut      sync.Mutex
+	entries  map[string]*cacheEntry
+	size     int64
+	evicting atomic.Bool
+}
+
+// WithCacheCapacity bounds the total size in bytes of LFS objects fetched from upstream.
+// When the capacity is exceeded, cached objects are evicted according to policy, except objects
+// referenced by non-mirror repositories or pinned revisions. A zero capacity disables eviction.
+func WithCacheCapacity(capacity int64, policy EvictionPolicy) Option {
+	return func(m *Mirror) {
+		m.cacheCapacity = capacity
+		m.cachePolicy = policy
+	}
+}
+
+// WithCachePins pins repositories or revisions whose LFS objects must never be evicted.
+func WithCachePins(pins ...Pin) Option {
+	return func(m *Mirror) {
+		m.cachePins = append(m.cachePins, pins...)
+	}
+}
+
+// WithCacheIndexFile persists the access statistics of cached objects to path,
+// so eviction decisions survive restarts.
+func WithCacheIndexFile(path string) Option {
+	return func(m *Mirror) {
+		m.cacheIndexFile = path
+	}
+}
+
+// WithStorage sets the storage used to find the repositories whose LFS objects are protected from eviction.
+func WithStorage(storage *storage.Storage) Option {
+	return func(m *Mirror) {
+		m.storage = storage
+	}
+}
+
+// WithLFSStorage sets the LFS storage that cached objects are evicted from.
+func WithLFSStorage(storage lfs.Storage) Option {
+	return func(m *Mirror) {
+		m.lfsStorage = storage
+	}
+}
+
+func (m *Mirror) loadCacheIndex() {
+	m.cache.entries = map[string]*cacheEntry{}
+	if m.cacheIndexFile == "" {
+		return
+	}
+	data, err := os.ReadFile(m.cacheIndexFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("Failed to read LFS cache index", "path", m.cacheIndexFile, "error", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &m.cache.entries); err != nil {
+		slog.Warn("Failed to parse LFS cache index", "path", m.cacheIndexFile, "error", err)
+		m.cache.entries = map[string]*cacheEntry{}
+		return
+	}
+	for _, e := range m.cache.entries {
+		m.cache.size += e.Size
+	}
+}
+
+// saveCacheIndex writes the cache index to disk. The caller must hold m.cache.mut.
+func (m *Mirror) saveCacheIndex() {
+	if m.cacheIndexFile == "" {
+		return
+	}
+	data, err := json.Marshal(m.cache.entries)
+	if err != nil {
+		slog.Warn("Failed to encode LFS cache index", "error", err)
+		return
+	}
+	tmp := m.cacheIndexFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		slog.Warn("Failed to write LFS cache index", "path", tmp, "error", err)
+		return
+	}
+	if err := os.Rename(tmp, m.cacheIndexFile); err != nil {
+		slog.Warn("Failed to write LFS cache index", "path", m.cacheIndexFile, "error", err)
+	}
+}
+
+// trackLFS records an LFS object fetched from upstream and starts an eviction if the cache is over capacity.
+func (m *Mirror) trackLFS(ctx context.Context, oid string, size int64) {
+	if m.cacheCapacity <= 0 {
+		return
+	}
+
+	m.cache.mut.Lock()
+	e, ok := m.cache.entries[oid]
+	if !ok {
+		e = &cacheEntry{Size: size}
+		m.cache.entries[oid] = e
+		m.cache.size += size
+	}
+	e.LastAccess = time.Now()
+	e.Hits++
+	over := m.cache.size > m.cacheCapacity
+	if !ok {
+		m.saveCacheIndex()
+	}
+	m.cache.mut.Unlock()
+
+	if over && m.cache.evicting.CompareAndSwap(false, true) {
+		go func() {
+			defer m.cache.evicting.Store(false)
+			if err := m.Evict(context.WithoutCancel(ctx)); err != nil {
+				slog.WarnContext(ctx, "Failed to evict cached LFS objects", "error", err)
+			}
+		}()
+	}
+}
+
+// uncachedObjects returns the objects that will be fetched from upstream and so must be tracked by the cache:
+// objects already tracked, and objects missing from the LFS storage. Untracked objects present in the
+// LFS storage were not fetched from upstream and are left alone.
+func (m *Mirror) uncachedObjects(objects []lfs.LFSObject) []lfs.LFSObject {
+	if m.cacheCapacity <= 0 {
+		return nil
+	}
+	var result []lfs.LFSObject
+	for _, obj := range objects {
+		m.cache.mut.Lock()
+		_, tracked := m.cache.entries[obj.Oid]
+		m.cache.mut.Unlock()
+		if tracked || m.lfsStorage == nil || !m.lfsStorage.Exists(obj.Oid) {
+			result = append(result, obj)
+		}
+	}
+	return result
+}
+
+// trackFetch records the objects of a fetch started from upstream.
+func (m *Mirror) trackFetch(ctx context.Context, objects []lfs.LFSObject) {
+	for _, obj := range objects {
+		m.trackLFS(ctx, obj.Oid, obj.Size)
+	}
+}
+
+// Touch records an access to a cached LFS object. Objects not fetched from upstream are ignored.
+func (m *Mirror) Touch(oid string) {
+	if m.cacheCapacity <= 0 {
+		return
+	}
+
+	m.cache.mut.Lock()
+	defer m.cache.mut.Unlock()
+	if e, ok := m.cache.entries[oid]; ok {
+		e.LastAccess = time.Now()
+		e.Hits++
+	}
+}
+
+// CacheSize returns the total size in bytes of the tracked LFS objects fetched from upstream.
+func (m *Mirror) CacheSize() int64 {
+	m.cache.mut.Lock()
+	defer m.cache.mut.Unlock()
+	return m.cache.size
+}
+
+// Evict removes cached LFS objects until the cache fits its capacity.
+// Objects referenced by non-mirror repositories, pinned revisions or in-flight fetches are kept.
+func (m *Mirror) Evict(ctx context.Context) error {
+	if m.cacheCapacity <= 0 {
+		return nil
+	}
+	deleter, ok := m.lfsStorage.(lfs.Deleter)
+	if !ok {
+		return fmt.Errorf("LFS storage does not support deleting objects")
+	}
+
+	if m.CacheSize() <= m.cacheCapacity {
+		return nil
+	}
+
+	protected, err := m.protectedLFSObjects(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to collect protected LFS objects: %w", err)
+	}
+
+	type candidate struct {
+		oid string
+		cacheEntry
+	}
+	m.cache.mut.Lock()
+	candidates := make([]candidate, 0, len(m.cache.entries))
+	for oid, e := range m.cache.entries {
+		if protected[oid] {
+			continue
+		}
+		candidates = append(candidates, candidate{oid: oid, cacheEntry: *e})
+	}
+	m.cache.mut.Unlock()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if m.cachePolicy == EvictionLFU && a.Hits != b.Hits {
+			return a.Hits < b.Hits
+		}
+		return a.LastAccess.Before(b.LastAccess)
+	})
+
+	var evicted int
+	for _, c := range candidates {
+		if m.CacheSize() <= m.cacheCapacity {
+			break
+		}
+		if m.lfsTeeCache != nil && m.lfsTeeCache.Get(c.oid) != nil {
+			continue
+		}
+		if err := deleter.Delete(c.oid); err != nil && !os.IsNotExist(err) {
+			slog.WarnContext(ctx, "Failed to evict cached LFS object", "oid", c.oid, "error", err)
+			continue
+		}
+
+		m.cache.mut.Lock()
+		if e, ok := m.cache.entries[c.oid]; ok {
+			m.cache.size -= e.Size
+			delete(m.cache.entries, c.oid)
+		}
+		m.cache.mut.Unlock()
+		evicted++
+	}
+
+	m.cache.mut.Lock()
+	m.saveCacheIndex()
+	size := m.cache.size
+	m.cache.mut.Unlock()
+
+	slog.InfoContext(ctx, "Evicted cached LFS objects", "count", evicted, "size", size, "capacity", m.cacheCapacity)
+	return nil
+}
+
+// protectedLFSObjects returns the OIDs of LFS objects referenced by local repositories or pinned revisions.
+// A repository is local unless it was created as a mirror, see repository.IsMirror.
+func (m *Mirror) protectedLFSObjects(ctx context.Context) (map[string]bool, error) {
+	protected := map[string]bool{}
+	if m.storage == nil {
+		return protected, nil
+	}
+
+	add := func(ptrs []*lfs.Pointer) {
+		for _, ptr := range ptrs {
+			protected[ptr.OID()] = true
+		}
+	}
+
+	root := m.storage.RepositoriesDir()
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() || !strings.HasSuffix(d.Name(), ".git") {
+			return nil
+		}
+		if !repository.IsRepository(path) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		repoName := strings.TrimSuffix(filepath.ToSlash(rel), ".git")
+
+		repo, err := repository.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open repository %q: %w", repoName, err)
+		}
+
+		// The source func may treat every name as a mirror (e.g. proxy mode),
+		// so repositories created locally are told apart by their own config
+		if !repo.IsMirror() {
+			ptrs, err := repo.ScanLFSPointers()
+			if err != nil {
+				return fmt.Errorf("failed to scan LFS pointers of %q: %w", repoName, err)
+			}
+			add(ptrs)
+			return filepath.SkipDir
+		}
+
+		for _, pin := range m.cachePins {
+			if pin.RepoName != repoName {
+				continue
+			}
+			var ptrs []*lfs.Pointer
+			if pin.Revision == "" {
+				ptrs, err = repo.ScanLFSPointers()
+			} else {
+				ptrs, err = repo.ScanLFSPointersAt(pin.Revision)
+			}
+			if err != nil {
+				slog.WarnContext(ctx, "Failed to scan LFS pointers of pinned revision", "repo", repoName, "revision", pin.Revision, "error", err)
+				continue
+			}
+			add(ptrs)
+		}
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+	return protected, nil
+}
@@ -0,0 +1,115 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+	"github.com/matrixhub-ai/hfd/pkg/storage"
+)
+
+func TestEvict(t *testing.T) {
+	ctx := context.Background()
+
+	store := storage.NewStorage(storage.WithRootDir(t.TempDir()))
+	lfsStorage := lfs.NewLocal(store.LFSDir())
+
+	put := func(t *testing.T, content string) string {
+		t.Helper()
+		sum := sha256.Sum256([]byte(content))
+		oid := hex.EncodeToString(sum[:])
+		if err := lfsStorage.Put(oid, bytes.NewReader([]byte(content)), int64(len(content))); err != nil {
+			t.Fatalf("put LFS object: %v", err)
+		}
+		return oid
+	}
+
+	initRepo := func(t *testing.T, name, oid string) *repository.Repository {
+		t.Helper()
+		repo, err := repository.Init(ctx, filepath.Join(store.RepositoriesDir(), "org", name+".git"), "main")
+		if err != nil {
+			t.Fatalf("init repository: %v", err)
+		}
+		pointer := fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize 4\n", oid)
+		if _, err := repo.CreateCommit(ctx, "main", "add pointer", "test", "test@example.com", []repository.CommitOperation{
+			{Type: repository.CommitOperationAdd, Path: "a.bin", Content: []byte(pointer)},
+		}, ""); err != nil {
+			t.Fatalf("create commit: %v", err)
+		}
+		return repo
+	}
+
+	// A local repository references object a, so it must never be evicted,
+	// while object c is only referenced by a mirror.
+	a, b, c := put(t, "aaaa"), put(t, "bbbb"), put(t, "cccc")
+	initRepo(t, "local", a)
+	mirrored := initRepo(t, "mirrored", c)
+	if err := mirrored.MarkMirror(ctx, "https://huggingface.co/org/mirrored.git"); err != nil {
+		t.Fatalf("mark mirror: %v", err)
+	}
+
+	newMirror := func(policy EvictionPolicy) *Mirror {
+		return NewMirror(
+			// As in proxy mode, every repository name is a mirror candidate
+			WithMirrorSourceFunc(func(ctx context.Context, repoName string) (string, bool, error) {
+				return "https://huggingface.co/" + repoName, true, nil
+			}),
+			WithCacheCapacity(8, policy),
+			WithStorage(store),
+			WithLFSStorage(lfsStorage),
+		)
+	}
+
+	t.Run("lru", func(t *testing.T) {
+		m := newMirror(EvictionLRU)
+		m.cache.evicting.Store(true) // evict synchronously below
+		m.trackLFS(ctx, a, 4)
+		m.trackLFS(ctx, c, 4)
+		time.Sleep(time.Millisecond)
+		m.trackLFS(ctx, b, 4)
+
+		if err := m.Evict(ctx); err != nil {
+			t.Fatalf("evict: %v", err)
+		}
+		if !lfsStorage.Exists(a) {
+			t.Errorf("expected object referenced by a local repository to be kept")
+		}
+		if !lfsStorage.Exists(b) {
+			t.Errorf("expected recently used object to be kept")
+		}
+		if lfsStorage.Exists(c) {
+			t.Errorf("expected least recently used object to be evicted")
+		}
+		if got := m.CacheSize(); got != 8 {
+			t.Errorf("expected cache size 8, got %d", got)
+		}
+	})
+
+	t.Run("lfu", func(t *testing.T) {
+		d, e := put(t, "dddd"), put(t, "eeee")
+		m := newMirror(EvictionLFU)
+		m.cache.evicting.Store(true)
+		m.trackLFS(ctx, d, 4)
+		m.trackLFS(ctx, e, 4)
+		m.trackLFS(ctx, b, 4)
+		m.Touch(d)
+		m.Touch(b)
+
+		if err := m.Evict(ctx); err != nil {
+			t.Fatalf("evict: %v", err)
+		}
+		if lfsStorage.Exists(e) {
+			t.Errorf("expected least frequently used object to be evicted")
+		}
+		if !lfsStorage.Exists(d) || !lfsStorage.Exists(b) {
+			t.Errorf("expected frequently used objects to be kept")
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/matrixhub-ai/hfd/internal/utils"
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+)
+
+// WithLazyEndpoint enables the resolve-only lazy mode. Until a git client clones a mirrored
+// repository, HuggingFace API metadata and file download requests for it are answered by
+// forwarding them to endpoint (e.g. https://huggingface.co) instead of mirroring the full git history.
+func WithLazyEndpoint(endpoint string) Option {
+	return func(m *Mirror) {
+		m.lazyEndpoint = strings.TrimSuffix(endpoint, "/")
+		client := *utils.HTTPClient
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+		m.lazyClient = &client
+	}
+}
+
+// IsLazy reports whether requests for the repository should be forwarded to the lazy endpoint.
+// This is the case when lazy mode is enabled, the repository is a mirror and no full git mirror exists
+// locally yet. Once the repository has been mirrored, it is served from the local copy.
+func (m *Mirror) IsLazy(ctx context.Context, repoPath, repoName string) (bool, error) {
+	if m.lazyEndpoint == "" || m.offline {
+		return false, nil
+	}
+	if repository.IsRepository(repoPath) {
+		return false, nil
+	}
+	return m.IsMirror(ctx, repoName)
+}
+
+// LazyRequest sends a request for uri (path and query) to the lazy endpoint.
+// Redirects are returned to the caller instead of being followed, so LFS downloads can be intercepted.
+func (m *Mirror) LazyRequest(ctx context.Context, method, uri string, header http.Header) (*http.Response, error) {
+	if !m.upstreamAvailable(m.lazyEndpoint) {
+		return nil, fmt.Errorf("%w: %s", ErrUpstreamUnavailable, m.lazyEndpoint)
+	}
+
+	target := uri
+	if strings.HasPrefix(uri, "/") {
+		target = m.lazyEndpoint + uri
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := m.lazyClient.Do(req)
+	if err == nil && resp.StatusCode >= http.StatusInternalServerError {
+		// Server errors count as failures of the upstream, though the response is still passed through
+		m.recordUpstream(m.lazyEndpoint, fmt.Errorf("%w: %s", ErrUpstreamUnavailable, resp.Status))
+	} else {
+		m.recordUpstream(m.lazyEndpoint, err)
+	}
+	if err != nil {
+		if isUnreachable(err) {
+			return nil, fmt.Errorf("%w: %w", ErrUpstreamUnavailable, err)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// StartLFSFetchURL starts fetching a single LFS object from a direct download URL into the tee cache.
+func (m *Mirror) StartLFSFetchURL(ctx context.Context, oid string, size int64, href string) error {
+	if m.lfsTeeCache == nil {
+		return fmt.Errorf("LFS cache is not configured")
+	}
+	uncached := m.uncachedObjects([]lfs.LFSObject{{Oid: oid, Size: size}})
+	err := m.lfsTeeCache.StartFetchURL(ctx, oid, size, href)
+	if err != nil {
+		if isUnreachable(err) {
+			return fmt.Errorf("%w: %w", ErrUpstreamUnavailable, err)
+		}
+		return err
+	}
+	m.trackFetch(ctx, uncached)
+	return nil
+}
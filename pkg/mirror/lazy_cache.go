@@ -0,0 +1,243 @@
+package mirror
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxLazyFileSize is the size of the largest regular file cached by the lazy mode.
+// Larger files are streamed from upstream on every request.
+const maxLazyFileSize = 16 << 20
+
+// lazyFileCache stores the regular files resolved through the lazy endpoint. A file is keyed by
+// the repository, the commit it was resolved at and the requested path, which never change content.
+type lazyFileCache struct {
+	dir      string
+	capacity int64
+
+	mut     sync.Mutex
+	size    int64
+	scanned bool
+}
+
+// lazyFileMeta is stored next to a cached file, for its responses to carry the upstream headers.
+type lazyFileMeta struct {
+	ETag        string `json:"etag"`
+	ContentType string `json:"contentType"`
+}
+
+// LazyFile is a regular file cached by the lazy mode.
+type LazyFile struct {
+	*os.File
+	ETag        string
+	ContentType string
+	ModTime     time.Time
+}
+
+// WithLazyFileCache caches the regular files resolved through the lazy endpoint in dir, so they are
+// served locally once fetched. A positive capacity bounds the total size in bytes of the cached files,
+// evicting the least recently used ones.
+func WithLazyFileCache(dir string, capacity int64) Option {
+	return func(m *Mirror) {
+		m.lazyFiles = &lazyFileCache{dir: dir, capacity: capacity}
+	}
+}
+
+// IsCommitHash reports whether rev is a full commit hash, whose files never change.
+func IsCommitHash(rev string) bool {
+	if len(rev) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(rev)
+	return err == nil
+}
+
+func (c *lazyFileCache) path(repoName, commit, revpath string) string {
+	sum := sha256.Sum256([]byte(repoName + "\x00" + commit + "\x00" + revpath))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// OpenLazyFile returns the cached regular file resolved from revpath at commit, or nil when it is not cached.
+func (m *Mirror) OpenLazyFile(repoName, commit, revpath string) *LazyFile {
+	if m.lazyFiles == nil || !IsCommitHash(commit) {
+		return nil
+	}
+	path := m.lazyFiles.path(repoName, commit, revpath)
+	data, err := os.ReadFile(path + ".json")
+	if err != nil {
+		return nil
+	}
+	var meta lazyFileMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil
+	}
+	// The modification time orders the files for eviction
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return &LazyFile{File: f, ETag: meta.ETag, ContentType: meta.ContentType, ModTime: stat.ModTime()}
+}
+
+// TeeLazyFile returns the body of resp, a regular file resolved from revpath at commit, caching it as it is read.
+// The file is only cached once its body is read completely.
+func (m *Mirror) TeeLazyFile(repoName, commit, revpath string, resp *http.Response) io.ReadCloser {
+	if m.lazyFiles == nil || !IsCommitHash(commit) || resp.StatusCode != http.StatusOK || resp.ContentLength > maxLazyFileSize {
+		return resp.Body
+	}
+	path := m.lazyFiles.path(repoName, commit, revpath)
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		slog.Warn("Failed to create lazy file cache directory", "path", filepath.Dir(path), "error", err)
+		return resp.Body
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "lazy_tmp_")
+	if err != nil {
+		slog.Warn("Failed to create lazy file cache entry", "path", path, "error", err)
+		return resp.Body
+	}
+	return &lazyFileTee{
+		cache:  m.lazyFiles,
+		body:   resp.Body,
+		tmp:    tmp,
+		path:   path,
+		size:   resp.ContentLength,
+		meta:   lazyFileMeta{ETag: resp.Header.Get("ETag"), ContentType: resp.Header.Get("Content-Type")},
+		reader: io.TeeReader(resp.Body, tmp),
+	}
+}
+
+type lazyFileTee struct {
+	cache   *lazyFileCache
+	body    io.ReadCloser
+	tmp     *os.File
+	path    string
+	size    int64 // -1 when unknown
+	meta    lazyFileMeta
+	reader  io.Reader
+	read    int64
+	failed  bool
+	reached bool
+}
+
+func (t *lazyFileTee) Read(p []byte) (int, error) {
+	n, err := t.reader.Read(p)
+	t.read += int64(n)
+	switch {
+	case err == io.EOF:
+		t.reached = true
+	case err != nil:
+		t.failed = true
+	case t.read > maxLazyFileSize && !t.failed:
+		// Too large to be cached, the rest is only streamed
+		t.failed = true
+		t.reader = t.body
+	}
+	return n, err
+}
+
+// Close closes the upstream body, and adds the file to the cache when it was read completely.
+func (t *lazyFileTee) Close() error {
+	err := t.body.Close()
+	_ = t.tmp.Close()
+	defer func() {
+		_ = os.Remove(t.tmp.Name())
+	}()
+	// The length of compressed responses is only known once read
+	if t.failed || !t.reached || (t.size >= 0 && t.read != t.size) {
+		return err
+	}
+
+	data, merr := json.Marshal(t.meta)
+	if merr == nil {
+		merr = os.WriteFile(t.path+".json", data, 0o640)
+	}
+	if merr == nil {
+		merr = os.Rename(t.tmp.Name(), t.path)
+	}
+	if merr != nil {
+		slog.Warn("Failed to cache lazy file", "path", t.path, "error", merr)
+		return err
+	}
+	t.cache.add(t.read)
+	return err
+}
+
+// add accounts a file added to the cache, evicting the least recently used files when over capacity.
+func (c *lazyFileCache) add(size int64) {
+	if c.capacity <= 0 {
+		return
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if !c.scanned {
+		// The files cached before a restart are counted once; they include the file just added
+		c.size = 0
+		for _, f := range c.files() {
+			c.size += f.size
+		}
+		c.scanned = true
+	} else {
+		c.size += size
+	}
+	if c.size <= c.capacity {
+		return
+	}
+
+	files := c.files()
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	for _, f := range files {
+		if c.size <= c.capacity {
+			break
+		}
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			slog.Warn("Failed to evict lazy file", "path", f.path, "error", err)
+			continue
+		}
+		_ = os.Remove(f.path + ".json")
+		c.size -= f.size
+	}
+}
+
+type lazyCachedFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// files lists the cached files.
+func (c *lazyFileCache) files() []lazyCachedFile {
+	var files []lazyCachedFile
+	_ = filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasSuffix(path, ".json") || strings.HasPrefix(d.Name(), "lazy_tmp_") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, lazyCachedFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	return files
+}
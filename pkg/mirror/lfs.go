@@ -2,6 +2,7 @@ package mirror
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/matrixhub-ai/hfd/pkg/lfs"
 )
@@ -21,9 +22,20 @@ func (m *Mirror) StartLFSFetch(ctx context.Context, repoName string, objects []l
 		return "", false, nil
 	}
 
-	if err := m.lfsTeeCache.StartFetch(ctx, sourceURL, objects); err != nil {
+	if !m.upstreamAvailable(sourceURL) {
+		return sourceURL, false, fmt.Errorf("%w: LFS objects are not cached locally", ErrUpstreamUnavailable)
+	}
+
+	uncached := m.uncachedObjects(objects)
+	err = m.lfsTeeCache.StartFetch(ctx, sourceURL, objects)
+	m.recordUpstream(sourceURL, err)
+	if err != nil {
+		if isUnreachable(err) {
+			return sourceURL, false, fmt.Errorf("%w: %w", ErrUpstreamUnavailable, err)
+		}
 		return sourceURL, false, err
 	}
+	m.trackFetch(ctx, uncached)
 
 	return sourceURL, true, nil
 }
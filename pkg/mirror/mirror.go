@@ -4,12 +4,14 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"sync"
 	"time"
 
 	"github.com/matrixhub-ai/hfd/pkg/lfs"
 	"github.com/matrixhub-ai/hfd/pkg/receive"
 	"github.com/matrixhub-ai/hfd/pkg/repository"
+	"github.com/matrixhub-ai/hfd/pkg/storage"
 	"golang.org/x/sync/singleflight"
 )
 
@@ -21,8 +23,23 @@ type Mirror struct {
 	postReceiveHookFunc receive.PostReceiveHookFunc
 	lfsTeeCache         *lfs.TeeCache
 	ttl                 time.Duration
+	filter              string
 	group               singleflight.Group
 	lastSync            sync.Map // map[string]time.Time, keyed by repoName
+	offline             bool
+	breakerThreshold    int
+	breakerCooldown     time.Duration
+	breakers            sync.Map // map[string]*breaker, keyed by upstream host
+	lazyEndpoint        string
+	lazyClient          *http.Client
+	lazyFiles           *lazyFileCache
+	storage             *storage.Storage
+	lfsStorage          lfs.Storage
+	cacheCapacity       int64
+	cachePolicy         EvictionPolicy
+	cachePins           []Pin
+	cacheIndexFile      string
+	cache               lfsCache
 }
 
 // Option defines a functional option for configuring the Mirror.
@@ -71,12 +88,42 @@ func WithLFSCache(tc *lfs.TeeCache) Option {
 	}
 }
 
+// WithOffline makes the mirror serve only its on-disk copies and never contact the upstream source.
+// Repositories and LFS objects that are not cached locally are reported as ErrUpstreamUnavailable.
+func WithOffline(offline bool) Option {
+	return func(m *Mirror) {
+		m.offline = offline
+	}
+}
+
+// WithCircuitBreaker configures the circuit breaker guarding upstream requests.
+// After threshold consecutive network failures, the upstream is considered down for the
+// cooldown period and the mirror degrades to serving its on-disk copies.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(m *Mirror) {
+		m.breakerThreshold = threshold
+		m.breakerCooldown = cooldown
+	}
+}
+
+// WithPartialCloneFilter makes new mirrors partial clones fetching only the objects matching filter
+// (e.g. "blob:none" or "blob:limit=1m"); the objects left out are fetched from upstream on first use.
+func WithPartialCloneFilter(filter string) Option {
+	return func(m *Mirror) {
+		m.filter = filter
+	}
+}
+
 // NewMirror creates a new Mirror with the provided options.
 func NewMirror(opts ...Option) *Mirror {
-	m := &Mirror{}
+	m := &Mirror{
+		breakerThreshold: defaultBreakerThreshold,
+		breakerCooldown:  defaultBreakerCooldown,
+	}
 	for _, opt := range opts {
 		opt(m)
 	}
+	m.loadCacheIndex()
 	return m
 }
 
@@ -101,6 +148,8 @@ func WithSyncMirrorSourceURL(url string) func(*syncOption) {
 }
 
 // OpenOrSync opens the mirror repository at repoPath, syncing with the source URL if necessary based on TTL.
+// When the upstream is unreachable the existing on-disk copy is served as is; if there is no local copy
+// an error wrapping ErrUpstreamUnavailable is returned.
 func (m *Mirror) OpenOrSync(ctx context.Context, repoPath, repoName string, opts ...func(*syncOption)) (*repository.Repository, error) {
 	var opt syncOption
 	for _, o := range opts {
@@ -123,11 +172,18 @@ func (m *Mirror) OpenOrSync(ctx context.Context, repoPath, repoName string, opts
 		if !m.shouldSync(repoPath) {
 			return repo, nil
 		}
+		if !m.upstreamAvailable(opt.SourceURL) {
+			return repo, nil
+		}
 		_, err, _ := m.group.Do(repoPath, func() (any, error) {
 			defer m.markSynced(repoPath)
 			return nil, m.syncMirror(ctx, repo, repoName, opt.SourceURL)
 		})
 		if err != nil {
+			if isUnreachable(err) {
+				slog.WarnContext(ctx, "Upstream unreachable, serving local mirror copy", "repo", repoName, "error", err)
+				return repo, nil
+			}
 			return nil, err
 		}
 		return repo, nil
@@ -137,12 +193,25 @@ func (m *Mirror) OpenOrSync(ctx context.Context, repoPath, repoName string, opts
 		return nil, err
 	}
 
+	if !m.upstreamAvailable(opt.SourceURL) {
+		return nil, fmt.Errorf("%w: repository %q is not cached locally", ErrUpstreamUnavailable, repoName)
+	}
+
 	v, err, _ := m.group.Do(repoPath, func() (any, error) {
 		repo, err = repository.InitMirror(ctx, repoPath, opt.SourceURL)
+		m.recordUpstream(opt.SourceURL, err)
 		if err != nil {
+			if isUnreachable(err) {
+				return nil, fmt.Errorf("%w: repository %q is not cached locally: %w", ErrUpstreamUnavailable, repoName, err)
+			}
 			slog.WarnContext(ctx, "Failed to initialize mirror repository", "repo", repoName, "error", err)
 			return nil, repository.ErrRepositoryNotExists
 		}
+		if m.filter != "" {
+			if err := repo.EnablePartialClone(ctx, opt.SourceURL, m.filter); err != nil {
+				return nil, err
+			}
+		}
 		defer m.markSynced(repoPath)
 		err = m.syncMirror(ctx, repo, repoName, opt.SourceURL)
 		if err != nil {
@@ -180,6 +249,10 @@ func (m *Mirror) Sync(ctx context.Context, repoPath, repoName string, opts ...fu
 		return fmt.Errorf("failed to open mirror repository: %w", err)
 	}
 
+	if !m.upstreamAvailable(opt.SourceURL) {
+		return fmt.Errorf("%w: cannot sync repository %q", ErrUpstreamUnavailable, repoName)
+	}
+
 	_, err, _ = m.group.Do(repoPath, func() (any, error) {
 		defer m.markSynced(repoPath)
 		err = m.syncMirror(ctx, repo, repoName, opt.SourceURL)
@@ -237,6 +310,7 @@ func (m *Mirror) markSynced(repoPath string) {
 // syncMirror syncs a mirror and fires post-receive hooks for any ref changes.
 func (m *Mirror) syncMirror(ctx context.Context, repo *repository.Repository, repoName string, sourceURL string) error {
 	remoteRefsMap, err := repo.RemoteRefs(ctx, sourceURL)
+	m.recordUpstream(sourceURL, err)
 	if err != nil {
 		return fmt.Errorf("failed to list remote refs: %w", err)
 	}
@@ -264,14 +338,18 @@ func (m *Mirror) syncMirror(ctx context.Context, repo *repository.Repository, re
 		return nil
 	}
 	if m.preReceiveHookFunc != nil {
-		if ok, err := m.preReceiveHookFunc(ctx, repoName, preReceiveUpdates); err != nil {
+		pushCtx, endPush := receive.WithPush(ctx)
+		defer endPush()
+		if ok, err := m.preReceiveHookFunc(pushCtx, repoName, preReceiveUpdates); err != nil {
 			return fmt.Errorf("pre-receive hook error: %w", err)
 		} else if !ok {
 			return nil
 		}
 	}
 
-	if err := repo.SyncMirrorRefs(ctx, sourceURL, refsFilter); err != nil {
+	err = repo.SyncMirrorRefs(ctx, sourceURL, refsFilter)
+	m.recordUpstream(sourceURL, err)
+	if err != nil {
 		return fmt.Errorf("failed to sync mirror refs: %w", err)
 	}
 
@@ -2,12 +2,15 @@ package mirror
 
 import (
 	"context"
+	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/matrixhub-ai/hfd/pkg/repository"
 )
 
 func TestOpenOrSyncRespectsTTL(t *testing.T) {
@@ -46,6 +49,124 @@ func TestOpenOrSyncRespectsTTL(t *testing.T) {
 	})
 }
 
+func TestOpenOrSyncDegradesWhenUpstreamUnreachable(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+
+	upstream := setupUpstreamRepo(t, root)
+	mirrorPath := filepath.Join(root, "mirror.git")
+
+	// Port 1 is reserved and nothing listens on it, so connections are refused.
+	const unreachable = "http://127.0.0.1:1/sample.git"
+	source := upstream
+	m := NewMirror(
+		WithMirrorSourceFunc(func(ctx context.Context, repoName string) (string, bool, error) {
+			if repoName == "missing" {
+				return unreachable, true, nil
+			}
+			return source, true, nil
+		}),
+		WithCircuitBreaker(2, time.Hour),
+	)
+
+	if _, err := m.OpenOrSync(ctx, mirrorPath, "sample"); err != nil {
+		t.Fatalf("initial sync failed: %v", err)
+	}
+	source = unreachable
+
+	t.Run("serve local copy", func(t *testing.T) {
+		for range 2 {
+			repo, err := m.OpenOrSync(ctx, mirrorPath, "sample")
+			if err != nil {
+				t.Fatalf("expected local copy to be served, got error: %v", err)
+			}
+			if _, err := repo.Blob("main", "file.txt"); err != nil {
+				t.Fatalf("expected file in local copy: %v", err)
+			}
+		}
+		if m.upstreamAvailable(unreachable) {
+			t.Fatalf("expected circuit breaker to be open after repeated failures")
+		}
+	})
+
+	t.Run("missing repository", func(t *testing.T) {
+		_, err := m.OpenOrSync(ctx, filepath.Join(root, "missing.git"), "missing")
+		if !errors.Is(err, ErrUpstreamUnavailable) {
+			t.Fatalf("expected ErrUpstreamUnavailable, got: %v", err)
+		}
+	})
+}
+
+func TestOpenOrSyncOffline(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+
+	upstream := setupUpstreamRepo(t, root)
+	mirrorPath := filepath.Join(root, "mirror.git")
+
+	sourceFunc := WithMirrorSourceFunc(func(ctx context.Context, repoName string) (string, bool, error) {
+		return upstream, true, nil
+	})
+	if _, err := NewMirror(sourceFunc).OpenOrSync(ctx, mirrorPath, "sample"); err != nil {
+		t.Fatalf("initial sync failed: %v", err)
+	}
+
+	// Advance upstream; an offline mirror must not pick up the change.
+	work := filepath.Join(root, "work")
+	if err := os.WriteFile(filepath.Join(work, "new.txt"), []byte("new"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	git(t, work, "add", ".")
+	git(t, work, "commit", "-m", "second")
+	git(t, work, "push", "origin", "main")
+
+	m := NewMirror(sourceFunc, WithOffline(true))
+	repo, err := m.OpenOrSync(ctx, mirrorPath, "sample")
+	if err != nil {
+		t.Fatalf("expected offline mirror to serve local copy, got error: %v", err)
+	}
+	if _, err := repo.Blob("main", "new.txt"); err == nil {
+		t.Fatalf("expected offline mirror not to sync from upstream")
+	}
+
+	if err := m.Sync(ctx, mirrorPath, "sample"); !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Fatalf("expected forced sync to fail with ErrUpstreamUnavailable, got: %v", err)
+	}
+
+	if _, err := m.OpenOrSync(ctx, filepath.Join(root, "other.git"), "other"); !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Fatalf("expected ErrUpstreamUnavailable for uncached repository, got: %v", err)
+	}
+}
+
+func TestOpenOrSyncLocalRepository(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+
+	// In proxy mode every repository has a source, including the ones only pushed here
+	localPath := filepath.Join(root, "local.git")
+	repo, err := repository.Init(ctx, localPath, "main")
+	if err != nil {
+		t.Fatalf("init repository: %v", err)
+	}
+	if _, err := repo.CreateCommit(ctx, "main", "initial", "test", "test@example.com", []repository.CommitOperation{
+		{Type: repository.CommitOperationAdd, Path: "file.txt", Content: []byte("content")},
+	}, ""); err != nil {
+		t.Fatalf("create commit: %v", err)
+	}
+	m := NewMirror(WithMirrorSourceFunc(func(ctx context.Context, repoName string) (string, bool, error) {
+		return filepath.Join(root, "missing.git"), true, nil
+	}))
+	_, _ = m.OpenOrSync(ctx, localPath, "local")
+
+	repo, err = repository.Open(localPath)
+	if err != nil {
+		t.Fatalf("open repository: %v", err)
+	}
+	if repo.IsMirror() {
+		t.Errorf("expected a local repository not to be marked as a mirror by a sync")
+	}
+}
+
 func setupUpstreamRepo(t *testing.T, root string) string {
 	t.Helper()
 
@@ -0,0 +1,266 @@
+package modeltree
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/matrixhub-ai/hfd/pkg/hf"
+	"github.com/matrixhub-ai/hfd/pkg/receive"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+	"github.com/matrixhub-ai/hfd/pkg/storage"
+)
+
+// Index keeps the base models of the model repositories, as told by the card on their default branch,
+// so that the models derived from a base model are found without reading every repository.
+type Index struct {
+	storage   *storage.Storage
+	indexFile string
+
+	mut   sync.RWMutex
+	bases map[string][]hf.BaseModel
+}
+
+// Option defines a functional option for configuring the Index.
+type Option func(*Index)
+
+// WithStorage sets the storage repositories are opened from by PostReceiveHook and Rebuild.
+func WithStorage(storage *storage.Storage) Option {
+	return func(x *Index) {
+		x.storage = storage
+	}
+}
+
+// WithIndexFile persists the index to path, so it survives restarts.
+func WithIndexFile(path string) Option {
+	return func(x *Index) {
+		x.indexFile = path
+	}
+}
+
+// NewIndex creates a new Index with the provided options, loading the index file if there is one.
+func NewIndex(opts ...Option) *Index {
+	x := &Index{
+		bases: map[string][]hf.BaseModel{},
+	}
+	for _, opt := range opts {
+		opt(x)
+	}
+	x.load()
+	return x
+}
+
+// Bases returns the base models of a repository.
+func (x *Index) Bases(repoName string) []hf.BaseModel {
+	x.mut.RLock()
+	defer x.mut.RUnlock()
+	return slices.Clone(x.bases[repoName])
+}
+
+// Derived returns the names of the repositories derived from baseModel, sorted. When relation
+// is not empty, only the repositories with that relation to baseModel are returned.
+func (x *Index) Derived(baseModel, relation string) []string {
+	x.mut.RLock()
+	defer x.mut.RUnlock()
+	var names []string
+	for name, bases := range x.bases {
+		for _, base := range bases {
+			if base.ID == baseModel && (relation == "" || base.Relation == relation) {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Update reads the base models of a repository from the card on its default branch.
+// Datasets and spaces have no base models.
+func (x *Index) Update(repoName string, repo *repository.Repository) {
+	bases := readBases(repoName, repo)
+
+	x.mut.Lock()
+	defer x.mut.Unlock()
+	if slices.Equal(bases, x.bases[repoName]) {
+		return
+	}
+	if len(bases) == 0 {
+		delete(x.bases, repoName)
+	} else {
+		x.bases[repoName] = bases
+	}
+	x.save()
+}
+
+// Remove drops a deleted repository from the index.
+func (x *Index) Remove(repoName string) {
+	x.mut.Lock()
+	defer x.mut.Unlock()
+	if _, ok := x.bases[repoName]; !ok {
+		return
+	}
+	delete(x.bases, repoName)
+	x.save()
+}
+
+// Rename moves the base models of a repository to its new name.
+func (x *Index) Rename(from, to string) {
+	x.mut.Lock()
+	defer x.mut.Unlock()
+	bases, ok := x.bases[from]
+	if !ok {
+		return
+	}
+	delete(x.bases, from)
+	if hf.RepoTypeOf(to) == "model" {
+		x.bases[to] = bases
+	}
+	x.save()
+}
+
+// PostReceiveHook updates the base models of a repository when its default branch changes,
+// by a push or a mirror sync. It matches receive.PostReceiveHookFunc.
+func (x *Index) PostReceiveHook(ctx context.Context, repoName string, updates []receive.RefUpdate) error {
+	if x.storage == nil || hf.RepoTypeOf(repoName) != "model" {
+		return nil
+	}
+	repoPath := x.storage.ResolvePath(repoName)
+	if repoPath == "" {
+		return nil
+	}
+	repo, err := repository.Open(repoPath)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to open repository to read base models", "repo", repoName, "error", err)
+		return err
+	}
+	defaultRef := "refs/heads/" + repo.DefaultBranch()
+	for _, u := range updates {
+		if u.RefName() == defaultRef {
+			x.Update(repoName, repo)
+			break
+		}
+	}
+	return nil
+}
+
+// Rebuild reads the base models of every model repository of the storage, replacing the index.
+// It catches up with the repositories changed while the index was not maintained.
+func (x *Index) Rebuild(ctx context.Context) error {
+	if x.storage == nil {
+		return nil
+	}
+	reposDir := x.storage.RepositoriesDir()
+	namespaces, err := os.ReadDir(reposDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	bases := map[string][]hf.BaseModel{}
+	for _, ns := range namespaces {
+		if !ns.IsDir() || ns.Name() == "datasets" || ns.Name() == "spaces" {
+			continue
+		}
+		repos, err := os.ReadDir(filepath.Join(reposDir, ns.Name()))
+		if err != nil {
+			continue
+		}
+		for _, entry := range repos {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if !entry.IsDir() || !strings.HasSuffix(entry.Name(), ".git") {
+				continue
+			}
+			repoName := ns.Name() + "/" + strings.TrimSuffix(entry.Name(), ".git")
+			repo, err := repository.Open(filepath.Join(reposDir, ns.Name(), entry.Name()))
+			if err != nil {
+				continue
+			}
+			if b := readBases(repoName, repo); len(b) != 0 {
+				bases[repoName] = b
+			}
+		}
+	}
+
+	x.mut.Lock()
+	defer x.mut.Unlock()
+	x.bases = bases
+	x.save()
+	return nil
+}
+
+// readBases returns the base models told by the card on the default branch of a repository.
+func readBases(repoName string, repo *repository.Repository) []hf.BaseModel {
+	if hf.RepoTypeOf(repoName) != "model" {
+		return nil
+	}
+	rev := repo.DefaultBranch()
+	blob, err := repo.Blob(rev, "README.md")
+	if err != nil {
+		return nil
+	}
+	rc, err := blob.NewReader()
+	if err != nil {
+		return nil
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+	rm, err := hf.ParseReadme(rc)
+	if err != nil || len(rm.Card.BaseModel) == 0 {
+		return nil
+	}
+	// The files only tell the relation the card leaves out, and are not listed otherwise
+	if slices.Contains(hf.BaseModelRelations, rm.Card.BaseModelRelation) {
+		return hf.BaseModels(rm.Card, nil)
+	}
+	entries, _ := repo.Tree(rev, "", &repository.TreeOptions{Recursive: true})
+	return hf.BaseModels(rm.Card, hf.ReadModelFiles(repo, rev, entries))
+}
+
+func (x *Index) load() {
+	if x.indexFile == "" {
+		return
+	}
+	data, err := os.ReadFile(x.indexFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("Failed to read model tree index", "path", x.indexFile, "error", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &x.bases); err != nil {
+		slog.Warn("Failed to parse model tree index", "path", x.indexFile, "error", err)
+		x.bases = map[string][]hf.BaseModel{}
+	}
+}
+
+// save writes the index to disk. The caller must hold x.mut.
+func (x *Index) save() {
+	if x.indexFile == "" {
+		return
+	}
+	data, err := json.Marshal(x.bases)
+	if err != nil {
+		slog.Warn("Failed to encode model tree index", "error", err)
+		return
+	}
+	tmp := x.indexFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		slog.Warn("Failed to write model tree index", "path", tmp, "error", err)
+		return
+	}
+	if err := os.Rename(tmp, x.indexFile); err != nil {
+		slog.Warn("Failed to write model tree index", "path", x.indexFile, "error", err)
+	}
+}
@@ -0,0 +1,88 @@
+package modeltree
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/matrixhub-ai/hfd/pkg/hf"
+	"github.com/matrixhub-ai/hfd/pkg/receive"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+	"github.com/matrixhub-ai/hfd/pkg/storage"
+)
+
+func TestIndex(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store := storage.NewStorage(storage.WithRootDir(filepath.Join(root, "data")))
+
+	// commit creates repoName if needed and commits files to main, returning the update of main.
+	commit := func(repoName string, files map[string]string) receive.RefUpdate {
+		t.Helper()
+		repoPath := store.ResolvePath(repoName)
+		repo, err := repository.Open(repoPath)
+		if err != nil {
+			repo, err = repository.Init(ctx, repoPath, "main")
+			if err != nil {
+				t.Fatalf("init repository: %v", err)
+			}
+		}
+		var ops []repository.CommitOperation
+		for path, content := range files {
+			ops = append(ops, repository.CommitOperation{Type: repository.CommitOperationAdd, Path: path, Content: []byte(content)})
+		}
+		head, err := repo.CreateCommit(ctx, "main", "update", "test", "test@example.com", ops, "")
+		if err != nil {
+			t.Fatalf("create commit: %v", err)
+		}
+		return receive.NewRefUpdate(receive.ZeroHash, head, "refs/heads/main", repoName)
+	}
+
+	commit("org/finetune", map[string]string{"README.md": "---\nbase_model: org/base\n---\n"})
+	commit("org/adapter", map[string]string{
+		"README.md":           "---\nbase_model: org/base\n---\n",
+		"adapter_config.json": `{"task_type":"CAUSAL_LM"}`,
+	})
+	commit("datasets/org/data", map[string]string{"README.md": "---\nbase_model: org/base\n---\n"})
+
+	indexFile := filepath.Join(root, "model-tree.json")
+	x := NewIndex(WithStorage(store), WithIndexFile(indexFile))
+	if err := x.Rebuild(ctx); err != nil {
+		t.Fatalf("Rebuild: %v", err)
+	}
+	if got := x.Derived("org/base", ""); !reflect.DeepEqual(got, []string{"org/adapter", "org/finetune"}) {
+		t.Errorf("expected the models derived from org/base, got %v", got)
+	}
+	if got := x.Derived("org/base", "adapter"); !reflect.DeepEqual(got, []string{"org/adapter"}) {
+		t.Errorf("expected the adapters of org/base, got %v", got)
+	}
+
+	// Pushes to the default branch update the index
+	update := commit("org/quantized", map[string]string{"README.md": "---\nbase_model: org/base\nbase_model_relation: quantized\n---\n"})
+	if err := x.PostReceiveHook(ctx, "org/quantized", []receive.RefUpdate{update}); err != nil {
+		t.Fatalf("PostReceiveHook: %v", err)
+	}
+	if got := x.Bases("org/quantized"); !reflect.DeepEqual(got, []hf.BaseModel{{ID: "org/base", Relation: "quantized"}}) {
+		t.Errorf("unexpected bases %v", got)
+	}
+	update = commit("org/finetune", map[string]string{"README.md": "---\nbase_model: org/other\n---\n"})
+	if err := x.PostReceiveHook(ctx, "org/finetune", []receive.RefUpdate{update}); err != nil {
+		t.Fatalf("PostReceiveHook: %v", err)
+	}
+	if got := x.Derived("org/other", ""); !reflect.DeepEqual(got, []string{"org/finetune"}) {
+		t.Errorf("expected org/finetune to be derived from org/other, got %v", got)
+	}
+
+	x.Rename("org/adapter", "org/lora")
+	x.Remove("org/quantized")
+	if got := x.Derived("org/base", ""); !reflect.DeepEqual(got, []string{"org/lora"}) {
+		t.Errorf("expected only the renamed adapter, got %v", got)
+	}
+
+	// The index survives restarts
+	x = NewIndex(WithIndexFile(indexFile))
+	if got := x.Derived("org/base", ""); !reflect.DeepEqual(got, []string{"org/lora"}) {
+		t.Errorf("expected the index to be loaded, got %v", got)
+	}
+}
@@ -0,0 +1,541 @@
+package notebook
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The markdown of notebooks is rendered with the common subset of CommonMark and GitHub Flavored Markdown:
+// headings, paragraphs, fenced code, block quotes, lists, tables, thematic breaks, emphasis, code spans,
+// links and images. Inline HTML is kept as is, the result being sanitized by the caller.
+
+var (
+	reFence     = regexp.MustCompile("^ {0,3}(```+|~~~+)\\s*([^`\\s]*)")
+	reHeading   = regexp.MustCompile(`^ {0,3}(#{1,6})(?:\s+(.*?))?(?:\s+#+)?\s*$`)
+	reRule      = regexp.MustCompile(`^ {0,3}(?:(?:\*\s*){3,}|(?:-\s*){3,}|(?:_\s*){3,})$`)
+	reListItem  = regexp.MustCompile(`^( *)([-*+]|[0-9]{1,9}[.)])(?:\s+|$)`)
+	reTableSep  = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(?:\|\s*:?-+:?\s*)*\|?\s*$`)
+	reHTMLBlock = regexp.MustCompile(`^ {0,3}</?[A-Za-z][A-Za-z0-9-]*(?:\s|/?>|$)|^ {0,3}<!--`)
+	reHTMLTag   = regexp.MustCompile(`^(?:</?[A-Za-z][A-Za-z0-9-]*(?:\s+[A-Za-z_:][A-Za-z0-9_.:-]*(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?)*\s*/?>|<!--[\s\S]*?-->)`)
+	reAutolink  = regexp.MustCompile(`^<((?:https?|mailto):[^\s<>]*)>`)
+	reEntity    = regexp.MustCompile(`^&(?:[A-Za-z][A-Za-z0-9]{1,31}|#[0-9]{1,7}|#[xX][0-9A-Fa-f]{1,6});`)
+)
+
+// maxNesting bounds the nesting of blocks, such as block quotes, and of inline content, such as emphasis,
+// beyond which the content is rendered as text.
+const maxNesting = 16
+
+// renderMarkdown renders markdown as HTML.
+func renderMarkdown(src string) string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	var b strings.Builder
+	renderBlocks(&b, strings.Split(src, "\n"), 0)
+	return b.String()
+}
+
+func renderBlocks(b *strings.Builder, lines []string, depth int) {
+	if depth > maxNesting {
+		b.WriteString("<p>" + html.EscapeString(strings.Join(lines, "\n")) + "</p>\n")
+		return
+	}
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			i++
+
+		case reFence.MatchString(line):
+			m := reFence.FindStringSubmatch(line)
+			j := i + 1
+			for j < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[j]), m[1]) {
+				j++
+			}
+			writeCode(b, m[2], strings.Join(lines[i+1:min(j, len(lines))], "\n"))
+			i = j + 1
+
+		case reHeading.MatchString(line):
+			m := reHeading.FindStringSubmatch(line)
+			level := strconv.Itoa(len(m[1]))
+			b.WriteString("<h" + level + ">" + renderInline(m[2]) + "</h" + level + ">\n")
+			i++
+
+		case reRule.MatchString(line):
+			b.WriteString("<hr>\n")
+			i++
+
+		case strings.HasPrefix(trimmed, ">"):
+			var quoted []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				l := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quoted = append(quoted, strings.TrimPrefix(l, " "))
+			}
+			b.WriteString("<blockquote>\n")
+			renderBlocks(b, quoted, depth+1)
+			b.WriteString("</blockquote>\n")
+
+		case reListItem.MatchString(line) && strings.TrimSpace(reListItem.ReplaceAllString(line, "")) != "" || reListItem.MatchString(line) && i+1 < len(lines) && indentOf(lines[i+1]) > indentOf(line):
+			i = renderList(b, lines, i, depth)
+
+		case i+1 < len(lines) && strings.Contains(line, "|") && reTableSep.MatchString(lines[i+1]):
+			i = renderTable(b, lines, i)
+
+		case reHTMLBlock.MatchString(line):
+			for ; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+				b.WriteString(lines[i] + "\n")
+			}
+
+		default:
+			var paragraph []string
+			for ; i < len(lines) && !startsBlock(lines, i); i++ {
+				paragraph = append(paragraph, strings.TrimSpace(lines[i]))
+			}
+			b.WriteString("<p>" + renderInline(strings.Join(paragraph, "\n")) + "</p>\n")
+		}
+	}
+}
+
+// startsBlock reports whether the line ends a paragraph, being blank or starting another block.
+func startsBlock(lines []string, i int) bool {
+	line := lines[i]
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || reFence.MatchString(line) || reHeading.MatchString(line) || reRule.MatchString(line) ||
+		strings.HasPrefix(trimmed, ">") || (reListItem.MatchString(line) && strings.TrimSpace(reListItem.ReplaceAllString(line, "")) != "") ||
+		(i+1 < len(lines) && strings.Contains(line, "|") && reTableSep.MatchString(lines[i+1]))
+}
+
+// renderList renders the list starting at lines[i], returning the index of the line after it.
+// Lines indented under an item, such as nested lists, are rendered as the blocks of the item.
+func renderList(b *strings.Builder, lines []string, i int, depth int) int {
+	m := reListItem.FindStringSubmatch(lines[i])
+	indent := len(m[1])
+	ordered := !strings.ContainsAny(m[2], "-*+")
+	marker := m[2][len(m[2])-1:]
+
+	var items [][]string
+	contentIndent := 0
+	for i < len(lines) {
+		line := lines[i]
+		if m := reListItem.FindStringSubmatch(line); m != nil && len(m[1]) <= indent+1 && strings.HasSuffix(m[2], marker) {
+			contentIndent = len(m[0])
+			items = append(items, []string{line[len(m[0]):]})
+			i++
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			// A blank line followed by an indented line continues the item
+			if i+1 < len(lines) && indentOf(lines[i+1]) > indent && strings.TrimSpace(lines[i+1]) != "" {
+				items[len(items)-1] = append(items[len(items)-1], "")
+				i++
+				continue
+			}
+			break
+		}
+		if indentOf(line) > indent {
+			items[len(items)-1] = append(items[len(items)-1], dedent(line, contentIndent))
+			i++
+			continue
+		}
+		if startsBlock(lines, i) {
+			break
+		}
+		// Lazy continuation of the paragraph of the item
+		items[len(items)-1] = append(items[len(items)-1], strings.TrimSpace(line))
+		i++
+	}
+
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+		if start, _ := strconv.Atoi(strings.TrimRight(m[2], ".)")); start != 1 {
+			tag = `ol start="` + strconv.Itoa(start) + `"`
+		}
+	}
+	b.WriteString("<" + tag + ">\n")
+	for _, item := range items {
+		// The first lines of an item are its text, the rest its blocks
+		j := 1
+		for j < len(item) && strings.TrimSpace(item[j]) != "" && !startsBlock(item, j) {
+			j++
+		}
+		b.WriteString("<li>" + renderInline(strings.TrimSpace(strings.Join(item[:j], "\n"))))
+		if j < len(item) {
+			b.WriteString("\n")
+			renderBlocks(b, item[j:], depth+1)
+		}
+		b.WriteString("</li>\n")
+	}
+	b.WriteString("</" + tag[:2] + ">\n")
+	return i
+}
+
+// renderTable renders the table whose header is lines[i], returning the index of the line after it.
+func renderTable(b *strings.Builder, lines []string, i int) int {
+	header := tableCells(lines[i])
+	var aligns []string
+	for _, sep := range tableCells(lines[i+1]) {
+		switch {
+		case strings.HasPrefix(sep, ":") && strings.HasSuffix(sep, ":"):
+			aligns = append(aligns, "center")
+		case strings.HasSuffix(sep, ":"):
+			aligns = append(aligns, "right")
+		case strings.HasPrefix(sep, ":"):
+			aligns = append(aligns, "left")
+		default:
+			aligns = append(aligns, "")
+		}
+	}
+	row := func(cells []string, tag string) {
+		b.WriteString("<tr>")
+		for j := range header {
+			cell := ""
+			if j < len(cells) {
+				cell = cells[j]
+			}
+			open := tag
+			if j < len(aligns) && aligns[j] != "" {
+				open += ` align="` + aligns[j] + `"`
+			}
+			b.WriteString("<" + open + ">" + renderInline(cell) + "</" + tag + ">")
+		}
+		b.WriteString("</tr>\n")
+	}
+
+	b.WriteString("<table>\n<thead>\n")
+	row(header, "th")
+	b.WriteString("</thead>\n<tbody>\n")
+	for i += 2; i < len(lines) && strings.TrimSpace(lines[i]) != "" && strings.Contains(lines[i], "|"); i++ {
+		row(tableCells(lines[i]), "td")
+	}
+	b.WriteString("</tbody>\n</table>\n")
+	return i
+}
+
+// tableCells splits a row of a table into its cells.
+func tableCells(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if !strings.HasSuffix(line, `\|`) {
+		line = strings.TrimSuffix(line, "|")
+	}
+	var cells []string
+	var cell strings.Builder
+	for k := 0; k < len(line); k++ {
+		switch {
+		case line[k] == '\\' && k+1 < len(line) && line[k+1] == '|':
+			cell.WriteByte('|')
+			k++
+		case line[k] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[k])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+func writeCode(b *strings.Builder, lang string, code string) {
+	b.WriteString("<pre><code")
+	if lang != "" {
+		b.WriteString(` class="language-` + html.EscapeString(lang) + `"`)
+	}
+	b.WriteString(">" + html.EscapeString(code) + "</code></pre>\n")
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// dedent removes up to n spaces of indentation from line.
+func dedent(line string, n int) string {
+	return line[min(indentOf(line), n):]
+}
+
+// renderInline renders the inline content of a block: code spans, math, links, images, emphasis,
+// line breaks and inline HTML. The rest is escaped.
+func renderInline(s string) string {
+	return newInline(s).render(0, len(s), 0)
+}
+
+// inline renders the inline content of a block. Finding the end of a construct, such as the closing
+// delimiter of an emphasis, scans the text once: brackets and parentheses are matched in a single pass,
+// and the position from which a delimiter has no closer is remembered, so that delimiters left open
+// do not make the text scanned again for each of them.
+type inline struct {
+	s        string
+	brackets map[int]int
+	parens   map[int]int
+	// unclosed is the position from which each delimiter does not occur, up to the end of a text,
+	// and unclosedEmphasis the position from which it does not close an emphasis
+	unclosed         map[span]int
+	unclosedEmphasis map[span]int
+}
+
+// span is a delimiter searched up to the end of a text, as the text of nested constructs ends before the block does.
+type span struct {
+	delim string
+	end   int
+}
+
+func newInline(s string) *inline {
+	return &inline{
+		s:                s,
+		brackets:         matchPairs(s, '[', ']', true, false),
+		parens:           matchPairs(s, '(', ')', false, true),
+		unclosed:         map[span]int{},
+		unclosedEmphasis: map[span]int{},
+	}
+}
+
+// matchPairs returns the positions of the closing bytes matching the opening bytes of s.
+// Escaped bytes are skipped when escapes is set, and pairs do not span lines when lines is set.
+func matchPairs(s string, open, close byte, escapes, lines bool) map[int]int {
+	pairs := map[int]int{}
+	var stack []int
+	for k := 0; k < len(s); k++ {
+		switch s[k] {
+		case '\\':
+			if escapes {
+				k++
+			}
+		case '\n':
+			if lines {
+				stack = stack[:0]
+			}
+		case open:
+			stack = append(stack, k)
+		case close:
+			if len(stack) != 0 {
+				pairs[stack[len(stack)-1]] = k
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	return pairs
+}
+
+// index returns the position of the first occurrence of delim in s[from:end], or -1.
+func (in *inline) index(delim string, from, end int) int {
+	key := span{delim: delim, end: end}
+	if p, ok := in.unclosed[key]; ok && from >= p {
+		return -1
+	}
+	k := strings.Index(in.s[from:end], delim)
+	if k < 0 {
+		in.unclosed[key] = from
+		return -1
+	}
+	return from + k
+}
+
+// render renders s[start:end], nested in depth inline constructs.
+func (in *inline) render(start, end, depth int) string {
+	s := in.s
+	var b strings.Builder
+	if depth > maxNesting {
+		b.WriteString(html.EscapeString(s[start:end]))
+		return b.String()
+	}
+	for i := start; i < end; {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < end && s[i+1] == '\n':
+			b.WriteString("<br>\n")
+			i += 2
+
+		case c == '\\' && i+1 < end && strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", s[i+1]) >= 0:
+			b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+
+		case c == '`':
+			n := len(s[i:end]) - len(strings.TrimLeft(s[i:end], "`"))
+			fence := s[i : i+n]
+			closing := in.index(fence, i+n, end)
+			if closing < 0 {
+				b.WriteString(fence)
+				i += n
+				continue
+			}
+			code := strings.ReplaceAll(s[i+n:closing], "\n", " ")
+			if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' {
+				code = code[1 : len(code)-1]
+			}
+			b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+			i = closing + n
+
+		case c == '$':
+			// Math is kept as written, for its underscores and asterisks not to be taken for emphasis
+			delim := "$"
+			if strings.HasPrefix(s[i:end], "$$") {
+				delim = "$$"
+			}
+			closing := in.index(delim, i+len(delim), end)
+			if closing < 0 {
+				b.WriteString(delim)
+				i += len(delim)
+				continue
+			}
+			b.WriteString(html.EscapeString(s[i : closing+len(delim)]))
+			i = closing + len(delim)
+
+		case c == '!' && strings.HasPrefix(s[i+1:end], "["):
+			text, dest, title, next, ok := in.link(i+1, end)
+			if !ok {
+				b.WriteString("!")
+				i++
+				continue
+			}
+			b.WriteString(`<img src="` + html.EscapeString(dest) + `" alt="` + html.EscapeString(s[text[0]:text[1]]) + `"`)
+			if title != "" {
+				b.WriteString(` title="` + html.EscapeString(title) + `"`)
+			}
+			b.WriteString(">")
+			i = next
+
+		case c == '[':
+			text, dest, title, next, ok := in.link(i, end)
+			if !ok {
+				b.WriteString("[")
+				i++
+				continue
+			}
+			b.WriteString(`<a href="` + html.EscapeString(dest) + `"`)
+			if title != "" {
+				b.WriteString(` title="` + html.EscapeString(title) + `"`)
+			}
+			b.WriteString(">" + in.render(text[0], text[1], depth+1) + "</a>")
+			i = next
+
+		case c == '<':
+			if m := reAutolink.FindStringSubmatch(s[i:end]); m != nil {
+				b.WriteString(`<a href="` + html.EscapeString(m[1]) + `">` + html.EscapeString(m[1]) + "</a>")
+				i += len(m[0])
+			} else if m := reHTMLTag.FindString(s[i:end]); m != "" {
+				b.WriteString(m)
+				i += len(m)
+			} else {
+				b.WriteString("&lt;")
+				i++
+			}
+
+		case c == '&':
+			if m := reEntity.FindString(s[i:end]); m != "" {
+				b.WriteString(m)
+				i += len(m)
+			} else {
+				b.WriteString("&amp;")
+				i++
+			}
+
+		case c == '*' || c == '_' || c == '~':
+			i = in.emphasis(&b, i, end, depth)
+
+		case c == '\n':
+			if strings.HasSuffix(b.String(), "  ") {
+				b.WriteString("<br>")
+			}
+			b.WriteString("\n")
+			i++
+
+		default:
+			b.WriteString(html.EscapeString(s[i : i+1]))
+			i++
+		}
+	}
+	return b.String()
+}
+
+// emphasis renders the emphasis opened by the delimiter run at s[i], returning the position after the text it renders.
+// A delimiter run that is not closed is rendered as is.
+func (in *inline) emphasis(b *strings.Builder, i, end, depth int) int {
+	s := in.s
+	c := s[i]
+	n := len(s[i:end]) - len(strings.TrimLeft(s[i:end], string(c)))
+	delim := s[i : i+min(n, 2)]
+	if c == '~' && n < 2 {
+		b.WriteByte(c)
+		return i + 1
+	}
+	// Underscores inside words, as in snake_case names, are not delimiters
+	opens := i+len(delim) < end && s[i+len(delim)] != ' ' && s[i+len(delim)] != '\n'
+	if c == '_' && i > 0 && isWordByte(s[i-1]) {
+		opens = false
+	}
+	if opens {
+		if closing := in.closer(delim, i+len(delim)+1, end); closing >= 0 {
+			tag := "em"
+			switch {
+			case c == '~':
+				tag = "del"
+			case len(delim) == 2:
+				tag = "strong"
+			}
+			b.WriteString("<" + tag + ">" + in.render(i+len(delim), closing, depth+1) + "</" + tag + ">")
+			return closing + len(delim)
+		}
+	}
+	b.WriteString(delim)
+	return i + len(delim)
+}
+
+// closer returns the position of the first delimiter run of s[from:end] able to close an emphasis of delim, or -1.
+func (in *inline) closer(delim string, from, end int) int {
+	key := span{delim: delim, end: end}
+	if p, ok := in.unclosedEmphasis[key]; ok && from >= p {
+		return -1
+	}
+	s := in.s
+	c := delim[0]
+	for j := from; ; j++ {
+		j = in.index(delim, j, end)
+		if j < 0 {
+			in.unclosedEmphasis[key] = from
+			return -1
+		}
+		if s[j-1] == ' ' || s[j-1] == '\\' {
+			continue
+		}
+		after := j + len(delim)
+		if after < end && s[after] == c {
+			continue
+		}
+		if c == '_' && after < end && isWordByte(s[after]) {
+			continue
+		}
+		return j
+	}
+}
+
+// link parses a link whose text starts at s[i] == '[', returning the bounds of its text, its destination,
+// its title and the position after it.
+func (in *inline) link(i, end int) (text [2]int, dest, title string, next int, ok bool) {
+	s := in.s
+	closing, found := in.brackets[i]
+	if !found || closing+1 >= end || s[closing+1] != '(' {
+		return text, "", "", 0, false
+	}
+	last, found := in.parens[closing+1]
+	if !found || last >= end {
+		return text, "", "", 0, false
+	}
+	inner := strings.TrimSpace(s[closing+2 : last])
+	if strings.HasPrefix(inner, "<") {
+		if k := strings.IndexByte(inner, '>'); k > 0 {
+			dest, inner = inner[1:k], strings.TrimSpace(inner[k+1:])
+		}
+	} else {
+		dest, inner, _ = strings.Cut(inner, " ")
+		inner = strings.TrimSpace(inner)
+	}
+	if len(inner) >= 2 && strings.ContainsAny(inner[:1], `"'(`) {
+		title = inner[1 : len(inner)-1]
+	}
+	return [2]int{i + 1, closing}, dest, title, last + 1, true
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+}
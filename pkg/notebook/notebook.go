@@ -0,0 +1,98 @@
+// Package notebook renders Jupyter notebooks as HTML documents, for them to be previewed without running a kernel.
+package notebook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Notebook is a Jupyter notebook, in the nbformat 4 format.
+type Notebook struct {
+	Cells    []Cell   `json:"cells"`
+	Metadata Metadata `json:"metadata"`
+	NBFormat int      `json:"nbformat"`
+}
+
+// Metadata is the metadata of a notebook.
+type Metadata struct {
+	KernelSpec struct {
+		Language string `json:"language"`
+	} `json:"kernelspec"`
+	LanguageInfo struct {
+		Name string `json:"name"`
+	} `json:"language_info"`
+}
+
+// Cell is a cell of a notebook, whose type is markdown, code or raw.
+type Cell struct {
+	CellType       string                                `json:"cell_type"`
+	Source         Text                                  `json:"source"`
+	ExecutionCount *int                                  `json:"execution_count,omitempty"`
+	Outputs        []Output                              `json:"outputs,omitempty"`
+	Attachments    map[string]map[string]json.RawMessage `json:"attachments,omitempty"`
+}
+
+// Output is an output of a code cell, whose type is stream, execute_result, display_data or error.
+// The data of results is keyed by MIME type.
+type Output struct {
+	OutputType     string                     `json:"output_type"`
+	Name           string                     `json:"name,omitempty"`
+	Text           Text                       `json:"text,omitempty"`
+	Data           map[string]json.RawMessage `json:"data,omitempty"`
+	ExecutionCount *int                       `json:"execution_count,omitempty"`
+	EName          string                     `json:"ename,omitempty"`
+	EValue         string                     `json:"evalue,omitempty"`
+	Traceback      []string                   `json:"traceback,omitempty"`
+}
+
+// Text is a multiline string, stored in notebooks as a string or as a list of lines.
+type Text string
+
+// UnmarshalJSON decodes a string or a list of strings.
+func (t *Text) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = Text(s)
+		return nil
+	}
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err != nil {
+		return fmt.Errorf("expected a string or a list of strings: %w", err)
+	}
+	*t = Text(strings.Join(lines, ""))
+	return nil
+}
+
+// Parse reads a notebook.
+func Parse(r io.Reader) (*Notebook, error) {
+	var nb Notebook
+	if err := json.NewDecoder(r).Decode(&nb); err != nil {
+		return nil, fmt.Errorf("invalid notebook: %w", err)
+	}
+	if nb.NBFormat != 4 {
+		return nil, fmt.Errorf("unsupported notebook format %d", nb.NBFormat)
+	}
+	return &nb, nil
+}
+
+// Language returns the programming language of the code cells of the notebook.
+func (nb *Notebook) Language() string {
+	if nb.Metadata.LanguageInfo.Name != "" {
+		return nb.Metadata.LanguageInfo.Name
+	}
+	if nb.Metadata.KernelSpec.Language != "" {
+		return nb.Metadata.KernelSpec.Language
+	}
+	return "python"
+}
+
+// dataText returns the text of an output data or an attachment, which are multiline strings.
+func dataText(raw json.RawMessage) (string, bool) {
+	var t Text
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return "", false
+	}
+	return string(t), true
+}
@@ -0,0 +1,177 @@
+package notebook
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testNotebook = `{
+ "cells": [
+  {
+   "cell_type": "markdown",
+   "metadata": {},
+   "source": ["# Training\n", "\n", "See the [card](README.md) and ![plot](attachment:plot.png).\n", "<script>alert(1)</script>"],
+   "attachments": {"plot.png": {"image/png": "iVBORw0KGgo="}}
+  },
+  {
+   "cell_type": "code",
+   "execution_count": 1,
+   "metadata": {},
+   "source": "print(\"<b>hi</b>\")\n1 + 1",
+   "outputs": [
+    {"output_type": "stream", "name": "stdout", "text": ["<b>hi</b>\n"]},
+    {"output_type": "execute_result", "execution_count": 1, "data": {"text/plain": ["2"]}, "metadata": {}},
+    {"output_type": "display_data", "data": {"text/html": "<table onclick=\"x()\"><tr><td>ok</td></tr></table><img src=x onerror=alert(1)>", "text/plain": "table"}, "metadata": {}},
+    {"output_type": "display_data", "data": {"image/png": "iVBORw0K\nGgo=\n", "text/plain": "figure"}, "metadata": {}},
+    {"output_type": "error", "ename": "ValueError", "evalue": "bad", "traceback": ["\u001b[0;31mValueError\u001b[0m: bad"]}
+   ]
+  },
+  {
+   "cell_type": "raw",
+   "metadata": {},
+   "source": "<i>raw</i>"
+  }
+ ],
+ "metadata": {"kernelspec": {"language": "python"}, "language_info": {"name": "python"}},
+ "nbformat": 4,
+ "nbformat_minor": 5
+}`
+
+func TestRender(t *testing.T) {
+	nb, err := Parse(strings.NewReader(testNotebook))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	var b strings.Builder
+	if err := WriteDocument(&b, Render(nb), Options{Title: "train.ipynb", Base: "/user/model/resolve/main/"}); err != nil {
+		t.Fatalf("WriteDocument: %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"<title>train.ipynb</title>",
+		`<base href="/user/model/resolve/main/">`,
+		"<h1>Training</h1>",
+		`<a href="README.md" rel="nofollow noopener noreferrer" target="_blank">card</a>`,
+		`<img src="data:image/png;base64,iVBORw0KGgo=" alt="plot">`,
+		`In [1]:`,
+		`<pre><code class="language-python">print(&#34;&lt;b&gt;hi&lt;/b&gt;&#34;)` + "\n1 + 1</code></pre>",
+		`<pre class="stream">&lt;b&gt;hi&lt;/b&gt;`,
+		`Out [1]:`,
+		"<pre>2</pre>",
+		"<table><tbody><tr><td>ok</td></tr></tbody></table>",
+		`<img src="x">`,
+		`<img src="data:image/png;base64,iVBORw0KGgo=" alt="output">`,
+		`<pre class="error">ValueError: bad</pre>`,
+		"<pre>&lt;i&gt;raw&lt;/i&gt;</pre>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected the output to contain %q, got:\n%s", want, out)
+		}
+	}
+	for _, unwanted := range []string{"<script>", "alert(1)</script>", "onclick", "onerror"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("expected the output not to contain %q", unwanted)
+		}
+	}
+}
+
+func TestRenderLimits(t *testing.T) {
+	nb := &Notebook{Cells: []Cell{{
+		CellType: "code",
+		Outputs: []Output{
+			{OutputType: "stream", Name: "stdout", Text: Text(strings.Repeat("a", MaxTextOutputSize+1))},
+			{OutputType: "display_data", Data: map[string]json.RawMessage{"image/png": json.RawMessage(`"` + strings.Repeat("A", MaxImageSize*2) + `"`)}},
+			{OutputType: "display_data", Data: map[string]json.RawMessage{"image/png": json.RawMessage(`"not base64!"`), "text/plain": json.RawMessage(`"figure"`)}},
+		},
+	}}}
+	out := string(Render(nb))
+	if strings.Contains(out, strings.Repeat("a", MaxTextOutputSize+1)) || !strings.Contains(out, "Output truncated") {
+		t.Errorf("expected the stream to be truncated")
+	}
+	if strings.Contains(out, "AAAA") || !strings.Contains(out, "Output too large") {
+		t.Errorf("expected the large image to be left out")
+	}
+	if !strings.Contains(out, "<pre>figure</pre>") {
+		t.Errorf("expected the invalid image to fall back to text")
+	}
+
+	large := strings.Repeat("*a ", MaxSourceSize/3+1)
+	out = string(Render(&Notebook{Cells: []Cell{{CellType: "markdown", Source: Text(large)}, {CellType: "code", Source: Text(large)}}}))
+	if strings.Contains(out, "<em>") || strings.Count(out, "Source truncated") != 2 {
+		t.Errorf("expected the large sources to be truncated and not rendered as markdown")
+	}
+}
+
+func TestRenderMarkdownUnclosed(t *testing.T) {
+	// Delimiters left open do not make the text scanned again for each of them
+	for _, run := range []string{"*a ", "**a ", "_a ", "~~a ", "`a ", "$a ", "[a ", "[a](", "*a _b ~~c `d $e [f ", "> "} {
+		started := time.Now()
+		renderMarkdown(strings.Repeat(run, MaxSourceSize/len(run)))
+		if elapsed := time.Since(started); elapsed > 5*time.Second {
+			t.Errorf("rendering unclosed %q took %v", run, elapsed)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, invalid := range []string{"", "{", `{"nbformat": 3, "worksheets": []}`, `{"nbformat": 4, "cells": [{"source": 1}]}`} {
+		if _, err := Parse(strings.NewReader(invalid)); err == nil {
+			t.Errorf("expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		markdown string
+		html     string
+	}{
+		{"## Title ##", "<h2>Title</h2>\n"},
+		{"some *em*, **strong**, ~~del~~ and `a < b`", "<p>some <em>em</em>, <strong>strong</strong>, <del>del</del> and <code>a &lt; b</code></p>\n"},
+		{"snake_case_name and _em_", "<p>snake_case_name and <em>em</em></p>\n"},
+		{"$x_1 * y_2 * z$", "<p>$x_1 * y_2 * z$</p>\n"},
+		{"line one\nline two", "<p>line one\nline two</p>\n"},
+		{"```py\nif a < b:\n    pass\n```", "<pre><code class=\"language-py\">if a &lt; b:\n    pass</code></pre>\n"},
+		{"- a\n- b\n  1. c\n  2. d\n", "<ul>\n<li>a</li>\n<li>b\n<ol>\n<li>c</li>\n<li>d</li>\n</ol>\n</li>\n</ul>\n"},
+		{"3. c\n4. d", "<ol start=\"3\">\n<li>c</li>\n<li>d</li>\n</ol>\n"},
+		{"> quoted\n> text", "<blockquote>\n<p>quoted\ntext</p>\n</blockquote>\n"},
+		{"| a | b |\n|:--|--:|\n| 1 | 2 |", "<table>\n<thead>\n<tr><th align=\"left\">a</th><th align=\"right\">b</th></tr>\n</thead>\n<tbody>\n<tr><td align=\"left\">1</td><td align=\"right\">2</td></tr>\n</tbody>\n</table>\n"},
+		{"---", "<hr>\n"},
+		{"[link](https://example.com \"Example\") <https://example.com>", "<p><a href=\"https://example.com\" title=\"Example\">link</a> <a href=\"https://example.com\">https://example.com</a></p>\n"},
+		{"a <br/> b & c &amp; \\*d\\*", "<p>a <br/> b &amp; c &amp; *d*</p>\n"},
+	}
+	for _, tt := range tests {
+		if got := renderMarkdown(tt.markdown); got != tt.html {
+			t.Errorf("renderMarkdown(%q) = %q, expected %q", tt.markdown, got, tt.html)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		fragment string
+		html     string
+	}{
+		{`<p onclick="x()">text</p>`, "<p>text</p>"},
+		{`<script>alert(1)</script><style>body{}</style>ok`, "ok"},
+		{`<a href="javascript:alert(1)">x</a>`, `<a rel="nofollow noopener noreferrer" target="_blank">x</a>`},
+		{`<a href="JaVaScRiPt:alert(1)">x</a>`, `<a rel="nofollow noopener noreferrer" target="_blank">x</a>`},
+		{`<a href="#section" target="_self">x</a>`, `<a href="#section" rel="nofollow noopener noreferrer" target="_blank">x</a>`},
+		{`<img src="data:text/html;base64,PHNjcmlwdD4=" width="100" height="50px">`, `<img width="100">`},
+		{`<img src="https://example.com/a.png" style="position:fixed">`, `<img src="https://example.com/a.png">`},
+		{`<iframe src="https://example.com"></iframe><svg><script>alert(1)</script></svg>`, ""},
+		{`<custom-element><b>kept</b></custom-element>`, "<b>kept</b>"},
+		{`<code class="language-python">x</code><span class="navbar">y</span>`, `<code class="language-python">x</code><span>y</span>`},
+		{"<pre>\n\nindented</pre>", "<pre>\n\nindented</pre>"},
+		{`<p>unclosed <b>bold`, "<p>unclosed <b>bold</b></p>"},
+		{`<!-- comment --><div>&lt;escaped&gt;</div>`, "<div>&lt;escaped&gt;</div>"},
+	}
+	for _, tt := range tests {
+		if got := sanitize(tt.fragment); got != tt.html {
+			t.Errorf("sanitize(%q) = %q, expected %q", tt.fragment, got, tt.html)
+		}
+	}
+}
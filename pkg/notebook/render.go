@@ -0,0 +1,243 @@
+package notebook
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"html"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxTextOutputSize is the size text outputs are truncated to.
+	MaxTextOutputSize = 64 << 10
+	// MaxHTMLOutputSize is the size of the largest HTML output that is rendered.
+	MaxHTMLOutputSize = 512 << 10
+	// MaxImageSize is the size of the largest image, as decoded, that is rendered.
+	MaxImageSize = 1 << 20
+	// MaxSourceSize is the size sources are truncated to. Larger markdown cells are shown as their source.
+	MaxSourceSize = 1 << 20
+)
+
+// imageTypes are the MIME types of the images outputs and attachments can have.
+var imageTypes = []string{"image/png", "image/jpeg", "image/gif", "image/svg+xml"}
+
+var (
+	reANSI       = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]|\x1b\][^\x07]*\x07`)
+	reAttachment = regexp.MustCompile(`attachment:([^\s)"'>]+)`)
+	reBase64     = regexp.MustCompile(`^[A-Za-z0-9+/]*={0,2}$`)
+)
+
+// Options are the options of WriteDocument.
+type Options struct {
+	// Title is the title of the document.
+	Title string
+	// Base is the URL the relative links and images of the notebook are resolved against,
+	// usually the directory of the notebook.
+	Base string
+}
+
+// Render renders the cells of a notebook as HTML, with their relative links and images left as is,
+// for it not to depend on where the notebook is. The markdown and HTML the notebook contains are sanitized,
+// and the sources and outputs larger than the size limits are truncated or left out.
+func Render(nb *Notebook) []byte {
+	var b strings.Builder
+	language := nb.Language()
+	for _, cell := range nb.Cells {
+		switch cell.CellType {
+		case "markdown":
+			b.WriteString("<div class=\"cell markdown\">\n")
+			if len(cell.Source) > MaxSourceSize {
+				b.WriteString("<pre>" + source(string(cell.Source)) + "</pre>")
+			} else {
+				b.WriteString(sanitize(renderMarkdown(inlineAttachments(string(cell.Source), cell.Attachments))))
+			}
+			b.WriteString("</div>\n")
+		case "code":
+			b.WriteString("<div class=\"cell code\">\n<div class=\"input\">")
+			b.WriteString("<div class=\"prompt\">" + prompt("In", cell.ExecutionCount) + "</div>")
+			b.WriteString("<pre><code class=\"language-" + html.EscapeString(language) + "\">")
+			b.WriteString(source(string(cell.Source)) + "</code></pre></div>\n")
+			for _, output := range cell.Outputs {
+				writeOutput(&b, output)
+			}
+			b.WriteString("</div>\n")
+		case "raw":
+			b.WriteString("<div class=\"cell raw\"><pre>" + source(string(cell.Source)) + "</pre></div>\n")
+		}
+	}
+	return []byte(b.String())
+}
+
+// WriteDocument writes the cells of a notebook rendered by Render as an HTML document.
+func WriteDocument(w io.Writer, content []byte, opts Options) error {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	b.WriteString("<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n")
+	b.WriteString("<title>" + html.EscapeString(opts.Title) + "</title>\n")
+	if opts.Base != "" {
+		b.WriteString("<base href=\"" + html.EscapeString(opts.Base) + "\">\n")
+	}
+	b.WriteString("<style>" + style + "</style>\n</head>\n<body>\n<div class=\"notebook\">\n")
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return err
+	}
+	if _, err := w.Write(content); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "</div>\n</body>\n</html>\n")
+	return err
+}
+
+func writeOutput(b *strings.Builder, output Output) {
+	b.WriteString("<div class=\"output\">")
+	switch output.OutputType {
+	case "stream":
+		class := "stream"
+		if output.Name == "stderr" {
+			class += " stderr"
+		}
+		b.WriteString("<div class=\"prompt\"></div><pre class=\"" + class + "\">" + text(string(output.Text)) + "</pre>")
+	case "error":
+		b.WriteString("<div class=\"prompt\"></div><pre class=\"error\">")
+		if len(output.Traceback) != 0 {
+			b.WriteString(text(strings.Join(output.Traceback, "\n")))
+		} else {
+			b.WriteString(text(output.EName + ": " + output.EValue))
+		}
+		b.WriteString("</pre>")
+	case "execute_result", "display_data":
+		p := ""
+		if output.OutputType == "execute_result" {
+			p = prompt("Out", output.ExecutionCount)
+		}
+		b.WriteString("<div class=\"prompt\">" + p + "</div>")
+		b.WriteString(renderData(output.Data))
+	}
+	b.WriteString("</div>\n")
+}
+
+// renderData renders the richest representation of an output data that is within the size limits.
+func renderData(data map[string]json.RawMessage) string {
+	if raw, ok := data["text/html"]; ok {
+		if s, ok := dataText(raw); ok && len(s) <= MaxHTMLOutputSize {
+			return "<div class=\"html\">" + sanitize(s) + "</div>"
+		}
+	}
+	for _, typ := range imageTypes {
+		raw, ok := data[typ]
+		if !ok {
+			continue
+		}
+		if src, ok := imageURL(typ, raw); ok {
+			return "<div class=\"image\"><img src=\"" + html.EscapeString(src) + "\" alt=\"output\"></div>"
+		}
+	}
+	if raw, ok := data["text/markdown"]; ok {
+		if s, ok := dataText(raw); ok && len(s) <= MaxHTMLOutputSize {
+			return "<div class=\"html\">" + sanitize(renderMarkdown(s)) + "</div>"
+		}
+	}
+	if raw, ok := data["text/plain"]; ok {
+		if s, ok := dataText(raw); ok {
+			return "<pre>" + text(s) + "</pre>"
+		}
+	}
+	if len(data) != 0 {
+		return "<pre class=\"omitted\">Output too large or of an unsupported type, not shown</pre>"
+	}
+	return ""
+}
+
+// imageURL returns the data URL of an image output, or false when it is too large or invalid.
+// Images other than SVG are base64 encoded in notebooks.
+func imageURL(typ string, raw json.RawMessage) (string, bool) {
+	s, ok := dataText(raw)
+	if !ok {
+		return "", false
+	}
+	if typ == "image/svg+xml" {
+		if len(s) > MaxImageSize {
+			return "", false
+		}
+		return "data:" + typ + ";base64," + base64.StdEncoding.EncodeToString([]byte(s)), true
+	}
+	s = strings.Join(strings.Fields(s), "")
+	if base64.StdEncoding.DecodedLen(len(s)) > MaxImageSize || len(s)%4 != 0 || !reBase64.MatchString(s) {
+		return "", false
+	}
+	return "data:" + typ + ";base64," + s, true
+}
+
+// inlineAttachments replaces the references to the attachments of a markdown cell by their data URLs.
+func inlineAttachments(source string, attachments map[string]map[string]json.RawMessage) string {
+	if len(attachments) == 0 {
+		return source
+	}
+	return reAttachment.ReplaceAllStringFunc(source, func(ref string) string {
+		name, err := url.PathUnescape(strings.TrimPrefix(ref, "attachment:"))
+		if err != nil {
+			return ref
+		}
+		for _, typ := range imageTypes {
+			if raw, ok := attachments[name][typ]; ok {
+				if src, ok := imageURL(typ, raw); ok {
+					return src
+				}
+			}
+		}
+		return ref
+	})
+}
+
+// text escapes a text output, without its terminal escape sequences and truncated to MaxTextOutputSize.
+func text(s string) string {
+	s = reANSI.ReplaceAllString(s, "")
+	if len(s) <= MaxTextOutputSize {
+		return html.EscapeString(s)
+	}
+	s = strings.ToValidUTF8(s[:MaxTextOutputSize], "")
+	return html.EscapeString(s) + "\n<span class=\"omitted\">Output truncated</span>"
+}
+
+// source escapes a source, truncated to MaxSourceSize.
+func source(s string) string {
+	if len(s) <= MaxSourceSize {
+		return html.EscapeString(s)
+	}
+	s = strings.ToValidUTF8(s[:MaxSourceSize], "")
+	return html.EscapeString(s) + "\n<span class=\"omitted\">Source truncated</span>"
+}
+
+func prompt(name string, count *int) string {
+	n := " "
+	if count != nil {
+		n = strconv.Itoa(*count)
+	}
+	return name + " [" + n + "]:"
+}
+
+const style = `
+body{margin:0;font-family:-apple-system,BlinkMacSystemFont,"Segoe UI",Helvetica,Arial,sans-serif;font-size:14px;line-height:1.5;color:#1f2328;background:#fff}
+.notebook{max-width:1000px;margin:0 auto;padding:16px}
+.cell{margin:8px 0}
+.input,.output{display:flex;align-items:flex-start}
+.prompt{flex:0 0 72px;padding-top:8px;font-family:monospace;font-size:12px;color:#6e7781;text-align:right;margin-right:8px}
+.code pre{flex:1;min-width:0}
+pre{margin:0;padding:8px;overflow-x:auto;font-family:ui-monospace,SFMono-Regular,Menlo,Consolas,monospace;font-size:13px;white-space:pre-wrap;word-break:break-word}
+.input pre{background:#f6f8fa;border:1px solid #d0d7de;border-radius:6px}
+.stderr{background:#fff5f5}
+.error{background:#ffebe9;color:#82071e}
+.omitted{color:#6e7781;font-style:italic}
+.html,.image{flex:1;min-width:0;overflow-x:auto;padding:8px 0}
+.markdown{padding:0 8px 0 80px}
+img{max-width:100%}
+table{border-collapse:collapse}
+th,td{border:1px solid #d0d7de;padding:4px 8px}
+blockquote{margin:0;padding:0 1em;color:#57606a;border-left:.25em solid #d0d7de}
+.markdown pre{background:#f6f8fa;border-radius:6px}
+code{font-family:ui-monospace,SFMono-Regular,Menlo,Consolas,monospace}
+`
@@ -0,0 +1,144 @@
+package notebook
+
+import (
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// allowedElements are the elements kept by sanitize, with the attributes they can have besides globalAttributes.
+var allowedElements = map[string][]string{
+	"a": {"href"}, "abbr": nil, "b": nil, "blockquote": nil, "br": nil, "caption": nil, "code": {"class"},
+	"dd": nil, "del": nil, "details": {"open"}, "div": nil, "dl": nil, "dt": nil, "em": nil,
+	"figcaption": nil, "figure": nil, "h1": nil, "h2": nil, "h3": nil, "h4": nil, "h5": nil, "h6": nil,
+	"hr": nil, "i": nil, "img": {"src", "alt", "width", "height"}, "kbd": nil, "li": nil, "ol": {"start"},
+	"p": nil, "pre": nil, "q": nil, "s": nil, "samp": nil, "span": nil, "strong": nil, "sub": nil,
+	"summary": nil, "sup": nil, "table": {"border"}, "tbody": nil, "td": {"colspan", "rowspan"},
+	"tfoot": nil, "th": {"colspan", "rowspan"}, "thead": nil, "tr": nil, "tt": nil, "u": nil, "ul": nil,
+}
+
+// globalAttributes are the attributes any allowed element can have.
+var globalAttributes = []string{"align", "dir", "lang", "title"}
+
+// droppedElements are the elements removed with their content. The other elements not allowed are
+// replaced by their content.
+var droppedElements = map[string]bool{
+	"base": true, "button": true, "embed": true, "form": true, "frame": true, "frameset": true, "head": true,
+	"iframe": true, "input": true, "link": true, "math": true, "meta": true, "noembed": true, "noframes": true,
+	"noscript": true, "object": true, "script": true, "select": true, "style": true, "svg": true,
+	"template": true, "textarea": true, "title": true,
+}
+
+var (
+	reDimension  = regexp.MustCompile(`^[0-9]{1,5}%?$`)
+	reLanguage   = regexp.MustCompile(`^language-[A-Za-z0-9_+#.-]+$`)
+	reImageData  = regexp.MustCompile(`^data:image/(?:png|jpeg|gif|webp|svg\+xml);base64,[A-Za-z0-9+/=\s]*$`)
+	voidElements = map[string]bool{"br": true, "hr": true, "img": true}
+)
+
+// sanitize returns an HTML fragment keeping only the elements and attributes that cannot run scripts,
+// load content other than images, or change the page outside of the fragment.
+// Relative URLs are kept as is.
+func sanitize(fragment string) string {
+	context := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), context)
+	if err != nil {
+		return html.EscapeString(fragment)
+	}
+	var b strings.Builder
+	for _, n := range nodes {
+		writeNode(&b, n)
+	}
+	return b.String()
+}
+
+func writeNode(b *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		b.WriteString(html.EscapeString(n.Data))
+		return
+	case html.ElementNode:
+	default:
+		// Comments and doctypes are dropped
+		return
+	}
+
+	if droppedElements[n.Data] {
+		return
+	}
+	attributes, ok := allowedElements[n.Data]
+	if !ok {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			writeNode(b, c)
+		}
+		return
+	}
+
+	b.WriteString("<" + n.Data)
+	for _, a := range n.Attr {
+		if a.Namespace != "" || (!slices.Contains(attributes, a.Key) && !slices.Contains(globalAttributes, a.Key)) {
+			continue
+		}
+		value, ok := attributeValue(a.Key, a.Val)
+		if !ok {
+			continue
+		}
+		b.WriteString(" " + a.Key + `="` + html.EscapeString(value) + `"`)
+	}
+	if n.Data == "a" {
+		b.WriteString(` rel="nofollow noopener noreferrer" target="_blank"`)
+	}
+	b.WriteString(">")
+	if voidElements[n.Data] {
+		return
+	}
+	// Parsers drop a newline right after <pre>, which would be the first line of its content
+	if c := n.FirstChild; n.Data == "pre" && c != nil && c.Type == html.TextNode && strings.HasPrefix(c.Data, "\n") {
+		b.WriteString("\n")
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeNode(b, c)
+	}
+	b.WriteString("</" + n.Data + ">")
+}
+
+// attributeValue returns the value an allowed attribute is kept with, or false when it is dropped.
+func attributeValue(key, value string) (string, bool) {
+	switch key {
+	case "href":
+		return cleanURL(value, false)
+	case "src":
+		return cleanURL(value, true)
+	case "width", "height", "colspan", "rowspan", "start", "border":
+		return value, reDimension.MatchString(value)
+	case "class":
+		// Only the language of code blocks is kept, for the page styles not to apply to the content
+		return value, reLanguage.MatchString(value)
+	}
+	return value, true
+}
+
+// cleanURL returns a URL, or false when its scheme could run scripts.
+// Images can be data URLs.
+func cleanURL(value string, image bool) (string, bool) {
+	if image && reImageData.MatchString(value) {
+		return value, true
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return "", false
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return u.String(), true
+	case "mailto":
+		return u.String(), !image
+	case "":
+		return u.String(), true
+	}
+	return "", false
+}
@@ -0,0 +1,318 @@
+package packcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/matrixhub-ai/hfd/internal/lru"
+	"github.com/matrixhub-ai/hfd/pkg/receive"
+)
+
+const (
+	defaultMaxEntries = 1024
+	// MaxRequestSize is the size of the largest upload-pack request the cache is used for.
+	// Larger requests carry many haves, so they are unlikely to be repeated by other clients.
+	MaxRequestSize = 64 << 10
+)
+
+// GenerateFunc writes the response of an upload-pack request.
+type GenerateFunc func(ctx context.Context, w io.Writer) error
+
+// Cache stores upload-pack responses on disk, so identical requests against the same refs are
+// answered with the stored response instead of generating the pack again. Concurrent identical
+// requests share a single generation, and stream the response while it is being written.
+// Only stateless requests can be cached: smart HTTP requests, and the parts of SSH sessions that
+// do not negotiate interactively, as the responses of those depend on more than a single request.
+type Cache struct {
+	dir        string
+	maxSize    int64
+	maxEntries int
+
+	group   singleflight.Group
+	entries *lru.Cache[string, *entry]
+
+	mut   sync.Mutex
+	size  int64
+	repos map[string]map[string]struct{} // keys of the entries of each repository
+}
+
+// Option configures a Cache.
+type Option func(*Cache)
+
+// WithDir sets the directory the responses are stored in.
+func WithDir(dir string) Option {
+	return func(c *Cache) {
+		c.dir = dir
+	}
+}
+
+// WithMaxSize sets the total size of the stored responses above which the least recently
+// used ones are evicted. Zero means no limit.
+func WithMaxSize(size int64) Option {
+	return func(c *Cache) {
+		c.maxSize = size
+	}
+}
+
+// WithMaxEntries sets the maximum number of stored responses.
+func WithMaxEntries(n int) Option {
+	return func(c *Cache) {
+		c.maxEntries = n
+	}
+}
+
+// NewCache creates a new Cache. Responses stored by a previous process are discarded.
+func NewCache(opts ...Option) *Cache {
+	c := &Cache{
+		dir:        filepath.Join(os.TempDir(), "hfd-pack-cache"),
+		maxEntries: defaultMaxEntries,
+		repos:      make(map[string]map[string]struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	_ = os.RemoveAll(c.dir)
+
+	c.entries = lru.New[string, *entry](c.maxEntries)
+	c.entries.OnEvicted = c.onEvicted
+	return c
+}
+
+// Key returns the cache key of an upload-pack request of a repository. The key covers the refs
+// of the repository, so responses computed before a ref update are never served after it.
+func Key(repoName string, refs map[string]string, head string, protocol string, body []byte) string {
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s\x00%s\x00%s\x00", repoName, head, protocol)
+	for _, name := range names {
+		_, _ = fmt.Fprintf(h, "%s %s\n", refs[name], name)
+	}
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Serve writes the response for key to w. The response is streamed from the cache if it is
+// stored or being generated, and generated with generate otherwise. The generation is detached
+// from ctx, as other requests may be streaming it.
+func (c *Cache) Serve(ctx context.Context, w io.Writer, repoName string, key string, generate GenerateFunc) error {
+	e, ok := c.entries.Get(key)
+	if !ok {
+		v, err, _ := c.group.Do(key, func() (any, error) {
+			if e, ok := c.entries.Get(key); ok {
+				return e, nil
+			}
+			return c.start(ctx, repoName, key, generate)
+		})
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to cache upload-pack response", "repo", repoName, "error", err)
+			return generate(ctx, w)
+		}
+		e = v.(*entry)
+	}
+
+	f, err := os.Open(e.path)
+	if err != nil {
+		// The entry was evicted in the meantime.
+		return generate(ctx, w)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	return e.copyTo(ctx, w, f)
+}
+
+// start creates the entry for key and generates its response in the background.
+func (c *Cache) start(ctx context.Context, repoName string, key string, generate GenerateFunc) (*entry, error) {
+	if err := os.MkdirAll(c.dir, 0750); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(filepath.Join(c.dir, key))
+	if err != nil {
+		return nil, err
+	}
+
+	e := &entry{
+		repoName: repoName,
+		path:     f.Name(),
+	}
+	e.cond = sync.NewCond(&e.mut)
+	c.entries.Add(key, e)
+
+	c.mut.Lock()
+	keys := c.repos[repoName]
+	if keys == nil {
+		keys = make(map[string]struct{})
+		c.repos[repoName] = keys
+	}
+	keys[key] = struct{}{}
+	c.mut.Unlock()
+
+	go func() {
+		err := generate(context.WithoutCancel(ctx), &entryWriter{e: e, f: f})
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to generate upload-pack response", "repo", repoName, "error", err)
+			c.entries.Remove(key)
+		} else {
+			c.added(e)
+		}
+		e.finish(err)
+	}()
+	return e, nil
+}
+
+// added accounts for a completed response, evicting the least recently used ones above the size limit.
+func (c *Cache) added(e *entry) {
+	c.mut.Lock()
+	if !e.evicted {
+		c.size += e.size
+		e.counted = true
+	}
+	over := c.maxSize > 0 && c.size > c.maxSize
+	c.mut.Unlock()
+
+	for over && c.entries.Len() > 0 {
+		c.entries.RemoveOldest()
+		c.mut.Lock()
+		over = c.size > c.maxSize
+		c.mut.Unlock()
+	}
+}
+
+func (c *Cache) onEvicted(key string, e *entry) {
+	_ = os.Remove(e.path)
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	e.evicted = true
+	if e.counted {
+		c.size -= e.size
+	}
+	if keys := c.repos[e.repoName]; keys != nil {
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(c.repos, e.repoName)
+		}
+	}
+}
+
+// Invalidate drops the stored responses of a repository.
+func (c *Cache) Invalidate(repoName string) {
+	c.mut.Lock()
+	keys := make([]string, 0, len(c.repos[repoName]))
+	for key := range c.repos[repoName] {
+		keys = append(keys, key)
+	}
+	c.mut.Unlock()
+
+	for _, key := range keys {
+		c.entries.Remove(key)
+	}
+}
+
+// PostReceiveHook drops the stored responses of a repository whose refs were updated.
+func (c *Cache) PostReceiveHook(ctx context.Context, repoName string, updates []receive.RefUpdate) error {
+	if len(updates) == 0 {
+		return nil
+	}
+	c.Invalidate(repoName)
+	return nil
+}
+
+// Size returns the total size of the stored responses.
+func (c *Cache) Size() int64 {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.size
+}
+
+// entry is a stored response, possibly still being generated.
+type entry struct {
+	repoName string
+	path     string
+
+	mut  sync.Mutex
+	cond *sync.Cond
+	size int64
+	done bool
+	err  error
+
+	// Guarded by the mutex of the Cache.
+	counted bool // size is accounted for in the size of the Cache
+	evicted bool
+}
+
+func (e *entry) finish(err error) {
+	e.mut.Lock()
+	defer e.mut.Unlock()
+	e.done = true
+	e.err = err
+	e.cond.Broadcast()
+}
+
+// copyTo streams the response from f to w, waiting for the parts still being generated.
+func (e *entry) copyTo(ctx context.Context, w io.Writer, f *os.File) error {
+	var off int64
+	for {
+		e.mut.Lock()
+		for off >= e.size && !e.done {
+			e.cond.Wait()
+		}
+		size, done, err := e.size, e.done, e.err
+		e.mut.Unlock()
+
+		if err != nil {
+			return err
+		}
+		if off < size {
+			n, err := io.Copy(w, io.NewSectionReader(f, off, size-off))
+			off += n
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			continue
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// entryWriter writes a response being generated to its file, waking up the streaming readers.
+type entryWriter struct {
+	e *entry
+	f *os.File
+}
+
+func (w *entryWriter) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	w.e.mut.Lock()
+	w.e.size += int64(n)
+	w.e.cond.Broadcast()
+	w.e.mut.Unlock()
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	return n, err
+}
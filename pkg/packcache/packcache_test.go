@@ -0,0 +1,111 @@
+package packcache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestServeCoalescesRequests(t *testing.T) {
+	c := NewCache(WithDir(t.TempDir()))
+	key := Key("org/repo", map[string]string{"refs/heads/main": "abc"}, "main", "", []byte("want abc\n"))
+
+	release := make(chan struct{})
+	var calls atomic.Int32
+	generate := func(ctx context.Context, w io.Writer) error {
+		calls.Add(1)
+		if _, err := w.Write([]byte("first part,")); err != nil {
+			return err
+		}
+		<-release
+		_, err := w.Write([]byte("second part"))
+		return err
+	}
+
+	var wg sync.WaitGroup
+	outputs := make([]bytes.Buffer, 8)
+	for i := range outputs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.Serve(context.Background(), &outputs[i], "org/repo", key, generate); err != nil {
+				t.Errorf("Serve failed: %v", err)
+			}
+		}()
+	}
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected a single generation, got %d", n)
+	}
+	for i := range outputs {
+		if got := outputs[i].String(); got != "first part,second part" {
+			t.Errorf("Output %d = %q", i, got)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := c.Serve(context.Background(), &out, "org/repo", key, generate); err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected stored response to be served, got %d generations", n)
+	}
+	if c.Size() != int64(out.Len()) {
+		t.Errorf("Size() = %d, want %d", c.Size(), out.Len())
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	c := NewCache(WithDir(t.TempDir()))
+	key := Key("org/repo", nil, "main", "", []byte("want abc\n"))
+
+	var calls atomic.Int32
+	generate := func(ctx context.Context, w io.Writer) error {
+		calls.Add(1)
+		_, err := w.Write([]byte("pack"))
+		return err
+	}
+	for range 2 {
+		if err := c.Serve(context.Background(), io.Discard, "org/repo", key, generate); err != nil {
+			t.Fatalf("Serve failed: %v", err)
+		}
+		c.Invalidate("org/repo")
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("Expected invalidated response to be generated again, got %d generations", n)
+	}
+	if c.Size() != 0 {
+		t.Errorf("Size() = %d, want 0", c.Size())
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	c := NewCache(WithDir(dir), WithMaxSize(10))
+	generate := func(ctx context.Context, w io.Writer) error {
+		_, err := w.Write([]byte("123456"))
+		return err
+	}
+	for _, body := range []string{"a", "b", "c"} {
+		key := Key("org/repo", nil, "main", "", []byte(body))
+		if err := c.Serve(context.Background(), io.Discard, "org/repo", key, generate); err != nil {
+			t.Fatalf("Serve failed: %v", err)
+		}
+	}
+	if c.Size() > 10 {
+		t.Errorf("Size() = %d, want at most 10", c.Size())
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("Expected 1 stored response, got %d", len(files))
+	}
+}
@@ -0,0 +1,385 @@
+// Package parquet writes tables in the Apache Parquet format.
+//
+// Only flat schemas of optional columns are supported. Values are written
+// with the PLAIN encoding into uncompressed data pages, one page per column
+// chunk, which every Parquet reader understands.
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// magic starts and ends every Parquet file.
+const magic = "PAR1"
+
+// Type is the type of the values of a column.
+type Type int
+
+const (
+	Boolean Type = iota
+	Int64
+	Double
+	String
+)
+
+// String returns the name of the type.
+func (t Type) String() string {
+	switch t {
+	case Boolean:
+		return "bool"
+	case Int64:
+		return "int64"
+	case Double:
+		return "double"
+	case String:
+		return "string"
+	}
+	return fmt.Sprintf("Type(%d)", int(t))
+}
+
+// physicalType returns the physical type of the Parquet format storing values of the type.
+func (t Type) physicalType() int32 {
+	switch t {
+	case Boolean:
+		return 0
+	case Int64:
+		return 2
+	case Double:
+		return 5
+	}
+	return 6 // BYTE_ARRAY
+}
+
+// Column describes a column of a table.
+type Column struct {
+	Name string
+	Type Type
+}
+
+// Values of the Parquet format.
+const (
+	repetitionOptional = 1
+	convertedTypeUTF8  = 0
+	encodingPlain      = 0
+	encodingRLE        = 3
+	codecUncompressed  = 0
+	pageTypeData       = 0
+)
+
+// DefaultRowGroupSize is the default number of rows of a row group.
+const DefaultRowGroupSize = 64 * 1024
+
+// Option is a functional option for configuring the Writer.
+type Option func(*Writer)
+
+// WithRowGroupSize sets the number of rows buffered in memory before they are written as a row group.
+func WithRowGroupSize(n int) Option {
+	return func(w *Writer) {
+		if n > 0 {
+			w.rowGroupSize = n
+		}
+	}
+}
+
+// WithCreatedBy sets the application recorded as the writer of the file.
+func WithCreatedBy(createdBy string) Option {
+	return func(w *Writer) {
+		w.createdBy = createdBy
+	}
+}
+
+// Writer writes rows to a Parquet file.
+type Writer struct {
+	w            io.Writer
+	offset       int64
+	columns      []Column
+	chunks       []columnChunk
+	rows         int
+	numRows      int64
+	rowGroups    []rowGroup
+	rowGroupSize int
+	createdBy    string
+	closed       bool
+}
+
+// columnChunk buffers the values of a column for the current row group.
+type columnChunk struct {
+	defined []bool
+	values  bytes.Buffer
+	bits    int
+}
+
+type rowGroup struct {
+	numRows int64
+	size    int64
+	columns []columnMeta
+}
+
+type columnMeta struct {
+	offset    int64
+	size      int64
+	numValues int64
+}
+
+// NewWriter returns a Writer writing a file of the given columns to w.
+func NewWriter(w io.Writer, columns []Column, opts ...Option) (*Writer, error) {
+	if len(columns) == 0 {
+		return nil, errors.New("parquet: no columns")
+	}
+	seen := map[string]struct{}{}
+	for _, c := range columns {
+		if c.Name == "" {
+			return nil, errors.New("parquet: empty column name")
+		}
+		if _, ok := seen[c.Name]; ok {
+			return nil, fmt.Errorf("parquet: duplicate column %q", c.Name)
+		}
+		seen[c.Name] = struct{}{}
+		if c.Type < Boolean || c.Type > String {
+			return nil, fmt.Errorf("parquet: invalid type of column %q", c.Name)
+		}
+	}
+
+	pw := &Writer{
+		w:            w,
+		columns:      columns,
+		chunks:       make([]columnChunk, len(columns)),
+		rowGroupSize: DefaultRowGroupSize,
+		createdBy:    "hfd",
+	}
+	for _, opt := range opts {
+		opt(pw)
+	}
+	if err := pw.write([]byte(magic)); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// Write appends a row with a value for each column. A value is nil for a null,
+// or a bool, int64, float64 or string according to the type of its column.
+func (w *Writer) Write(row []any) error {
+	if w.closed {
+		return errors.New("parquet: write to closed writer")
+	}
+	if len(row) != len(w.columns) {
+		return fmt.Errorf("parquet: row has %d values, want %d", len(row), len(w.columns))
+	}
+	for i, v := range row {
+		if v == nil {
+			continue
+		}
+		if err := checkValue(w.columns[i], v); err != nil {
+			return err
+		}
+	}
+
+	for i, v := range row {
+		c := &w.chunks[i]
+		c.defined = append(c.defined, v != nil)
+		if v == nil {
+			continue
+		}
+		switch v := v.(type) {
+		case bool:
+			// Booleans are bit-packed, the first value in the least significant bit
+			if c.bits%8 == 0 {
+				c.values.WriteByte(0)
+			}
+			if v {
+				b := c.values.Bytes()
+				b[len(b)-1] |= 1 << (c.bits % 8)
+			}
+			c.bits++
+		case int64:
+			c.values.Write(binary.LittleEndian.AppendUint64(nil, uint64(v)))
+		case float64:
+			c.values.Write(binary.LittleEndian.AppendUint64(nil, math.Float64bits(v)))
+		case string:
+			c.values.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(v))))
+			c.values.WriteString(v)
+		}
+	}
+
+	w.rows++
+	if w.rows >= w.rowGroupSize {
+		return w.flush()
+	}
+	return nil
+}
+
+func checkValue(c Column, v any) error {
+	var ok bool
+	switch c.Type {
+	case Boolean:
+		_, ok = v.(bool)
+	case Int64:
+		_, ok = v.(int64)
+	case Double:
+		_, ok = v.(float64)
+	case String:
+		_, ok = v.(string)
+	}
+	if !ok {
+		return fmt.Errorf("parquet: value %v of type %T for column %q of type %s", v, v, c.Name, c.Type)
+	}
+	return nil
+}
+
+// flush writes the buffered rows as a row group, a data page for each column.
+func (w *Writer) flush() error {
+	if w.rows == 0 {
+		return nil
+	}
+	rg := rowGroup{numRows: int64(w.rows)}
+	for i, col := range w.columns {
+		c := &w.chunks[i]
+
+		var page bytes.Buffer
+		levels := encodeLevels(c.defined)
+		page.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(levels))))
+		page.Write(levels)
+		page.Write(c.values.Bytes())
+		if page.Len() > math.MaxInt32 {
+			return fmt.Errorf("parquet: page of column %q is too large", col.Name)
+		}
+
+		var header thriftWriter
+		header.i32Field(1, pageTypeData)
+		header.i32Field(2, int32(page.Len()))
+		header.i32Field(3, int32(page.Len()))
+		header.structField(5)
+		header.i32Field(1, int32(len(c.defined)))
+		header.i32Field(2, encodingPlain)
+		header.i32Field(3, encodingRLE)
+		header.i32Field(4, encodingRLE)
+		header.structEnd()
+		header.structEnd()
+
+		meta := columnMeta{
+			offset:    w.offset,
+			size:      int64(header.buf.Len() + page.Len()),
+			numValues: int64(len(c.defined)),
+		}
+		if err := w.write(header.buf.Bytes()); err != nil {
+			return err
+		}
+		if err := w.write(page.Bytes()); err != nil {
+			return err
+		}
+		rg.columns = append(rg.columns, meta)
+		rg.size += meta.size
+
+		*c = columnChunk{}
+	}
+	w.rowGroups = append(w.rowGroups, rg)
+	w.numRows += rg.numRows
+	w.rows = 0
+	return nil
+}
+
+// encodeLevels encodes the definition levels of a page with the RLE/bit-packing hybrid
+// encoding, as runs of a bit width of 1.
+func encodeLevels(defined []bool) []byte {
+	var out []byte
+	for i := 0; i < len(defined); {
+		j := i + 1
+		for j < len(defined) && defined[j] == defined[i] {
+			j++
+		}
+		out = binary.AppendUvarint(out, uint64(j-i)<<1)
+		if defined[i] {
+			out = append(out, 1)
+		} else {
+			out = append(out, 0)
+		}
+		i = j
+	}
+	return out
+}
+
+// Close writes the buffered rows and the footer of the file. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	if err := w.flush(); err != nil {
+		return err
+	}
+	w.closed = true
+
+	var meta thriftWriter
+	meta.i32Field(1, 1)
+	meta.listField(2, thriftStruct, len(w.columns)+1)
+	meta.structBegin()
+	meta.binaryField(4, "schema")
+	meta.i32Field(5, int32(len(w.columns)))
+	meta.structEnd()
+	for _, col := range w.columns {
+		meta.structBegin()
+		meta.i32Field(1, col.Type.physicalType())
+		meta.i32Field(3, repetitionOptional)
+		meta.binaryField(4, col.Name)
+		if col.Type == String {
+			meta.i32Field(6, convertedTypeUTF8)
+			meta.structField(10)
+			meta.structField(1) // STRING
+			meta.structEnd()
+			meta.structEnd()
+		}
+		meta.structEnd()
+	}
+	meta.i64Field(3, w.numRows)
+	meta.listField(4, thriftStruct, len(w.rowGroups))
+	for _, rg := range w.rowGroups {
+		meta.structBegin()
+		meta.listField(1, thriftStruct, len(rg.columns))
+		for i, c := range rg.columns {
+			meta.structBegin()
+			meta.i64Field(2, c.offset)
+			meta.structField(3)
+			meta.i32Field(1, w.columns[i].Type.physicalType())
+			meta.listField(2, thriftI32, 2)
+			meta.i32(encodingPlain)
+			meta.i32(encodingRLE)
+			meta.listField(3, thriftBinary, 1)
+			meta.binary(w.columns[i].Name)
+			meta.i32Field(4, codecUncompressed)
+			meta.i64Field(5, c.numValues)
+			meta.i64Field(6, c.size)
+			meta.i64Field(7, c.size)
+			meta.i64Field(9, c.offset)
+			meta.structEnd()
+			meta.structEnd()
+		}
+		meta.i64Field(2, rg.size)
+		meta.i64Field(3, rg.numRows)
+		meta.structEnd()
+	}
+	meta.binaryField(6, w.createdBy)
+	meta.structEnd()
+
+	if err := w.write(meta.buf.Bytes()); err != nil {
+		return err
+	}
+	if err := w.write(binary.LittleEndian.AppendUint32(nil, uint32(meta.buf.Len()))); err != nil {
+		return err
+	}
+	return w.write([]byte(magic))
+}
+
+// NumRows returns the number of rows written so far.
+func (w *Writer) NumRows() int64 {
+	return w.numRows + int64(w.rows)
+}
+
+func (w *Writer) write(b []byte) error {
+	n, err := w.w.Write(b)
+	w.offset += int64(n)
+	return err
+}
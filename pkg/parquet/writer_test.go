@@ -0,0 +1,226 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// thriftReader decodes structures of the Thrift compact protocol into maps of their fields by ID.
+type thriftReader struct {
+	t   *testing.T
+	buf []byte
+	pos int
+}
+
+func (r *thriftReader) byte() byte {
+	if r.pos >= len(r.buf) {
+		r.t.Fatalf("unexpected end of thrift data")
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		r.t.Fatalf("invalid varint at %d", r.pos)
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		n := int(r.uvarint())
+		s := string(r.buf[r.pos : r.pos+n])
+		r.pos += n
+		return s
+	case thriftList:
+		h := r.byte()
+		n := int(h >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]any, n)
+		for i := range list {
+			list[i] = r.value(h & 0x0f)
+		}
+		return list
+	case thriftStruct:
+		return r.readStruct()
+	}
+	r.t.Fatalf("unexpected thrift type %d", typ)
+	return nil
+}
+
+func (r *thriftReader) readStruct() map[int64]any {
+	fields := map[int64]any{}
+	var id int64
+	for {
+		h := r.byte()
+		if h == 0 {
+			return fields
+		}
+		if delta := int64(h >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = r.zigzag()
+		}
+		fields[id] = r.value(h & 0x0f)
+	}
+}
+
+// readFile decodes the rows of a file written by the Writer.
+func readFile(t *testing.T, data []byte) ([]map[int64]any, [][]any) {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte(magic)) || !bytes.HasSuffix(data, []byte(magic)) {
+		t.Fatalf("missing magic")
+	}
+	size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := &thriftReader{t: t, buf: data[len(data)-8-size : len(data)-8]}
+	meta := footer.readStruct()
+
+	var schema []map[int64]any
+	for _, s := range meta[2].([]any)[1:] {
+		schema = append(schema, s.(map[int64]any))
+	}
+
+	var rows [][]any
+	for _, g := range meta[4].([]any) {
+		group := g.(map[int64]any)
+		numRows := int(group[3].(int64))
+		groupRows := make([][]any, numRows)
+		for i := range groupRows {
+			groupRows[i] = make([]any, len(schema))
+		}
+		for i, c := range group[1].([]any) {
+			chunk := c.(map[int64]any)[3].(map[int64]any)
+			offset := int(chunk[9].(int64))
+			page := &thriftReader{t: t, buf: data, pos: offset}
+			header := page.readStruct()
+			body := data[page.pos : page.pos+int(header[3].(int64))]
+			if n := header[5].(map[int64]any)[1].(int64); int(n) != numRows {
+				t.Fatalf("page has %d values, want %d", n, numRows)
+			}
+
+			n := int(binary.LittleEndian.Uint32(body))
+			levels := &thriftReader{t: t, buf: body[4 : 4+n]}
+			var defined []bool
+			for levels.pos < len(levels.buf) {
+				run := int(levels.uvarint() >> 1)
+				v := levels.byte() == 1
+				for range run {
+					defined = append(defined, v)
+				}
+			}
+			values := body[4+n:]
+			bit := 0
+			for row, ok := range defined {
+				if !ok {
+					continue
+				}
+				var v any
+				switch chunk[1].(int64) {
+				case 0:
+					v = values[bit/8]&(1<<(bit%8)) != 0
+					bit++
+				case 2:
+					v = int64(binary.LittleEndian.Uint64(values))
+					values = values[8:]
+				case 5:
+					v = math.Float64frombits(binary.LittleEndian.Uint64(values))
+					values = values[8:]
+				case 6:
+					l := binary.LittleEndian.Uint32(values)
+					v = string(values[4 : 4+l])
+					values = values[4+l:]
+				}
+				groupRows[row][i] = v
+			}
+		}
+		rows = append(rows, groupRows...)
+	}
+	if int(meta[3].(int64)) != len(rows) {
+		t.Fatalf("file has %d rows, read %d", meta[3], len(rows))
+	}
+	return schema, rows
+}
+
+func TestWriter(t *testing.T) {
+	columns := []Column{
+		{Name: "ok", Type: Boolean},
+		{Name: "id", Type: Int64},
+		{Name: "score", Type: Double},
+		{Name: "text", Type: String},
+	}
+	var rows [][]any
+	for i := range 40 {
+		row := []any{i%3 == 0, int64(i - 20), float64(i) / 4, string(rune('a' + i%26))}
+		if i%7 == 0 {
+			row[i%4] = nil
+		}
+		rows = append(rows, row)
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, columns, WithRowGroupSize(16))
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if w.NumRows() != int64(len(rows)) {
+		t.Errorf("expected %d rows, got %d", len(rows), w.NumRows())
+	}
+
+	schema, got := readFile(t, buf.Bytes())
+	for i, s := range schema {
+		if s[4] != columns[i].Name || s[1] != int64(columns[i].Type.physicalType()) || s[3] != int64(repetitionOptional) {
+			t.Errorf("unexpected schema element %v for column %+v", s, columns[i])
+		}
+	}
+	if _, ok := schema[3][6]; !ok {
+		t.Errorf("expected the string column to be annotated as UTF8")
+	}
+	if !reflect.DeepEqual(got, rows) {
+		t.Errorf("expected rows %v, got %v", rows, got)
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	if _, err := NewWriter(&bytes.Buffer{}, nil); err == nil {
+		t.Errorf("expected an error without columns")
+	}
+	if _, err := NewWriter(&bytes.Buffer{}, []Column{{Name: "a"}, {Name: "a"}}); err == nil {
+		t.Errorf("expected an error for duplicate columns")
+	}
+
+	w, err := NewWriter(&bytes.Buffer{}, []Column{{Name: "a", Type: Int64}})
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	if err := w.Write([]any{"x"}); err == nil {
+		t.Errorf("expected an error for a value of the wrong type")
+	}
+	if err := w.Write([]any{int64(1), int64(2)}); err == nil {
+		t.Errorf("expected an error for a row of the wrong length")
+	}
+}
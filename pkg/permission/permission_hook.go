@@ -14,6 +14,7 @@ const (
 	operationAboutDelete
 
 	operationAboutRepo
+	operationAboutServer
 
 	// OperationUnknown represents an unknown or unrecognized operation.
 	OperationUnknown Operation = 0
@@ -25,6 +26,9 @@ const (
 	OperationReadRepo = operationAboutRead | operationAboutRepo
 	// OperationUpdateRepo represents updating repository settings.
 	OperationUpdateRepo = operationAboutUpdate | operationAboutRepo
+	// OperationManageServer represents server-wide administration, such as maintaining all repositories.
+	// It is checked with an empty repository name.
+	OperationManageServer = operationAboutUpdate | operationAboutServer
 )
 
 // String returns a human-readable name for the operation.
@@ -38,6 +42,8 @@ func (o Operation) String() string {
 		return "read_repo"
 	case OperationUpdateRepo:
 		return "update_repo"
+	case OperationManageServer:
+		return "manage_server"
 	default:
 		return "unknown"
 	}
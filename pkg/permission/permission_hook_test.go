@@ -15,6 +15,7 @@ func TestOperationConstants(t *testing.T) {
 		permission.OperationDeleteRepo,
 		permission.OperationReadRepo,
 		permission.OperationUpdateRepo,
+		permission.OperationManageServer,
 	}
 	seen := map[permission.Operation]bool{}
 	for _, op := range ops {
@@ -43,6 +44,7 @@ func TestOperationString(t *testing.T) {
 		{permission.OperationDeleteRepo, "delete_repo"},
 		{permission.OperationReadRepo, "read_repo"},
 		{permission.OperationUpdateRepo, "update_repo"},
+		{permission.OperationManageServer, "manage_server"},
 		{permission.Operation(99), "unknown"},
 	}
 	for _, tt := range tests {
@@ -0,0 +1,396 @@
+package pushmirror
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/matrixhub-ai/hfd/internal/utils"
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/receive"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+	"github.com/matrixhub-ai/hfd/pkg/storage"
+)
+
+const (
+	defaultMaxAttempts = 8
+	defaultBackoff     = 5 * time.Second
+	defaultMaxBackoff  = 5 * time.Minute
+)
+
+// RemotesFunc returns the URLs of the git remotes a repository is replicated to.
+// Returning no remotes disables push mirroring for the repository.
+type RemotesFunc func(ctx context.Context, repoName string) ([]string, error)
+
+// State is the replication state of a repository to a remote.
+type State string
+
+const (
+	// StateIdle means nothing has been pushed to the remote yet.
+	StateIdle State = "idle"
+	// StatePending means ref updates are queued, possibly waiting for a retry.
+	StatePending State = "pending"
+	// StatePushing means a push to the remote is in progress.
+	StatePushing State = "pushing"
+	// StateSynced means the last push succeeded and no ref updates are queued.
+	StateSynced State = "synced"
+	// StateFailed means pushing was given up after too many attempts.
+	// The queued ref updates are retried on the next push or sync.
+	StateFailed State = "failed"
+)
+
+// Status reports the replication state of a repository to a single remote.
+type Status struct {
+	Remote      string    `json:"remote"`
+	State       State     `json:"state"`
+	PendingRefs []string  `json:"pendingRefs,omitempty"`
+	Attempts    int       `json:"attempts"`
+	LastAttempt time.Time `json:"lastAttempt,omitzero"`
+	LastSuccess time.Time `json:"lastSuccess,omitzero"`
+	NextRetry   time.Time `json:"nextRetry,omitzero"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+type target struct {
+	repoName string
+	remote   string
+}
+
+type targetState struct {
+	status  Status
+	refs    map[string]struct{}
+	running bool
+	// pushed holds the commit each ref was last pushed at, the remote having everything reachable from them
+	pushed map[string]string
+}
+
+// PushMirror replicates local repositories to remote git remotes. Ref updates are queued per
+// repository and remote, and pushed in the background together with the LFS objects they reference,
+// retrying with exponential backoff on failure.
+type PushMirror struct {
+	storage     *storage.Storage
+	lfsStorage  lfs.Storage
+	remotesFunc RemotesFunc
+	httpClient  *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+
+	mut     sync.Mutex
+	targets map[target]*targetState
+}
+
+// Option defines a functional option for configuring the PushMirror.
+type Option func(*PushMirror)
+
+// WithStorage sets the storage the replicated repositories are read from. This is required.
+func WithStorage(storage *storage.Storage) Option {
+	return func(p *PushMirror) {
+		p.storage = storage
+	}
+}
+
+// WithLFSStorage sets the LFS storage the replicated LFS objects are read from.
+// Without it, only git refs are pushed.
+func WithLFSStorage(storage lfs.Storage) Option {
+	return func(p *PushMirror) {
+		p.lfsStorage = storage
+	}
+}
+
+// WithRemotesFunc sets the callback returning the remotes of a repository.
+func WithRemotesFunc(fn RemotesFunc) Option {
+	return func(p *PushMirror) {
+		p.remotesFunc = fn
+	}
+}
+
+// WithRetry configures the retry queue. A failed push is retried up to maxAttempts times,
+// waiting backoff after the first failure and doubling the wait up to maxBackoff.
+func WithRetry(maxAttempts int, backoff, maxBackoff time.Duration) Option {
+	return func(p *PushMirror) {
+		p.maxAttempts = maxAttempts
+		p.backoff = backoff
+		p.maxBackoff = maxBackoff
+	}
+}
+
+// NewPushMirror creates a new PushMirror with the provided options.
+func NewPushMirror(opts ...Option) *PushMirror {
+	p := &PushMirror{
+		httpClient:  utils.HTTPClient,
+		maxAttempts: defaultMaxAttempts,
+		backoff:     defaultBackoff,
+		maxBackoff:  defaultMaxBackoff,
+		targets:     map[target]*targetState{},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// PostReceiveHook queues the updated refs for pushing to the remotes of the repository.
+// Repositories mirrored from another source are not replicated, so their syncs are skipped.
+// It matches receive.PostReceiveHookFunc.
+func (p *PushMirror) PostReceiveHook(ctx context.Context, repoName string, updates []receive.RefUpdate) error {
+	repo, err := p.openRepo(repoName)
+	if err != nil {
+		return err
+	}
+	if repo.IsMirror() {
+		return nil
+	}
+	refs := make([]string, 0, len(updates))
+	for _, update := range updates {
+		refs = append(refs, update.RefName())
+	}
+	return p.Enqueue(ctx, repoName, refs)
+}
+
+// Sync queues all branches and tags of the repository for pushing to its remotes.
+func (p *PushMirror) Sync(ctx context.Context, repoName string) error {
+	repo, err := p.openRepo(repoName)
+	if err != nil {
+		return err
+	}
+	localRefs, err := repo.Refs()
+	if err != nil {
+		return err
+	}
+	refs := make([]string, 0, len(localRefs))
+	for ref := range localRefs {
+		refs = append(refs, ref)
+	}
+	return p.Enqueue(ctx, repoName, refs)
+}
+
+// Enqueue queues the given refs for pushing to the remotes of the repository.
+// Refs are pushed with their state at push time, so several updates of the same ref are coalesced.
+func (p *PushMirror) Enqueue(ctx context.Context, repoName string, refs []string) error {
+	if len(refs) == 0 || p.remotesFunc == nil {
+		return nil
+	}
+	remotes, err := p.remotesFunc(ctx, repoName)
+	if err != nil {
+		return err
+	}
+
+	ctx = context.WithoutCancel(ctx)
+
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	for _, remote := range remotes {
+		t := target{repoName: repoName, remote: remote}
+		ts := p.targetState(t)
+		for _, ref := range refs {
+			ts.refs[ref] = struct{}{}
+		}
+		if ts.running {
+			continue
+		}
+		ts.running = true
+		ts.status.State = StatePending
+		ts.status.Attempts = 0
+		ts.status.NextRetry = time.Time{}
+		go p.run(ctx, t)
+	}
+	return nil
+}
+
+// Status returns the replication status of the repository to each of its remotes.
+func (p *PushMirror) Status(ctx context.Context, repoName string) ([]Status, error) {
+	if p.remotesFunc == nil {
+		return nil, nil
+	}
+	remotes, err := p.remotesFunc(ctx, repoName)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	result := make([]Status, 0, len(remotes))
+	for _, remote := range remotes {
+		ts, ok := p.targets[target{repoName: repoName, remote: remote}]
+		if !ok {
+			result = append(result, Status{Remote: redact(remote), State: StateIdle})
+			continue
+		}
+		status := ts.status
+		for ref := range ts.refs {
+			status.PendingRefs = append(status.PendingRefs, ref)
+		}
+		sort.Strings(status.PendingRefs)
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+// targetState returns the state of the target, creating it if needed. The caller must hold p.mut.
+func (p *PushMirror) targetState(t target) *targetState {
+	ts, ok := p.targets[t]
+	if !ok {
+		ts = &targetState{
+			status: Status{Remote: redact(t.remote), State: StateIdle},
+			refs:   map[string]struct{}{},
+			pushed: map[string]string{},
+		}
+		p.targets[t] = ts
+	}
+	return ts
+}
+
+// run pushes the queued refs of the target until the queue is empty or the retries are exhausted.
+func (p *PushMirror) run(ctx context.Context, t target) {
+	for {
+		p.mut.Lock()
+		ts := p.targets[t]
+		if len(ts.refs) == 0 {
+			ts.running = false
+			p.mut.Unlock()
+			return
+		}
+		refs := make([]string, 0, len(ts.refs))
+		for ref := range ts.refs {
+			refs = append(refs, ref)
+		}
+		sort.Strings(refs)
+		clear(ts.refs)
+		exclude := make([]string, 0, len(ts.pushed))
+		for _, hash := range ts.pushed {
+			exclude = append(exclude, hash)
+		}
+		ts.status.State = StatePushing
+		ts.status.LastAttempt = time.Now()
+		ts.status.NextRetry = time.Time{}
+		p.mut.Unlock()
+
+		pushed, err := p.push(ctx, t, refs, exclude)
+
+		p.mut.Lock()
+		if err == nil {
+			for _, ref := range refs {
+				if hash, ok := pushed[ref]; ok {
+					ts.pushed[ref] = hash
+				} else {
+					delete(ts.pushed, ref)
+				}
+			}
+			ts.status.State = StateSynced
+			ts.status.LastSuccess = time.Now()
+			ts.status.Attempts = 0
+			ts.status.LastError = ""
+			p.mut.Unlock()
+			slog.InfoContext(ctx, "Push mirror: pushed refs", "repo", t.repoName, "remote", ts.status.Remote, "refs", refs)
+			continue
+		}
+
+		for _, ref := range refs {
+			ts.refs[ref] = struct{}{}
+		}
+		ts.status.Attempts++
+		ts.status.LastError = err.Error()
+		if ts.status.Attempts >= p.maxAttempts {
+			ts.status.State = StateFailed
+			ts.running = false
+			p.mut.Unlock()
+			slog.ErrorContext(ctx, "Push mirror: giving up pushing refs", "repo", t.repoName, "remote", ts.status.Remote, "attempts", p.maxAttempts, "error", err)
+			return
+		}
+		delay := p.retryDelay(ts.status.Attempts)
+		ts.status.State = StatePending
+		ts.status.NextRetry = time.Now().Add(delay)
+		p.mut.Unlock()
+
+		slog.WarnContext(ctx, "Push mirror: failed to push refs, retrying", "repo", t.repoName, "remote", ts.status.Remote, "retryIn", delay, "error", err)
+		time.Sleep(delay)
+	}
+}
+
+// retryDelay returns the wait before the next attempt after the given number of failed attempts.
+func (p *PushMirror) retryDelay(attempts int) time.Duration {
+	delay := p.backoff
+	for range attempts - 1 {
+		delay *= 2
+		if delay >= p.maxBackoff {
+			return p.maxBackoff
+		}
+	}
+	return min(delay, p.maxBackoff)
+}
+
+// push uploads the LFS objects referenced by the commits the refs add to the remote, and then pushes the refs.
+// LFS objects go first so the remote never has commits whose LFS objects are missing. The commits reachable
+// from exclude are known to be on the remote already. It returns the commits the existing refs were pushed at.
+func (p *PushMirror) push(ctx context.Context, t target, refs []string, exclude []string) (map[string]string, error) {
+	repo, err := p.openRepo(t.repoName)
+	if err != nil {
+		return nil, err
+	}
+
+	localRefs, err := repo.Refs()
+	if err != nil {
+		return nil, err
+	}
+	pushed := map[string]string{}
+	for _, ref := range refs {
+		if hash, ok := localRefs[ref]; ok {
+			pushed[ref] = hash
+		}
+	}
+
+	if p.lfsStorage != nil {
+		var objects []lfs.LFSObject
+		seen := map[string]bool{}
+		for _, ref := range refs {
+			hash, ok := pushed[ref]
+			if !ok {
+				continue
+			}
+			ptrs, err := repo.ScanLFSPointersRange(ctx, hash, exclude)
+			if err != nil {
+				return nil, fmt.Errorf("failed to scan LFS pointers of %s: %w", ref, err)
+			}
+			for _, ptr := range ptrs {
+				if !seen[ptr.OID()] {
+					seen[ptr.OID()] = true
+					objects = append(objects, lfs.LFSObject{Oid: ptr.OID(), Size: ptr.Size()})
+				}
+			}
+		}
+
+		if len(objects) != 0 {
+			if err := lfs.Push(ctx, p.httpClient, t.remote, p.lfsStorage, objects); err != nil {
+				return nil, fmt.Errorf("failed to push LFS objects: %w", err)
+			}
+		}
+	}
+
+	if err := repo.PushRefs(ctx, t.remote, refs); err != nil {
+		return nil, err
+	}
+	return pushed, nil
+}
+
+func (p *PushMirror) openRepo(repoName string) (*repository.Repository, error) {
+	repoPath := p.storage.ResolvePath(repoName)
+	if repoPath == "" {
+		return nil, repository.ErrRepositoryNotExists
+	}
+	return repository.Open(repoPath)
+}
+
+// redact hides the credentials of a remote URL.
+func redact(remote string) string {
+	u, err := url.Parse(remote)
+	if err != nil {
+		return remote
+	}
+	return u.Redacted()
+}
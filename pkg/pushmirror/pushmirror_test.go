@@ -0,0 +1,165 @@
+package pushmirror
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matrixhub-ai/hfd/pkg/receive"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+	"github.com/matrixhub-ai/hfd/pkg/storage"
+)
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func waitState(t *testing.T, p *PushMirror, repoName string, want State) Status {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		status, err := p.Status(context.Background(), repoName)
+		if err != nil {
+			t.Fatalf("status: %v", err)
+		}
+		if len(status) != 1 {
+			t.Fatalf("expected status for 1 remote, got %d", len(status))
+		}
+		if status[0].State == want {
+			return status[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected state %q, got %+v", want, status[0])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPushMirror(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+
+	store := storage.NewStorage(storage.WithRootDir(filepath.Join(root, "data")))
+	repo, err := repository.Init(ctx, store.ResolvePath("org/repo"), "main")
+	if err != nil {
+		t.Fatalf("init repository: %v", err)
+	}
+	head, err := repo.CreateCommit(ctx, "main", "initial", "test", "test@example.com", []repository.CommitOperation{
+		{Type: repository.CommitOperationAdd, Path: "README.md", Content: []byte("hello")},
+	}, "")
+	if err != nil {
+		t.Fatalf("create commit: %v", err)
+	}
+	if err := repo.CreateBranch("dev", head); err != nil {
+		t.Fatalf("create branch: %v", err)
+	}
+
+	remote := filepath.Join(root, "remote.git")
+	git(t, root, "init", "--bare", remote)
+
+	p := NewPushMirror(
+		WithStorage(store),
+		WithRemotesFunc(func(ctx context.Context, repoName string) ([]string, error) {
+			if repoName == "org/broken" {
+				return []string{filepath.Join(root, "missing.git")}, nil
+			}
+			return []string{remote}, nil
+		}),
+		WithRetry(2, 10*time.Millisecond, 20*time.Millisecond),
+	)
+
+	if status := waitState(t, p, "org/repo", StateIdle); status.Remote != remote {
+		t.Fatalf("expected remote %q, got %q", remote, status.Remote)
+	}
+
+	t.Run("push refs", func(t *testing.T) {
+		if err := p.Sync(ctx, "org/repo"); err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+		waitState(t, p, "org/repo", StateSynced)
+		if got := git(t, remote, "rev-parse", "refs/heads/main"); got != head {
+			t.Fatalf("expected remote main at %s, got %s", head, got)
+		}
+		if got := git(t, remote, "rev-parse", "refs/heads/dev"); got != head {
+			t.Fatalf("expected remote dev at %s, got %s", head, got)
+		}
+	})
+
+	t.Run("delete ref", func(t *testing.T) {
+		if err := repo.DeleteBranch("dev"); err != nil {
+			t.Fatalf("delete branch: %v", err)
+		}
+		if err := p.Enqueue(ctx, "org/repo", []string{"refs/heads/dev"}); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+		deadline := time.Now().Add(10 * time.Second)
+		for git(t, remote, "for-each-ref", "refs/heads/dev") != "" {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected dev to be deleted from the remote")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		waitState(t, p, "org/repo", StateSynced)
+	})
+
+	t.Run("skip mirrors", func(t *testing.T) {
+		mirrored, err := repository.Init(ctx, store.ResolvePath("org/mirrored"), "main")
+		if err != nil {
+			t.Fatalf("init repository: %v", err)
+		}
+		if err := mirrored.MarkMirror(ctx, "https://huggingface.co/org/mirrored.git"); err != nil {
+			t.Fatalf("mark mirror: %v", err)
+		}
+		hash, err := mirrored.CreateCommit(ctx, "main", "initial", "test", "test@example.com", []repository.CommitOperation{
+			{Type: repository.CommitOperationAdd, Path: "README.md", Content: []byte("mirrored")},
+		}, "")
+		if err != nil {
+			t.Fatalf("create commit: %v", err)
+		}
+
+		// Syncs of a pull mirror run the post-receive hook, but are not replicated
+		updates := []receive.RefUpdate{receive.NewRefUpdate(strings.Repeat("0", 40), hash, "refs/heads/main", mirrored.RepoPath())}
+		if err := p.PostReceiveHook(ctx, "org/mirrored", updates); err != nil {
+			t.Fatalf("post-receive hook: %v", err)
+		}
+		if status := waitState(t, p, "org/mirrored", StateIdle); len(status.PendingRefs) != 0 {
+			t.Errorf("expected nothing to be queued, got %v", status.PendingRefs)
+		}
+	})
+
+	t.Run("retry and fail", func(t *testing.T) {
+		broken, err := repository.Init(ctx, store.ResolvePath("org/broken"), "main")
+		if err != nil {
+			t.Fatalf("init repository: %v", err)
+		}
+		if _, err := broken.CreateCommit(ctx, "main", "initial", "test", "test@example.com", []repository.CommitOperation{
+			{Type: repository.CommitOperationAdd, Path: "README.md", Content: []byte("hello")},
+		}, ""); err != nil {
+			t.Fatalf("create commit: %v", err)
+		}
+
+		if err := p.Enqueue(ctx, "org/broken", []string{"refs/heads/main"}); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+		status := waitState(t, p, "org/broken", StateFailed)
+		if status.Attempts != 2 {
+			t.Errorf("expected 2 attempts, got %d", status.Attempts)
+		}
+		if status.LastError == "" {
+			t.Errorf("expected last error to be reported")
+		}
+		if len(status.PendingRefs) != 1 || status.PendingRefs[0] != "refs/heads/main" {
+			t.Errorf("expected main to stay queued, got %v", status.PendingRefs)
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package receive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	// sideBandMax is the maximum size of a packet of the side-band, as git's LARGE_PACKET_MAX.
+	sideBandMax = 65520
+	// smallSideBandMax is the maximum size of a packet of the side-band of clients not asking for side-band-64k.
+	smallSideBandMax = 1000
+)
+
+// Messages collects the messages hooks send to the client of a push, which git shows prefixed with "remote:".
+type Messages struct {
+	mut   sync.Mutex
+	lines []string
+}
+
+type messagesKey struct{}
+
+// WithMessages returns a context carrying a new Messages, which SendMessage adds to.
+func WithMessages(ctx context.Context) (context.Context, *Messages) {
+	m := &Messages{}
+	return context.WithValue(ctx, messagesKey{}, m), m
+}
+
+// SendMessage adds a message for the client of the push of ctx.
+// It does nothing unless the backend set up ctx with WithMessages.
+func SendMessage(ctx context.Context, format string, args ...any) {
+	m, ok := ctx.Value(messagesKey{}).(*Messages)
+	if !ok {
+		return
+	}
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.lines = append(m.lines, strings.Split(fmt.Sprintf(format, args...), "\n")...)
+}
+
+// Lines returns the lines of the messages sent so far.
+func (m *Messages) Lines() []string {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	return slices.Clone(m.lines)
+}
+
+// SideBandMessages returns the progress packets of the side-band showing lines to the client, to be sent
+// before the output of git-receive-pack. It returns nil unless the client asked for the side-band with caps.
+func SideBandMessages(caps []string, lines []string) []byte {
+	size := sideBandSize(caps)
+	if size == 0 || len(lines) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, line := range lines {
+		writeSideBand(&buf, 2, []byte(line+"\n"), size)
+	}
+	return buf.Bytes()
+}
+
+// RejectionReport returns the result of a push rejected before git-receive-pack runs, showing lines to the client
+// and marking each ref update as rejected for reason. It returns nil unless the client asked for report-status with caps,
+// as clients that did not only see the status of the response.
+func RejectionReport(caps []string, updates []RefUpdate, lines []string, reason string) []byte {
+	if !slices.Contains(caps, "report-status") && !slices.Contains(caps, "report-status-v2") {
+		return nil
+	}
+	reason = strings.Join(strings.Fields(reason), " ")
+
+	var report bytes.Buffer
+	writePacket(&report, []byte("unpack ok\n"))
+	for _, u := range updates {
+		writePacket(&report, []byte(fmt.Sprintf("ng %s %s\n", u.RefName(), reason)))
+	}
+	report.WriteString("0000")
+
+	size := sideBandSize(caps)
+	if size == 0 {
+		return report.Bytes()
+	}
+	var buf bytes.Buffer
+	for _, line := range lines {
+		writeSideBand(&buf, 2, []byte(line+"\n"), size)
+	}
+	writeSideBand(&buf, 1, report.Bytes(), size)
+	buf.WriteString("0000")
+	return buf.Bytes()
+}
+
+// sideBandSize returns the maximum size of the packets of the side-band the client asked for, or 0 if it did not.
+func sideBandSize(caps []string) int {
+	switch {
+	case slices.Contains(caps, "side-band-64k"):
+		return sideBandMax
+	case slices.Contains(caps, "side-band"):
+		return smallSideBandMax
+	}
+	return 0
+}
+
+// writeSideBand writes data to the band of the side-band, in packets of at most size bytes.
+func writeSideBand(buf *bytes.Buffer, band byte, data []byte, size int) {
+	for len(data) > 0 {
+		n := min(len(data), size-5)
+		writePacket(buf, append([]byte{band}, data[:n]...))
+		data = data[n:]
+	}
+}
+
+func writePacket(buf *bytes.Buffer, payload []byte) {
+	fmt.Fprintf(buf, "%04x", len(payload)+4)
+	buf.Write(payload)
+}
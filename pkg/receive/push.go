@@ -0,0 +1,52 @@
+package receive
+
+import (
+	"context"
+	"sync"
+)
+
+// push is a push in progress, from its pre-receive hook to its end.
+type push struct {
+	mut   sync.Mutex
+	ended bool
+	onEnd []func()
+}
+
+type pushKey struct{}
+
+// WithPush returns a context for a push, and the function ending it. Backends call the hooks of the
+// push with the context, and defer the end right away, so that it runs whether the refs were updated,
+// the push was rejected or it failed. The end runs the functions hooks registered with OnPushEnd.
+func WithPush(ctx context.Context) (context.Context, func()) {
+	p := &push{}
+	return context.WithValue(ctx, pushKey{}, p), p.end
+}
+
+// OnPushEnd registers fn to run once the push of ctx ends. It reports false, without registering fn,
+// unless the backend set up ctx with WithPush. fn runs right away if the push already ended.
+func OnPushEnd(ctx context.Context, fn func()) bool {
+	p, ok := ctx.Value(pushKey{}).(*push)
+	if !ok {
+		return false
+	}
+	p.mut.Lock()
+	if p.ended {
+		p.mut.Unlock()
+		fn()
+		return true
+	}
+	p.onEnd = append(p.onEnd, fn)
+	p.mut.Unlock()
+	return true
+}
+
+func (p *push) end() {
+	p.mut.Lock()
+	onEnd := p.onEnd
+	p.onEnd = nil
+	p.ended = true
+	p.mut.Unlock()
+	for _, fn := range onEnd {
+		fn()
+	}
+}
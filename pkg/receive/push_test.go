@@ -0,0 +1,32 @@
+package receive
+
+import (
+	"context"
+	"testing"
+)
+
+func TestOnPushEnd(t *testing.T) {
+	if OnPushEnd(context.Background(), func() {}) {
+		t.Errorf("Expected OnPushEnd to report a context without a push")
+	}
+
+	ctx, end := WithPush(context.Background())
+	var ended int
+	if !OnPushEnd(ctx, func() { ended++ }) {
+		t.Fatalf("Expected OnPushEnd to register on the context of a push")
+	}
+	if ended != 0 {
+		t.Fatalf("Expected the push not to be ended yet")
+	}
+	end()
+	end()
+	if ended != 1 {
+		t.Errorf("Expected the end of the push to run once, ran %d times", ended)
+	}
+
+	// Registering after the end runs right away
+	OnPushEnd(ctx, func() { ended++ })
+	if ended != 2 {
+		t.Errorf("Expected a registration after the end to run right away")
+	}
+}
@@ -0,0 +1,439 @@
+package receive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/matrixhub-ai/hfd/internal/utils"
+)
+
+// QuarantineHookFunc is called with the objects of a push after the pre-receive hook accepted it,
+// before any of them is stored in the repository or any ref is updated.
+// Returning a non-nil error rejects the push, the error message being reported to the client.
+type QuarantineHookFunc func(ctx context.Context, repoName string, q *Quarantine, updates []RefUpdate) error
+
+// ChainQuarantineHooks returns a QuarantineHookFunc calling the non-nil hooks in order, until one rejects the push.
+// It returns nil when there are no hooks.
+func ChainQuarantineHooks(hooks ...QuarantineHookFunc) QuarantineHookFunc {
+	var chain []QuarantineHookFunc
+	for _, hook := range hooks {
+		if hook != nil {
+			chain = append(chain, hook)
+		}
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+	return func(ctx context.Context, repoName string, q *Quarantine, updates []RefUpdate) error {
+		for _, hook := range chain {
+			if err := hook(ctx, repoName, q, updates); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Quarantine holds the objects of a push apart from the repository while they are checked,
+// as git does for its own pre-receive hooks. Git commands run by Command see both the quarantined
+// objects and the objects of the repository.
+type Quarantine struct {
+	repoPath     string
+	dir          string
+	spool        *os.File
+	input        *bufio.Reader
+	capabilities []string
+}
+
+// NewQuarantine reads the push from a receive-pack input stream, whose ref update commands were read by
+// ParseRefUpdates, and indexes the pack it carries into a temporary object directory.
+// Nothing past the pack is read, as SSH clients keep their input open while waiting for the result.
+// Reader replays the input stream afterwards. The quarantine must be closed to remove the objects.
+func NewQuarantine(ctx context.Context, repoPath string, input io.Reader, updates []RefUpdate) (*Quarantine, error) {
+	dir, err := os.MkdirTemp("", "hfd-quarantine-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create quarantine: %w", err)
+	}
+	q := &Quarantine{repoPath: repoPath, dir: dir, input: bufio.NewReader(input)}
+	if err := q.receive(ctx, updates); err != nil {
+		_ = q.Close()
+		return nil, err
+	}
+	return q, nil
+}
+
+// NewBundleQuarantine stores the objects of a git bundle file in a temporary object directory, so that an
+// import of the bundle can be checked like a push. It has no input stream to replay.
+// The quarantine must be closed to remove the objects.
+func NewBundleQuarantine(ctx context.Context, repoPath string, bundleFile string) (*Quarantine, error) {
+	dir, err := os.MkdirTemp("", "hfd-quarantine-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create quarantine: %w", err)
+	}
+	q := &Quarantine{repoPath: repoPath, dir: dir}
+	if err := os.MkdirAll(filepath.Join(q.dir, "objects", "pack"), 0o755); err != nil {
+		_ = q.Close()
+		return nil, fmt.Errorf("failed to create quarantine: %w", err)
+	}
+	cmd := q.Command(ctx, "bundle", "unbundle", bundleFile)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		_ = q.Close()
+		return nil, fmt.Errorf("failed to unbundle: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return q, nil
+}
+
+// NewRefQuarantine creates a quarantine without objects of its own, so that ref updates made by the server
+// to objects already in the repository can be checked like a push. It has no input stream to replay.
+// The quarantine must be closed to remove its directory.
+func NewRefQuarantine(repoPath string) (*Quarantine, error) {
+	dir, err := os.MkdirTemp("", "hfd-quarantine-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create quarantine: %w", err)
+	}
+	q := &Quarantine{repoPath: repoPath, dir: dir}
+	if err := os.MkdirAll(filepath.Join(q.dir, "objects", "pack"), 0o755); err != nil {
+		_ = q.Close()
+		return nil, fmt.Errorf("failed to create quarantine: %w", err)
+	}
+	return q, nil
+}
+
+// receive spools the commands, push options and pack of the push, and indexes the pack.
+func (q *Quarantine) receive(ctx context.Context, updates []RefUpdate) error {
+	if err := os.MkdirAll(filepath.Join(q.dir, "objects", "pack"), 0o755); err != nil {
+		return fmt.Errorf("failed to create quarantine: %w", err)
+	}
+	var err error
+	q.spool, err = os.Create(filepath.Join(q.dir, "input"))
+	if err != nil {
+		return fmt.Errorf("failed to create quarantine: %w", err)
+	}
+
+	var commands bytes.Buffer
+	if err := copyPackets(io.MultiWriter(q.spool, &commands), q.input); err != nil {
+		return fmt.Errorf("failed to read push: %w", err)
+	}
+	// The capabilities the client asked for follow the first command
+	firstLine, _, _ := bytes.Cut(commands.Bytes(), []byte("\n"))
+	if _, caps, ok := bytes.Cut(firstLine, []byte{0}); ok {
+		q.capabilities = strings.Fields(string(caps))
+	}
+	// The push options follow the commands when the client asked for them.
+	if slices.Contains(q.capabilities, "push-options") {
+		if err := copyPackets(q.spool, q.input); err != nil {
+			return fmt.Errorf("failed to read push options: %w", err)
+		}
+	}
+
+	// A push deleting refs only has no pack.
+	needPack := false
+	for _, u := range updates {
+		if !u.IsDelete() {
+			needPack = true
+		}
+	}
+	if !needPack {
+		return nil
+	}
+
+	packStart, err := q.spool.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if err := copyPack(q.spool, q.input); err != nil {
+		return fmt.Errorf("failed to read pack: %w", err)
+	}
+	if _, err := q.spool.Seek(packStart, io.SeekStart); err != nil {
+		return err
+	}
+
+	cmd := q.Command(ctx, "index-pack", "--stdin", "--fix-thin")
+	cmd.Stdin = q.spool
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to index pack: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Reader returns the input stream of the push, starting with its ref update commands.
+func (q *Quarantine) Reader() (io.Reader, error) {
+	if q.spool == nil {
+		return nil, errors.New("quarantine has no input stream")
+	}
+	if _, err := q.spool.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return io.MultiReader(q.spool, q.input), nil
+}
+
+// Capabilities returns the capabilities the client asked for with the commands of the push.
+func (q *Quarantine) Capabilities() []string {
+	return q.capabilities
+}
+
+// Command returns a git command run in the repository that also sees the quarantined objects.
+func (q *Quarantine) Command(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := utils.Command(ctx, "git", args...)
+	cmd.Dir = q.repoPath
+	cmd.Env = append(os.Environ(),
+		"GIT_DIR="+q.repoPath,
+		"GIT_OBJECT_DIRECTORY="+filepath.Join(q.dir, "objects"),
+		"GIT_ALTERNATE_OBJECT_DIRECTORIES="+filepath.Join(q.repoPath, "objects"),
+	)
+	return cmd
+}
+
+// IsAncestor reports whether the commit ancestor is reachable from the commit rev.
+func (q *Quarantine) IsAncestor(ctx context.Context, ancestor, rev string) (bool, error) {
+	err := q.Command(ctx, "merge-base", "--is-ancestor", ancestor, rev).Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check whether %s is an ancestor of %s: %w", ancestor, rev, err)
+	}
+	return true, nil
+}
+
+// NewCommits returns the commits reachable from rev that are not reachable from any ref of the repository,
+// newest first.
+func (q *Quarantine) NewCommits(ctx context.Context, rev string) ([]string, error) {
+	out, err := q.Command(ctx, "rev-list", rev, "--not", "--all").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list new commits of %s: %w", rev, err)
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// Commits returns the commits reachable from rev that are not reachable from any of exclude, newest first.
+func (q *Quarantine) Commits(ctx context.Context, rev string, exclude ...string) ([]string, error) {
+	args := append([]string{"rev-list", rev, "--not"}, exclude...)
+	out, err := q.Command(ctx, args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commits of %s: %w", rev, err)
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// Refs returns the current value of each ref of the repository, by name.
+func (q *Quarantine) Refs(ctx context.Context) (map[string]string, error) {
+	out, err := q.Command(ctx, "for-each-ref", "--format=%(objectname) %(refname)").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refs: %w", err)
+	}
+	refs := map[string]string{}
+	for line := range strings.Lines(string(out)) {
+		hash, name, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if ok {
+			refs[name] = hash
+		}
+	}
+	return refs, nil
+}
+
+// MaxReadObjectSize is the size of the largest object ReadObjects reads.
+const MaxReadObjectSize = 32 << 20
+
+// ErrObjectTooLarge is returned by ReadObjects for objects larger than MaxReadObjectSize.
+var ErrObjectTooLarge = fmt.Errorf("object is larger than %d bytes", MaxReadObjectSize)
+
+// ReadObjects calls fn with the type and raw content of each object, in order.
+// It is meant for small objects such as commits and tags: objects larger than
+// MaxReadObjectSize fail with ErrObjectTooLarge, use StreamObjects to read them.
+func (q *Quarantine) ReadObjects(ctx context.Context, hashes []string, fn func(hash string, objectType string, content []byte) error) error {
+	return q.StreamObjects(ctx, hashes, func(hash string, objectType string, size int64, r io.Reader) error {
+		if size > MaxReadObjectSize {
+			return fmt.Errorf("failed to read object %s: %w", hash, ErrObjectTooLarge)
+		}
+		content := make([]byte, size)
+		if _, err := io.ReadFull(r, content); err != nil {
+			return fmt.Errorf("failed to read object %s: %w", hash, err)
+		}
+		return fn(hash, objectType, content)
+	})
+}
+
+// StreamObjects calls fn with the type, size and a reader of the raw content of each object, in order.
+// The reader is only valid until fn returns, the content fn does not read being skipped.
+func (q *Quarantine) StreamObjects(ctx context.Context, hashes []string, fn func(hash string, objectType string, size int64, r io.Reader) error) error {
+	if len(hashes) == 0 {
+		return nil
+	}
+	cmd := q.Command(ctx, "cat-file", "--batch")
+	cmd.Stdin = strings.NewReader(strings.Join(hashes, "\n") + "\n")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to read objects: %w", err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	br := bufio.NewReader(stdout)
+	for range hashes {
+		header, err := br.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read objects: %w", err)
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			return fmt.Errorf("failed to read object: %s", strings.TrimSpace(header))
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("failed to read object: %s", strings.TrimSpace(header))
+		}
+		content := io.LimitReader(br, size)
+		if err := fn(fields[0], fields[1], size, content); err != nil {
+			return err
+		}
+		// Skip what was not read, and the trailing newline
+		if _, err := io.Copy(io.Discard, content); err != nil {
+			return fmt.Errorf("failed to read object %s: %w", fields[0], err)
+		}
+		if _, err := br.Discard(1); err != nil {
+			return fmt.Errorf("failed to read object %s: %w", fields[0], err)
+		}
+	}
+	return nil
+}
+
+// Close removes the quarantined objects.
+func (q *Quarantine) Close() error {
+	if q.spool != nil {
+		_ = q.spool.Close()
+	}
+	return os.RemoveAll(q.dir)
+}
+
+// copyPackets copies the pkt-lines of r to w, up to and including the next flush packet.
+func copyPackets(w io.Writer, r io.Reader) error {
+	head := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, head); err != nil {
+			return unexpectedEOF(err)
+		}
+		n, err := strconv.ParseUint(string(head), 16, 16)
+		if err != nil || (n != 0 && n < 4) {
+			return errors.New("invalid pkt-line")
+		}
+		if _, err := w.Write(head); err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		if _, err := io.CopyN(w, r, int64(n-4)); err != nil {
+			return unexpectedEOF(err)
+		}
+	}
+}
+
+// copyPack copies a pack of r to w, reading no further than its trailing checksum.
+// The end of a pack is only known by walking its objects, inflating their content.
+func copyPack(w io.Writer, r *bufio.Reader) error {
+	pr := &byteTeeReader{r: r, w: bufio.NewWriter(w)}
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(pr, header); err != nil {
+		return unexpectedEOF(err)
+	}
+	if string(header[:4]) != "PACK" {
+		return errors.New("invalid pack signature")
+	}
+
+	var z io.ReadCloser
+	for count := binary.BigEndian.Uint32(header[8:]); count > 0; count-- {
+		c, err := pr.ReadByte()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		objectType := (c >> 4) & 7
+		for c&0x80 != 0 {
+			if c, err = pr.ReadByte(); err != nil {
+				return unexpectedEOF(err)
+			}
+		}
+		switch objectType {
+		case 6: // offset delta
+			for c = 0x80; c&0x80 != 0; {
+				if c, err = pr.ReadByte(); err != nil {
+					return unexpectedEOF(err)
+				}
+			}
+		case 7: // reference delta
+			if _, err := io.CopyN(io.Discard, pr, 20); err != nil {
+				return unexpectedEOF(err)
+			}
+		}
+
+		if z == nil {
+			z, err = zlib.NewReader(pr)
+		} else {
+			err = z.(zlib.Resetter).Reset(pr, nil)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(io.Discard, z); err != nil {
+			return err
+		}
+	}
+	if _, err := io.CopyN(io.Discard, pr, 20); err != nil {
+		return unexpectedEOF(err)
+	}
+	return pr.w.Flush()
+}
+
+// byteTeeReader writes to w the bytes read from r. It is an io.ByteReader,
+// so that inflating data through it does not read past the end of the compressed stream.
+type byteTeeReader struct {
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func (t *byteTeeReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if _, werr := t.w.Write(p[:n]); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (t *byteTeeReader) ReadByte() (byte, error) {
+	b, err := t.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	return b, t.w.WriteByte(b)
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,152 @@
+package receive
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runGit(t *testing.T, dir string, stdin io.Reader, args ...string) string {
+	t.Helper()
+	cmd := exec.CommandContext(t.Context(), "git", args...)
+	cmd.Dir = dir
+	cmd.Stdin = stdin
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("git %s failed: %v", strings.Join(args, " "), err)
+	}
+	return string(out)
+}
+
+func TestQuarantine(t *testing.T) {
+	repoDir := filepath.Join(t.TempDir(), "repo.git")
+	workDir := t.TempDir()
+	runGit(t, "", nil, "init", "--bare", "--initial-branch=main", repoDir)
+	runGit(t, "", nil, "init", "--initial-branch=main", workDir)
+	runGit(t, workDir, nil, "config", "user.email", "test@test.com")
+	runGit(t, workDir, nil, "config", "user.name", "Test User")
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(workDir, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		runGit(t, workDir, nil, "add", name)
+		runGit(t, workDir, nil, "commit", "-m", "Add "+name)
+	}
+	head := strings.TrimSpace(runGit(t, workDir, nil, "rev-parse", "HEAD"))
+	parent := strings.TrimSpace(runGit(t, workDir, nil, "rev-parse", "HEAD~1"))
+	pack := runGit(t, workDir, strings.NewReader(head+"\n"), "pack-objects", "--stdout", "--revs")
+
+	// The input a client sends, followed by data the quarantine must not read.
+	input := pktLine(ZeroHash+" "+head+" refs/heads/main\x00report-status push-options\n") + "0000" +
+		pktLine("ci.skip\n") + "0000" +
+		pack
+	const trailing = "trailing"
+
+	updates, replay := ParseRefUpdates(strings.NewReader(input+trailing), repoDir)
+	q, err := NewQuarantine(t.Context(), repoDir, replay, updates)
+	if err != nil {
+		t.Fatalf("NewQuarantine: %v", err)
+	}
+	defer q.Close()
+
+	commits, err := q.NewCommits(t.Context(), head)
+	if err != nil {
+		t.Fatalf("NewCommits: %v", err)
+	}
+	if len(commits) != 2 || commits[0] != head || commits[1] != parent {
+		t.Fatalf("expected new commits %s %s, got %v", head, parent, commits)
+	}
+
+	var types []string
+	err = q.ReadObjects(t.Context(), commits, func(hash string, objectType string, content []byte) error {
+		types = append(types, objectType)
+		if !bytes.HasPrefix(content, []byte("tree ")) {
+			t.Errorf("unexpected content of %s: %q", hash, content)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadObjects: %v", err)
+	}
+	if strings.Join(types, " ") != "commit commit" {
+		t.Errorf("unexpected object types %v", types)
+	}
+
+	// The content left unread is skipped
+	var heads []string
+	err = q.StreamObjects(t.Context(), commits, func(hash string, objectType string, size int64, r io.Reader) error {
+		head := make([]byte, 5)
+		if _, err := io.ReadFull(r, head); err != nil {
+			return err
+		}
+		heads = append(heads, string(head))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamObjects: %v", err)
+	}
+	if strings.Join(heads, ",") != "tree ,tree " {
+		t.Errorf("unexpected object contents %q", heads)
+	}
+
+	// The objects are not in the repository until the push is processed.
+	if err := exec.CommandContext(t.Context(), "git", "--git-dir", repoDir, "cat-file", "-e", head).Run(); err == nil {
+		t.Errorf("expected %s not to be in the repository", head)
+	}
+
+	r, err := q.Reader()
+	if err != nil {
+		t.Fatalf("Reader: %v", err)
+	}
+	all, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading replay: %v", err)
+	}
+	if string(all) != input+trailing {
+		t.Errorf("replayed input does not match the original (%d bytes, want %d)", len(all), len(input+trailing))
+	}
+
+	dir := q.dir
+	if err := q.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected quarantine to be removed, got %v", err)
+	}
+}
+
+func TestQuarantineDeleteOnly(t *testing.T) {
+	repoDir := filepath.Join(t.TempDir(), "repo.git")
+	runGit(t, "", nil, "init", "--bare", "--initial-branch=main", repoDir)
+
+	input := pktLine("1111111111111111111111111111111111111111 "+ZeroHash+" refs/heads/old\x00report-status\n") + "0000"
+	// A client deleting refs sends no pack, and waits for the result without closing its input.
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go func() {
+		_, _ = io.WriteString(pw, input)
+	}()
+
+	updates, replay := ParseRefUpdates(pr, repoDir)
+	q, err := NewQuarantine(t.Context(), repoDir, replay, updates)
+	if err != nil {
+		t.Fatalf("NewQuarantine: %v", err)
+	}
+	defer q.Close()
+
+	r, err := q.Reader()
+	if err != nil {
+		t.Fatalf("Reader: %v", err)
+	}
+	got := make([]byte, len(input))
+	if _, err := io.ReadFull(r, got); err != nil {
+		t.Fatalf("reading replay: %v", err)
+	}
+	if string(got) != input {
+		t.Errorf("replayed %q, want %q", got, input)
+	}
+}
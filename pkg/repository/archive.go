@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+)
+
+// ArchiveFormat is the file format of a repository archive.
+type ArchiveFormat string
+
+const (
+	// ArchiveTarGz is a gzip compressed tar archive.
+	ArchiveTarGz ArchiveFormat = "tar.gz"
+	// ArchiveZip is a zip archive.
+	ArchiveZip ArchiveFormat = "zip"
+)
+
+// ArchiveFormats is the list of supported archive formats.
+var ArchiveFormats = []ArchiveFormat{ArchiveTarGz, ArchiveZip}
+
+// LFSOpenFunc opens the content of an LFS object.
+type LFSOpenFunc func(ptr *lfs.Pointer) (io.ReadCloser, error)
+
+// ArchiveOptions provides options for the WriteArchive method.
+type ArchiveOptions struct {
+	// Prefix is prepended to the path of every file in the archive.
+	Prefix string
+	// OpenLFS opens the content of the LFS objects. Without it, LFS files are archived as their pointer files.
+	OpenLFS LFSOpenFunc
+}
+
+// ArchiveFile is a file of a repository archive.
+type ArchiveFile struct {
+	Path string
+	Blob *Blob
+	// LFS is the LFS pointer of the file, if it is tracked by LFS.
+	LFS *lfs.Pointer
+}
+
+// ArchiveFiles returns the files under treePath at the given commit, sorted by path, as archived by WriteArchive.
+func (r *Repository) ArchiveFiles(commit string, treePath string) ([]ArchiveFile, error) {
+	entries, err := r.Tree(commit, treePath, &TreeOptions{Recursive: true})
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]ArchiveFile, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type() != EntryTypeFile {
+			continue
+		}
+		blob, err := entry.Blob()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get blob for entry %q: %w", entry.Path(), err)
+		}
+		ptr, _ := blob.LFSPointer()
+		files = append(files, ArchiveFile{Path: entry.Path(), Blob: blob, LFS: ptr})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files, nil
+}
+
+// WriteArchive writes the files under treePath at the given commit to w as an archive.
+// The archive only depends on its arguments: files are sorted by path, and their times are
+// the commit time, so archiving the same commit twice gives the same bytes.
+func (r *Repository) WriteArchive(w io.Writer, commit string, treePath string, format ArchiveFormat, opts *ArchiveOptions) error {
+	if opts == nil {
+		opts = &ArchiveOptions{}
+	}
+
+	hash, err := r.repo.ResolveRevision(plumbing.Revision(commit))
+	if err != nil {
+		return fmt.Errorf("failed to resolve revision: %w", err)
+	}
+	c, err := r.repo.CommitObject(*hash)
+	if err != nil {
+		return fmt.Errorf("failed to get commit object: %w", err)
+	}
+	modTime := c.Committer.When.UTC()
+
+	files, err := r.ArchiveFiles(hash.String(), treePath)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case ArchiveTarGz:
+		return writeTarGz(w, files, modTime, opts)
+	case ArchiveZip:
+		return writeZip(w, files, modTime, opts)
+	default:
+		return fmt.Errorf("unsupported archive format %q", format)
+	}
+}
+
+// open returns the content of an archived file and its size.
+func (f *ArchiveFile) open(opts *ArchiveOptions) (io.ReadCloser, int64, error) {
+	if f.LFS != nil && opts.OpenLFS != nil {
+		rc, err := opts.OpenLFS(f.LFS)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to open LFS object %q of %q: %w", f.LFS.OID(), f.Path, err)
+		}
+		return rc, f.LFS.Size(), nil
+	}
+	rc, err := f.Blob.NewReader()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read %q: %w", f.Path, err)
+	}
+	return rc, f.Blob.Size(), nil
+}
+
+// copyFile copies the content of an archived file, failing if it is not exactly size bytes long.
+func copyFile(w io.Writer, rc io.ReadCloser, name string, size int64) error {
+	defer func() {
+		_ = rc.Close()
+	}()
+	n, err := io.CopyN(w, rc, size)
+	if err != nil {
+		return fmt.Errorf("failed to archive %q: %d of %d bytes copied: %w", name, n, size, err)
+	}
+	return nil
+}
+
+func writeTarGz(w io.Writer, files []ArchiveFile, modTime time.Time, opts *ArchiveOptions) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, f := range files {
+		rc, size, err := f.open(opts)
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     path.Join(opts.Prefix, f.Path),
+			Size:     size,
+			Mode:     0644,
+			ModTime:  modTime,
+			Format:   tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			_ = rc.Close()
+			return err
+		}
+		if err := copyFile(tw, rc, f.Path, size); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func writeZip(w io.Writer, files []ArchiveFile, modTime time.Time, opts *ArchiveOptions) error {
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		rc, size, err := f.open(opts)
+		if err != nil {
+			return err
+		}
+		hdr := &zip.FileHeader{
+			Name:     path.Join(opts.Prefix, f.Path),
+			Modified: modTime,
+			Method:   zip.Deflate,
+		}
+		if f.LFS != nil {
+			// LFS files are mostly large binaries which do not compress well.
+			hdr.Method = zip.Store
+		}
+		hdr.SetMode(0644)
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			_ = rc.Close()
+			return err
+		}
+		if err := copyFile(fw, rc, f.Path, size); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
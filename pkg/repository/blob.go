@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/matrixhub-ai/hfd/pkg/lfs"
 )
 
@@ -62,16 +63,11 @@ func (b *Blob) LFSPointer() (*lfs.Pointer, error) {
 }
 
 func (b *Blob) parseLFS(r *Repository) (*lfs.Pointer, error) {
-	blob, err := r.repo.BlobObject(b.hash)
-	if err != nil {
-		return nil, err
-	}
-
-	if blob.Size > lfs.MaxLFSPointerSize {
+	if b.size > lfs.MaxLFSPointerSize {
 		return nil, nil
 	}
 
-	reader, err := blob.Reader()
+	reader, err := b.newReader()
 	if err != nil {
 		return nil, err
 	}
@@ -101,17 +97,27 @@ func (r *Repository) Blob(rev string, path string) (b *Blob, err error) {
 		return nil, fmt.Errorf("failed to get commit object: %w", err)
 	}
 
-	file, err := commit.File(path)
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree object: %w", err)
+	}
+
+	entry, err := tree.FindEntry(path)
+	if err != nil || !entry.Mode.IsFile() {
+		return nil, fmt.Errorf("file not found in tree: %w", object.ErrFileNotFound)
+	}
+
+	size, newReader, err := r.blobObject(entry.Hash)
 	if err != nil {
-		return nil, fmt.Errorf("file not found in tree: %w", err)
+		return nil, fmt.Errorf("failed to get blob object: %w", err)
 	}
 
 	return &Blob{
-		name:      file.Name,
-		size:      file.Size,
+		name:      path,
+		size:      size,
 		modTime:   commit.Committer.When,
-		newReader: file.Reader,
-		hash:      file.Hash,
+		newReader: newReader,
+		hash:      entry.Hash,
 		r:         r,
 	}, nil
 }
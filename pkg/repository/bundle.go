@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/matrixhub-ai/hfd/internal/utils"
+)
+
+// ErrEmptyBundle is returned when a bundle would contain no objects, because the
+// bundled refs are all reachable from the basis commits.
+var ErrEmptyBundle = errors.New("empty bundle")
+
+// CreateBundle writes a git bundle of the given refs to file. Objects reachable from the basis
+// commits are left out, making an incremental bundle that can only be fetched into a repository
+// having them.
+func (r *Repository) CreateBundle(ctx context.Context, file string, refs []string, basis []string) error {
+	args := append([]string{"bundle", "create", "--quiet", file}, refs...)
+	for _, commit := range basis {
+		args = append(args, "^"+commit)
+	}
+	var stderr bytes.Buffer
+	cmd := utils.Command(ctx, "git", args...)
+	cmd.Dir = r.repoPath
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stderr.String(), "empty bundle") {
+			return ErrEmptyBundle
+		}
+		return fmt.Errorf("failed to create bundle: %w", err)
+	}
+	return nil
+}
+
+// BundleHeads returns the refs recorded in a bundle file and the objects they point to.
+func BundleHeads(ctx context.Context, file string) (map[string]string, error) {
+	cmd := utils.Command(ctx, "git", "bundle", "list-heads", file)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bundle heads: %w", err)
+	}
+
+	heads := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		hash, name, ok := strings.Cut(scanner.Text(), " ")
+		if !ok || !strings.HasPrefix(name, "refs/") {
+			continue
+		}
+		heads[name] = hash
+	}
+	return heads, scanner.Err()
+}
+
+// FetchBundle checks that the repository has the prerequisite commits of a bundle file, then
+// stores the objects of the bundle and points the given refs to their values in the bundle.
+// Unless force is set, no ref is updated if a branch would not be fast-forwarded or a tag would be moved.
+// The objects are written by git, so the repository must be opened again to see them.
+func (r *Repository) FetchBundle(ctx context.Context, file string, refs []string, force bool) error {
+	defer lruCache.Remove(r.repoPath)
+
+	cmd := utils.Command(ctx, "git", "bundle", "verify", "--quiet", file)
+	cmd.Dir = r.repoPath
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("bundle cannot be applied to the repository: %w", err)
+	}
+
+	args := []string{"fetch", "--quiet", "--no-tags", "--no-write-fetch-head"}
+	if !force {
+		args = append(args, "--atomic")
+	}
+	args = append(args, file)
+	for _, ref := range refs {
+		refspec := ref + ":" + ref
+		if force {
+			refspec = "+" + refspec
+		}
+		args = append(args, refspec)
+	}
+	cmd = utils.Command(ctx, "git", args...)
+	cmd.Dir = r.repoPath
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to fetch bundle: %w", err)
+	}
+	return nil
+}
@@ -1,8 +1,14 @@
 package repository
 
 import (
+	"context"
+	"fmt"
+	"strings"
+
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/matrixhub-ai/hfd/internal/utils"
 	"github.com/matrixhub-ai/hfd/pkg/lfs"
 )
 
@@ -26,56 +32,106 @@ func (r *Repository) ScanLFSPointers() ([]*lfs.Pointer, error) {
 			return nil
 		}
 
-		tree, err := commit.Tree()
+		result = r.scanCommitLFSPointers(commit, seen, result)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ScanLFSPointersAt returns the unique LFS pointer files in the tree of the given revision.
+func (r *Repository) ScanLFSPointersAt(rev string) ([]*lfs.Pointer, error) {
+	hash, err := r.repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, err
+	}
+	commit, err := r.repo.CommitObject(*hash)
+	if err != nil {
+		return nil, err
+	}
+	return r.scanCommitLFSPointers(commit, map[plumbing.Hash]bool{}, []*lfs.Pointer{}), nil
+}
+
+// ScanLFSPointersRange returns the unique LFS pointer files in the trees of every commit reachable from rev
+// but not from any of the exclude revisions, e.g. the commits a push adds to a remote.
+// Exclude revisions missing from the repository are ignored.
+func (r *Repository) ScanLFSPointersRange(ctx context.Context, rev string, exclude []string) ([]*lfs.Pointer, error) {
+	args := []string{"rev-list", "--ignore-missing", rev}
+	if len(exclude) != 0 {
+		args = append(args, "--not")
+		args = append(args, exclude...)
+	}
+	cmd := utils.Command(ctx, "git", args...)
+	cmd.Dir = r.repoPath
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commits of %s: %w", rev, err)
+	}
+
+	seen := map[plumbing.Hash]bool{}
+	result := []*lfs.Pointer{}
+	for line := range strings.SplitSeq(strings.TrimSpace(string(out)), "\n") {
+		if line == "" {
+			continue
+		}
+		commit, err := r.repo.CommitObject(plumbing.NewHash(line))
 		if err != nil {
-			// Skip branches with inaccessible trees, continue with others
-			return nil
+			return nil, err
 		}
+		result = r.scanCommitLFSPointers(commit, seen, result)
+	}
+	return result, nil
+}
 
-		// Walk all files in the tree
-		walker := object.NewTreeWalker(tree, true, seen)
-		defer walker.Close()
+// scanCommitLFSPointers appends the LFS pointers found in the commit's tree to result,
+// skipping blobs and trees already in seen.
+func (r *Repository) scanCommitLFSPointers(commit *object.Commit, seen map[plumbing.Hash]bool, result []*lfs.Pointer) []*lfs.Pointer {
+	tree, err := commit.Tree()
+	if err != nil {
+		// Skip inaccessible trees, continue with others
+		return result
+	}
 
-		for {
-			_, entry, err := walker.Next()
-			if err != nil {
-				break
-			}
+	// Walk all files in the tree
+	walker := object.NewTreeWalker(tree, true, seen)
+	defer walker.Close()
 
-			seen[entry.Hash] = true
+	for {
+		_, entry, err := walker.Next()
+		if err != nil {
+			break
+		}
 
-			if !entry.Mode.IsFile() {
-				continue
-			}
+		seen[entry.Hash] = true
 
-			blob, err := r.repo.BlobObject(entry.Hash)
-			if err != nil {
-				continue
-			}
+		if !entry.Mode.IsFile() {
+			continue
+		}
 
-			if blob.Size > lfs.MaxLFSPointerSize {
-				continue
-			}
+		size, newReader, err := r.blobObject(entry.Hash)
+		if err != nil {
+			continue
+		}
 
-			reader, err := blob.Reader()
-			if err != nil {
-				continue
-			}
+		if size > lfs.MaxLFSPointerSize {
+			continue
+		}
 
-			ptr, err := lfs.DecodePointer(reader)
-			_ = reader.Close()
-			if err != nil || ptr == nil {
-				continue
-			}
+		reader, err := newReader()
+		if err != nil {
+			continue
+		}
 
-			result = append(result, ptr)
+		ptr, err := lfs.DecodePointer(reader)
+		_ = reader.Close()
+		if err != nil || ptr == nil {
+			continue
 		}
 
-		return nil
-	})
-	if err != nil {
-		return nil, err
+		result = append(result, ptr)
 	}
-
-	return result, nil
+	return result
 }
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScanLFSPointersRange(t *testing.T) {
+	ctx := context.Background()
+	repo, err := Init(ctx, filepath.Join(t.TempDir(), "repo.git"), "main")
+	if err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	commit := func(oid string) string {
+		t.Helper()
+		pointer := fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize 4\n", oid)
+		hash, err := repo.CreateCommit(ctx, "main", "update weights", "Test", "test@test.com", []CommitOperation{
+			{Type: CommitOperationAdd, Path: "model.bin", Content: []byte(pointer)},
+		}, "")
+		if err != nil {
+			t.Fatalf("CreateCommit returned error: %v", err)
+		}
+		return hash
+	}
+	a, b := strings.Repeat("a", 64), strings.Repeat("b", 64)
+	first := commit(a)
+	second := commit(b)
+
+	oids := func(rev string, exclude ...string) []string {
+		t.Helper()
+		ptrs, err := repo.ScanLFSPointersRange(ctx, rev, exclude)
+		if err != nil {
+			t.Fatalf("ScanLFSPointersRange returned error: %v", err)
+		}
+		var result []string
+		for _, ptr := range ptrs {
+			result = append(result, ptr.OID())
+		}
+		return result
+	}
+
+	// The object replaced by the tip is still referenced by the history
+	if got := oids(second); len(got) != 2 {
+		t.Errorf("Expected the pointers of both commits, got %v", got)
+	}
+	if got := oids(second, first); len(got) != 1 || got[0] != b {
+		t.Errorf("Expected only the pointer of the new commit, got %v", got)
+	}
+	if got := oids(second, strings.Repeat("0", 40)); len(got) != 2 {
+		t.Errorf("Expected missing exclude revisions to be ignored, got %v", got)
+	}
+}
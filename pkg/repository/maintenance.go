@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/matrixhub-ai/hfd/internal/utils"
+)
+
+// MaintenanceTask is a housekeeping operation optimizing how a repository is stored on disk.
+type MaintenanceTask string
+
+const (
+	// MaintenanceGC packs refs, expires reflogs and prunes unreachable loose objects,
+	// when git considers the repository to need it.
+	MaintenanceGC MaintenanceTask = "gc"
+	// MaintenanceRepack packs all objects into a single pack with a reachability bitmap.
+	MaintenanceRepack MaintenanceTask = "repack"
+	// MaintenanceCommitGraph writes the commit-graph file speeding up history walks.
+	MaintenanceCommitGraph MaintenanceTask = "commit-graph"
+	// MaintenanceMultiPackIndex writes the multi-pack-index covering all packs.
+	MaintenanceMultiPackIndex MaintenanceTask = "multi-pack-index"
+)
+
+// MaintenanceTasks is the list of all maintenance tasks, in the order they are best run.
+var MaintenanceTasks = []MaintenanceTask{
+	MaintenanceGC,
+	MaintenanceRepack,
+	MaintenanceCommitGraph,
+	MaintenanceMultiPackIndex,
+}
+
+// args returns the git arguments running the task.
+func (t MaintenanceTask) args() ([]string, error) {
+	switch t {
+	case MaintenanceGC:
+		return []string{"-c", "gc.autoDetach=false", "gc", "--auto", "--quiet"}, nil
+	case MaintenanceRepack:
+		return []string{"repack", "-a", "-d", "-b", "-q"}, nil
+	case MaintenanceCommitGraph:
+		return []string{"commit-graph", "write", "--reachable"}, nil
+	case MaintenanceMultiPackIndex:
+		return []string{"multi-pack-index", "write"}, nil
+	default:
+		return nil, fmt.Errorf("unknown maintenance task %q", t)
+	}
+}
+
+// Valid reports whether t is a known maintenance task.
+func (t MaintenanceTask) Valid() bool {
+	_, err := t.args()
+	return err == nil
+}
+
+// Maintain runs the given maintenance tasks on the repository, in order.
+// Packs are rewritten, so the repository is dropped from the cache of opened repositories
+// and the next Open sees the new packs.
+func (r *Repository) Maintain(ctx context.Context, tasks ...MaintenanceTask) error {
+	defer lruCache.Remove(r.repoPath)
+
+	for _, task := range tasks {
+		args, err := task.args()
+		if err != nil {
+			return err
+		}
+		if task == MaintenanceRepack && r.PartialCloneFilter() != "" {
+			// Bitmaps cannot be written for a repository missing some of its objects.
+			args = []string{"repack", "-a", "-d", "-q"}
+		}
+		cmd := utils.Command(ctx, "git", args...)
+		cmd.Dir = r.repoPath
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to run %s: %w", task, err)
+		}
+	}
+	return nil
+}
@@ -1,13 +1,61 @@
 package repository
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"os/exec"
 	"strings"
 
 	"github.com/matrixhub-ai/hfd/internal/utils"
 )
 
+// ErrRemoteUnreachable is returned when a remote repository cannot be reached because of
+// a network failure (DNS, connection, TLS) or the remote answering with a server error.
+// It is not returned when the remote is reachable but the repository does not exist.
+var ErrRemoteUnreachable = errors.New("remote unreachable")
+
+// unreachableMessages are lowercase fragments of git/curl error output that indicate the
+// remote could not be reached, as opposed to the remote rejecting the request.
+var unreachableMessages = []string{
+	"could not resolve host",
+	"could not resolve hostname",
+	"temporary failure in name resolution",
+	"failed to connect",
+	"couldn't connect to server",
+	"connection refused",
+	"connection reset",
+	"connection timed out",
+	"operation timed out",
+	"network is unreachable",
+	"no route to host",
+	"empty reply from server",
+	"ssl_connect",
+	"gnutls_handshake",
+	"the requested url returned error: 5",
+}
+
+// runRemote runs a git command talking to a remote and returns its stdout.
+// Failures caused by an unreachable remote are wrapped with ErrRemoteUnreachable.
+func runRemote(cmd *exec.Cmd) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.ToLower(stderr.String())
+		for _, m := range unreachableMessages {
+			if strings.Contains(msg, m) {
+				return out, fmt.Errorf("%w: %w", ErrRemoteUnreachable, err)
+			}
+		}
+		return out, err
+	}
+	return out, nil
+}
+
 // MirrorSourceFunc defines a function type for determining the source URL of a repository mirror.
 // It receives the repository name and returns the source URL, a boolean indicating whether
 // the mirror should be enabled for this repository, and an error if any occurs during the process.
@@ -29,12 +77,46 @@ func InitMirror(ctx context.Context, repoPath string, sourceURL string) (*Reposi
 		return nil, fmt.Errorf("failed to get HEAD from source repository: %w", err)
 	}
 
-	return Init(ctx, repoPath, defaultBranch)
+	repo, err := Init(ctx, repoPath, defaultBranch)
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.MarkMirror(ctx, sourceURL); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// MarkMirror records in the repository config that it mirrors sourceURL,
+// the way git clone --mirror configures its origin remote.
+func (r *Repository) MarkMirror(ctx context.Context, sourceURL string) error {
+	configs := [][2]string{
+		{"remote." + promisorRemote + ".url", sourceURL},
+		{"remote." + promisorRemote + ".mirror", "true"},
+	}
+	for _, kv := range configs {
+		cmd := utils.Command(ctx, "git", "config", kv[0], kv[1])
+		cmd.Dir = r.repoPath
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to set %s: %w", kv[0], err)
+		}
+	}
+	return nil
+}
+
+// IsMirror reports whether the repository was created as a mirror of another repository,
+// as opposed to a local repository whose content only exists here.
+func (r *Repository) IsMirror() bool {
+	cfg, err := r.repo.Config()
+	if err != nil {
+		return false
+	}
+	return cfg.Raw.Section("remote").Subsection(promisorRemote).Option("mirror") == "true"
 }
 
 func getDefaultBranch(ctx context.Context, sourceURL string) (string, error) {
 	cmd := utils.Command(ctx, "git", "ls-remote", "--symref", sourceURL)
-	out, err := cmd.Output()
+	out, err := runRemote(cmd)
 	if err != nil {
 		return "", err
 	}
@@ -60,7 +142,7 @@ func getDefaultBranch(ctx context.Context, sourceURL string) (string, error) {
 func (r *Repository) RemoteRefs(ctx context.Context, sourceURL string) (map[string]string, error) {
 	cmd := utils.Command(ctx, "git", "ls-remote", "--refs", sourceURL)
 	cmd.Dir = r.repoPath
-	out, err := cmd.Output()
+	out, err := runRemote(cmd)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list remote refs: %w", err)
 	}
@@ -88,12 +170,26 @@ func (r *Repository) SyncMirrorRefs(ctx context.Context, sourceURL string, refs
 		return nil
 	}
 
+	remote := sourceURL
+	var filterArgs []string
+	if filter := r.PartialCloneFilter(); filter != "" {
+		// Fetch through the promisor remote so the received packs are marked as promisor packs.
+		cmd := utils.Command(ctx, "git", "config", "remote."+promisorRemote+".url", sourceURL)
+		cmd.Dir = r.repoPath
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to set promisor remote url: %w", err)
+		}
+		remote = promisorRemote
+		filterArgs = []string{"--filter=" + filter}
+	}
+
 	args := []string{
 		"fetch",
-		sourceURL,
+		remote,
 		"--no-tags",
 		"--progress",
 	}
+	args = append(args, filterArgs...)
 
 	// Add explicit refspecs for each desired ref.
 	for _, ref := range refs {
@@ -102,7 +198,7 @@ func (r *Repository) SyncMirrorRefs(ctx context.Context, sourceURL string, refs
 
 	cmd := utils.Command(ctx, "git", args...)
 	cmd.Dir = r.repoPath
-	if err := cmd.Run(); err != nil {
+	if _, err := runRemote(cmd); err != nil {
 		return fmt.Errorf("failed to fetch repository refs: %w", err)
 	}
 
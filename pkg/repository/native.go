@@ -0,0 +1,219 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/sideband"
+)
+
+// NativeSupported reports whether a request of the service can be served in-process. Protocol v2 requests,
+// and the fetches of a partial clone whose missing objects git fetches lazily, need the git binaries.
+func (r *Repository) NativeSupported(service string, extraEnv []string) bool {
+	if service != GitUploadPack {
+		return true
+	}
+	if r.PartialCloneFilter() != "" {
+		return false
+	}
+	for _, env := range extraEnv {
+		if value, ok := strings.CutPrefix(env, "GIT_PROTOCOL="); ok && slices.Contains(strings.Split(value, ":"), "version=2") {
+			return false
+		}
+	}
+	return true
+}
+
+// NativeStateless is the in-process counterpart of Stateless. It serves git-upload-pack and
+// git-receive-pack with go-git instead of spawning the git binaries.
+// Shallow and filtered fetches are passed on to git-upload-pack, run with extraEnv.
+// Use NativeSupported to tell whether the request can be served in-process at all.
+func (r *Repository) NativeStateless(ctx context.Context, output io.Writer, input io.Reader, service string, advertise bool, extraEnv ...string) error {
+	if advertise {
+		if _, err := output.Write(packetLine(fmt.Sprintf("# service=%s\n", service))); err != nil {
+			return err
+		}
+		if _, err := output.Write([]byte("0000")); err != nil {
+			return err
+		}
+		return r.advertiseRefs(output, service)
+	}
+	if service == GitUploadPack {
+		request, needGit, err := readUploadRequest(input)
+		if err != nil {
+			return err
+		}
+		input = io.MultiReader(bytes.NewReader(request), input)
+		if needGit {
+			return r.Stateless(ctx, output, input, service, false, extraEnv...)
+		}
+	}
+	return r.serveNative(ctx, output, input, service, true)
+}
+
+// NativeServe serves a full-duplex git session in-process, as the git-upload-pack and
+// git-receive-pack binaries do over SSH: the refs are advertised, then the request is served.
+// Shallow and filtered fetches are passed on to git-upload-pack, run with extraEnv.
+// Use NativeSupported to tell whether the session can be served in-process at all.
+func (r *Repository) NativeServe(ctx context.Context, output io.Writer, input io.Reader, service string, extraEnv ...string) error {
+	if err := r.advertiseRefs(output, service); err != nil {
+		return err
+	}
+	if service == GitUploadPack {
+		request, needGit, err := readUploadRequest(input)
+		if err != nil {
+			return err
+		}
+		input = io.MultiReader(bytes.NewReader(request), input)
+		if needGit {
+			return r.ServeAdvertised(ctx, output, input, service, extraEnv...)
+		}
+	}
+	return r.serveNative(ctx, output, input, service, false)
+}
+
+// readUploadRequest reads the first section of an upload-pack request, up to its flush-pkt, and returns it as read.
+// It reports whether the request asks for a shallow or filtered fetch, which are left to git-upload-pack.
+func readUploadRequest(input io.Reader) ([]byte, bool, error) {
+	var buf bytes.Buffer
+	scanner := pktline.NewScanner(io.TeeReader(input, &buf))
+	needGit := false
+	for {
+		line, err := scanLine(scanner)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return buf.Bytes(), needGit, nil
+			}
+			return nil, false, err
+		}
+		if line == "" {
+			return buf.Bytes(), needGit, nil
+		}
+		if strings.HasPrefix(line, "shallow ") || strings.HasPrefix(line, "deepen") || strings.HasPrefix(line, "filter ") {
+			needGit = true
+		}
+	}
+}
+
+func (r *Repository) serveNative(ctx context.Context, output io.Writer, input io.Reader, service string, stateless bool) error {
+	switch service {
+	case GitUploadPack:
+		return r.uploadPack(ctx, output, input, stateless)
+	case GitReceivePack:
+		return r.receivePack(ctx, output, input)
+	default:
+		return fmt.Errorf("unsupported service %q", service)
+	}
+}
+
+// noThin asks pushing clients not to send thin packs, whose deltas reference objects outside
+// the pack and cannot be indexed by go-git.
+const noThin capability.Capability = "no-thin"
+
+// advertiseRefs writes the refs advertisement of the service, with the capabilities implemented in-process.
+func (r *Repository) advertiseRefs(w io.Writer, service string) error {
+	ar := packp.NewAdvRefs()
+
+	caps := []capability.Capability{capability.OFSDelta, capability.Sideband64k, capability.Sideband}
+	switch service {
+	case GitUploadPack:
+		// Shallow and filtered fetches are served by git-upload-pack. Any object may be wanted,
+		// as with uploadpack.allowAnySHA1InWant, for partial clones to fetch the objects they left out.
+		caps = append(caps, capability.MultiACKDetailed, capability.NoProgress, capability.IncludeTag,
+			capability.Shallow, capability.DeepenSince, capability.DeepenNot, capability.DeepenRelative, capability.Filter,
+			capability.AllowTipSHA1InWant, capability.AllowReachableSHA1InWant)
+	case GitReceivePack:
+		caps = append(caps, capability.ReportStatus, capability.DeleteRefs, capability.Atomic, capability.Quiet, noThin)
+	default:
+		return fmt.Errorf("unsupported service %q", service)
+	}
+	for _, c := range caps {
+		if err := ar.Capabilities.Add(c); err != nil {
+			return err
+		}
+	}
+	if err := ar.Capabilities.Set(capability.Agent, capability.DefaultAgent()); err != nil {
+		return err
+	}
+
+	refs, err := r.repo.Storer.IterReferences()
+	if err != nil {
+		return err
+	}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference || !strings.HasPrefix(ref.Name().String(), "refs/") {
+			return nil
+		}
+		ar.References[ref.Name().String()] = ref.Hash()
+		if service != GitUploadPack {
+			return nil
+		}
+		if tag, err := r.repo.TagObject(ref.Hash()); err == nil {
+			ar.Peeled[ref.Name().String()] = tag.Target
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if service == GitUploadPack {
+		if head, err := r.repo.Reference(plumbing.HEAD, false); err == nil && head.Type() == plumbing.SymbolicReference {
+			if hash, ok := ar.References[head.Target().String()]; ok {
+				ar.Head = &hash
+				if err := ar.Capabilities.Add(capability.SymRef, plumbing.HEAD.String()+":"+head.Target().String()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return ar.Encode(w)
+}
+
+// sidebandWriter returns a writer multiplexing data on the sideband negotiated by the client, if any.
+func sidebandWriter(w io.Writer, caps *capability.List) (io.Writer, bool) {
+	switch {
+	case caps.Supports(capability.Sideband64k):
+		return sideband.NewMuxer(sideband.Sideband64k, w), true
+	case caps.Supports(capability.Sideband):
+		return sideband.NewMuxer(sideband.Sideband, w), true
+	default:
+		return w, false
+	}
+}
+
+// parseCapabilities parses the space separated capabilities a client sends with its first command.
+func parseCapabilities(s string) *capability.List {
+	caps := capability.NewList()
+	for _, field := range strings.Fields(s) {
+		name, value, ok := strings.Cut(field, "=")
+		if ok {
+			_ = caps.Add(capability.Capability(name), value)
+		} else {
+			_ = caps.Add(capability.Capability(name))
+		}
+	}
+	return caps
+}
+
+// scanLine reads the next pkt-line, returning its payload without the trailing newline.
+// A flush-pkt is returned as an empty line.
+func scanLine(scanner *pktline.Scanner) (string, error) {
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return strings.TrimSuffix(string(scanner.Bytes()), "\n"), nil
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/matrixhub-ai/hfd/internal/utils"
+)
+
+// promisorRemote is the name of the remote a partial clone fetches its missing objects from.
+const promisorRemote = "origin"
+
+// EnablePartialClone turns the repository into a partial clone of sourceURL.
+// Mirror syncs then only fetch the objects matching filter (e.g. "blob:none" or "blob:limit=1m"),
+// and the objects left out are fetched from sourceURL when they are first needed.
+func (r *Repository) EnablePartialClone(ctx context.Context, sourceURL string, filter string) error {
+	configs := [][2]string{
+		{"core.repositoryformatversion", "1"},
+		{"remote." + promisorRemote + ".url", sourceURL},
+		{"remote." + promisorRemote + ".promisor", "true"},
+		{"remote." + promisorRemote + ".partialclonefilter", filter},
+		{"extensions.partialClone", promisorRemote},
+	}
+	for _, kv := range configs {
+		cmd := utils.Command(ctx, "git", "config", kv[0], kv[1])
+		cmd.Dir = r.repoPath
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to set %s: %w", kv[0], err)
+		}
+	}
+	return nil
+}
+
+// PartialCloneFilter returns the object filter of a repository created as a partial clone,
+// or an empty string for a repository holding all its objects.
+func (r *Repository) PartialCloneFilter() string {
+	cfg, err := r.repo.Config()
+	if err != nil {
+		return ""
+	}
+	if cfg.Raw.Section("extensions").Option("partialClone") != promisorRemote {
+		return ""
+	}
+	return cfg.Raw.Section("remote").Subsection(promisorRemote).Option("partialclonefilter")
+}
+
+// blobObject returns the size and a reader of the blob with the given hash.
+// Blobs left out of a partial clone are fetched from the promisor remote through git,
+// as the packs git adds are not visible to the already opened repository.
+func (r *Repository) blobObject(hash plumbing.Hash) (int64, func() (io.ReadCloser, error), error) {
+	blob, err := r.repo.BlobObject(hash)
+	if err == nil {
+		return blob.Size, blob.Reader, nil
+	}
+	if !errors.Is(err, plumbing.ErrObjectNotFound) || r.PartialCloneFilter() == "" {
+		return 0, nil, err
+	}
+
+	// cat-file fetches the missing blob from the promisor remote.
+	cmd := utils.Command(context.Background(), "git", "cat-file", "-s", hash.String())
+	cmd.Dir = r.repoPath
+	out, err := runRemote(cmd)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to fetch missing blob %s: %w", hash, err)
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to parse size of blob %s: %w", hash, err)
+	}
+
+	newReader := func() (io.ReadCloser, error) {
+		cmd := utils.Command(context.Background(), "git", "cat-file", "blob", hash.String())
+		cmd.Dir = r.repoPath
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, err
+		}
+		return &cmdReader{ReadCloser: stdout, cmd: cmd}, nil
+	}
+	return size, newReader, nil
+}
+
+// cmdReader reads the stdout of a command, waiting for the command when closed.
+type cmdReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (c *cmdReader) Close() error {
+	_ = c.ReadCloser.Close()
+	// The command fails with a broken pipe when closed before the blob is fully read.
+	_ = c.cmd.Wait()
+	return nil
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestPartialCloneMirror(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+
+	upstream := setupMirrorSyncUpstream(t, root)
+	runGit(t, upstream, "config", "uploadpack.allowFilter", "true")
+	runGit(t, upstream, "config", "uploadpack.allowAnySHA1InWant", "true")
+	sourceURL := "file://" + upstream
+
+	mirrorPath := filepath.Join(root, "mirror.git")
+	repo, err := InitMirror(ctx, mirrorPath, sourceURL)
+	if err != nil {
+		t.Fatalf("init mirror: %v", err)
+	}
+	if err := repo.EnablePartialClone(ctx, sourceURL, "blob:none"); err != nil {
+		t.Fatalf("enable partial clone: %v", err)
+	}
+	if err := repo.SyncMirrorRefs(ctx, sourceURL, []string{"refs/heads/main", "refs/heads/feature"}); err != nil {
+		t.Fatalf("sync mirror refs: %v", err)
+	}
+
+	repo, err = Open(mirrorPath)
+	if err != nil {
+		t.Fatalf("open mirror: %v", err)
+	}
+	if got := repo.PartialCloneFilter(); got != "blob:none" {
+		t.Fatalf("PartialCloneFilter() = %q, want %q", got, "blob:none")
+	}
+
+	check := exec.CommandContext(ctx, "git", "cat-file", "-e", "refs/heads/main:file.txt")
+	check.Dir = mirrorPath
+	check.Env = append(os.Environ(), "GIT_NO_LAZY_FETCH=1")
+	if err := check.Run(); err == nil {
+		t.Fatal("expected blob to be left out of the mirror")
+	}
+
+	blob, err := repo.Blob("refs/heads/main", "file.txt")
+	if err != nil {
+		t.Fatalf("blob: %v", err)
+	}
+	if blob.Size() != int64(len("main\n")) {
+		t.Fatalf("blob size = %d, want %d", blob.Size(), len("main\n"))
+	}
+	reader, err := blob.NewReader()
+	if err != nil {
+		t.Fatalf("blob reader: %v", err)
+	}
+	data, err := io.ReadAll(reader)
+	_ = reader.Close()
+	if err != nil {
+		t.Fatalf("read blob: %v", err)
+	}
+	if string(data) != "main\n" {
+		t.Fatalf("blob content = %q, want %q", data, "main\n")
+	}
+
+	// A full clone from the mirror fetches the blobs it is missing from upstream,
+	// and a filtered clone is accepted.
+	for _, args := range [][]string{
+		{"clone", "--bare", "file://" + mirrorPath, filepath.Join(root, "full.git")},
+		{"clone", "--bare", "--filter=blob:none", "file://" + mirrorPath, filepath.Join(root, "filtered.git")},
+	} {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Env = append(os.Environ(), ServiceEnv(GitUploadPack)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	runGit(t, filepath.Join(root, "full.git"), "cat-file", "-e", "refs/heads/feature:file.txt")
+}
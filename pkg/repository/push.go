@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/matrixhub-ai/hfd/internal/utils"
+)
+
+// PushRefs pushes the given refs to remoteURL, overwriting the remote refs.
+// Refs that no longer exist locally are deleted from the remote.
+func (r *Repository) PushRefs(ctx context.Context, remoteURL string, refs []string) error {
+	if len(refs) == 0 {
+		return nil
+	}
+
+	localRefs, err := r.Refs()
+	if err != nil {
+		return err
+	}
+
+	args := []string{
+		"push",
+		"--porcelain",
+		remoteURL,
+	}
+	for _, ref := range refs {
+		if _, ok := localRefs[ref]; ok {
+			args = append(args, "+"+ref+":"+ref)
+		} else {
+			args = append(args, ":"+ref)
+		}
+	}
+
+	cmd := utils.Command(ctx, "git", args...)
+	cmd.Dir = r.repoPath
+	out, err := runRemote(cmd)
+	if err != nil {
+		// With --porcelain, rejected refs are reported on stdout as lines starting with "!".
+		var rejected []string
+		for line := range strings.SplitSeq(string(out), "\n") {
+			if strings.HasPrefix(line, "!") {
+				rejected = append(rejected, strings.TrimSpace(strings.TrimPrefix(line, "!")))
+			}
+		}
+		if len(rejected) != 0 {
+			return fmt.Errorf("failed to push refs: %w: %s", err, strings.Join(rejected, "; "))
+		}
+		return fmt.Errorf("failed to push refs: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ObjectQuarantine is a temporary object directory of the repository, which the objects of a commit
+// are written to until the commit is made, as git receive-pack does with the objects of a push.
+// The objects of a commit that is rejected or fails never reach the repository.
+type ObjectQuarantine struct {
+	repoPath string
+	dir      string
+}
+
+// NewObjectQuarantine creates a quarantine for new objects of the repository. It must be closed.
+func (r *Repository) NewObjectQuarantine() (*ObjectQuarantine, error) {
+	// Within the object directory, the objects are moved in without copying them
+	dir, err := os.MkdirTemp(filepath.Join(r.repoPath, "objects"), "incoming-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create object quarantine: %w", err)
+	}
+	return &ObjectQuarantine{repoPath: r.repoPath, dir: dir}, nil
+}
+
+// WriteBlob streams size bytes of content from rd into a loose blob object of the quarantine,
+// as Repository.WriteBlob does, and returns its hash.
+func (q *ObjectQuarantine) WriteBlob(rd io.Reader, size int64) (string, error) {
+	return writeLooseBlob(q.dir, rd, size)
+}
+
+// env returns the environment of the git commands writing their objects into the quarantine.
+func (q *ObjectQuarantine) env() []string {
+	return []string{
+		"GIT_OBJECT_DIRECTORY=" + q.dir,
+		"GIT_ALTERNATE_OBJECT_DIRECTORIES=" + filepath.Join(q.repoPath, "objects"),
+	}
+}
+
+// migrate moves the objects of the quarantine into the repository.
+func (q *ObjectQuarantine) migrate() error {
+	objectsDir := filepath.Join(q.repoPath, "objects")
+	return filepath.WalkDir(q.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(q.dir, path)
+		if err != nil {
+			return err
+		}
+		if filepath.Dir(rel) == "." {
+			// Temporary files of objects being written
+			return nil
+		}
+		target := filepath.Join(objectsDir, rel)
+		if _, err := os.Stat(target); err == nil {
+			return nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return fmt.Errorf("failed to create object directory: %w", err)
+		}
+		if err := os.Rename(path, target); err != nil {
+			return fmt.Errorf("failed to move object %s: %w", rel, err)
+		}
+		return nil
+	})
+}
+
+// Close removes the quarantine, with the objects not moved into the repository.
+func (q *ObjectQuarantine) Close() error {
+	return os.RemoveAll(q.dir)
+}
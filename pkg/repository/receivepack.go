@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+)
+
+var errAtomicPushFailed = errors.New("atomic push failed")
+
+// receiveCommand is a ref update requested by a push.
+type receiveCommand struct {
+	old, new plumbing.Hash
+	name     plumbing.ReferenceName
+}
+
+// receivePack serves a receive-pack request: it stores the pushed pack, then updates the
+// refs whose old value still matches, and reports the status of each update to the client.
+func (r *Repository) receivePack(ctx context.Context, w io.Writer, in io.Reader) error {
+	scanner := pktline.NewScanner(in)
+
+	var commands []receiveCommand
+	caps := capability.NewList()
+	for {
+		line, err := scanLine(scanner)
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(commands) == 0 {
+				// The client has nothing to push.
+				return nil
+			}
+			return err
+		}
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "shallow ") {
+			continue
+		}
+
+		line, rawCaps, ok := strings.Cut(line, "\x00")
+		if ok && len(commands) == 0 {
+			caps = parseCapabilities(rawCaps)
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return fmt.Errorf("malformed receive-pack command %q", line)
+		}
+		commands = append(commands, receiveCommand{
+			old:  plumbing.NewHash(fields[0]),
+			new:  plumbing.NewHash(fields[1]),
+			name: plumbing.ReferenceName(fields[2]),
+		})
+	}
+	if len(commands) == 0 {
+		return nil
+	}
+
+	var unpackErr error
+	for _, cmd := range commands {
+		if !cmd.new.IsZero() {
+			// The pack follows the commands, unless the push only deletes refs.
+			unpackErr = packfile.UpdateObjectStorage(r.repo.Storer, in)
+			break
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	statuses := make([]*packp.CommandStatus, 0, len(commands))
+	if unpackErr != nil {
+		for _, cmd := range commands {
+			statuses = append(statuses, &packp.CommandStatus{ReferenceName: cmd.name, Status: "unpacker error"})
+		}
+	} else if caps.Supports(capability.Atomic) {
+		statuses = r.updateRefsAtomic(commands)
+	} else {
+		for _, cmd := range commands {
+			statuses = append(statuses, r.updateRef(cmd))
+		}
+	}
+
+	if !caps.Supports(capability.ReportStatus) {
+		if unpackErr != nil {
+			return fmt.Errorf("failed to unpack objects: %w", unpackErr)
+		}
+		return nil
+	}
+
+	report := packp.NewReportStatus()
+	report.UnpackStatus = "ok"
+	if unpackErr != nil {
+		report.UnpackStatus = unpackErr.Error()
+	}
+	report.CommandStatuses = statuses
+
+	var buf bytes.Buffer
+	if err := report.Encode(&buf); err != nil {
+		return err
+	}
+	out, muxed := sidebandWriter(w, caps)
+	if _, err := out.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if muxed {
+		return pktline.NewEncoder(w).Flush()
+	}
+	return nil
+}
+
+// checkCommand validates a ref update against the current state of the repository.
+func (r *Repository) checkCommand(cmd receiveCommand) error {
+	if !strings.HasPrefix(cmd.name.String(), "refs/") || validateRefName(strings.TrimPrefix(cmd.name.String(), "refs/")) != nil {
+		return fmt.Errorf("funny refname")
+	}
+	if !cmd.new.IsZero() && !r.isConnected(cmd.new) {
+		return fmt.Errorf("missing necessary objects")
+	}
+
+	current, err := r.repo.Storer.Reference(cmd.name)
+	switch {
+	case errors.Is(err, plumbing.ErrReferenceNotFound):
+		if !cmd.old.IsZero() {
+			return fmt.Errorf("stale info")
+		}
+	case err != nil:
+		return err
+	case current.Hash() != cmd.old:
+		return fmt.Errorf("stale info")
+	}
+	return nil
+}
+
+// isConnected reports whether every object reachable from hash is in the repository, as git checks
+// before updating a ref to a pushed commit. The objects reachable from the existing refs are not walked.
+func (r *Repository) isConnected(hash plumbing.Hash) bool {
+	refs, err := r.repo.Storer.IterReferences()
+	if err != nil {
+		return false
+	}
+	var tips []plumbing.Hash
+	_ = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			tips = append(tips, ref.Hash())
+		}
+		return nil
+	})
+
+	// Walking the commits and trees fails on missing ones, while blobs are only listed
+	objects, err := objectsBetween(r.repo.Storer, []plumbing.Hash{hash}, tips)
+	if err != nil {
+		return false
+	}
+	for _, h := range objects {
+		if err := r.repo.Storer.HasEncodedObject(h); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// applyCommand applies a validated ref update.
+func (r *Repository) applyCommand(cmd receiveCommand) error {
+	if cmd.new.IsZero() {
+		return r.repo.Storer.RemoveReference(cmd.name)
+	}
+	ref := plumbing.NewHashReference(cmd.name, cmd.new)
+	if cmd.old.IsZero() {
+		return r.repo.Storer.SetReference(ref)
+	}
+	return r.repo.Storer.CheckAndSetReference(ref, plumbing.NewHashReference(cmd.name, cmd.old))
+}
+
+func (r *Repository) updateRef(cmd receiveCommand) *packp.CommandStatus {
+	err := r.checkCommand(cmd)
+	if err == nil {
+		err = r.applyCommand(cmd)
+	}
+	return commandStatus(cmd, err)
+}
+
+// updateRefsAtomic applies all the ref updates, or none of them if any is rejected.
+func (r *Repository) updateRefsAtomic(commands []receiveCommand) []*packp.CommandStatus {
+	statuses := make([]*packp.CommandStatus, 0, len(commands))
+	failed := false
+	for _, cmd := range commands {
+		err := r.checkCommand(cmd)
+		failed = failed || err != nil
+		statuses = append(statuses, commandStatus(cmd, err))
+	}
+	if failed {
+		for _, status := range statuses {
+			if status.Status == "ok" {
+				status.Status = errAtomicPushFailed.Error()
+			}
+		}
+		return statuses
+	}
+
+	for i, cmd := range commands {
+		statuses[i] = commandStatus(cmd, r.applyCommand(cmd))
+	}
+	return statuses
+}
+
+func commandStatus(cmd receiveCommand, err error) *packp.CommandStatus {
+	status := &packp.CommandStatus{ReferenceName: cmd.name, Status: "ok"}
+	if err != nil {
+		status.Status = err.Error()
+	}
+	return status
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestIsConnected(t *testing.T) {
+	ctx := context.Background()
+	repo, err := Init(ctx, filepath.Join(t.TempDir(), "repo.git"), "main")
+	if err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+	head, err := repo.CreateCommit(ctx, "main", "initial", "Test", "test@test.com", []CommitOperation{
+		{Type: CommitOperationAdd, Path: "README.md", Content: []byte("hello")},
+	}, "")
+	if err != nil {
+		t.Fatalf("CreateCommit returned error: %v", err)
+	}
+	if !repo.isConnected(plumbing.NewHash(head)) {
+		t.Errorf("Expected the commit of a ref to be connected")
+	}
+
+	// A pushed commit whose tree never arrived
+	sig := object.Signature{Name: "Test", Email: "test@test.com", When: time.Now()}
+	commit := &object.Commit{
+		Author:       sig,
+		Committer:    sig,
+		Message:      "dangling",
+		TreeHash:     plumbing.NewHash(strings.Repeat("1", 40)),
+		ParentHashes: []plumbing.Hash{plumbing.NewHash(head)},
+	}
+	obj := repo.repo.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		t.Fatalf("Failed to encode commit: %v", err)
+	}
+	hash, err := repo.repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatalf("Failed to store commit: %v", err)
+	}
+	if repo.isConnected(hash) {
+		t.Errorf("Expected a commit missing its tree not to be connected")
+	}
+}
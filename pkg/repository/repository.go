@@ -116,11 +116,23 @@ func (r *Repository) RepoPath() string {
 }
 
 // SplitRevisionAndPath splits a refpath into a revision (branch or tag) and a file path.
+// A revision may also be a full ref name of three segments, such as refs/convert/parquet.
 func (r *Repository) SplitRevisionAndPath(refpath string) (rev string, path string, err error) {
 	if refpath == "" {
 		return r.DefaultBranch(), "", nil
 	}
 
+	if strings.HasPrefix(refpath, "refs/") {
+		parts := strings.SplitN(refpath, "/", 4)
+		if len(parts) >= 3 {
+			rev = strings.Join(parts[:3], "/")
+			if len(parts) == 4 {
+				path = parts[3]
+			}
+			return rev, path, nil
+		}
+	}
+
 	branches, err := r.Branches()
 	if err != nil {
 		return "", "", err
@@ -250,6 +262,36 @@ func (r *Repository) Tags() ([]string, error) {
 	return tags, nil
 }
 
+// ConvertRefPrefix is the prefix of the refs holding conversions of the files of the default branch.
+const ConvertRefPrefix = "refs/convert/"
+
+// Converts returns the names of the conversion refs, such as parquet for refs/convert/parquet.
+func (r *Repository) Converts() ([]string, error) {
+	refsIter, err := r.repo.References()
+	if err != nil {
+		return nil, err
+	}
+
+	var converts []string
+	err = refsIter.ForEach(func(ref *plumbing.Reference) error {
+		if name, ok := strings.CutPrefix(ref.Name().String(), ConvertRefPrefix); ok {
+			converts = append(converts, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(converts)
+	return converts, nil
+}
+
+// DeleteConvert deletes a conversion ref, such as refs/convert/parquet for parquet.
+func (r *Repository) DeleteConvert(name string) error {
+	return r.repo.Storer.RemoveReference(plumbing.ReferenceName(ConvertRefPrefix + name))
+}
+
 // ResolveRevision resolves a revision string (branch name, tag, or commit SHA) to a commit hash.
 func (r *Repository) ResolveRevision(rev string) (string, error) {
 	if rev == "" {
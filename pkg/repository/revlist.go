@@ -0,0 +1,238 @@
+package repository
+
+import (
+	"container/heap"
+	"errors"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// objectsBetween returns the objects reachable from wants that are not reachable from haves, as
+// git rev-list --objects wants --not haves does. The history is walked newest commit first and the
+// walk stops once every queued commit is reachable from haves, so the history shared with haves is
+// not walked; only the trees of the commits at its edge are excluded from the result.
+func objectsBetween(s storer.EncodedObjectStorer, wants, haves []plumbing.Hash) ([]plumbing.Hash, error) {
+	w := &revWalk{
+		s:             s,
+		uninteresting: make(map[plumbing.Hash]bool),
+		queued:        make(map[plumbing.Hash]bool),
+		excluded:      make(map[plumbing.Hash]bool),
+	}
+	for _, hash := range haves {
+		if err := w.add(hash, true); err != nil && !errors.Is(err, plumbing.ErrObjectNotFound) {
+			return nil, err
+		}
+	}
+	for _, hash := range wants {
+		if err := w.add(hash, false); err != nil {
+			return nil, err
+		}
+	}
+
+	commits, err := w.walk()
+	if err != nil {
+		return nil, err
+	}
+
+	// The trees of the commits at the edge are the ones the new commits most likely share objects with.
+	for _, commit := range commits {
+		for _, parent := range commit.ParentHashes {
+			if !w.uninteresting[parent] {
+				continue
+			}
+			c, err := object.GetCommit(s, parent)
+			if err != nil {
+				continue
+			}
+			if err := w.tree(c.TreeHash, w.exclude, true); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, commit := range commits {
+		w.include(commit.Hash)
+		if err := w.tree(commit.TreeHash, w.include, false); err != nil {
+			return nil, err
+		}
+	}
+	for _, hash := range w.others {
+		if err := w.tree(hash, w.include, false); err != nil {
+			return nil, err
+		}
+	}
+	return w.result, nil
+}
+
+// revWalk is the state of objectsBetween.
+type revWalk struct {
+	s             storer.EncodedObjectStorer
+	queue         commitQueue
+	uninteresting map[plumbing.Hash]bool
+	queued        map[plumbing.Hash]bool
+	excluded      map[plumbing.Hash]bool
+	// others are the wanted trees and blobs.
+	others []plumbing.Hash
+	result []plumbing.Hash
+}
+
+// add queues the commit hash points to, peeling annotated tags.
+func (w *revWalk) add(hash plumbing.Hash, uninteresting bool) error {
+	for {
+		obj, err := w.s.EncodedObject(plumbing.AnyObject, hash)
+		if err != nil {
+			return err
+		}
+		switch obj.Type() {
+		case plumbing.TagObject:
+			tag, err := object.DecodeTag(w.s, obj)
+			if err != nil {
+				return err
+			}
+			if uninteresting {
+				w.exclude(hash)
+			} else {
+				w.include(hash)
+			}
+			hash = tag.Target
+		case plumbing.CommitObject:
+			commit, err := object.DecodeCommit(w.s, obj)
+			if err != nil {
+				return err
+			}
+			if uninteresting {
+				w.uninteresting[hash] = true
+			}
+			w.push(commit)
+			return nil
+		default:
+			if uninteresting {
+				w.exclude(hash)
+			} else {
+				w.others = append(w.others, hash)
+			}
+			return nil
+		}
+	}
+}
+
+func (w *revWalk) push(commit *object.Commit) {
+	if w.queued[commit.Hash] {
+		return
+	}
+	w.queued[commit.Hash] = true
+	heap.Push(&w.queue, commit)
+}
+
+// walk returns the commits reachable from the wanted commits and not from the uninteresting ones.
+func (w *revWalk) walk() ([]*object.Commit, error) {
+	var commits []*object.Commit
+	for w.queue.Len() > 0 && !w.everybodyUninteresting() {
+		commit := heap.Pop(&w.queue).(*object.Commit)
+		uninteresting := w.uninteresting[commit.Hash]
+		if !uninteresting {
+			commits = append(commits, commit)
+		}
+		for _, parent := range commit.ParentHashes {
+			if uninteresting {
+				w.uninteresting[parent] = true
+			}
+			if w.queued[parent] {
+				continue
+			}
+			c, err := object.GetCommit(w.s, parent)
+			if err != nil {
+				if uninteresting && errors.Is(err, plumbing.ErrObjectNotFound) {
+					continue
+				}
+				return nil, err
+			}
+			w.push(c)
+		}
+	}
+
+	// A commit can be found reachable from haves after it was walked, when commit dates are skewed.
+	n := 0
+	for _, commit := range commits {
+		if !w.uninteresting[commit.Hash] {
+			commits[n] = commit
+			n++
+		}
+	}
+	return commits[:n], nil
+}
+
+func (w *revWalk) everybodyUninteresting() bool {
+	for _, commit := range w.queue {
+		if !w.uninteresting[commit.Hash] {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *revWalk) include(hash plumbing.Hash) {
+	if w.excluded[hash] {
+		return
+	}
+	w.excluded[hash] = true
+	w.result = append(w.result, hash)
+}
+
+func (w *revWalk) exclude(hash plumbing.Hash) {
+	w.excluded[hash] = true
+}
+
+// tree visits hash and, if it is a tree, the entries it does not share with the excluded trees.
+// Missing trees fail the walk, unless allowMissing; blobs are only listed.
+func (w *revWalk) tree(hash plumbing.Hash, visit func(plumbing.Hash), allowMissing bool) error {
+	if w.excluded[hash] {
+		return nil
+	}
+	obj, err := w.s.EncodedObject(plumbing.AnyObject, hash)
+	if err != nil {
+		if allowMissing && errors.Is(err, plumbing.ErrObjectNotFound) {
+			return nil
+		}
+		return err
+	}
+	visit(hash)
+	if obj.Type() != plumbing.TreeObject {
+		return nil
+	}
+	tree, err := object.DecodeTree(w.s, obj)
+	if err != nil {
+		return err
+	}
+	for _, entry := range tree.Entries {
+		switch {
+		case entry.Mode == filemode.Submodule, w.excluded[entry.Hash]:
+		case entry.Mode == filemode.Dir:
+			if err := w.tree(entry.Hash, visit, allowMissing); err != nil {
+				return err
+			}
+		default:
+			visit(entry.Hash)
+		}
+	}
+	return nil
+}
+
+// commitQueue is a priority queue of commits, newest committer date first.
+type commitQueue []*object.Commit
+
+func (q commitQueue) Len() int { return len(q) }
+func (q commitQueue) Less(i, j int) bool {
+	return q[i].Committer.When.After(q[j].Committer.When)
+}
+func (q commitQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *commitQueue) Push(x any)   { *q = append(*q, x.(*object.Commit)) }
+func (q *commitQueue) Pop() any {
+	old := *q
+	commit := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return commit
+}
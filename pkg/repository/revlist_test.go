@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// walkedStorage fails reading the objects the walk must not reach.
+type walkedStorage struct {
+	*memory.Storage
+	forbidden map[plumbing.Hash]bool
+}
+
+func (s *walkedStorage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	if s.forbidden[h] {
+		return nil, fmt.Errorf("walked past the known tips to %s", h)
+	}
+	return s.Storage.EncodedObject(t, h)
+}
+
+func TestObjectsBetween(t *testing.T) {
+	s := &walkedStorage{Storage: memory.NewStorage(), forbidden: map[plumbing.Hash]bool{}}
+	store := func(o interface {
+		Encode(plumbing.EncodedObject) error
+	}) plumbing.Hash {
+		obj := s.NewEncodedObject()
+		if err := o.Encode(obj); err != nil {
+			t.Fatalf("Failed to encode object: %v", err)
+		}
+		hash, err := s.SetEncodedObject(obj)
+		if err != nil {
+			t.Fatalf("Failed to store object: %v", err)
+		}
+		return hash
+	}
+	blob := func(content string) plumbing.Hash {
+		obj := s.NewEncodedObject()
+		obj.SetType(plumbing.BlobObject)
+		w, _ := obj.Writer()
+		_, _ = w.Write([]byte(content))
+		_ = w.Close()
+		hash, err := s.SetEncodedObject(obj)
+		if err != nil {
+			t.Fatalf("Failed to store blob: %v", err)
+		}
+		return hash
+	}
+	when := time.Now()
+	commit := func(content string, parents ...plumbing.Hash) (plumbing.Hash, plumbing.Hash) {
+		tree := store(&object.Tree{Entries: []object.TreeEntry{
+			{Name: "README.md", Mode: filemode.Regular, Hash: blob("readme")},
+			{Name: "file.txt", Mode: filemode.Regular, Hash: blob(content)},
+		}})
+		when = when.Add(time.Minute)
+		sig := object.Signature{Name: "Test", Email: "test@test.com", When: when}
+		return store(&object.Commit{Author: sig, Committer: sig, Message: content, TreeHash: tree, ParentHashes: parents}), tree
+	}
+
+	first, firstTree := commit("first")
+	tip, _ := commit("second", first)
+	pushed, pushedTree := commit("third", tip)
+	s.forbidden[first] = true
+	s.forbidden[firstTree] = true
+
+	objects, err := objectsBetween(s, []plumbing.Hash{pushed}, []plumbing.Hash{tip})
+	if err != nil {
+		t.Fatalf("objectsBetween returned error: %v", err)
+	}
+	want := []plumbing.Hash{pushed, pushedTree, blob("third")}
+	plumbing.HashesSort(objects)
+	plumbing.HashesSort(want)
+	if !slices.Equal(objects, want) {
+		t.Errorf("Expected objects %v, got %v", want, objects)
+	}
+
+	objects, err = objectsBetween(s, []plumbing.Hash{tip}, []plumbing.Hash{pushed})
+	if err != nil {
+		t.Fatalf("objectsBetween returned error: %v", err)
+	}
+	if len(objects) != 0 {
+		t.Errorf("Expected no objects for a commit reachable from the haves, got %v", objects)
+	}
+}
@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/matrixhub-ai/hfd/pkg/signature"
+)
+
+// CommitOption configures the commits and tags created by the repository.
+type CommitOption func(*commitOptions)
+
+type commitOptions struct {
+	signer         *signature.Signer
+	committerName  string
+	committerEmail string
+	quarantine     *ObjectQuarantine
+}
+
+// WithSigner signs the commits and annotated tags with signer.
+func WithSigner(signer *signature.Signer) CommitOption {
+	return func(o *commitOptions) {
+		o.signer = signer
+	}
+}
+
+// WithCommitter sets the committer of the commits, which defaults to the author.
+func WithCommitter(name string, email string) CommitOption {
+	return func(o *commitOptions) {
+		o.committerName = name
+		o.committerEmail = email
+	}
+}
+
+// WithObjectQuarantine writes the objects of the commits into quarantine, which they are moved from
+// into the repository once the commit is about to be made.
+func WithObjectQuarantine(quarantine *ObjectQuarantine) CommitOption {
+	return func(o *commitOptions) {
+		o.quarantine = quarantine
+	}
+}
+
+func newCommitOptions(opts []CommitOption) commitOptions {
+	var o commitOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// signable is a commit or tag object, which is signed over its encoding without signature.
+type signable interface {
+	EncodeWithoutSignature(o plumbing.EncodedObject) error
+}
+
+// sign returns the signature of the object, or an empty string without a signer.
+func (o commitOptions) sign(obj signable) (string, error) {
+	if o.signer == nil {
+		return "", nil
+	}
+	payload, err := encodeWithoutSignature(obj)
+	if err != nil {
+		return "", err
+	}
+	sig, err := o.signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return string(sig), nil
+}
+
+func encodeWithoutSignature(obj signable) ([]byte, error) {
+	encoded := &plumbing.MemoryObject{}
+	if err := obj.EncodeWithoutSignature(encoded); err != nil {
+		return nil, fmt.Errorf("failed to encode object: %w", err)
+	}
+	rd, err := encoded.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	return io.ReadAll(rd)
+}
+
+// writeCommit stores a commit object of the given tree and parents, made now.
+func (r *Repository) writeCommit(tree plumbing.Hash, parents []plumbing.Hash, message string, authorName string, authorEmail string, o commitOptions) (plumbing.Hash, error) {
+	// Git records times with a precision of a second
+	now := time.Now().Truncate(time.Second)
+	author := object.Signature{Name: authorName, Email: authorEmail, When: now}
+	committer := author
+	if o.committerName != "" || o.committerEmail != "" {
+		committer = object.Signature{Name: o.committerName, Email: o.committerEmail, When: now}
+	}
+
+	commit := &object.Commit{
+		Author:       author,
+		Committer:    committer,
+		Message:      withTrailingNewline(message),
+		TreeHash:     tree,
+		ParentHashes: parents,
+	}
+	sig, err := o.sign(commit)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to sign commit: %w", err)
+	}
+	commit.PGPSignature = sig
+
+	obj := r.repo.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to encode commit: %w", err)
+	}
+	hash, err := r.repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to create commit: %w", err)
+	}
+	return hash, nil
+}
+
+// CreateAnnotatedTag creates an annotated tag of the given revision, signed when a signer is given.
+// A committer given in the options is the tagger, as the identity the signature vouches for.
+func (r *Repository) CreateAnnotatedTag(name string, revision string, message string, taggerName string, taggerEmail string, opts ...CommitOption) error {
+	if err := validateRefName(name); err != nil {
+		return fmt.Errorf("invalid tag name %q: %w", name, err)
+	}
+	if revision == "" {
+		revision = r.DefaultBranch()
+	}
+	target, err := r.repo.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return fmt.Errorf("failed to resolve revision %q: %w", revision, err)
+	}
+
+	o := newCommitOptions(opts)
+	if o.committerName != "" || o.committerEmail != "" {
+		taggerName, taggerEmail = o.committerName, o.committerEmail
+	}
+	tag := &object.Tag{
+		Name:       name,
+		Tagger:     object.Signature{Name: taggerName, Email: taggerEmail, When: time.Now().Truncate(time.Second)},
+		Message:    withTrailingNewline(message),
+		TargetType: plumbing.CommitObject,
+		Target:     *target,
+	}
+	sig, err := o.sign(tag)
+	if err != nil {
+		return fmt.Errorf("failed to sign tag: %w", err)
+	}
+	tag.PGPSignature = sig
+
+	obj := r.repo.Storer.NewEncodedObject()
+	if err := tag.Encode(obj); err != nil {
+		return fmt.Errorf("failed to encode tag: %w", err)
+	}
+	hash, err := r.repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return fmt.Errorf("failed to create tag: %w", err)
+	}
+	return r.repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewTagReferenceName(name), hash))
+}
+
+// Verify verifies the signature of the commit with verifier, which caches the result by commit hash.
+func (c *Commit) Verify(verifier *signature.Verifier) (signature.Verification, error) {
+	if c.commit.PGPSignature == "" {
+		return verifier.Verify(nil, ""), nil
+	}
+	obj, err := c.r.repo.Storer.EncodedObject(plumbing.CommitObject, c.commit.Hash)
+	if err != nil {
+		return signature.Verification{}, fmt.Errorf("failed to read commit: %w", err)
+	}
+	reader, err := obj.Reader()
+	if err != nil {
+		return signature.Verification{}, fmt.Errorf("failed to read commit: %w", err)
+	}
+	defer reader.Close()
+	raw, err := io.ReadAll(reader)
+	if err != nil {
+		return signature.Verification{}, fmt.Errorf("failed to read commit: %w", err)
+	}
+	return verifier.VerifyCommit(c.commit.Hash.String(), raw), nil
+}
+
+func withTrailingNewline(message string) string {
+	if !strings.HasSuffix(message, "\n") {
+		message += "\n"
+	}
+	return message
+}
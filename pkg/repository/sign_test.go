@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/matrixhub-ai/hfd/pkg/signature"
+)
+
+func TestSignedCommitAndTag(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not found")
+	}
+	ctx := context.Background()
+	root := t.TempDir()
+	dir := filepath.Join(root, "repo.git")
+	repo, err := Init(ctx, dir, "main")
+	if err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	pub, key, _ := ed25519.GenerateKey(rand.Reader)
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	signer, err := signature.NewSSHSigner(pem.EncodeToMemory(block))
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	sshPub, _ := ssh.NewPublicKey(pub)
+	allowedSigners := filepath.Join(root, "allowed_signers")
+	if err := os.WriteFile(allowedSigners, []byte("hub@example.com "+string(ssh.MarshalAuthorizedKey(sshPub))), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := []CommitOption{WithSigner(signer), WithCommitter("Hub", "hub@example.com")}
+	commit, err := repo.CreateCommit(ctx, "main", "signed", "Test", "test@test.com", []CommitOperation{
+		{Type: CommitOperationAdd, Path: "README.md", Content: []byte("# Test\n")},
+	}, "", opts...)
+	if err != nil {
+		t.Fatalf("CreateCommit returned error: %v", err)
+	}
+	if err := repo.CreateAnnotatedTag("v1", "main", "release", "Test", "test@test.com", opts...); err != nil {
+		t.Fatalf("CreateAnnotatedTag returned error: %v", err)
+	}
+
+	git := func(args ...string) (string, error) {
+		args = append([]string{"-C", dir, "-c", "gpg.format=ssh", "-c", "gpg.ssh.allowedSignersFile=" + allowedSigners}, args...)
+		out, err := exec.Command("git", args...).CombinedOutput()
+		return string(out), err
+	}
+	if out, err := git("verify-commit", commit); err != nil {
+		t.Errorf("git rejected the commit signature: %v\n%s", err, out)
+	}
+	if out, err := git("verify-tag", "v1"); err != nil {
+		t.Errorf("git rejected the tag signature: %v\n%s", err, out)
+	}
+	if out, _ := git("log", "-1", "--format=%an <%ae> %cn <%ce>", commit); strings.TrimSpace(out) != "Test <test@test.com> Hub <hub@example.com>" {
+		t.Errorf("Unexpected identities %q", out)
+	}
+
+	verifier := signature.NewVerifier()
+	verifier.TrustSigner(signer, "hub@example.com")
+	commits, err := repo.Commits("main", nil)
+	if err != nil || len(commits) != 1 {
+		t.Fatalf("Failed to list commits: %v", err)
+	}
+	if result, err := commits[0].Verify(verifier); err != nil || !result.Verified || result.Signer != "hub@example.com" {
+		t.Errorf("Expected a valid signature, got %+v: %v", result, err)
+	}
+
+	squashed, err := repo.SuperSquash(ctx, "main", "squash", "Test", "test@test.com")
+	if err != nil {
+		t.Fatalf("SuperSquash returned error: %v", err)
+	}
+	commits, _ = repo.Commits(squashed, nil)
+	if result, err := commits[0].Verify(verifier); err != nil || result.Status != signature.StatusUnsigned {
+		t.Errorf("Expected an unsigned commit without signer, got %+v: %v", result, err)
+	}
+}
@@ -5,14 +5,15 @@ import (
 	"fmt"
 	"os"
 	"strings"
-	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
 
 	"github.com/matrixhub-ai/hfd/internal/utils"
 )
 
 // SuperSquash squashes all commits in the given rev into a single root commit
 // with the provided message. The action is irreversible.
-func (r *Repository) SuperSquash(ctx context.Context, rev string, message string, authorName string, authorEmail string) (string, error) {
+func (r *Repository) SuperSquash(ctx context.Context, rev string, message string, authorName string, authorEmail string, opts ...CommitOption) (string, error) {
 	if rev == "" {
 		rev = r.DefaultBranch()
 	}
@@ -33,23 +34,11 @@ func (r *Repository) SuperSquash(ctx context.Context, rev string, message string
 	treeHash := strings.TrimSpace(string(treeOutput))
 
 	// Create a new root commit (no parents) with the same tree
-	now := time.Now()
-	commitEnv := append(append([]string{}, env...),
-		"GIT_AUTHOR_NAME="+authorName,
-		"GIT_AUTHOR_EMAIL="+authorEmail,
-		"GIT_AUTHOR_DATE="+now.Format(time.RFC3339),
-		"GIT_COMMITTER_NAME="+authorName,
-		"GIT_COMMITTER_EMAIL="+authorEmail,
-		"GIT_COMMITTER_DATE="+now.Format(time.RFC3339),
-	)
-
-	commitCmd := utils.Command(ctx, "git", "commit-tree", treeHash, "-m", message)
-	commitCmd.Env = commitEnv
-	commitOutput, err := commitCmd.Output()
+	hash, err := r.writeCommit(plumbing.NewHash(treeHash), nil, message, authorName, authorEmail, newCommitOptions(opts))
 	if err != nil {
 		return "", fmt.Errorf("failed to create squash commit: %w", err)
 	}
-	commitHash := strings.TrimSpace(string(commitOutput))
+	commitHash := hash.String()
 
 	// Force update the ref to point to the new root commit
 	updateCmd := utils.Command(ctx, "git", "update-ref", refName, commitHash)
@@ -6,6 +6,8 @@ import (
 	"io"
 	"os"
 
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+
 	"github.com/matrixhub-ai/hfd/internal/utils"
 )
 
@@ -34,8 +36,8 @@ func (r *Repository) Stateless(ctx context.Context, output io.Writer, input io.R
 	cmd.Dir = r.repoPath
 	cmd.Stdin = input
 	cmd.Stdout = output
-	if len(extraEnv) > 0 {
-		cmd.Env = append(os.Environ(), extraEnv...)
+	if env := append(ServiceEnv(service), extraEnv...); len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
 	}
 	err := cmd.Run()
 	if err != nil {
@@ -44,6 +46,77 @@ func (r *Repository) Stateless(ctx context.Context, output io.Writer, input io.R
 	return nil
 }
 
+// Advertise writes the refs advertisement of the service, as the git binaries start a full-duplex session with.
+// The rest of the session is then served by ServeAdvertised, or as stateless requests by Stateless.
+func (r *Repository) Advertise(ctx context.Context, output io.Writer, service string, extraEnv ...string) error {
+	cmd := utils.Command(ctx, service, "--stateless-rpc", "--advertise-refs", ".")
+	cmd.Dir = r.repoPath
+	cmd.Stdout = output
+	if env := append(ServiceEnv(service), extraEnv...); len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return cmd.Run()
+}
+
+// ServeAdvertised serves the rest of a full-duplex session whose refs were already advertised with the git binary,
+// skipping the advertisement it starts with.
+func (r *Repository) ServeAdvertised(ctx context.Context, output io.Writer, input io.Reader, service string, extraEnv ...string) error {
+	cmd := utils.Command(ctx, service, ".")
+	cmd.Dir = r.repoPath
+	cmd.Stdin = input
+	cmd.Env = append(os.Environ(), append(ServiceEnv(service), extraEnv...)...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	scanner := pktline.NewScanner(stdout)
+	for {
+		line, err := scanLine(scanner)
+		if err != nil {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+			return fmt.Errorf("failed to read the advertisement of %s: %w", service, err)
+		}
+		if line == "" {
+			break
+		}
+	}
+	if _, err := io.Copy(output, stdout); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return err
+	}
+	return cmd.Wait()
+}
+
+// uploadPackConfig is the git configuration upload-pack runs with, allowing clients to make partial
+// clones (--filter) and to lazily fetch the objects they left out by hash.
+var uploadPackConfig = [][2]string{
+	{"uploadpack.allowFilter", "true"},
+	{"uploadpack.allowAnySHA1InWant", "true"},
+}
+
+// ServiceEnv returns the environment variables the given git service must run with.
+func ServiceEnv(service string) []string {
+	if service != GitUploadPack {
+		return nil
+	}
+	env := []string{fmt.Sprintf("GIT_CONFIG_COUNT=%d", len(uploadPackConfig))}
+	for i, kv := range uploadPackConfig {
+		env = append(env,
+			fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", i, kv[0]),
+			fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", i, kv[1]),
+		)
+	}
+	// Let upload-pack of a partial clone mirror fetch the objects it is missing from upstream.
+	env = append(env, "GIT_NO_LAZY_FETCH=0")
+	return env
+}
+
 // packetLine formats a string as a git packet-line.
 func packetLine(s string) []byte {
 	return fmt.Appendf(nil, "%04x%s", len(s)+4, s)
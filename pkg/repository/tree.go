@@ -2,7 +2,6 @@ package repository
 
 import (
 	"fmt"
-	"io"
 	"path"
 
 	"github.com/go-git/go-git/v5/plumbing"
@@ -44,17 +43,17 @@ func (e *TreeEntry) Blob() (*Blob, error) {
 		return nil, fmt.Errorf("entry is not a file")
 	}
 
-	blob, err := e.r.repo.BlobObject(e.hash)
+	size, newReader, err := e.r.blobObject(e.hash)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get blob object: %w", err)
 	}
 
 	return &Blob{
 		name:      path.Base(e.path),
-		size:      blob.Size,
+		size:      size,
 		modTime:   e.lastCommit.commit.Committer.When,
-		newReader: func() (io.ReadCloser, error) { return blob.Reader() },
-		hash:      blob.Hash,
+		newReader: newReader,
+		hash:      e.hash,
 		r:         e.r,
 	}, nil
 }
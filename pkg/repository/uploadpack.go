@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/format/pktline"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+)
+
+// packWindow is the number of objects go-git considers as delta bases when generating a pack.
+const packWindow = 10
+
+// uploadPack serves an upload-pack request: it negotiates the objects the client already has,
+// then sends a pack with the objects it wants. A stateless request ends at the first flush
+// of the negotiation, as the client sends the next round in a new request.
+func (r *Repository) uploadPack(ctx context.Context, w io.Writer, in io.Reader, stateless bool) error {
+	scanner := pktline.NewScanner(in)
+
+	wants, caps, err := r.readWants(scanner)
+	if err != nil {
+		return err
+	}
+	if len(wants) == 0 {
+		// The client is up to date, or only listed the refs.
+		return nil
+	}
+
+	enc := pktline.NewEncoder(w)
+	multiAck := caps.Supports(capability.MultiACKDetailed) || caps.Supports(capability.MultiACK)
+	var common []plumbing.Hash
+	for done := false; !done; {
+		line, err := scanLine(scanner)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		switch {
+		case line == "":
+			// With a common base, the client can stop sending haves and ask for the pack.
+			if caps.Supports(capability.MultiACKDetailed) && len(common) > 0 {
+				if err := enc.Encodef("ACK %s ready\n", common[len(common)-1]); err != nil {
+					return err
+				}
+			}
+			if multiAck || len(common) == 0 {
+				if err := enc.EncodeString("NAK\n"); err != nil {
+					return err
+				}
+			}
+			if stateless {
+				return nil
+			}
+		case line == "done":
+			switch {
+			case len(common) == 0:
+				err = enc.EncodeString("NAK\n")
+			case multiAck:
+				err = enc.Encodef("ACK %s\n", common[len(common)-1])
+			}
+			if err != nil {
+				return err
+			}
+			done = true
+		case strings.HasPrefix(line, "have "):
+			hash := plumbing.NewHash(strings.TrimPrefix(line, "have "))
+			if _, err := r.repo.Storer.EncodedObject(plumbing.AnyObject, hash); err != nil {
+				continue
+			}
+			common = append(common, hash)
+			switch {
+			case caps.Supports(capability.MultiACKDetailed):
+				err = enc.Encodef("ACK %s common\n", hash)
+			case caps.Supports(capability.MultiACK):
+				err = enc.Encodef("ACK %s continue\n", hash)
+			case len(common) == 1:
+				err = enc.Encodef("ACK %s\n", hash)
+			}
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unexpected upload-pack line %q", line)
+		}
+	}
+
+	objects, err := r.objectsToUpload(wants, common, caps.Supports(capability.IncludeTag))
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	out, muxed := sidebandWriter(w, caps)
+	if _, err := packfile.NewEncoder(out, r.repo.Storer, false).Encode(objects, packWindow); err != nil {
+		return fmt.Errorf("failed to encode pack: %w", err)
+	}
+	if muxed {
+		return enc.Flush()
+	}
+	return nil
+}
+
+// readWants reads the wanted objects and the capabilities of an upload-pack request.
+func (r *Repository) readWants(scanner *pktline.Scanner) ([]plumbing.Hash, *capability.List, error) {
+	caps := capability.NewList()
+	var wants []plumbing.Hash
+	for {
+		line, err := scanLine(scanner)
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(wants) == 0 {
+				return nil, caps, nil
+			}
+			return nil, nil, err
+		}
+		if line == "" {
+			return wants, caps, nil
+		}
+
+		switch {
+		case strings.HasPrefix(line, "want "):
+			hex, rest, _ := strings.Cut(strings.TrimPrefix(line, "want "), " ")
+			if len(wants) == 0 {
+				caps = parseCapabilities(rest)
+			}
+			hash := plumbing.NewHash(hex)
+			if _, err := r.repo.Storer.EncodedObject(plumbing.AnyObject, hash); err != nil {
+				return nil, nil, fmt.Errorf("not our ref %s", hex)
+			}
+			wants = append(wants, hash)
+		case strings.HasPrefix(line, "shallow "), strings.HasPrefix(line, "deepen"), strings.HasPrefix(line, "filter "):
+			return nil, nil, fmt.Errorf("shallow and filtered fetches are served by git-upload-pack")
+		default:
+			return nil, nil, fmt.Errorf("unexpected upload-pack line %q", line)
+		}
+	}
+}
+
+// objectsToUpload returns the objects reachable from wants that are not reachable from common.
+// With includeTag, annotated tags pointing at the uploaded objects are included too.
+func (r *Repository) objectsToUpload(wants, common []plumbing.Hash, includeTag bool) ([]plumbing.Hash, error) {
+	objects, err := objectsBetween(r.repo.Storer, wants, common)
+	if err != nil {
+		return nil, err
+	}
+	if !includeTag {
+		return objects, nil
+	}
+
+	sent := make(map[plumbing.Hash]bool, len(objects)+len(common))
+	for _, hash := range objects {
+		sent[hash] = true
+	}
+	for _, hash := range common {
+		sent[hash] = true
+	}
+	tags, err := r.repo.TagObjects()
+	if err != nil {
+		return nil, err
+	}
+	err = tags.ForEach(func(tag *object.Tag) error {
+		if !sent[tag.Hash] && sent[tag.Target] {
+			objects = append(objects, tag.Hash)
+			sent[tag.Hash] = true
+		}
+		return nil
+	})
+	return objects, err
+}
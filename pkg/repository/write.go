@@ -3,10 +3,16 @@ package repository
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
-	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/objfile"
+	"github.com/go-git/go-git/v5/plumbing/object"
 
 	"github.com/matrixhub-ai/hfd/internal/utils"
 )
@@ -19,23 +25,101 @@ const (
 	CommitOperationAdd CommitOperationType = "add"
 	// CommitOperationDelete deletes a file.
 	CommitOperationDelete CommitOperationType = "delete"
+	// CommitOperationDeleteFolder deletes a folder and everything under it.
+	CommitOperationDeleteFolder CommitOperationType = "delete-folder"
+	// CommitOperationCopy copies a file from a revision of the repository.
+	CommitOperationCopy CommitOperationType = "copy"
 )
 
+// ErrCopySourceNotFound is returned when the source of a copy operation does not exist.
+var ErrCopySourceNotFound = errors.New("copy source not found")
+
 // CommitOperation represents a single operation in a commit.
 type CommitOperation struct {
 	Type    CommitOperationType
 	Path    string
 	Content []byte // file content for add operations
+	Blob    string // hash of a blob already written with WriteBlob, used instead of Content when set
+
+	// SrcPath and SrcRevision locate the file copied by copy operations.
+	// The source revision defaults to the branch the commit is made on, before the commit.
+	SrcPath     string
+	SrcRevision string
+}
+
+// WriteBlob streams size bytes of content from rd into a loose blob object and returns its hash.
+// The content is compressed and hashed as it is read, so the size of the blob is not bound by memory.
+// The blob is unreachable until a commit references it.
+func (r *Repository) WriteBlob(rd io.Reader, size int64) (string, error) {
+	return writeLooseBlob(filepath.Join(r.repoPath, "objects"), rd, size)
+}
+
+// writeLooseBlob writes a loose blob object into the object directory objectsDir.
+func writeLooseBlob(objectsDir string, rd io.Reader, size int64) (string, error) {
+	f, err := os.CreateTemp(objectsDir, "tmp_obj_")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp object: %w", err)
+	}
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath)
+
+	hash, err := writeBlobObject(f, rd, size)
+	if cerr := f.Close(); err == nil && cerr != nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	hex := hash.String()
+	objectPath := filepath.Join(objectsDir, hex[:2], hex[2:])
+	if _, err := os.Stat(objectPath); err == nil {
+		return hex, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create object directory: %w", err)
+	}
+	if err := os.Chmod(tmpPath, 0o444); err != nil {
+		return "", fmt.Errorf("failed to write object %s: %w", hex, err)
+	}
+	if err := os.Rename(tmpPath, objectPath); err != nil {
+		return "", fmt.Errorf("failed to write object %s: %w", hex, err)
+	}
+	return hex, nil
+}
+
+func writeBlobObject(w io.Writer, rd io.Reader, size int64) (plumbing.Hash, error) {
+	ow := objfile.NewWriter(w)
+	if err := ow.WriteHeader(plumbing.BlobObject, size); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to write blob header: %w", err)
+	}
+	n, err := io.Copy(ow, io.LimitReader(rd, size))
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to write blob: %w", err)
+	}
+	if n != size {
+		return plumbing.ZeroHash, fmt.Errorf("failed to write blob: expected %d bytes, got %d", size, n)
+	}
+	if err := ow.Close(); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to write blob: %w", err)
+	}
+	return ow.Hash(), nil
 }
 
 // CreateCommit creates a new commit on the given branch with the given operations.
+// The branch may also be given as a full ref name, such as refs/convert/parquet.
 // This works on bare repositories by directly manipulating git objects and refs.
 // If parentCommit is non-empty, the rev update is made atomic: the current tip
 // must match parentCommit, otherwise the operation fails (optimistic concurrency).
-func (r *Repository) CreateCommit(ctx context.Context, rev string, message string, authorName string, authorEmail string, ops []CommitOperation, parentCommit string) (string, error) {
+func (r *Repository) CreateCommit(ctx context.Context, rev string, message string, authorName string, authorEmail string, ops []CommitOperation, parentCommit string, opts ...CommitOption) (string, error) {
 	if rev == "" {
 		rev = r.DefaultBranch()
 	}
+	o := newCommitOptions(opts)
+	writeBlob := r.WriteBlob
+	if o.quarantine != nil {
+		writeBlob = o.quarantine.WriteBlob
+	}
 
 	// Create a temporary index file path (the file must not exist yet for git)
 	tmpIndex, err := os.CreateTemp("", "git-index-*")
@@ -52,46 +136,89 @@ func (r *Repository) CreateCommit(ctx context.Context, rev string, message strin
 		"GIT_DIR="+r.repoPath,
 		"GIT_WORK_TREE="+r.repoPath,
 	)
+	if o.quarantine != nil {
+		env = append(env, o.quarantine.env()...)
+	}
 
 	// Try to read the current tree into the index (ignore error for new branches)
 	refName := "refs/heads/" + rev
+	if strings.HasPrefix(rev, "refs/") {
+		refName = rev
+	}
 	{
 		cmd := utils.Command(ctx, "git", "read-tree", refName)
 		cmd.Env = env
 		_ = cmd.Run()
 	}
 
-	// Apply operations
+	// Apply operations. Blobs are written in-process and the index is updated by
+	// update-index in batches, so the number of subprocesses does not grow with the number of files.
+	var indexInfo bytes.Buffer
+	flush := func() error {
+		if indexInfo.Len() == 0 {
+			return nil
+		}
+		cmd := utils.Command(ctx, "git", "update-index", "-z", "--index-info")
+		cmd.Env = env
+		cmd.Stdin = &indexInfo
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to update index: %w", err)
+		}
+		indexInfo.Reset()
+		return nil
+	}
 	for _, op := range ops {
 		switch op.Type {
 		case CommitOperationAdd:
-			// Create blob
-			cmd := utils.Command(ctx, "git", "hash-object", "-w", "--stdin")
-			cmd.Env = env
-			cmd.Stdin = bytes.NewReader(op.Content)
-			output, err := cmd.Output()
-			if err != nil {
-				return "", fmt.Errorf("failed to create blob for %s: %w", op.Path, err)
+			blobHash := op.Blob
+			if blobHash == "" {
+				blobHash, err = writeBlob(bytes.NewReader(op.Content), int64(len(op.Content)))
+				if err != nil {
+					return "", fmt.Errorf("failed to create blob for %s: %w", op.Path, err)
+				}
 			}
-			blobHash := strings.TrimSpace(string(output))
+			fmt.Fprintf(&indexInfo, "100644 %s\t%s\x00", blobHash, op.Path)
 
-			// Update index
-			cmd = utils.Command(ctx, "git", "update-index", "--add", "--cacheinfo", "100644", blobHash, op.Path)
-			cmd.Env = env
-			if err := cmd.Run(); err != nil {
-				return "", fmt.Errorf("failed to update index for %s: %w", op.Path, err)
+		case CommitOperationCopy:
+			srcRev := op.SrcRevision
+			if srcRev == "" {
+				srcRev = refName
+			}
+			entry, err := r.fileEntry(srcRev, op.SrcPath)
+			if err != nil {
+				return "", err
 			}
+			// The blob is shared with the source, so no content is written
+			fmt.Fprintf(&indexInfo, "%o %s\t%s\x00", uint32(entry.Mode), entry.Hash, op.Path)
 
 		case CommitOperationDelete:
-			cmd := utils.Command(ctx, "git", "update-index", "--force-remove", op.Path)
+			// A zero mode removes the path from the index
+			fmt.Fprintf(&indexInfo, "0 %s\t%s\x00", plumbing.ZeroHash, op.Path)
+
+		case CommitOperationDeleteFolder:
+			// The files of the folder are listed from the index, which must include the operations before
+			if err := flush(); err != nil {
+				return "", err
+			}
+			cmd := utils.Command(ctx, "git", "ls-files", "-z", "--", ":(literal)"+strings.TrimSuffix(op.Path, "/")+"/")
 			cmd.Env = env
-			if err := cmd.Run(); err != nil {
-				return "", fmt.Errorf("failed to remove path %s from index: %w", op.Path, err)
+			output, err := cmd.Output()
+			if err != nil {
+				return "", fmt.Errorf("failed to list folder %s: %w", op.Path, err)
 			}
+			for _, path := range strings.Split(string(output), "\x00") {
+				if path != "" {
+					fmt.Fprintf(&indexInfo, "0 %s\t%s\x00", plumbing.ZeroHash, path)
+				}
+			}
+
 		default:
 			return "", fmt.Errorf("unsupported operation type: %s", op.Type)
 		}
 	}
+	if err := flush(); err != nil {
+		return "", err
+	}
 
 	// Write tree
 	cmd := utils.Command(ctx, "git", "write-tree")
@@ -102,21 +229,9 @@ func (r *Repository) CreateCommit(ctx context.Context, rev string, message strin
 	}
 	treeHash := strings.TrimSpace(string(output))
 
-	// Build commit command
-	now := time.Now()
-	commitEnv := append(append([]string{}, env...),
-		"GIT_AUTHOR_NAME="+authorName,
-		"GIT_AUTHOR_EMAIL="+authorEmail,
-		"GIT_AUTHOR_DATE="+now.Format(time.RFC3339),
-		"GIT_COMMITTER_NAME="+authorName,
-		"GIT_COMMITTER_EMAIL="+authorEmail,
-		"GIT_COMMITTER_DATE="+now.Format(time.RFC3339),
-	)
-
-	args := []string{"commit-tree", treeHash, "-m", message}
-
 	// Add parent if branch exists
 	var currentTip string
+	var parents []plumbing.Hash
 	{
 		parentCmd := utils.Command(ctx, "git", "rev-parse", "--verify", refName)
 		parentCmd.Env = env
@@ -124,7 +239,7 @@ func (r *Repository) CreateCommit(ctx context.Context, rev string, message strin
 		if err == nil {
 			currentTip = strings.TrimSpace(string(parentOutput))
 			if currentTip != "" {
-				args = append(args, "-p", currentTip)
+				parents = append(parents, plumbing.NewHash(currentTip))
 			}
 		}
 	}
@@ -134,13 +249,17 @@ func (r *Repository) CreateCommit(ctx context.Context, rev string, message strin
 		return "", fmt.Errorf("expected parent commit %s but branch tip is %s", parentCommit, currentTip)
 	}
 
-	cmd = utils.Command(ctx, "git", args...)
-	cmd.Env = commitEnv
-	output, err = cmd.Output()
+	if o.quarantine != nil {
+		if err := o.quarantine.migrate(); err != nil {
+			return "", err
+		}
+	}
+
+	hash, err := r.writeCommit(plumbing.NewHash(treeHash), parents, message, authorName, authorEmail, o)
 	if err != nil {
-		return "", fmt.Errorf("failed to create commit: %w", err)
+		return "", err
 	}
-	commitHash := strings.TrimSpace(string(output))
+	commitHash := hash.String()
 
 	// Update ref atomically: provide old value to prevent lost updates
 	updateRefArgs := []string{"update-ref", refName, commitHash}
@@ -155,3 +274,24 @@ func (r *Repository) CreateCommit(ctx context.Context, rev string, message strin
 
 	return commitHash, nil
 }
+
+// fileEntry returns the tree entry of the file at path in the given revision.
+func (r *Repository) fileEntry(rev string, path string) (*object.TreeEntry, error) {
+	hash, err := r.repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("%w: revision %s: %v", ErrCopySourceNotFound, rev, err)
+	}
+	commit, err := r.repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit object: %w", err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree object: %w", err)
+	}
+	entry, err := tree.FindEntry(path)
+	if err != nil || !entry.Mode.IsFile() {
+		return nil, fmt.Errorf("%w: %s at revision %s", ErrCopySourceNotFound, path, rev)
+	}
+	return entry, nil
+}
@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestCreateCommitWithWrittenBlobs(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "repo.git")
+	repo, err := Init(ctx, dir, "main")
+	if err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+
+	content := strings.Repeat("large content\n", 10000)
+	blob, err := repo.WriteBlob(strings.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("WriteBlob returned error: %v", err)
+	}
+	out, err := exec.Command("git", "-C", dir, "cat-file", "-p", blob).Output()
+	if err != nil || string(out) != content {
+		t.Fatalf("Expected blob %s to hold the written content: %v", blob, err)
+	}
+	if _, err := repo.WriteBlob(strings.NewReader("short"), 10); err == nil {
+		t.Errorf("Expected WriteBlob to fail when the content is shorter than the size")
+	}
+
+	ops := []CommitOperation{{Type: CommitOperationAdd, Path: "data/large.txt", Blob: blob}}
+	for i := 0; i < 1000; i++ {
+		ops = append(ops, CommitOperation{Type: CommitOperationAdd, Path: fmt.Sprintf("files/%04d.txt", i), Content: []byte(fmt.Sprint(i))})
+	}
+	first, err := repo.CreateCommit(ctx, "main", "add files", "Test", "test@test.com", ops, "")
+	if err != nil {
+		t.Fatalf("CreateCommit returned error: %v", err)
+	}
+
+	second, err := repo.CreateCommit(ctx, "main", "delete files", "Test", "test@test.com", []CommitOperation{
+		{Type: CommitOperationDelete, Path: "files/0000.txt"},
+		{Type: CommitOperationDelete, Path: "missing.txt"},
+		{Type: CommitOperationAdd, Path: "files/0001.txt", Content: []byte("updated")},
+	}, first)
+	if err != nil {
+		t.Fatalf("CreateCommit returned error: %v", err)
+	}
+	if _, err := repo.CreateCommit(ctx, "main", "stale", "Test", "test@test.com", nil, first); err == nil {
+		t.Errorf("Expected CreateCommit to fail when the parent commit is not the tip")
+	}
+
+	out, err = exec.Command("git", "-C", dir, "ls-tree", "-r", "--name-only", second).Output()
+	if err != nil {
+		t.Fatalf("Failed to list tree: %v", err)
+	}
+	paths := strings.Fields(string(out))
+	if len(paths) != 1000 || paths[0] != "data/large.txt" || paths[1] != "files/0001.txt" {
+		t.Errorf("Unexpected tree with %d paths starting with %v", len(paths), paths[:2])
+	}
+	out, err = exec.Command("git", "-C", dir, "show", second+":files/0001.txt").Output()
+	if err != nil || string(out) != "updated" {
+		t.Errorf("Expected the updated content, got %q: %v", out, err)
+	}
+
+	third, err := repo.CreateCommit(ctx, "main", "copy and delete folder", "Test", "test@test.com", []CommitOperation{
+		{Type: CommitOperationCopy, Path: "copies/large.txt", SrcPath: "data/large.txt"},
+		{Type: CommitOperationCopy, Path: "copies/0000.txt", SrcPath: "files/0000.txt", SrcRevision: first},
+		{Type: CommitOperationAdd, Path: "files/new.txt", Content: []byte("new")},
+		{Type: CommitOperationDeleteFolder, Path: "files/"},
+	}, "")
+	if err != nil {
+		t.Fatalf("CreateCommit returned error: %v", err)
+	}
+	out, err = exec.Command("git", "-C", dir, "ls-tree", "-r", "--name-only", third).Output()
+	if err != nil {
+		t.Fatalf("Failed to list tree: %v", err)
+	}
+	if paths := strings.Fields(string(out)); fmt.Sprint(paths) != "[copies/0000.txt copies/large.txt data/large.txt]" {
+		t.Errorf("Unexpected tree after copy and folder delete: %v", paths)
+	}
+	out, err = exec.Command("git", "-C", dir, "rev-parse", third+":copies/large.txt", third+":copies/0000.txt").Output()
+	if err != nil || !strings.HasPrefix(string(out), blob+"\n") {
+		t.Errorf("Expected the copy to share the source blob, got %q: %v", out, err)
+	}
+	out, err = exec.Command("git", "-C", dir, "show", third+":copies/0000.txt").Output()
+	if err != nil || string(out) != "0" {
+		t.Errorf("Expected the copy from the first commit, got %q: %v", out, err)
+	}
+	if _, err := repo.CreateCommit(ctx, "main", "bad copy", "Test", "test@test.com", []CommitOperation{
+		{Type: CommitOperationCopy, Path: "copy.txt", SrcPath: "missing.txt"},
+	}, ""); !errors.Is(err, ErrCopySourceNotFound) {
+		t.Errorf("Expected ErrCopySourceNotFound, got %v", err)
+	}
+
+	if out, err := exec.Command("git", "-C", dir, "fsck", "--strict").CombinedOutput(); err != nil {
+		t.Errorf("git fsck failed: %v\n%s", err, out)
+	}
+}
+
+func TestCreateCommitOnConvertRef(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "repo.git")
+	repo, err := Init(ctx, dir, "main")
+	if err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+	if _, err := repo.CreateCommit(ctx, "main", "add data", "Test", "test@test.com", []CommitOperation{
+		{Type: CommitOperationAdd, Path: "data.csv", Content: []byte("a\n1\n")},
+	}, ""); err != nil {
+		t.Fatalf("CreateCommit returned error: %v", err)
+	}
+
+	commit, err := repo.CreateCommit(ctx, ConvertRefPrefix+"parquet", "convert", "Test", "test@test.com", []CommitOperation{
+		{Type: CommitOperationAdd, Path: "default/train/0000.parquet", Content: []byte("PAR1")},
+	}, "")
+	if err != nil {
+		t.Fatalf("CreateCommit returned error: %v", err)
+	}
+	if branches, _ := repo.Branches(); len(branches) != 1 || branches[0] != "main" {
+		t.Errorf("Expected the convert ref not to be a branch, got %v", branches)
+	}
+	if converts, _ := repo.Converts(); len(converts) != 1 || converts[0] != "parquet" {
+		t.Errorf("Expected the parquet convert ref, got %v", converts)
+	}
+	if sha, err := repo.ResolveRevision("refs/convert/parquet"); err != nil || sha != commit {
+		t.Errorf("Expected refs/convert/parquet to resolve to %s, got %s: %v", commit, sha, err)
+	}
+
+	rev, path, err := repo.SplitRevisionAndPath("refs/convert/parquet/default/train/0000.parquet")
+	if err != nil || rev != "refs/convert/parquet" || path != "default/train/0000.parquet" {
+		t.Errorf("Unexpected split %q %q: %v", rev, path, err)
+	}
+	if rev, path, _ := repo.SplitRevisionAndPath("main/data.csv"); rev != "main" || path != "data.csv" {
+		t.Errorf("Unexpected split %q %q", rev, path)
+	}
+
+	if err := repo.DeleteConvert("parquet"); err != nil {
+		t.Fatalf("DeleteConvert returned error: %v", err)
+	}
+	if converts, _ := repo.Converts(); len(converts) != 0 {
+		t.Errorf("Expected no convert ref, got %v", converts)
+	}
+}
+
+func TestCreateCommitWithObjectQuarantine(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "repo.git")
+	repo, err := Init(ctx, dir, "main")
+	if err != nil {
+		t.Fatalf("Failed to init repo: %v", err)
+	}
+	first, err := repo.CreateCommit(ctx, "main", "initial", "Test", "test@test.com", []CommitOperation{
+		{Type: CommitOperationAdd, Path: "README.md", Content: []byte("hello")},
+	}, "")
+	if err != nil {
+		t.Fatalf("CreateCommit returned error: %v", err)
+	}
+
+	commit := func(content string, parent string) (string, string, error) {
+		q, err := repo.NewObjectQuarantine()
+		if err != nil {
+			t.Fatalf("NewObjectQuarantine returned error: %v", err)
+		}
+		defer q.Close()
+		blob, err := q.WriteBlob(strings.NewReader(content), int64(len(content)))
+		if err != nil {
+			t.Fatalf("WriteBlob returned error: %v", err)
+		}
+		if err := exec.Command("git", "-C", dir, "cat-file", "-e", blob).Run(); err == nil {
+			t.Errorf("Expected blob %s to stay in quarantine", blob)
+		}
+		hash, err := repo.CreateCommit(ctx, "main", "add file", "Test", "test@test.com", []CommitOperation{
+			{Type: CommitOperationAdd, Path: "file.txt", Blob: blob},
+		}, parent, WithObjectQuarantine(q))
+		return hash, blob, err
+	}
+
+	// The objects of a failed commit never reach the repository
+	if _, blob, err := commit("stale", plumbing.ZeroHash.String()); err == nil {
+		t.Errorf("Expected CreateCommit to fail when the parent commit is not the tip")
+	} else if err := exec.Command("git", "-C", dir, "cat-file", "-e", blob).Run(); err == nil {
+		t.Errorf("Expected the blob of the failed commit not to be stored")
+	}
+
+	hash, _, err := commit("added", first)
+	if err != nil {
+		t.Fatalf("CreateCommit returned error: %v", err)
+	}
+	out, err := exec.Command("git", "-C", dir, "show", hash+":file.txt").Output()
+	if err != nil || string(out) != "added" {
+		t.Errorf("Expected the committed file to be stored, got %q: %v", out, err)
+	}
+	if incoming, _ := filepath.Glob(filepath.Join(dir, "objects", "incoming-*")); len(incoming) != 0 {
+		t.Errorf("Expected the quarantine to be removed, got %v", incoming)
+	}
+}
@@ -0,0 +1,198 @@
+package safetensors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"strings"
+
+	"github.com/matrixhub-ai/hfd/internal/lru"
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/receive"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+	"github.com/matrixhub-ai/hfd/pkg/storage"
+)
+
+const defaultCacheSize = 4096
+
+// Indexer reads the headers of the safetensors files of repositories, caching their parameter counts by object ID,
+// so that the weights of a model are described without reading more than their headers.
+type Indexer struct {
+	storage    *storage.Storage
+	lfsStorage lfs.Storage
+	teeCache   *lfs.TeeCache
+	counts     *lru.Cache[string, map[string]int64]
+}
+
+// Option defines a functional option for configuring the Indexer.
+type Option func(*Indexer)
+
+// WithStorage sets the storage repositories are opened from by PostReceiveHook.
+func WithStorage(storage *storage.Storage) Option {
+	return func(x *Indexer) {
+		x.storage = storage
+	}
+}
+
+// WithLFSStorage sets the storage the LFS objects of safetensors files are read from.
+func WithLFSStorage(s lfs.Storage) Option {
+	return func(x *Indexer) {
+		x.lfsStorage = s
+	}
+}
+
+// WithTeeCache sets the cache of the LFS objects being fetched from a proxy source,
+// whose headers can be read before the fetch completes.
+func WithTeeCache(c *lfs.TeeCache) Option {
+	return func(x *Indexer) {
+		x.teeCache = c
+	}
+}
+
+// WithCacheSize sets the number of files whose parameter counts are kept in memory.
+func WithCacheSize(n int) Option {
+	return func(x *Indexer) {
+		x.counts = lru.New[string, map[string]int64](n)
+	}
+}
+
+// NewIndexer creates a new Indexer with the provided options.
+func NewIndexer(opts ...Option) *Indexer {
+	x := &Indexer{
+		counts: lru.New[string, map[string]int64](defaultCacheSize),
+	}
+	for _, opt := range opts {
+		opt(x)
+	}
+	return x
+}
+
+// Info returns the parameter count of the safetensors weights of a repository at rev,
+// or nil if it has none. The weights are the shards listed by the index when there is one,
+// and the safetensors files at the root of the repository otherwise.
+func (x *Indexer) Info(ctx context.Context, repo *repository.Repository, rev string) (*Info, error) {
+	files, err := weightFiles(repo, rev)
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+
+	info := &Info{Parameters: map[string]int64{}}
+	for _, file := range files {
+		count, err := x.ParameterCount(ctx, repo, rev, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read header of %q: %w", file, err)
+		}
+		info.add(count)
+	}
+	return info, nil
+}
+
+// ParameterCount returns the number of parameters of each data type of a safetensors file of a repository at rev.
+// Only the counts are cached, as headers list every tensor of the file.
+func (x *Indexer) ParameterCount(ctx context.Context, repo *repository.Repository, rev string, file string) (map[string]int64, error) {
+	blob, err := repo.Blob(rev, file)
+	if err != nil {
+		return nil, err
+	}
+	// Content that does not parse as a pointer is the file itself
+	ptr, _ := blob.LFSPointer()
+
+	key := blob.Hash().String()
+	open := blob.NewReader
+	if ptr != nil {
+		key = ptr.OID()
+		open = func() (io.ReadCloser, error) {
+			return lfs.OpenHead(ctx, x.lfsStorage, x.teeCache, ptr.OID(), MaxHeaderSize+8)
+		}
+	}
+	if count, ok := x.counts.Get(key); ok {
+		return count, nil
+	}
+
+	rc, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+	h, err := ReadHeader(rc)
+	if err != nil {
+		return nil, err
+	}
+	count := h.ParameterCount()
+	x.counts.Add(key, count)
+	return count, nil
+}
+
+// PostReceiveHook reads the headers of the weights of the updated branches in the background,
+// so that they are cached by the time the model info is requested. It matches receive.PostReceiveHookFunc.
+func (x *Indexer) PostReceiveHook(ctx context.Context, repoName string, updates []receive.RefUpdate) error {
+	if x.storage == nil {
+		return nil
+	}
+	var revs []string
+	for _, u := range updates {
+		if u.IsBranch() && !u.IsDelete() {
+			revs = append(revs, u.NewRev())
+		}
+	}
+	if len(revs) == 0 {
+		return nil
+	}
+	repoPath := x.storage.ResolvePath(repoName)
+	if repoPath == "" {
+		return nil
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		repo, err := repository.Open(repoPath)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to open repository to read safetensors headers", "repo", repoName, "error", err)
+			return
+		}
+		for _, rev := range revs {
+			if _, err := x.Info(ctx, repo, rev); err != nil {
+				slog.WarnContext(ctx, "Failed to read safetensors headers", "repo", repoName, "rev", rev, "error", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// weightFiles returns the safetensors weight files of a repository at rev.
+func weightFiles(repo *repository.Repository, rev string) ([]string, error) {
+	if blob, err := repo.Blob(rev, IndexFile); err == nil {
+		rc, err := blob.NewReader()
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = rc.Close()
+		}()
+		index, err := ParseIndex(rc)
+		if err != nil {
+			return nil, err
+		}
+		return index.Files(), nil
+	}
+
+	entries, err := repo.Tree(rev, "", nil)
+	if err != nil {
+		if errors.Is(err, repository.ErrRevisionNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.Type() == repository.EntryTypeFile && strings.HasSuffix(entry.Path(), ".safetensors") && path.Dir(entry.Path()) == "." {
+			files = append(files, entry.Path())
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,143 @@
+package safetensors
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+const (
+	// MaxHeaderSize is the largest header read, as the huggingface_hub client does.
+	MaxHeaderSize = 25_000_000
+
+	// IndexFile is the file listing the shards of sharded weights.
+	IndexFile = "model.safetensors.index.json"
+	// WeightsFile is the file holding weights that are not sharded.
+	WeightsFile = "model.safetensors"
+
+	metadataKey = "__metadata__"
+)
+
+// ErrHeaderTooLarge is returned for headers larger than MaxHeaderSize.
+var ErrHeaderTooLarge = errors.New("safetensors header is too large")
+
+// TensorInfo describes a tensor of a safetensors file.
+type TensorInfo struct {
+	DType       string   `json:"dtype"`
+	Shape       []int64  `json:"shape"`
+	DataOffsets [2]int64 `json:"data_offsets"`
+}
+
+// Parameters returns the number of parameters of the tensor.
+func (t TensorInfo) Parameters() int64 {
+	n := int64(1)
+	for _, d := range t.Shape {
+		n *= d
+	}
+	return n
+}
+
+// Header is the header of a safetensors file, which describes its tensors.
+type Header struct {
+	Metadata map[string]string     `json:"metadata"`
+	Tensors  map[string]TensorInfo `json:"tensors"`
+}
+
+// ReadHeader reads the header at the start of a safetensors file: its size as
+// a little-endian 64-bit integer followed by as many bytes of JSON.
+// Nothing past the header is read.
+func ReadHeader(r io.Reader) (*Header, error) {
+	var size uint64
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, fmt.Errorf("failed to read safetensors header size: %w", err)
+	}
+	if size > MaxHeaderSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrHeaderTooLarge, size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("failed to read safetensors header: %w", err)
+	}
+	return ParseHeader(data)
+}
+
+// ParseHeader parses the JSON of a safetensors header.
+func ParseHeader(data []byte) (*Header, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid safetensors header: %w", err)
+	}
+	h := &Header{
+		Metadata: map[string]string{},
+		Tensors:  make(map[string]TensorInfo, len(raw)),
+	}
+	for name, value := range raw {
+		if name == metadataKey {
+			if err := json.Unmarshal(value, &h.Metadata); err != nil {
+				return nil, fmt.Errorf("invalid safetensors metadata: %w", err)
+			}
+			continue
+		}
+		var t TensorInfo
+		if err := json.Unmarshal(value, &t); err != nil {
+			return nil, fmt.Errorf("invalid safetensors tensor %q: %w", name, err)
+		}
+		h.Tensors[name] = t
+	}
+	return h, nil
+}
+
+// ParameterCount returns the number of parameters of the tensors, by dtype.
+func (h *Header) ParameterCount() map[string]int64 {
+	count := map[string]int64{}
+	for _, t := range h.Tensors {
+		count[t.DType] += t.Parameters()
+	}
+	return count
+}
+
+// Index is the content of the index of sharded weights.
+type Index struct {
+	Metadata  map[string]any    `json:"metadata"`
+	WeightMap map[string]string `json:"weight_map"`
+}
+
+// ParseIndex parses the index of sharded weights.
+func ParseIndex(r io.Reader) (*Index, error) {
+	var index Index
+	if err := json.NewDecoder(r).Decode(&index); err != nil {
+		return nil, fmt.Errorf("invalid safetensors index: %w", err)
+	}
+	return &index, nil
+}
+
+// Files returns the sorted shard files of the index.
+func (i *Index) Files() []string {
+	seen := map[string]struct{}{}
+	var files []string
+	for _, file := range i.WeightMap {
+		if _, ok := seen[file]; !ok {
+			seen[file] = struct{}{}
+			files = append(files, file)
+		}
+	}
+	slices.Sort(files)
+	return files
+}
+
+// Info is the parameter count of the weights of a model.
+type Info struct {
+	Parameters map[string]int64 `json:"parameters"`
+	Total      int64            `json:"total"`
+}
+
+// add counts the parameters of a file in the info.
+func (i *Info) add(count map[string]int64) {
+	for dtype, n := range count {
+		i.Parameters[dtype] += n
+		i.Total += n
+	}
+}
@@ -0,0 +1,193 @@
+package safetensors
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+)
+
+// buildFile returns a safetensors file of F32 tensors with the given shapes.
+func buildFile(t *testing.T, shapes map[string][]int64) []byte {
+	t.Helper()
+	header := map[string]any{
+		"__metadata__": map[string]string{"format": "pt"},
+	}
+	// The data of the tensors is laid out in the order of their names
+	var offset int64
+	for _, name := range slices.Sorted(maps.Keys(shapes)) {
+		shape := shapes[name]
+		size := TensorInfo{Shape: shape}.Parameters() * 4
+		header[name] = TensorInfo{DType: "F32", Shape: shape, DataOffsets: [2]int64{offset, offset + size}}
+		offset += size
+	}
+	data, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, uint64(len(data)))
+	buf.Write(data)
+	buf.Write(make([]byte, offset))
+	return buf.Bytes()
+}
+
+func TestReadHeader(t *testing.T) {
+	file := buildFile(t, map[string][]int64{
+		"embed.weight": {10, 4},
+		"head.bias":    {4},
+		"scale":        {},
+	})
+	r := bytes.NewReader(file)
+	h, err := ReadHeader(r)
+	if err != nil {
+		t.Fatalf("ReadHeader: %v", err)
+	}
+	if h.Metadata["format"] != "pt" || len(h.Tensors) != 3 {
+		t.Fatalf("unexpected header %+v", h)
+	}
+	if got := h.Tensors["embed.weight"]; got.DType != "F32" || got.DataOffsets != [2]int64{0, 160} {
+		t.Errorf("unexpected tensor %+v", got)
+	}
+	if count := h.ParameterCount(); count["F32"] != 45 {
+		t.Errorf("expected 45 F32 parameters, got %v", count)
+	}
+	if r.Len() != 45*4 {
+		t.Errorf("expected the data not to be read, %d bytes left", r.Len())
+	}
+
+	var tooLarge bytes.Buffer
+	_ = binary.Write(&tooLarge, binary.LittleEndian, uint64(MaxHeaderSize+1))
+	if _, err := ReadHeader(&tooLarge); !errors.Is(err, ErrHeaderTooLarge) {
+		t.Errorf("expected ErrHeaderTooLarge, got %v", err)
+	}
+	if _, err := ReadHeader(bytes.NewReader(file[:20])); err == nil {
+		t.Errorf("expected an error for a truncated header")
+	}
+}
+
+func TestParseIndex(t *testing.T) {
+	index, err := ParseIndex(strings.NewReader(`{
+		"metadata": {"total_size": 1000},
+		"weight_map": {
+			"a": "model-00002-of-00002.safetensors",
+			"b": "model-00001-of-00002.safetensors",
+			"c": "model-00001-of-00002.safetensors"
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("ParseIndex: %v", err)
+	}
+	files := index.Files()
+	if strings.Join(files, ",") != "model-00001-of-00002.safetensors,model-00002-of-00002.safetensors" {
+		t.Errorf("unexpected files %v", files)
+	}
+}
+
+func TestIndexer(t *testing.T) {
+	lfsDir := t.TempDir()
+	lfsStorage := lfs.NewLocal(lfsDir)
+	workDir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.CommandContext(t.Context(), "git", args...)
+		cmd.Dir = workDir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	write := func(name string, content []byte) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(workDir, name), content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// writeLFS stores the content in the LFS storage, and its pointer in the repository.
+	writeLFS := func(name string, content []byte) string {
+		t.Helper()
+		sum := sha256.Sum256(content)
+		oid := hex.EncodeToString(sum[:])
+		if err := lfsStorage.Put(oid, bytes.NewReader(content), int64(len(content))); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		write(name, []byte(fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", oid, len(content))))
+		return oid
+	}
+
+	git("init", "--initial-branch=main")
+	git("config", "user.email", "test@test.com")
+	git("config", "user.name", "Test User")
+	write("README.md", []byte("# Model\n"))
+	git("add", ".")
+	git("commit", "-m", "Initial commit")
+	write("model.safetensors", buildFile(t, map[string][]int64{"w": {2, 3}}))
+	git("add", ".")
+	git("commit", "-m", "Add weights")
+
+	repo, err := repository.Open(workDir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	x := NewIndexer(WithLFSStorage(lfsStorage))
+
+	info, err := x.Info(t.Context(), repo, "main~1")
+	if err != nil || info != nil {
+		t.Fatalf("expected no info without weights, got %+v, %v", info, err)
+	}
+	info, err = x.Info(t.Context(), repo, "main")
+	if err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+	if info.Total != 6 || info.Parameters["F32"] != 6 {
+		t.Errorf("unexpected info %+v", info)
+	}
+
+	// Sharded weights are listed by the index, with shards stored in LFS
+	git("rm", "-q", "model.safetensors")
+	oid := writeLFS("model-00001-of-00002.safetensors", buildFile(t, map[string][]int64{"a": {100, 10}, "b": {10}}))
+	writeLFS("model-00002-of-00002.safetensors", buildFile(t, map[string][]int64{"c": {7}}))
+	write(IndexFile, []byte(fmt.Sprintf(`{"metadata":{},"weight_map":{"a":%q,"b":%[1]q,"c":%q}}`,
+		"model-00001-of-00002.safetensors", "model-00002-of-00002.safetensors")))
+	git("add", ".")
+	git("commit", "-m", "Shard weights")
+
+	repo, err = repository.Open(workDir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	info, err = x.Info(t.Context(), repo, "main")
+	if err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+	if info.Total != 1017 || info.Parameters["F32"] != 1017 {
+		t.Errorf("unexpected info %+v", info)
+	}
+
+	// Parameter counts are cached by object ID
+	if err := os.RemoveAll(lfsDir); err != nil {
+		t.Fatal(err)
+	}
+	count, err := x.ParameterCount(t.Context(), repo, "main", "model-00001-of-00002.safetensors")
+	if err != nil {
+		t.Fatalf("expected the parameter count of %s to be cached, got %v", oid, err)
+	}
+	if len(count) != 1 || count["F32"] == 0 {
+		t.Errorf("unexpected parameter count %+v", count)
+	}
+	if _, err := NewIndexer(WithLFSStorage(lfsStorage)).Info(t.Context(), repo, "main"); !errors.Is(err, lfs.ErrObjectNotAvailable) {
+		t.Errorf("expected ErrObjectNotAvailable for missing LFS objects, got %v", err)
+	}
+}
@@ -0,0 +1,561 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// SafetyLevel is the safety of a global imported by a pickle, as reported by huggingface.co.
+type SafetyLevel string
+
+const (
+	// SafetyInnocuous is the level of globals known to be safe, such as the tensor types of PyTorch.
+	SafetyInnocuous SafetyLevel = "innocuous"
+	// SafetySuspicious is the level of globals neither known to be safe nor dangerous.
+	SafetySuspicious SafetyLevel = "suspicious"
+	// SafetyDangerous is the level of globals able to run code or reach the system, such as os.system.
+	SafetyDangerous SafetyLevel = "dangerous"
+)
+
+func (l SafetyLevel) rank() int {
+	switch l {
+	case SafetyInnocuous:
+		return 1
+	case SafetySuspicious:
+		return 2
+	case SafetyDangerous:
+		return 3
+	}
+	return 0
+}
+
+// Import is a global imported by a pickle, which unpickling looks up and usually calls.
+type Import struct {
+	Module string      `json:"module"`
+	Name   string      `json:"name"`
+	Safety SafetyLevel `json:"safety"`
+}
+
+// unknownGlobal names the globals whose module or name is not known without running the pickle.
+const unknownGlobal = "unknown"
+
+// maxStringSize bounds the size of the strings kept while reading a pickle;
+// longer strings are skipped, as they cannot name a global.
+const maxStringSize = 1024
+
+// safeGlobals are the globals of the modules found in model weights known to be safe, by module.
+// The name "*" matches any global of a module.
+var safeGlobals = map[string][]string{
+	"collections": {"OrderedDict", "defaultdict"},
+	"torch": {
+		"BFloat16Storage", "BoolStorage", "ByteStorage", "CharStorage", "ComplexDoubleStorage", "ComplexFloatStorage",
+		"DoubleStorage", "FloatStorage", "HalfStorage", "IntStorage", "LongStorage", "QInt32Storage", "QInt8Storage",
+		"QUInt2x4Storage", "QUInt4x2Storage", "QUInt8Storage", "ShortStorage", "Size", "device", "dtype",
+		"bfloat16", "bool", "float16", "float32", "float64", "int8", "int16", "int32", "int64", "uint8",
+	},
+	"torch._utils": {
+		"_rebuild_device_tensor_from_numpy", "_rebuild_meta_tensor_no_storage", "_rebuild_nested_tensor",
+		"_rebuild_parameter", "_rebuild_parameter_with_state", "_rebuild_qtensor", "_rebuild_sparse_tensor",
+		"_rebuild_tensor", "_rebuild_tensor_v2", "_rebuild_wrapper_subclass",
+	},
+	"torch._tensor":          {"_rebuild_from_type_v2"},
+	"torch.serialization":    {"_get_layout"},
+	"numpy":                  {"dtype", "ndarray"},
+	"numpy.core.multiarray":  {"_reconstruct", "scalar"},
+	"numpy._core.multiarray": {"_reconstruct", "scalar"},
+	"builtins":               {"bytearray", "complex", "frozenset", "set", "slice"},
+	"__builtin__":            {"bytearray", "complex", "frozenset", "set", "slice"},
+	"_codecs":                {"encode"},
+}
+
+// dangerousGlobals are the globals able to run code, read or write files, or reach the network, by module.
+// The name "*" matches any global of a module and of its submodules.
+var dangerousGlobals = map[string][]string{
+	"builtins": {
+		"__import__", "apply", "breakpoint", "compile", "delattr", "eval", "exec", "execfile", "getattr",
+		"globals", "input", "locals", "open", "setattr", "vars",
+	},
+	"__builtin__": {
+		"__import__", "apply", "breakpoint", "compile", "delattr", "eval", "exec", "execfile", "getattr",
+		"globals", "input", "locals", "open", "setattr", "vars",
+	},
+	"operator":                         {"attrgetter", "methodcaller"},
+	"torch.storage":                    {"_load_from_bytes"},
+	"torch._inductor.codecache":        {"compile_file"},
+	"numpy.testing._private.utils":     {"runstring"},
+	"_io":                              {"FileIO"},
+	"io":                               {"FileIO", "open"},
+	"os":                               {"*"},
+	"nt":                               {"*"},
+	"posix":                            {"*"},
+	"subprocess":                       {"*"},
+	"sys":                              {"*"},
+	"socket":                           {"*"},
+	"shutil":                           {"*"},
+	"runpy":                            {"*"},
+	"webbrowser":                       {"*"},
+	"pty":                              {"*"},
+	"pickle":                           {"*"},
+	"_pickle":                          {"*"},
+	"dill":                             {"*"},
+	"marshal":                          {"*"},
+	"ctypes":                           {"*"},
+	"importlib":                        {"*"},
+	"code":                             {"*"},
+	"codeop":                           {"*"},
+	"commands":                         {"*"},
+	"pdb":                              {"*"},
+	"bdb":                              {"*"},
+	"asyncio":                          {"*"},
+	"multiprocessing":                  {"*"},
+	"platform":                         {"*"},
+	"httplib":                          {"*"},
+	"http":                             {"*"},
+	"urllib":                           {"*"},
+	"urllib2":                          {"*"},
+	"requests":                         {"*"},
+	"aiohttp":                          {"*"},
+	"torch.hub":                        {"*"},
+	"tensorflow.python.ops.gen_io_ops": {"*"},
+	unknownGlobal:                      {"*"},
+}
+
+// safetyOf returns the safety level of a global.
+func safetyOf(module, name string) SafetyLevel {
+	for m, names := range dangerousGlobals {
+		if module != m && !strings.HasPrefix(module, m+".") {
+			continue
+		}
+		for _, n := range names {
+			if n == "*" || (n == name && module == m) {
+				return SafetyDangerous
+			}
+		}
+	}
+	for _, n := range safeGlobals[module] {
+		if n == "*" || n == name {
+			return SafetyInnocuous
+		}
+	}
+	return SafetySuspicious
+}
+
+// pickle opcodes, as listed by Python's pickletools.
+const (
+	opMark           = '('
+	opStop           = '.'
+	opPop            = '0'
+	opPopMark        = '1'
+	opDup            = '2'
+	opFloat          = 'F'
+	opInt            = 'I'
+	opBinInt         = 'J'
+	opBinInt1        = 'K'
+	opLong           = 'L'
+	opBinInt2        = 'M'
+	opNone           = 'N'
+	opPersID         = 'P'
+	opBinPersID      = 'Q'
+	opReduce         = 'R'
+	opString         = 'S'
+	opBinString      = 'T'
+	opShortBinString = 'U'
+	opUnicode        = 'V'
+	opBinUnicode     = 'X'
+	opAppend         = 'a'
+	opBuild          = 'b'
+	opGlobal         = 'c'
+	opDict           = 'd'
+	opEmptyDict      = '}'
+	opAppends        = 'e'
+	opGet            = 'g'
+	opBinGet         = 'h'
+	opInst           = 'i'
+	opLongBinGet     = 'j'
+	opList           = 'l'
+	opEmptyList      = ']'
+	opObj            = 'o'
+	opPut            = 'p'
+	opBinPut         = 'q'
+	opLongBinPut     = 'r'
+	opSetItem        = 's'
+	opTuple          = 't'
+	opEmptyTuple     = ')'
+	opSetItems       = 'u'
+	opBinFloat       = 'G'
+
+	opProto           = 0x80
+	opNewObj          = 0x81
+	opExt1            = 0x82
+	opExt2            = 0x83
+	opExt4            = 0x84
+	opTuple1          = 0x85
+	opTuple2          = 0x86
+	opTuple3          = 0x87
+	opNewTrue         = 0x88
+	opNewFalse        = 0x89
+	opLong1           = 0x8a
+	opLong4           = 0x8b
+	opBinBytes        = 'B'
+	opShortBinBytes   = 'C'
+	opShortBinUnicode = 0x8c
+	opBinUnicode8     = 0x8d
+	opBinBytes8       = 0x8e
+	opEmptySet        = 0x8f
+	opAddItems        = 0x90
+	opFrozenSet       = 0x91
+	opNewObjEx        = 0x92
+	opStackGlobal     = 0x93
+	opMemoize         = 0x94
+	opFrame           = 0x95
+	opByteArray8      = 0x96
+	opNextBuffer      = 0x97
+	opReadOnlyBuffer  = 0x98
+)
+
+// errNotPickle is returned when the content does not start as a pickle does.
+var errNotPickle = errors.New("not a pickle")
+
+// isPickleStart tells whether b starts a pickle of protocol 2 or later, as PyTorch writes them.
+func isPickleStart(b []byte) bool {
+	return len(b) >= 2 && b[0] == opProto && b[1] <= 5
+}
+
+// value is a value pushed on the stack of a pickle, whose text is known for strings only.
+type value struct {
+	text  string
+	known bool
+}
+
+// pickleReader reads the opcodes of a pickle without running it, collecting the globals it imports.
+// As the stack is not simulated, the operands of STACK_GLOBAL are taken to be the last two values
+// pushed, which is how pickles written by Python import globals.
+type pickleReader struct {
+	r       *bufio.Reader
+	recent  []value
+	memo    map[uint64]value
+	imports []Import
+}
+
+// ScanPickle returns the globals imported by the pickles of r, which holds one or more pickles in a row,
+// possibly followed by data that is not a pickle, as the legacy PyTorch format does.
+// The pickles are not run.
+func ScanPickle(r io.Reader) ([]Import, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	var imports []Import
+	for i := 0; ; i++ {
+		if i > 0 {
+			// What follows the first pickle is read as a pickle only if it starts as one
+			if head, _ := br.Peek(2); !isPickleStart(head) {
+				return imports, nil
+			}
+		}
+		pr := &pickleReader{r: br, memo: map[uint64]value{}}
+		err := pr.read()
+		if err != nil {
+			if i == 0 {
+				return nil, err
+			}
+			return imports, nil
+		}
+		imports = appendImports(imports, pr.imports...)
+	}
+}
+
+func appendImports(imports []Import, more ...Import) []Import {
+	for _, imp := range more {
+		found := false
+		for _, i := range imports {
+			if i.Module == imp.Module && i.Name == imp.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			imports = append(imports, imp)
+		}
+	}
+	return imports
+}
+
+// read reads the opcodes of a pickle up to its STOP opcode.
+func (p *pickleReader) read() error {
+	for n := 0; ; n++ {
+		op, err := p.r.ReadByte()
+		if err != nil {
+			if n == 0 && err == io.EOF {
+				return errNotPickle
+			}
+			return unexpectedEOF(err)
+		}
+		switch op {
+		case opStop:
+			return nil
+
+		case opProto:
+			if _, err := p.fixed(1); err != nil {
+				return err
+			}
+		case opFrame:
+			if _, err := p.fixed(8); err != nil {
+				return err
+			}
+
+		case opMark, opNone, opNewTrue, opNewFalse, opEmptyDict, opEmptyList, opEmptyTuple, opEmptySet,
+			opDict, opList, opTuple, opTuple1, opTuple2, opTuple3, opObj, opFrozenSet, opNewObj, opNewObjEx,
+			opReduce, opBinPersID, opNextBuffer:
+			p.push(value{})
+		case opPop, opPopMark, opAppend, opAppends, opSetItem, opSetItems, opAddItems, opBuild, opReadOnlyBuffer:
+		case opDup:
+			if len(p.recent) > 0 {
+				p.push(p.recent[len(p.recent)-1])
+			}
+
+		case opBinInt1:
+			if err := p.skip(1); err != nil {
+				return err
+			}
+			p.push(value{})
+		case opBinInt2:
+			if err := p.skip(2); err != nil {
+				return err
+			}
+			p.push(value{})
+		case opBinInt:
+			if err := p.skip(4); err != nil {
+				return err
+			}
+			p.push(value{})
+		case opBinFloat:
+			if err := p.skip(8); err != nil {
+				return err
+			}
+			p.push(value{})
+		case opInt, opLong, opFloat, opPersID:
+			if _, err := p.line(); err != nil {
+				return err
+			}
+			p.push(value{})
+		case opLong1:
+			if err := p.sized(1, false); err != nil {
+				return err
+			}
+		case opLong4, opBinBytes:
+			if err := p.sized(4, false); err != nil {
+				return err
+			}
+		case opShortBinBytes:
+			if err := p.sized(1, false); err != nil {
+				return err
+			}
+		case opBinBytes8, opByteArray8:
+			if err := p.sized(8, false); err != nil {
+				return err
+			}
+
+		case opString:
+			s, err := p.line()
+			if err != nil {
+				return err
+			}
+			if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+				s = s[1 : len(s)-1]
+			}
+			p.push(value{text: s, known: true})
+		case opUnicode:
+			s, err := p.line()
+			if err != nil {
+				return err
+			}
+			p.push(value{text: s, known: true})
+		case opShortBinString, opShortBinUnicode:
+			if err := p.sized(1, true); err != nil {
+				return err
+			}
+		case opBinString, opBinUnicode:
+			if err := p.sized(4, true); err != nil {
+				return err
+			}
+		case opBinUnicode8:
+			if err := p.sized(8, true); err != nil {
+				return err
+			}
+
+		case opGet:
+			s, err := p.line()
+			if err != nil {
+				return err
+			}
+			idx, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid GET opcode: %q", s)
+			}
+			p.push(p.memo[idx])
+		case opBinGet:
+			idx, err := p.fixed(1)
+			if err != nil {
+				return err
+			}
+			p.push(p.memo[idx])
+		case opLongBinGet:
+			idx, err := p.fixed(4)
+			if err != nil {
+				return err
+			}
+			p.push(p.memo[idx])
+		case opPut:
+			s, err := p.line()
+			if err != nil {
+				return err
+			}
+			idx, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid PUT opcode: %q", s)
+			}
+			p.put(idx)
+		case opBinPut:
+			idx, err := p.fixed(1)
+			if err != nil {
+				return err
+			}
+			p.put(idx)
+		case opLongBinPut:
+			idx, err := p.fixed(4)
+			if err != nil {
+				return err
+			}
+			p.put(idx)
+		case opMemoize:
+			p.put(uint64(len(p.memo)))
+
+		case opGlobal, opInst:
+			module, err := p.line()
+			if err != nil {
+				return err
+			}
+			name, err := p.line()
+			if err != nil {
+				return err
+			}
+			p.addImport(module, name)
+			p.push(value{})
+		case opStackGlobal:
+			module, name := value{}, value{}
+			if n := len(p.recent); n >= 2 {
+				module, name = p.recent[n-2], p.recent[n-1]
+			}
+			if !module.known || !name.known {
+				module.text, name.text = unknownGlobal, unknownGlobal
+			}
+			p.addImport(module.text, name.text)
+			p.push(value{})
+		case opExt1, opExt2, opExt4:
+			size := map[byte]int{opExt1: 1, opExt2: 2, opExt4: 4}[op]
+			code, err := p.fixed(size)
+			if err != nil {
+				return err
+			}
+			// Extensions are globals registered with copyreg, which cannot be told without running Python
+			p.addImport("copyreg", "extension "+strconv.FormatUint(code, 10))
+			p.push(value{})
+
+		default:
+			if n == 0 {
+				return errNotPickle
+			}
+			return fmt.Errorf("unknown pickle opcode 0x%02x", op)
+		}
+	}
+}
+
+// push records a value pushed on the stack, keeping the last two.
+func (p *pickleReader) push(v value) {
+	p.recent = append(p.recent, v)
+	if len(p.recent) > 2 {
+		p.recent = p.recent[1:]
+	}
+}
+
+// put records the value on the top of the stack in the memo.
+func (p *pickleReader) put(idx uint64) {
+	var v value
+	if len(p.recent) > 0 {
+		v = p.recent[len(p.recent)-1]
+	}
+	p.memo[idx] = v
+}
+
+func (p *pickleReader) addImport(module, name string) {
+	p.imports = appendImports(p.imports, Import{Module: module, Name: name, Safety: safetyOf(module, name)})
+}
+
+// fixed reads a little-endian unsigned integer of size bytes.
+func (p *pickleReader) fixed(size int) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(p.r, buf[:size]); err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
+
+func (p *pickleReader) skip(n int64) error {
+	if _, err := p.r.Discard(int(n)); err != nil {
+		return unexpectedEOF(err)
+	}
+	return nil
+}
+
+// sized reads data prefixed by its size of sizeLen bytes, and pushes it as a string when text is set.
+func (p *pickleReader) sized(sizeLen int, text bool) error {
+	n, err := p.fixed(sizeLen)
+	if err != nil {
+		return err
+	}
+	if !text || n > maxStringSize {
+		if _, err := io.CopyN(io.Discard, p.r, int64(n)); err != nil {
+			return unexpectedEOF(err)
+		}
+		p.push(value{})
+		return nil
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(p.r, buf); err != nil {
+		return unexpectedEOF(err)
+	}
+	p.push(value{text: string(buf), known: true})
+	return nil
+}
+
+// line reads the argument of an opcode ending with a newline. Only the first bytes of long lines are kept.
+func (p *pickleReader) line() (string, error) {
+	var buf bytes.Buffer
+	for {
+		chunk, err := p.r.ReadSlice('\n')
+		if buf.Len() < maxStringSize {
+			buf.Write(chunk[:min(len(chunk), maxStringSize-buf.Len())])
+		}
+		if err == nil {
+			break
+		}
+		if err != bufio.ErrBufferFull {
+			return "", unexpectedEOF(err)
+		}
+	}
+	return strings.TrimRight(buf.String(), "\r\n"), nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
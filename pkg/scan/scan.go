@@ -0,0 +1,271 @@
+// Package scan inspects the files of repositories for content that is unsafe to load,
+// such as pickles importing globals able to run code, or executables, as huggingface.co does.
+// Nothing is run: pickles are read opcode by opcode.
+package scan
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// Status is the security status of a file.
+type Status string
+
+const (
+	// StatusSafe means nothing unsafe was found in the file.
+	StatusSafe Status = "safe"
+	// StatusCaution means the file holds content that could not be told safe,
+	// such as pickles importing unknown globals or archives.
+	StatusCaution Status = "caution"
+	// StatusUnsafe means the file holds content able to run code when loaded or run.
+	StatusUnsafe Status = "unsafe"
+	// StatusQueued means the file was not scanned yet.
+	StatusQueued Status = "queued"
+)
+
+func (s Status) rank() int {
+	switch s {
+	case StatusCaution:
+		return 1
+	case StatusUnsafe:
+		return 2
+	}
+	return 0
+}
+
+// PickleImportScan reports the globals imported by the pickles of a file.
+type PickleImportScan struct {
+	HighestSafetyLevel SafetyLevel `json:"highestSafetyLevel"`
+	Imports            []Import    `json:"imports"`
+}
+
+// Result is the result of the scan of a file.
+type Result struct {
+	Status           Status            `json:"status"`
+	PickleImportScan *PickleImportScan `json:"pickleImportScan,omitempty"`
+	// Issues tell why the file is not safe.
+	Issues []string `json:"issues,omitempty"`
+}
+
+// escalate raises the status of the result to s, recording the issue.
+func (r *Result) escalate(s Status, issue string) {
+	if s.rank() > r.Status.rank() {
+		r.Status = s
+	}
+	r.Issues = append(r.Issues, issue)
+}
+
+// addImports records the globals imported by pickles, raising the status by their safety.
+func (r *Result) addImports(imports []Import) {
+	if r.PickleImportScan == nil {
+		r.PickleImportScan = &PickleImportScan{HighestSafetyLevel: SafetyInnocuous, Imports: []Import{}}
+	}
+	r.PickleImportScan.Imports = appendImports(r.PickleImportScan.Imports, imports...)
+	for _, imp := range imports {
+		if imp.Safety.rank() > r.PickleImportScan.HighestSafetyLevel.rank() {
+			r.PickleImportScan.HighestSafetyLevel = imp.Safety
+		}
+		switch imp.Safety {
+		case SafetyDangerous:
+			r.escalate(StatusUnsafe, fmt.Sprintf("pickle imports dangerous global %s.%s", imp.Module, imp.Name))
+		case SafetySuspicious:
+			r.escalate(StatusCaution, fmt.Sprintf("pickle imports unknown global %s.%s", imp.Module, imp.Name))
+		}
+	}
+}
+
+// pickleExtensions are the extensions of the files holding pickles, or archives of pickles as PyTorch writes them.
+var pickleExtensions = map[string]bool{
+	".bin":    true,
+	".ckpt":   true,
+	".joblib": true,
+	".pkl":    true,
+	".pickle": true,
+	".pt":     true,
+	".pth":    true,
+}
+
+// pickleOnlyExtensions are the extensions of the files that are pickles whatever their first opcode.
+var pickleOnlyExtensions = map[string]bool{
+	".joblib": true,
+	".pkl":    true,
+	".pickle": true,
+}
+
+// IsPickleFile tells whether the file at name is scanned for pickles, by its extension.
+func IsPickleFile(name string) bool {
+	return pickleExtensions[strings.ToLower(path.Ext(name))]
+}
+
+// sniffSize is the size of the head of a file its kind is told from.
+const sniffSize = 4096
+
+// Scan scans the content of the file at name. The files told by IsPickleFile are read for pickles,
+// including in zip archives as PyTorch writes them; other files are only checked for executable
+// content. Zip archives are spooled to a temporary file, unless r is an io.ReaderAt and io.Seeker.
+func Scan(name string, r io.Reader) (*Result, error) {
+	br := bufio.NewReaderSize(r, sniffSize)
+	head, err := br.Peek(sniffSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	result := &Result{Status: StatusSafe}
+	if kind := executableKind(head); kind != "" {
+		result.escalate(StatusUnsafe, kind+" executable")
+		return result, nil
+	}
+	if !IsPickleFile(name) {
+		return result, nil
+	}
+
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		if err := scanZip(result, r, br); err != nil {
+			return nil, err
+		}
+	case isPickleStart(head) || pickleOnlyExtensions[strings.ToLower(path.Ext(name))]:
+		imports, err := ScanPickle(br)
+		if err != nil {
+			result.escalate(StatusCaution, fmt.Sprintf("failed to read pickle: %v", err))
+			return result, nil
+		}
+		result.addImports(imports)
+	default:
+		if kind := archiveKind(head); kind != "" {
+			result.escalate(StatusCaution, kind+" archive whose content is not scanned")
+		}
+	}
+	return result, nil
+}
+
+// scanZip scans the pickles of a zip archive, and the head of its other members for executables.
+// The archive is read from r when it can be read at random, and spooled from br otherwise.
+func scanZip(result *Result, r io.Reader, br *bufio.Reader) error {
+	var ra io.ReaderAt
+	var size int64
+	if rs, ok := r.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		end, err := rs.Seek(0, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+		ra, size = rs, end
+	} else {
+		spool, err := os.CreateTemp("", "hfd-scan-*")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = spool.Close()
+			_ = os.Remove(spool.Name())
+		}()
+		if size, err = io.Copy(spool, br); err != nil {
+			return err
+		}
+		ra = spool
+	}
+
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		result.escalate(StatusCaution, fmt.Sprintf("failed to read zip archive: %v", err))
+		return nil
+	}
+	pickles := 0
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if err := scanZipMember(result, f, &pickles); err != nil {
+			result.escalate(StatusCaution, fmt.Sprintf("failed to read %s: %v", f.Name, err))
+		}
+	}
+	if pickles == 0 {
+		result.escalate(StatusCaution, "zip archive whose content is not scanned")
+	}
+	return nil
+}
+
+func scanZipMember(result *Result, f *zip.File, pickles *int) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+	br := bufio.NewReaderSize(rc, sniffSize)
+	head, err := br.Peek(sniffSize)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if kind := executableKind(head); kind != "" {
+		result.escalate(StatusUnsafe, fmt.Sprintf("%s executable in archive member %s", kind, f.Name))
+		return nil
+	}
+	if path.Ext(f.Name) != ".pkl" {
+		return nil
+	}
+	*pickles++
+	imports, err := ScanPickle(br)
+	if err != nil {
+		return err
+	}
+	result.addImports(imports)
+	return nil
+}
+
+// executableKind returns the kind of executable head starts, or an empty string if it is not one.
+func executableKind(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("\x7fELF")):
+		return "ELF"
+	case len(head) >= 4 && isMachO(binary.BigEndian.Uint32(head)):
+		return "Mach-O"
+	case bytes.HasPrefix(head, []byte("MZ")) && len(head) >= 0x40:
+		// The DOS header of a PE executable points to its PE header
+		offset := binary.LittleEndian.Uint32(head[0x3c:])
+		if int64(offset)+4 <= int64(len(head)) && bytes.Equal(head[offset:offset+4], []byte("PE\x00\x00")) {
+			return "PE"
+		}
+	}
+	return ""
+}
+
+func isMachO(magic uint32) bool {
+	switch magic {
+	case 0xfeedface, 0xfeedfacf, 0xcefaedfe, 0xcffaedfe:
+		return true
+	}
+	return false
+}
+
+// archiveKind returns the kind of archive or compressed stream head starts, or an empty string if it is not one.
+func archiveKind(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("\x1f\x8b")):
+		return "gzip"
+	case bytes.HasPrefix(head, []byte("BZh")):
+		return "bzip2"
+	case bytes.HasPrefix(head, []byte("\xfd7zXZ\x00")):
+		return "xz"
+	case bytes.HasPrefix(head, []byte("(\xb5/\xfd")):
+		return "zstd"
+	case bytes.HasPrefix(head, []byte("7z\xbc\xaf\x27\x1c")):
+		return "7z"
+	case bytes.HasPrefix(head, []byte("Rar!\x1a\x07")):
+		return "rar"
+	case len(head) >= 262 && bytes.Equal(head[257:262], []byte("ustar")):
+		return "tar"
+	}
+	return ""
+}
@@ -0,0 +1,173 @@
+package scan
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func zipArchive(t *testing.T, files map[string]string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestScanPickle(t *testing.T) {
+	tests := []struct {
+		name    string
+		pickle  string
+		imports []Import
+		wantErr bool
+	}{
+		{
+			name:    "protocol 2 global",
+			pickle:  "\x80\x02ccollections\nOrderedDict\nq\x00)Rq\x01.",
+			imports: []Import{{Module: "collections", Name: "OrderedDict", Safety: SafetyInnocuous}},
+		},
+		{
+			name:    "protocol 0 global",
+			pickle:  "cos\nsystem\n(S'echo hi'\ntR.",
+			imports: []Import{{Module: "os", Name: "system", Safety: SafetyDangerous}},
+		},
+		{
+			name:    "protocol 4 stack global",
+			pickle:  "\x80\x04\x95\x1a\x00\x00\x00\x00\x00\x00\x00]\x94(\x8c\x05posix\x94\x8c\x06system\x94\x93\x94h\x03e.",
+			imports: []Import{{Module: "posix", Name: "system", Safety: SafetyDangerous}},
+		},
+		{
+			name:    "stack global of memoized strings",
+			pickle:  "\x80\x04\x8c\x08builtins\x94\x8c\x03set\x94\x8c\x04eval\x94h\x00h\x02\x93.",
+			imports: []Import{{Module: "builtins", Name: "eval", Safety: SafetyDangerous}},
+		},
+		{
+			name:    "stack global of unknown operands",
+			pickle:  "\x80\x04K\x01K\x02\x93.",
+			imports: []Import{{Module: "unknown", Name: "unknown", Safety: SafetyDangerous}},
+		},
+		{
+			name: "pickles followed by data",
+			pickle: "\x80\x02K\x01." +
+				"\x80\x02ctorch\nFloatStorage\nq\x00." +
+				"cos\nsystem\n",
+			imports: []Import{{Module: "torch", Name: "FloatStorage", Safety: SafetyInnocuous}},
+		},
+		{
+			name:    "unknown global",
+			pickle:  "\x80\x02c__main__\nModel\nq\x00.",
+			imports: []Import{{Module: "__main__", Name: "Model", Safety: SafetySuspicious}},
+		},
+		{
+			name:    "truncated",
+			pickle:  "\x80\x02c__ma",
+			wantErr: true,
+		},
+		{
+			name:    "not a pickle",
+			pickle:  "\x00\x01\x02",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			imports, err := ScanPickle(strings.NewReader(tt.pickle))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got imports %v", imports)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ScanPickle: %v", err)
+			}
+			if !reflect.DeepEqual(imports, tt.imports) {
+				t.Errorf("expected imports %v, got %v", tt.imports, imports)
+			}
+		})
+	}
+}
+
+func TestScan(t *testing.T) {
+	elf := "\x7fELF\x02\x01\x01" + strings.Repeat("\x00", 64)
+	dangerous := "cos\nsystem\n(S'echo hi'\ntR."
+	safe := "\x80\x02ctorch._utils\n_rebuild_tensor_v2\nq\x00ctorch\nFloatStorage\nq\x01\x86q\x02."
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		status  Status
+		highest SafetyLevel
+	}{
+		{name: "safe pickle", file: "model.pt", content: safe, status: StatusSafe, highest: SafetyInnocuous},
+		{name: "dangerous pickle", file: "model.pkl", content: dangerous, status: StatusUnsafe, highest: SafetyDangerous},
+		{name: "suspicious pickle", file: "model.ckpt", content: "\x80\x02c__main__\nModel\nq\x00.", status: StatusCaution, highest: SafetySuspicious},
+		{name: "broken pickle", file: "data.pickle", content: "cos\nsys", status: StatusCaution},
+		{name: "pickle with another extension", file: "notes.txt", content: dangerous, status: StatusSafe},
+		{name: "binary that is not a pickle", file: "model.bin", content: "\x00\x01\x02\x03", status: StatusSafe},
+		{name: "executable", file: "tokenizer.json", content: elf, status: StatusUnsafe},
+		{name: "gzip", file: "model.bin", content: "\x1f\x8b\x08\x00\x00\x00", status: StatusCaution},
+		{
+			name:    "pytorch archive",
+			file:    "pytorch_model.bin",
+			content: zipArchive(t, map[string]string{"archive/data.pkl": safe, "archive/data/0": "\x00\x00\x80\x3f", "archive/version": "3\n"}),
+			status:  StatusSafe,
+			highest: SafetyInnocuous,
+		},
+		{
+			name:    "pytorch archive with a dangerous pickle",
+			file:    "model.pth",
+			content: zipArchive(t, map[string]string{"archive/data.pkl": dangerous}),
+			status:  StatusUnsafe,
+			highest: SafetyDangerous,
+		},
+		{
+			name:    "archive with an executable",
+			file:    "model.bin",
+			content: zipArchive(t, map[string]string{"archive/data.pkl": safe, "run": elf}),
+			status:  StatusUnsafe,
+			highest: SafetyInnocuous,
+		},
+		{
+			name:    "archive without pickles",
+			file:    "model.bin",
+			content: zipArchive(t, map[string]string{"readme.txt": "hello"}),
+			status:  StatusCaution,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Scan(tt.file, strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatalf("Scan: %v", err)
+			}
+			if result.Status != tt.status {
+				t.Errorf("expected status %q, got %+v", tt.status, result)
+			}
+			if tt.status != StatusSafe && len(result.Issues) == 0 {
+				t.Errorf("expected the issues of the file to be reported")
+			}
+			var highest SafetyLevel
+			if result.PickleImportScan != nil {
+				highest = result.PickleImportScan.HighestSafetyLevel
+			}
+			if highest != tt.highest {
+				t.Errorf("expected highest safety level %q, got %q", tt.highest, highest)
+			}
+		})
+	}
+}
@@ -0,0 +1,467 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/matrixhub-ai/hfd/internal/lru"
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/receive"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+	"github.com/matrixhub-ai/hfd/pkg/storage"
+)
+
+const (
+	defaultCacheSize   = 65536
+	defaultConcurrency = 1
+	// defaultQueueSize bounds the number of files waiting to be scanned in the background.
+	// Files listed while the queue is full are queued again the next time they are listed.
+	defaultQueueSize = 1024
+	// failureRetryInterval is how long a file that failed to be scanned is not queued again,
+	// such as a proxied LFS object not fetched yet.
+	failureRetryInterval = 10 * time.Minute
+)
+
+// FileResult is the result of the scan of a file of a repository.
+type FileResult struct {
+	Path   string
+	Result *Result
+}
+
+// target is the content of a file to scan.
+type target struct {
+	path string
+	key  string
+	open func() (io.ReadCloser, error)
+}
+
+// Scanner scans the files of repositories in the background, caching the results by the LFS object ID
+// of the files, or by their blob hash for the files not stored with LFS, so that a file is scanned once
+// whatever the repositories and revisions it is part of. The results are also stored in a directory,
+// when one is set, so that they outlive the process.
+type Scanner struct {
+	storage     *storage.Storage
+	lfsStorage  lfs.Storage
+	teeCache    *lfs.TeeCache
+	resultsDir  string
+	results     *lru.Cache[string, *Result]
+	failures    *lru.Cache[string, time.Time]
+	concurrency int
+
+	startOnce sync.Once
+	pending   chan target
+
+	mut    sync.Mutex
+	queued map[string]struct{}
+}
+
+// Option defines a functional option for configuring the Scanner.
+type Option func(*Scanner)
+
+// WithStorage sets the storage repositories are opened from by PostReceiveHook.
+func WithStorage(storage *storage.Storage) Option {
+	return func(s *Scanner) {
+		s.storage = storage
+	}
+}
+
+// WithLFSStorage sets the storage the LFS objects of files are read from.
+func WithLFSStorage(ls lfs.Storage) Option {
+	return func(s *Scanner) {
+		s.lfsStorage = ls
+	}
+}
+
+// WithTeeCache sets the cache of the LFS objects being fetched from a proxy source.
+func WithTeeCache(c *lfs.TeeCache) Option {
+	return func(s *Scanner) {
+		s.teeCache = c
+	}
+}
+
+// WithResultsDir sets the directory the results are stored in.
+func WithResultsDir(dir string) Option {
+	return func(s *Scanner) {
+		s.resultsDir = dir
+	}
+}
+
+// WithCacheSize sets the number of results, and of failures, kept in memory.
+func WithCacheSize(n int) Option {
+	return func(s *Scanner) {
+		s.results = lru.New[string, *Result](n)
+		s.failures = lru.New[string, time.Time](n)
+	}
+}
+
+// WithConcurrency sets the number of files scanned at once in the background.
+func WithConcurrency(n int) Option {
+	return func(s *Scanner) {
+		s.concurrency = max(n, 1)
+	}
+}
+
+// NewScanner creates a new Scanner with the provided options.
+func NewScanner(opts ...Option) *Scanner {
+	s := &Scanner{
+		results:     lru.New[string, *Result](defaultCacheSize),
+		failures:    lru.New[string, time.Time](defaultCacheSize),
+		concurrency: defaultConcurrency,
+		pending:     make(chan target, defaultQueueSize),
+		queued:      map[string]struct{}{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// File returns the result of the scan of a file of a repository. When the file was not scanned yet,
+// the result has the queued status and the file is scanned in the background, unless it failed to be
+// scanned recently.
+func (s *Scanner) File(ctx context.Context, name string, blob *repository.Blob) *Result {
+	// The file is read in the background, after the request the file is listed for
+	t := s.blobTarget(context.WithoutCancel(ctx), name, blob)
+	if result, ok := s.cached(t.key); ok {
+		return result
+	}
+	if failed, ok := s.failures.Get(t.key); !ok || time.Since(failed) > failureRetryInterval {
+		s.queue(t)
+	}
+	return &Result{Status: StatusQueued}
+}
+
+// Files returns the results of the scans of the files of a repository at rev, as File does.
+func (s *Scanner) Files(ctx context.Context, repo *repository.Repository, rev string) ([]FileResult, error) {
+	entries, err := repo.Tree(rev, "", &repository.TreeOptions{Recursive: true})
+	if err != nil {
+		return nil, err
+	}
+	var results []FileResult
+	for _, e := range entries {
+		if e.Type() != repository.EntryTypeFile {
+			continue
+		}
+		blob, err := e.Blob()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get blob of %q: %w", e.Path(), err)
+		}
+		results = append(results, FileResult{Path: e.Path(), Result: s.File(ctx, e.Path(), blob)})
+	}
+	return results, nil
+}
+
+// PostReceiveHook scans the files of the updated branches in the background, after a push,
+// a commit or a mirror sync. It matches receive.PostReceiveHookFunc.
+func (s *Scanner) PostReceiveHook(ctx context.Context, repoName string, updates []receive.RefUpdate) error {
+	if s.storage == nil {
+		return nil
+	}
+	var revs []string
+	for _, u := range updates {
+		if u.IsBranch() && !u.IsDelete() {
+			revs = append(revs, u.NewRev())
+		}
+	}
+	if len(revs) == 0 {
+		return nil
+	}
+	repoPath := s.storage.ResolvePath(repoName)
+	if repoPath == "" {
+		return nil
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		repo, err := repository.Open(repoPath)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to open repository to scan", "repo", repoName, "error", err)
+			return
+		}
+		for _, rev := range revs {
+			if _, err := s.Files(ctx, repo, rev); err != nil {
+				slog.WarnContext(ctx, "Failed to scan files", "repo", repoName, "rev", rev, "error", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// QuarantineHook scans the files a push adds, and rejects the push when one of them is unsafe.
+// The LFS objects of the files must be uploaded before the push, as git-lfs does, so that they
+// are scanned: a push adding a file whose object is not available is rejected. It is a receive.QuarantineHookFunc.
+func (s *Scanner) QuarantineHook(ctx context.Context, repoName string, q *receive.Quarantine, updates []receive.RefUpdate) error {
+	args := []string{"rev-list", "--objects"}
+	for _, u := range updates {
+		if !u.IsDelete() {
+			args = append(args, u.NewRev())
+		}
+	}
+	if len(args) == 2 {
+		return nil
+	}
+	out, err := q.Command(ctx, append(args, "--not", "--all")...).Output()
+	if err != nil {
+		return fmt.Errorf("failed to list new objects: %w", err)
+	}
+
+	// Only the objects listed with a path are trees and blobs
+	paths := map[string]string{}
+	var hashes []string
+	for _, line := range strings.Split(string(out), "\n") {
+		hash, name, ok := strings.Cut(line, " ")
+		if !ok || name == "" {
+			continue
+		}
+		if _, seen := paths[hash]; !seen {
+			hashes = append(hashes, hash)
+		}
+		paths[hash] = name
+	}
+
+	var scanned []FileResult
+	var missing []string
+	// Blobs are streamed, as they can be large
+	err = q.StreamObjects(ctx, hashes, func(hash string, objectType string, size int64, r io.Reader) error {
+		if objectType != "blob" {
+			return nil
+		}
+		name := paths[hash]
+		t, err := s.streamTarget(ctx, name, hash, size, r)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		result, err := s.scan(ctx, t)
+		if errors.Is(err, lfs.ErrObjectNotAvailable) {
+			missing = append(missing, name)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to scan %s: %w", name, err)
+		}
+		scanned = append(scanned, FileResult{Path: name, Result: result})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(missing) != 0 {
+		return fmt.Errorf("%w: the LFS objects of %s must be uploaded before they are pushed", ErrUnscannedFiles, strings.Join(missing, ", "))
+	}
+	return UnsafeFilesError(scanned)
+}
+
+// Check returns the result of the scan of a file not stored with LFS, of the given blob hash,
+// reading its content from r unless the result is cached.
+func (s *Scanner) Check(ctx context.Context, name string, hash string, r io.Reader) (*Result, error) {
+	return s.scan(ctx, target{path: name, key: cacheKey(hash, name), open: func() (io.ReadCloser, error) {
+		return io.NopCloser(r), nil
+	}})
+}
+
+// CheckLFS returns the result of the scan of a file stored as the LFS object of ptr,
+// scanning it unless the result is cached.
+func (s *Scanner) CheckLFS(ctx context.Context, name string, ptr *lfs.Pointer) (*Result, error) {
+	return s.scan(ctx, s.lfsTarget(ctx, name, ptr))
+}
+
+// ErrUnsafeFiles is returned when files that are unsafe are added to a repository.
+var ErrUnsafeFiles = errors.New("unsafe files")
+
+// ErrUnscannedFiles is returned when files whose content cannot be scanned, such as LFS objects
+// not uploaded yet, are added to a repository that only accepts scanned files.
+var ErrUnscannedFiles = errors.New("files cannot be scanned")
+
+// UnsafeFilesError returns an error wrapping ErrUnsafeFiles which lists the unsafe files and their issues,
+// or nil if none of the files is unsafe.
+func UnsafeFilesError(files []FileResult) error {
+	var unsafe []string
+	for _, f := range files {
+		if f.Result.Status == StatusUnsafe {
+			unsafe = append(unsafe, fmt.Sprintf("%s (%s)", f.Path, strings.Join(f.Result.Issues, ", ")))
+		}
+	}
+	if len(unsafe) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrUnsafeFiles, strings.Join(unsafe, "; "))
+}
+
+// blobTarget returns the target of a file of a repository, which is its LFS object when it has one.
+func (s *Scanner) blobTarget(ctx context.Context, name string, blob *repository.Blob) target {
+	// Content that does not parse as a pointer is the file itself
+	if ptr, _ := blob.LFSPointer(); ptr != nil && ptr.OID() != "" {
+		return s.lfsTarget(ctx, name, ptr)
+	}
+	return target{path: name, key: cacheKey(blob.Hash().String(), name), open: blob.NewReader}
+}
+
+// streamTarget returns the target of a file of the blob of the given size read from r, which is its LFS object
+// when it has one. Only blobs small enough to be LFS pointers are read in memory; the target of other blobs
+// can be opened once, while r is valid.
+func (s *Scanner) streamTarget(ctx context.Context, name string, hash string, size int64, r io.Reader) (target, error) {
+	if size <= lfs.MaxLFSPointerSize {
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return target{}, err
+		}
+		if ptr, err := lfs.DecodePointer(bytes.NewReader(content)); err == nil && ptr != nil && ptr.OID() != "" {
+			return s.lfsTarget(ctx, name, ptr), nil
+		}
+		r = bytes.NewReader(content)
+	}
+	return target{path: name, key: cacheKey(hash, name), open: func() (io.ReadCloser, error) {
+		return io.NopCloser(r), nil
+	}}, nil
+}
+
+func (s *Scanner) lfsTarget(ctx context.Context, name string, ptr *lfs.Pointer) target {
+	return target{path: name, key: cacheKey(ptr.OID(), name), open: func() (io.ReadCloser, error) {
+		// Objects read from a file can be read at random, which saves spooling zip archives
+		if getter, ok := s.lfsStorage.(lfs.Getter); ok && s.lfsStorage.Exists(ptr.OID()) {
+			content, _, err := getter.Get(ptr.OID())
+			return content, err
+		}
+		return lfs.OpenHead(ctx, s.lfsStorage, s.teeCache, ptr.OID(), ptr.Size())
+	}}
+}
+
+// cacheKey returns the key of the result of the scan of an object. As files are scanned by their
+// extension, the same object is scanned once for each extension it is stored with.
+func cacheKey(oid string, name string) string {
+	return oid + strings.ToLower(path.Ext(name))
+}
+
+// scan returns the cached result of the scan of the target, scanning it if needed.
+func (s *Scanner) scan(ctx context.Context, t target) (*Result, error) {
+	if result, ok := s.cached(t.key); ok {
+		return result, nil
+	}
+	rc, err := t.open()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+	result, err := Scan(t.path, rc)
+	if err != nil {
+		return nil, err
+	}
+	if result.Status != StatusSafe {
+		slog.WarnContext(ctx, "Scanned file is not safe", "path", t.path, "status", result.Status, "issues", result.Issues)
+	}
+	s.results.Add(t.key, result)
+	s.failures.Remove(t.key)
+	if err := s.store(t.key, result); err != nil {
+		slog.WarnContext(ctx, "Failed to store scan result", "path", t.path, "error", err)
+	}
+	return result, nil
+}
+
+// cached returns the result of the scan of the object of the key, from memory or from the results directory.
+func (s *Scanner) cached(key string) (*Result, bool) {
+	if result, ok := s.results.Get(key); ok {
+		return result, true
+	}
+	if s.resultsDir == "" {
+		return nil, false
+	}
+	data, err := os.ReadFile(s.resultPath(key))
+	if err != nil {
+		return nil, false
+	}
+	var result Result
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, false
+	}
+	s.results.Add(key, &result)
+	return &result, true
+}
+
+// store writes the result of the scan of the object of the key to the results directory, if any.
+func (s *Scanner) store(key string, result *Result) error {
+	if s.resultsDir == "" {
+		return nil
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	file := s.resultPath(key)
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".result-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// resultPath returns the file the result of the key is stored in. Keys end with the extension
+// of a file name, so they are hashed to be safe as file names.
+func (s *Scanner) resultPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(s.resultsDir, name[:2], name+".json")
+}
+
+// queue scans the target in the background, unless it is already queued. Targets are dropped
+// while the queue is full.
+func (s *Scanner) queue(t target) {
+	s.startOnce.Do(func() {
+		for range s.concurrency {
+			go s.work()
+		}
+	})
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if _, ok := s.queued[t.key]; ok {
+		return
+	}
+	select {
+	case s.pending <- t:
+		s.queued[t.key] = struct{}{}
+	default:
+	}
+}
+
+// work scans the queued targets. Failures are remembered so that the targets are not queued
+// again before failureRetryInterval.
+func (s *Scanner) work() {
+	ctx := context.Background()
+	for t := range s.pending {
+		if _, err := s.scan(ctx, t); err != nil {
+			slog.WarnContext(ctx, "Failed to scan file", "path", t.path, "error", err)
+			s.failures.Add(t.key, time.Now())
+		}
+		s.mut.Lock()
+		delete(s.queued, t.key)
+		s.mut.Unlock()
+	}
+}
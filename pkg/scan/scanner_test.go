@@ -0,0 +1,209 @@
+package scan
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matrixhub-ai/hfd/pkg/lfs"
+	"github.com/matrixhub-ai/hfd/pkg/receive"
+	"github.com/matrixhub-ai/hfd/pkg/repository"
+	"github.com/matrixhub-ai/hfd/pkg/storage"
+)
+
+func git(t *testing.T, dir string, input string, args ...string) string {
+	t.Helper()
+	cmd := exec.CommandContext(t.Context(), "git", args...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(input)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("git %s failed: %v", strings.Join(args, " "), err)
+	}
+	return string(out)
+}
+
+// putLFS stores content in s, returning its pointer file.
+func putLFS(t *testing.T, s lfs.Storage, content string) string {
+	t.Helper()
+	sum := sha256.Sum256([]byte(content))
+	oid := hex.EncodeToString(sum[:])
+	if err := s.Put(oid, strings.NewReader(content), int64(len(content))); err != nil {
+		t.Fatalf("put LFS object: %v", err)
+	}
+	return lfs.NewPointer(oid, int64(len(content))).Encoded()
+}
+
+func TestScannerQuarantineHook(t *testing.T) {
+	repoDir := filepath.Join(t.TempDir(), "repo.git")
+	workDir := t.TempDir()
+	git(t, "", "", "init", "--bare", "--initial-branch=main", repoDir)
+	git(t, "", "", "init", "--initial-branch=main", workDir)
+	git(t, workDir, "", "config", "user.email", "test@test.com")
+	git(t, workDir, "", "config", "user.name", "Test User")
+
+	lfsStorage := lfs.NewLocal(t.TempDir())
+	s := NewScanner(WithLFSStorage(lfsStorage))
+	commit := func(files map[string]string) string {
+		t.Helper()
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(workDir, name), []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			git(t, workDir, "", "add", name)
+		}
+		git(t, workDir, "", "commit", "-m", "Update")
+		return strings.TrimSpace(git(t, workDir, "", "rev-parse", "HEAD"))
+	}
+	push := func(rev string) error {
+		t.Helper()
+		pack := git(t, workDir, rev+"\n", "pack-objects", "--stdout", "--revs")
+		line := fmt.Sprintf("%s %s refs/heads/main\x00report-status\n", receive.ZeroHash, rev)
+		input := fmt.Sprintf("%04x%s0000%s", len(line)+4, line, pack)
+		updates, replay := receive.ParseRefUpdates(strings.NewReader(input), repoDir)
+		q, err := receive.NewQuarantine(t.Context(), repoDir, replay, updates)
+		if err != nil {
+			t.Fatalf("NewQuarantine: %v", err)
+		}
+		defer q.Close()
+		return s.QuarantineHook(t.Context(), "user/model", q, updates)
+	}
+
+	safe := commit(map[string]string{
+		"config.json":       "{}",
+		"pytorch_model.bin": putLFS(t, lfsStorage, "\x80\x02ccollections\nOrderedDict\nq\x00)Rq\x01."),
+	})
+	if err := push(safe); err != nil {
+		t.Fatalf("expected safe files to be accepted, got %v", err)
+	}
+
+	unsafe := commit(map[string]string{
+		"model.pkl": "cos\nsystem\n(S'echo hi'\ntR.",
+		"model.pt":  putLFS(t, lfsStorage, "\x80\x04\x8c\x05posix\x94\x8c\x06system\x94\x93."),
+	})
+	err := push(unsafe)
+	if err == nil || !strings.Contains(err.Error(), "model.pkl (pickle imports dangerous global os.system)") ||
+		!strings.Contains(err.Error(), "model.pt (pickle imports dangerous global posix.system)") {
+		t.Fatalf("expected the unsafe files to be rejected, got %v", err)
+	}
+
+	// Files cannot be pushed before their LFS object is uploaded, as they could not be scanned
+	missing := commit(map[string]string{
+		"missing.bin": lfs.NewPointer(strings.Repeat("0", 64), 10).Encoded(),
+	})
+	if err := push(missing); !errors.Is(err, ErrUnscannedFiles) || !strings.Contains(err.Error(), "missing.bin") {
+		t.Fatalf("expected the file without LFS object to be rejected, got %v", err)
+	}
+}
+
+func TestScannerFiles(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewStorage(storage.WithRootDir(t.TempDir()))
+	lfsStorage := lfs.NewLocal(store.LFSDir())
+	repoName := "user/model"
+	repo, err := repository.Init(ctx, store.ResolvePath(repoName), "main")
+	if err != nil {
+		t.Fatalf("init repository: %v", err)
+	}
+	head, err := repo.CreateCommit(ctx, "main", "add model", "test", "test@example.com", []repository.CommitOperation{
+		{Type: repository.CommitOperationAdd, Path: "README.md", Content: []byte("# Model\n")},
+		{Type: repository.CommitOperationAdd, Path: "model.ckpt", Content: []byte(putLFS(t, lfsStorage, "\x80\x02c__main__\nModel\nq\x00."))},
+	}, "")
+	if err != nil {
+		t.Fatalf("create commit: %v", err)
+	}
+
+	resultsDir := t.TempDir()
+	s := NewScanner(WithStorage(store), WithLFSStorage(lfsStorage), WithResultsDir(resultsDir))
+	err = s.PostReceiveHook(ctx, repoName, []receive.RefUpdate{
+		receive.NewRefUpdate(receive.ZeroHash, head, "refs/heads/main", repo.RepoPath()),
+	})
+	if err != nil {
+		t.Fatalf("post-receive hook: %v", err)
+	}
+
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		files, err := s.Files(ctx, repo, "main")
+		if err != nil {
+			t.Fatalf("Files: %v", err)
+		}
+		if len(files) != 2 {
+			t.Fatalf("expected 2 files, got %+v", files)
+		}
+		if files[0].Result.Status != StatusQueued && files[1].Result.Status != StatusQueued {
+			if files[0].Path != "README.md" || files[0].Result.Status != StatusSafe {
+				t.Errorf("expected a safe README.md, got %s %+v", files[0].Path, files[0].Result)
+			}
+			ckpt := files[1].Result
+			if files[1].Path != "model.ckpt" || ckpt.Status != StatusCaution || ckpt.PickleImportScan == nil ||
+				ckpt.PickleImportScan.HighestSafetyLevel != SafetySuspicious {
+				t.Errorf("expected model.ckpt to need caution, got %s %+v", files[1].Path, ckpt)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("files were not scanned, got %+v", files)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Results outlive the scanner
+	files, err := NewScanner(WithLFSStorage(lfsStorage), WithResultsDir(resultsDir)).Files(ctx, repo, "main")
+	if err != nil {
+		t.Fatalf("Files: %v", err)
+	}
+	if len(files) != 2 || files[0].Result.Status != StatusSafe || files[1].Result.Status != StatusCaution {
+		t.Errorf("expected the stored results, got %+v", files)
+	}
+
+	// Files that fail to be scanned are not queued again right away
+	_, err = repo.CreateCommit(ctx, "main", "add weights", "test", "test@example.com", []repository.CommitOperation{
+		{Type: repository.CommitOperationAdd, Path: "missing.bin", Content: []byte(lfs.NewPointer(strings.Repeat("0", 64), 10).Encoded())},
+	}, "")
+	if err != nil {
+		t.Fatalf("create commit: %v", err)
+	}
+	blob, err := repo.Blob("main", "missing.bin")
+	if err != nil {
+		t.Fatalf("Blob: %v", err)
+	}
+	key := cacheKey(strings.Repeat("0", 64), "missing.bin")
+	for {
+		if result := s.File(ctx, "missing.bin", blob); result.Status != StatusQueued {
+			t.Fatalf("expected missing.bin to stay queued, got %+v", result)
+		}
+		if _, ok := s.failures.Get(key); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("missing.bin was not scanned")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Wait for the worker to be done with the file
+	for {
+		s.mut.Lock()
+		_, queued := s.queued[key]
+		s.mut.Unlock()
+		if !queued {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.File(ctx, "missing.bin", blob)
+	s.mut.Lock()
+	_, queued := s.queued[key]
+	s.mut.Unlock()
+	if queued {
+		t.Errorf("expected missing.bin not to be queued again after failing")
+	}
+}
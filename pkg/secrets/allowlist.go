@@ -0,0 +1,111 @@
+package secrets
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Allowlist holds the findings not to report, such as test fixtures and example keys.
+// Each line of an allowlist file is an entry, blank lines and lines starting with # being ignored:
+//
+//	fingerprint:<sha256>  a secret, by the fingerprint reported with its findings
+//	regex:<expression>    the secrets matching a regular expression
+//	rule:<id>             the secrets of a kind, such as aws-access-key-id
+//	path:<pattern>        the files matching a pattern, as path.Match, or under a directory ending with /
+//
+// As only the header of most private keys is matched, they are allowed by path rather than fingerprint.
+type Allowlist struct {
+	fingerprints map[string]struct{}
+	regexps      []*regexp.Regexp
+	rules        map[string]struct{}
+	paths        []string
+}
+
+// ParseAllowlist parses the entries of an allowlist read from r.
+func ParseAllowlist(r io.Reader) (*Allowlist, error) {
+	a := &Allowlist{
+		fingerprints: map[string]struct{}{},
+		rules:        map[string]struct{}{},
+	}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kind, value, ok := strings.Cut(line, ":")
+		value = strings.TrimSpace(value)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid allowlist entry on line %d: %q", n, line)
+		}
+		switch kind {
+		case "fingerprint":
+			a.fingerprints[strings.ToLower(value)] = struct{}{}
+		case "regex":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex on line %d: %w", n, err)
+			}
+			a.regexps = append(a.regexps, re)
+		case "rule":
+			a.rules[value] = struct{}{}
+		case "path":
+			if _, err := path.Match(value, ""); err != nil {
+				return nil, fmt.Errorf("invalid path pattern on line %d: %w", n, err)
+			}
+			a.paths = append(a.paths, value)
+		default:
+			return nil, fmt.Errorf("unknown allowlist entry %q on line %d", kind, n)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// LoadAllowlist reads an allowlist file.
+func LoadAllowlist(name string) (*Allowlist, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret allowlist: %w", err)
+	}
+	defer f.Close()
+	a, err := ParseAllowlist(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse secret allowlist %s: %w", name, err)
+	}
+	return a, nil
+}
+
+// allows reports whether the secret of a finding, whose unmasked value is secret, is not to be reported.
+func (a *Allowlist) allows(f Finding, secret string) bool {
+	if a == nil {
+		return false
+	}
+	if _, ok := a.fingerprints[f.Fingerprint]; ok {
+		return true
+	}
+	if _, ok := a.rules[f.Rule]; ok {
+		return true
+	}
+	for _, re := range a.regexps {
+		if re.MatchString(secret) {
+			return true
+		}
+	}
+	for _, pattern := range a.paths {
+		if strings.HasSuffix(pattern, "/") && strings.HasPrefix(f.Path, pattern) {
+			return true
+		}
+		if ok, _ := path.Match(pattern, f.Path); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,262 @@
+package secrets
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/matrixhub-ai/hfd/pkg/authenticate"
+	"github.com/matrixhub-ai/hfd/pkg/receive"
+)
+
+// Policy is what is done with the pushes and commits adding secrets.
+type Policy string
+
+const (
+	// PolicyWarn accepts the content, warning the client about its secrets.
+	PolicyWarn Policy = "warn"
+	// PolicyReject rejects the content.
+	PolicyReject Policy = "reject"
+)
+
+// ParsePolicy parses the name of a policy.
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case PolicyWarn, PolicyReject:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown secret scanning policy %q", s)
+}
+
+// ErrSecretsFound is returned when content adding secrets is rejected.
+var ErrSecretsFound = errors.New("secrets found")
+
+// AuditEvent is the record of a finding in the audit log, one JSON object per line.
+type AuditEvent struct {
+	Time   time.Time `json:"time"`
+	Repo   string    `json:"repo"`
+	Ref    string    `json:"ref"`
+	User   string    `json:"user,omitempty"`
+	Action string    `json:"action"`
+	Finding
+}
+
+// Scanner finds secrets in the content added to repositories, by pushes and commits,
+// and warns about them or rejects the content as its policy says.
+type Scanner struct {
+	policy    Policy
+	allowlist *Allowlist
+
+	mut      sync.Mutex
+	auditLog io.Writer
+}
+
+// Option defines a functional option for configuring the Scanner.
+type Option func(*Scanner)
+
+// WithPolicy sets what is done with the content adding secrets; it defaults to PolicyWarn.
+func WithPolicy(p Policy) Option {
+	return func(s *Scanner) {
+		s.policy = p
+	}
+}
+
+// WithAllowlist sets the findings not to report.
+func WithAllowlist(a *Allowlist) Option {
+	return func(s *Scanner) {
+		s.allowlist = a
+	}
+}
+
+// WithAuditLog sets the writer the findings are recorded to, as AuditEvent JSON lines.
+func WithAuditLog(w io.Writer) Option {
+	return func(s *Scanner) {
+		s.auditLog = w
+	}
+}
+
+// NewScanner creates a new Scanner with the provided options.
+func NewScanner(opts ...Option) *Scanner {
+	s := &Scanner{
+		policy: PolicyWarn,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// File returns the secrets found in the content of a file read from r. Binary files are not scanned.
+func (s *Scanner) File(name string, r io.Reader) ([]Finding, error) {
+	return scanFile(name, r, s.allowlist)
+}
+
+// Report records the secrets found in the content added to ref of a repository and warns the client about them.
+// It returns an error wrapping ErrSecretsFound when the policy rejects the content.
+func (s *Scanner) Report(ctx context.Context, repoName string, ref string, findings []Finding) error {
+	s.record(ctx, repoName, ref, findings)
+	return s.verdict(findings)
+}
+
+// QuarantineHook finds secrets in the lines the new commits of a push add, reporting them as Report does.
+// It is a receive.QuarantineHookFunc.
+func (s *Scanner) QuarantineHook(ctx context.Context, repoName string, q *receive.Quarantine, updates []receive.RefUpdate) error {
+	var all []Finding
+	// Commits reachable from several of the updated refs are scanned with the first one only
+	var scanned []string
+	for _, u := range updates {
+		if u.IsDelete() {
+			continue
+		}
+		args := []string{
+			"-c", "core.quotePath=false",
+			"log", "-p", "-U0", "--no-color", "--no-ext-diff", "--no-textconv", "--format=%x00%H",
+			u.NewRev(), "--not", "--all",
+		}
+		cmd := q.Command(ctx, append(args, scanned...)...)
+		scanned = append(scanned, u.NewRev())
+
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("failed to list new changes of %s: %w", u.RefName(), err)
+		}
+		findings, err := scanDiff(stdout, s.allowlist)
+		if err != nil {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+			return fmt.Errorf("failed to scan new changes of %s: %w", u.RefName(), err)
+		}
+		if err := cmd.Wait(); err != nil {
+			return fmt.Errorf("failed to list new changes of %s: %w", u.RefName(), err)
+		}
+		s.record(ctx, repoName, u.RefName(), findings)
+		all = append(all, findings...)
+	}
+	return s.verdict(all)
+}
+
+// record logs the findings, sends them to the client and writes them to the audit log.
+func (s *Scanner) record(ctx context.Context, repoName string, ref string, findings []Finding) {
+	action, level := "warned", "warning"
+	if s.policy == PolicyReject {
+		action, level = "rejected", "error"
+	}
+	user, _ := authenticate.GetUserInfo(ctx)
+	for _, f := range findings {
+		slog.WarnContext(ctx, "Secret found", "repo", repoName, "ref", ref, "user", user.User, "action", action,
+			"commit", f.Commit, "path", f.Path, "line", f.Line, "rule", f.Rule, "fingerprint", f.Fingerprint)
+		receive.SendMessage(ctx, "%s: secret found in %s", level, f)
+		s.audit(AuditEvent{
+			Time:    time.Now().UTC(),
+			Repo:    repoName,
+			Ref:     ref,
+			User:    user.User,
+			Action:  action,
+			Finding: f,
+		})
+	}
+}
+
+// verdict returns an error wrapping ErrSecretsFound which lists the findings when the policy rejects them.
+func (s *Scanner) verdict(findings []Finding) error {
+	if s.policy != PolicyReject || len(findings) == 0 {
+		return nil
+	}
+	locations := make([]string, 0, len(findings))
+	for _, f := range findings {
+		locations = append(locations, fmt.Sprintf("%s:%d (%s)", f.Path, f.Line, f.Description))
+	}
+	return fmt.Errorf("%w: %s", ErrSecretsFound, strings.Join(locations, "; "))
+}
+
+func (s *Scanner) audit(e AuditEvent) {
+	if s.auditLog == nil {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if _, err := s.auditLog.Write(append(data, '\n')); err != nil {
+		slog.Warn("Failed to write secret audit log", "error", err)
+	}
+}
+
+// scanDiff returns the secrets found in the lines added by the patches of the commits of a git log,
+// as printed with -p and a format of a NUL byte followed by the commit hash.
+func scanDiff(r io.Reader, allowlist *Allowlist) ([]Finding, error) {
+	br := bufio.NewReader(r)
+	var findings []Finding
+	var commit, path string
+	var header bool
+	var n int
+	for {
+		line, err := readLine(br)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "\x00"):
+			commit, path, header = line[1:], "", false
+		case strings.HasPrefix(line, "diff --git "):
+			path, header = "", true
+		case header && strings.HasPrefix(line, "+++ "):
+			path = diffPath(line[4:])
+		case strings.HasPrefix(line, "@@ "):
+			header = false
+			n = hunkStart(line)
+		case !header && path != "" && strings.HasPrefix(line, "+"):
+			for _, f := range scanLine(path, n, line[1:], allowlist) {
+				f.Commit = commit
+				findings = append(findings, f)
+			}
+			n++
+		case !header && strings.HasPrefix(line, " "):
+			n++
+		}
+		if err == io.EOF {
+			return findings, nil
+		}
+	}
+}
+
+// diffPath returns the path of the new file of a patch, from its "+++" header, or "" for a deleted file.
+func diffPath(name string) string {
+	// Names with spaces are followed by a tab
+	name = strings.TrimSuffix(name, "\t")
+	if strings.HasPrefix(name, `"`) {
+		if unquoted, err := strconv.Unquote(name); err == nil {
+			name = unquoted
+		}
+	}
+	name, ok := strings.CutPrefix(name, "b/")
+	if !ok {
+		return ""
+	}
+	return name
+}
+
+// hunkStart returns the number of the first line of the new file in a hunk, from its "@@ -a,b +c,d @@" header.
+func hunkStart(line string) int {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return 0
+	}
+	start, _, _ := strings.Cut(strings.TrimPrefix(fields[2], "+"), ",")
+	n, _ := strconv.Atoi(start)
+	return n
+}
@@ -0,0 +1,119 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matrixhub-ai/hfd/pkg/receive"
+)
+
+func git(t *testing.T, dir string, input string, args ...string) string {
+	t.Helper()
+	cmd := exec.CommandContext(t.Context(), "git", args...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(input)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("git %s failed: %v", strings.Join(args, " "), err)
+	}
+	return string(out)
+}
+
+func TestScannerQuarantineHook(t *testing.T) {
+	repoDir := filepath.Join(t.TempDir(), "repo.git")
+	workDir := t.TempDir()
+	git(t, "", "", "init", "--bare", "--initial-branch=main", repoDir)
+	git(t, "", "", "init", "--initial-branch=main", workDir)
+	git(t, workDir, "", "config", "user.email", "test@test.com")
+	git(t, workDir, "", "config", "user.name", "Test User")
+
+	commit := func(files map[string]string) string {
+		t.Helper()
+		for name, content := range files {
+			if err := os.MkdirAll(filepath.Dir(filepath.Join(workDir, name)), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(workDir, name), []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			git(t, workDir, "", "add", name)
+		}
+		git(t, workDir, "", "commit", "-m", "Update")
+		return strings.TrimSpace(git(t, workDir, "", "rev-parse", "HEAD"))
+	}
+	push := func(s *Scanner, old, rev string) ([]string, error) {
+		t.Helper()
+		revs := rev + "\n"
+		if old != receive.ZeroHash {
+			revs += "^" + old + "\n"
+		}
+		pack := git(t, workDir, revs, "pack-objects", "--stdout", "--revs")
+		line := fmt.Sprintf("%s %s refs/heads/main\x00report-status\n", old, rev)
+		input := fmt.Sprintf("%04x%s0000%s", len(line)+4, line, pack)
+		updates, replay := receive.ParseRefUpdates(strings.NewReader(input), repoDir)
+		q, err := receive.NewQuarantine(t.Context(), repoDir, replay, updates)
+		if err != nil {
+			t.Fatalf("NewQuarantine: %v", err)
+		}
+		defer q.Close()
+		ctx, messages := receive.WithMessages(t.Context())
+		err = s.QuarantineHook(ctx, "user/model", q, updates)
+		return messages.Lines(), err
+	}
+
+	allowlist, err := ParseAllowlist(strings.NewReader("path:tests/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var auditLog bytes.Buffer
+	warn := NewScanner(WithAllowlist(allowlist), WithAuditLog(&auditLog))
+	reject := NewScanner(WithPolicy(PolicyReject), WithAllowlist(allowlist))
+
+	first := commit(map[string]string{
+		"train.py":          "import os\nlogin(token=\"" + hfToken + "\")\n",
+		"tests/fixtures.py": "TOKEN = \"" + hfToken + "\"\n",
+	})
+	messages, err := push(warn, receive.ZeroHash, first)
+	if err != nil {
+		t.Fatalf("expected the push to be accepted with a warning, got %v", err)
+	}
+	if len(messages) != 1 || !strings.HasPrefix(messages[0], "warning: secret found in "+first[:12]+" train.py:2: Hugging Face access token hf_A****") {
+		t.Errorf("expected a warning about train.py, got %q", messages)
+	}
+	var event AuditEvent
+	if err := json.Unmarshal(auditLog.Bytes(), &event); err != nil {
+		t.Fatalf("expected one audit event, got %q: %v", auditLog.String(), err)
+	}
+	if event.Repo != "user/model" || event.Ref != "refs/heads/main" || event.Action != "warned" ||
+		event.Commit != first || event.Path != "train.py" || event.Rule != "huggingface-access-token" {
+		t.Errorf("unexpected audit event %+v", event)
+	}
+	if strings.Contains(auditLog.String(), hfToken) {
+		t.Errorf("expected the secret not to be written to the audit log")
+	}
+
+	_, err = push(reject, receive.ZeroHash, first)
+	if !errors.Is(err, ErrSecretsFound) || !strings.Contains(err.Error(), "train.py:2 (Hugging Face access token)") {
+		t.Fatalf("expected the push to be rejected, got %v", err)
+	}
+
+	// Once stored, the secrets of the repository are not reported again, nor are the lines removing them
+	git(t, workDir, "", "push", repoDir, "main")
+	second := commit(map[string]string{"train.py": "import os\nlogin()\n"})
+	if _, err := push(reject, first, second); err != nil {
+		t.Fatalf("expected the push to be accepted, got %v", err)
+	}
+
+	third := commit(map[string]string{"data/config.ini": "[default]\n\naws_access_key_id = " + awsKeyID + "\n"})
+	_, err = push(reject, first, third)
+	if err == nil || !strings.Contains(err.Error(), "data/config.ini:3 (AWS access key ID)") || strings.Contains(err.Error(), "train.py") {
+		t.Fatalf("expected the push to be rejected for data/config.ini only, got %v", err)
+	}
+}
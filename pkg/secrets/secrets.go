@@ -0,0 +1,181 @@
+// Package secrets finds credentials, such as access tokens and private keys, in the content pushed to repositories.
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// allowMarker marks a line whose secrets are not reported, such as an example in documentation.
+const allowMarker = "hfd:allow-secret"
+
+// binaryPeekSize is the size of the start of a file looked at for a NUL byte to tell it is binary, as git does.
+const binaryPeekSize = 8000
+
+// maxLineSize bounds the part of a line that is scanned, so that a file without line breaks is not read in memory.
+const maxLineSize = 1 << 20
+
+// rule is a kind of secret, found with a regular expression. When the expression has a group,
+// the secret is the text of its first group rather than the whole match.
+type rule struct {
+	id          string
+	description string
+	re          *regexp.Regexp
+}
+
+var rules = []rule{
+	{
+		id:          "huggingface-access-token",
+		description: "Hugging Face access token",
+		re:          regexp.MustCompile(`\bhf_[A-Za-z0-9]{34}\b`),
+	},
+	{
+		id:          "huggingface-organization-api-token",
+		description: "Hugging Face organization API token",
+		re:          regexp.MustCompile(`\bapi_org_[A-Za-z0-9]{34}\b`),
+	},
+	{
+		id:          "aws-access-key-id",
+		description: "AWS access key ID",
+		re:          regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA)[A-Z0-9]{16}\b`),
+	},
+	{
+		id:          "aws-secret-access-key",
+		description: "AWS secret access key",
+		re:          regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]+\s*["']?([A-Za-z0-9/+]{40})(?:[^A-Za-z0-9/+]|$)`),
+	},
+	{
+		// The header alone, as found in code handling keys, is not a key
+		id:          "private-key",
+		description: "Private key",
+		re:          regexp.MustCompile(`-----BEGIN[ A-Z0-9]*PRIVATE KEY(?: BLOCK)?-----(?:\s*$|(?:\\r)?\\n[A-Za-z0-9+/=]{16,}|\s+[A-Za-z0-9+/=]{16,})`),
+	},
+	{
+		id:          "github-token",
+		description: "GitHub token",
+		re:          regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36}\b`),
+	},
+	{
+		id:          "slack-token",
+		description: "Slack token",
+		re:          regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`),
+	},
+	{
+		id:          "google-api-key",
+		description: "Google API key",
+		re:          regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}`),
+	},
+}
+
+// Finding is a secret found in a file.
+type Finding struct {
+	Rule        string `json:"rule"`
+	Description string `json:"description"`
+	Path        string `json:"path"`
+	Line        int    `json:"line"`
+	Commit      string `json:"commit,omitempty"`
+	// Secret is the secret with most of it masked.
+	Secret string `json:"secret"`
+	// Fingerprint is the SHA-256 of the secret, which allowlists refer to it by.
+	Fingerprint string `json:"fingerprint"`
+}
+
+// String returns the location and kind of the secret, as reported to users.
+func (f Finding) String() string {
+	s := fmt.Sprintf("%s:%d: %s %s (fingerprint:%s)", f.Path, f.Line, f.Description, f.Secret, f.Fingerprint)
+	if f.Commit != "" {
+		s = f.Commit[:min(len(f.Commit), 12)] + " " + s
+	}
+	return s
+}
+
+// scanLine returns the secrets found in a line of a file, but those of the allowlist.
+func scanLine(path string, n int, line string, allowlist *Allowlist) []Finding {
+	if strings.Contains(line, allowMarker) {
+		return nil
+	}
+	var findings []Finding
+	for _, r := range rules {
+		for _, m := range r.re.FindAllStringSubmatchIndex(line, -1) {
+			secret := line[m[0]:m[1]]
+			if len(m) > 2 && m[2] >= 0 {
+				secret = line[m[2]:m[3]]
+			}
+			secret = strings.TrimSpace(secret)
+			sum := sha256.Sum256([]byte(secret))
+			f := Finding{
+				Rule:        r.id,
+				Description: r.description,
+				Path:        path,
+				Line:        n,
+				Secret:      redact(secret),
+				Fingerprint: hex.EncodeToString(sum[:]),
+			}
+			if !allowlist.allows(f, secret) {
+				findings = append(findings, f)
+			}
+		}
+	}
+	return findings
+}
+
+// scanFile returns the secrets found in the content of a file read from r, but those of the allowlist.
+// Binary files are not scanned.
+func scanFile(path string, r io.Reader, allowlist *Allowlist) ([]Finding, error) {
+	br := bufio.NewReaderSize(r, binaryPeekSize)
+	head, err := br.Peek(binaryPeekSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return nil, nil
+	}
+
+	var findings []Finding
+	for n := 1; ; n++ {
+		line, err := readLine(br)
+		if line != "" {
+			findings = append(findings, scanLine(path, n, strings.TrimSuffix(line, "\n"), allowlist)...)
+		}
+		if err == io.EOF {
+			return findings, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readLine reads a line of br, including its line break, of which only the first maxLineSize bytes are returned.
+func readLine(br *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if len(line) < maxLineSize {
+			line = append(line, chunk[:min(len(chunk), maxLineSize-len(line))]...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		return string(line), err
+	}
+}
+
+// redact masks all but the first characters of a secret, or the header of a private key.
+func redact(secret string) string {
+	if strings.HasPrefix(secret, "-----BEGIN") {
+		if i := strings.Index(secret[5:], "-----"); i >= 0 {
+			return secret[:i+10] + "****"
+		}
+	}
+	if len(secret) <= 8 {
+		return "****"
+	}
+	return secret[:4] + "****"
+}
@@ -0,0 +1,147 @@
+package secrets
+
+import (
+	"strings"
+	"testing"
+)
+
+// The secrets of the tests are assembled from parts, so that the tests are not taken for leaks themselves.
+var (
+	hfToken      = "hf_" + "AbCdEfGhIjKlMnOpQrStUvWxYz01234567"
+	awsKeyID     = "AKIA" + "Z7Q3XK2M4N5P6R8T"
+	awsSecret    = "wJalrXUtnFEMI/K7MDENG/" + "bPxRfiCYEXAMPLEKEY"
+	githubToken  = "ghp_" + "0123456789abcdefghijABCDEFGHIJ012345"
+	privateKey   = "-----BEGIN RSA " + "PRIVATE KEY-----"
+	keyMaterial  = "MIIEowIBAAKCAQEAu1SU1LfVLPHCozMxH2Mo4lgOEePzNm0tRgeLezV6ffAt0gun"
+	googleAPIKey = "AIza" + "SyA1b2C3d4E5f6G7h8I9j0K1l2M3n4O5p6Q"
+)
+
+func TestScanFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		rules   []string
+		lines   []int
+	}{
+		{
+			name:    "Hugging Face token",
+			content: "from huggingface_hub import login\nlogin(token=\"" + hfToken + "\")\n",
+			rules:   []string{"huggingface-access-token"},
+			lines:   []int{2},
+		},
+		{
+			name:    "AWS credentials",
+			content: "[default]\naws_access_key_id = " + awsKeyID + "\naws_secret_access_key = " + awsSecret + "\n",
+			rules:   []string{"aws-access-key-id", "aws-secret-access-key"},
+			lines:   []int{2, 3},
+		},
+		{
+			name:    "private key",
+			content: privateKey + "\n" + keyMaterial + "\n-----END RSA PRIVATE KEY-----",
+			rules:   []string{"private-key"},
+			lines:   []int{1},
+		},
+		{
+			name:    "escaped private key",
+			content: `{"key": "` + privateKey + `\n` + keyMaterial + `"}`,
+			rules:   []string{"private-key"},
+			lines:   []int{1},
+		},
+		{
+			name:    "private key header in code",
+			content: "if bytes.Contains(data, []byte(\"" + privateKey + "\")) {\n",
+		},
+		{
+			name:    "several secrets on a line",
+			content: "GITHUB_TOKEN=" + githubToken + " GOOGLE_API_KEY=" + googleAPIKey,
+			rules:   []string{"github-token", "google-api-key"},
+			lines:   []int{1, 1},
+		},
+		{
+			name:    "allowed inline",
+			content: "token = \"" + hfToken + "\"  # hfd:allow-secret\n",
+		},
+		{
+			name:    "token too short",
+			content: "hf_abc\n",
+		},
+		{
+			name:    "binary",
+			content: "\x00\x01" + hfToken,
+		},
+		{
+			name:    "after a long line",
+			content: strings.Repeat("a", 2*maxLineSize) + " " + githubToken + "\ntoken = \"" + hfToken + "\"\n",
+			rules:   []string{"huggingface-access-token"},
+			lines:   []int{2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings, err := scanFile("file", strings.NewReader(tt.content), nil)
+			if err != nil {
+				t.Fatalf("scanFile: %v", err)
+			}
+			if len(findings) != len(tt.rules) {
+				t.Fatalf("expected %d findings, got %+v", len(tt.rules), findings)
+			}
+			for i, f := range findings {
+				if f.Rule != tt.rules[i] || f.Line != tt.lines[i] {
+					t.Errorf("expected %s on line %d, got %+v", tt.rules[i], tt.lines[i], f)
+				}
+				if len(f.Fingerprint) != 64 || !strings.HasSuffix(f.Secret, "****") {
+					t.Errorf("expected the secret to be masked, got %+v", f)
+				}
+			}
+		})
+	}
+}
+
+func TestAllowlist(t *testing.T) {
+	content := "aws_access_key_id = " + awsKeyID + "\n" +
+		"token = " + hfToken + "\n" +
+		"GITHUB_TOKEN=" + githubToken + "\n"
+	findings, err := scanFile("config.ini", strings.NewReader(content), nil)
+	if err != nil || len(findings) != 3 {
+		t.Fatalf("expected 3 findings, got %+v, %v", findings, err)
+	}
+
+	tests := []struct {
+		name      string
+		allowlist string
+		path      string
+		rules     []string
+	}{
+		{name: "fingerprint", allowlist: "# example token\nfingerprint:" + findings[1].Fingerprint, path: "config.ini", rules: []string{"aws-access-key-id", "github-token"}},
+		{name: "regex", allowlist: "regex:^AKIA", path: "config.ini", rules: []string{"huggingface-access-token", "github-token"}},
+		{name: "rule", allowlist: "rule:github-token", path: "config.ini", rules: []string{"aws-access-key-id", "huggingface-access-token"}},
+		{name: "path pattern", allowlist: "path:*.ini", path: "config.ini"},
+		{name: "directory", allowlist: "path:tests/fixtures/", path: "tests/fixtures/config.ini"},
+		{name: "other path", allowlist: "path:tests/fixtures/", path: "config.ini", rules: []string{"aws-access-key-id", "huggingface-access-token", "github-token"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := ParseAllowlist(strings.NewReader(tt.allowlist))
+			if err != nil {
+				t.Fatalf("ParseAllowlist: %v", err)
+			}
+			findings, err := scanFile(tt.path, strings.NewReader(content), a)
+			if err != nil {
+				t.Fatalf("scanFile: %v", err)
+			}
+			var rules []string
+			for _, f := range findings {
+				rules = append(rules, f.Rule)
+			}
+			if strings.Join(rules, ",") != strings.Join(tt.rules, ",") {
+				t.Errorf("expected findings %v, got %v", tt.rules, rules)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"AKIA", "regex:(", "path:[", "user:admin"} {
+		if _, err := ParseAllowlist(strings.NewReader(invalid)); err == nil {
+			t.Errorf("expected allowlist %q to be invalid", invalid)
+		}
+	}
+}
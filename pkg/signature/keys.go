@@ -0,0 +1,67 @@
+package signature
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"golang.org/x/crypto/ssh"
+)
+
+const openPGPPublicKeyBegin = "-----BEGIN PGP PUBLIC KEY BLOCK-----"
+
+// LoadAllowedSigners trusts the SSH keys of an allowed signers file, in the format of
+// git's gpg.ssh.allowedSignersFile: one key per line, preceded by the comma separated principals it belongs to.
+// The key only verifies the objects of a committer or tagger matching one of the principals,
+// and the first principal is the identity of the key.
+func (v *Verifier) LoadAllowedSigners(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read allowed signers: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		principals, key, ok := strings.Cut(line, " ")
+		if !ok {
+			return fmt.Errorf("invalid allowed signer at %s:%d", path, n)
+		}
+		// The key may be preceded by options, such as namespaces="git", as in an authorized keys file.
+		pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(key)))
+		if err != nil {
+			return fmt.Errorf("invalid allowed signer at %s:%d: %w", path, n, err)
+		}
+		v.TrustSSHKey(pub, strings.Split(principals, ",")...)
+	}
+	return scanner.Err()
+}
+
+// LoadKeyring trusts the OpenPGP public keys of a file holding one or more armored key blocks.
+func (v *Verifier) LoadKeyring(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read keyring: %w", err)
+	}
+
+	var keys openpgp.EntityList
+	blocks := strings.Split(string(data), openPGPPublicKeyBegin)
+	for _, block := range blocks[1:] {
+		entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(openPGPPublicKeyBegin + block))
+		if err != nil {
+			return fmt.Errorf("failed to parse keyring %s: %w", path, err)
+		}
+		keys = append(keys, entities...)
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no OpenPGP public key found in %s", path)
+	}
+	v.TrustOpenPGPKeys(keys)
+	return nil
+}
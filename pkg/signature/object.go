@@ -0,0 +1,90 @@
+package signature
+
+import (
+	"bytes"
+)
+
+// signatureHeaders are the commit headers git stores signatures in.
+var signatureHeaders = [][]byte{[]byte("gpgsig "), []byte("gpgsig-sha256 ")}
+
+// SplitCommit splits the raw content of a commit object into the payload its signature is made over
+// and the armored signature, which is empty if the commit is not signed.
+func SplitCommit(raw []byte) (payload []byte, sig string) {
+	headerEnd := bytes.Index(raw, []byte("\n\n")) + 1
+	if headerEnd == 0 {
+		headerEnd = len(raw)
+	}
+
+	payload = make([]byte, 0, len(raw))
+	var signature []byte
+	inSignature := false
+	for rest := raw[:headerEnd]; len(rest) > 0; {
+		line := rest
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			line = rest[:i+1]
+		}
+		rest = rest[len(line):]
+
+		if inSignature && bytes.HasPrefix(line, []byte(" ")) {
+			signature = append(signature, line[1:]...)
+			continue
+		}
+		inSignature = false
+		if signature == nil {
+			for _, header := range signatureHeaders {
+				if bytes.HasPrefix(line, header) {
+					signature = append([]byte{}, line[len(header):]...)
+					inSignature = true
+					break
+				}
+			}
+			if inSignature {
+				continue
+			}
+		}
+		payload = append(payload, line...)
+	}
+	payload = append(payload, raw[headerEnd:]...)
+	if len(signature) > 0 && signature[len(signature)-1] != '\n' {
+		signature = append(signature, '\n')
+	}
+	return payload, string(signature)
+}
+
+// SplitTag splits the raw content of a tag object into the payload its signature is made over
+// and the armored signature, which git appends to the message of the tag.
+// The signature is empty if the tag is not signed.
+func SplitTag(raw []byte) (payload []byte, sig string) {
+	start := -1
+	for _, begin := range []string{sshSignatureBegin, openPGPSignatureBegin, openPGPMessageBegin, x509SignatureBegin} {
+		if i := bytes.LastIndex(raw, []byte("\n"+begin)); i > start {
+			start = i
+		}
+	}
+	if start < 0 {
+		return raw, ""
+	}
+	return raw[:start+1], string(raw[start+1:])
+}
+
+// headerEmail returns the email of the identity in the given header of a commit or tag object,
+// such as "committer" or "tagger", or "" if the object has none.
+func headerEmail(raw []byte, header string) string {
+	headers, _, _ := bytes.Cut(raw, []byte("\n\n"))
+	prefix := []byte(header + " ")
+	for line := range bytes.SplitSeq(headers, []byte("\n")) {
+		if !bytes.HasPrefix(line, prefix) {
+			continue
+		}
+		_, rest, ok := bytes.Cut(line, []byte("<"))
+		if !ok {
+			return ""
+		}
+		email, _, ok := bytes.Cut(rest, []byte(">"))
+		if !ok {
+			return ""
+		}
+		return string(email)
+	}
+	return ""
+}
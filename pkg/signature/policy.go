@@ -0,0 +1,134 @@
+package signature
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/matrixhub-ai/hfd/pkg/receive"
+)
+
+// Policy verifies the signatures of the commits and tags pushed to a repository,
+// and rejects pushes to protected refs bringing commits or tags that are not verified.
+type Policy struct {
+	verifier      *Verifier
+	protectedRefs []string
+}
+
+// PolicyOption defines a functional option for configuring the Policy.
+type PolicyOption func(*Policy)
+
+// WithProtectedRefs sets the patterns of the refs only verified commits and tags can be pushed to,
+// matched with path.Match, such as "refs/heads/main" or "refs/tags/*".
+func WithProtectedRefs(patterns ...string) PolicyOption {
+	return func(p *Policy) {
+		p.protectedRefs = append(p.protectedRefs, patterns...)
+	}
+}
+
+// NewPolicy creates a Policy verifying signatures with verifier.
+func NewPolicy(verifier *Verifier, opts ...PolicyOption) *Policy {
+	p := &Policy{
+		verifier: verifier,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// IsProtected reports whether only verified commits and tags can be pushed to ref.
+func (p *Policy) IsProtected(ref string) bool {
+	for _, pattern := range p.protectedRefs {
+		if ok, _ := path.Match(pattern, ref); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Check verifies the new commits and tags reachable from the refs of a push.
+// It is a receive.QuarantineHookFunc. Protected refs only accept verified commits and tags:
+// all those a ref update brings to the ref are verified, including the ones already pushed to other refs.
+// The new objects of the other refs are verified too, so that their results are cached.
+func (p *Policy) Check(ctx context.Context, repoName string, q *receive.Quarantine, updates []receive.RefUpdate) error {
+	var rejected []string
+	var protectedRevs []string
+	for _, u := range updates {
+		if u.IsDelete() {
+			continue
+		}
+
+		protected := p.IsProtected(u.RefName())
+		var commits []string
+		var err error
+		switch {
+		case !protected:
+			commits, err = q.NewCommits(ctx, u.NewRev())
+		case !u.IsCreate():
+			commits, err = q.Commits(ctx, u.NewRev(), u.OldRev())
+		default:
+			// A new protected ref only brings the commits that no protected ref has
+			if protectedRevs == nil {
+				protectedRevs, err = p.protectedRevs(ctx, q)
+				if err != nil {
+					return err
+				}
+			}
+			commits, err = q.Commits(ctx, u.NewRev(), protectedRevs...)
+		}
+		if err != nil {
+			return err
+		}
+
+		// The new value is a tag, or else a commit listed with the others when the update brings it
+		hashes := commits
+		brought := slices.Contains(commits, u.NewRev())
+		if !brought {
+			hashes = append([]string{u.NewRev()}, commits...)
+		}
+
+		err = q.ReadObjects(ctx, hashes, func(hash string, objectType string, content []byte) error {
+			var result Verification
+			switch objectType {
+			case "commit":
+				if hash == u.NewRev() && !brought {
+					return nil
+				}
+				result = p.verifier.VerifyCommit(hash, content)
+			case "tag":
+				result = p.verifier.VerifyTag(hash, content)
+			default:
+				return nil
+			}
+			if protected && !result.Verified {
+				rejected = append(rejected, fmt.Sprintf("%s %s %s: %s", u.RefName(), objectType, hash, result.Status))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(rejected) != 0 {
+		return fmt.Errorf("signature verification failed for protected refs:\n%s", strings.Join(rejected, "\n"))
+	}
+	return nil
+}
+
+// protectedRevs returns the current values of the protected refs of the repository.
+func (p *Policy) protectedRevs(ctx context.Context, q *receive.Quarantine) ([]string, error) {
+	refs, err := q.Refs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	revs := []string{}
+	for name, rev := range refs {
+		if p.IsProtected(name) {
+			revs = append(revs, rev)
+		}
+	}
+	return revs, nil
+}
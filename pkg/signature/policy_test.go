@@ -0,0 +1,147 @@
+package signature
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/matrixhub-ai/hfd/pkg/receive"
+)
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	return gitWithInput(t, dir, "", args...)
+}
+
+func gitWithInput(t *testing.T, dir string, input string, args ...string) string {
+	t.Helper()
+	cmd := exec.CommandContext(t.Context(), "git", args...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(input)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("git %s failed: %v", strings.Join(args, " "), err)
+	}
+	return string(out)
+}
+
+// checkPush runs the policy on a push creating ref at rev, built as a client would send it.
+func checkPush(t *testing.T, p *Policy, repoDir, workDir, ref, rev string) error {
+	t.Helper()
+	return checkUpdate(t, p, repoDir, workDir, ref, receive.ZeroHash, rev)
+}
+
+// checkUpdate runs the policy on a push updating ref from old to rev.
+// The pack holds all the objects reachable from rev, whatever the repository already has.
+func checkUpdate(t *testing.T, p *Policy, repoDir, workDir, ref, old, rev string) error {
+	t.Helper()
+	pack := gitWithInput(t, workDir, rev+"\n", "pack-objects", "--stdout", "--revs")
+	line := fmt.Sprintf("%s %s %s\x00report-status\n", old, rev, ref)
+	input := fmt.Sprintf("%04x%s0000%s", len(line)+4, line, pack)
+
+	updates, replay := receive.ParseRefUpdates(strings.NewReader(input), repoDir)
+	q, err := receive.NewQuarantine(t.Context(), repoDir, replay, updates)
+	if err != nil {
+		t.Fatalf("NewQuarantine: %v", err)
+	}
+	defer q.Close()
+	return p.Check(t.Context(), "repo", q, updates)
+}
+
+func TestPolicy(t *testing.T) {
+	trusted, trustedPEM := newSSHSigner(t)
+	_, untrustedPEM := newSSHSigner(t)
+	keyDir := t.TempDir()
+	trustedKey := filepath.Join(keyDir, "trusted")
+	untrustedKey := filepath.Join(keyDir, "untrusted")
+	for path, data := range map[string][]byte{trustedKey: trustedPEM, untrustedKey: untrustedPEM} {
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	allowedSigners := filepath.Join(keyDir, "allowed_signers")
+	line := "dev@example.com,ops@example.com namespaces=\"git\" " + string(ssh.MarshalAuthorizedKey(trusted.ssh.PublicKey()))
+	if err := os.WriteFile(allowedSigners, []byte("# trusted keys\n"+line), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := NewVerifier()
+	if err := verifier.LoadAllowedSigners(allowedSigners); err != nil {
+		t.Fatalf("LoadAllowedSigners: %v", err)
+	}
+	p := NewPolicy(verifier, WithProtectedRefs("refs/heads/main", "refs/tags/*"))
+
+	repoDir := filepath.Join(t.TempDir(), "repo.git")
+	workDir := t.TempDir()
+	git(t, "", "init", "--bare", "--initial-branch=main", repoDir)
+	git(t, "", "init", "--initial-branch=main", workDir)
+	git(t, workDir, "config", "user.email", "dev@example.com")
+	git(t, workDir, "config", "user.name", "Dev")
+	git(t, workDir, "config", "gpg.format", "ssh")
+	commit := func(message string, args ...string) string {
+		git(t, workDir, append([]string{"commit", "--allow-empty", "-m", message}, args...)...)
+		return strings.TrimSpace(git(t, workDir, "rev-parse", "HEAD"))
+	}
+
+	signed := commit("Signed", "-S"+trustedKey)
+	if err := checkPush(t, p, repoDir, workDir, "refs/heads/main", signed); err != nil {
+		t.Fatalf("expected a push of a verified commit to be accepted, got %v", err)
+	}
+	if result := verifier.VerifyCommit(signed, nil); !result.Verified || result.Signer != "dev@example.com" {
+		t.Errorf("expected the verification of %s to be cached, got %+v", signed, result)
+	}
+
+	unsigned := commit("Unsigned")
+	err := checkPush(t, p, repoDir, workDir, "refs/heads/main", unsigned)
+	if err == nil || !strings.Contains(err.Error(), unsigned+": unsigned") {
+		t.Fatalf("expected a push of an unsigned commit to be rejected, got %v", err)
+	}
+	if err := checkPush(t, p, repoDir, workDir, "refs/heads/dev", unsigned); err != nil {
+		t.Fatalf("expected a push to an unprotected ref to be accepted, got %v", err)
+	}
+
+	unknown := commit("Unknown signer", "-S"+untrustedKey)
+	err = checkPush(t, p, repoDir, workDir, "refs/heads/main", unknown)
+	if err == nil || !strings.Contains(err.Error(), unknown+": unknown_key") {
+		t.Fatalf("expected a push of a commit of an unknown signer to be rejected, got %v", err)
+	}
+
+	git(t, workDir, "reset", "--hard", signed)
+	git(t, workDir, "tag", "-s", "-u", trustedKey, "-m", "Release", "v1")
+	tag := strings.TrimSpace(git(t, workDir, "rev-parse", "v1"))
+	if err := checkPush(t, p, repoDir, workDir, "refs/tags/v1", tag); err != nil {
+		t.Fatalf("expected a push of a verified tag to be accepted, got %v", err)
+	}
+	git(t, workDir, "tag", "-a", "-m", "Release", "v2")
+	tag = strings.TrimSpace(git(t, workDir, "rev-parse", "v2"))
+	err = checkPush(t, p, repoDir, workDir, "refs/tags/v2", tag)
+	if err == nil || !strings.Contains(err.Error(), "tag "+tag+": unsigned") {
+		t.Fatalf("expected a push of an unsigned tag to be rejected, got %v", err)
+	}
+
+	// Commits already pushed to an unprotected ref are verified when they are brought to a protected one
+	git(t, workDir, "push", repoDir, signed+":refs/heads/main", unsigned+":refs/heads/dev")
+	err = checkUpdate(t, p, repoDir, workDir, "refs/heads/main", signed, unsigned)
+	if err == nil || !strings.Contains(err.Error(), unsigned+": unsigned") {
+		t.Fatalf("expected a fast-forward to an unsigned commit of another ref to be rejected, got %v", err)
+	}
+	err = checkPush(t, p, repoDir, workDir, "refs/tags/v3", unsigned)
+	if err == nil || !strings.Contains(err.Error(), unsigned+": unsigned") {
+		t.Fatalf("expected a tag of an unsigned commit of another ref to be rejected, got %v", err)
+	}
+	if err := checkPush(t, p, repoDir, workDir, "refs/tags/v4", signed); err != nil {
+		t.Fatalf("expected a tag of a verified commit to be accepted, got %v", err)
+	}
+
+	git(t, workDir, "config", "user.email", "intruder@example.com")
+	mismatch := commit("Other committer", "-S"+trustedKey)
+	err = checkPush(t, p, repoDir, workDir, "refs/heads/main", mismatch)
+	if err == nil || !strings.Contains(err.Error(), mismatch+": identity_mismatch") {
+		t.Fatalf("expected a push of a commit signed for another committer to be rejected, got %v", err)
+	}
+}
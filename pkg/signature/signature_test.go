@@ -0,0 +1,150 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"golang.org/x/crypto/ssh"
+)
+
+func newSSHSigner(t *testing.T) (*Signer, []byte) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	keyPEM := pem.EncodeToMemory(block)
+	s, err := NewSSHSigner(keyPEM)
+	if err != nil {
+		t.Fatalf("NewSSHSigner: %v", err)
+	}
+	return s, keyPEM
+}
+
+func newOpenPGPSigner(t *testing.T) *Signer {
+	t.Helper()
+	entity, err := openpgp.NewEntity("Hub", "", "hub@example.com", nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatalf("armor: %v", err)
+	}
+	if err := entity.SerializePrivate(w, nil); err != nil {
+		t.Fatalf("serialize key: %v", err)
+	}
+	_ = w.Close()
+
+	path := filepath.Join(t.TempDir(), "key.asc")
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	s, err := LoadSigner(path)
+	if err != nil {
+		t.Fatalf("LoadSigner: %v", err)
+	}
+	if s.Format() != FormatOpenPGP {
+		t.Fatalf("expected an OpenPGP signer, got %s", s.Format())
+	}
+	return s
+}
+
+func TestVerify(t *testing.T) {
+	payload := []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n\nmessage\n")
+
+	sshSigner, _ := newSSHSigner(t)
+	for _, s := range []*Signer{sshSigner, newOpenPGPSigner(t)} {
+		t.Run(string(s.Format()), func(t *testing.T) {
+			sig, err := s.Sign(payload)
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			if FormatOf(string(sig)) != s.Format() || !bytes.HasSuffix(sig, []byte("\n")) {
+				t.Fatalf("unexpected signature %q", sig)
+			}
+
+			v := NewVerifier()
+			result := v.Verify(payload, string(sig))
+			if result.Verified || result.Status != StatusUnknownKey {
+				t.Errorf("expected an untrusted key, got %+v", result)
+			}
+
+			v.TrustSigner(s, "hub@example.com")
+			result = v.Verify(payload, string(sig))
+			if !result.Verified || result.Status != StatusValid || result.Fingerprint != s.Fingerprint() || result.Signer == "" {
+				t.Errorf("expected a valid signature, got %+v", result)
+			}
+
+			result = v.Verify(append([]byte("tampered "), payload...), string(sig))
+			if result.Verified || result.Status != StatusBadSignature {
+				t.Errorf("expected a bad signature, got %+v", result)
+			}
+		})
+	}
+
+	var v *Verifier
+	if result := v.Verify(payload, ""); result.Status != StatusUnsigned {
+		t.Errorf("expected unsigned, got %+v", result)
+	}
+	if result := v.Verify(payload, "-----BEGIN SSH SIGNATURE-----\ngarbage\n-----END SSH SIGNATURE-----\n"); result.Status != StatusMalformedSignature {
+		t.Errorf("expected a malformed signature, got %+v", result)
+	}
+}
+
+// TestSSHSignatureInterop checks signatures against ssh-keygen, which git uses to verify them.
+func TestSSHSignatureInterop(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not found")
+	}
+	dir := t.TempDir()
+	s, keyPEM := newSSHSigner(t)
+	payload := []byte("payload\n")
+
+	sig, err := s.Sign(payload)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	allowed := "signer@example.com " + string(ssh.MarshalAuthorizedKey(s.ssh.PublicKey()))
+	if err := os.WriteFile(filepath.Join(dir, "allowed_signers"), []byte(allowed), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "payload.sig"), sig, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("ssh-keygen", "-Y", "verify", "-f", filepath.Join(dir, "allowed_signers"), "-I", "signer@example.com", "-n", "git", "-s", filepath.Join(dir, "payload.sig"))
+	cmd.Stdin = bytes.NewReader(payload)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen rejected the signature: %v\n%s", err, out)
+	}
+
+	// And the other way around
+	keyFile := filepath.Join(dir, "key")
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cmd = exec.Command("ssh-keygen", "-Y", "sign", "-f", keyFile, "-n", "git")
+	cmd.Stdin = bytes.NewReader(payload)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("ssh-keygen sign: %v", err)
+	}
+	v := NewVerifier()
+	v.TrustSigner(s, "signer@example.com")
+	if result := v.Verify(payload, string(out)); !result.Verified {
+		t.Errorf("expected the signature of ssh-keygen to be valid, got %+v", result)
+	}
+}
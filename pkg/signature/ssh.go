@@ -0,0 +1,119 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSH signatures follow the SSHSIG format of OpenSSH (PROTOCOL.sshsig),
+// with the namespace git signs commits and tags in.
+const (
+	sshsigMagic     = "SSHSIG"
+	sshsigVersion   = 1
+	sshsigNamespace = "git"
+	sshsigPEMType   = "SSH SIGNATURE"
+)
+
+var errMalformedSSHSignature = errors.New("malformed SSH signature")
+
+// sshsigBlob is the content of an armored SSH signature, after the magic preamble.
+type sshsigBlob struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// sshsigSignedData is the data actually signed, after the magic preamble.
+type sshsigSignedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+func signSSH(s ssh.Signer, payload []byte) ([]byte, error) {
+	h := sha512.Sum512(payload)
+	signed := append([]byte(sshsigMagic), ssh.Marshal(sshsigSignedData{
+		Namespace:     sshsigNamespace,
+		HashAlgorithm: "sha512",
+		Hash:          h[:],
+	})...)
+
+	var sig *ssh.Signature
+	var err error
+	if as, ok := s.(ssh.AlgorithmSigner); ok && s.PublicKey().Type() == ssh.KeyAlgoRSA {
+		// ssh-rsa signatures use SHA-1, which OpenSSH refuses for SSHSIG
+		sig, err = as.SignWithAlgorithm(rand.Reader, signed, ssh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = s.Sign(rand.Reader, signed)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+
+	blob := append([]byte(sshsigMagic), ssh.Marshal(sshsigBlob{
+		Version:       sshsigVersion,
+		PublicKey:     s.PublicKey().Marshal(),
+		Namespace:     sshsigNamespace,
+		HashAlgorithm: "sha512",
+		Signature:     ssh.Marshal(sig),
+	})...)
+	return pem.EncodeToMemory(&pem.Block{Type: sshsigPEMType, Bytes: blob}), nil
+}
+
+// verifySSH checks an armored SSH signature of payload, returning the public key that made it.
+func verifySSH(armored []byte, payload []byte) (ssh.PublicKey, error) {
+	block, _ := pem.Decode(armored)
+	if block == nil || block.Type != sshsigPEMType || !bytes.HasPrefix(block.Bytes, []byte(sshsigMagic)) {
+		return nil, errMalformedSSHSignature
+	}
+	var blob sshsigBlob
+	if err := ssh.Unmarshal(block.Bytes[len(sshsigMagic):], &blob); err != nil {
+		return nil, errMalformedSSHSignature
+	}
+	if blob.Version != sshsigVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", errMalformedSSHSignature, blob.Version)
+	}
+	if blob.Namespace != sshsigNamespace {
+		return nil, fmt.Errorf("%w: unexpected namespace %q", errMalformedSSHSignature, blob.Namespace)
+	}
+	pub, err := ssh.ParsePublicKey(blob.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformedSSHSignature, err)
+	}
+	var sig ssh.Signature
+	if err := ssh.Unmarshal(blob.Signature, &sig); err != nil {
+		return nil, errMalformedSSHSignature
+	}
+
+	var h hash.Hash
+	switch blob.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("%w: unsupported hash algorithm %q", errMalformedSSHSignature, blob.HashAlgorithm)
+	}
+	h.Write(payload)
+	signed := append([]byte(sshsigMagic), ssh.Marshal(sshsigSignedData{
+		Namespace:     blob.Namespace,
+		HashAlgorithm: blob.HashAlgorithm,
+		Hash:          h.Sum(nil),
+	})...)
+	if err := pub.Verify(signed, &sig); err != nil {
+		return pub, err
+	}
+	return pub, nil
+}
@@ -0,0 +1,255 @@
+package signature
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/matrixhub-ai/hfd/internal/lru"
+)
+
+// Status is the outcome of the verification of a signature.
+type Status string
+
+const (
+	// StatusValid means the signature is good and made by a trusted key.
+	StatusValid Status = "valid"
+	// StatusUnsigned means there is no signature.
+	StatusUnsigned Status = "unsigned"
+	// StatusUnknownKey means the signature was made by a key that is not trusted.
+	// SSH signatures carry their public key, so they are known to be good anyway.
+	StatusUnknownKey Status = "unknown_key"
+	// StatusBadSignature means the signature does not match the signed content.
+	StatusBadSignature Status = "bad_signature"
+	// StatusMalformedSignature means the signature cannot be parsed.
+	StatusMalformedSignature Status = "malformed_signature"
+	// StatusUnsupportedFormat means the signature is in a format that is not verified.
+	StatusUnsupportedFormat Status = "unsupported_format"
+	// StatusIdentityMismatch means the signature is good and made by a trusted key,
+	// but the key does not belong to the committer or tagger of the object.
+	StatusIdentityMismatch Status = "identity_mismatch"
+)
+
+// Verification is the result of the verification of a signature.
+type Verification struct {
+	// Verified reports whether the signature is valid and made by a trusted key.
+	Verified bool
+	Status   Status
+	Format   Format
+	// Fingerprint is the fingerprint of the key that made the signature, when known.
+	Fingerprint string
+	// Signer is the identity the trusted key belongs to.
+	Signer string
+	// principals are the email patterns of the identities the trusted key belongs to.
+	principals []string
+}
+
+// Verifier verifies signatures against a set of trusted keys.
+// A nil Verifier trusts no key, but still tells good signatures from bad ones where the format allows.
+type Verifier struct {
+	mu      sync.RWMutex
+	sshKeys map[string][]string // fingerprint to principals, the first one being the identity
+	keyring openpgp.EntityList
+	// openPGPPrincipals overrides the principals of the OpenPGP keys, by fingerprint,
+	// which otherwise are the emails of their user IDs.
+	openPGPPrincipals map[string][]string
+	// results caches the verifications of objects by hash, which are cleared when the trusted keys change.
+	results *lru.Cache[string, Verification]
+}
+
+// NewVerifier returns a verifier trusting no key.
+func NewVerifier() *Verifier {
+	return &Verifier{
+		sshKeys:           map[string][]string{},
+		openPGPPrincipals: map[string][]string{},
+		results:           lru.New[string, Verification](16 * 1024),
+	}
+}
+
+// TrustSigner trusts the public key of a signer for the objects made by identity, an email pattern
+// such as "hub@example.com" or "*" for any identity.
+func (v *Verifier) TrustSigner(s *Signer, identity string) {
+	if s.format == FormatSSH {
+		v.TrustSSHKey(s.ssh.PublicKey(), identity)
+		return
+	}
+	v.TrustOpenPGPKeys(openpgp.EntityList{s.openPGP})
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.openPGPPrincipals[s.Fingerprint()] = []string{identity}
+	v.results.Clear()
+}
+
+// TrustSSHKey trusts an SSH public key for the objects made by principals, the email patterns
+// of the identities the key belongs to as in git's allowed signers. The first principal names the owner of the key.
+func (v *Verifier) TrustSSHKey(pub ssh.PublicKey, principals ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.sshKeys[ssh.FingerprintSHA256(pub)] = principals
+	v.results.Clear()
+}
+
+// TrustOpenPGPKeys trusts OpenPGP public keys.
+func (v *Verifier) TrustOpenPGPKeys(keys openpgp.EntityList) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.keyring = append(v.keyring, keys...)
+	v.results.Clear()
+}
+
+// VerifyCommit verifies the signature of a commit object from its raw content,
+// made by a key belonging to its committer. Results are cached by the hash of the object.
+func (v *Verifier) VerifyCommit(hash string, raw []byte) Verification {
+	return v.verifyObject(hash, raw, SplitCommit, "committer")
+}
+
+// VerifyTag verifies the signature of a tag object from its raw content,
+// made by a key belonging to its tagger. Results are cached by the hash of the object.
+func (v *Verifier) VerifyTag(hash string, raw []byte) Verification {
+	return v.verifyObject(hash, raw, SplitTag, "tagger")
+}
+
+func (v *Verifier) verifyObject(hash string, raw []byte, split func([]byte) ([]byte, string), identityHeader string) Verification {
+	if v != nil {
+		if result, ok := v.results.Get(hash); ok {
+			return result
+		}
+	}
+	result := v.Verify(split(raw))
+	if result.Verified {
+		email := headerEmail(raw, identityHeader)
+		principal, ok := matchPrincipal(result.principals, email)
+		if !ok {
+			result.Verified = false
+			result.Status = StatusIdentityMismatch
+		} else if strings.ContainsAny(principal, "*?[") {
+			// The key is trusted for any matching identity, so it is reported as the one of the object.
+			result.Signer = email
+		}
+	}
+	if v != nil {
+		v.results.Add(hash, result)
+	}
+	return result
+}
+
+// matchPrincipal returns the principal matching email, compared case-insensitively.
+func matchPrincipal(principals []string, email string) (string, bool) {
+	if email == "" {
+		return "", false
+	}
+	for _, principal := range principals {
+		if ok, _ := path.Match(strings.ToLower(principal), strings.ToLower(email)); ok {
+			return principal, true
+		}
+	}
+	return "", false
+}
+
+// Verify verifies the armored signature of payload. An empty signature gives StatusUnsigned.
+func (v *Verifier) Verify(payload []byte, sig string) Verification {
+	if sig == "" {
+		return Verification{Status: StatusUnsigned}
+	}
+
+	switch format := FormatOf(sig); format {
+	case FormatSSH:
+		return v.verifySSH(payload, sig)
+	case FormatOpenPGP:
+		return v.verifyOpenPGP(payload, sig)
+	case FormatX509:
+		return Verification{Status: StatusUnsupportedFormat, Format: format}
+	default:
+		return Verification{Status: StatusMalformedSignature}
+	}
+}
+
+func (v *Verifier) verifySSH(payload []byte, sig string) Verification {
+	result := Verification{Format: FormatSSH}
+	pub, err := verifySSH([]byte(sig), payload)
+	if err != nil {
+		if errors.Is(err, errMalformedSSHSignature) {
+			result.Status = StatusMalformedSignature
+		} else {
+			result.Status = StatusBadSignature
+		}
+		return result
+	}
+	result.Fingerprint = ssh.FingerprintSHA256(pub)
+
+	var principals []string
+	ok := false
+	if v != nil {
+		v.mu.RLock()
+		principals, ok = v.sshKeys[result.Fingerprint]
+		v.mu.RUnlock()
+	}
+	if !ok {
+		result.Status = StatusUnknownKey
+		return result
+	}
+	result.Verified = true
+	result.Status = StatusValid
+	result.principals = principals
+	if len(principals) != 0 {
+		result.Signer = principals[0]
+	}
+	return result
+}
+
+func (v *Verifier) verifyOpenPGP(payload []byte, sig string) Verification {
+	result := Verification{Format: FormatOpenPGP}
+
+	var keyring openpgp.EntityList
+	var principals map[string][]string
+	if v != nil {
+		v.mu.RLock()
+		keyring = v.keyring
+		principals = v.openPGPPrincipals
+		v.mu.RUnlock()
+	}
+	signer, err := openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(payload), strings.NewReader(sig), nil)
+	switch {
+	case err == nil:
+	case errors.Is(err, pgperrors.ErrUnknownIssuer):
+		result.Status = StatusUnknownKey
+		return result
+	case isStructuralError(err):
+		result.Status = StatusMalformedSignature
+		return result
+	default:
+		result.Status = StatusBadSignature
+		return result
+	}
+
+	result.Verified = true
+	result.Status = StatusValid
+	result.Fingerprint = fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint)
+	for name, identity := range signer.Identities {
+		if result.Signer == "" || name < result.Signer {
+			result.Signer = name
+		}
+		if identity.UserId != nil && identity.UserId.Email != "" {
+			result.principals = append(result.principals, identity.UserId.Email)
+		}
+	}
+	if p, ok := principals[result.Fingerprint]; ok {
+		result.principals = p
+	}
+	return result
+}
+
+// isStructuralError reports whether an OpenPGP signature failed to verify because it cannot be parsed.
+func isStructuralError(err error) bool {
+	var structural pgperrors.StructuralError
+	return errors.As(err, &structural) || errors.Is(err, armor.ArmorCorrupt) || errors.Is(err, io.EOF)
+}
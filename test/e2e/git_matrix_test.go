@@ -18,6 +18,7 @@ import (
 	backendhttp "github.com/matrixhub-ai/hfd/pkg/backend/http"
 	backendlfs "github.com/matrixhub-ai/hfd/pkg/backend/lfs"
 	backendssh "github.com/matrixhub-ai/hfd/pkg/backend/ssh"
+	"github.com/matrixhub-ai/hfd/pkg/packcache"
 	"github.com/matrixhub-ai/hfd/pkg/storage"
 	"golang.org/x/crypto/ssh"
 )
@@ -28,9 +29,28 @@ type testProtocol struct {
 	setupFunc func(t *testing.T) (cloneURL string, env []string, cleanup func())
 }
 
+// nativeProtocolEnv makes git clients use protocol v0 against servers serving git in-process,
+// as the protocol v2 most clients default to is served by the git binaries.
+var nativeProtocolEnv = []string{
+	"GIT_CONFIG_COUNT=1",
+	"GIT_CONFIG_KEY_0=protocol.version",
+	"GIT_CONFIG_VALUE_0=0",
+}
+
 // setupHTTPProtocol creates an HTTP test server and returns its clone URL
 func setupHTTPProtocol(t *testing.T) (cloneURL string, env []string, cleanup func()) {
 	t.Helper()
+	return setupHTTPProtocolWith(t, false)
+}
+
+// setupNativeHTTPProtocol creates an HTTP test server serving git in-process and returns its clone URL
+func setupNativeHTTPProtocol(t *testing.T) (cloneURL string, env []string, cleanup func()) {
+	t.Helper()
+	return setupHTTPProtocolWith(t, true)
+}
+
+func setupHTTPProtocolWith(t *testing.T, nativeGit bool) (cloneURL string, env []string, cleanup func()) {
+	t.Helper()
 
 	dataDir, err := os.MkdirTemp("", "git-http-matrix-data")
 	if err != nil {
@@ -50,6 +70,7 @@ func setupHTTPProtocol(t *testing.T) (cloneURL string, env []string, cleanup fun
 	handler = backendhttp.NewHandler(
 		backendhttp.WithStorage(storage),
 		backendhttp.WithNext(handler),
+		backendhttp.WithNativeGit(nativeGit),
 	)
 
 	server := httptest.NewServer(handler)
@@ -64,8 +85,12 @@ func setupHTTPProtocol(t *testing.T) (cloneURL string, env []string, cleanup fun
 	}
 	resp.Body.Close()
 
+	env = []string{"GIT_TERMINAL_PROMPT=0"}
+	if nativeGit {
+		env = append(env, nativeProtocolEnv...)
+	}
 	return server.URL + "/test-org/test-repo.git",
-		[]string{"GIT_TERMINAL_PROMPT=0"},
+		env,
 		func() {
 			server.Close()
 			os.RemoveAll(dataDir)
@@ -75,6 +100,24 @@ func setupHTTPProtocol(t *testing.T) (cloneURL string, env []string, cleanup fun
 // setupSSHProtocol creates an SSH test server and returns its clone URL
 func setupSSHProtocol(t *testing.T) (cloneURL string, env []string, cleanup func()) {
 	t.Helper()
+	return setupSSHProtocolWith(t, false)
+}
+
+// setupNativeSSHProtocol creates an SSH test server serving git in-process and returns its clone URL
+func setupNativeSSHProtocol(t *testing.T) (cloneURL string, env []string, cleanup func()) {
+	t.Helper()
+	return setupSSHProtocolWith(t, true)
+}
+
+// setupCachedSSHProtocol creates an SSH test server serving fetches through the pack cache and returns its clone URL
+func setupCachedSSHProtocol(t *testing.T) (cloneURL string, env []string, cleanup func()) {
+	t.Helper()
+	packCache := packcache.NewCache(packcache.WithDir(t.TempDir()))
+	return setupSSHProtocolWith(t, false, backendssh.WithPackCache(packCache))
+}
+
+func setupSSHProtocolWith(t *testing.T, nativeGit bool, opts ...backendssh.Option) (cloneURL string, env []string, cleanup func()) {
+	t.Helper()
 
 	dataDir, err := os.MkdirTemp("", "git-ssh-matrix-data")
 	if err != nil {
@@ -156,7 +199,8 @@ func setupSSHProtocol(t *testing.T) (cloneURL string, env []string, cleanup func
 	}
 
 	// Set up SSH server
-	sshServer := backendssh.NewServer(backendssh.WithHostKey(hostKey), backendssh.WithStorage(storage))
+	opts = append(opts, backendssh.WithHostKey(hostKey), backendssh.WithStorage(storage), backendssh.WithNativeGit(nativeGit))
+	sshServer := backendssh.NewServer(opts...)
 	listener, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
 		httpServer.Close()
@@ -173,11 +217,15 @@ func setupSSHProtocol(t *testing.T) (cloneURL string, env []string, cleanup func
 	port := strings.Split(addr.String(), ":")[1]
 	sshCmd := fmt.Sprintf("ssh -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null -i %s -p %s", keyFile, port)
 
+	env = []string{
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_SSH_COMMAND=" + sshCmd,
+	}
+	if nativeGit {
+		env = append(env, nativeProtocolEnv...)
+	}
 	return "ssh://git@" + addr.String() + "/test-org/test-repo.git",
-		[]string{
-			"GIT_TERMINAL_PROMPT=0",
-			"GIT_SSH_COMMAND=" + sshCmd,
-		},
+		env,
 		func() {
 			listener.Close()
 			httpServer.Close()
@@ -197,6 +245,18 @@ func TestGitOperationsMatrix(t *testing.T) {
 			name:      "SSH",
 			setupFunc: setupSSHProtocol,
 		},
+		{
+			name:      "NativeHTTP",
+			setupFunc: setupNativeHTTPProtocol,
+		},
+		{
+			name:      "NativeSSH",
+			setupFunc: setupNativeSSHProtocol,
+		},
+		{
+			name:      "CachedSSH",
+			setupFunc: setupCachedSSHProtocol,
+		},
 	}
 
 	operations := []struct {
@@ -247,6 +307,18 @@ func TestGitOperationsMatrix(t *testing.T) {
 			name: "DeleteTag",
 			test: testDeleteTag,
 		},
+		{
+			name: "ShallowClone",
+			test: testShallowClone,
+		},
+		{
+			name: "PartialClone",
+			test: testPartialClone,
+		},
+		{
+			name: "CloneProtocolV2",
+			test: testCloneProtocolV2,
+		},
 	}
 
 	for _, protocol := range protocols {
@@ -504,6 +576,83 @@ func testDeleteTag(t *testing.T, cloneURL string, env []string) {
 	runGitCmd(t, cloneDir, env, "push", "origin", "--delete", "v1.0")
 }
 
+func testShallowClone(t *testing.T, cloneURL string, env []string) {
+	testPushMoreCommits(t, cloneURL, env)
+
+	clientDir, err := os.MkdirTemp("", "git-test-client")
+	if err != nil {
+		t.Fatalf("Failed to create temp client dir: %v", err)
+	}
+	defer os.RemoveAll(clientDir)
+
+	cloneDir := filepath.Join(clientDir, "clone")
+	runGitCmd(t, "", env, "clone", "--depth", "1", cloneURL, cloneDir)
+	if count := gitOutput(t, cloneDir, env, "rev-list", "--count", "HEAD"); count != "1" {
+		t.Errorf("Expected 1 commit in the shallow clone, got %s", count)
+	}
+
+	runGitCmd(t, cloneDir, env, "fetch", "--deepen", "1")
+	if count := gitOutput(t, cloneDir, env, "rev-list", "--count", "HEAD"); count != "2" {
+		t.Errorf("Expected 2 commits after deepening, got %s", count)
+	}
+}
+
+func testPartialClone(t *testing.T, cloneURL string, env []string) {
+	testPushMoreCommits(t, cloneURL, env)
+
+	clientDir, err := os.MkdirTemp("", "git-test-client")
+	if err != nil {
+		t.Fatalf("Failed to create temp client dir: %v", err)
+	}
+	defer os.RemoveAll(clientDir)
+
+	cloneDir := filepath.Join(clientDir, "clone")
+	runGitCmd(t, "", env, "clone", "--filter=blob:none", cloneURL, cloneDir)
+	if filter := gitOutput(t, cloneDir, env, "config", "remote.origin.partialclonefilter"); filter != "blob:none" {
+		t.Errorf("Expected a partial clone, got filter %q", filter)
+	}
+
+	// The blobs left out are fetched lazily
+	content, err := os.ReadFile(filepath.Join(cloneDir, "file2.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read file2.txt: %v", err)
+	}
+	if string(content) != "Second file\n" {
+		t.Errorf("Unexpected content: %s", content)
+	}
+	runGitCmd(t, cloneDir, env, "log", "-p")
+}
+
+func testCloneProtocolV2(t *testing.T, cloneURL string, env []string) {
+	testPushCommit(t, cloneURL, env)
+
+	clientDir, err := os.MkdirTemp("", "git-test-client")
+	if err != nil {
+		t.Fatalf("Failed to create temp client dir: %v", err)
+	}
+	defer os.RemoveAll(clientDir)
+
+	cloneDir := filepath.Join(clientDir, "clone")
+	runGitCmd(t, "", env, "-c", "protocol.version=2", "clone", cloneURL, cloneDir)
+	runGitCmd(t, cloneDir, env, "-c", "protocol.version=2", "fetch", "origin")
+	if _, err := os.Stat(filepath.Join(cloneDir, "README.md")); err != nil {
+		t.Errorf("Expected README.md in the clone: %v", err)
+	}
+}
+
+// gitOutput runs a git command and returns its trimmed output.
+func gitOutput(t *testing.T, dir string, env []string, args ...string) string {
+	t.Helper()
+	cmd := utils.Command(t.Context(), "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Git command failed: git %s\nError: %v\nOutput: %s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
 func runGitCmd(t *testing.T, dir string, env []string, args ...string) {
 	t.Helper()
 	cmd := utils.Command(t.Context(), "git", args...)
@@ -41,6 +41,14 @@ func TestReceiveHooksMatrix(t *testing.T) {
 			name:      "SSH",
 			setupFunc: setupSSHWithHooks,
 		},
+		{
+			name:      "NativeHTTP",
+			setupFunc: setupNativeHTTPWithHooks,
+		},
+		{
+			name:      "NativeSSH",
+			setupFunc: setupNativeSSHWithHooks,
+		},
 	}
 
 	type hookTest struct {
@@ -86,6 +94,14 @@ func TestPreReceiveHookDenyMatrix(t *testing.T) {
 			name:      "SSH",
 			setupFunc: setupSSHWithHooks,
 		},
+		{
+			name:      "NativeHTTP",
+			setupFunc: setupNativeHTTPWithHooks,
+		},
+		{
+			name:      "NativeSSH",
+			setupFunc: setupNativeSSHWithHooks,
+		},
 	}
 
 	for _, protocol := range protocols {
@@ -139,6 +155,17 @@ func TestPreReceiveHookDenyMatrix(t *testing.T) {
 
 func setupHTTPWithHooks(t *testing.T, preHook receive.PreReceiveHookFunc, postHook receive.PostReceiveHookFunc) (repoURL string, env []string, createRepo func(), cleanup func()) {
 	t.Helper()
+	return setupHTTPWithHooksWith(t, preHook, postHook, false)
+}
+
+// setupNativeHTTPWithHooks is setupHTTPWithHooks with git served in-process.
+func setupNativeHTTPWithHooks(t *testing.T, preHook receive.PreReceiveHookFunc, postHook receive.PostReceiveHookFunc) (repoURL string, env []string, createRepo func(), cleanup func()) {
+	t.Helper()
+	return setupHTTPWithHooksWith(t, preHook, postHook, true)
+}
+
+func setupHTTPWithHooksWith(t *testing.T, preHook receive.PreReceiveHookFunc, postHook receive.PostReceiveHookFunc, nativeGit bool) (repoURL string, env []string, createRepo func(), cleanup func()) {
+	t.Helper()
 
 	dataDir, err := os.MkdirTemp("", "hook-http-data")
 	if err != nil {
@@ -148,7 +175,7 @@ func setupHTTPWithHooks(t *testing.T, preHook receive.PreReceiveHookFunc, postHo
 	storage := storage.NewStorage(storage.WithRootDir(dataDir))
 
 	var httpOpts []backendhttp.Option
-	httpOpts = append(httpOpts, backendhttp.WithStorage(storage))
+	httpOpts = append(httpOpts, backendhttp.WithStorage(storage), backendhttp.WithNativeGit(nativeGit))
 	if preHook != nil {
 		httpOpts = append(httpOpts, backendhttp.WithPreReceiveHookFunc(preHook))
 	}
@@ -169,8 +196,12 @@ func setupHTTPWithHooks(t *testing.T, preHook receive.PreReceiveHookFunc, postHo
 
 	server := httptest.NewServer(handler)
 
+	env = []string{"GIT_TERMINAL_PROMPT=0"}
+	if nativeGit {
+		env = append(env, nativeProtocolEnv...)
+	}
 	return server.URL + "/hook-org/hook-repo.git",
-		[]string{"GIT_TERMINAL_PROMPT=0"},
+		env,
 		func() {
 			resp, err := http.Post(server.URL+"/api/repos/create", "application/json",
 				strings.NewReader(`{"type":"model","name":"hook-repo","organization":"hook-org"}`))
@@ -187,6 +218,17 @@ func setupHTTPWithHooks(t *testing.T, preHook receive.PreReceiveHookFunc, postHo
 
 func setupSSHWithHooks(t *testing.T, preHook receive.PreReceiveHookFunc, postHook receive.PostReceiveHookFunc) (repoURL string, env []string, createRepo func(), cleanup func()) {
 	t.Helper()
+	return setupSSHWithHooksWith(t, preHook, postHook, false)
+}
+
+// setupNativeSSHWithHooks is setupSSHWithHooks with git served in-process.
+func setupNativeSSHWithHooks(t *testing.T, preHook receive.PreReceiveHookFunc, postHook receive.PostReceiveHookFunc) (repoURL string, env []string, createRepo func(), cleanup func()) {
+	t.Helper()
+	return setupSSHWithHooksWith(t, preHook, postHook, true)
+}
+
+func setupSSHWithHooksWith(t *testing.T, preHook receive.PreReceiveHookFunc, postHook receive.PostReceiveHookFunc, nativeGit bool) (repoURL string, env []string, createRepo func(), cleanup func()) {
+	t.Helper()
 
 	dataDir, err := os.MkdirTemp("", "hook-ssh-data")
 	if err != nil {
@@ -241,6 +283,7 @@ func setupSSHWithHooks(t *testing.T, preHook receive.PreReceiveHookFunc, postHoo
 	sshOpts := []backendssh.Option{
 		backendssh.WithHostKey(hostKey),
 		backendssh.WithStorage(storage),
+		backendssh.WithNativeGit(nativeGit),
 	}
 	if preHook != nil {
 		sshOpts = append(sshOpts, backendssh.WithPreReceiveHookFunc(preHook))
@@ -266,11 +309,15 @@ func setupSSHWithHooks(t *testing.T, preHook receive.PreReceiveHookFunc, postHoo
 	port := strings.Split(addr.String(), ":")[1]
 	sshCmd := fmt.Sprintf("ssh -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null -i %s -p %s", keyFile, port)
 
+	env = []string{
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_SSH_COMMAND=" + sshCmd,
+	}
+	if nativeGit {
+		env = append(env, nativeProtocolEnv...)
+	}
 	return "ssh://git@" + addr.String() + "/hook-org/hook-repo.git",
-		[]string{
-			"GIT_TERMINAL_PROMPT=0",
-			"GIT_SSH_COMMAND=" + sshCmd,
-		},
+		env,
 		func() {
 			resp, err := http.Post(httpServer.URL+"/api/repos/create", "application/json",
 				strings.NewReader(`{"type":"model","name":"hook-repo","organization":"hook-org"}`))
@@ -0,0 +1,156 @@
+package e2e_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	backendhf "github.com/matrixhub-ai/hfd/pkg/backend/hf"
+	backendhttp "github.com/matrixhub-ai/hfd/pkg/backend/http"
+	backendssh "github.com/matrixhub-ai/hfd/pkg/backend/ssh"
+	"github.com/matrixhub-ai/hfd/pkg/packcache"
+	"github.com/matrixhub-ai/hfd/pkg/storage"
+)
+
+// TestHTTPPackCache verifies that clones are served from the pack cache, and that
+// the cache does not serve stale packs after a push.
+func TestHTTPPackCache(t *testing.T) {
+	dataDir := t.TempDir()
+	storage := storage.NewStorage(storage.WithRootDir(dataDir))
+	packCache := packcache.NewCache(packcache.WithDir(filepath.Join(dataDir, "pack-cache")))
+
+	var handler http.Handler
+	handler = backendhf.NewHandler(
+		backendhf.WithStorage(storage),
+		backendhf.WithPostReceiveHookFunc(packCache.PostReceiveHook),
+	)
+	handler = backendhttp.NewHandler(
+		backendhttp.WithStorage(storage),
+		backendhttp.WithNext(handler),
+		backendhttp.WithPackCache(packCache),
+		backendhttp.WithPostReceiveHookFunc(packCache.PostReceiveHook),
+	)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/api/repos/create", "application/json",
+		strings.NewReader(`{"type":"model","name":"cached-repo","organization":"test-org"}`))
+	if err != nil {
+		t.Fatalf("Failed to create repo: %v", err)
+	}
+	resp.Body.Close()
+
+	cloneURL := server.URL + "/test-org/cached-repo.git"
+	env := []string{"GIT_TERMINAL_PROMPT=0"}
+	clientDir := t.TempDir()
+
+	workDir := filepath.Join(clientDir, "work")
+	runGitCmd(t, "", env, "clone", cloneURL, workDir)
+	runGitCmd(t, workDir, env, "config", "user.email", "test@test.com")
+	runGitCmd(t, workDir, env, "config", "user.name", "Test User")
+	if err := os.WriteFile(filepath.Join(workDir, "README.md"), []byte("v1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGitCmd(t, workDir, env, "add", "README.md")
+	runGitCmd(t, workDir, env, "commit", "-m", "v1")
+	runGitCmd(t, workDir, env, "push", "origin", "main")
+
+	for _, name := range []string{"clone1", "clone2"} {
+		runGitCmd(t, "", env, "clone", cloneURL, filepath.Join(clientDir, name))
+		content, err := os.ReadFile(filepath.Join(clientDir, name, "README.md"))
+		if err != nil {
+			t.Fatalf("Failed to read README.md: %v", err)
+		}
+		if string(content) != "v1\n" {
+			t.Errorf("Unexpected content: %q", content)
+		}
+	}
+	if packCache.Size() == 0 {
+		t.Error("Expected clone responses to be cached")
+	}
+
+	if err := os.WriteFile(filepath.Join(workDir, "README.md"), []byte("v2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGitCmd(t, workDir, env, "commit", "-am", "v2")
+	runGitCmd(t, workDir, env, "push", "origin", "main")
+
+	cloneDir := filepath.Join(clientDir, "clone3")
+	runGitCmd(t, "", env, "clone", cloneURL, cloneDir)
+	content, err := os.ReadFile(filepath.Join(cloneDir, "README.md"))
+	if err != nil {
+		t.Fatalf("Failed to read README.md: %v", err)
+	}
+	if string(content) != "v2\n" {
+		t.Errorf("Expected content after push, got %q", content)
+	}
+
+	runGitCmd(t, filepath.Join(clientDir, "clone1"), env, "pull", "--ff-only")
+	content, err = os.ReadFile(filepath.Join(clientDir, "clone1", "README.md"))
+	if err != nil {
+		t.Fatalf("Failed to read README.md: %v", err)
+	}
+	if string(content) != "v2\n" {
+		t.Errorf("Expected content after pull, got %q", content)
+	}
+}
+
+// TestSSHPackCache verifies that SSH clones are served from the pack cache with both protocol versions,
+// and that fetches negotiating with the server still work.
+func TestSSHPackCache(t *testing.T) {
+	packCache := packcache.NewCache(packcache.WithDir(t.TempDir()))
+	cloneURL, env, cleanup := setupSSHProtocolWith(t, false, backendssh.WithPackCache(packCache))
+	defer cleanup()
+	clientDir := t.TempDir()
+
+	workDir := filepath.Join(clientDir, "work")
+	runGitCmd(t, "", env, "clone", cloneURL, workDir)
+	runGitCmd(t, workDir, env, "config", "user.email", "test@test.com")
+	runGitCmd(t, workDir, env, "config", "user.name", "Test User")
+	if err := os.WriteFile(filepath.Join(workDir, "README.md"), []byte("v1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGitCmd(t, workDir, env, "add", "README.md")
+	runGitCmd(t, workDir, env, "commit", "-m", "v1")
+	runGitCmd(t, workDir, env, "push", "origin", "main")
+
+	var size int64
+	for _, version := range []string{"0", "2"} {
+		for _, name := range []string{"clone1", "clone2"} {
+			cloneDir := filepath.Join(clientDir, "v"+version, name)
+			runGitCmd(t, "", env, "-c", "protocol.version="+version, "clone", cloneURL, cloneDir)
+			content, err := os.ReadFile(filepath.Join(cloneDir, "README.md"))
+			if err != nil {
+				t.Fatalf("Failed to read README.md: %v", err)
+			}
+			if string(content) != "v1\n" {
+				t.Errorf("Unexpected content: %q", content)
+			}
+		}
+		if packCache.Size() <= size {
+			t.Errorf("Expected protocol v%s clone responses to be cached", version)
+		}
+		size = packCache.Size()
+	}
+
+	if err := os.WriteFile(filepath.Join(workDir, "README.md"), []byte("v2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGitCmd(t, workDir, env, "commit", "-am", "v2")
+	runGitCmd(t, workDir, env, "push", "origin", "main")
+
+	for _, version := range []string{"0", "2"} {
+		cloneDir := filepath.Join(clientDir, "v"+version, "clone1")
+		runGitCmd(t, cloneDir, env, "-c", "protocol.version="+version, "pull", "--ff-only")
+		content, err := os.ReadFile(filepath.Join(cloneDir, "README.md"))
+		if err != nil {
+			t.Fatalf("Failed to read README.md: %v", err)
+		}
+		if string(content) != "v2\n" {
+			t.Errorf("Expected content after protocol v%s pull, got %q", version, content)
+		}
+	}
+}